@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"nanotalon/agent/tools"
+	"nanotalon/logging"
+	"nanotalon/providers"
+	"nanotalon/session"
+)
+
+// approvalTTL is how long a held command waits for /approve before it lapses
+const approvalTTL = 10 * time.Minute
+
+// pendingApproval is a tool call held by the command filter until the user decides
+type pendingApproval struct {
+	call      providers.ToolCall
+	command   string
+	reason    string
+	createdAt time.Time
+}
+
+// isApprovalCommand reports whether a chat message is /approve or /deny
+func isApprovalCommand(message string) bool {
+	message = strings.TrimSpace(message)
+	return message == "/approve" || message == "/deny"
+}
+
+// holdForApproval records a call the command filter held, replacing any earlier one for
+// the session, and returns the tool result telling the model what happened
+func (al *AgentLoop) holdForApproval(sessionID string, tc providers.ToolCall, blocked *tools.CommandBlockedError) string {
+	al.approvalsMu.Lock()
+	if al.approvals == nil {
+		al.approvals = make(map[string]pendingApproval)
+	}
+	al.approvals[sessionID] = pendingApproval{
+		call:      tc,
+		command:   blocked.Command,
+		reason:    blocked.Reason,
+		createdAt: time.Now(),
+	}
+	al.approvalsMu.Unlock()
+
+	slog.Info("Holding tool call for approval", logging.SessionKey, sessionID, "tool", tc.Name, "reason", blocked.Reason)
+	return fmt.Sprintf("Error: %v. It has not been run. Tell the user what the command does and why it is needed; "+
+		"they can reply /approve to run it or /deny to cancel it.", blocked)
+}
+
+// takeApproval removes and returns the session's held call, if it hasn't lapsed
+func (al *AgentLoop) takeApproval(sessionID string) (pendingApproval, bool) {
+	al.approvalsMu.Lock()
+	defer al.approvalsMu.Unlock()
+
+	pending, ok := al.approvals[sessionID]
+	delete(al.approvals, sessionID)
+	if !ok || time.Since(pending.createdAt) > approvalTTL {
+		return pendingApproval{}, false
+	}
+	return pending, true
+}
+
+// heldSince reports whether the session has a call waiting for approval that was held at
+// or after since
+func (al *AgentLoop) heldSince(sessionID string, since time.Time) bool {
+	al.approvalsMu.Lock()
+	defer al.approvalsMu.Unlock()
+
+	pending, ok := al.approvals[sessionID]
+	return ok && !pending.createdAt.Before(since)
+}
+
+// handleApprovalCommand runs or discards the session's held command and returns the reply.
+// The outcome is saved to the session so the model knows about it on the next turn.
+func (al *AgentLoop) handleApprovalCommand(sessionID, message string) string {
+	pending, ok := al.takeApproval(sessionID)
+	if !ok {
+		return "Nothing is waiting for approval."
+	}
+
+	var reply string
+	if strings.TrimSpace(message) == "/deny" {
+		reply = fmt.Sprintf("Cancelled. I won't run `%s`.", pending.command)
+	} else {
+		channel, _, _ := strings.Cut(sessionID, ":")
+		started := time.Now()
+		result, err := al.toolRegistry.ExecuteApproved(pending.call.Name, pending.call.Args)
+		al.recordToolCall(sessionID, channel, pending.call, started, result, err)
+		if err != nil {
+			result = fmt.Sprintf("Error: %v", err)
+		}
+		reply = fmt.Sprintf("Ran the approved command `%s`:\n%s", pending.command, result)
+	}
+
+	al.sessionManager.GetOrCreateSession(sessionID)
+	al.saveSessionMessage(sessionID, session.Message{Role: "assistant", Content: reply})
+	return reply
+}
+
+// approvalResult turns a command the filter held into the tool result for the model.
+// It reports false for any other error.
+func (al *AgentLoop) approvalResult(sessionID string, tc providers.ToolCall, err error) (string, bool) {
+	var blocked *tools.CommandBlockedError
+	if !errors.As(err, &blocked) || !blocked.NeedsApproval {
+		return "", false
+	}
+	return al.holdForApproval(sessionID, tc, blocked), true
+}
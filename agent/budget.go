@@ -0,0 +1,177 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"nanotalon/clock"
+	"nanotalon/providers"
+	"nanotalon/session"
+)
+
+// tokenUsage is the daily token total, persisted in the workspace
+type tokenUsage struct {
+	Date   string `json:"date"`
+	Tokens int    `json:"tokens"`
+}
+
+// tokenBudget enforces agents.defaults.max_request_tokens and daily_token_budget. The
+// daily total is saved in the workspace so restarts don't reset it, and starts over at
+// local midnight. A nil budget allows everything.
+type tokenBudget struct {
+	maxRequest int
+	daily      int
+	path       string
+	clock      clock.Clock
+
+	mu     sync.Mutex
+	usage  tokenUsage
+	loaded bool
+}
+
+// newTokenBudget returns a budget for the configured caps, or nil when neither is set
+func newTokenBudget(maxRequest, daily int, path string, clk clock.Clock) *tokenBudget {
+	if maxRequest <= 0 && daily <= 0 {
+		return nil
+	}
+	return &tokenBudget{maxRequest: maxRequest, daily: daily, path: path, clock: clk}
+}
+
+// defaultUsagePath returns where the daily token total is kept in a workspace
+func defaultUsagePath(workspace string) string {
+	return filepath.Join(workspace, "usage", "tokens.json")
+}
+
+// budgetExceededError reports which cap a model call would have exceeded
+type budgetExceededError struct {
+	daily bool
+	used  int
+	limit int
+}
+
+func (e *budgetExceededError) Error() string {
+	if e.daily {
+		return fmt.Sprintf("today's token budget is used up (%d of %d tokens); it resets at midnight", e.used, e.limit)
+	}
+	return fmt.Sprintf("this request would exceed its token budget (%d of %d tokens used)", e.used, e.limit)
+}
+
+// check returns an error if a call estimated at estimate tokens would take the request,
+// which has used turnUsed tokens so far, or today's total over its cap
+func (b *tokenBudget) check(turnUsed, estimate int) error {
+	if b == nil {
+		return nil
+	}
+	if b.maxRequest > 0 && turnUsed+estimate > b.maxRequest {
+		return &budgetExceededError{used: turnUsed, limit: b.maxRequest}
+	}
+	if b.daily <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if used := b.todayLocked().Tokens; used+estimate > b.daily {
+		return &budgetExceededError{daily: true, used: used, limit: b.daily}
+	}
+	return nil
+}
+
+// record adds the tokens of a model call to today's total
+func (b *tokenBudget) record(tokens int) {
+	if b == nil || b.daily <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	usage := b.todayLocked()
+	usage.Tokens += tokens
+
+	data, err := json.Marshal(usage)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(b.path), 0755); err == nil {
+			err = os.WriteFile(b.path, data, 0644)
+		}
+	}
+	if err != nil {
+		slog.Warn("Could not save token usage", "error", err)
+	}
+}
+
+// todayLocked returns today's usage, loading it on first use and starting over when the
+// date has changed; the caller must hold mu
+func (b *tokenBudget) todayLocked() *tokenUsage {
+	if !b.loaded {
+		b.loaded = true
+		if data, err := os.ReadFile(b.path); err == nil {
+			if err := json.Unmarshal(data, &b.usage); err != nil {
+				slog.Warn("Ignoring unreadable token usage file", "path", b.path, "error", err)
+			}
+		}
+	}
+
+	if today := b.clock.Now().Format("2006-01-02"); b.usage.Date != today {
+		b.usage = tokenUsage{Date: today}
+	}
+	return &b.usage
+}
+
+// chat sends a model request for the turn, enforcing the token budgets and counting the
+// tokens used. Providers that don't report usage are charged an estimate.
+func (al *AgentLoop) chat(t *turn, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	estimate := estimateRequestTokens(req)
+	if err := al.tokenBudget.check(t.tokensUsed, estimate); err != nil {
+		return nil, err
+	}
+
+	response, err := t.provider.Chat(t.ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	used := response.Usage.TotalTokens
+	if used == 0 {
+		used = estimate + session.EstimateTokens(response.Content)
+		for _, tc := range response.ToolCalls {
+			args, _ := json.Marshal(tc.Args)
+			used += session.EstimateTokens(tc.Name) + session.EstimateTokens(string(args))
+		}
+	}
+	t.tokensUsed += used
+	al.tokenBudget.record(used)
+	al.emit(Event{Type: EventTokens, SessionKey: t.sessionID, Content: response.Content, Tokens: used})
+	return response, nil
+}
+
+// estimateRequestTokens approximates the prompt tokens of a request, tool definitions included
+func estimateRequestTokens(req providers.ChatRequest) int {
+	tokens := 0
+	for _, msg := range req.Messages {
+		text, _ := msg.Content.(string)
+		tokens += session.EstimateTokens(text)
+		for _, tc := range msg.ToolCalls {
+			tokens += session.EstimateTokens(tc.Function.Name) + session.EstimateTokens(tc.Function.Arguments)
+		}
+	}
+	if len(req.Tools) > 0 {
+		defs, _ := json.Marshal(req.Tools)
+		tokens += session.EstimateTokens(string(defs))
+	}
+	return tokens
+}
+
+// budgetReply builds the reply for a turn stopped by a token budget from what it produced so far
+func budgetReply(partial string, err error) string {
+	notice := fmt.Sprintf("⚠ I stopped because %v.", err)
+	if partial == "" {
+		return notice
+	}
+	return partial + "\n\n" + notice
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nanotalon/clock"
+	"nanotalon/providers"
+)
+
+func TestRequestTokenBudgetStopsTurn(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{
+			Content:   "Searching first.",
+			ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "web_search", Args: map[string]interface{}{"query": "go"}}},
+			Usage:     providers.Usage{TotalTokens: 6000},
+		},
+	}}
+	al := newTestAgentLoop(t, provider)
+	al.maxIterations = 10
+	al.tokenBudget = newTokenBudget(10000, 0, filepath.Join(al.workspace, "usage.json"), clock.New())
+
+	reply, err := al.ProcessDirect("search forever", "cli:direct")
+	if err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+	if !strings.Contains(reply, "this request would exceed its token budget (12000 of 10000 tokens used)") ||
+		!strings.HasPrefix(reply, "Searching first.") {
+		t.Errorf("Expected the partial answer and a budget notice, got %q", reply)
+	}
+	if len(provider.requests) != 2 {
+		t.Errorf("Expected the third model call to be refused, got %d calls", len(provider.requests))
+	}
+}
+
+func TestDailyTokenBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage", "tokens.json")
+	fake := clock.NewFake(time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local))
+
+	budget := newTokenBudget(0, 1000, path, fake)
+	if err := budget.check(0, 200); err != nil {
+		t.Fatalf("Expected a fresh budget to allow the call, got %v", err)
+	}
+	budget.record(900)
+
+	// The total survives a restart
+	restarted := newTokenBudget(0, 1000, path, fake)
+	if err := restarted.check(0, 200); err == nil || !strings.Contains(err.Error(), "900 of 1000") {
+		t.Errorf("Expected today's budget to be used up, got %v", err)
+	}
+
+	fake.Advance(24 * time.Hour)
+	if err := restarted.check(0, 200); err != nil {
+		t.Errorf("Expected the budget to start over the next day, got %v", err)
+	}
+}
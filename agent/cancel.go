@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// stoppedNotice prefixes the reply of a turn that was cancelled with /stop
+const stoppedNotice = "⏹ Stopped."
+
+// isStopCommand reports whether a chat message is the /stop command
+func isStopCommand(message string) bool {
+	return strings.TrimSpace(message) == "/stop"
+}
+
+// CancelRun cancels the turn currently running for a session, if any. The tool loop stops
+// before its next model call or tool, and the turn returns whatever it has so far.
+// It reports whether a run was cancelled.
+func (al *AgentLoop) CancelRun(sessionKey string) bool {
+	al.runsMu.Lock()
+	defer al.runsMu.Unlock()
+
+	cancel, ok := al.runs[sessionKey]
+	if !ok {
+		return false
+	}
+	cancel()
+	return true
+}
+
+// startRun registers a cancellable context for a session's turn; call the returned
+// function when the turn ends
+func (al *AgentLoop) startRun(sessionKey string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	al.runsMu.Lock()
+	if al.runs == nil {
+		al.runs = make(map[string]context.CancelFunc)
+	}
+	al.runs[sessionKey] = cancel
+	al.runsMu.Unlock()
+
+	return ctx, func() {
+		al.runsMu.Lock()
+		delete(al.runs, sessionKey)
+		al.runsMu.Unlock()
+		cancel()
+	}
+}
+
+// handleStopCommand cancels the session's running turn and returns the reply
+func (al *AgentLoop) handleStopCommand(sessionKey string) string {
+	if al.CancelRun(sessionKey) {
+		return "Stopping the current task…"
+	}
+	return "Nothing is running."
+}
+
+// stoppedReply builds the reply for a cancelled turn from what it produced before stopping
+func stoppedReply(partial string, toolsRun int) string {
+	reply := stoppedNotice
+	if toolsRun > 0 {
+		reply += fmt.Sprintf(" %d tool call(s) finished before stopping.", toolsRun)
+	}
+	if partial = strings.TrimSpace(partial); partial != "" {
+		reply += "\n\n" + partial
+	}
+	return reply
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+
+	"nanotalon/logging"
+	"nanotalon/providers"
+	"nanotalon/session"
+)
+
+// summaryPrompt instructs the model how to maintain the rolling session summary
+const summaryPrompt = `You maintain a running summary of a conversation between a user and an AI assistant.
+Merge the existing summary with the new messages into one updated summary.
+Keep facts about the user, decisions made, results of tool use, open tasks and commitments.
+Drop small talk and anything superseded. Write concise plain prose or bullet points, no preamble.`
+
+// CompactSession summarizes every message of a session except the most recent keepRecent
+// into its rolling summary. It reports whether anything was compacted.
+func (al *AgentLoop) CompactSession(ctx context.Context, sessionID string, keepRecent int) (bool, error) {
+	if keepRecent < 0 {
+		keepRecent = 0
+	}
+
+	// Messages are append-only, so the leading part read here stays stable during the LLM call
+	all, err := al.sessionManager.GetMessageHistory(sessionID, math.MaxInt)
+	if err != nil {
+		return false, err
+	}
+	summary, summarized, err := al.sessionManager.GetSummary(sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	upTo := len(all) - keepRecent
+	if upTo <= summarized {
+		return false, nil
+	}
+
+	newSummary, err := al.summarize(ctx, summary, all[summarized:upTo])
+	if err != nil {
+		return false, err
+	}
+
+	if err := al.sessionManager.SetSummary(sessionID, newSummary, upTo); err != nil {
+		return false, fmt.Errorf("error saving summary: %w", err)
+	}
+	return true, nil
+}
+
+// maybeCompact folds turns that have fallen out of the memory window into the summary.
+// It waits until half a window has been evicted so the LLM isn't called on every turn.
+func (al *AgentLoop) maybeCompact(ctx context.Context, sessionID string) {
+	if !al.config.Agents.Defaults.AutoCompact || al.memoryWindow <= 0 {
+		return
+	}
+
+	_, summarized, err := al.sessionManager.GetSummary(sessionID)
+	if err != nil {
+		return
+	}
+	history, err := al.sessionManager.GetMessageHistory(sessionID, math.MaxInt)
+	if err != nil {
+		return
+	}
+
+	if len(history)-summarized <= al.memoryWindow+al.memoryWindow/2 {
+		return
+	}
+
+	if _, err := al.CompactSession(ctx, sessionID, al.memoryWindow); err != nil {
+		slog.WarnContext(ctx, "Could not compact session", logging.SessionKey, sessionID, "error", err)
+	}
+}
+
+// summarize asks the model to merge messages into the existing summary
+func (al *AgentLoop) summarize(ctx context.Context, existing string, messages []session.Message) (string, error) {
+	var transcript strings.Builder
+	if existing != "" {
+		transcript.WriteString("Existing summary:\n")
+		transcript.WriteString(existing)
+		transcript.WriteString("\n\n")
+	}
+	transcript.WriteString("New messages:\n")
+	for _, msg := range messages {
+		if msg.Content != "" {
+			transcript.WriteString(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+		}
+		for _, tc := range msg.ToolCalls {
+			args, _ := json.Marshal(tc.Arguments)
+			transcript.WriteString(fmt.Sprintf("%s: [called %s %s]\n", msg.Role, tc.Name, args))
+		}
+	}
+
+	response, err := al.provider.Chat(ctx, providers.ChatRequest{
+		Messages: []providers.Message{
+			{Role: "system", Content: summaryPrompt},
+			{Role: "user", Content: transcript.String()},
+		},
+		Model:       al.model,
+		Temperature: 0.2,
+		MaxTokens:   al.maxTokens,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error summarizing session: %w", err)
+	}
+
+	summary := strings.TrimSpace(response.Content)
+	if summary == "" {
+		return "", fmt.Errorf("model returned an empty summary")
+	}
+	return summary, nil
+}
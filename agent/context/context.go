@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"nanotalon/agent/memory"
@@ -16,8 +17,19 @@ import (
 type ContextBuilder struct {
 	workspace      string
 	memory         *memory.MemoryStore
+	scopes         *memory.Scopes
 	skills         *skills.SkillsLoader
 	bootstrapFiles []string
+
+	// The system prompt of each memory view is rebuilt only when one of its source files changes
+	cacheMu sync.Mutex
+	cache   map[string]cachedPrompt
+}
+
+// cachedPrompt is a built system prompt with the signature of the files it was built from
+type cachedPrompt struct {
+	prompt     string
+	sourcesSig string
 }
 
 // NewContextBuilder creates a new context builder
@@ -25,17 +37,29 @@ func NewContextBuilder(workspace string) *ContextBuilder {
 	return &ContextBuilder{
 		workspace:      workspace,
 		memory:         memory.NewMemoryStore(workspace),
+		scopes:         memory.NewScopes(workspace),
 		skills:         skills.NewSkillsLoader(workspace, ""),
 		bootstrapFiles: []string{"AGENTS.md", "SOUL.md", "USER.md", "TOOLS.md", "IDENTITY.md"},
+		cache:          make(map[string]cachedPrompt),
 	}
 }
 
-// BuildSystemPrompt builds the system prompt from bootstrap files, memory, and skills
+// globalView is the memory view of chats that only use global memory
+func (cb *ContextBuilder) globalView() memory.View {
+	return cb.scopes.View("", "", memory.TierGlobal, nil)
+}
+
+// BuildSystemPrompt builds the system prompt from bootstrap files, global memory, and skills
 func (cb *ContextBuilder) BuildSystemPrompt(skillNames []string) (string, error) {
+	return cb.buildSystemPrompt(cb.globalView())
+}
+
+// buildSystemPrompt builds the system prompt with the memory of a view
+func (cb *ContextBuilder) buildSystemPrompt(view memory.View) (string, error) {
 	var parts []string
 
 	// Core identity
-	parts = append(parts, cb.getIdentity())
+	parts = append(parts, cb.getIdentity(view))
 
 	// Bootstrap files
 	bootstrap, err := cb.loadBootstrapFiles()
@@ -46,13 +70,23 @@ func (cb *ContextBuilder) BuildSystemPrompt(skillNames []string) (string, error)
 		parts = append(parts, bootstrap)
 	}
 
-	// Memory context
-	memContext, err := cb.memory.GetMemoryContext()
-	if err != nil {
-		return "", err
+	// Memory context, from the most general scope to the most specific
+	var memParts []string
+	for _, scope := range view.Read {
+		memContext, err := memory.NewMemoryStoreAt(scope.Dir).GetMemoryContext()
+		if err != nil {
+			return "", err
+		}
+		if memContext == "" {
+			continue
+		}
+		if len(view.Read) > 1 || scope.Name != memory.TierGlobal {
+			memContext = strings.Replace(memContext, "## Long-term Memory", fmt.Sprintf("## Long-term Memory (%s)", scope.Name), 1)
+		}
+		memParts = append(memParts, memContext)
 	}
-	if memContext != "" {
-		parts = append(parts, fmt.Sprintf("# Memory\n\n%s", memContext))
+	if len(memParts) > 0 {
+		parts = append(parts, fmt.Sprintf("# Memory\n\n%s", strings.Join(memParts, "\n\n")))
 	}
 
 	// Skills - progressive loading
@@ -88,9 +122,64 @@ Skills with available="false" need dependencies installed first - you can try in
 	return strings.Join(parts, "\n\n---\n\n"), nil
 }
 
-// getIdentity gets the core identity section
-func (cb *ContextBuilder) getIdentity() string {
+// SystemPrompt returns the system prompt with global memory, reusing the last build while
+// the bootstrap files, long-term memory and skills it was built from are unchanged
+func (cb *ContextBuilder) SystemPrompt() (string, error) {
+	return cb.SystemPromptFor(cb.globalView())
+}
+
+// SystemPromptFor returns the system prompt with the memory of a view, cached like SystemPrompt
+func (cb *ContextBuilder) SystemPromptFor(view memory.View) (string, error) {
+	signature := cb.sourcesSignature(view)
+
+	cb.cacheMu.Lock()
+	defer cb.cacheMu.Unlock()
+
+	key := view.Key()
+	if cached, ok := cb.cache[key]; ok && signature == cached.sourcesSig {
+		return cached.prompt, nil
+	}
+
+	prompt, err := cb.buildSystemPrompt(view)
+	if err != nil {
+		return "", err
+	}
+	cb.cache[key] = cachedPrompt{prompt: prompt, sourcesSig: signature}
+	return prompt, nil
+}
+
+// sourcesSignature fingerprints the files the system prompt is built from by name, size
+// and modification time, so edits by the user or the agent's own tools are picked up
+func (cb *ContextBuilder) sourcesSignature(view memory.View) string {
+	var b strings.Builder
+	stamp := func(path string) {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+
+	for _, filename := range cb.bootstrapFiles {
+		stamp(filepath.Join(cb.workspace, filename))
+	}
+	for _, scope := range view.Read {
+		stamp(filepath.Join(scope.Dir, "MEMORY.md"))
+	}
+	for _, dir := range cb.skills.Dirs() {
+		stamp(dir)
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				stamp(filepath.Join(dir, entry.Name(), "SKILL.md"))
+			}
+		}
+	}
+	return b.String()
+}
+
+// getIdentity gets the core identity section; memory paths point at the view's write scope
+func (cb *ContextBuilder) getIdentity(view memory.View) string {
 	workspacePath := cb.workspace
+	memoryPath := view.Write.Dir
 	runtimeInfo := fmt.Sprintf("%s %s, Go", getOSName(), runtime.GOARCH)
 
 	return fmt.Sprintf(`# nanobot 🐈
@@ -102,8 +191,8 @@ You are nanobot, a helpful AI assistant.
 
 ## Workspace
 Your workspace is at: %s
-- Long-term memory: %s/memory/MEMORY.md
-- History log: %s/memory/HISTORY.md (grep-searchable)
+- Long-term memory: %s/MEMORY.md
+- History log: %s/HISTORY.md (grep-searchable; older entries are archived in HISTORY-YYYY-MM.md)
 - Custom skills: %s/skills/{{skill-name}}/SKILL.md
 
 Reply directly with text for conversations. Only use the 'message' tool to send to a specific chat channel.
@@ -116,15 +205,25 @@ Reply directly with text for conversations. Only use the 'message' tool to send
 - If a tool call fails, analyze the error before retrying with a different approach.
 
 ## Memory
-- Remember important facts: write to %s/memory/MEMORY.md
-- Recall past events: grep %s/memory/HISTORY.md`,
+- Remember important facts: write to %s/MEMORY.md
+- Exact details such as birthdays, addresses and preferences: fact_assert, then fact_query to recall them
+- Recall past events: grep %s/HISTORY*.md%s`,
 		runtimeInfo,
 		workspacePath,
+		memoryPath,
+		memoryPath,
 		workspacePath,
-		workspacePath,
-		workspacePath,
-		workspacePath,
-		workspacePath)
+		memoryPath,
+		memoryPath,
+		scopeNote(view))
+}
+
+// scopeNote tells the model which memory scope this chat uses, if it isn't global only
+func scopeNote(view memory.View) string {
+	if len(view.Read) == 1 && view.Write.Name == memory.TierGlobal {
+		return ""
+	}
+	return fmt.Sprintf("\n- This chat's memory scope is %s; keep memories in its files above, not in other scopes' memory directories", view.Write.Name)
 }
 
 // getOSName returns a human-readable OS name
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"time"
+)
+
+// Event types emitted while the agent works on a turn
+const (
+	EventTurnStarted  = "turn_started"  // Content is the user's message
+	EventToolCall     = "tool_call"     // Tool and Args are set
+	EventToolResult   = "tool_result"   // Tool, Result and, if it failed, Error are set
+	EventTokens       = "tokens"        // Content is the text of a model response, Tokens what the call used
+	EventTurnFinished = "turn_finished" // Content is the reply
+	EventError        = "error"         // The turn failed with Error
+)
+
+// eventBufferSize is how many events a subscriber can fall behind before it misses some
+const eventBufferSize = 256
+
+// Event describes one step of a turn, so observers such as the gateway API, a TUI or
+// logs all see a run the same way. Providers don't stream yet, so each model response
+// arrives as a single tokens event.
+type Event struct {
+	Type       string                 `json:"type"`
+	SessionKey string                 `json:"session_key"`
+	Time       time.Time              `json:"time"`
+	Content    string                 `json:"content,omitempty"`
+	Tool       string                 `json:"tool,omitempty"`
+	Args       map[string]interface{} `json:"args,omitempty"`
+	Result     string                 `json:"result,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Tokens     int                    `json:"tokens,omitempty"`
+}
+
+// Events subscribes to the events of every turn and returns the channel they arrive on.
+// Each call returns a new subscription. A subscriber that falls behind misses events
+// rather than slowing the agent down. The channel is closed by CloseEvents or Stop.
+func (al *AgentLoop) Events() <-chan Event {
+	al.eventsMu.Lock()
+	defer al.eventsMu.Unlock()
+
+	ch := make(chan Event, eventBufferSize)
+	if al.eventsClosed {
+		close(ch)
+		return ch
+	}
+	al.eventSubscribers = append(al.eventSubscribers, ch)
+	return ch
+}
+
+// CloseEvents ends a subscription returned by Events and closes its channel
+func (al *AgentLoop) CloseEvents(events <-chan Event) {
+	al.eventsMu.Lock()
+	defer al.eventsMu.Unlock()
+
+	for i, ch := range al.eventSubscribers {
+		if ch == events {
+			al.eventSubscribers = append(al.eventSubscribers[:i], al.eventSubscribers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+// closeAllEvents ends every subscription; later calls to Events get a closed channel
+func (al *AgentLoop) closeAllEvents() {
+	al.eventsMu.Lock()
+	defer al.eventsMu.Unlock()
+
+	for _, ch := range al.eventSubscribers {
+		close(ch)
+	}
+	al.eventSubscribers = nil
+	al.eventsClosed = true
+}
+
+// emit sends an event to every subscriber without blocking
+func (al *AgentLoop) emit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	al.eventsMu.Lock()
+	defer al.eventsMu.Unlock()
+
+	for _, ch := range al.eventSubscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"nanotalon/agent/memory"
+	"nanotalon/providers"
+)
+
+// Longest user ask and outcome kept in a history record, in characters
+const (
+	historyAskChars     = 200
+	historyOutcomeChars = 300
+)
+
+// fileTools are the tools whose "path" argument names a file the turn changed
+var fileTools = map[string]bool{"write_file": true, "edit_file": true}
+
+// track records which tools a successful call used and the files it changed
+func (t *turn) track(tc providers.ToolCall) {
+	if !containsString(t.toolsUsed, tc.Name) {
+		t.toolsUsed = append(t.toolsUsed, tc.Name)
+	}
+	if path, ok := tc.Args["path"].(string); ok && path != "" && fileTools[tc.Name] && !containsString(t.filesTouched, path) {
+		t.filesTouched = append(t.filesTouched, path)
+	}
+}
+
+// captureTurn appends a condensed record of a completed turn to the history log of the
+// chat's memory scope, so the grep-based recall the system prompt describes finds it.
+// Failures are logged and don't affect the reply.
+func (al *AgentLoop) captureTurn(view memory.View, t *turn, message, reply string) {
+	settings := al.config.Memory.History
+	if !settings.AutoCapture {
+		return
+	}
+	// A turn that forgot something would only write it down again
+	if containsString(t.toolsUsed, "forget") {
+		return
+	}
+
+	var record strings.Builder
+	fmt.Fprintf(&record, "[%s] Asked: %s\nOutcome: %s", t.sessionID, condense(message, historyAskChars), condense(reply, historyOutcomeChars))
+	if len(t.toolsUsed) > 0 {
+		fmt.Fprintf(&record, "\nTools: %s", strings.Join(t.toolsUsed, ", "))
+	}
+	files := append(append([]string{}, t.filesTouched...), t.attachments...)
+	if len(files) > 0 {
+		fmt.Fprintf(&record, "\nFiles: %s", strings.Join(files, ", "))
+	}
+
+	store := memory.NewMemoryStoreAt(view.Write.Dir)
+	if settings.MaxBytes != 0 {
+		store.SetHistoryLimits(settings.MaxBytes, settings.KeepBytes)
+	}
+
+	// Turns of different sessions finish concurrently; appends and rotation must not interleave
+	al.historyMu.Lock()
+	defer al.historyMu.Unlock()
+	if err := store.AppendHistory(record.String()); err != nil {
+		slog.Warn("Could not record turn in history", "error", err)
+	}
+}
+
+// condense puts text on one line and shortens it to at most max characters
+func condense(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > max {
+		return string(runes[:max-1]) + "…"
+	}
+	return text
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
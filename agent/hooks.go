@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	"nanotalon/config"
+	"nanotalon/logging"
+)
+
+// Hook events, as used in the agents.hooks config
+const (
+	HookUserMessage    = "user_message"
+	HookToolCall       = "tool_call"
+	HookToolResult     = "tool_result"
+	HookAssistantReply = "assistant_reply"
+)
+
+// defaultHookTimeout bounds a hook script when its config doesn't set a timeout
+const defaultHookTimeout = 10 * time.Second
+
+// HookContext identifies the turn a hook runs for
+type HookContext struct {
+	SessionKey string
+	Channel    string
+	ChatID     string
+}
+
+// Hooks are callbacks run at fixed points of every turn. Each receives the current value
+// and returns the value to continue with, so hooks can filter, rewrite or just observe.
+// Returning an error blocks the step: a blocked user message or reply is replaced by the
+// error, and a blocked tool call isn't run and the error becomes its result.
+// Nil callbacks are skipped.
+type Hooks struct {
+	OnUserMessage    func(hc HookContext, content string) (string, error)
+	OnToolCall       func(hc HookContext, name string, args map[string]interface{}) (map[string]interface{}, error)
+	OnToolResult     func(hc HookContext, name, result string) (string, error)
+	OnAssistantReply func(hc HookContext, content string) (string, error)
+}
+
+// RegisterHooks adds hooks that run after the ones already registered
+func (al *AgentLoop) RegisterHooks(hooks Hooks) {
+	al.hooksMu.Lock()
+	defer al.hooksMu.Unlock()
+
+	al.hooks = append(al.hooks, hooks)
+}
+
+// registeredHooks returns a snapshot of the registered hooks
+func (al *AgentLoop) registeredHooks() []Hooks {
+	al.hooksMu.RLock()
+	defer al.hooksMu.RUnlock()
+
+	return append([]Hooks(nil), al.hooks...)
+}
+
+// runUserMessageHooks passes an incoming message through every OnUserMessage hook
+func (al *AgentLoop) runUserMessageHooks(hc HookContext, content string) (string, error) {
+	for _, hooks := range al.registeredHooks() {
+		if hooks.OnUserMessage == nil {
+			continue
+		}
+		var err error
+		if content, err = hooks.OnUserMessage(hc, content); err != nil {
+			return "", err
+		}
+	}
+	return content, nil
+}
+
+// runToolCallHooks passes tool arguments through every OnToolCall hook
+func (al *AgentLoop) runToolCallHooks(hc HookContext, name string, args map[string]interface{}) (map[string]interface{}, error) {
+	for _, hooks := range al.registeredHooks() {
+		if hooks.OnToolCall == nil {
+			continue
+		}
+		var err error
+		if args, err = hooks.OnToolCall(hc, name, args); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// runToolResultHooks passes a tool result through every OnToolResult hook
+func (al *AgentLoop) runToolResultHooks(hc HookContext, name, result string) (string, error) {
+	for _, hooks := range al.registeredHooks() {
+		if hooks.OnToolResult == nil {
+			continue
+		}
+		var err error
+		if result, err = hooks.OnToolResult(hc, name, result); err != nil {
+			return "", err
+		}
+	}
+	return result, nil
+}
+
+// runAssistantReplyHooks passes the final reply through every OnAssistantReply hook
+func (al *AgentLoop) runAssistantReplyHooks(hc HookContext, content string) (string, error) {
+	for _, hooks := range al.registeredHooks() {
+		if hooks.OnAssistantReply == nil {
+			continue
+		}
+		var err error
+		if content, err = hooks.OnAssistantReply(hc, content); err != nil {
+			return "", err
+		}
+	}
+	return content, nil
+}
+
+// hookScriptInput is written as JSON to a hook script's stdin
+type hookScriptInput struct {
+	Event   string                 `json:"event"`
+	Session string                 `json:"session"`
+	Channel string                 `json:"channel"`
+	ChatID  string                 `json:"chat_id"`
+	Content string                 `json:"content,omitempty"`
+	Tool    string                 `json:"tool,omitempty"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+	Result  string                 `json:"result,omitempty"`
+}
+
+// hookScriptOutput is read from a hook script's stdout. Empty output, or omitted
+// fields, leave the value unchanged; a non-empty block rejects the step.
+type hookScriptOutput struct {
+	Content *string                `json:"content"`
+	Args    map[string]interface{} `json:"args"`
+	Result  *string                `json:"result"`
+	Block   string                 `json:"block"`
+}
+
+// NewScriptHooks builds hooks that run a workspace script for one event. A script that
+// fails or times out is logged and skipped, so a broken hook can't take the agent down;
+// scripts that want to reject something must say so with "block".
+func NewScriptHooks(hookConfig config.HookConfig, workspace string) (Hooks, error) {
+	if strings.TrimSpace(hookConfig.Command) == "" {
+		return Hooks{}, fmt.Errorf("hook for %q has no command", hookConfig.Event)
+	}
+
+	timeout := defaultHookTimeout
+	if hookConfig.Timeout > 0 {
+		timeout = time.Duration(hookConfig.Timeout) * time.Second
+	}
+	script := &hookScript{command: hookConfig.Command, workspace: workspace, timeout: timeout}
+
+	switch hookConfig.Event {
+	case HookUserMessage:
+		return Hooks{OnUserMessage: func(hc HookContext, content string) (string, error) {
+			out, err := script.run(hc, hookScriptInput{Event: HookUserMessage, Content: content})
+			if err != nil || out.Content == nil {
+				return content, err
+			}
+			return *out.Content, nil
+		}}, nil
+	case HookToolCall:
+		return Hooks{OnToolCall: func(hc HookContext, name string, args map[string]interface{}) (map[string]interface{}, error) {
+			out, err := script.run(hc, hookScriptInput{Event: HookToolCall, Tool: name, Args: args})
+			if err != nil || out.Args == nil {
+				return args, err
+			}
+			return out.Args, nil
+		}}, nil
+	case HookToolResult:
+		return Hooks{OnToolResult: func(hc HookContext, name, result string) (string, error) {
+			out, err := script.run(hc, hookScriptInput{Event: HookToolResult, Tool: name, Result: result})
+			if err != nil || out.Result == nil {
+				return result, err
+			}
+			return *out.Result, nil
+		}}, nil
+	case HookAssistantReply:
+		return Hooks{OnAssistantReply: func(hc HookContext, content string) (string, error) {
+			out, err := script.run(hc, hookScriptInput{Event: HookAssistantReply, Content: content})
+			if err != nil || out.Content == nil {
+				return content, err
+			}
+			return *out.Content, nil
+		}}, nil
+	default:
+		return Hooks{}, fmt.Errorf("unknown hook event %q (use %s, %s, %s or %s)",
+			hookConfig.Event, HookUserMessage, HookToolCall, HookToolResult, HookAssistantReply)
+	}
+}
+
+// hookScript runs a hook command with sh -c in the workspace
+type hookScript struct {
+	command   string
+	workspace string
+	timeout   time.Duration
+}
+
+// run executes the script for one event. Only an explicit block is returned as an error;
+// script failures are logged and yield an empty output.
+func (s *hookScript) run(hc HookContext, input hookScriptInput) (hookScriptOutput, error) {
+	input.Session, input.Channel, input.ChatID = hc.SessionKey, hc.Channel, hc.ChatID
+
+	var out hookScriptOutput
+	payload, err := json.Marshal(input)
+	if err != nil {
+		slog.Warn("Could not encode hook input", "event", input.Event, logging.SessionKey, hc.SessionKey, "error", err)
+		return out, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.command)
+	cmd.Dir = s.workspace
+	cmd.Stdin = bytes.NewReader(payload)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		slog.Warn("Hook failed", "event", input.Event, "command", s.command, logging.SessionKey, hc.SessionKey, "error", err, "stderr", strings.TrimSpace(stderr.String()))
+		return out, nil
+	}
+
+	if raw := bytes.TrimSpace(stdout.Bytes()); len(raw) > 0 {
+		if err := json.Unmarshal(raw, &out); err != nil {
+			slog.Warn("Hook returned invalid JSON", "event", input.Event, "command", s.command, logging.SessionKey, hc.SessionKey, "error", err)
+			return hookScriptOutput{}, nil
+		}
+	}
+	if out.Block != "" {
+		return out, errors.New(out.Block)
+	}
+	return out, nil
+}
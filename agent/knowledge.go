@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"nanotalon/agent/memory"
+	"nanotalon/agent/tools"
+)
+
+// knowledgeRetrieveTimeout bounds the automatic knowledge base search before each turn
+const knowledgeRetrieveTimeout = 15 * time.Second
+
+// retrieveKnowledge returns the knowledge base excerpts relevant to a message, formatted
+// for the prompt, or "" if none score high enough. Failures are logged and don't hold up
+// the turn.
+func (al *AgentLoop) retrieveKnowledge(message string) string {
+	settings := al.config.Memory.Knowledge
+	if al.knowledgeBase == nil || !settings.AutoRetrieve {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), knowledgeRetrieveTimeout)
+	defer cancel()
+
+	results, err := al.knowledgeBase.Search(ctx, message, settings.MaxResults)
+	if err != nil {
+		slog.Error("Error searching knowledge base", "error", err)
+		return ""
+	}
+
+	var relevant []memory.MemorySearchResult
+	for _, result := range results {
+		if result.Similarity >= settings.MinScore {
+			relevant = append(relevant, result)
+		}
+	}
+	if len(relevant) == 0 {
+		return ""
+	}
+
+	return "[Knowledge Base: excerpts of the user's documents that may help; use kb_search for more]\n" +
+		tools.FormatKnowledgeResults(relevant)
+}
@@ -2,37 +2,85 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"fmt"
 
 	agentcontext "nanotalon/agent/context"
+	"nanotalon/agent/mcp"
 	"nanotalon/agent/memory"
 	"nanotalon/agent/skills"
 	"nanotalon/agent/subagent"
 	"nanotalon/agent/tools"
+	"nanotalon/audit"
+	"nanotalon/bus"
+	"nanotalon/clock"
 	"nanotalon/config"
 	"nanotalon/cron"
+	"nanotalon/logging"
+	"nanotalon/media"
 	"nanotalon/providers"
 	"nanotalon/session"
 )
 
 // AgentLoop represents the core processing engine for the AI agent
 type AgentLoop struct {
-	config          *config.Config
-	provider        providers.LLMProvider
-	workspace       string
-	model           string
-	maxTokens       int
-	temperature     float64
-	maxIterations   int
-	memoryWindow    int
-	toolRegistry    *tools.ToolRegistry
-	sessionManager  *session.SessionManager
-	cronService     *cron.CronService
-	skillsLoader    *skills.SkillsLoader
-	contextBuilder  *agentcontext.ContextBuilder
-	memoryStore     *memory.MemoryStore
-	subagentManager *subagent.SubagentManager
+	config           *config.Config
+	provider         providers.LLMProvider
+	workspace        string
+	model            string
+	maxTokens        int
+	temperature      float64
+	defaultsMu       sync.RWMutex // Guards temperature, which a config reload may change
+	maxIterations    int
+	memoryWindow     int
+	maxHistoryTokens int
+	toolRegistry     *tools.ToolRegistry
+	sessionManager   *session.SessionManager
+	cronService      *cron.CronService
+	skillsLoader     *skills.SkillsLoader
+	contextBuilder   *agentcontext.ContextBuilder
+	memoryStore      *memory.MemoryStore
+	memoryScopes     *memory.Scopes
+	scopesOnce       sync.Once
+	historyMu        sync.Mutex
+	knowledgeBase    *memory.KnowledgeBase
+	subagentManager  *subagent.SubagentManager
+	auditLog         *audit.Logger
+	processManager   *tools.ProcessManager
+	messageBus       *bus.MessageBus
+	tokenBudget      *tokenBudget
+	mediaDescriber   *media.Describer
+
+	// Turns for one session run one at a time so tool loops don't interleave
+	sessionLocks sessionLocks
+
+	// Hooks run at fixed points of every turn, in registration order
+	hooks   []Hooks
+	hooksMu sync.RWMutex
+
+	// Cancel functions of the turns in progress, by session, for /stop
+	runs   map[string]context.CancelFunc
+	runsMu sync.Mutex
+
+	// Commands held by the command filter, by session, until /approve or /deny
+	approvals   map[string]pendingApproval
+	approvalsMu sync.Mutex
+
+	// Subscribers to the event stream, see Events
+	eventSubscribers []chan Event
+	eventsClosed     bool
+	eventsMu         sync.Mutex
+
+	// Providers for per-session model overrides, created on first use
+	modelProviders map[string]providers.LLMProvider
+	providersMu    sync.Mutex
 }
 
 // NewAgentLoop creates a new agent loop with the given configuration
@@ -45,18 +93,55 @@ func NewAgentLoop(cfg *config.Config) (*AgentLoop, error) {
 		return nil, fmt.Errorf("failed to create provider: %w", err)
 	}
 
-	// Create tool registry with available tools
+	// Create tool registry with available tools; oversized output is offloaded to workspace artifacts
 	toolRegistry := tools.NewToolRegistry()
+	toolRegistry.SetOutputLimiter(tools.NewOutputLimiter(cfg.Tools.MaxOutputChars, filepath.Join(workspace, "artifacts")))
 
-	// Add file tools
-	toolRegistry.Register(tools.NewReadFileTool(workspace, ""))
-	toolRegistry.Register(tools.NewWriteFileTool(workspace, ""))
-	toolRegistry.Register(tools.NewListDirTool(workspace, ""))
-	toolRegistry.Register(tools.NewEditFileTool(workspace, ""))
+	// Add file tools, kept inside the workspace when restricted
+	allowedDir := ""
+	if cfg.Tools.RestrictToWorkspace {
+		allowedDir = workspace
+	}
+	toolRegistry.Register(tools.NewReadFileTool(workspace, allowedDir))
+	toolRegistry.Register(tools.NewWriteFileTool(workspace, allowedDir))
+	toolRegistry.Register(tools.NewListDirTool(workspace, allowedDir))
+	toolRegistry.Register(tools.NewEditFileTool(workspace, allowedDir))
 
-	// Add exec tool
+	// Add exec tool; dangerous commands are refused or held for the user's approval
+	denyRules := make([]tools.CommandRule, 0, len(cfg.Tools.Exec.Safety.Deny))
+	for _, rule := range cfg.Tools.Exec.Safety.Deny {
+		denyRules = append(denyRules, tools.CommandRule{Pattern: rule.Pattern, Reason: rule.Reason})
+	}
+	commandFilter, err := tools.NewCommandFilter(cfg.Tools.Exec.Safety.Mode, denyRules, cfg.Tools.Exec.Safety.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tools.exec.safety config: %w", err)
+	}
 	execTool := tools.NewExecTool(workspace, cfg.Tools.Exec.Timeout, cfg.Tools.RestrictToWorkspace)
+	execTool.SetCommandFilter(commandFilter)
+	processManager := tools.NewProcessManager()
+	execTool.SetProcessManager(processManager)
 	toolRegistry.Register(execTool)
+	toolRegistry.Register(tools.NewProcessListTool(processManager))
+	toolRegistry.Register(tools.NewProcessKillTool(processManager))
+	toolRegistry.Register(tools.NewProcessLogsTool(processManager))
+
+	// Add attach tool so the agent can send files it created with its reply
+	toolRegistry.Register(tools.NewAttachFileTool(workspace, allowedDir))
+	toolRegistry.Register(tools.NewOfferChoicesTool())
+
+	// Add code interpreter tool (opt-in, snippets run on the host)
+	if cfg.Tools.RunCode.Enabled {
+		toolRegistry.Register(tools.NewRunCodeTool(workspace, cfg.Tools.RunCode.Timeout, cfg.Tools.RunCode.MemoryMB, cfg.Tools.RestrictToWorkspace))
+	}
+
+	// Add desktop tools (opt-in, only useful when running on a local desktop)
+	if cfg.Tools.Desktop.Clipboard {
+		toolRegistry.Register(tools.NewClipboardReadTool())
+		toolRegistry.Register(tools.NewClipboardWriteTool())
+	}
+	if cfg.Tools.Desktop.Notify {
+		toolRegistry.Register(tools.NewNotifyTool())
+	}
 
 	// Add web tools
 	webSearchTool := tools.NewWebSearchTool(cfg.Tools.Web.Search.APIKey, cfg.Tools.Web.Search.MaxResults)
@@ -64,8 +149,15 @@ func NewAgentLoop(cfg *config.Config) (*AgentLoop, error) {
 	toolRegistry.Register(webSearchTool)
 	toolRegistry.Register(webFetchTool)
 
+	// Add weather tool (Open-Meteo, no API key needed)
+	toolRegistry.Register(tools.NewWeatherTool(cfg.Tools.Weather.DefaultLocation, cfg.Tools.Weather.Units))
+
 	// Create session manager
-	sessionManager := session.NewSessionManager(workspace)
+	sessionStore, err := session.NewStore(cfg.Session, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session store: %w", err)
+	}
+	sessionManager := session.NewSessionManagerWithStore(workspace, sessionStore)
 
 	// Create skills loader
 	skillsLoader := skills.NewSkillsLoader(workspace, "")
@@ -76,34 +168,123 @@ func NewAgentLoop(cfg *config.Config) (*AgentLoop, error) {
 	// Create memory store
 	memoryStore := memory.NewMemoryStore(workspace)
 
+	// Add fact tools for details that must be recalled exactly. These use global facts;
+	// each turn swaps in tools bound to its chat's memory scopes.
+	memoryScopes := memory.NewScopes(workspace)
+	factStore, err := memoryScopes.Facts(memoryScopes.Global())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load facts: %w", err)
+	}
+	toolRegistry.Register(tools.NewFactAssertTool(factStore))
+	toolRegistry.Register(tools.NewFactQueryTool(factStore))
+	toolRegistry.Register(tools.NewFactRetractTool(factStore))
+	toolRegistry.Register(tools.NewForgetTool(memoryScopes, sessionManager))
+
+	// Create the knowledge base when an embedding model is configured; documents are
+	// ingested in the background so the first search doesn't wait for all of them
+	var knowledgeBase *memory.KnowledgeBase
+	if embeddings, err := providers.EmbeddingsFactory(cfg); err != nil {
+		slog.Info("Knowledge base disabled", "error", err)
+	} else if knowledgeBase, err = memory.NewKnowledgeBase(workspace, embeddings, cfg.Memory.Knowledge.PDFCommand); err != nil {
+		slog.Info("Knowledge base disabled", "error", err)
+	} else {
+		// Searches fall back to the local index if the configured vector store is unusable
+		if vectors, err := memory.NewVectorStore(cfg.Memory.VectorStore); err != nil {
+			slog.Error("Error creating vector store", "error", err)
+		} else if vectors != nil {
+			if err := knowledgeBase.UseVectorStore(vectors); err != nil {
+				slog.Error("Error attaching vector store to knowledge base", "error", err)
+			}
+		}
+		toolRegistry.Register(tools.NewKBSearchTool(knowledgeBase, cfg.Memory.Knowledge.MaxResults))
+		go func() {
+			if err := knowledgeBase.Sync(context.Background()); err != nil {
+				slog.Error("Error ingesting knowledge base", "error", err)
+			}
+		}()
+	}
+
+	// Create tool call audit log
+	var auditLog *audit.Logger
+	if cfg.Tools.AuditLog {
+		auditLog = audit.NewLogger(audit.DefaultPath(workspace))
+	}
+
+	// Create token budget guardrails; nil when no cap is configured
+	tokenBudget := newTokenBudget(cfg.Agents.Defaults.MaxRequestTokens, cfg.Agents.Defaults.DailyTokenBudget,
+		defaultUsagePath(workspace), clock.New())
+
 	// Create subagent manager
 	subagentManager := subagent.NewSubagentManager(
 		provider,
 		workspace,
-		nil, // message bus would be passed in a real implementation
+		nil, // set with the agent's message bus in SetMessageBus
 		cfg.Agents.Defaults.Model,
 		cfg.Agents.Defaults.Temperature,
 		cfg.Agents.Defaults.MaxTokens,
 		cfg.Tools.Web.Search.APIKey,
 		cfg.Tools.RestrictToWorkspace,
 	)
+	subagentManager.SetCommandFilter(commandFilter)
+	subagentManager.SetMaxOutputChars(cfg.Tools.MaxOutputChars)
+	subagentManager.SetAuditLog(auditLog)
+	toolRegistry.Register(subagent.NewListTool(subagentManager))
+	toolRegistry.Register(subagent.NewStatusTool(subagentManager))
+	toolRegistry.Register(subagent.NewCancelTool(subagentManager))
+	if cfg.Agents.Defaults.Scratchpad {
+		scratchpad := subagent.NewScratchpad(subagent.ScratchpadPath(workspace), clock.New())
+		subagentManager.SetScratchpad(scratchpad)
+		toolRegistry.Register(subagent.NewScratchpadWriteTool(scratchpad, "main"))
+		toolRegistry.Register(subagent.NewScratchpadReadTool(scratchpad))
+	}
+
+	al := &AgentLoop{
+		config:           cfg,
+		provider:         provider,
+		workspace:        workspace,
+		model:            cfg.Agents.Defaults.Model,
+		maxTokens:        cfg.Agents.Defaults.MaxTokens,
+		temperature:      cfg.Agents.Defaults.Temperature,
+		maxIterations:    cfg.Agents.Defaults.MaxToolIterations,
+		memoryWindow:     cfg.Agents.Defaults.MemoryWindow,
+		maxHistoryTokens: cfg.Agents.Defaults.MaxHistoryTokens,
+		toolRegistry:     toolRegistry,
+		sessionManager:   sessionManager,
+		skillsLoader:     skillsLoader,
+		contextBuilder:   contextBuilder,
+		memoryStore:      memoryStore,
+		memoryScopes:     memoryScopes,
+		knowledgeBase:    knowledgeBase,
+		subagentManager:  subagentManager,
+		auditLog:         auditLog,
+		processManager:   processManager,
+		tokenBudget:      tokenBudget,
+		mediaDescriber:   media.NewDescriber(workspace, cfg.Channels.Media.OCRCommand, cfg.Channels.Media.TranscribeCommand),
+	}
+	subagentManager.SetToolPolicies(al.toolPolicies)
+
+	// Register workspace hook scripts from the config
+	for _, hookConfig := range cfg.Agents.Hooks {
+		hooks, err := NewScriptHooks(hookConfig, workspace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hook: %w", err)
+		}
+		al.RegisterHooks(hooks)
+	}
 
-	return &AgentLoop{
-		config:          cfg,
-		provider:        provider,
-		workspace:       workspace,
-		model:           cfg.Agents.Defaults.Model,
-		maxTokens:       cfg.Agents.Defaults.MaxTokens,
-		temperature:     cfg.Agents.Defaults.Temperature,
-		maxIterations:   cfg.Agents.Defaults.MaxToolIterations,
-		memoryWindow:    cfg.Agents.Defaults.MemoryWindow,
-		toolRegistry:    toolRegistry,
-		sessionManager:  sessionManager,
-		skillsLoader:    skillsLoader,
-		contextBuilder:  contextBuilder,
-		memoryStore:     memoryStore,
-		subagentManager: subagentManager,
-	}, nil
+	// Add the tools of configured MCP servers; servers that are down are retried in the background
+	if mcpServers := mcp.ServersFromConfig(cfg.Tools.MCPServers); len(mcpServers) > 0 {
+		for i := range mcpServers {
+			if sampling := cfg.Tools.MCPServers[mcpServers[i].Name].Sampling; sampling.Enabled {
+				mcpServers[i].Sampling = al.mcpSampling(mcpServers[i].Name, sampling)
+			}
+		}
+		if err := tools.ConnectMCPServers(mcpServers, toolRegistry, filepath.Join(workspace, "artifacts")); err != nil {
+			slog.Warn("Could not connect to MCP servers", "error", err)
+		}
+	}
+
+	return al, nil
 }
 
 // SetCronService sets the cron service for the agent
@@ -117,69 +298,666 @@ func (al *AgentLoop) SetCronService(service *cron.CronService) {
 	}
 }
 
-// ProcessDirect processes a single message directly without going through message bus
+// Sessions returns the agent's session manager. Other parts of the process should read
+// sessions through it rather than open their own, which would cache stale copies.
+func (al *AgentLoop) Sessions() *session.SessionManager {
+	return al.sessionManager
+}
+
+// SetTemperature changes the default temperature for the turns and subagent tasks that
+// start from now on; chats with their own /settings keep theirs
+func (al *AgentLoop) SetTemperature(temperature float64) {
+	al.defaultsMu.Lock()
+	al.temperature = temperature
+	al.defaultsMu.Unlock()
+	al.subagentManager.SetTemperature(temperature)
+}
+
+// defaultTemperature returns the temperature of chats that don't set their own
+func (al *AgentLoop) defaultTemperature() float64 {
+	al.defaultsMu.RLock()
+	defer al.defaultsMu.RUnlock()
+	return al.temperature
+}
+
+// PingProvider checks the default model's provider is reachable. Providers that can't be
+// checked without running a completion are assumed to be.
+func (al *AgentLoop) PingProvider(ctx context.Context) error {
+	if pinger, ok := al.provider.(providers.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// ProcessDirect processes a single message directly without going through message bus.
+// Messages for the same session are processed one at a time, in arrival order. Files the
+// agent attached are listed at the end of the reply.
 func (al *AgentLoop) ProcessDirect(message, sessionID string) (string, error) {
+	reply, extras, err := al.processMessage(message, sessionID, nil)
+	if err != nil || len(extras.attachments) == 0 {
+		return reply, err
+	}
+	return reply + "\n\nAttached files:\n- " + strings.Join(extras.attachments, "\n- "), nil
+}
+
+// replyExtras is what a turn sends along with its reply text
+type replyExtras struct {
+	attachments []string // Paths of files the agent attached
+	choices     []string // Answers offered to the user, shown as buttons where the channel can
+}
+
+// processMessage runs one turn of the conversation, reporting tool activity to progress.
+// It returns the reply and the files and choices the agent added to it.
+func (al *AgentLoop) processMessage(message, sessionID string, progress *progressReporter) (string, replyExtras, error) {
+	// /stop must not wait behind the turn it is meant to cancel
+	if isStopCommand(message) {
+		return al.handleStopCommand(sessionID), replyExtras{}, nil
+	}
+
+	unlock := al.sessionLocks.lock(sessionID)
+	defer unlock()
+
+	// Chat commands are answered directly and kept out of the conversation history
+	if isSettingsCommand(message) {
+		return al.handleSettingsCommand(sessionID, message), replyExtras{}, nil
+	}
+	if isApprovalCommand(message) {
+		return al.handleApprovalCommand(sessionID, message), replyExtras{}, nil
+	}
+
+	// "/plan <task>" plans this task and shows the plan; a bare "/plan" shows the last plan
+	planned := false
+	if isPlanCommand(message) {
+		task := planTask(message)
+		if task == "" {
+			return al.describePlan(sessionID), replyExtras{}, nil
+		}
+		message, planned = task, true
+	}
+
+	al.emit(Event{Type: EventTurnStarted, SessionKey: sessionID, Content: message})
+	reply, extras, err := al.runTurn(message, sessionID, planned, progress)
+	if err != nil {
+		al.emit(Event{Type: EventError, SessionKey: sessionID, Error: err.Error()})
+		return "", replyExtras{}, err
+	}
+	al.emit(Event{Type: EventTurnFinished, SessionKey: sessionID, Content: reply})
+	return reply, extras, nil
+}
+
+// runTurn sends a message through the model and its tools and returns the reply and the
+// files and choices added to it; the caller holds the session lock
+func (al *AgentLoop) runTurn(message, sessionID string, planned bool, progress *progressReporter) (string, replyExtras, error) {
+	// Hooks may rewrite or reject the message before the model or the session sees it
+	channel, chatID, _ := strings.Cut(sessionID, ":")
+	hc := HookContext{SessionKey: sessionID, Channel: channel, ChatID: chatID}
+	message, err := al.runUserMessageHooks(hc, message)
+	if err != nil {
+		return fmt.Sprintf("⚠ %v", err), replyExtras{}, nil
+	}
+
+	// Per-session settings override the agent defaults
+	settings, err := al.sessionManager.GetSettings(sessionID)
+	if err != nil {
+		slog.Warn("Could not load session settings", logging.SessionKey, sessionID, "error", err)
+	}
+	model, temperature := al.model, al.defaultTemperature()
+	if settings.Model != "" {
+		model = settings.Model
+	}
+	if settings.Temperature != nil {
+		temperature = *settings.Temperature
+	}
+	provider, err := al.providerFor(model)
+	if err != nil {
+		return "", replyExtras{}, fmt.Errorf("error creating provider for model %s: %w", model, err)
+	}
+
+	// Get recent message history (before saving the new message, so it isn't sent twice).
+	// Turns already folded into the rolling summary are replaced by the summary itself.
+	history, err := al.sessionManager.GetUnsummarizedHistory(sessionID, al.memoryWindow)
+	if err != nil {
+		// New sessions have no history yet
+		history = []session.Message{}
+	}
+	if summary, _, err := al.sessionManager.GetSummary(sessionID); err == nil && summary != "" {
+		history = append([]session.Message{{
+			Role:    "system",
+			Content: "Summary of the earlier conversation:\n" + summary,
+		}}, history...)
+	}
+
+	// Each chat sees only the memory its channel is allowed to read
+	view := al.memoryView(channel, chatID)
+
+	if systemPrompt := al.systemPrompt(view, settings); systemPrompt != "" {
+		history = append([]session.Message{{Role: "system", Content: systemPrompt}}, history...)
+	}
+
+	// The model sees the current time and origin of the message; the session keeps the raw text
+	userContent := al.contextBuilder.InjectRuntimeContext(message, &channel, &chatID)
+
+	// Excerpts of the user's documents that look relevant ride along with the message
+	if knowledge := al.retrieveKnowledge(message); knowledge != "" {
+		userContent += "\n\n" + knowledge
+	}
+
+	// Trim the oldest turns to the token budget; the new user message is always kept
+	history = append(history, session.Message{Role: "user", Content: userContent})
+	history = session.TrimToTokenBudget(history, al.maxHistoryTokens)
+	history = session.RepairToolCalls(history)
+
 	// Add message to session history
 	if err := al.sessionManager.SaveMessage(sessionID, "user", message); err != nil {
 		// Just log the error, don't fail the whole operation
-		fmt.Printf("Warning: could not save message to session: %v\n", err)
+		slog.Warn("Could not save message to session", logging.SessionKey, sessionID, "error", err)
+	}
+
+	// Assemble the tools this request is allowed to use
+	toolRegistry := al.ToolsForChannel(channel)
+	al.scopeFactTools(toolRegistry, view)
+	scopeCronTool(toolRegistry, channel, chatID)
+
+	ctx, endRun := al.startRun(sessionID)
+	ctx = logging.With(ctx, logging.SessionKey, sessionID, logging.ChannelKey, channel)
+	defer endRun()
+
+	// Malformed tool calls are explained to the model and retried, up to a limit per turn
+	maxToolRetries := al.config.Agents.Defaults.MaxToolRetries
+	if maxToolRetries <= 0 {
+		maxToolRetries = defaultMaxToolRetries
 	}
 
-	// Get recent message history
-	history, err := al.sessionManager.GetMessageHistory(sessionID, al.memoryWindow)
+	t := &turn{
+		ctx:            ctx,
+		sessionID:      sessionID,
+		channel:        channel,
+		hc:             hc,
+		provider:       provider,
+		model:          model,
+		temperature:    temperature,
+		toolRegistry:   toolRegistry,
+		toolDefs:       toolDefinitions(toolRegistry),
+		progress:       progress,
+		messages:       toProviderMessages(history),
+		maxToolRetries: maxToolRetries,
+	}
+
+	var finalContent string
+	if planned || al.config.Agents.Defaults.Planning {
+		finalContent, err = al.runPlanned(t, message, planned)
+	} else {
+		finalContent, err = al.runToolLoop(t, al.maxIterations)
+	}
 	if err != nil {
-		// Just log the error, continue without history
-		fmt.Printf("Warning: could not get message history: %v\n", err)
-		history = []session.Message{}
+		return "", replyExtras{}, err
 	}
 
-	// Build the context with history
-	var messages []providers.Message
+	if finalContent == "" && ctx.Err() != nil {
+		finalContent = stoppedReply(t.partialContent, t.toolsRun)
+	}
+	if finalContent == "" {
+		finalContent = "I've completed processing but have no response to give."
+	}
+	if finalContent, err = al.runAssistantReplyHooks(hc, finalContent); err != nil {
+		finalContent = fmt.Sprintf("⚠ %v", err)
+	}
 
-	// Add history if available
-	for _, msg := range history {
-		messages = append(messages, providers.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
+	// Add assistant response to session history
+	if err := al.sessionManager.SaveMessage(sessionID, "assistant", finalContent); err != nil {
+		slog.WarnContext(t.ctx, "Could not save assistant message to session", "error", err)
 	}
 
-	// Add the current user message
-	messages = append(messages, providers.Message{
-		Role:    "user",
-		Content: message,
-	})
+	// Keep a condensed record of the turn in the chat's history log
+	al.captureTurn(view, t, message, finalContent)
+
+	// Fold turns that fell out of the memory window into the rolling summary
+	al.maybeCompact(context.Background(), sessionID)
 
-	// Create the chat request
-	chatReq := providers.ChatRequest{
-		Messages:    messages,
-		Model:       al.model,
-		Temperature: al.temperature,
-		MaxTokens:   al.maxTokens,
+	return finalContent, replyExtras{attachments: t.attachments, choices: t.choices}, nil
+}
+
+// turn is the state of one conversation turn, shared by the tool loops it runs
+type turn struct {
+	ctx          context.Context
+	sessionID    string
+	channel      string
+	hc           HookContext
+	provider     providers.LLMProvider
+	model        string
+	temperature  float64
+	toolRegistry *tools.ToolRegistry
+	toolDefs     []providers.ToolDef
+	progress     *progressReporter
+
+	// The conversation sent to the model, ending with the latest exchange
+	messages []providers.Message
+
+	iterations     int
+	partialContent string
+	toolsRun       int
+	maxToolRetries int
+	invalidCalls   int
+	lastInvalid    error
+
+	// Tokens used by this turn's model calls, and the budget that stopped it, if any
+	tokensUsed int
+	budgetErr  error
+
+	// Files the agent attached to its reply, and answers it offered the user
+	attachments []string
+	choices     []string
+
+	// Tools that ran successfully and files they changed, for the history record
+	toolsUsed    []string
+	filesTouched []string
+}
+
+// halted reports whether the turn must end early: it ran out of retries for malformed
+// tool calls or hit a token budget
+func (t *turn) halted() bool {
+	return t.invalidCalls > t.maxToolRetries || t.budgetErr != nil
+}
+
+// runToolLoop calls the model and runs the tools it asks for until it answers without tool
+// calls, returning that answer. It returns an empty answer when maxIterations model calls
+// didn't produce one or the turn was stopped.
+func (al *AgentLoop) runToolLoop(t *turn, maxIterations int) (string, error) {
+	if maxIterations <= 0 {
+		maxIterations = 1
 	}
 
-	ctx := context.Background()
-	response, err := al.provider.Chat(ctx, chatReq)
+	for i := 0; i < maxIterations && t.ctx.Err() == nil; i++ {
+		t.progress.working()
+		iteration := t.iterations
+		t.iterations++
+
+		// Create the chat request
+		chatReq := providers.ChatRequest{
+			Messages:    t.messages,
+			Model:       t.model,
+			Temperature: t.temperature,
+			MaxTokens:   al.maxTokens,
+			Tools:       t.toolDefs,
+		}
+
+		response, err := al.chat(t, chatReq)
+		if err != nil {
+			var budgetErr *budgetExceededError
+			if errors.As(err, &budgetErr) {
+				slog.InfoContext(t.ctx, "Stopped by token budget", "error", err)
+				t.budgetErr = err
+				return budgetReply(t.partialContent, err), nil
+			}
+			if t.ctx.Err() != nil {
+				break
+			}
+			return "", fmt.Errorf("error calling LLM: %w", err)
+		}
+		if response.Content != "" {
+			t.partialContent = response.Content
+		}
+
+		if len(response.ToolCalls) == 0 {
+			return response.Content, nil
+		}
+
+		// Record the assistant turn with all of its tool calls, then one result per call,
+		// so the exchange can be replayed from the session later
+		callMsg := session.Message{Role: "assistant", Content: response.Content}
+		for i, tc := range response.ToolCalls {
+			if tc.ID == "" {
+				response.ToolCalls[i].ID = fmt.Sprintf("call_%d_%d", iteration, i)
+			}
+			callMsg.ToolCalls = append(callMsg.ToolCalls, session.ToolCall{
+				ID:        response.ToolCalls[i].ID,
+				Name:      tc.Name,
+				Arguments: tc.Args,
+			})
+		}
+		al.appendTurnMessage(t, callMsg)
+
+		for _, tc := range response.ToolCalls {
+			// Once stopped, remaining calls still get a result so the exchange stays valid
+			if t.ctx.Err() != nil {
+				al.appendTurnMessage(t, session.Message{Role: "tool", Content: "Cancelled by the user.", ToolCallID: tc.ID, Name: tc.Name})
+				continue
+			}
+
+			if problem := checkToolCall(t.toolRegistry, tc); problem != nil {
+				t.invalidCalls++
+				t.lastInvalid = fmt.Errorf("%s: %w", tc.Name, problem)
+				slog.WarnContext(t.ctx, "Invalid tool call", "tool", tc.Name, "attempt", t.invalidCalls, "max_retries", t.maxToolRetries, "error", problem)
+
+				al.appendTurnMessage(t, session.Message{
+					Role:       "tool",
+					Content:    invalidToolCallResult(tc, problem, t.maxToolRetries-t.invalidCalls),
+					ToolCallID: tc.ID,
+					Name:       tc.Name,
+				})
+				continue
+			}
+
+			argsBytes, _ := json.Marshal(tc.Args)
+			slog.DebugContext(t.ctx, "Executing tool", "tool", tc.Name, "args", string(argsBytes))
+			t.progress.toolStarted(tc)
+			t.progress.working()
+			al.emit(Event{Type: EventToolCall, SessionKey: t.sessionID, Tool: tc.Name, Args: tc.Args})
+
+			// Tool errors, including calls blocked by a hook, are fed back to the model so it can recover
+			started := time.Now()
+			var result string
+			args, err := al.runToolCallHooks(t.hc, tc.Name, tc.Args)
+			if err != nil {
+				err = fmt.Errorf("blocked: %w", err)
+			} else {
+				tc.Args = args
+				result, err = t.toolRegistry.ExecuteWithProgress(tc.Name, tc.Args, func(message string) {
+					t.progress.toolProgress(tc, message)
+				})
+				if err == nil {
+					t.attach(tc)
+					t.offer(tc)
+					t.track(tc)
+				}
+			}
+			al.recordToolCall(t.sessionID, t.channel, tc, started, result, err)
+			resultEvent := Event{Type: EventToolResult, SessionKey: t.sessionID, Tool: tc.Name, Result: result}
+			if err != nil {
+				resultEvent.Error = err.Error()
+			}
+			al.emit(resultEvent)
+			if err != nil {
+				if held, ok := al.approvalResult(t.sessionID, tc, err); ok {
+					result = held
+				} else {
+					result = fmt.Sprintf("Error: %v", err)
+				}
+			}
+			if result, err = al.runToolResultHooks(t.hc, tc.Name, result); err != nil {
+				result = fmt.Sprintf("Error: result withheld: %v", err)
+			}
+
+			al.appendTurnMessage(t, session.Message{
+				Role:       "tool",
+				Content:    result,
+				ToolCallID: tc.ID,
+				Name:       tc.Name,
+			})
+			t.toolsRun++
+		}
+
+		if t.invalidCalls > t.maxToolRetries {
+			return fmt.Sprintf("I couldn't produce a valid tool call after %d attempts (%v), so I stopped here.", t.invalidCalls, t.lastInvalid), nil
+		}
+	}
+
+	return "", nil
+}
+
+// attach records the file a successful attach_file call attached to the reply
+func (t *turn) attach(tc providers.ToolCall) {
+	attacher, ok := t.toolRegistry.Get(tc.Name).(tools.Attacher)
+	if !ok {
+		return
+	}
+	path, err := attacher.AttachmentPath(tc.Args)
 	if err != nil {
-		return "", fmt.Errorf("error calling LLM: %w", err)
+		return
+	}
+	for _, attached := range t.attachments {
+		if attached == path {
+			return
+		}
 	}
+	t.attachments = append(t.attachments, path)
+}
 
-	// Add assistant response to session history
-	if err := al.sessionManager.SaveMessage(sessionID, "assistant", response.Content); err != nil {
-		fmt.Printf("Warning: could not save assistant message to session: %v\n", err)
+// offer records the answers a successful offer_choices call offered; a later call replaces them
+func (t *turn) offer(tc providers.ToolCall) {
+	chooser, ok := t.toolRegistry.Get(tc.Name).(tools.Chooser)
+	if !ok {
+		return
+	}
+	if choices, err := chooser.Choices(tc.Args); err == nil {
+		t.choices = choices
+	}
+}
+
+// appendTurnMessage adds a tool exchange message to the conversation and the session
+func (al *AgentLoop) appendTurnMessage(t *turn, message session.Message) {
+	t.messages = append(t.messages, toProviderMessages([]session.Message{message})...)
+	al.saveSessionMessage(t.sessionID, message)
+}
+
+// systemPrompt combines the workspace system prompt (identity, bootstrap files, the memory
+// of the chat's view and skills) with the session's extra instructions
+func (al *AgentLoop) systemPrompt(view memory.View, settings session.Settings) string {
+	prompt, err := al.contextBuilder.SystemPromptFor(view)
+	if err != nil {
+		slog.Warn("Could not build system prompt", "error", err)
+	}
+	if settings.SystemPromptExtra == "" {
+		return prompt
+	}
+	if prompt == "" {
+		return settings.SystemPromptExtra
+	}
+	return prompt + "\n\n---\n\n# Instructions for This Chat\n\n" + settings.SystemPromptExtra
+}
+
+// ToolsForChannel returns the tools available to a request from the given channel,
+// applying the global tools.enabled/disabled lists and any tools.channels restriction
+func (al *AgentLoop) ToolsForChannel(channel string) *tools.ToolRegistry {
+	return al.toolRegistry.Filter(al.toolPolicies(channel)...)
+}
+
+// toolPolicies returns the global tool policy and the channel's own, if it has one
+func (al *AgentLoop) toolPolicies(channel string) []*tools.ToolPolicy {
+	policies := []*tools.ToolPolicy{
+		tools.NewToolPolicy(al.config.Tools.Enabled, al.config.Tools.Disabled),
+	}
+	if channelPolicy, ok := al.config.Tools.Channels[strings.ToLower(channel)]; ok {
+		policies = append(policies, tools.NewToolPolicy(channelPolicy.Enabled, channelPolicy.Disabled))
+	}
+	return policies
+}
+
+// recordToolCall appends a tool invocation to the audit log if auditing is enabled
+func (al *AgentLoop) recordToolCall(sessionID, channel string, tc providers.ToolCall, started time.Time, result string, callErr error) {
+	if al.auditLog == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Time:       started,
+		Session:    sessionID,
+		Channel:    channel,
+		Tool:       tc.Name,
+		Args:       tc.Args,
+		DurationMS: time.Since(started).Milliseconds(),
+		Result:     result,
+	}
+	if callErr != nil {
+		entry.Error = callErr.Error()
 	}
 
-	return response.Content, nil
+	if err := al.auditLog.Record(entry); err != nil {
+		slog.Warn("Could not write audit log", logging.SessionKey, sessionID, "error", err)
+	}
 }
 
-// Run starts the agent loop for processing messages from the message bus
+// saveSessionMessage persists a message, logging rather than failing the request on error
+func (al *AgentLoop) saveSessionMessage(sessionID string, message session.Message) {
+	if err := al.sessionManager.AppendMessage(sessionID, message); err != nil {
+		slog.Warn("Could not save message to session", logging.SessionKey, sessionID, "role", message.Role, "error", err)
+	}
+}
+
+// toProviderMessages converts session messages, including tool calls and results, to provider messages
+func toProviderMessages(history []session.Message) []providers.Message {
+	messages := make([]providers.Message, 0, len(history))
+	for _, msg := range history {
+		pm := providers.Message{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Name:       msg.Name,
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, tc := range msg.ToolCalls {
+			pm.ToolCalls = append(pm.ToolCalls, providers.NewMessageToolCall(tc.ID, tc.Name, tc.Arguments))
+		}
+		messages = append(messages, pm)
+	}
+	return messages
+}
+
+// toolDefinitions converts registry definitions to provider tool definitions
+func toolDefinitions(toolRegistry *tools.ToolRegistry) []providers.ToolDef {
+	var toolDefs []providers.ToolDef
+	for _, def := range toolRegistry.GetDefinitions() {
+		defMap, ok := def.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		funcDef, ok := defMap["function"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := funcDef["name"].(string)
+		description, _ := funcDef["description"].(string)
+		parameters, _ := funcDef["parameters"].(map[string]interface{})
+
+		toolDefs = append(toolDefs, providers.ToolDef{
+			Type: "function",
+			Function: providers.FunctionDef{
+				Name:        name,
+				Description: description,
+				Parameters:  parameters,
+			},
+		})
+	}
+	return toolDefs
+}
+
+// SetMessageBus connects the agent to the message bus consumed by Run; subagents announce
+// their results on it
+func (al *AgentLoop) SetMessageBus(messageBus *bus.MessageBus) {
+	al.messageBus = messageBus
+	if al.subagentManager != nil {
+		al.subagentManager.SetMessageBus(messageBus)
+	}
+}
+
+// RestoreSubagents persists subagent tasks in the workspace from now on and restores the
+// tasks left by the last run
+func (al *AgentLoop) RestoreSubagents() error {
+	return al.subagentManager.SetStorePath(subagent.DefaultStorePath(al.workspace))
+}
+
+// SpawnTemplate spawns a subagent from a workspace template; its result is announced in
+// the given chat, if any
+func (al *AgentLoop) SpawnTemplate(name string, args map[string]string, channel, chatID string) (string, error) {
+	return al.subagentManager.SpawnTemplate(name, args, channel, chatID)
+}
+
+// Run processes inbound messages from the message bus with a pool of workers and publishes
+// each reply to the chat it came from. It returns once ctx is cancelled and the turns
+// already in progress have finished.
 func (al *AgentLoop) Run(ctx context.Context) error {
-	// For now, just return (implementation would connect to message bus)
-	// In a complete implementation, this would listen for incoming messages
+	if al.messageBus == nil {
+		return fmt.Errorf("agent loop has no message bus")
+	}
+
+	workers := al.config.Agents.Defaults.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msg, err := al.messageBus.ConsumeInboundContext(ctx)
+				if err != nil {
+					return
+				}
+				al.handleInbound(msg)
+			}
+		}()
+	}
+
+	wg.Wait()
 	return nil
 }
 
+// handleInbound runs one inbound message through the agent and publishes the reply
+func (al *AgentLoop) handleInbound(msg bus.InboundMessage) {
+	al.markRead(msg)
+
+	sessionKey := msg.SessionKey
+	if sessionKey == "" {
+		sessionKey = fmt.Sprintf("%s:%s", msg.Channel, msg.ChatID)
+	}
+
+	// Attachments are already saved in the workspace; the model gets their description
+	content := msg.Content
+	if len(msg.Media) > 0 {
+		content = strings.TrimSpace(content + "\n\n" + al.describeMedia(msg.Media))
+	}
+
+	started := time.Now()
+	response, extras, err := al.processMessage(content, sessionKey, al.newProgressReporter(msg.Channel, msg.ChatID))
+	if err != nil {
+		slog.Error("Error processing message", logging.SessionKey, sessionKey, logging.ChannelKey, msg.Channel, "error", err)
+		response = "Sorry, I ran into an error while processing your message."
+	}
+
+	if err := al.messageBus.PublishOutbound(bus.OutboundMessage{
+		Channel:     msg.Channel,
+		ChatID:      msg.ChatID,
+		Content:     response,
+		Attachments: extras.attachments,
+		Buttons:     al.replyButtons(sessionKey, extras, started),
+	}); err != nil {
+		slog.Error("Could not publish reply", logging.SessionKey, sessionKey, logging.ChannelKey, msg.Channel, "error", err)
+	}
+}
+
+// replyButtons turns the choices the agent offered into buttons. A command the turn held
+// for approval gets Approve and Deny buttons instead.
+func (al *AgentLoop) replyButtons(sessionID string, extras replyExtras, turnStarted time.Time) []bus.Button {
+	if al.heldSince(sessionID, turnStarted) {
+		return []bus.Button{{Text: "✅ Approve", Data: "/approve"}, {Text: "❌ Deny", Data: "/deny"}}
+	}
+
+	var buttons []bus.Button
+	for _, choice := range extras.choices {
+		buttons = append(buttons, bus.Button{Text: choice, Data: choice})
+	}
+	return buttons
+}
+
+// describeMedia describes saved attachments for the model
+func (al *AgentLoop) describeMedia(paths []string) string {
+	describer := al.mediaDescriber
+	if describer == nil {
+		describer = media.NewDescriber(al.workspace, "", "")
+	}
+	return describer.Prompt(paths)
+}
+
 // Stop stops the agent loop
 func (al *AgentLoop) Stop() {
-	// Cleanup resources
+	al.closeAllEvents()
+
+	// Don't leave background processes running after the agent exits
+	al.processManager.KillAll()
+	al.sessionManager.Close()
+	if al.knowledgeBase != nil {
+		al.knowledgeBase.Close()
+	}
 }
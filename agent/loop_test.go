@@ -0,0 +1,915 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	agentcontext "nanotalon/agent/context"
+	"nanotalon/agent/memory"
+	"nanotalon/agent/tools"
+	"nanotalon/bus"
+	"nanotalon/config"
+	"nanotalon/cron"
+	"nanotalon/media"
+	"nanotalon/providers"
+	"nanotalon/session"
+)
+
+// echoProvider replies with the last message it was sent
+type echoProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *echoProvider) Chat(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+	last, _ := req.Messages[len(req.Messages)-1].Content.(string)
+	return &providers.ChatResponse{Content: "echo: " + last}, nil
+}
+
+func (p *echoProvider) GetDefaultModel() string {
+	return "test/echo"
+}
+
+// stubTool stands in for a real tool and returns a fixed result
+type stubTool struct {
+	name string
+}
+
+func (t stubTool) Name() string        { return t.name }
+func (t stubTool) Description() string { return "stub " + t.name }
+func (t stubTool) Call(args map[string]interface{}) (string, error) {
+	return t.name + " ok", nil
+}
+
+// newTestAgentLoop builds an agent loop around provider with stub tools and no channels
+func newTestAgentLoop(t *testing.T, provider providers.LLMProvider) *AgentLoop {
+	workspace := t.TempDir()
+	toolRegistry := tools.NewToolRegistry()
+	for _, name := range []string{"web_search", "list_directory", "execute_command"} {
+		toolRegistry.Register(stubTool{name: name})
+	}
+	return &AgentLoop{
+		config:         &config.Config{},
+		provider:       provider,
+		workspace:      workspace,
+		model:          "test/echo",
+		maxIterations:  3,
+		memoryWindow:   20,
+		toolRegistry:   toolRegistry,
+		sessionManager: session.NewSessionManager(workspace),
+		contextBuilder: agentcontext.NewContextBuilder(workspace),
+	}
+}
+
+func TestRunProcessesInboundMessages(t *testing.T) {
+	provider := &echoProvider{}
+	al := newTestAgentLoop(t, provider)
+	al.config.Agents.Defaults.Workers = 2
+	messageBus := bus.NewMessageBus()
+	al.SetMessageBus(messageBus)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- al.Run(ctx) }()
+
+	messageBus.PublishInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "hi"})
+
+	outCtx, outCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer outCancel()
+	reply, err := messageBus.ConsumeOutboundContext(outCtx)
+	if err != nil {
+		t.Fatalf("No reply published: %v", err)
+	}
+	if reply.Channel != "telegram" || reply.ChatID != "42" {
+		t.Errorf("Reply addressed to %s:%s, expected telegram:42", reply.Channel, reply.ChatID)
+	}
+
+	if history, _ := al.sessionManager.GetMessageHistory("telegram:42", 10); len(history) != 2 {
+		t.Errorf("Expected the turn to be saved under telegram:42, got %d messages", len(history))
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned an error on shutdown: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+}
+
+// scriptedProvider returns its responses in order, then repeats the last one
+type scriptedProvider struct {
+	mu        sync.Mutex
+	responses []*providers.ChatResponse
+	requests  []providers.ChatRequest
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+	response := p.responses[0]
+	if len(p.responses) > 1 {
+		p.responses = p.responses[1:]
+	}
+	return response, nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string {
+	return "test/scripted"
+}
+
+func TestProgressUpdatesDuringToolLoop(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "web_search", Args: map[string]interface{}{"query": "go 1.23"}}}},
+		{Content: "done"},
+	}}
+	al := newTestAgentLoop(t, provider)
+	al.config.Channels.SendProgress = true
+	al.config.Channels.SendTyping = true
+	messageBus := bus.NewMessageBus()
+	al.SetMessageBus(messageBus)
+
+	al.handleInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "search please"})
+
+	var kinds []string
+	var notice string
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for {
+		msg, err := messageBus.ConsumeOutboundContext(ctx)
+		if err != nil {
+			t.Fatalf("Missing final reply, got kinds %v", kinds)
+		}
+		kinds = append(kinds, msg.Kind())
+		if msg.Kind() == bus.KindProgress {
+			notice = msg.Content
+		}
+		if msg.Kind() == "" {
+			break
+		}
+	}
+
+	if kinds[0] != bus.KindTyping {
+		t.Errorf("Expected a typing indicator first, got %v", kinds)
+	}
+	if notice != "Searching the web…" {
+		t.Errorf("Expected a web search notice, got %q", notice)
+	}
+}
+
+func TestReadReceiptWhenTurnStarts(t *testing.T) {
+	al := newTestAgentLoop(t, &scriptedProvider{responses: []*providers.ChatResponse{{Content: "hi"}}})
+	al.config.Channels.SendReadReceipts = true
+	messageBus := bus.NewMessageBus()
+	al.SetMessageBus(messageBus)
+
+	al.handleInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "hello", Metadata: map[string]interface{}{bus.MetadataMessageID: 7}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeOutboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No outbound message: %v", err)
+	}
+	if msg.Kind() != bus.KindRead || msg.Metadata[bus.MetadataMessageID] != "7" || msg.ChatID != "42" {
+		t.Errorf("Expected a read receipt for message 7 first, got %+v", msg)
+	}
+}
+
+func TestToolHint(t *testing.T) {
+	hint := toolHint(providers.ToolCall{Name: "execute_command", Args: map[string]interface{}{"command": "ls -la"}})
+	if hint != "🔧 execute_command: ls -la" {
+		t.Errorf("Unexpected hint %q", hint)
+	}
+}
+
+// blockingProvider asks for a tool once, then blocks until the request is cancelled
+type blockingProvider struct {
+	calls   int
+	blocked chan struct{}
+}
+
+func (p *blockingProvider) Chat(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	p.calls++
+	if p.calls == 1 {
+		return &providers.ChatResponse{
+			Content:   "Looking into it",
+			ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "list_directory", Args: map[string]interface{}{}}},
+		}, nil
+	}
+	close(p.blocked)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (p *blockingProvider) GetDefaultModel() string {
+	return "test/blocking"
+}
+
+func TestStopCancelsRunningTurn(t *testing.T) {
+	provider := &blockingProvider{blocked: make(chan struct{})}
+	al := newTestAgentLoop(t, provider)
+
+	if reply, _ := al.ProcessDirect("/stop", "telegram:42"); reply != "Nothing is running." {
+		t.Errorf("Unexpected reply with nothing running: %q", reply)
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		reply, err := al.ProcessDirect("loop forever", "telegram:42")
+		if err != nil {
+			t.Errorf("Stopped turn returned an error: %v", err)
+		}
+		result <- reply
+	}()
+
+	select {
+	case <-provider.blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Turn never reached its second model call")
+	}
+	al.ProcessDirect("/stop", "telegram:42")
+
+	select {
+	case reply := <-result:
+		if !strings.HasPrefix(reply, stoppedNotice) || !strings.Contains(reply, "Looking into it") {
+			t.Errorf("Expected a stopped reply with partial content, got %q", reply)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Turn did not stop")
+	}
+}
+
+func TestHooksRewriteAndBlock(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "execute_command", Args: map[string]interface{}{"command": "rm -rf /"}}}},
+		{Content: "secret answer"},
+	}}
+	al := newTestAgentLoop(t, provider)
+
+	var toolResult string
+	al.RegisterHooks(Hooks{
+		OnUserMessage: func(hc HookContext, content string) (string, error) {
+			return strings.ToUpper(content), nil
+		},
+		OnToolCall: func(hc HookContext, name string, args map[string]interface{}) (map[string]interface{}, error) {
+			return nil, errors.New("no shell commands")
+		},
+		OnToolResult: func(hc HookContext, name, result string) (string, error) {
+			toolResult = result
+			return result, nil
+		},
+		OnAssistantReply: func(hc HookContext, content string) (string, error) {
+			return strings.ReplaceAll(content, "secret", "[redacted]"), nil
+		},
+	})
+
+	reply, err := al.ProcessDirect("hello", "cli:direct")
+	if err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+	if reply != "[redacted] answer" {
+		t.Errorf("Expected the reply hook to redact, got %q", reply)
+	}
+	if toolResult != "Error: blocked: no shell commands" {
+		t.Errorf("Expected the blocked call to be reported to the model, got %q", toolResult)
+	}
+	if history, _ := al.sessionManager.GetMessageHistory("cli:direct", 10); len(history) == 0 || history[0].Content != "HELLO" {
+		t.Errorf("Expected the rewritten user message to be saved, got %+v", history)
+	}
+
+	al.RegisterHooks(Hooks{OnUserMessage: func(hc HookContext, content string) (string, error) {
+		return "", errors.New("message rejected")
+	}})
+	if reply, _ := al.ProcessDirect("hello again", "cli:direct"); reply != "⚠ message rejected" {
+		t.Errorf("Expected a blocked message reply, got %q", reply)
+	}
+}
+
+func TestScriptHooks(t *testing.T) {
+	workspace := t.TempDir()
+	hooks, err := NewScriptHooks(config.HookConfig{
+		Event:   HookUserMessage,
+		Command: `grep -q '"content":"spam"' && echo '{"block":"spam filtered"}' || echo '{"content":"ok"}'`,
+	}, workspace)
+	if err != nil {
+		t.Fatalf("Failed to create script hooks: %v", err)
+	}
+
+	if content, err := hooks.OnUserMessage(HookContext{}, "hi"); err != nil || content != "ok" {
+		t.Errorf("Expected rewritten content, got %q (err %v)", content, err)
+	}
+	if _, err := hooks.OnUserMessage(HookContext{}, "spam"); err == nil || err.Error() != "spam filtered" {
+		t.Errorf("Expected the script to block, got %v", err)
+	}
+
+	if _, err := NewScriptHooks(config.HookConfig{Event: "on_boot", Command: "true"}, workspace); err == nil {
+		t.Errorf("Expected an error for an unknown event")
+	}
+}
+
+func TestProcessDirectFiltersToolsByChannel(t *testing.T) {
+	run := func(sessionID string) (offered, result string) {
+		provider := &scriptedProvider{responses: []*providers.ChatResponse{
+			{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "execute_command", Args: map[string]interface{}{"command": "ls"}}}},
+			{Content: "done"},
+		}}
+		al := newTestAgentLoop(t, provider)
+		al.config.Tools.Disabled = []string{"list_directory"}
+		al.config.Tools.Channels = map[string]config.ToolPolicyConfig{"discord": {Disabled: []string{"execute_command"}}}
+
+		reply, err := al.ProcessDirect("list the files", sessionID)
+		if err != nil || reply != "done" {
+			t.Fatalf("Expected the turn to finish after the tool call, got %q (err %v)", reply, err)
+		}
+		if len(provider.requests) != 2 {
+			t.Fatalf("Expected a model call before and after the tool, got %d", len(provider.requests))
+		}
+
+		var names []string
+		for _, def := range provider.requests[0].Tools {
+			names = append(names, def.Function.Name)
+		}
+		result, _ = provider.requests[1].Messages[len(provider.requests[1].Messages)-1].Content.(string)
+		return strings.Join(names, ","), result
+	}
+
+	// The global list applies everywhere and the channel's list on top of it
+	offered, result := run("discord:1")
+	if offered != "web_search" {
+		t.Errorf("Expected only web_search offered on discord, got %s", offered)
+	}
+	if strings.Contains(result, "execute_command ok") {
+		t.Errorf("Expected the disabled tool not to run on discord, got %q", result)
+	}
+
+	offered, result = run("cli:direct")
+	if offered != "execute_command,web_search" && offered != "web_search,execute_command" {
+		t.Errorf("Expected web_search and execute_command offered on the CLI, got %s", offered)
+	}
+	if !strings.Contains(result, "execute_command ok") {
+		t.Errorf("Expected the tool result fed back to the model, got %q", result)
+	}
+}
+
+func TestCronJobsAreScheduledForTheChat(t *testing.T) {
+	provider := &scriptedProvider{}
+	al := newTestAgentLoop(t, provider)
+	service, err := cron.NewCronService(filepath.Join(al.workspace, "cron", "jobs.json"))
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	al.SetCronService(service)
+
+	for _, sessionID := range []string{"telegram:42", "discord:7"} {
+		provider.responses = []*providers.ChatResponse{
+			{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "cron", Args: map[string]interface{}{
+				"action": "add", "message": "Stand up", "every_seconds": float64(3600),
+			}}}},
+			{Content: "scheduled"},
+		}
+		reply, err := al.ProcessDirect("remind me to stand up every hour", sessionID)
+		if err != nil || reply != "scheduled" {
+			t.Fatalf("Expected the turn to finish, got %q (err %v)", reply, err)
+		}
+		last := provider.requests[len(provider.requests)-1].Messages
+		if result, _ := last[len(last)-1].Content.(string); !strings.Contains(result, "Created job") {
+			t.Errorf("Expected the job to be added from %s, got %q", sessionID, result)
+		}
+	}
+
+	delivery := map[string]bool{}
+	for _, job := range service.ListJobs(true) {
+		delivery[job.Payload.Channel+":"+job.Payload.To] = true
+	}
+	if len(delivery) != 2 || !delivery["telegram:42"] || !delivery["discord:7"] {
+		t.Errorf("Expected each job delivered to the chat that asked for it, got %v", delivery)
+	}
+
+	// The registered tool stays unbound; each turn gets its own copy
+	if _, err := al.toolRegistry.Execute("cron", map[string]interface{}{"action": "add", "message": "x", "every_seconds": float64(60)}); err == nil {
+		t.Error("Expected the shared cron tool to have no chat of its own")
+	}
+}
+
+func TestRegisteredToolsHaveSchemas(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Agents.Defaults.Model = "anthropic/claude-test"
+	cfg.Providers.Anthropic.APIKey = "test-key"
+	cfg.Tools.RunCode.Enabled = true
+	cfg.Tools.Desktop.Clipboard = true
+	cfg.Tools.Desktop.Notify = true
+	al, err := NewAgentLoop(cfg)
+	if err != nil {
+		t.Fatalf("NewAgentLoop failed: %v", err)
+	}
+	service, err := cron.NewCronService(filepath.Join(al.workspace, "cron", "jobs.json"))
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	al.SetCronService(service)
+
+	// Subagents get their own registry, which is checked with the subagent package
+	names := al.toolRegistry.Names()
+	if len(names) < 20 {
+		t.Fatalf("Expected the optional tools to be registered too, got %v", names)
+	}
+	for _, name := range names {
+		if _, ok := al.toolRegistry.Get(name).(tools.SchemaTool); !ok {
+			t.Errorf("Tool %s doesn't describe its arguments with a schema", name)
+		}
+	}
+}
+
+func TestFileToolsStayInsideTheWorkspace(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "workspace")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{workspace, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("hunter2"), 0644); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(workspace, "link")); err != nil {
+		t.Skipf("Symlinks unavailable: %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Agents.Defaults.Workspace = workspace
+	cfg.Agents.Defaults.Model = "anthropic/claude-test"
+	cfg.Providers.Anthropic.APIKey = "test-key"
+	cfg.Agents.Defaults.MaxToolIterations = 3
+	cfg.Tools.RestrictToWorkspace = true
+	al, err := NewAgentLoop(cfg)
+	if err != nil {
+		t.Fatalf("NewAgentLoop failed: %v", err)
+	}
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{
+			{ID: "call_1", Name: "read_file", Args: map[string]interface{}{"path": "../outside/secret.txt"}},
+			{ID: "call_2", Name: "read_file", Args: map[string]interface{}{"path": "link/secret.txt"}},
+			{ID: "call_3", Name: "list_directory", Args: map[string]interface{}{"path": "link"}},
+			{ID: "call_4", Name: "write_file", Args: map[string]interface{}{"path": "link/planted.txt", "content": "x"}},
+			{ID: "call_5", Name: "edit_file", Args: map[string]interface{}{"path": "../outside/secret.txt", "old_text": "hunter2", "new_text": "x"}},
+		}},
+		{Content: "done"},
+	}}
+	al.provider = provider
+
+	if reply, err := al.ProcessDirect("read the secret", "cli:direct"); err != nil || reply != "done" {
+		t.Fatalf("Expected the turn to finish, got %q (err %v)", reply, err)
+	}
+	messages := provider.requests[len(provider.requests)-1].Messages
+	results := messages[len(messages)-5:]
+	for i, message := range results {
+		result, _ := message.Content.(string)
+		if !strings.Contains(result, "outside allowed directory") || strings.Contains(result, "hunter2") {
+			t.Errorf("Expected call %d to be refused, got %q", i+1, result)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(outside, "secret.txt")); string(data) != "hunter2" {
+		t.Errorf("Expected the secret to be untouched, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "planted.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be written outside the workspace, got %v", err)
+	}
+}
+
+func TestMalformedToolCallsAreRetried(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "web_search", ArgsError: "unexpected end of JSON input", RawArgs: `{"query": "go`}}},
+		{ToolCalls: []providers.ToolCall{{ID: "call_2", Name: "web_search", Args: map[string]interface{}{"query": "go"}}}},
+		{Content: "found it"},
+	}}
+	al := newTestAgentLoop(t, provider)
+
+	reply, err := al.ProcessDirect("search", "cli:direct")
+	if err != nil || reply != "found it" {
+		t.Fatalf("Expected the turn to recover, got %q (err %v)", reply, err)
+	}
+
+	feedback, _ := provider.requests[1].Messages[len(provider.requests[1].Messages)-1].Content.(string)
+	if !strings.Contains(feedback, `"error":"invalid_tool_call"`) || !strings.Contains(feedback, `"retries_left":2`) {
+		t.Errorf("Expected structured feedback for the malformed call, got %s", feedback)
+	}
+}
+
+func TestMalformedToolCallsGiveUp(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "no_such_tool"}}},
+	}}
+	al := newTestAgentLoop(t, provider)
+	al.maxIterations = 10
+	al.config.Agents.Defaults.MaxToolRetries = 2
+
+	reply, err := al.ProcessDirect("go", "cli:direct")
+	if err != nil || !strings.Contains(reply, "after 3 attempts") {
+		t.Errorf("Expected the turn to give up after the retries, got %q (err %v)", reply, err)
+	}
+	if len(provider.requests) != 3 {
+		t.Errorf("Expected 3 model calls, got %d", len(provider.requests))
+	}
+}
+
+func TestPlanAndExecute(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{Content: "1. Search for X\n2. Write the report"},
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "web_search", Args: map[string]interface{}{"query": "X"}}}},
+		{Content: "Found three facts about X."},
+		{Content: "Report drafted."},
+		{Content: "Here is the report."},
+	}}
+	al := newTestAgentLoop(t, provider)
+	al.maxIterations = 10
+
+	reply, err := al.ProcessDirect("/plan research X, then write a report", "cli:direct")
+	if err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+	if !strings.Contains(reply, "[x] 1. Search for X") || !strings.Contains(reply, "[x] 2. Write the report") ||
+		!strings.HasSuffix(reply, "Here is the report.") {
+		t.Errorf("Expected the finished plan followed by the answer, got %q", reply)
+	}
+
+	if len(provider.requests) != 5 {
+		t.Fatalf("Expected 5 model calls, got %d", len(provider.requests))
+	}
+	if provider.requests[0].Tools != nil {
+		t.Error("Expected the plan to be drafted without tools")
+	}
+	step2 := provider.requests[3].Messages
+	if instruction, _ := step2[len(step2)-1].Content.(string); !strings.Contains(instruction, "step 2 of 2: Write the report") {
+		t.Errorf("Expected the second step to be announced to the model, got %q", instruction)
+	}
+
+	shown, _ := al.ProcessDirect("/plan", "cli:direct")
+	if !strings.Contains(shown, "Task: research X, then write a report") || !strings.Contains(shown, "[x] 2. Write the report") {
+		t.Errorf("Expected /plan to show the latest plan, got %q", shown)
+	}
+}
+
+func TestPlanningFallsBackForSimpleTasks(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{Content: "1. Say hello"},
+		{Content: "Hello!"},
+	}}
+	al := newTestAgentLoop(t, provider)
+	al.config.Agents.Defaults.Planning = true
+
+	reply, err := al.ProcessDirect("hi", "cli:direct")
+	if err != nil || reply != "Hello!" {
+		t.Errorf("Expected a one-step task to run as a normal turn, got %q (err %v)", reply, err)
+	}
+}
+
+func TestParsePlanSteps(t *testing.T) {
+	steps := parsePlanSteps("Here's the plan:\n1. Search\n2) Read results\n- Summarize\n\nDone.")
+	if len(steps) != 3 || steps[0] != "Search" || steps[1] != "Read results" || steps[2] != "Summarize" {
+		t.Errorf("Unexpected steps: %q", steps)
+	}
+}
+
+func TestDangerousCommandWaitsForApproval(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "execute_command", Args: map[string]interface{}{"command": "echo danger"}}}},
+		{Content: "That command needs your approval."},
+	}}
+	al := newTestAgentLoop(t, provider)
+	filter, err := tools.NewCommandFilter("approve", []tools.CommandRule{{Pattern: `echo danger`, Reason: "is dangerous"}}, nil)
+	if err != nil {
+		t.Fatalf("NewCommandFilter failed: %v", err)
+	}
+	execTool := tools.NewExecTool(al.workspace, 10, false)
+	execTool.SetCommandFilter(filter)
+	al.toolRegistry.Register(execTool)
+
+	if _, err := al.ProcessDirect("run it", "cli:direct"); err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+	result, _ := provider.requests[1].Messages[len(provider.requests[1].Messages)-1].Content.(string)
+	if !strings.Contains(result, "needs the user's approval because it is dangerous") || !strings.Contains(result, "/approve") {
+		t.Errorf("Expected the model to be told the command is held, got %q", result)
+	}
+
+	reply, _ := al.ProcessDirect("/approve", "cli:direct")
+	if !strings.Contains(reply, "Ran the approved command `echo danger`") || !strings.Contains(reply, "danger\n") {
+		t.Errorf("Expected /approve to run the held command, got %q", reply)
+	}
+	if reply, _ := al.ProcessDirect("/approve", "cli:direct"); reply != "Nothing is waiting for approval." {
+		t.Errorf("Expected the approval to be used up, got %q", reply)
+	}
+}
+
+func TestReplyButtons(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "offer_choices", Args: map[string]interface{}{"choices": []interface{}{"Daily", "Weekly"}}}}},
+		{Content: "How often should it run?"},
+		{ToolCalls: []providers.ToolCall{{ID: "call_2", Name: "execute_command", Args: map[string]interface{}{"command": "echo danger"}}}},
+		{Content: "That command needs your approval."},
+	}}
+	al := newTestAgentLoop(t, provider)
+	filter, err := tools.NewCommandFilter("approve", []tools.CommandRule{{Pattern: `echo danger`, Reason: "is dangerous"}}, nil)
+	if err != nil {
+		t.Fatalf("NewCommandFilter failed: %v", err)
+	}
+	execTool := tools.NewExecTool(al.workspace, 10, false)
+	execTool.SetCommandFilter(filter)
+	al.toolRegistry.Register(execTool)
+	al.toolRegistry.Register(tools.NewOfferChoicesTool())
+	messageBus := bus.NewMessageBus()
+	al.SetMessageBus(messageBus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	buttonsFor := func(content string) []bus.Button {
+		al.handleInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: content})
+		msg, err := messageBus.ConsumeOutboundContext(ctx)
+		if err != nil {
+			t.Fatalf("No reply to %q: %v", content, err)
+		}
+		return msg.Buttons
+	}
+
+	if buttons := buttonsFor("remind me to stretch"); len(buttons) != 2 || buttons[0].Data != "Daily" || buttons[1].Text != "Weekly" {
+		t.Errorf("Expected the offered choices as buttons, got %v", buttons)
+	}
+	if buttons := buttonsFor("clean up"); len(buttons) != 2 || buttons[0].Data != "/approve" || buttons[1].Data != "/deny" {
+		t.Errorf("Expected approve and deny buttons for a held command, got %v", buttons)
+	}
+	if buttons := buttonsFor("/deny"); len(buttons) != 0 {
+		t.Errorf("Expected no buttons once the command is decided, got %v", buttons)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "web_search", Args: map[string]interface{}{"query": "go"}}}},
+		{Content: "done", Usage: providers.Usage{TotalTokens: 42}},
+	}}
+	al := newTestAgentLoop(t, provider)
+	events := al.Events()
+	unsubscribed := al.Events()
+	al.CloseEvents(unsubscribed)
+
+	if _, err := al.ProcessDirect("search", "cli:direct"); err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+	al.closeAllEvents()
+
+	var types []string
+	for event := range events {
+		if event.SessionKey != "cli:direct" {
+			t.Errorf("Unexpected session key %q", event.SessionKey)
+		}
+		switch event.Type {
+		case EventToolResult:
+			if event.Tool != "web_search" || event.Result != "web_search ok" {
+				t.Errorf("Unexpected tool result event: %+v", event)
+			}
+		case EventTokens:
+			if event.Content == "done" && event.Tokens != 42 {
+				t.Errorf("Expected the reported usage, got %d tokens", event.Tokens)
+			}
+		case EventTurnFinished:
+			if event.Content != "done" {
+				t.Errorf("Expected the reply in the finished event, got %q", event.Content)
+			}
+		}
+		types = append(types, event.Type)
+	}
+
+	want := []string{EventTurnStarted, EventTokens, EventToolCall, EventToolResult, EventTokens, EventTurnFinished}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected events %v, got %v", want, types)
+	}
+	if _, open := <-unsubscribed; open {
+		t.Error("Expected CloseEvents to close the channel")
+	}
+}
+
+func TestInboundAttachmentsAreDescribed(t *testing.T) {
+	provider := &echoProvider{}
+	al := newTestAgentLoop(t, provider)
+	messageBus := bus.NewMessageBus()
+	al.SetMessageBus(messageBus)
+
+	path, err := media.NewStore(al.workspace, 0).Save("telegram", "list.txt", "", strings.NewReader("eggs"))
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	al.handleInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "what's on my list?", Media: []string{path}})
+
+	history, _ := al.sessionManager.GetMessageHistory("telegram:42", 10)
+	if len(history) == 0 || !strings.Contains(history[0].Content, "media/telegram/") || !strings.Contains(history[0].Content, "contents:\n  eggs") {
+		t.Errorf("Expected the attachment to be described in the user message, got %+v", history)
+	}
+}
+
+func TestAttachedFilesAreSentWithReply(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "attach_file", Args: map[string]interface{}{"path": "chart.png"}}}},
+		{Content: "Here's the chart."},
+	}}
+	al := newTestAgentLoop(t, provider)
+	al.toolRegistry.Register(tools.NewAttachFileTool(al.workspace, ""))
+	messageBus := bus.NewMessageBus()
+	al.SetMessageBus(messageBus)
+
+	chart := filepath.Join(al.workspace, "chart.png")
+	if err := os.WriteFile(chart, []byte("png"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	al.handleInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "plot it"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, err := messageBus.ConsumeOutboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No reply published: %v", err)
+	}
+	if reply.Content != "Here's the chart." || len(reply.Attachments) != 1 || reply.Attachments[0] != chart {
+		t.Errorf("Expected the chart attached to the reply, got %+v", reply)
+	}
+}
+
+// wordEmbeddings embeds text as the counts of a few words
+type wordEmbeddings struct {
+	words []string
+}
+
+func (e wordEmbeddings) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float64, len(e.words))
+		for j, word := range e.words {
+			vectors[i][j] = float64(strings.Count(strings.ToLower(text), word))
+		}
+	}
+	return vectors, nil
+}
+
+func (e wordEmbeddings) GetModel() string {
+	return "test/words"
+}
+
+func TestKnowledgeIsRetrievedForMessages(t *testing.T) {
+	provider := &echoProvider{}
+	al := newTestAgentLoop(t, provider)
+	al.config.Memory.Knowledge = config.KnowledgeConfig{AutoRetrieve: true, MaxResults: 3, MinScore: 0.5}
+
+	kb, err := memory.NewKnowledgeBase(al.workspace, wordEmbeddings{words: []string{"boiler", "service"}}, "")
+	if err != nil {
+		t.Fatalf("Failed to create knowledge base: %v", err)
+	}
+	defer kb.Close()
+	al.knowledgeBase = kb
+	doc := "The boiler service is due every October.\n\nThe service desk opens at nine."
+	if err := os.WriteFile(filepath.Join(kb.Dir(), "house.md"), []byte(doc), 0644); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+
+	reply, err := al.ProcessDirect("When is the boiler due?", "cli:direct")
+	if err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+	if !strings.Contains(reply, "[house.md]") || !strings.Contains(reply, "every October") {
+		t.Errorf("Expected the boiler excerpt in the message sent to the model, got %q", reply)
+	}
+	if strings.Contains(reply, "service desk") {
+		t.Errorf("Expected the excerpt below min_score to be left out, got %q", reply)
+	}
+
+	// The session keeps the message as the user wrote it
+	history, _ := al.sessionManager.GetMessageHistory("cli:direct", 10)
+	if len(history) == 0 || history[0].Content != "When is the boiler due?" {
+		t.Errorf("Expected the raw message in the session, got %+v", history)
+	}
+}
+
+func TestMemoryIsScopedPerChannel(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "fact_assert", Args: map[string]interface{}{"subject": "Alice", "predicate": "employer", "value": "Acme"}}}},
+		{Content: "noted"},
+		{ToolCalls: []providers.ToolCall{{ID: "call_2", Name: "fact_query", Args: map[string]interface{}{}}}},
+		{Content: "done"},
+	}}
+	al := newTestAgentLoop(t, provider)
+	al.config.Memory.Scopes = config.MemoryScopesConfig{
+		Write:    memory.TierChannel,
+		Read:     []string{memory.TierGlobal, memory.TierChannel},
+		Channels: map[string]config.MemoryScopePolicy{"telegram": {Write: memory.TierChat}},
+	}
+
+	global, err := al.scopes().Facts(al.scopes().Global())
+	if err != nil {
+		t.Fatalf("Failed to load global facts: %v", err)
+	}
+	if _, _, err := global.Assert(memory.Fact{Subject: "user", Predicate: "name", Value: "Sam", Confidence: 1}, true); err != nil {
+		t.Fatalf("Failed to assert global fact: %v", err)
+	}
+	al.toolRegistry.Register(tools.NewFactAssertTool(global))
+	al.toolRegistry.Register(tools.NewFactQueryTool(global))
+	al.toolRegistry.Register(tools.NewFactRetractTool(global))
+
+	slackDir := al.memoryView("slack", "work").Write.Dir
+	if err := os.MkdirAll(slackDir, 0755); err != nil {
+		t.Fatalf("Failed to create scope directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(slackDir, "MEMORY.md"), []byte("Quarterly review on Friday."), 0644); err != nil {
+		t.Fatalf("Failed to write scoped memory: %v", err)
+	}
+
+	if _, err := al.ProcessDirect("Alice works at Acme", "slack:work"); err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+	if _, err := al.ProcessDirect("What do you know?", "telegram:family"); err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+
+	slackPrompt, _ := provider.requests[0].Messages[0].Content.(string)
+	familyPrompt, _ := provider.requests[2].Messages[0].Content.(string)
+	if !strings.Contains(slackPrompt, "## Long-term Memory (channel:slack)") || !strings.Contains(slackPrompt, "Quarterly review") {
+		t.Errorf("Expected the slack memory in the slack system prompt, got %q", slackPrompt)
+	}
+	if strings.Contains(familyPrompt, "Quarterly review") {
+		t.Errorf("Expected the slack memory to stay out of the telegram system prompt, got %q", familyPrompt)
+	}
+	if !strings.Contains(familyPrompt, "chat:telegram:family") {
+		t.Errorf("Expected the telegram chat scope in its system prompt, got %q", familyPrompt)
+	}
+
+	// The fact learned on slack stays there; the global fact is visible everywhere
+	messages := provider.requests[3].Messages
+	result, _ := messages[len(messages)-1].Content.(string)
+	if strings.Contains(result, "Acme") {
+		t.Errorf("Expected the slack fact to be hidden from telegram, got %q", result)
+	}
+	if !strings.Contains(result, "user name: Sam") {
+		t.Errorf("Expected the global fact in telegram, got %q", result)
+	}
+	if facts := global.Query(memory.FactQuery{Subject: "Alice"}); len(facts) != 0 {
+		t.Errorf("Expected the slack fact to stay out of global memory, got %+v", facts)
+	}
+	slackFacts, err := al.scopes().Facts(al.memoryView("slack", "work").Write)
+	if err != nil {
+		t.Fatalf("Failed to load slack facts: %v", err)
+	}
+	if facts := slackFacts.Query(memory.FactQuery{Subject: "Alice"}); len(facts) != 1 {
+		t.Errorf("Expected the fact in the slack scope, got %+v", facts)
+	}
+}
+
+func TestCompletedTurnsAreCapturedInHistory(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "write_file", Args: map[string]interface{}{"path": "notes.md", "content": "milk"}}}},
+		{Content: "Saved your   shopping\nlist to notes.md."},
+	}}
+	al := newTestAgentLoop(t, provider)
+	al.toolRegistry.Register(stubTool{name: "write_file"})
+	al.config.Memory.History.AutoCapture = true
+
+	if _, err := al.ProcessDirect("Please save my shopping list", "cli:direct"); err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+
+	history, err := memory.NewMemoryStore(al.workspace).ReadHistory()
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	for _, want := range []string{
+		"] [cli:direct] Asked: Please save my shopping list\n",
+		"Outcome: Saved your shopping list to notes.md.\n",
+		"Tools: write_file\n",
+		"Files: notes.md\n\n",
+	} {
+		if !strings.Contains(history, want) {
+			t.Errorf("Expected %q in the history log, got %q", want, history)
+		}
+	}
+
+	// Capturing can be turned off
+	al.config.Memory.History.AutoCapture = false
+	provider.responses = []*providers.ChatResponse{{Content: "ok"}}
+	if _, err := al.ProcessDirect("Nothing to see", "cli:direct"); err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+	if after, _ := memory.NewMemoryStore(al.workspace).ReadHistory(); after != history {
+		t.Errorf("Expected no record with auto_capture off, got %q", after)
+	}
+}
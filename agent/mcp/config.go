@@ -0,0 +1,57 @@
+package mcp
+
+import (
+	"sort"
+	"strings"
+
+	"nanotalon/config"
+)
+
+// ServerFromConfig returns the server configured under tools.mcp_servers.<name>
+func ServerFromConfig(name string, cfg config.MCPServerConfig) MCPServer {
+	server := MCPServer{
+		Name:         name,
+		Command:      cfg.Command,
+		Args:         cfg.Args,
+		URL:          cfg.URL,
+		Headers:      cfg.Headers,
+		Timeout:      cfg.Timeout,
+		AllowedTools: cfg.AllowedTools,
+		BlockedTools: cfg.BlockedTools,
+		OAuth: OAuthConfig{
+			ClientID:     cfg.OAuth.ClientID,
+			ClientSecret: cfg.OAuth.ClientSecret,
+			Scopes:       cfg.OAuth.Scopes,
+			CallbackPort: cfg.OAuth.CallbackPort,
+		},
+	}
+	if server.Timeout == 0 {
+		server.Timeout = cfg.ToolTimeout
+	}
+
+	// The config lower-cases keys, while environment variables are conventionally upper case
+	if len(cfg.Env) > 0 {
+		server.Env = make(map[string]string, len(cfg.Env))
+		for k, v := range cfg.Env {
+			server.Env[strings.ToUpper(k)] = v
+		}
+	}
+	return server
+}
+
+// ServersFromConfig returns the enabled servers of tools.mcp_servers, by name
+func ServersFromConfig(servers map[string]config.MCPServerConfig) []MCPServer {
+	names := make([]string, 0, len(servers))
+	for name, cfg := range servers {
+		if cfg.IsEnabled() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := make([]MCPServer, 0, len(names))
+	for _, name := range names {
+		result = append(result, ServerFromConfig(name, servers[name]))
+	}
+	return result
+}
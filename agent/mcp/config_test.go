@@ -0,0 +1,26 @@
+package mcp
+
+import (
+	"testing"
+
+	"nanotalon/config"
+)
+
+func TestServersFromConfig(t *testing.T) {
+	disabled := false
+	servers := ServersFromConfig(map[string]config.MCPServerConfig{
+		"github": {Command: "npx", Env: map[string]string{"github_token": "secret"}, ToolTimeout: 45},
+		"notion": {URL: "https://mcp.notion.com/mcp", Timeout: 10, ToolTimeout: 45},
+		"old":    {Command: "old", Enabled: &disabled},
+	})
+
+	if len(servers) != 2 || servers[0].Name != "github" || servers[1].Name != "notion" {
+		t.Fatalf("Expected the enabled servers by name, got %+v", servers)
+	}
+	if servers[0].Env["GITHUB_TOKEN"] != "secret" || servers[0].Timeout != 45 {
+		t.Errorf("Unexpected github server %+v", servers[0])
+	}
+	if servers[1].Timeout != 10 {
+		t.Errorf("Expected timeout to win over toolTimeout, got %d", servers[1].Timeout)
+	}
+}
@@ -0,0 +1,411 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// legacyEndpointTimeout bounds the wait for a legacy HTTP+SSE server to announce its endpoint
+const legacyEndpointTimeout = 10 * time.Second
+
+// httpSession is the state of an MCP session over HTTP
+type httpSession struct {
+	ctx       context.Context // Cancelled when the session closes, ending its requests and streams
+	cancel    context.CancelFunc
+	sessionID string // Mcp-Session-Id the server assigned during initialization
+	postURL   string // Where messages are posted; a legacy server announces its own
+	legacy    bool   // The server speaks the 2024-11-05 HTTP+SSE transport
+}
+
+// errSessionExpired is returned once the server no longer knows the session
+var errSessionExpired = errors.New("MCP session expired")
+
+// httpStatusError is an HTTP error status from the MCP server
+type httpStatusError struct {
+	status int
+	body   string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("MCP server returned HTTP %d: %s", e.status, e.body)
+}
+
+// legacyFallback reports whether a server answering the initialize POST with this status may
+// speak the legacy HTTP+SSE transport instead
+func (e *httpStatusError) legacyFallback() bool {
+	return e.status >= 400 && e.status < 500 && e.status != http.StatusUnauthorized && e.status != http.StatusForbidden
+}
+
+// connectViaHTTP connects to an MCP server over the streamable HTTP transport: each message
+// is POSTed to the server's URL, which answers with JSON or an SSE stream, and the server
+// sends messages of its own on a stream the client opens with GET
+func (ms *MCPSession) connectViaHTTP(ctx context.Context) error {
+	slog.Info("Connecting to MCP server via HTTP", "server", ms.Server.Name, "url", ms.Server.URL)
+
+	// Streams stay open for as long as the session, so only the wait for response headers
+	// is bounded here; sendRequest times out waiting for the response itself
+	if ms.httpClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ResponseHeaderTimeout = ms.timeout()
+		ms.httpClient = &http.Client{Transport: transport}
+	}
+	if ms.auth == nil && !hasHeader(ms.Server.Headers, "Authorization") {
+		ms.auth = newOAuthClient(ms.Server.URL, ms.Server.OAuth)
+	}
+	ms.httpSession = httpSession{postURL: ms.Server.URL}
+	ms.httpSession.ctx, ms.httpSession.cancel = context.WithCancel(context.Background())
+	ms.activeRequests = make(map[int]chan json.RawMessage)
+
+	return nil
+}
+
+// postHTTP posts a message to the server. A JSON answer is handled right away; an SSE stream
+// is read in the background, since the server may send requests of its own before the response.
+// Both end with ctx.
+func (ms *MCPSession) postHTTP(ctx context.Context, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	resp, err := ms.doHTTP(ctx, http.MethodPost, data, "application/json, text/event-stream")
+	if err != nil {
+		return err
+	}
+
+	// The server assigns the session ID when answering the initialize request
+	if sessionID := resp.Header.Get("Mcp-Session-Id"); sessionID != "" {
+		ms.mu.Lock()
+		ms.httpSession.sessionID = sessionID
+		ms.mu.Unlock()
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		resp.Body.Close()
+		return nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		statusErr := &httpStatusError{status: resp.StatusCode, body: strings.TrimSpace(string(body))}
+		if resp.StatusCode == http.StatusNotFound && resp.Request.Header.Get("Mcp-Session-Id") != "" {
+			// There is nothing left to end on the server
+			ms.mu.Lock()
+			ms.httpSession.sessionID = ""
+			ms.mu.Unlock()
+			return fmt.Errorf("%w: %w", errSessionExpired, statusErr)
+		}
+		return statusErr
+	case isEventStream(resp):
+		go func() {
+			defer resp.Body.Close()
+			readSSE(resp.Body, ms.handleEvent)
+		}()
+		return nil
+	default:
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		ms.handleMessage(body)
+		return nil
+	}
+}
+
+// listenHTTP reads the stream the server sends its own requests and notifications on, for
+// as long as the session lasts. Servers that don't offer one answer 405.
+func (ms *MCPSession) listenHTTP() {
+	ms.mu.Lock()
+	legacy := ms.httpSession.legacy
+	ms.mu.Unlock()
+	if legacy {
+		// A legacy server sends everything on the stream opened when connecting
+		return
+	}
+
+	resp, err := ms.doHTTP(context.Background(), http.MethodGet, nil, "text/event-stream")
+	if err != nil {
+		if ms.sessionContext().Err() == nil {
+			slog.Warn("Failed to open event stream of MCP server", "server", ms.Server.Name, "error", err)
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || !isEventStream(resp) {
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			slog.Warn("MCP server didn't open an event stream", "server", ms.Server.Name, "status", resp.StatusCode)
+		}
+		return
+	}
+
+	readSSE(resp.Body, ms.handleEvent)
+	if resp.Request.Context().Err() == nil {
+		slog.Info("MCP server closed its event stream", "server", ms.Server.Name)
+	}
+}
+
+// connectLegacySSE opens the event stream of a server speaking the 2024-11-05 HTTP+SSE
+// transport. Its first event announces the endpoint to post messages to; the answers
+// arrive on the stream, and the connection is lost when it closes.
+func (ms *MCPSession) connectLegacySSE(ctx context.Context) error {
+	slog.Info("MCP server doesn't take streamable HTTP, trying the HTTP+SSE transport", "server", ms.Server.Name)
+
+	ms.mu.Lock()
+	generation := ms.generation
+	ms.mu.Unlock()
+
+	resp, err := ms.doHTTP(context.Background(), http.MethodGet, nil, "text/event-stream")
+	if err != nil {
+		return fmt.Errorf("failed to open event stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || !isEventStream(resp) {
+		resp.Body.Close()
+		return fmt.Errorf("failed to open event stream: HTTP %d", resp.StatusCode)
+	}
+
+	endpoint := make(chan string, 1)
+	go func() {
+		defer resp.Body.Close()
+		readSSE(resp.Body, func(event sseEvent) {
+			if event.name == "endpoint" {
+				select {
+				case endpoint <- string(event.data):
+				default:
+				}
+				return
+			}
+			ms.handleEvent(event)
+		})
+		if resp.Request.Context().Err() == nil {
+			ms.connectionLost(generation, errors.New("event stream closed"))
+		}
+	}()
+
+	select {
+	case path := <-endpoint:
+		postURL, err := resolveEndpoint(ms.Server.URL, path)
+		if err != nil {
+			return err
+		}
+		ms.mu.Lock()
+		ms.httpSession.postURL = postURL
+		ms.httpSession.legacy = true
+		ms.mu.Unlock()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(legacyEndpointTimeout):
+		return fmt.Errorf("MCP server didn't announce an endpoint within %s", legacyEndpointTimeout)
+	}
+}
+
+// resolveEndpoint resolves the endpoint a legacy server announced against its URL. Only
+// endpoints on the same origin are accepted, so a server can't redirect messages elsewhere.
+func resolveEndpoint(serverURL, endpoint string) (string, error) {
+	base, err := url.Parse(serverURL)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := base.Parse(strings.TrimSpace(endpoint))
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if resolved.Scheme != base.Scheme || resolved.Host != base.Host {
+		return "", fmt.Errorf("endpoint %q is not on the server's origin", endpoint)
+	}
+	return resolved.String(), nil
+}
+
+// closeHTTP ends the session on the server and closes its streams. ms.mu is held.
+func (ms *MCPSession) closeHTTP() {
+	if ms.httpSession.cancel == nil {
+		return
+	}
+
+	if ms.httpSession.sessionID != "" && !ms.httpSession.legacy {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if req, err := http.NewRequestWithContext(ctx, http.MethodDelete, ms.Server.URL, nil); err == nil {
+			ms.setHTTPHeaders(req, ms.httpSession.sessionID, ms.protocolVersion)
+			if ms.auth != nil {
+				setBearer(req, ms.auth.cachedToken())
+			}
+			if resp, err := ms.httpClient.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+		ms.httpSession.sessionID = ""
+	}
+
+	ms.httpSession.cancel()
+}
+
+// doHTTP sends a request to the server. When the server turns it down as unauthorized, the
+// client gets a new token if it can and sends the request once more.
+func (ms *MCPSession) doHTTP(ctx context.Context, method string, body []byte, accept string) (*http.Response, error) {
+	for retried := false; ; retried = true {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := ms.newHTTPRequest(ctx, method, reader)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Accept", accept)
+
+		resp, err := ms.httpClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || ms.auth == nil {
+			return resp, err
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		statusErr := &httpStatusError{status: resp.StatusCode, body: strings.TrimSpace(string(respBody))}
+		if retried {
+			return nil, statusErr
+		}
+		if err := ms.auth.authorize(req.Context(), challenge); err != nil {
+			return nil, fmt.Errorf("%w, run 'nanotalon mcp login %s': %w", err, ms.Server.Name, statusErr)
+		}
+	}
+}
+
+// sessionContext returns the context that ends with the session
+func (ms *MCPSession) sessionContext() context.Context {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.httpSession.ctx
+}
+
+// newHTTPRequest creates a request to the server that ends with ctx or the session, whichever
+// ends first. POSTs go to the endpoint messages are posted to, other methods to the server's URL.
+func (ms *MCPSession) newHTTPRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	ms.mu.Lock()
+	target := ms.Server.URL
+	if method == http.MethodPost {
+		target = ms.httpSession.postURL
+	}
+	sessionCtx, sessionID, version := ms.httpSession.ctx, ms.httpSession.sessionID, ms.protocolVersion
+	auth := ms.auth
+	ms.mu.Unlock()
+
+	if ctx.Done() == nil {
+		ctx = sessionCtx
+	} else {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		stop := context.AfterFunc(sessionCtx, cancel)
+		context.AfterFunc(ctx, func() { stop() })
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	ms.setHTTPHeaders(req, sessionID, version)
+	if auth != nil {
+		setBearer(req, auth.accessToken(ctx))
+	}
+	return req, nil
+}
+
+// setBearer authorizes a request with an access token, if there is one
+func setBearer(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// hasHeader reports whether headers set the named header, whatever its case
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// setHTTPHeaders sets the configured headers and those identifying the session
+func (ms *MCPSession) setHTTPHeaders(req *http.Request, sessionID, version string) {
+	for k, v := range ms.Server.Headers {
+		req.Header.Set(k, v)
+	}
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+	if version != "" {
+		req.Header.Set("MCP-Protocol-Version", version)
+	}
+}
+
+// handleEvent handles a message the server sent as an SSE event
+func (ms *MCPSession) handleEvent(event sseEvent) {
+	if event.name == "" || event.name == "message" {
+		ms.handleMessage(event.data)
+	}
+}
+
+// isEventStream reports whether a response is a server-sent event stream
+func isEventStream(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// sseEvent is an event of a server-sent event stream
+type sseEvent struct {
+	name string
+	data []byte
+}
+
+// readSSE calls onEvent for each event of a server-sent event stream until the stream ends
+func readSSE(r io.Reader, onEvent func(sseEvent)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var name string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line ends the event; events without data are skipped
+			if data.Len() > 0 {
+				onEvent(sseEvent{name: name, data: []byte(strings.TrimSuffix(data.String(), "\n"))})
+			}
+			name = ""
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // A comment, such as a keep-alive
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			name = value
+		case "data":
+			data.WriteString(value)
+			data.WriteString("\n")
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rpcMessage is a JSON-RPC message as the test servers see it
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+func readRPC(t *testing.T, r *http.Request) rpcMessage {
+	var msg rpcMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		t.Errorf("Failed to decode posted message: %v", err)
+	}
+	return msg
+}
+
+func TestStreamableHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var posted []string
+	var deleted bool
+	pingAnswered := make(chan bool, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		case http.MethodDelete:
+			mu.Lock()
+			deleted = r.Header.Get("Mcp-Session-Id") == "session-1"
+			mu.Unlock()
+			return
+		}
+
+		msg := readRPC(t, r)
+		mu.Lock()
+		posted = append(posted, msg.Method)
+		mu.Unlock()
+		if msg.Method != "initialize" && r.Header.Get("Mcp-Session-Id") != "session-1" {
+			t.Errorf("Expected the session ID on %q, got headers %v", msg.Method, r.Header)
+		}
+
+		switch {
+		case msg.Method == "initialize":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Mcp-Session-Id", "session-1")
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{"protocolVersion":"2025-06-18","capabilities":{"tools":{}}}}`, msg.ID)
+		case msg.Method == "tools/list":
+			// Ask the client something before answering, as servers may do on the stream
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": keep-alive\n\nevent: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":\"srv-1\",\"method\":\"ping\"}\n\n")
+			fmt.Fprintf(w, "data: {\"jsonrpc\":\"2.0\",\"id\":%s,\ndata: \"result\":{\"tools\":[{\"name\":\"echo\"}]}}\n\n", msg.ID)
+		case msg.Method == "" && string(msg.ID) == `"srv-1"`:
+			pingAnswered <- string(msg.Result) == "{}"
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+
+	session := &MCPSession{Server: &MCPServer{Name: "test", URL: server.URL, Timeout: 5}}
+	if err := session.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := session.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	tools, err := session.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	if len(tools) != 1 || tools[0].Name != "echo" {
+		t.Errorf("Expected the echo tool, got %+v", tools)
+	}
+	select {
+	case ok := <-pingAnswered:
+		if !ok {
+			t.Error("Expected an empty result for the ping")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the ping sent on the stream to be answered")
+	}
+	session.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posted) < 3 || posted[0] != "initialize" || posted[1] != "notifications/initialized" {
+		t.Errorf("Expected initialize and the initialized notification first, got %v", posted)
+	}
+	if !deleted {
+		t.Error("Expected the session to be ended with DELETE")
+	}
+}
+
+func TestLegacySSEFallback(t *testing.T) {
+	events := make(chan string, 4)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: endpoint\ndata: /messages?session=1\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case event := <-events:
+				fmt.Fprint(w, event)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		msg := readRPC(t, r)
+		w.WriteHeader(http.StatusAccepted)
+		if msg.Method == "initialize" {
+			events <- fmt.Sprintf("event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":%s,\"result\":{\"protocolVersion\":\"2024-11-05\"}}\n\n", msg.ID)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	session := &MCPSession{Server: &MCPServer{Name: "legacy", URL: server.URL + "/sse", Timeout: 5}}
+	if err := session.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer session.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- session.Initialize(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Initialize didn't finish")
+	}
+	if session.protocolVersion != "2024-11-05" || session.httpSession.postURL != server.URL+"/messages?session=1" {
+		t.Errorf("Expected the legacy endpoint to be used, got %q at %q", session.protocolVersion, session.httpSession.postURL)
+	}
+}
+
+func TestResolveEndpoint(t *testing.T) {
+	if got, err := resolveEndpoint("https://mcp.example.com/sse", "/messages?id=1"); err != nil || got != "https://mcp.example.com/messages?id=1" {
+		t.Errorf("Unexpected endpoint %q, %v", got, err)
+	}
+	if _, err := resolveEndpoint("https://mcp.example.com/sse", "https://attacker.example/collect"); err == nil {
+		t.Error("Expected an endpoint on another origin to be rejected")
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := "retry: 1000\n\nevent: endpoint\ndata: /a\n\n: comment\ndata:line 1\ndata: line 2\n\ndata: unterminated"
+	var events []sseEvent
+	readSSE(strings.NewReader(stream), func(event sseEvent) { events = append(events, event) })
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %+v", events)
+	}
+	if events[0].name != "endpoint" || string(events[0].data) != "/a" {
+		t.Errorf("Unexpected first event %+v", events[0])
+	}
+	if events[1].name != "" || string(events[1].data) != "line 1\nline 2" {
+		t.Errorf("Unexpected second event %q", events[1].data)
+	}
+}
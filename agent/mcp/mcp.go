@@ -2,11 +2,13 @@ package mcp
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os/exec"
 	"strings"
@@ -24,7 +26,13 @@ type MCPServer struct {
 	URL     string
 	Headers map[string]string
 	Env     map[string]string
-	Timeout int
+	Timeout int         // Seconds to wait for a response; DefaultTimeout if not positive
+	OAuth   OAuthConfig // For http transport, unless Headers sets Authorization
+
+	AllowedTools []string // Glob patterns of the tools offered to the agent; all of them if empty
+	BlockedTools []string // Glob patterns of tools never offered, even if allowed
+
+	Sampling SamplingHandler // Answers the server's sampling requests; not offered if nil
 }
 
 // TransportType defines the type of transport to use for MCP connections
@@ -36,6 +44,12 @@ const (
 	WebSocketTransport TransportType = "websocket"
 )
 
+// DefaultTimeout is how many seconds requests wait for a response unless the server sets its own
+const DefaultTimeout = 30
+
+// protocolVersion is the MCP revision the client asks for in the initialize handshake
+const protocolVersion = "2025-06-18"
+
 // MCPSession represents a connection to an MCP server
 type MCPSession struct {
 	Server     *MCPServer
@@ -43,11 +57,27 @@ type MCPSession struct {
 	stdinCmd   *exec.Cmd // For stdio transport
 	wsConn     *websocket.Conn // For websocket transport
 	httpClient *http.Client // For http transport
+	httpSession httpSession // For http transport
+	auth       *oauthClient // For http transport, unless an Authorization header is configured
 	writer     io.Writer
 	reader     io.Reader
 	reqID      int
 	mu         sync.Mutex
+	writeMu    sync.Mutex // Serializes writes to stdin and the WebSocket
 	activeRequests map[int]chan json.RawMessage
+
+	// Agreed on in the initialize handshake
+	protocolVersion string
+	capabilities    map[string]interface{}
+
+	connected    bool
+	closed       bool
+	reconnecting bool
+	generation   int    // Counts connections, so the reader of an old one can't report the new one lost
+	onReconnect  func() // Called after the session reconnected and initialized again
+
+	progressHandlers map[int]func(Progress) // By progress token, which is the request's ID
+	onToolsChanged   func()                 // Called when the server's tool list changed
 }
 
 // Connect connects to an MCP server using the appropriate transport
@@ -55,26 +85,38 @@ func (ms *MCPSession) Connect(ctx context.Context) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
+	if ms.closed {
+		return fmt.Errorf("MCP session %s is closed", ms.Server.Name)
+	}
+	ms.generation++
+	if ms.progressHandlers == nil {
+		ms.progressHandlers = make(map[int]func(Progress))
+	}
+
+	var err error
 	if ms.Server.Command != "" {
 		ms.transport = StdioTransport
-		return ms.connectViaStdio(ctx)
+		err = ms.connectViaStdio(ctx)
 	} else if ms.Server.URL != "" {
 		// Determine transport based on URL scheme
 		if strings.HasPrefix(ms.Server.URL, "ws://") || strings.HasPrefix(ms.Server.URL, "wss://") {
 			ms.transport = WebSocketTransport
-			return ms.connectViaWebSocket(ctx)
+			err = ms.connectViaWebSocket(ctx)
 		} else {
 			ms.transport = HTTPTransport
-			return ms.connectViaHTTP(ctx)
+			err = ms.connectViaHTTP(ctx)
 		}
+	} else {
+		return fmt.Errorf("neither command nor URL provided for MCP server %s", ms.Server.Name)
 	}
 
-	return fmt.Errorf("neither command nor URL provided for MCP server %s", ms.Server.Name)
+	ms.connected = err == nil
+	return err
 }
 
 // connectViaStdio connects to an MCP server via stdio
 func (ms *MCPSession) connectViaStdio(ctx context.Context) error {
-	log.Printf("Connecting to MCP server %s via stdio", ms.Server.Name)
+	slog.Info("Connecting to MCP server via stdio", "server", ms.Server.Name)
 
 	// Set up the command with proper environment
 	cmd := exec.CommandContext(ctx, ms.Server.Command, ms.Server.Args...)
@@ -110,45 +152,32 @@ func (ms *MCPSession) connectViaStdio(ctx context.Context) error {
 	ms.writer = stdin
 	ms.activeRequests = make(map[int]chan json.RawMessage)
 
-	// Start reading responses in a goroutine
-	go ms.readStdioResponses(stdout)
+	// Start reading responses in a goroutine; the connection is lost when the process exits
+	generation := ms.generation
+	go func() {
+		ms.readStdioResponses(stdout)
+		err := cmd.Wait()
+		if err == nil {
+			err = fmt.Errorf("process exited")
+		}
+		ms.connectionLost(generation, err)
+	}()
 
 	return nil
 }
 
-// readStdioResponses reads responses from the MCP server (stdio version)
+// readStdioResponses reads messages from the MCP server (stdio version)
 func (ms *MCPSession) readStdioResponses(reader io.Reader) {
 	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
 	for scanner.Scan() {
-		var response map[string]interface{}
-		line := scanner.Bytes()
-
-		if err := json.Unmarshal(line, &response); err != nil {
-			log.Printf("Error decoding MCP response: %v", err)
-			continue
-		}
-
-		// Handle the response - check if it's a response to a request we made
-		if idVal, ok := response["id"]; ok {
-			idFloat, ok := idVal.(float64)
-			if !ok {
-				continue
-			}
-			id := int(idFloat)
-
-			ms.mu.Lock()
-			if ch, exists := ms.activeRequests[id]; exists {
-				ch <- line
-				delete(ms.activeRequests, id)
-			}
-			ms.mu.Unlock()
-		}
+		ms.handleMessage(scanner.Bytes())
 	}
 }
 
 // connectViaWebSocket connects to an MCP server via WebSocket
 func (ms *MCPSession) connectViaWebSocket(ctx context.Context) error {
-	log.Printf("Connecting to MCP server %s via WebSocket: %s", ms.Server.Name, ms.Server.URL)
+	slog.Info("Connecting to MCP server via WebSocket", "server", ms.Server.Name, "url", ms.Server.URL)
 
 	headers := make(http.Header)
 	for k, v := range ms.Server.Headers {
@@ -164,64 +193,131 @@ func (ms *MCPSession) connectViaWebSocket(ctx context.Context) error {
 	ms.activeRequests = make(map[int]chan json.RawMessage)
 
 	// Start reading responses in a goroutine
-	go ms.readWebSocketResponses(conn)
+	go ms.readWebSocketResponses(conn, ms.generation)
 
 	return nil
 }
 
 // readWebSocketResponses reads responses from the MCP server (WebSocket version)
-func (ms *MCPSession) readWebSocketResponses(conn *websocket.Conn) {
+func (ms *MCPSession) readWebSocketResponses(conn *websocket.Conn, generation int) {
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
-			log.Printf("Error reading WebSocket message: %v", err)
+			ms.connectionLost(generation, err)
 			return
 		}
+		ms.handleMessage(message)
+	}
+}
 
-		var response map[string]interface{}
-		if err := json.Unmarshal(message, &response); err != nil {
-			log.Printf("Error decoding MCP WebSocket response: %v", err)
-			continue
+// handleMessage routes a JSON-RPC message from the server: a response goes to the request
+// waiting for it, a request from the server is answered and a notification is handled.
+func (ms *MCPSession) handleMessage(data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return
+	}
+	if data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			slog.Error("Error decoding MCP message batch", "server", ms.Server.Name, "error", err)
+			return
+		}
+		for _, message := range batch {
+			ms.handleMessage(message)
 		}
+		return
+	}
 
-		// Handle the response - check if it's a response to a request we made
-		if idVal, ok := response["id"]; ok {
-			idFloat, ok := idVal.(float64)
-			if !ok {
-				continue
-			}
-			id := int(idFloat)
+	var message struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		slog.Error("Error decoding MCP message", "server", ms.Server.Name, "error", err)
+		return
+	}
 
-			ms.mu.Lock()
-			if ch, exists := ms.activeRequests[id]; exists {
-				ch <- message
-				delete(ms.activeRequests, id)
-			}
-			ms.mu.Unlock()
+	hasID := len(message.ID) > 0 && string(message.ID) != "null"
+	switch {
+	case message.Method != "" && hasID:
+		go ms.answerRequest(message.ID, message.Method, message.Params)
+	case message.Method != "":
+		ms.handleNotification(message.Method, message.Params)
+	case hasID:
+		var id int
+		if err := json.Unmarshal(message.ID, &id); err != nil {
+			return
 		}
+		ms.mu.Lock()
+		if ch, exists := ms.activeRequests[id]; exists {
+			ch <- append(json.RawMessage(nil), data...)
+			delete(ms.activeRequests, id)
+		}
+		ms.mu.Unlock()
 	}
 }
 
-// connectViaHTTP connects to an MCP server via HTTP (SSE)
-func (ms *MCPSession) connectViaHTTP(ctx context.Context) error {
-	log.Printf("Connecting to MCP server %s via HTTP: %s", ms.Server.Name, ms.Server.URL)
-
-	client := &http.Client{
-		Timeout: time.Duration(ms.Server.Timeout) * time.Second,
+// answerRequest answers a request from the server: pings, and sampling requests if the
+// server may sample the agent's model; the client offers no other methods
+func (ms *MCPSession) answerRequest(id json.RawMessage, method string, params json.RawMessage) {
+	response := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+	}
+	switch {
+	case method == "ping":
+		response["result"] = map[string]interface{}{}
+	case method == "sampling/createMessage" && ms.Server.Sampling != nil:
+		if result, rpcErr := ms.answerSampling(params); rpcErr != nil {
+			response["error"] = rpcErr
+		} else {
+			response["result"] = result
+		}
+	default:
+		response["error"] = map[string]interface{}{"code": -32601, "message": "Method not found: " + method}
 	}
 
-	ms.httpClient = client
-	ms.activeRequests = make(map[int]chan json.RawMessage)
-
-	return nil
+	if err := ms.writeMessage(context.Background(), response); err != nil {
+		slog.Error("Error answering MCP server request", "server", ms.Server.Name, "method", method, "error", err)
+	}
 }
 
 // sendRequest sends a JSON-RPC request to the MCP server
-func (ms *MCPSession) sendRequest(method string, params interface{}) (json.RawMessage, error) {
+func (ms *MCPSession) sendRequest(ctx context.Context, method string, params map[string]interface{}) (json.RawMessage, error) {
+	return ms.sendRequestWithProgress(ctx, method, params, nil)
+}
+
+// sendRequestWithProgress sends a JSON-RPC request, asking the server to report its progress
+// to onProgress if it isn't nil. It waits for the response until ctx ends or the server's
+// timeout passes, and then tells the server the request is cancelled.
+func (ms *MCPSession) sendRequestWithProgress(ctx context.Context, method string, params map[string]interface{}, onProgress func(Progress)) (json.RawMessage, error) {
+	errTimeout := fmt.Errorf("request timeout after %s", ms.timeout())
+	ctx, cancel := context.WithTimeoutCause(ctx, ms.timeout(), errTimeout)
+	defer cancel()
+
 	ms.mu.Lock()
+	if !ms.connected {
+		ms.mu.Unlock()
+		return nil, fmt.Errorf("MCP server %s is not connected", ms.Server.Name)
+	}
+	generation := ms.generation
 	ms.reqID++
 	id := ms.reqID
 
+	if onProgress != nil {
+		// The request ID doubles as the progress token
+		meta := map[string]interface{}{"progressToken": id}
+		params = withMeta(params, meta)
+		ms.progressHandlers[id] = onProgress
+		defer func() {
+			ms.mu.Lock()
+			delete(ms.progressHandlers, id)
+			ms.mu.Unlock()
+		}()
+	}
+
 	req := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"id":      id,
@@ -234,102 +330,94 @@ func (ms *MCPSession) sendRequest(method string, params interface{}) (json.RawMe
 	ms.activeRequests[id] = responseChan
 	ms.mu.Unlock()
 
-	// Send the request based on transport type
-	var sendErr error
-	switch ms.transport {
-	case StdioTransport:
-		sendErr = ms.sendStdioRequest(req, responseChan)
-	case WebSocketTransport:
-		sendErr = ms.sendWebSocketRequest(req, responseChan)
-	case HTTPTransport:
-		sendErr = ms.sendHTTPRequest(req, responseChan)
-	default:
-		return nil, fmt.Errorf("unsupported transport type: %s", ms.transport)
-	}
-
-	if sendErr != nil {
+	sendErr := ms.writeMessage(ctx, req)
+	if sendErr != nil && ctx.Err() == nil {
 		ms.mu.Lock()
 		delete(ms.activeRequests, id)
 		ms.mu.Unlock()
+		if isConnectionError(sendErr) {
+			ms.connectionLost(generation, sendErr)
+		}
 		return nil, fmt.Errorf("failed to send request: %w", sendErr)
 	}
 
-	// Wait for response with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(ms.Server.Timeout)*time.Second)
-	defer cancel()
-
 	select {
-	case response := <-responseChan:
+	case response, ok := <-responseChan:
+		if !ok {
+			return nil, fmt.Errorf("lost connection to MCP server %s", ms.Server.Name)
+		}
 		return response, nil
 	case <-ctx.Done():
 		ms.mu.Lock()
 		delete(ms.activeRequests, id)
 		ms.mu.Unlock()
-		return nil, fmt.Errorf("request timeout after %ds", ms.Server.Timeout)
-	}
-}
 
-// sendStdioRequest sends a request via stdio transport
-func (ms *MCPSession) sendStdioRequest(req map[string]interface{}, responseChan chan json.RawMessage) error {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return err
+		// The initialize request can't be cancelled; the session is dropped instead
+		if method != "initialize" {
+			go ms.notify("notifications/cancelled", map[string]interface{}{"requestId": id, "reason": ctx.Err().Error()})
+		}
+		if context.Cause(ctx) == errTimeout {
+			return nil, errTimeout
+		}
+		return nil, fmt.Errorf("request cancelled: %w", ctx.Err())
 	}
-
-	// Add newline as MCP expects line-delimited JSON
-	data = append(data, '\n')
-
-	_, err = ms.writer.Write(data)
-	return err
 }
 
-// sendWebSocketRequest sends a request via WebSocket transport
-func (ms *MCPSession) sendWebSocketRequest(req map[string]interface{}, responseChan chan json.RawMessage) error {
-	return ms.wsConn.WriteJSON(req)
+// timeout returns how long requests wait for a response
+func (ms *MCPSession) timeout() time.Duration {
+	if ms.Server.Timeout <= 0 {
+		return DefaultTimeout * time.Second
+	}
+	return time.Duration(ms.Server.Timeout) * time.Second
 }
 
-// sendHTTPRequest sends a request via HTTP transport
-func (ms *MCPSession) sendHTTPRequest(req map[string]interface{}, responseChan chan json.RawMessage) error {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return err
+// notify sends a JSON-RPC notification to the MCP server
+func (ms *MCPSession) notify(method string, params interface{}) error {
+	notification := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
 	}
-
-	httpReq, err := http.NewRequest("POST", ms.Server.URL, strings.NewReader(string(data)))
-	if err != nil {
-		return err
+	if params != nil {
+		notification["params"] = params
 	}
+	return ms.writeMessage(context.Background(), notification)
+}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	for k, v := range ms.Server.Headers {
-		httpReq.Header.Set(k, v)
-	}
+// writeMessage sends a JSON-RPC message over the session's transport. Only HTTP requests end
+// with ctx; writes to stdin and the WebSocket don't block for long.
+func (ms *MCPSession) writeMessage(ctx context.Context, message interface{}) error {
+	ms.mu.Lock()
+	transport, writer, wsConn := ms.transport, ms.writer, ms.wsConn
+	ms.mu.Unlock()
 
-	resp, err := ms.httpClient.Do(httpReq)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+	switch transport {
+	case StdioTransport:
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
 
-	responseData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
+		// Add newline as MCP expects line-delimited JSON
+		data = append(data, '\n')
 
-	var response map[string]interface{}
-	if err := json.Unmarshal(responseData, &response); err != nil {
+		ms.writeMu.Lock()
+		defer ms.writeMu.Unlock()
+		_, err = writer.Write(data)
 		return err
+	case WebSocketTransport:
+		ms.writeMu.Lock()
+		defer ms.writeMu.Unlock()
+		return wsConn.WriteJSON(message)
+	case HTTPTransport:
+		return ms.postHTTP(ctx, message)
+	default:
+		return fmt.Errorf("unsupported transport type: %s", transport)
 	}
-
-	// Send response to the waiting channel
-	responseChan <- responseData
-
-	return nil
 }
 
 // ListTools lists available tools from the MCP server
 func (ms *MCPSession) ListTools(ctx context.Context) ([]ToolDefinition, error) {
-	response, err := ms.sendRequest("tools/list", map[string]interface{}{})
+	response, err := ms.sendRequest(ctx, "tools/list", map[string]interface{}{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list tools: %w", err)
 	}
@@ -371,19 +459,24 @@ func (ms *MCPSession) ListTools(ctx context.Context) ([]ToolDefinition, error) {
 }
 
 // CallTool calls a specific tool on the MCP server
-func (ms *MCPSession) CallTool(ctx context.Context, toolName string, arguments map[string]interface{}) (interface{}, error) {
+func (ms *MCPSession) CallTool(ctx context.Context, toolName string, arguments map[string]interface{}) (*CallToolResult, error) {
+	return ms.CallToolWithProgress(ctx, toolName, arguments, nil)
+}
+
+// CallToolWithProgress calls a tool, passing the progress the server reports to onProgress
+func (ms *MCPSession) CallToolWithProgress(ctx context.Context, toolName string, arguments map[string]interface{}, onProgress func(Progress)) (*CallToolResult, error) {
 	params := map[string]interface{}{
 		"name":      toolName,
 		"arguments": arguments,
 	}
 
-	response, err := ms.sendRequest("tools/call", params)
+	response, err := ms.sendRequestWithProgress(ctx, "tools/call", params, onProgress)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call tool %s: %w", toolName, err)
 	}
 
 	var result struct {
-		Result interface{} `json:"result"`
+		Result CallToolResult `json:"result"`
 		Error  *struct {
 			Code    int    `json:"code"`
 			Message string `json:"message"`
@@ -399,23 +492,39 @@ func (ms *MCPSession) CallTool(ctx context.Context, toolName string, arguments m
 		return nil, fmt.Errorf("MCP server error %d: %s", result.Error.Code, result.Error.Message)
 	}
 
-	return result.Result, nil
+	return &result.Result, nil
 }
 
 // Initialize performs the MCP initialization handshake
 func (ms *MCPSession) Initialize(ctx context.Context) error {
+	capabilities := map[string]interface{}{}
+	if ms.Server.Sampling != nil {
+		capabilities["sampling"] = map[string]interface{}{}
+	}
 	params := map[string]interface{}{
-		"capabilities": map[string]interface{}{},
+		"protocolVersion": protocolVersion,
+		"capabilities":    capabilities,
+		"clientInfo":      map[string]interface{}{"name": "nanotalon", "version": "0.1.0"},
+	}
+
+	response, err := ms.sendRequest(ctx, "initialize", params)
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.legacyFallback() {
+		// Servers of the 2024-11-05 revision reject the POST; they take messages at an
+		// endpoint announced on their SSE stream
+		if err := ms.connectLegacySSE(ctx); err != nil {
+			return fmt.Errorf("failed to initialize: %w", err)
+		}
+		response, err = ms.sendRequest(ctx, "initialize", params)
 	}
-
-	response, err := ms.sendRequest("initialize", params)
 	if err != nil {
 		return fmt.Errorf("failed to initialize: %w", err)
 	}
 
 	var result struct {
 		Result struct {
-			ServerCapabilities map[string]interface{} `json:"serverCapabilities"`
+			ProtocolVersion string                 `json:"protocolVersion"`
+			Capabilities    map[string]interface{} `json:"capabilities"`
 		} `json:"result"`
 		Error *struct {
 			Code    int    `json:"code"`
@@ -432,7 +541,19 @@ func (ms *MCPSession) Initialize(ctx context.Context) error {
 		return fmt.Errorf("MCP server initialization error %d: %s", result.Error.Code, result.Error.Message)
 	}
 
-	log.Printf("MCP server %s initialized successfully", ms.Server.Name)
+	ms.mu.Lock()
+	ms.protocolVersion = result.Result.ProtocolVersion
+	ms.capabilities = result.Result.Capabilities
+	ms.mu.Unlock()
+
+	if err := ms.notify("notifications/initialized", nil); err != nil {
+		return fmt.Errorf("failed to send initialized notification: %w", err)
+	}
+	if ms.transport == HTTPTransport {
+		go ms.listenHTTP()
+	}
+
+	slog.Info("MCP server initialized", "server", ms.Server.Name)
 	return nil
 }
 
@@ -441,6 +562,13 @@ func (ms *MCPSession) Close() error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
+	ms.closed = true
+	ms.connected = false
+	return ms.closeTransport()
+}
+
+// closeTransport closes the current connection. ms.mu is held.
+func (ms *MCPSession) closeTransport() error {
 	switch ms.transport {
 	case StdioTransport:
 		if ms.stdinCmd != nil {
@@ -451,9 +579,7 @@ func (ms *MCPSession) Close() error {
 			return ms.wsConn.Close()
 		}
 	case HTTPTransport:
-		if ms.httpClient != nil {
-			// HTTP clients don't need explicit closing for individual requests
-		}
+		ms.closeHTTP()
 	}
 
 	return nil
@@ -466,6 +592,33 @@ type ToolDefinition struct {
 	InputSchema map[string]interface{} `json:"inputSchema"`
 }
 
+// CallToolResult is the result of a tool call
+type CallToolResult struct {
+	Content           []ContentBlock `json:"content"`
+	StructuredContent interface{}    `json:"structuredContent,omitempty"`
+	IsError           bool           `json:"isError,omitempty"`
+}
+
+// ContentBlock is a piece of a tool result: text, an image or audio clip, a resource
+// embedded in the result, or a link to one
+type ContentBlock struct {
+	Type     string            `json:"type"` // text, image, audio, resource or resource_link
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"` // Base64, for images and audio
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *EmbeddedResource `json:"resource,omitempty"`
+	URI      string            `json:"uri,omitempty"` // For resource links
+	Name     string            `json:"name,omitempty"`
+}
+
+// EmbeddedResource is a resource whose contents are part of a tool result
+type EmbeddedResource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"` // Base64
+}
+
 // MCPServerManager manages multiple MCP servers
 type MCPServerManager struct {
 	servers map[string]*MCPSession
@@ -500,15 +653,16 @@ func (mm *MCPServerManager) ConnectAll(ctx context.Context) error {
 	var lastErr error
 	for name, session := range mm.servers {
 		if err := session.Connect(ctx); err != nil {
-			log.Printf("Failed to connect to MCP server %s: %v", name, err)
+			slog.Error("Failed to connect to MCP server", "server", name, "error", err)
+			session.retryLater()
 			lastErr = err
 			continue
 		}
 
 		// Perform initialization handshake
 		if err := session.Initialize(ctx); err != nil {
-			log.Printf("Failed to initialize MCP server %s: %v", name, err)
-			session.Close()
+			slog.Error("Failed to initialize MCP server", "server", name, "error", err)
+			session.retryLater()
 			lastErr = err
 			continue
 		}
@@ -526,7 +680,7 @@ func (mm *MCPServerManager) GetTools(ctx context.Context) ([]ToolDefinition, err
 	for name, session := range mm.servers {
 		tools, err := session.ListTools(ctx)
 		if err != nil {
-			log.Printf("Failed to list tools from MCP server %s: %v", name, err)
+			slog.Error("Failed to list tools from MCP server", "server", name, "error", err)
 			continue
 		}
 
@@ -541,7 +695,7 @@ func (mm *MCPServerManager) GetTools(ctx context.Context) ([]ToolDefinition, err
 }
 
 // CallTool calls a tool on the appropriate MCP server
-func (mm *MCPServerManager) CallTool(ctx context.Context, fullToolName string, arguments map[string]interface{}) (interface{}, error) {
+func (mm *MCPServerManager) CallTool(ctx context.Context, fullToolName string, arguments map[string]interface{}) (*CallToolResult, error) {
 	mm.mu.RLock()
 	defer mm.mu.RUnlock()
 
@@ -0,0 +1,90 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCancelledRequest(t *testing.T) {
+	cancelled := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				RequestID json.RawMessage `json:"requestId"`
+			} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		switch msg.Method {
+		case "initialize":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{"protocolVersion":"2025-06-18"}}`, msg.ID)
+		case "tools/call":
+			// Never answer; the stream stays open until the client gives up
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		case "notifications/cancelled":
+			cancelled <- string(msg.Params.RequestID)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+
+	session := &MCPSession{Server: &MCPServer{Name: "slow", URL: server.URL}}
+	if err := session.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer session.Close()
+	if err := session.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := session.CallTool(ctx, "wait", nil)
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("Expected the call to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the call to end with its context, took %s", elapsed)
+	}
+
+	select {
+	case id := <-cancelled:
+		if id != "2" {
+			t.Errorf("Expected request 2 to be cancelled, got %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the server to be told the request is cancelled")
+	}
+	if !session.Connected() {
+		t.Error("Expected a cancelled request to leave the session connected")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	session := &MCPSession{Server: &MCPServer{Name: "default"}}
+	if got := session.timeout(); got != DefaultTimeout*time.Second {
+		t.Errorf("Expected the default timeout without one configured, got %s", got)
+	}
+	session.Server.Timeout = 5
+	if got := session.timeout(); got != 5*time.Second {
+		t.Errorf("Expected the configured timeout, got %s", got)
+	}
+}
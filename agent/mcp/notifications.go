@@ -0,0 +1,115 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+)
+
+// Progress is what a server reported about a request in progress
+type Progress struct {
+	Progress float64
+	Total    float64 // 0 when the server doesn't know
+	Message  string
+}
+
+// SetOnToolsChanged sets a function called when the server says its tool list changed
+func (ms *MCPSession) SetOnToolsChanged(onToolsChanged func()) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.onToolsChanged = onToolsChanged
+}
+
+// handleNotification handles a notification from the server. It runs on the goroutine
+// reading the connection, so anything that sends requests of its own runs separately.
+func (ms *MCPSession) handleNotification(method string, params json.RawMessage) {
+	switch method {
+	case "notifications/tools/list_changed":
+		ms.mu.Lock()
+		onToolsChanged := ms.onToolsChanged
+		ms.mu.Unlock()
+		if onToolsChanged != nil {
+			go onToolsChanged()
+		}
+
+	case "notifications/progress":
+		var progress struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+			Progress      float64         `json:"progress"`
+			Total         float64         `json:"total"`
+			Message       string          `json:"message"`
+		}
+		if err := json.Unmarshal(params, &progress); err != nil {
+			return
+		}
+		var token int
+		if err := json.Unmarshal(progress.ProgressToken, &token); err != nil {
+			return // Not a token the client handed out
+		}
+		ms.mu.Lock()
+		onProgress := ms.progressHandlers[token]
+		ms.mu.Unlock()
+		if onProgress != nil {
+			onProgress(Progress{Progress: progress.Progress, Total: progress.Total, Message: progress.Message})
+		}
+
+	case "notifications/message":
+		var logMessage struct {
+			Level  string          `json:"level"`
+			Logger string          `json:"logger"`
+			Data   json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(params, &logMessage); err != nil {
+			return
+		}
+		source := ms.Server.Name
+		if logMessage.Logger != "" {
+			source += "/" + logMessage.Logger
+		}
+		slog.Log(context.Background(), logLevel(logMessage.Level), logData(logMessage.Data), "server", source)
+	}
+}
+
+// logLevel maps the syslog-style level of a server's log message to slog's
+func logLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "notice", "info":
+		return slog.LevelInfo
+	case "warning":
+		return slog.LevelWarn
+	case "error", "critical", "alert", "emergency":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// logData returns the data of a log message as text; strings are shown without quotes
+func logData(data json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return text
+	}
+	return string(data)
+}
+
+// withMeta returns params with _meta fields added, leaving the original map alone
+func withMeta(params map[string]interface{}, meta map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(params)+1)
+	for key, value := range params {
+		merged[key] = value
+	}
+	if existing, ok := params["_meta"].(map[string]interface{}); ok {
+		combined := make(map[string]interface{}, len(existing)+len(meta))
+		for key, value := range existing {
+			combined[key] = value
+		}
+		for key, value := range meta {
+			combined[key] = value
+		}
+		meta = combined
+	}
+	merged["_meta"] = meta
+	return merged
+}
@@ -0,0 +1,83 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProgressAndListChangedNotifications(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Meta struct {
+					ProgressToken json.RawMessage `json:"progressToken"`
+				} `json:"_meta"`
+			} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		switch msg.Method {
+		case "initialize":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{"protocolVersion":"2025-06-18"}}`, msg.ID)
+		case "tools/call":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\",\"params\":{\"progressToken\":%s,\"progress\":1,\"total\":4,\"message\":\"Indexing\"}}\n\n", msg.Params.Meta.ProgressToken)
+			fmt.Fprint(w, "data: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\",\"params\":{\"progressToken\":999,\"progress\":1}}\n\n")
+			fmt.Fprint(w, "data: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/tools/list_changed\"}\n\n")
+			fmt.Fprintf(w, "data: {\"jsonrpc\":\"2.0\",\"id\":%s,\"result\":{\"content\":[]}}\n\n", msg.ID)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+
+	session := &MCPSession{Server: &MCPServer{Name: "indexer", URL: server.URL, Timeout: 5}}
+	toolsChanged := make(chan struct{}, 1)
+	session.SetOnToolsChanged(func() { toolsChanged <- struct{}{} })
+	if err := session.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer session.Close()
+	if err := session.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	var updates []Progress
+	if _, err := session.CallToolWithProgress(context.Background(), "index", nil, func(p Progress) { updates = append(updates, p) }); err != nil {
+		t.Fatalf("CallToolWithProgress failed: %v", err)
+	}
+	if len(updates) != 1 || updates[0].Message != "Indexing" || updates[0].Total != 4 {
+		t.Errorf("Expected only the progress of the call, got %+v", updates)
+	}
+
+	select {
+	case <-toolsChanged:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the tool list change to be reported")
+	}
+}
+
+func TestWithMeta(t *testing.T) {
+	params := map[string]interface{}{"name": "index", "_meta": map[string]interface{}{"trace": "1"}}
+	merged := withMeta(params, map[string]interface{}{"progressToken": 7})
+
+	meta := merged["_meta"].(map[string]interface{})
+	if meta["trace"] != "1" || meta["progressToken"] != 7 || merged["name"] != "index" {
+		t.Errorf("Unexpected params %v", merged)
+	}
+	if _, ok := params["_meta"].(map[string]interface{})["progressToken"]; ok {
+		t.Error("Expected the original params to be left alone")
+	}
+}
@@ -0,0 +1,597 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeouts of the authorization flow
+const (
+	oauthRequestTimeout = 30 * time.Second
+	tokenExpiryMargin   = 30 * time.Second
+)
+
+// ErrAuthorizationRequired is returned when a server wants a token the client can't get on
+// its own; logging in with `nanotalon mcp login` gets one
+var ErrAuthorizationRequired = errors.New("authorization required")
+
+// OAuthConfig configures OAuth 2.1 for a remote MCP server. Without a client ID the client
+// registers itself with the authorization server when logging in; with a client ID and
+// secret it can also get tokens with the client credentials grant, without logging in.
+type OAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	CallbackPort int    // Port of the local login callback; 0 picks a free one
+	TokenPath    string // File tokens are kept in; DefaultTokenPath() if empty
+}
+
+// DefaultTokenPath returns where MCP OAuth tokens are kept by default
+func DefaultTokenPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".nanotalon", "data", "mcp", "tokens.json")
+}
+
+// storedToken is a server's token as kept in the token file
+type storedToken struct {
+	AccessToken   string    `json:"access_token"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	Expiry        time.Time `json:"expiry,omitempty"`
+	TokenEndpoint string    `json:"token_endpoint,omitempty"`
+	ClientID      string    `json:"client_id,omitempty"` // Set when the client registered itself
+	ClientSecret  string    `json:"client_secret,omitempty"`
+}
+
+// expired reports whether the token has expired or is about to
+func (t storedToken) expired() bool {
+	return !t.Expiry.IsZero() && time.Now().Add(tokenExpiryMargin).After(t.Expiry)
+}
+
+// authServerMetadata is the part of an authorization server's metadata (RFC 8414) the client uses
+type authServerMetadata struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	RegistrationEndpoint  string `json:"registration_endpoint"`
+}
+
+// oauthClient gets and refreshes the access token of one MCP server
+type oauthClient struct {
+	serverURL  string
+	config     OAuthConfig
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	token  storedToken
+	loaded bool
+}
+
+// newOAuthClient creates the OAuth client of a server
+func newOAuthClient(serverURL string, config OAuthConfig) *oauthClient {
+	if config.TokenPath == "" {
+		config.TokenPath = DefaultTokenPath()
+	}
+	return &oauthClient{
+		serverURL:  serverURL,
+		config:     config,
+		httpClient: &http.Client{Timeout: oauthRequestTimeout},
+	}
+}
+
+// accessToken returns the access token to send, refreshing it once it expired. It is
+// empty when the client has no token yet.
+func (c *oauthClient) accessToken(ctx context.Context) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	if c.token.expired() && c.token.RefreshToken != "" {
+		if err := c.refresh(ctx); err != nil {
+			return ""
+		}
+	}
+	return c.token.AccessToken
+}
+
+// cachedToken returns the access token as it is, without refreshing it
+func (c *oauthClient) cachedToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token.AccessToken
+}
+
+// authorize gets a new token after the server turned the request down with challenge, the
+// WWW-Authenticate header of its answer: with the refresh token if there is one, else with
+// the client credentials grant if a client secret is configured.
+func (c *oauthClient) authorize(ctx context.Context, challenge string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	if c.token.RefreshToken != "" {
+		if err := c.refresh(ctx); err == nil {
+			return nil
+		}
+	}
+	if c.config.ClientID == "" || c.config.ClientSecret == "" {
+		return ErrAuthorizationRequired
+	}
+
+	metadata, scopes, err := discover(ctx, c.httpClient, c.serverURL, challenge)
+	if err != nil {
+		return err
+	}
+	form := url.Values{"grant_type": {"client_credentials"}, "resource": {c.serverURL}}
+	if scope := strings.Join(firstNonEmpty(c.config.Scopes, scopes), " "); scope != "" {
+		form.Set("scope", scope)
+	}
+	token, err := requestToken(ctx, c.httpClient, metadata.TokenEndpoint, form, c.config.ClientID, c.config.ClientSecret)
+	if err != nil {
+		return err
+	}
+	token.TokenEndpoint = metadata.TokenEndpoint
+	c.token = token
+	return saveToken(c.config.TokenPath, c.serverURL, token)
+}
+
+// load reads the stored token the first time it is needed. c.mu is held.
+func (c *oauthClient) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+	if token, ok := loadToken(c.config.TokenPath, c.serverURL); ok {
+		c.token = token
+	}
+}
+
+// refresh exchanges the refresh token for a new access token. c.mu is held.
+func (c *oauthClient) refresh(ctx context.Context) error {
+	clientID, clientSecret := c.config.ClientID, c.config.ClientSecret
+	if c.token.ClientID != "" {
+		clientID, clientSecret = c.token.ClientID, c.token.ClientSecret
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {c.token.RefreshToken},
+		"resource":      {c.serverURL},
+	}
+	token, err := requestToken(ctx, c.httpClient, c.token.TokenEndpoint, form, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	// Servers that don't rotate refresh tokens leave them out of the answer
+	if token.RefreshToken == "" {
+		token.RefreshToken = c.token.RefreshToken
+	}
+	token.TokenEndpoint = c.token.TokenEndpoint
+	token.ClientID, token.ClientSecret = c.token.ClientID, c.token.ClientSecret
+	c.token = token
+	return saveToken(c.config.TokenPath, c.serverURL, token)
+}
+
+// Login authorizes nanotalon with a remote MCP server through the user's browser. It finds
+// the server's authorization server, registers the client there unless a client ID is
+// configured, passes the authorization URL to openURL and waits for the code to come back
+// to a local callback. The tokens are saved for the server's sessions to use.
+func Login(ctx context.Context, server MCPServer, openURL func(authURL string)) error {
+	client := &http.Client{Timeout: oauthRequestTimeout}
+	config := server.OAuth
+	if config.TokenPath == "" {
+		config.TokenPath = DefaultTokenPath()
+	}
+
+	challenge := probeChallenge(ctx, client, server)
+	metadata, scopes, err := discover(ctx, client, server.URL, challenge)
+	if err != nil {
+		return err
+	}
+	if metadata.AuthorizationEndpoint == "" {
+		return fmt.Errorf("the authorization server has no authorization endpoint")
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", config.CallbackPort))
+	if err != nil {
+		return fmt.Errorf("failed to listen for the login callback: %w", err)
+	}
+	defer listener.Close()
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port)
+
+	token := storedToken{TokenEndpoint: metadata.TokenEndpoint}
+	clientID, clientSecret := config.ClientID, config.ClientSecret
+	if clientID == "" {
+		if metadata.RegistrationEndpoint == "" {
+			return fmt.Errorf("the authorization server doesn't register clients; configure oauth.client_id")
+		}
+		clientID, clientSecret, err = registerClient(ctx, client, metadata.RegistrationEndpoint, redirectURI)
+		if err != nil {
+			return err
+		}
+		token.ClientID, token.ClientSecret = clientID, clientSecret
+	}
+
+	verifier, state := randomString(), randomString()
+	challengeSum := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {redirectURI},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challengeSum[:])},
+		"code_challenge_method": {"S256"},
+		"resource":              {server.URL},
+	}
+	if scope := strings.Join(firstNonEmpty(config.Scopes, scopes), " "); scope != "" {
+		query.Set("scope", scope)
+	}
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	authURL.RawQuery = mergeQuery(authURL.Query(), query).Encode()
+
+	code, err := waitForCode(ctx, listener, state, func() { openURL(authURL.String()) })
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+		"resource":      {server.URL},
+	}
+	issued, err := requestToken(ctx, client, metadata.TokenEndpoint, form, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+	issued.TokenEndpoint, issued.ClientID, issued.ClientSecret = token.TokenEndpoint, token.ClientID, token.ClientSecret
+	return saveToken(config.TokenPath, server.URL, issued)
+}
+
+// Logout forgets the tokens saved for a server
+func Logout(server MCPServer) error {
+	path := server.OAuth.TokenPath
+	if path == "" {
+		path = DefaultTokenPath()
+	}
+	return updateTokens(path, func(tokens map[string]storedToken) { delete(tokens, server.URL) })
+}
+
+// waitForCode serves the login callback until the authorization server redirects the
+// browser to it, calling ready once it listens
+func waitForCode(ctx context.Context, listener net.Listener, state string, ready func()) (string, error) {
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var res result
+		switch {
+		case query.Get("state") != state:
+			res.err = fmt.Errorf("login callback with an unexpected state")
+		case query.Get("error") != "":
+			res.err = fmt.Errorf("authorization denied: %s %s", query.Get("error"), query.Get("error_description"))
+		case query.Get("code") == "":
+			res.err = fmt.Errorf("login callback without a code")
+		default:
+			res.code = query.Get("code")
+		}
+
+		if res.err != nil {
+			http.Error(w, res.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "nanotalon is authorized. You can close this window.")
+		}
+		select {
+		case results <- res:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	ready()
+	select {
+	case res := <-results:
+		return res.code, res.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("waiting for the login callback: %w", ctx.Err())
+	}
+}
+
+// probeChallenge asks the server for the challenge it answers unauthorized requests with
+func probeChallenge(ctx context.Context, client *http.Client, server MCPServer) string {
+	body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"` + protocolVersion + `","capabilities":{},"clientInfo":{"name":"nanotalon","version":"0.1.0"}}}`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	resp.Body.Close()
+	return resp.Header.Get("WWW-Authenticate")
+}
+
+// discover finds the authorization server of an MCP server and the scopes it supports: the
+// protected resource metadata (RFC 9728) is read from the URL named in the server's
+// challenge or from its well-known location, and then the authorization server's metadata
+// (RFC 8414 or OpenID Connect discovery). Servers without resource metadata are their own
+// authorization server, with the default endpoints if they publish no metadata either.
+func discover(ctx context.Context, client *http.Client, serverURL, challenge string) (*authServerMetadata, []string, error) {
+	resource, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	origin := resource.Scheme + "://" + resource.Host
+	path := strings.TrimSuffix(resource.Path, "/")
+
+	var resourceMetadata struct {
+		AuthorizationServers []string `json:"authorization_servers"`
+		ScopesSupported      []string `json:"scopes_supported"`
+	}
+	candidates := []string{origin + "/.well-known/oauth-protected-resource" + path, origin + "/.well-known/oauth-protected-resource"}
+	if metadataURL := challengeParams(challenge)["resource_metadata"]; metadataURL != "" {
+		candidates = append([]string{metadataURL}, candidates...)
+	}
+	for _, candidate := range candidates {
+		if getJSON(ctx, client, candidate, &resourceMetadata) == nil && len(resourceMetadata.AuthorizationServers) > 0 {
+			break
+		}
+	}
+
+	issuer := origin
+	if len(resourceMetadata.AuthorizationServers) > 0 {
+		issuer = strings.TrimSuffix(resourceMetadata.AuthorizationServers[0], "/")
+	}
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid authorization server %q: %w", issuer, err)
+	}
+	issuerOrigin := issuerURL.Scheme + "://" + issuerURL.Host
+	issuerPath := strings.TrimSuffix(issuerURL.Path, "/")
+
+	var metadata authServerMetadata
+	for _, candidate := range []string{
+		issuerOrigin + "/.well-known/oauth-authorization-server" + issuerPath,
+		issuerOrigin + "/.well-known/openid-configuration" + issuerPath,
+		issuer + "/.well-known/openid-configuration",
+	} {
+		if getJSON(ctx, client, candidate, &metadata) == nil && metadata.TokenEndpoint != "" {
+			return &metadata, resourceMetadata.ScopesSupported, nil
+		}
+	}
+
+	if len(resourceMetadata.AuthorizationServers) > 0 {
+		return nil, nil, fmt.Errorf("failed to discover the metadata of authorization server %s", issuer)
+	}
+	return &authServerMetadata{
+		AuthorizationEndpoint: issuerOrigin + "/authorize",
+		TokenEndpoint:         issuerOrigin + "/token",
+		RegistrationEndpoint:  issuerOrigin + "/register",
+	}, nil, nil
+}
+
+// challengeAttr matches the attributes of a WWW-Authenticate challenge
+var challengeAttr = regexp.MustCompile(`([a-zA-Z_]+)="([^"]*)"`)
+
+// challengeParams returns the attributes of a WWW-Authenticate challenge
+func challengeParams(challenge string) map[string]string {
+	params := make(map[string]string)
+	for _, match := range challengeAttr.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	return params
+}
+
+// registerClient registers nanotalon with an authorization server (RFC 7591)
+func registerClient(ctx context.Context, client *http.Client, endpoint, redirectURI string) (string, string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"client_name":                "nanotalon",
+		"redirect_uris":              []string{redirectURI},
+		"grant_types":                []string{"authorization_code", "refresh_token"},
+		"response_types":             []string{"code"},
+		"token_endpoint_auth_method": "none",
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var registration struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := doJSON(client, req, &registration); err != nil {
+		return "", "", fmt.Errorf("failed to register the client: %w", err)
+	}
+	if registration.ClientID == "" {
+		return "", "", fmt.Errorf("failed to register the client: no client ID in the answer")
+	}
+	return registration.ClientID, registration.ClientSecret, nil
+}
+
+// requestToken posts a token request, authenticating with the client secret if there is one
+func requestToken(ctx context.Context, client *http.Client, endpoint string, form url.Values, clientID, clientSecret string) (storedToken, error) {
+	if endpoint == "" {
+		return storedToken{}, fmt.Errorf("no token endpoint")
+	}
+	if clientSecret == "" && clientID != "" {
+		form.Set("client_id", clientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return storedToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	var answer struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := doJSON(client, req, &answer); err != nil {
+		return storedToken{}, fmt.Errorf("token request failed: %w", err)
+	}
+	if answer.AccessToken == "" {
+		return storedToken{}, fmt.Errorf("token request failed: no access token in the answer")
+	}
+
+	token := storedToken{AccessToken: answer.AccessToken, RefreshToken: answer.RefreshToken}
+	if answer.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(answer.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// getJSON fetches a JSON document
+func getJSON(ctx context.Context, client *http.Client, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return doJSON(client, req, out)
+}
+
+// doJSON sends a request and decodes its JSON answer, turning OAuth error answers into errors
+func doJSON(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+			return fmt.Errorf("%s: %s", oauthErr.Error, oauthErr.Description)
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// loadToken reads the token saved for a server
+func loadToken(path, serverURL string) (storedToken, bool) {
+	tokens, err := readTokens(path)
+	if err != nil {
+		return storedToken{}, false
+	}
+	token, ok := tokens[serverURL]
+	return token, ok
+}
+
+// saveToken saves the token of a server, keeping those of the others
+func saveToken(path, serverURL string, token storedToken) error {
+	return updateTokens(path, func(tokens map[string]storedToken) { tokens[serverURL] = token })
+}
+
+// tokenFileMu serializes updates of token files
+var tokenFileMu sync.Mutex
+
+// updateTokens applies a change to the tokens in a file, which only its owner can read
+func updateTokens(path string, update func(map[string]storedToken)) error {
+	tokenFileMu.Lock()
+	defer tokenFileMu.Unlock()
+
+	tokens, err := readTokens(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if tokens == nil {
+		tokens = make(map[string]storedToken)
+	}
+	update(tokens)
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save MCP tokens: %w", err)
+	}
+	return nil
+}
+
+// readTokens reads a token file, by server URL
+func readTokens(path string) (map[string]storedToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tokens map[string]storedToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid token file %s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+// randomString returns a random URL-safe string, for PKCE verifiers and states
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// mergeQuery adds values to a query, replacing those of the same name
+func mergeQuery(query, values url.Values) url.Values {
+	for key, value := range values {
+		query[key] = value
+	}
+	return query
+}
+
+// firstNonEmpty returns a if it has any elements, else b
+func firstNonEmpty(a, b []string) []string {
+	if len(a) > 0 {
+		return a
+	}
+	return b
+}
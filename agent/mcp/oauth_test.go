@@ -0,0 +1,227 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// authServer is an MCP server that is also its own OAuth authorization server
+type authServer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu            sync.Mutex
+	validToken    string
+	refreshToken  string
+	codeChallenge string
+	grants        []string
+}
+
+func newAuthServer(t *testing.T) *authServer {
+	s := &authServer{t: t, validToken: "access-2", refreshToken: "refresh-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp", s.handleMCP)
+	mux.HandleFunc("/.well-known/oauth-protected-resource/mcp", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"resource":"%s/mcp","authorization_servers":["%s/auth"],"scopes_supported":["tools"]}`, s.URL, s.URL)
+	})
+	mux.HandleFunc("/.well-known/oauth-authorization-server/auth", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"issuer":"%[1]s/auth","authorization_endpoint":"%[1]s/auth/authorize","token_endpoint":"%[1]s/auth/token","registration_endpoint":"%[1]s/auth/register"}`, s.URL)
+	})
+	mux.HandleFunc("/auth/register", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"client_id":"registered-client"}`)
+	})
+	mux.HandleFunc("/auth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "registered-client" || query.Get("resource") != s.URL+"/mcp" {
+			t.Errorf("Unexpected authorization request %v", query)
+		}
+		s.mu.Lock()
+		s.codeChallenge = query.Get("code_challenge")
+		s.mu.Unlock()
+		http.Redirect(w, r, query.Get("redirect_uri")+"?code=code-1&state="+url.QueryEscape(query.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/auth/token", s.handleToken)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *authServer) handleMCP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	valid := r.Header.Get("Authorization") == "Bearer "+s.validToken
+	s.mu.Unlock()
+	if !valid {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer resource_metadata="%s/.well-known/oauth-protected-resource/mcp"`, s.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	msg := readRPC(s.t, r)
+	if msg.Method != "initialize" {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{"protocolVersion":"2025-06-18"}}`, msg.ID)
+}
+
+func (s *authServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grants = append(s.grants, r.Form.Get("grant_type"))
+
+	switch r.Form.Get("grant_type") {
+	case "refresh_token":
+		if r.Form.Get("refresh_token") != s.refreshToken {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+			return
+		}
+	case "client_credentials":
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+	case "authorization_code":
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "code-1" || base64.RawURLEncoding.EncodeToString(sum[:]) != s.codeChallenge {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"PKCE verification failed"}`)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"access_token":"%s","token_type":"Bearer","expires_in":3600}`, s.validToken)
+}
+
+func TestOAuthRefreshesRejectedToken(t *testing.T) {
+	server := newAuthServer(t)
+	defer server.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "tokens.json")
+	saveToken(tokenPath, server.URL+"/mcp", storedToken{
+		AccessToken:   "access-1",
+		RefreshToken:  "refresh-1",
+		TokenEndpoint: server.URL + "/auth/token",
+	})
+
+	session := &MCPSession{Server: &MCPServer{Name: "hosted", URL: server.URL + "/mcp", Timeout: 5, OAuth: OAuthConfig{TokenPath: tokenPath}}}
+	if err := session.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer session.Close()
+	if err := session.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	token, _ := loadToken(tokenPath, server.URL+"/mcp")
+	if token.AccessToken != "access-2" || token.RefreshToken != "refresh-1" || token.Expiry.IsZero() {
+		t.Errorf("Expected the refreshed token to be saved, got %+v", token)
+	}
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	server := newAuthServer(t)
+	defer server.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "tokens.json")
+	oauth := OAuthConfig{ClientID: "client", ClientSecret: "secret", TokenPath: tokenPath}
+	session := &MCPSession{Server: &MCPServer{Name: "hosted", URL: server.URL + "/mcp", Timeout: 5, OAuth: oauth}}
+	if err := session.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer session.Close()
+	if err := session.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.grants) != 1 || server.grants[0] != "client_credentials" {
+		t.Errorf("Expected one client credentials grant, got %v", server.grants)
+	}
+}
+
+func TestOAuthRequiresLogin(t *testing.T) {
+	server := newAuthServer(t)
+	defer server.Close()
+
+	oauth := OAuthConfig{TokenPath: filepath.Join(t.TempDir(), "tokens.json")}
+	session := &MCPSession{Server: &MCPServer{Name: "hosted", URL: server.URL + "/mcp", Timeout: 5, OAuth: oauth}}
+	if err := session.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer session.Close()
+
+	err := session.Initialize(context.Background())
+	if !errors.Is(err, ErrAuthorizationRequired) || !strings.Contains(err.Error(), "nanotalon mcp login hosted") {
+		t.Fatalf("Expected to be told to log in, got %v", err)
+	}
+	if isConnectionError(err) {
+		t.Error("Expected a missing authorization not to count as a lost connection")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	server := newAuthServer(t)
+	defer server.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "tokens.json")
+	mcpServer := MCPServer{Name: "hosted", URL: server.URL + "/mcp", OAuth: OAuthConfig{TokenPath: tokenPath}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := Login(ctx, mcpServer, func(authURL string) {
+		// Stand in for the browser, which follows the redirect to the callback
+		go func() {
+			resp, err := http.Get(authURL)
+			if err != nil {
+				t.Errorf("Authorization failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	token, ok := loadToken(tokenPath, mcpServer.URL)
+	if !ok || token.AccessToken != "access-2" || token.ClientID != "registered-client" || token.TokenEndpoint != server.URL+"/auth/token" {
+		t.Errorf("Expected the token and the registered client to be saved, got %+v", token)
+	}
+
+	if err := Logout(mcpServer); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	if _, ok := loadToken(tokenPath, mcpServer.URL); ok {
+		t.Error("Expected the token to be forgotten")
+	}
+}
+
+func TestChallengeParams(t *testing.T) {
+	params := challengeParams(`Bearer error="invalid_token", resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource", scope="tools"`)
+	if params["resource_metadata"] != "https://mcp.example.com/.well-known/oauth-protected-resource" || params["error"] != "invalid_token" || params["scope"] != "tools" {
+		t.Errorf("Unexpected params %v", params)
+	}
+}
@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Backoff between attempts to reconnect to an MCP server
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// SetOnReconnect sets a function called each time the session has reconnected and run the
+// initialize handshake again, such as to register the server's tools again
+func (ms *MCPSession) SetOnReconnect(onReconnect func()) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.onReconnect = onReconnect
+}
+
+// Connected reports whether the session is connected to its server
+func (ms *MCPSession) Connected() bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.connected
+}
+
+// connectionLost fails the requests waiting on a connection that broke and reconnects in
+// the background, unless the session was closed or the connection was already replaced
+func (ms *MCPSession) connectionLost(generation int, cause error) {
+	ms.mu.Lock()
+	if ms.closed || !ms.connected || generation != ms.generation {
+		ms.mu.Unlock()
+		return
+	}
+	ms.connected = false
+	for id, ch := range ms.activeRequests {
+		close(ch)
+		delete(ms.activeRequests, id)
+	}
+	ms.closeTransport()
+	start := ms.startReconnecting()
+	ms.mu.Unlock()
+
+	slog.Warn("Lost connection to MCP server", "server", ms.Server.Name, "error", cause)
+	if start {
+		go ms.reconnect()
+	}
+}
+
+// retryLater closes a connection that failed to come up and keeps trying in the background
+func (ms *MCPSession) retryLater() {
+	ms.mu.Lock()
+	ms.connected = false
+	ms.closeTransport()
+	start := ms.startReconnecting()
+	ms.mu.Unlock()
+
+	if start {
+		go ms.reconnect()
+	}
+}
+
+// startReconnecting reports whether a reconnection loop should start, as none is running.
+// ms.mu is held.
+func (ms *MCPSession) startReconnecting() bool {
+	if ms.closed || ms.reconnecting {
+		return false
+	}
+	ms.reconnecting = true
+	return true
+}
+
+// reconnect connects and initializes the session again, backing off exponentially between
+// attempts, until it succeeds or the session is closed. A stdio server is started again.
+func (ms *MCPSession) reconnect() {
+	delay := minReconnectDelay
+	for attempt := 1; ; attempt++ {
+		time.Sleep(delay)
+
+		err := ms.Connect(context.Background())
+		if err == nil {
+			err = ms.Initialize(context.Background())
+		}
+
+		ms.mu.Lock()
+		if ms.closed {
+			ms.reconnecting = false
+			ms.mu.Unlock()
+			return
+		}
+		if err == nil && ms.connected {
+			ms.reconnecting = false
+			onReconnect := ms.onReconnect
+			ms.mu.Unlock()
+
+			slog.Info("Reconnected to MCP server", "server", ms.Server.Name)
+			if onReconnect != nil {
+				onReconnect()
+			}
+			return
+		}
+		if err == nil {
+			err = errors.New("connection dropped while initializing")
+		}
+		ms.connected = false
+		ms.closeTransport()
+		ms.mu.Unlock()
+
+		delay = min(delay*2, maxReconnectDelay)
+		slog.Warn("Failed to reconnect to MCP server", "server", ms.Server.Name, "attempt", attempt, "retry_in", delay, "error", err)
+	}
+}
+
+// isConnectionError reports whether a failed write means the connection is gone, rather than
+// the server refusing the message
+func isConnectionError(err error) bool {
+	var statusErr *httpStatusError
+	return errors.Is(err, errSessionExpired) || !errors.As(err, &statusErr)
+}
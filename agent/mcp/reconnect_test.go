@@ -0,0 +1,87 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReconnectAfterSessionExpired(t *testing.T) {
+	var mu sync.Mutex
+	sessions := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		msg := readRPC(t, r)
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case msg.Method == "initialize":
+			sessions++
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Mcp-Session-Id", fmt.Sprintf("session-%d", sessions))
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{"protocolVersion":"2025-06-18"}}`, msg.ID)
+		case msg.Method == "tools/list" && r.Header.Get("Mcp-Session-Id") == "session-1":
+			// The server restarted and forgot the first session
+			w.WriteHeader(http.StatusNotFound)
+		case msg.Method == "tools/list":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{"tools":[{"name":"echo"}]}}`, msg.ID)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+
+	session := &MCPSession{Server: &MCPServer{Name: "flaky", URL: server.URL, Timeout: 5}}
+	reconnected := make(chan struct{}, 1)
+	session.SetOnReconnect(func() { reconnected <- struct{}{} })
+	if err := session.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer session.Close()
+	if err := session.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	if _, err := session.ListTools(context.Background()); err == nil {
+		t.Fatal("Expected the expired session to fail the request")
+	}
+	if session.Connected() {
+		t.Error("Expected the session to be disconnected after it expired")
+	}
+	if _, err := session.ListTools(context.Background()); err == nil {
+		t.Error("Expected requests to fail fast while reconnecting")
+	}
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the session to reconnect")
+	}
+	tools, err := session.ListTools(context.Background())
+	if err != nil || len(tools) != 1 {
+		t.Errorf("Expected the tools after reconnecting, got %v, %v", tools, err)
+	}
+}
+
+func TestCloseStopsReconnecting(t *testing.T) {
+	session := &MCPSession{Server: &MCPServer{Name: "gone", URL: "http://127.0.0.1:1", Timeout: 1}}
+	session.retryLater()
+	session.Close()
+
+	time.Sleep(minReconnectDelay + 200*time.Millisecond)
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.reconnecting || session.connected {
+		t.Error("Expected a closed session to stop reconnecting")
+	}
+}
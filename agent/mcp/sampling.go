@@ -0,0 +1,56 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// samplingTimeout bounds how long the client spends answering a sampling request
+const samplingTimeout = 2 * time.Minute
+
+// SamplingHandler answers a server's request for a completion from the client's model.
+// An error declines the request.
+type SamplingHandler func(ctx context.Context, req *SamplingRequest) (*SamplingResult, error)
+
+// SamplingRequest is a server's sampling/createMessage request
+type SamplingRequest struct {
+	Messages      []SamplingMessage `json:"messages"`
+	SystemPrompt  string            `json:"systemPrompt,omitempty"`
+	MaxTokens     int               `json:"maxTokens"`
+	Temperature   *float64          `json:"temperature,omitempty"`
+	StopSequences []string          `json:"stopSequences,omitempty"`
+}
+
+// SamplingMessage is a message of the conversation a server wants completed
+type SamplingMessage struct {
+	Role    string       `json:"role"` // user or assistant
+	Content ContentBlock `json:"content"`
+}
+
+// SamplingResult is the completion the client returns to the server
+type SamplingResult struct {
+	Role       string       `json:"role"`
+	Content    ContentBlock `json:"content"`
+	Model      string       `json:"model"`
+	StopReason string       `json:"stopReason,omitempty"`
+}
+
+// answerSampling runs a sampling/createMessage request through the server's sampling
+// handler, returning the result or the JSON-RPC error to answer with
+func (ms *MCPSession) answerSampling(params json.RawMessage) (*SamplingResult, map[string]interface{}) {
+	var req SamplingRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, map[string]interface{}{"code": -32602, "message": "Invalid sampling request: " + err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), samplingTimeout)
+	defer cancel()
+	result, err := ms.Server.Sampling(ctx, &req)
+	if err != nil {
+		slog.Warn("Declined sampling request from MCP server", "server", ms.Server.Name, "error", err)
+		return nil, map[string]interface{}{"code": -1, "message": err.Error()}
+	}
+	return result, nil
+}
@@ -0,0 +1,94 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSamplingRequest(t *testing.T) {
+	answers := make(chan json.RawMessage, 2)
+	var offered bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Capabilities map[string]interface{} `json:"capabilities"`
+			} `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		switch {
+		case msg.Method == "initialize":
+			_, offered = msg.Params.Capabilities["sampling"]
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{"protocolVersion":"2025-06-18"}}`, msg.ID)
+		case msg.Method == "tools/call":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"jsonrpc\":\"2.0\",\"id\":\"s1\",\"method\":\"sampling/createMessage\",\"params\":{\"messages\":[{\"role\":\"user\",\"content\":{\"type\":\"text\",\"text\":\"Name a color\"}}],\"maxTokens\":10}}\n\n")
+			fmt.Fprint(w, "data: {\"jsonrpc\":\"2.0\",\"id\":\"s2\",\"method\":\"sampling/createMessage\",\"params\":{\"messages\":[{\"role\":\"user\",\"content\":{\"type\":\"text\",\"text\":\"Refuse me\"}}],\"maxTokens\":10}}\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprintf(w, "data: {\"jsonrpc\":\"2.0\",\"id\":%s,\"result\":{\"content\":[]}}\n\n", msg.ID)
+		case msg.Method == "" && string(msg.ID) == `"s1"`:
+			answers <- msg.Result
+			w.WriteHeader(http.StatusAccepted)
+		case msg.Method == "" && string(msg.ID) == `"s2"`:
+			answers <- msg.Error
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+
+	sampling := func(ctx context.Context, req *SamplingRequest) (*SamplingResult, error) {
+		if req.Messages[0].Content.Text == "Refuse me" {
+			return nil, errors.New("sampling declined")
+		}
+		return &SamplingResult{Role: "assistant", Content: ContentBlock{Type: "text", Text: "Blue"}, Model: "test"}, nil
+	}
+	session := &MCPSession{Server: &MCPServer{Name: "sampler", URL: server.URL, Timeout: 5, Sampling: sampling}}
+	if err := session.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer session.Close()
+	if err := session.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if !offered {
+		t.Error("Expected sampling to be offered in the client's capabilities")
+	}
+	if _, err := session.CallTool(context.Background(), "ask", nil); err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case answer := <-answers:
+			var body struct {
+				Content ContentBlock `json:"content"`
+				Code    int          `json:"code"`
+				Message string       `json:"message"`
+			}
+			json.Unmarshal(answer, &body)
+			if body.Content.Text != "Blue" && (body.Code != -1 || body.Message != "sampling declined") {
+				t.Errorf("Unexpected answer %s", answer)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected both sampling requests to be answered")
+		}
+	}
+}
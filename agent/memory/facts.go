@@ -0,0 +1,233 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Suggested fact categories; any other lowercase name is accepted too
+const (
+	CategoryGeneral    = "general"
+	CategoryBirthday   = "birthday"
+	CategoryPreference = "preference"
+	CategoryAddress    = "address"
+	CategoryContact    = "contact"
+	CategoryPeople     = "people"
+	CategoryWork       = "work"
+	CategoryHealth     = "health"
+)
+
+// Fact is one structured piece of knowledge, such as ("Alice", "birthday", "March 3")
+type Fact struct {
+	ID         string    `json:"id"`
+	Category   string    `json:"category"`
+	Subject    string    `json:"subject"`
+	Predicate  string    `json:"predicate"`
+	Value      string    `json:"value"`
+	Confidence float64   `json:"confidence"`       // 0 to 1; how sure the agent is the fact is right
+	Source     string    `json:"source,omitempty"` // The message the fact was learned from
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FactQuery selects facts. Subject, predicate and category match exactly, ignoring case;
+// Text matches any part of any field. Empty fields match everything.
+type FactQuery struct {
+	Subject       string
+	Predicate     string
+	Category      string
+	Text          string
+	MinConfidence float64
+}
+
+// FactStore keeps structured facts in facts.json of a memory directory
+type FactStore struct {
+	path  string
+	facts map[string]*Fact
+	mutex sync.Mutex
+}
+
+// NewFactStore loads the global fact store of a workspace
+func NewFactStore(workspace string) (*FactStore, error) {
+	return NewFactStoreAt(filepath.Join(workspace, "memory"))
+}
+
+// NewFactStoreAt loads the fact store kept in a memory directory; the directory is created
+// when the first fact is saved
+func NewFactStoreAt(dir string) (*FactStore, error) {
+	path := filepath.Join(dir, "facts.json")
+	store := &FactStore{
+		path:  path,
+		facts: make(map[string]*Fact),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read facts: %w", err)
+	}
+
+	var facts []*Fact
+	if err := json.Unmarshal(data, &facts); err != nil {
+		return nil, fmt.Errorf("failed to decode facts: %w", err)
+	}
+	for _, fact := range facts {
+		store.facts[fact.ID] = fact
+	}
+
+	return store, nil
+}
+
+// Assert records a fact and returns it with the facts it replaced. Asserting a known fact
+// again refreshes its confidence, source and category. With replace, other values for the
+// same subject and predicate are retracted, as a new address replaces the old one; without
+// it they are kept, for predicates like "likes" that have many values.
+func (fs *FactStore) Assert(fact Fact, replace bool) (Fact, []Fact, error) {
+	fact.Subject = strings.TrimSpace(fact.Subject)
+	fact.Predicate = strings.TrimSpace(fact.Predicate)
+	fact.Value = strings.TrimSpace(fact.Value)
+	if fact.Subject == "" || fact.Predicate == "" || fact.Value == "" {
+		return Fact{}, nil, fmt.Errorf("a fact needs a subject, predicate and value")
+	}
+	if fact.Confidence < 0 || fact.Confidence > 1 {
+		return Fact{}, nil, fmt.Errorf("confidence must be between 0 and 1, got %g", fact.Confidence)
+	}
+	fact.Category = strings.ToLower(strings.TrimSpace(fact.Category))
+	if fact.Category == "" {
+		fact.Category = CategoryGeneral
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	now := time.Now()
+	var replaced []Fact
+	var existing *Fact
+	for id, other := range fs.facts {
+		if !strings.EqualFold(other.Subject, fact.Subject) || !strings.EqualFold(other.Predicate, fact.Predicate) {
+			continue
+		}
+		switch {
+		case strings.EqualFold(other.Value, fact.Value):
+			existing = other
+		case replace:
+			replaced = append(replaced, *other)
+			delete(fs.facts, id)
+		}
+	}
+
+	if existing != nil {
+		existing.Category = fact.Category
+		existing.Confidence = fact.Confidence
+		if fact.Source != "" {
+			existing.Source = fact.Source
+		}
+		existing.UpdatedAt = now
+		fact = *existing
+	} else {
+		fact.ID = "fact_" + uuid.NewString()[:8]
+		fact.CreatedAt = now
+		fact.UpdatedAt = now
+		stored := fact
+		fs.facts[fact.ID] = &stored
+	}
+
+	sortFacts(replaced)
+	return fact, replaced, fs.save()
+}
+
+// Query returns the facts that match, by subject, then predicate, then newest first
+func (fs *FactStore) Query(query FactQuery) []Fact {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	text := strings.ToLower(strings.TrimSpace(query.Text))
+	var facts []Fact
+	for _, fact := range fs.facts {
+		if query.Subject != "" && !strings.EqualFold(fact.Subject, strings.TrimSpace(query.Subject)) {
+			continue
+		}
+		if query.Predicate != "" && !strings.EqualFold(fact.Predicate, strings.TrimSpace(query.Predicate)) {
+			continue
+		}
+		if query.Category != "" && !strings.EqualFold(fact.Category, strings.TrimSpace(query.Category)) {
+			continue
+		}
+		if fact.Confidence < query.MinConfidence {
+			continue
+		}
+		if text != "" {
+			fields := strings.ToLower(strings.Join([]string{fact.Subject, fact.Predicate, fact.Value, fact.Category, fact.Source}, "\n"))
+			if !strings.Contains(fields, text) {
+				continue
+			}
+		}
+		facts = append(facts, *fact)
+	}
+
+	sortFacts(facts)
+	return facts
+}
+
+// Retract removes a fact by ID and returns it, reporting false if there is no such fact
+func (fs *FactStore) Retract(id string) (Fact, bool, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fact, ok := fs.facts[id]
+	if !ok {
+		return Fact{}, false, nil
+	}
+	delete(fs.facts, id)
+	return *fact, true, fs.save()
+}
+
+// sortFacts orders facts by subject, then predicate, then newest first
+func sortFacts(facts []Fact) {
+	sort.Slice(facts, func(i, j int) bool {
+		a, b := facts[i], facts[j]
+		if s1, s2 := strings.ToLower(a.Subject), strings.ToLower(b.Subject); s1 != s2 {
+			return s1 < s2
+		}
+		if p1, p2 := strings.ToLower(a.Predicate), strings.ToLower(b.Predicate); p1 != p2 {
+			return p1 < p2
+		}
+		return a.UpdatedAt.After(b.UpdatedAt)
+	})
+}
+
+// save writes the facts to disk; the caller must hold the mutex
+func (fs *FactStore) save() error {
+	facts := make([]Fact, 0, len(fs.facts))
+	for _, fact := range fs.facts {
+		facts = append(facts, *fact)
+	}
+	sortFacts(facts)
+
+	data, err := json.MarshalIndent(facts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode facts: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0755); err != nil {
+		return fmt.Errorf("failed to create memory directory: %w", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated store
+	tmpPath := fs.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write facts: %w", err)
+	}
+
+	return os.Rename(tmpPath, fs.path)
+}
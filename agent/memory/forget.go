@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"nanotalon/session"
+)
+
+// MemoryMatch is a line of long-term memory or a history entry that contains some text
+type MemoryMatch struct {
+	File string // "MEMORY.md", "HISTORY.md" or an archive such as "HISTORY-2025-01.md"
+	Text string
+}
+
+// Find returns the lines of long-term memory and the history entries, archived ones
+// included, that contain text, ignoring case
+func (ms *MemoryStore) Find(text string) ([]MemoryMatch, error) {
+	return ms.forget(text, true)
+}
+
+// Forget removes the lines of long-term memory and the history entries, archived ones
+// included, that contain text, ignoring case, and returns what it removed
+func (ms *MemoryStore) Forget(text string) ([]MemoryMatch, error) {
+	return ms.forget(text, false)
+}
+
+// forget finds the matches of text in every memory file, rewriting the files without
+// them unless dryRun is set
+func (ms *MemoryStore) forget(text string, dryRun bool) ([]MemoryMatch, error) {
+	needle := strings.ToLower(strings.TrimSpace(text))
+	if needle == "" {
+		return nil, fmt.Errorf("nothing to forget: the text is empty")
+	}
+	contains := func(s string) bool {
+		return strings.Contains(strings.ToLower(s), needle)
+	}
+
+	var matches []MemoryMatch
+
+	// Long-term memory is edited line by line, so one bullet goes rather than a whole section
+	longTerm, err := ms.ReadLongTerm()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read long-term memory: %w", err)
+	}
+	var kept []string
+	for _, line := range strings.SplitAfter(longTerm, "\n") {
+		if contains(line) {
+			matches = append(matches, MemoryMatch{File: "MEMORY.md", Text: strings.TrimSpace(line)})
+		} else {
+			kept = append(kept, line)
+		}
+	}
+	if !dryRun && len(matches) > 0 {
+		if err := writeFileAtomic(ms.memoryFile, strings.Join(kept, "")); err != nil {
+			return nil, fmt.Errorf("failed to write long-term memory: %w", err)
+		}
+	}
+
+	// History is edited entry by entry
+	months, err := ms.HistoryArchives()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(months)+1)
+	for _, month := range months {
+		files = append(files, ms.historyArchiveFile(month))
+	}
+	files = append(files, ms.historyFile)
+
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+
+		preamble, entries := splitHistoryEntries(string(data))
+		var keptEntries []string
+		removed := 0
+		for _, entry := range entries {
+			if contains(entry) {
+				matches = append(matches, MemoryMatch{File: filepath.Base(path), Text: strings.TrimSpace(entry)})
+				removed++
+			} else {
+				keptEntries = append(keptEntries, entry)
+			}
+		}
+		if dryRun || removed == 0 {
+			continue
+		}
+
+		// An archive left without entries is removed; HISTORY.md keeps its heading
+		content := preamble + strings.Join(keptEntries, "")
+		if path != ms.historyFile && strings.TrimSpace(content) == "" {
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("failed to remove history archive: %w", err)
+			}
+			continue
+		}
+		if err := writeFileAtomic(path, content); err != nil {
+			return nil, fmt.Errorf("failed to write history: %w", err)
+		}
+	}
+
+	return matches, nil
+}
+
+// writeFileAtomic writes a file through a temp file so a crash never leaves it truncated
+func writeFileAtomic(path, content string) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// ForgetReport lists what forgetting some text removed, or would remove in a dry run
+type ForgetReport struct {
+	Memory   []MemoryMatch       // Lines and entries of memory files; File is relative to the workspace
+	Facts    []Fact              // Facts that mention the text
+	Chunks   int                 // Chunks of the memory search index
+	Sessions []session.Redaction // Session messages and summaries the text was redacted from
+}
+
+// Empty reports whether nothing matched
+func (r ForgetReport) Empty() bool {
+	return len(r.Memory) == 0 && len(r.Facts) == 0 && r.Chunks == 0 && len(r.Sessions) == 0
+}
+
+// Forget removes text, ignoring case, everywhere the assistant may have kept it: the
+// long-term memory, history, facts and search index of every scope, and, unless sessions
+// is nil, session transcripts. With dryRun nothing is changed.
+func (s *Scopes) Forget(sessions *session.SessionManager, text string, dryRun bool) (ForgetReport, error) {
+	var report ForgetReport
+	if strings.TrimSpace(text) == "" {
+		return report, fmt.Errorf("nothing to forget: the text is empty")
+	}
+
+	scopes, err := s.Existing()
+	if err != nil {
+		return report, err
+	}
+	for _, scope := range scopes {
+		store := NewMemoryStoreAt(scope.Dir)
+		find := store.Forget
+		if dryRun {
+			find = store.Find
+		}
+		matches, err := find(text)
+		if err != nil {
+			return report, err
+		}
+		for _, match := range matches {
+			if rel, err := filepath.Rel(s.workspace, filepath.Join(scope.Dir, match.File)); err == nil {
+				match.File = rel
+			}
+			report.Memory = append(report.Memory, match)
+		}
+
+		facts, err := s.Facts(scope)
+		if err != nil {
+			return report, err
+		}
+		for _, fact := range facts.Query(FactQuery{Text: text}) {
+			if !dryRun {
+				if _, _, err := facts.Retract(fact.ID); err != nil {
+					return report, err
+				}
+			}
+			report.Facts = append(report.Facts, fact)
+		}
+
+		// Chunks go now rather than at the next search, which may never come
+		indexPath := filepath.Join(scope.Dir, "index", "memory.db")
+		if _, err := os.Stat(indexPath); err == nil {
+			index, err := OpenMemoryIndex(indexPath, "")
+			if err != nil {
+				return report, err
+			}
+			chunks, err := index.Forget(text, dryRun)
+			index.Close()
+			if err != nil {
+				return report, err
+			}
+			report.Chunks += chunks
+		}
+	}
+
+	if sessions != nil {
+		redactions, err := sessions.Redact(text, dryRun)
+		report.Sessions = redactions
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,196 @@
+package memory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default HISTORY.md size limits, see SetHistoryLimits
+const (
+	DefaultHistoryMaxBytes  = 256 * 1024
+	DefaultHistoryKeepBytes = 64 * 1024
+)
+
+// historyEntryStart matches the "[2006-01-02 15:04:05] " prefix of a history entry
+var historyEntryStart = regexp.MustCompile(`(?m)^\[\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\] `)
+
+// historyArchivePattern matches archive file names, capturing the month
+var historyArchivePattern = regexp.MustCompile(`^HISTORY-(\d{4}-\d{2})\.md$`)
+
+// SetHistoryLimits sets when HISTORY.md is rotated: once it grows past maxBytes, all but
+// the newest keepBytes of entries move to monthly archives. A maxBytes of 0 or less
+// disables rotation.
+func (ms *MemoryStore) SetHistoryLimits(maxBytes, keepBytes int64) {
+	ms.historyMaxBytes = maxBytes
+	ms.historyKeepBytes = keepBytes
+}
+
+// HistoryArchives returns the months of the history archives, oldest first
+func (ms *MemoryStore) HistoryArchives() ([]string, error) {
+	entries, err := os.ReadDir(ms.memoryDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history archives: %w", err)
+	}
+
+	var months []string
+	for _, entry := range entries {
+		if match := historyArchivePattern.FindStringSubmatch(entry.Name()); match != nil && !entry.IsDir() {
+			months = append(months, match[1])
+		}
+	}
+	sort.Strings(months)
+	return months, nil
+}
+
+// ReadHistoryArchive reads the archive of a month, such as "2025-01"
+func (ms *MemoryStore) ReadHistoryArchive(month string) (string, error) {
+	content, err := os.ReadFile(ms.historyArchiveFile(month))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// historyArchiveFile returns the path of a month's archive
+func (ms *MemoryStore) historyArchiveFile(month string) string {
+	return filepath.Join(ms.memoryDir, "HISTORY-"+month+".md")
+}
+
+// rotateHistoryIfNeeded rotates HISTORY.md if it has grown past the limit
+func (ms *MemoryStore) rotateHistoryIfNeeded() error {
+	if ms.historyMaxBytes <= 0 {
+		return nil
+	}
+	info, err := os.Stat(ms.historyFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() <= ms.historyMaxBytes {
+		return nil
+	}
+	return ms.RotateHistory()
+}
+
+// RotateHistory moves all but the newest entries of HISTORY.md, up to the keep limit, to
+// HISTORY-YYYY-MM.md archives by the month they were written in. Text before the first
+// entry, such as a heading, stays in HISTORY.md, and the newest entry always does.
+func (ms *MemoryStore) RotateHistory() error {
+	content, err := ms.ReadHistory()
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+
+	preamble, entries := splitHistoryEntries(content)
+	keep := len(entries)
+	var kept int64
+	for keep > 0 {
+		size := int64(len(entries[keep-1]))
+		if keep < len(entries) && kept+size > ms.historyKeepBytes {
+			break
+		}
+		kept += size
+		keep--
+	}
+	if keep == 0 {
+		return nil
+	}
+
+	// Append the old entries to their archives before dropping them from HISTORY.md, so a
+	// failure leaves entries duplicated rather than lost
+	var months []string
+	byMonth := make(map[string][]string)
+	for _, entry := range entries[:keep] {
+		month := time.Now().Format("2006-01")
+		if date, ok := historyEntryDate(entry); ok {
+			month = date.Format("2006-01")
+		}
+		if _, ok := byMonth[month]; !ok {
+			months = append(months, month)
+		}
+		byMonth[month] = append(byMonth[month], entry)
+	}
+	for _, month := range months {
+		if err := ms.appendHistoryArchive(month, byMonth[month]); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(ms.historyFile, preamble+strings.Join(entries[keep:], "")); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// appendHistoryArchive appends entries to the archive of a month
+func (ms *MemoryStore) appendHistoryArchive(month string, entries []string) error {
+	f, err := os.OpenFile(ms.historyArchiveFile(month), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history archive: %w", err)
+	}
+	for _, entry := range entries {
+		if _, err := f.WriteString(entry); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write history archive: %w", err)
+		}
+	}
+	return f.Close()
+}
+
+// splitHistoryEntries splits a history log into the text before the first entry and the
+// entries, each with its trailing blank line
+func splitHistoryEntries(content string) (string, []string) {
+	starts := historyEntryStart.FindAllStringIndex(content, -1)
+	if len(starts) == 0 {
+		return content, nil
+	}
+
+	entries := make([]string, 0, len(starts))
+	for i, start := range starts {
+		end := len(content)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		entries = append(entries, content[start[0]:end])
+	}
+	return content[:starts[0][0]], entries
+}
+
+// HistoryEntries returns every history entry, from the archives oldest first and then
+// HISTORY.md, each with its trailing blank line
+func (ms *MemoryStore) HistoryEntries() ([]string, error) {
+	months, err := ms.HistoryArchives()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []string
+	for _, month := range months {
+		content, err := ms.ReadHistoryArchive(month)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history archive: %w", err)
+		}
+		_, archived := splitHistoryEntries(content)
+		entries = append(entries, archived...)
+	}
+
+	content, err := ms.ReadHistory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	_, recent := splitHistoryEntries(content)
+	return append(entries, recent...), nil
+}
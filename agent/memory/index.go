@@ -0,0 +1,737 @@
+package memory
+
+import (
+	"container/heap"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Sources of indexed chunks
+const (
+	SourceMemory  = "memory"
+	SourceHistory = "history"
+)
+
+// HistoryArchiveSource is the source of the history archive of a month, such as "2025-01"
+func HistoryArchiveSource(month string) string {
+	return SourceHistory + ":" + month
+}
+
+// isHistorySource reports whether a source is the history log or one of its archives
+func isHistorySource(source string) bool {
+	return source == SourceHistory || strings.HasPrefix(source, SourceHistory+":")
+}
+
+// memoryIndexSchema creates the index tables. Vectors are little-endian float32 blobs;
+// date is the chunk's unix time in milliseconds, or 0 when the chunk has none.
+const memoryIndexSchema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS chunks (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	source   TEXT NOT NULL,
+	hash     TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	date     INTEGER NOT NULL DEFAULT 0,
+	text     TEXT NOT NULL,
+	vector   BLOB NOT NULL,
+	UNIQUE (source, hash)
+);
+CREATE INDEX IF NOT EXISTS idx_chunks_date ON chunks (source, date);
+
+CREATE TABLE IF NOT EXISTS stamps (
+	source TEXT PRIMARY KEY,
+	stamp  TEXT NOT NULL
+);
+`
+
+// vectorStoreTimeout bounds each request an index makes to its vector store
+const vectorStoreTimeout = time.Minute
+
+// vectorStoreBatch is the most chunks sent to a vector store in one upsert
+const vectorStoreBatch = 500
+
+// MemoryIndex is the on-disk vector index of embedded memory chunks. Searches are exact
+// cosine scans over the stored vectors, which is fast enough for personal-scale memory,
+// unless a vector store is attached with UseVectorStore.
+type MemoryIndex struct {
+	db        *sql.DB
+	model     string
+	namespace string      // Separates this index's vectors from others' in a shared store
+	vectors   VectorStore // Nil when searches scan the index
+}
+
+// IndexedChunk is a chunk of a memory source together with its embedding
+type IndexedChunk struct {
+	Source   string
+	Hash     string
+	Position int
+	Date     time.Time // Zero when the chunk has no timestamp
+	Text     string
+	Vector   []float64
+}
+
+// SearchFilter restricts a search to some sources and a date range. Zero values match
+// everything; with Since or Until set, chunks without a date are left out.
+type SearchFilter struct {
+	Sources []string
+	Since   time.Time
+	Until   time.Time
+}
+
+// OpenMemoryIndex opens or creates the index at path for the given embedding model.
+// Vectors from another model aren't comparable, so if the model changed the index is
+// emptied and refilled by the next sync.
+func OpenMemoryIndex(path, model string) (*MemoryIndex, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating memory index directory: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening memory index: %w", err)
+	}
+	// SQLite allows one writer at a time; serializing here avoids SQLITE_BUSY under load
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(memoryIndexSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating memory index schema: %w", err)
+	}
+
+	// The absolute path names the index in a vector store shared with other indexes
+	namespace, err := filepath.Abs(path)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error resolving memory index path: %w", err)
+	}
+
+	// Without a model the index is opened as it is, for maintenance such as Forget
+	index := &MemoryIndex{db: db, model: model, namespace: namespace}
+	if model == "" {
+		return index, nil
+	}
+	if err := index.checkModel(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// checkModel drops every chunk if the index was built with a different embedding model
+func (ix *MemoryIndex) checkModel() error {
+	var stored string
+	err := ix.db.QueryRow(`SELECT value FROM meta WHERE key = 'model'`).Scan(&stored)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error reading memory index model: %w", err)
+	}
+	if err == nil && stored == ix.model {
+		return nil
+	}
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM chunks`); err != nil {
+		return fmt.Errorf("error clearing memory index: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM stamps`); err != nil {
+		return fmt.Errorf("error clearing memory index: %w", err)
+	}
+	if err := unmarkMirrored(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('model', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, ix.model); err != nil {
+		return fmt.Errorf("error saving memory index model: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Positions returns the position of every indexed chunk of a source, keyed by hash
+func (ix *MemoryIndex) Positions(source string) (map[string]int, error) {
+	rows, err := ix.db.Query(`SELECT hash, position FROM chunks WHERE source = ?`, source)
+	if err != nil {
+		return nil, fmt.Errorf("error reading memory index: %w", err)
+	}
+	defer rows.Close()
+
+	positions := make(map[string]int)
+	for rows.Next() {
+		var hash string
+		var position int
+		if err := rows.Scan(&hash, &position); err != nil {
+			return nil, fmt.Errorf("error reading memory index: %w", err)
+		}
+		positions[hash] = position
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading memory index: %w", err)
+	}
+
+	return positions, nil
+}
+
+// Vectors returns the stored vectors of the chunks with the given hashes in any source,
+// so text that moved between sources isn't embedded again
+func (ix *MemoryIndex) Vectors(hashes []string) (map[string][]float64, error) {
+	const batchSize = 500
+	vectors := make(map[string][]float64)
+	for start := 0; start < len(hashes); start += batchSize {
+		batch := hashes[start:min(start+batchSize, len(hashes))]
+		args := make([]interface{}, len(batch))
+		for i, hash := range batch {
+			args[i] = hash
+		}
+
+		rows, err := ix.db.Query(`SELECT hash, vector FROM chunks WHERE hash IN (?`+strings.Repeat(`, ?`, len(batch)-1)+`)`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("error reading memory index: %w", err)
+		}
+		for rows.Next() {
+			var hash string
+			var blob []byte
+			if err := rows.Scan(&hash, &blob); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error reading memory index: %w", err)
+			}
+			vectors[hash] = decodeVector(blob)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading memory index: %w", err)
+		}
+	}
+	return vectors, nil
+}
+
+// Add inserts chunks, replacing any with the same source and hash
+func (ix *MemoryIndex) Add(chunks []IndexedChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, chunk := range chunks {
+		var date int64
+		if !chunk.Date.IsZero() {
+			date = chunk.Date.UnixMilli()
+		}
+		if _, err := tx.Exec(`INSERT INTO chunks (source, hash, position, date, text, vector) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (source, hash) DO UPDATE SET position = excluded.position, date = excluded.date,
+			text = excluded.text, vector = excluded.vector`,
+			chunk.Source, chunk.Hash, chunk.Position, date, chunk.Text, encodeVector(chunk.Vector)); err != nil {
+			return fmt.Errorf("error adding to memory index: %w", err)
+		}
+	}
+	if err := unmarkMirrored(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error adding to memory index: %w", err)
+	}
+
+	return ix.mirror(func(ctx context.Context, store VectorStore) error {
+		docs := make([]VectorDocument, 0, len(chunks))
+		for _, chunk := range chunks {
+			var date int64
+			if !chunk.Date.IsZero() {
+				date = chunk.Date.UnixMilli()
+			}
+			docs = append(docs, ix.vectorDocument(chunk.Source, chunk.Hash, date, chunk.Vector))
+		}
+		return store.Upsert(ctx, docs)
+	})
+}
+
+// Update moves chunks to new positions and removes those no longer in the source
+func (ix *MemoryIndex) Update(source string, moved map[string]int, removed []string) error {
+	if len(moved) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for hash, position := range moved {
+		if _, err := tx.Exec(`UPDATE chunks SET position = ? WHERE source = ? AND hash = ?`, position, source, hash); err != nil {
+			return fmt.Errorf("error updating memory index: %w", err)
+		}
+	}
+	for _, hash := range removed {
+		if _, err := tx.Exec(`DELETE FROM chunks WHERE source = ? AND hash = ?`, source, hash); err != nil {
+			return fmt.Errorf("error updating memory index: %w", err)
+		}
+	}
+	if len(removed) == 0 {
+		return tx.Commit()
+	}
+	if err := unmarkMirrored(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error updating memory index: %w", err)
+	}
+
+	ids := make([]string, len(removed))
+	for i, hash := range removed {
+		ids[i] = ix.vectorID(source, hash)
+	}
+	return ix.mirror(func(ctx context.Context, store VectorStore) error {
+		return store.Delete(ctx, ids...)
+	})
+}
+
+// Stamps returns the stamp recorded for each source with SetStamp, such as a file's size
+// and modification time when it was indexed
+func (ix *MemoryIndex) Stamps() (map[string]string, error) {
+	rows, err := ix.db.Query(`SELECT source, stamp FROM stamps`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading memory index: %w", err)
+	}
+	defer rows.Close()
+
+	stamps := make(map[string]string)
+	for rows.Next() {
+		var source, stamp string
+		if err := rows.Scan(&source, &stamp); err != nil {
+			return nil, fmt.Errorf("error reading memory index: %w", err)
+		}
+		stamps[source] = stamp
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading memory index: %w", err)
+	}
+
+	return stamps, nil
+}
+
+// SetStamp records the stamp of a source
+func (ix *MemoryIndex) SetStamp(source, stamp string) error {
+	if _, err := ix.db.Exec(`INSERT INTO stamps (source, stamp) VALUES (?, ?)
+		ON CONFLICT (source) DO UPDATE SET stamp = excluded.stamp`, source, stamp); err != nil {
+		return fmt.Errorf("error updating memory index: %w", err)
+	}
+	return nil
+}
+
+// RemoveSource removes every chunk of a source and its stamp
+func (ix *MemoryIndex) RemoveSource(source string) error {
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ids, err := ix.deleteChunks(tx, `source = ?`, source)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM stamps WHERE source = ?`, source); err != nil {
+		return fmt.Errorf("error updating memory index: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error updating memory index: %w", err)
+	}
+
+	return ix.mirror(func(ctx context.Context, store VectorStore) error {
+		return store.Delete(ctx, ids...)
+	})
+}
+
+// Forget removes the chunks whose text contains text, ignoring case, and returns how many
+// there were. With dryRun they are only counted.
+func (ix *MemoryIndex) Forget(text string, dryRun bool) (int, error) {
+	const match = `FROM chunks WHERE instr(lower(text), lower(?)) > 0`
+	if dryRun {
+		var count int
+		if err := ix.db.QueryRow(`SELECT COUNT(*) `+match, text).Scan(&count); err != nil {
+			return 0, fmt.Errorf("error reading memory index: %w", err)
+		}
+		return count, nil
+	}
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ids, err := ix.deleteChunks(tx, `instr(lower(text), lower(?)) > 0`, text)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error updating memory index: %w", err)
+	}
+
+	return len(ids), ix.mirror(func(ctx context.Context, store VectorStore) error {
+		return store.Delete(ctx, ids...)
+	})
+}
+
+// Empty reports whether the index holds no chunks
+func (ix *MemoryIndex) Empty() (bool, error) {
+	var exists bool
+	if err := ix.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM chunks)`).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error reading memory index: %w", err)
+	}
+	return !exists, nil
+}
+
+// IndexMatch is a search result with its similarity to the query
+type IndexMatch struct {
+	Chunk IndexedChunk
+	Score float64
+}
+
+// Search returns the chunks matching the filter that are closest to vector, best first,
+// leaving out those with a score of minScore or less
+func (ix *MemoryIndex) Search(ctx context.Context, vector []float64, filter SearchFilter, minScore float64, limit int) ([]IndexMatch, error) {
+	if ix.vectors != nil {
+		return ix.searchStore(ctx, vector, filter, minScore, limit)
+	}
+
+	query := `SELECT source, hash, position, date, text, vector FROM chunks WHERE 1 = 1`
+	var args []interface{}
+	if len(filter.Sources) > 0 {
+		query += ` AND source IN (?` + strings.Repeat(`, ?`, len(filter.Sources)-1) + `)`
+		for _, source := range filter.Sources {
+			args = append(args, source)
+		}
+	}
+	if !filter.Since.IsZero() {
+		query += ` AND date >= ?`
+		args = append(args, filter.Since.UnixMilli())
+	}
+	if !filter.Until.IsZero() {
+		query += ` AND date > 0 AND date < ?`
+		args = append(args, filter.Until.UnixMilli())
+	}
+
+	rows, err := ix.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching memory index: %w", err)
+	}
+	defer rows.Close()
+
+	best := &matchHeap{}
+	for rows.Next() {
+		var chunk IndexedChunk
+		var date int64
+		var blob []byte
+		if err := rows.Scan(&chunk.Source, &chunk.Hash, &chunk.Position, &date, &chunk.Text, &blob); err != nil {
+			return nil, fmt.Errorf("error searching memory index: %w", err)
+		}
+
+		score := cosineSimilarity(vector, decodeVector(blob))
+		if score <= minScore {
+			continue
+		}
+		if date != 0 {
+			chunk.Date = time.UnixMilli(date)
+		}
+
+		heap.Push(best, IndexMatch{Chunk: chunk, Score: score})
+		if limit > 0 && best.Len() > limit {
+			heap.Pop(best)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error searching memory index: %w", err)
+	}
+
+	// The heap pops worst first, so fill the results from the back
+	matches := make([]IndexMatch, best.Len())
+	for i := len(matches) - 1; i >= 0; i-- {
+		matches[i] = heap.Pop(best).(IndexMatch)
+	}
+
+	return matches, nil
+}
+
+// searchStore runs a search on the vector store, then reads the matching chunks from the
+// index. Matches the index no longer has, left behind by a change the store missed, are skipped.
+func (ix *MemoryIndex) searchStore(ctx context.Context, vector []float64, filter SearchFilter, minScore float64, limit int) ([]IndexMatch, error) {
+	found, err := ix.vectors.Query(ctx, vector, VectorFilter{Namespace: ix.namespace, SearchFilter: filter}, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error searching vector store: %w", err)
+	}
+
+	var matches []IndexMatch
+	for _, match := range found {
+		if match.Score <= minScore {
+			continue
+		}
+		source, hash, ok := ix.splitVectorID(match.ID)
+		if !ok {
+			continue
+		}
+
+		chunk := IndexedChunk{Source: source, Hash: hash}
+		var date int64
+		err := ix.db.QueryRowContext(ctx, `SELECT position, date, text FROM chunks WHERE source = ? AND hash = ?`,
+			source, hash).Scan(&chunk.Position, &date, &chunk.Text)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error searching memory index: %w", err)
+		}
+		if date != 0 {
+			chunk.Date = time.UnixMilli(date)
+		}
+
+		matches = append(matches, IndexMatch{Chunk: chunk, Score: match.Score})
+	}
+
+	return matches, nil
+}
+
+// UseVectorStore sends searches to a vector store, which the index keeps up to date from
+// then on and closes along with itself. The store gets every chunk again when it's new to
+// the index or missed changes. On error the store is closed and searches stay local.
+func (ix *MemoryIndex) UseVectorStore(store VectorStore) error {
+	if err := ix.fillVectorStore(store); err != nil {
+		store.Close()
+		return err
+	}
+	ix.vectors = store
+	return nil
+}
+
+// fillVectorStore replaces the index's vectors in the store unless it already has them
+func (ix *MemoryIndex) fillVectorStore(store VectorStore) error {
+	mark := store.Name() + " " + ix.namespace
+	var stored string
+	err := ix.db.QueryRow(`SELECT value FROM meta WHERE key = 'vector_store'`).Scan(&stored)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error reading memory index: %w", err)
+	}
+	if err == nil && stored == mark {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vectorStoreTimeout)
+	err = store.DeleteNamespace(ctx, ix.namespace)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("error clearing vector store: %w", err)
+	}
+
+	var after int64
+	for {
+		docs, last, err := ix.vectorDocuments(after)
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), vectorStoreTimeout)
+		err = store.Upsert(ctx, docs)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error filling vector store: %w", err)
+		}
+		after = last
+	}
+
+	return ix.markMirrored(mark)
+}
+
+// vectorDocuments returns the next batch of chunks after the row ID after as vector store
+// documents, with the row ID of the last one
+func (ix *MemoryIndex) vectorDocuments(after int64) ([]VectorDocument, int64, error) {
+	rows, err := ix.db.Query(`SELECT id, source, hash, date, vector FROM chunks WHERE id > ? ORDER BY id LIMIT ?`,
+		after, vectorStoreBatch)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading memory index: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []VectorDocument
+	for rows.Next() {
+		var source, hash string
+		var date int64
+		var blob []byte
+		if err := rows.Scan(&after, &source, &hash, &date, &blob); err != nil {
+			return nil, 0, fmt.Errorf("error reading memory index: %w", err)
+		}
+		docs = append(docs, ix.vectorDocument(source, hash, date, decodeVector(blob)))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error reading memory index: %w", err)
+	}
+
+	return docs, after, nil
+}
+
+// deleteChunks deletes the chunks matching a condition and returns their vector store IDs
+func (ix *MemoryIndex) deleteChunks(tx *sql.Tx, where string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(`SELECT source, hash FROM chunks WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading memory index: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var source, hash string
+		if err := rows.Scan(&source, &hash); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading memory index: %w", err)
+		}
+		ids = append(ids, ix.vectorID(source, hash))
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading memory index: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM chunks WHERE `+where, args...); err != nil {
+		return nil, fmt.Errorf("error updating memory index: %w", err)
+	}
+	if err := unmarkMirrored(tx); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// mirror applies a change that was committed to the index to the vector store, if one is
+// attached. Committing the change cleared the mark, so if this fails the store is known to
+// be stale: it's dropped, searches go back to scanning the index, and it's filled again the
+// next time it's attached.
+func (ix *MemoryIndex) mirror(change func(ctx context.Context, store VectorStore) error) error {
+	if ix.vectors == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vectorStoreTimeout)
+	defer cancel()
+	if err := change(ctx, ix.vectors); err != nil {
+		ix.vectors.Close()
+		ix.vectors = nil
+		return fmt.Errorf("error updating vector store: %w", err)
+	}
+	return ix.markMirrored(ix.vectors.Name() + " " + ix.namespace)
+}
+
+// markMirrored records that the vector store named in mark holds exactly the index's vectors
+func (ix *MemoryIndex) markMirrored(mark string) error {
+	if _, err := ix.db.Exec(`INSERT INTO meta (key, value) VALUES ('vector_store', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, mark); err != nil {
+		return fmt.Errorf("error updating memory index: %w", err)
+	}
+	return nil
+}
+
+// unmarkMirrored clears the mark as part of a change, which no vector store has yet
+func unmarkMirrored(tx *sql.Tx) error {
+	if _, err := tx.Exec(`DELETE FROM meta WHERE key = 'vector_store'`); err != nil {
+		return fmt.Errorf("error updating memory index: %w", err)
+	}
+	return nil
+}
+
+// vectorDocument returns the vector store document of a chunk
+func (ix *MemoryIndex) vectorDocument(source, hash string, date int64, vector []float64) VectorDocument {
+	return VectorDocument{
+		ID:        ix.vectorID(source, hash),
+		Namespace: ix.namespace,
+		Source:    source,
+		Date:      date,
+		Vector:    vector,
+	}
+}
+
+// vectorID returns the vector store ID of a chunk, unique across the indexes sharing a store
+func (ix *MemoryIndex) vectorID(source, hash string) string {
+	return ix.namespace + "|" + source + "|" + hash
+}
+
+// splitVectorID reverses vectorID. Hashes are hex, so the last separator ends the source.
+func (ix *MemoryIndex) splitVectorID(id string) (source, hash string, ok bool) {
+	rest, ok := strings.CutPrefix(id, ix.namespace+"|")
+	i := strings.LastIndex(rest, "|")
+	if !ok || i < 0 {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// Close closes the index database and the vector store, if one is attached
+func (ix *MemoryIndex) Close() error {
+	if ix.vectors != nil {
+		ix.vectors.Close()
+	}
+	return ix.db.Close()
+}
+
+// matchHeap is a min-heap of matches by score, used to keep the best ones during a scan.
+// Ties go to the earlier chunk of a source so results are stable.
+type matchHeap []IndexMatch
+
+func (h matchHeap) Len() int { return len(h) }
+func (h matchHeap) Less(i, j int) bool {
+	if h[i].Score != h[j].Score {
+		return h[i].Score < h[j].Score
+	}
+	return h[i].Chunk.Position > h[j].Chunk.Position
+}
+func (h matchHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(IndexMatch)) }
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// encodeVector stores a vector as little-endian float32s; the precision is plenty for ranking
+func encodeVector(vector []float64) []byte {
+	blob := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(blob[4*i:], math.Float32bits(float32(v)))
+	}
+	return blob
+}
+
+// decodeVector reverses encodeVector
+func decodeVector(blob []byte) []float64 {
+	vector := make([]float64, len(blob)/4)
+	for i := range vector {
+		vector[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:])))
+	}
+	return vector
+}
@@ -0,0 +1,245 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"nanotalon/media"
+	"nanotalon/providers"
+)
+
+// KnowledgeBase indexes the documents the user drops into workspace/knowledge so the agent
+// can search them. Markdown and text files are read directly; PDFs go through a text
+// extraction command. Files are re-indexed when their size or modification time changes.
+type KnowledgeBase struct {
+	dir        string
+	embeddings providers.EmbeddingsProvider
+	index      *MemoryIndex
+	pdfCommand string
+	mutex      sync.Mutex
+}
+
+// knowledgeExtensions are the file types the knowledge base ingests
+var knowledgeExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".txt":      true,
+	".pdf":      true,
+}
+
+// NewKnowledgeBase creates the knowledge base for a workspace. PDFs are converted with
+// pdfCommand, which gets the path in place of {file}; without one, pdftotext is used if
+// installed, and otherwise PDFs are skipped.
+func NewKnowledgeBase(workspace string, embeddings providers.EmbeddingsProvider, pdfCommand string) (*KnowledgeBase, error) {
+	dir := filepath.Join(workspace, "knowledge")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating knowledge directory: %w", err)
+	}
+
+	// The index lives in a hidden directory, which ingestion skips
+	index, err := OpenMemoryIndex(filepath.Join(dir, ".index", "knowledge.db"), embeddings.GetModel())
+	if err != nil {
+		return nil, err
+	}
+
+	if pdfCommand == "" {
+		if _, err := exec.LookPath("pdftotext"); err == nil {
+			pdfCommand = "pdftotext -layout {file} - 2>/dev/null"
+		}
+	}
+
+	return &KnowledgeBase{
+		dir:        dir,
+		embeddings: embeddings,
+		index:      index,
+		pdfCommand: pdfCommand,
+	}, nil
+}
+
+// Dir returns the directory the knowledge base ingests
+func (kb *KnowledgeBase) Dir() string {
+	return kb.dir
+}
+
+// UseVectorStore searches the given vector store instead of scanning the index; see
+// MemoryIndex.UseVectorStore
+func (kb *KnowledgeBase) UseVectorStore(store VectorStore) error {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+	return kb.index.UseVectorStore(store)
+}
+
+// Close closes the index
+func (kb *KnowledgeBase) Close() error {
+	return kb.index.Close()
+}
+
+// Search ingests new and changed documents, then returns the chunks closest to the query,
+// best match first. Each result's Source is the document's path within the knowledge directory.
+func (kb *KnowledgeBase) Search(ctx context.Context, query string, limit int) ([]MemorySearchResult, error) {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+
+	pending, stamps, err := kb.sync()
+	if err != nil {
+		return nil, err
+	}
+
+	// Without documents there is nothing to search, so don't pay for embedding the query
+	if len(pending) == 0 {
+		if empty, err := kb.index.Empty(); err != nil || empty {
+			return []MemorySearchResult{}, err
+		}
+	}
+
+	queryVector, err := embedChunks(ctx, kb.embeddings, kb.index, query, pending)
+	if err != nil {
+		return nil, err
+	}
+	if err := kb.setStamps(stamps); err != nil {
+		return nil, err
+	}
+
+	matches, err := kb.index.Search(ctx, queryVector, SearchFilter{}, minSimilarity, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return searchResults(matches), nil
+}
+
+// Sync ingests new and changed documents and drops deleted ones from the index
+func (kb *KnowledgeBase) Sync(ctx context.Context) error {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+
+	pending, stamps, err := kb.sync()
+	if err != nil {
+		return err
+	}
+	if _, err := embedChunks(ctx, kb.embeddings, kb.index, "", pending); err != nil {
+		return err
+	}
+	return kb.setStamps(stamps)
+}
+
+// setStamps records the documents whose chunks were indexed, so they aren't read again
+// until they change
+func (kb *KnowledgeBase) setStamps(stamps map[string]string) error {
+	for source, stamp := range stamps {
+		if err := kb.index.SetStamp(source, stamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sync reconciles the index with the knowledge directory and returns the chunks of new
+// and changed documents for embedding, with the stamps to record once they are indexed.
+// Documents that can't be read are logged and retried next time. The caller must hold
+// the mutex.
+func (kb *KnowledgeBase) sync() ([]IndexedChunk, map[string]string, error) {
+	stamps, err := kb.index.Stamps()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pending []IndexedChunk
+	changed := make(map[string]string)
+	seen := make(map[string]bool)
+	err = filepath.WalkDir(kb.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != kb.dir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !knowledgeExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		source := filepath.ToSlash(strings.TrimPrefix(path, kb.dir+string(filepath.Separator)))
+		seen[source] = true
+
+		stamp := fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+		if stamps[source] == stamp {
+			return nil
+		}
+
+		text, err := kb.extract(path)
+		if err != nil {
+			slog.Warn("Could not ingest document into the knowledge base", "source", source, "error", err)
+			return nil
+		}
+
+		// A changed document is indexed from scratch
+		if err := kb.index.RemoveSource(source); err != nil {
+			return err
+		}
+		chunks := make(map[string]bool)
+		for i, segment := range segmentText(text) {
+			hash := chunkHash(segment)
+			if chunks[hash] {
+				continue
+			}
+			chunks[hash] = true
+			pending = append(pending, IndexedChunk{Source: source, Hash: hash, Position: i, Text: segment})
+		}
+		changed[source] = stamp
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error scanning knowledge directory: %w", err)
+	}
+
+	// Forget deleted documents
+	var removed []string
+	for source := range stamps {
+		if !seen[source] {
+			removed = append(removed, source)
+		}
+	}
+	sort.Strings(removed)
+	for _, source := range removed {
+		if err := kb.index.RemoveSource(source); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return pending, changed, nil
+}
+
+// extract returns the text of a document
+func (kb *KnowledgeBase) extract(path string) (string, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".pdf" {
+		if kb.pdfCommand == "" {
+			return "", fmt.Errorf("no PDF text extraction command (install pdftotext or set memory.knowledge.pdf_command)")
+		}
+		return media.ExtractText(kb.pdfCommand, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("not a UTF-8 text file")
+	}
+	return string(data), nil
+}
@@ -13,6 +13,10 @@ type MemoryStore struct {
 	memoryDir   string
 	memoryFile  string
 	historyFile string
+
+	// HISTORY.md is rotated into monthly archives past historyMaxBytes
+	historyMaxBytes  int64
+	historyKeepBytes int64
 }
 
 // NewMemoryStore creates a new memory store
@@ -22,10 +26,18 @@ func NewMemoryStore(workspace string) *MemoryStore {
 	// Ensure directory exists
 	os.MkdirAll(memoryDir, 0755)
 
+	return NewMemoryStoreAt(memoryDir)
+}
+
+// NewMemoryStoreAt creates a memory store for a memory directory, such as a scope's;
+// the directory is created on the first write
+func NewMemoryStoreAt(memoryDir string) *MemoryStore {
 	return &MemoryStore{
-		memoryDir:   memoryDir,
-		memoryFile:  filepath.Join(memoryDir, "MEMORY.md"),
-		historyFile: filepath.Join(memoryDir, "HISTORY.md"),
+		memoryDir:        memoryDir,
+		memoryFile:       filepath.Join(memoryDir, "MEMORY.md"),
+		historyFile:      filepath.Join(memoryDir, "HISTORY.md"),
+		historyMaxBytes:  DefaultHistoryMaxBytes,
+		historyKeepBytes: DefaultHistoryKeepBytes,
 	}
 }
 
@@ -43,22 +55,37 @@ func (ms *MemoryStore) ReadLongTerm() (string, error) {
 
 // WriteLongTerm writes to long-term memory
 func (ms *MemoryStore) WriteLongTerm(content string) error {
+	if err := os.MkdirAll(ms.memoryDir, 0755); err != nil {
+		return err
+	}
 	return os.WriteFile(ms.memoryFile, []byte(content), 0644)
 }
 
-// AppendHistory appends an entry to the history log
+// AppendHistory appends an entry to the history log, rotating it once it grows too large
 func (ms *MemoryStore) AppendHistory(entry string) error {
+	if err := os.MkdirAll(ms.memoryDir, 0755); err != nil {
+		return err
+	}
 	f, err := os.OpenFile(ms.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
 	// Remove trailing whitespace and add timestamp and newlines
 	cleanEntry := strings.TrimRight(entry, " \t\n\r")
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	_, err = fmt.Fprintf(f, "[%s] %s\n\n", timestamp, cleanEntry)
-	return err
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := ms.rotateHistoryIfNeeded(); err != nil {
+		return fmt.Errorf("failed to rotate history: %w", err)
+	}
+	return nil
 }
 
 // GetMemoryContext gets the memory context for inclusion in prompts
@@ -0,0 +1,223 @@
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq" // also registers the postgres driver
+)
+
+var pgIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PgVectorStore implements VectorStore on top of PostgreSQL with the pgvector extension
+type PgVectorStore struct {
+	db         *sql.DB
+	dsn        string
+	table      string
+	dimensions int
+	ensureOnce sync.Once
+	ensureErr  error
+}
+
+// NewPgVectorStore creates a new pgvector-backed vector store
+func NewPgVectorStore(dsn, table string, dimensions int) (*PgVectorStore, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("pgvector vector store requires memory.vector_store.dsn")
+	}
+	if table == "" {
+		table = "nanotalon_memory"
+	}
+	if !pgIdentifierPattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid pgvector table name: %s", table)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres connection: %w", err)
+	}
+
+	return &PgVectorStore{
+		db:         db,
+		dsn:        dsn,
+		table:      table,
+		dimensions: dimensions,
+	}, nil
+}
+
+// Name identifies the database and table. The DSN is hashed since it may hold a password.
+func (s *PgVectorStore) Name() string {
+	sum := sha256.Sum256([]byte(s.dsn))
+	return "pgvector " + hex.EncodeToString(sum[:8]) + "/" + s.table
+}
+
+// Upsert inserts or replaces documents by ID
+func (s *PgVectorStore) Upsert(ctx context.Context, docs []VectorDocument) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	if err := s.ensureTable(ctx, len(docs[0].Vector)); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`INSERT INTO %s (id, namespace, source, date, embedding) VALUES ($1, $2, $3, $4, $5::vector)
+ON CONFLICT (id) DO UPDATE SET namespace = EXCLUDED.namespace, source = EXCLUDED.source,
+date = EXCLUDED.date, embedding = EXCLUDED.embedding`, s.table)
+
+	for _, doc := range docs {
+		if _, err := tx.ExecContext(ctx, query, doc.ID, doc.Namespace, doc.Source, doc.Date, formatPgVector(doc.Vector)); err != nil {
+			return fmt.Errorf("failed to upsert vector %s: %w", doc.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Query returns the documents matching the filter closest to the given vector using
+// cosine distance
+func (s *PgVectorStore) Query(ctx context.Context, vector []float64, filter VectorFilter, limit int) ([]VectorMatch, error) {
+	// Nothing was stored yet, so there's no table to search
+	if exists, err := s.tableExists(ctx); err != nil || !exists {
+		return nil, err
+	}
+
+	query, args := pgSearchQuery(s.table, vector, filter, limit)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pgvector query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []VectorMatch
+	for rows.Next() {
+		var match VectorMatch
+		if err := rows.Scan(&match.ID, &match.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan pgvector row: %w", err)
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
+// Delete removes documents by ID
+func (s *PgVectorStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if exists, err := s.tableExists(ctx); err != nil || !exists {
+		return err
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = ANY($1)", s.table)
+	if _, err := s.db.ExecContext(ctx, query, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to delete vectors: %w", err)
+	}
+	return nil
+}
+
+// DeleteNamespace removes every document of a namespace
+func (s *PgVectorStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	if exists, err := s.tableExists(ctx); err != nil || !exists {
+		return err
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE namespace = $1", s.table)
+	if _, err := s.db.ExecContext(ctx, query, namespace); err != nil {
+		return fmt.Errorf("failed to delete vectors: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database connection pool
+func (s *PgVectorStore) Close() error {
+	return s.db.Close()
+}
+
+// tableExists reports whether the table was created by an earlier upsert
+func (s *PgVectorStore) tableExists(ctx context.Context) (bool, error) {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, s.table).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up pgvector table: %w", err)
+	}
+	return exists, nil
+}
+
+// ensureTable creates the extension and table on first use
+func (s *PgVectorStore) ensureTable(ctx context.Context, dimensions int) error {
+	s.ensureOnce.Do(func() {
+		if s.dimensions > 0 {
+			dimensions = s.dimensions
+		}
+
+		statements := []string{
+			"CREATE EXTENSION IF NOT EXISTS vector",
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id TEXT PRIMARY KEY,
+	namespace TEXT NOT NULL,
+	source TEXT NOT NULL,
+	date BIGINT NOT NULL DEFAULT 0,
+	embedding vector(%d) NOT NULL
+)`, s.table, dimensions),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_namespace ON %s (namespace, source)`, s.table, s.table),
+		}
+
+		for _, stmt := range statements {
+			if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+				s.ensureErr = fmt.Errorf("failed to prepare pgvector table: %w", err)
+				return
+			}
+		}
+	})
+	return s.ensureErr
+}
+
+// pgSearchQuery builds the nearest-neighbour query for a filter, returning the best
+// matches first as (id, score) rows
+func pgSearchQuery(table string, vector []float64, filter VectorFilter, limit int) (string, []interface{}) {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	args := []interface{}{formatPgVector(vector), filter.Namespace}
+	where := "namespace = $2"
+	if len(filter.Sources) > 0 {
+		args = append(args, pq.Array(filter.Sources))
+		where += fmt.Sprintf(" AND source = ANY($%d)", len(args))
+	}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since.UnixMilli())
+		where += fmt.Sprintf(" AND date >= $%d", len(args))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until.UnixMilli())
+		where += fmt.Sprintf(" AND date > 0 AND date < $%d", len(args))
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`SELECT id, 1 - (embedding <=> $1::vector) AS score
+FROM %s WHERE %s ORDER BY embedding <=> $1::vector LIMIT $%d`, table, where, len(args))
+	return query, args
+}
+
+// formatPgVector formats a vector using pgvector's text representation
+func formatPgVector(vector []float64) string {
+	parts := make([]string, len(vector))
+	for i, v := range vector {
+		parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
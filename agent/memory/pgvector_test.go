@@ -0,0 +1,34 @@
+package memory
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TestPgSearchQuery checks that filters become numbered query parameters in order
+func TestPgSearchQuery(t *testing.T) {
+	query, args := pgSearchQuery("mem", []float64{0.5, -1}, VectorFilter{Namespace: "ns"}, 0)
+	if !strings.Contains(query, "FROM mem WHERE namespace = $2 ORDER BY embedding <=> $1::vector LIMIT $3") {
+		t.Errorf("Unexpected query without filters: %s", query)
+	}
+	if want := []interface{}{"[0.5,-1]", "ns", 10}; !reflect.DeepEqual(args, want) {
+		t.Errorf("Expected args %v, got %v", want, args)
+	}
+
+	query, args = pgSearchQuery("mem", []float64{1}, VectorFilter{
+		Namespace:    "ns",
+		SearchFilter: SearchFilter{Sources: []string{"memory", "history"}, Since: time.UnixMilli(500), Until: time.UnixMilli(2000)},
+	}, 3)
+	wantWhere := "WHERE namespace = $2 AND source = ANY($3) AND date >= $4 AND date > 0 AND date < $5 ORDER BY embedding <=> $1::vector LIMIT $6"
+	if !strings.Contains(query, wantWhere) {
+		t.Errorf("Unexpected filtered query: %s", query)
+	}
+	want := []interface{}{"[1]", "ns", pq.Array([]string{"memory", "history"}), int64(500), int64(2000), 3}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("Expected args %v, got %v", want, args)
+	}
+}
@@ -0,0 +1,257 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QdrantVectorStore implements VectorStore on top of the Qdrant REST API
+type QdrantVectorStore struct {
+	baseURL    string
+	apiKey     string
+	collection string
+	dimensions int
+	client     *http.Client
+	ensureOnce sync.Once
+	ensureErr  error
+}
+
+// qdrantStatusError is a non-2xx response from Qdrant
+type qdrantStatusError struct {
+	status int
+	body   string
+}
+
+func (e *qdrantStatusError) Error() string {
+	return fmt.Sprintf("qdrant returned status %d: %s", e.status, e.body)
+}
+
+// NewQdrantVectorStore creates a new Qdrant-backed vector store
+func NewQdrantVectorStore(baseURL, apiKey, collection string, dimensions int) (*QdrantVectorStore, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("qdrant vector store requires memory.vector_store.url")
+	}
+	if collection == "" {
+		collection = "nanotalon_memory"
+	}
+
+	return &QdrantVectorStore{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		collection: collection,
+		dimensions: dimensions,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Name identifies the server and collection
+func (s *QdrantVectorStore) Name() string {
+	return "qdrant " + s.baseURL + "/" + s.collection
+}
+
+// Upsert inserts or replaces documents by ID
+func (s *QdrantVectorStore) Upsert(ctx context.Context, docs []VectorDocument) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	if err := s.ensureCollection(ctx, len(docs[0].Vector)); err != nil {
+		return err
+	}
+
+	points := make([]map[string]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		points = append(points, map[string]interface{}{
+			"id":     qdrantPointID(doc.ID),
+			"vector": doc.Vector,
+			"payload": map[string]interface{}{
+				"doc_id":    doc.ID,
+				"namespace": doc.Namespace,
+				"source":    doc.Source,
+				"date":      doc.Date,
+			},
+		})
+	}
+
+	path := fmt.Sprintf("/collections/%s/points?wait=true", s.collection)
+	_, err := s.do(ctx, http.MethodPut, path, map[string]interface{}{"points": points})
+	return err
+}
+
+// Query returns the documents matching the filter closest to the given vector
+func (s *QdrantVectorStore) Query(ctx context.Context, vector []float64, filter VectorFilter, limit int) ([]VectorMatch, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	path := fmt.Sprintf("/collections/%s/points/search", s.collection)
+	body, err := s.do(ctx, http.MethodPost, path, map[string]interface{}{
+		"vector":       vector,
+		"filter":       qdrantFilter(filter),
+		"limit":        limit,
+		"with_payload": []string{"doc_id"},
+	})
+	// Nothing was stored yet, so there's no collection to search
+	var statusErr *qdrantStatusError
+	if errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Result []struct {
+			Score   float64 `json:"score"`
+			Payload struct {
+				DocID string `json:"doc_id"`
+			} `json:"payload"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode qdrant search response: %w", err)
+	}
+
+	matches := make([]VectorMatch, 0, len(resp.Result))
+	for _, r := range resp.Result {
+		matches = append(matches, VectorMatch{ID: r.Payload.DocID, Score: r.Score})
+	}
+
+	return matches, nil
+}
+
+// Delete removes documents by ID
+func (s *QdrantVectorStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	pointIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		pointIDs = append(pointIDs, qdrantPointID(id))
+	}
+
+	return s.deletePoints(ctx, map[string]interface{}{"points": pointIDs})
+}
+
+// DeleteNamespace removes every document of a namespace
+func (s *QdrantVectorStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	return s.deletePoints(ctx, map[string]interface{}{
+		"filter": qdrantFilter(VectorFilter{Namespace: namespace}),
+	})
+}
+
+// Close is a no-op for the HTTP-based Qdrant store
+func (s *QdrantVectorStore) Close() error {
+	return nil
+}
+
+// deletePoints sends a delete request; a missing collection has nothing to delete
+func (s *QdrantVectorStore) deletePoints(ctx context.Context, selector map[string]interface{}) error {
+	path := fmt.Sprintf("/collections/%s/points/delete?wait=true", s.collection)
+	_, err := s.do(ctx, http.MethodPost, path, selector)
+	var statusErr *qdrantStatusError
+	if errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// qdrantFilter converts a filter to Qdrant's filter conditions on the point payload
+func qdrantFilter(filter VectorFilter) map[string]interface{} {
+	must := []map[string]interface{}{
+		{"key": "namespace", "match": map[string]interface{}{"value": filter.Namespace}},
+	}
+	if len(filter.Sources) > 0 {
+		must = append(must, map[string]interface{}{
+			"key": "source", "match": map[string]interface{}{"any": filter.Sources},
+		})
+	}
+	if !filter.Since.IsZero() {
+		must = append(must, map[string]interface{}{
+			"key": "date", "range": map[string]interface{}{"gte": filter.Since.UnixMilli()},
+		})
+	}
+	if !filter.Until.IsZero() {
+		must = append(must, map[string]interface{}{
+			"key": "date", "range": map[string]interface{}{"gt": 0, "lt": filter.Until.UnixMilli()},
+		})
+	}
+	return map[string]interface{}{"must": must}
+}
+
+// ensureCollection creates the collection on first use if it does not exist
+func (s *QdrantVectorStore) ensureCollection(ctx context.Context, dimensions int) error {
+	s.ensureOnce.Do(func() {
+		if s.dimensions > 0 {
+			dimensions = s.dimensions
+		}
+
+		path := fmt.Sprintf("/collections/%s", s.collection)
+		if _, err := s.do(ctx, http.MethodGet, path, nil); err == nil {
+			return
+		}
+
+		_, s.ensureErr = s.do(ctx, http.MethodPut, path, map[string]interface{}{
+			"vectors": map[string]interface{}{
+				"size":     dimensions,
+				"distance": "Cosine",
+			},
+		})
+	})
+	return s.ensureErr
+}
+
+// do sends a request to the Qdrant API and returns the response body
+func (s *QdrantVectorStore) do(ctx context.Context, method, path string, payload interface{}) ([]byte, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal qdrant request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create qdrant request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("api-key", s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("qdrant request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read qdrant response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &qdrantStatusError{status: resp.StatusCode, body: string(body)}
+	}
+
+	return body, nil
+}
+
+// qdrantPointID maps an arbitrary document ID to a stable UUID, since Qdrant
+// only accepts unsigned integers or UUIDs as point IDs
+func qdrantPointID(id string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(id)).String()
+}
@@ -0,0 +1,185 @@
+package memory
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Memory tiers. Global memory is shared by every chat; channel memory by the chats of one
+// channel, such as a work Slack; chat memory belongs to a single chat or user.
+const (
+	TierGlobal  = "global"
+	TierChannel = "channel"
+	TierChat    = "chat"
+)
+
+// Scope is one tier of memory for a chat, with its own MEMORY.md, HISTORY.md and facts
+type Scope struct {
+	Name string // "global", "channel:slack" or "chat:telegram:42"
+	Dir  string
+}
+
+// View is the memory one chat sees: the scopes it reads, most general first, and the one
+// new memories go to
+type View struct {
+	Read  []Scope
+	Write Scope
+}
+
+// Key identifies the view, for caching what is built from it
+func (v View) Key() string {
+	names := make([]string, 0, len(v.Read)+1)
+	for _, scope := range v.Read {
+		names = append(names, scope.Name)
+	}
+	return strings.Join(names, ",") + ">" + v.Write.Name
+}
+
+// unsafeScopeChars are replaced in directory names built from channel and chat IDs
+var unsafeScopeChars = regexp.MustCompile(`[^A-Za-z0-9._@-]`)
+
+// scopeDirName makes an ID safe to use as a directory name. IDs that need sanitizing get
+// a short hash suffix so different IDs don't share a directory.
+func scopeDirName(id string) string {
+	name := unsafeScopeChars.ReplaceAllString(id, "_")
+	if name != id || name == "." || name == ".." {
+		sum := sha1.Sum([]byte(id))
+		name = fmt.Sprintf("%s_%x", name, sum[:4])
+	}
+	return name
+}
+
+// Scopes resolves the memory scopes of chats and opens each scope's facts once, so chats
+// sharing a scope share its store
+type Scopes struct {
+	workspace string
+	facts     map[string]*FactStore
+	mutex     sync.Mutex
+}
+
+// NewScopes creates the scopes of a workspace. Global memory lives in workspace/memory,
+// the other tiers under workspace/memory/scopes.
+func NewScopes(workspace string) *Scopes {
+	return &Scopes{
+		workspace: workspace,
+		facts:     make(map[string]*FactStore),
+	}
+}
+
+// Global returns the global scope
+func (s *Scopes) Global() Scope {
+	return Scope{Name: TierGlobal, Dir: filepath.Join(s.workspace, "memory")}
+}
+
+// Scope returns the scope of a tier for a chat; unknown tiers are global
+func (s *Scopes) Scope(tier, channel, chatID string) Scope {
+	channelDir := filepath.Join(s.workspace, "memory", "scopes", scopeDirName(channel))
+	switch strings.ToLower(tier) {
+	case TierChannel:
+		return Scope{Name: "channel:" + channel, Dir: channelDir}
+	case TierChat:
+		return Scope{Name: "chat:" + channel + ":" + chatID, Dir: filepath.Join(channelDir, "chats", scopeDirName(chatID))}
+	default:
+		return s.Global()
+	}
+}
+
+// Parse returns the scope with a name as shown in Scope.Name: "global", "channel:slack"
+// or "chat:telegram:42"
+func (s *Scopes) Parse(name string) (Scope, error) {
+	tier, rest, _ := strings.Cut(name, ":")
+	switch strings.ToLower(tier) {
+	case TierGlobal:
+		if rest == "" {
+			return s.Global(), nil
+		}
+	case TierChannel:
+		if rest != "" && !strings.Contains(rest, ":") {
+			return s.Scope(TierChannel, rest, ""), nil
+		}
+	case TierChat:
+		if channel, chatID, ok := strings.Cut(rest, ":"); ok && channel != "" && chatID != "" {
+			return s.Scope(TierChat, channel, chatID), nil
+		}
+	}
+	return Scope{}, fmt.Errorf("invalid memory scope %q: use global, channel:<channel> or chat:<channel>:<chat id>", name)
+}
+
+// View returns what a chat reads and writes given the tiers allowed for its channel.
+// The written tier is always readable.
+func (s *Scopes) View(channel, chatID, write string, read []string) View {
+	view := View{Write: s.Scope(write, channel, chatID)}
+
+	// Most general first, so more specific memory comes later in the prompt
+	allowed := make(map[string]bool)
+	for _, tier := range read {
+		allowed[strings.ToLower(tier)] = true
+	}
+	allowed[strings.ToLower(write)] = true
+	for _, tier := range []string{TierGlobal, TierChannel, TierChat} {
+		if allowed[tier] {
+			view.Read = append(view.Read, s.Scope(tier, channel, chatID))
+		}
+	}
+	if len(view.Read) == 0 {
+		view.Read = []Scope{view.Write}
+	}
+	return view
+}
+
+// Existing returns the scopes that have a memory directory, global first. Scopes other
+// than global are named by their directory under memory/scopes, such as "slack/chats/42".
+func (s *Scopes) Existing() ([]Scope, error) {
+	scopes := []Scope{s.Global()}
+	scopesDir := filepath.Join(s.workspace, "memory", "scopes")
+
+	channels, err := os.ReadDir(scopesDir)
+	if os.IsNotExist(err) {
+		return scopes, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memory scopes: %w", err)
+	}
+	for _, channel := range channels {
+		if !channel.IsDir() {
+			continue
+		}
+		channelDir := filepath.Join(scopesDir, channel.Name())
+		scopes = append(scopes, Scope{Name: channel.Name(), Dir: channelDir})
+
+		chats, err := os.ReadDir(filepath.Join(channelDir, "chats"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to list memory scopes: %w", err)
+		}
+		for _, chat := range chats {
+			if chat.IsDir() {
+				scopes = append(scopes, Scope{
+					Name: channel.Name() + "/chats/" + chat.Name(),
+					Dir:  filepath.Join(channelDir, "chats", chat.Name()),
+				})
+			}
+		}
+	}
+	return scopes, nil
+}
+
+// Facts returns the fact store of a scope
+func (s *Scopes) Facts(scope Scope) (*FactStore, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if store, ok := s.facts[scope.Dir]; ok {
+		return store, nil
+	}
+	store, err := NewFactStoreAt(scope.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load facts of %s: %w", scope.Name, err)
+	}
+	s.facts[scope.Dir] = store
+	return store, nil
+}
@@ -1,102 +1,71 @@
 package memory
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
 	"math"
-	"sort"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"nanotalon/providers"
 )
 
-// SemanticMemoryStore extends the basic MemoryStore with semantic search capabilities
+// SemanticMemoryStore extends the basic MemoryStore with semantic search capabilities.
+// Chunks of MEMORY.md, HISTORY.md and its archives are embedded once and kept in an
+// on-disk index; each search only embeds the query and chunks that changed since the last one.
 type SemanticMemoryStore struct {
 	*MemoryStore
-	vectorizer Vectorizer
+	embeddings providers.EmbeddingsProvider
+	index      *MemoryIndex
+	mutex      sync.Mutex
 }
 
-// Vectorizer interface for converting text to vectors
-type Vectorizer interface {
-	Vectorize(text string) []float64
-}
+// minSimilarity filters out segments that are unrelated to the query
+const minSimilarity = 0.1
 
-// SimpleVectorizer is a basic vectorizer that creates TF-IDF-like vectors
-type SimpleVectorizer struct {
-	documents    []string
-	documentFreq map[string]int
-	vocabulary   map[string]int
-}
-
-// NewSemanticMemoryStore creates a new semantic memory store
-func NewSemanticMemoryStore(workspace string) *SemanticMemoryStore {
-	return &SemanticMemoryStore{
-		MemoryStore: NewMemoryStore(workspace),
-		vectorizer:  NewSimpleVectorizer(),
-	}
-}
+// maxEmbedBatch is the most texts sent in one embeddings request
+const maxEmbedBatch = 100
 
-// NewSimpleVectorizer creates a new simple vectorizer
-func NewSimpleVectorizer() *SimpleVectorizer {
-	return &SimpleVectorizer{
-		documents:    make([]string, 0),
-		documentFreq: make(map[string]int),
-		vocabulary:   make(map[string]int),
-	}
+// NewSemanticMemoryStore creates a new semantic memory store that ranks segments
+// by the embeddings of the given provider, indexed under workspace/memory/index
+func NewSemanticMemoryStore(workspace string, embeddings providers.EmbeddingsProvider) (*SemanticMemoryStore, error) {
+	return NewSemanticMemoryStoreAt(filepath.Join(workspace, "memory"), embeddings)
 }
 
-// Vectorize converts text to a vector representation
-func (sv *SimpleVectorizer) Vectorize(text string) []float64 {
-	words := sv.tokenize(text)
-	vector := make([]float64, len(sv.vocabulary))
-
-	// Calculate term frequencies
-	termFreq := make(map[string]int)
-	for _, word := range words {
-		termFreq[word]++
-	}
+// NewSemanticMemoryStoreAt creates a semantic memory store for a memory directory, such
+// as a scope's, indexed under its index subdirectory
+func NewSemanticMemoryStoreAt(memoryDir string, embeddings providers.EmbeddingsProvider) (*SemanticMemoryStore, error) {
+	store := NewMemoryStoreAt(memoryDir)
 
-	// Create vector with TF-IDF-like scores
-	for word, idx := range sv.vocabulary {
-		tf := float64(termFreq[word]) / float64(len(words)) // Term frequency
-		idf := 1.0 // In a full implementation, this would be calculated properly
-		if df, exists := sv.documentFreq[word]; exists {
-			if len(sv.documents) > df {
-				idf = math.Log(float64(len(sv.documents)) / float64(df))
-			}
-		}
-		vector[idx] = tf * idf
+	index, err := OpenMemoryIndex(filepath.Join(store.memoryDir, "index", "memory.db"), embeddings.GetModel())
+	if err != nil {
+		return nil, err
 	}
 
-	return vector
+	return &SemanticMemoryStore{
+		MemoryStore: store,
+		embeddings:  embeddings,
+		index:       index,
+	}, nil
 }
 
-// tokenize splits text into lowercase words
-func (sv *SimpleVectorizer) tokenize(text string) []string {
-	text = strings.ToLower(text)
-	text = strings.ReplaceAll(text, ".", " ")
-	text = strings.ReplaceAll(text, ",", " ")
-	text = strings.ReplaceAll(text, "!", " ")
-	text = strings.ReplaceAll(text, "?", " ")
-	text = strings.ReplaceAll(text, ";", " ")
-	text = strings.ReplaceAll(text, ":", " ")
-
-	words := strings.Fields(text)
-	return words
+// UseVectorStore searches the given vector store instead of scanning the index; see
+// MemoryIndex.UseVectorStore
+func (sms *SemanticMemoryStore) UseVectorStore(store VectorStore) error {
+	sms.mutex.Lock()
+	defer sms.mutex.Unlock()
+	return sms.index.UseVectorStore(store)
 }
 
-// AddDocument adds a document to the vectorizer
-func (sv *SimpleVectorizer) AddDocument(text string) {
-	sv.documents = append(sv.documents, text)
-	seen := make(map[string]bool)
-
-	words := sv.tokenize(text)
-	for _, word := range words {
-		if !seen[word] {
-			sv.documentFreq[word]++
-			seen[word] = true
-		}
-
-		if _, exists := sv.vocabulary[word]; !exists {
-			sv.vocabulary[word] = len(sv.vocabulary)
-		}
-	}
+// Close closes the index
+func (sms *SemanticMemoryStore) Close() error {
+	return sms.index.Close()
 }
 
 // cosineSimilarity calculates cosine similarity between two vectors
@@ -119,52 +88,330 @@ func cosineSimilarity(vec1, vec2 []float64) float64 {
 	return dotProduct / (math.Sqrt(norm1) * math.Sqrt(norm2))
 }
 
+// AppendHistory appends an entry to the history log and indexes it right away, so the
+// next search doesn't have to. Indexing failures are logged; the next search retries.
+func (sms *SemanticMemoryStore) AppendHistory(entry string) error {
+	if err := sms.MemoryStore.AppendHistory(entry); err != nil {
+		return err
+	}
+
+	sms.mutex.Lock()
+	defer sms.mutex.Unlock()
+
+	// The append may have rotated old entries into an archive, so archives are synced too
+	pending, err := sms.syncAll(sms.expandSources([]string{SourceHistory}))
+	if err == nil {
+		_, err = embedChunks(context.Background(), sms.embeddings, sms.index, "", pending)
+	}
+	if err != nil {
+		slog.Error("Error indexing history entry", "error", err)
+	}
+	return nil
+}
+
 // SearchMemory performs semantic search on the long-term memory
-func (sms *SemanticMemoryStore) SearchMemory(query string, limit int) ([]MemorySearchResult, error) {
-	longTerm, err := sms.MemoryStore.ReadLongTerm()
+func (sms *SemanticMemoryStore) SearchMemory(ctx context.Context, query string, limit int) ([]MemorySearchResult, error) {
+	return sms.Search(ctx, query, SearchFilter{Sources: []string{SourceMemory}}, limit)
+}
+
+// SearchHistory performs semantic search on the history log and its archives
+func (sms *SemanticMemoryStore) SearchHistory(ctx context.Context, query string, limit int) ([]MemorySearchResult, error) {
+	return sms.Search(ctx, query, SearchFilter{Sources: []string{SourceHistory}}, limit)
+}
+
+// Search brings the index up to date with the sources in the filter, then returns the
+// chunks closest to the query, best match first
+func (sms *SemanticMemoryStore) Search(ctx context.Context, query string, filter SearchFilter, limit int) ([]MemorySearchResult, error) {
+	sms.mutex.Lock()
+	defer sms.mutex.Unlock()
+
+	sources := filter.Sources
+	if len(sources) == 0 {
+		sources = []string{SourceMemory, SourceHistory}
+	}
+	filter.Sources = sms.expandSources(sources)
+
+	pending, err := sms.syncAll(filter.Sources)
+	if err != nil {
+		return nil, err
+	}
+
+	queryVector, err := embedChunks(ctx, sms.embeddings, sms.index, query, pending)
 	if err != nil {
 		return nil, err
 	}
 
-	if longTerm == "" {
-		return []MemorySearchResult{}, nil
+	matches, err := sms.index.Search(ctx, queryVector, filter, minSimilarity, limit)
+	if err != nil {
+		return nil, err
 	}
 
-	// For simplicity, treat the entire long-term memory as a single text
-	// In a more advanced implementation, we would break it into chunks
-	segments := sms.segmentText(longTerm)
+	return searchResults(matches), nil
+}
 
-	queryVector := sms.vectorizer.Vectorize(query)
-	results := make([]MemorySearchResult, 0)
+// searchResults converts index matches to search results
+func searchResults(matches []IndexMatch) []MemorySearchResult {
+	results := make([]MemorySearchResult, 0, len(matches))
+	for _, match := range matches {
+		results = append(results, MemorySearchResult{
+			Segment:    match.Chunk.Text,
+			Similarity: match.Score,
+			Index:      match.Chunk.Position,
+			Source:     match.Chunk.Source,
+			Date:       match.Chunk.Date,
+		})
+	}
+	return results
+}
 
-	for i, segment := range segments {
-		segmentVector := sms.vectorizer.Vectorize(segment)
-		similarity := cosineSimilarity(queryVector, segmentVector)
+// expandSources adds the history archives wherever the history log is searched. Archives
+// come before the log, so entries rotated out of it are indexed under their archive before
+// the log drops them. Archives that were deleted are removed from the index.
+func (sms *SemanticMemoryStore) expandSources(sources []string) []string {
+	months, err := sms.MemoryStore.HistoryArchives()
+	if err != nil {
+		slog.Error("Error listing history archives", "error", err)
+	}
 
-		if similarity > 0.1 { // Threshold to filter out low-similarity results
-			results = append(results, MemorySearchResult{
-				Segment:    segment,
-				Similarity: similarity,
-				Index:      i,
-			})
+	var expanded []string
+	searchesHistory := false
+	for _, source := range sources {
+		if source != SourceHistory {
+			expanded = append(expanded, source)
+			continue
 		}
+		searchesHistory = true
+		for _, month := range months {
+			expanded = append(expanded, HistoryArchiveSource(month))
+		}
+		expanded = append(expanded, SourceHistory)
 	}
 
-	// Sort results by similarity in descending order
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Similarity > results[j].Similarity
-	})
+	if searchesHistory && err == nil {
+		sms.removeDeletedArchives(months)
+	}
+	return expanded
+}
 
-	// Limit results
-	if limit > 0 && len(results) > limit {
-		results = results[:limit]
+// removeDeletedArchives drops archives that are no longer on disk from the index
+func (sms *SemanticMemoryStore) removeDeletedArchives(months []string) {
+	archives := make(map[string]bool)
+	for _, month := range months {
+		archives[HistoryArchiveSource(month)] = true
 	}
 
-	return results, nil
+	stamps, err := sms.index.Stamps()
+	if err != nil {
+		slog.Error("Error reading memory index", "error", err)
+		return
+	}
+	for source := range stamps {
+		if isHistorySource(source) && source != SourceHistory && !archives[source] {
+			if err := sms.index.RemoveSource(source); err != nil {
+				slog.Error("Error removing deleted history archive from index", "error", err)
+			}
+		}
+	}
+}
+
+// syncAll syncs each source in order and returns the chunks that need embedding.
+// The caller must hold the mutex.
+func (sms *SemanticMemoryStore) syncAll(sources []string) ([]IndexedChunk, error) {
+	var pending []IndexedChunk
+	for _, source := range sources {
+		chunks, err := sms.sync(source)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, chunks...)
+	}
+	return pending, nil
+}
+
+// sync reconciles the index with a source file: chunks that moved get their new position,
+// chunks that are gone are removed, chunks already embedded under another source reuse
+// that vector, and the remaining new chunks are returned for embedding. Archives, which
+// rarely change, are skipped while their size and modification time are unchanged.
+// The caller must hold the mutex.
+func (sms *SemanticMemoryStore) sync(source string) ([]IndexedChunk, error) {
+	var content, stamp string
+	var err error
+	switch {
+	case source == SourceMemory:
+		content, err = sms.MemoryStore.ReadLongTerm()
+	case source == SourceHistory:
+		content, err = sms.MemoryStore.ReadHistory()
+	case isHistorySource(source):
+		month := strings.TrimPrefix(source, SourceHistory+":")
+		info, statErr := os.Stat(sms.MemoryStore.historyArchiveFile(month))
+		if statErr != nil {
+			return nil, fmt.Errorf("failed to read history archive: %w", statErr)
+		}
+		stamp = fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+		stamps, stampErr := sms.index.Stamps()
+		if stampErr != nil {
+			return nil, stampErr
+		}
+		if stamps[source] == stamp {
+			return nil, nil
+		}
+		content, err = sms.MemoryStore.ReadHistoryArchive(month)
+	default:
+		return nil, fmt.Errorf("unknown memory source: %s", source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	indexed, err := sms.index.Positions(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []IndexedChunk
+	moved := make(map[string]int)
+	seen := make(map[string]bool)
+	var date time.Time
+	for i, segment := range segmentText(content) {
+		// Chunks split from a long history entry share its timestamp
+		if isHistorySource(source) {
+			if entryDate, ok := historyEntryDate(segment); ok {
+				date = entryDate
+			}
+		}
+
+		hash := chunkHash(segment)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		position, ok := indexed[hash]
+		switch {
+		case !ok:
+			pending = append(pending, IndexedChunk{Source: source, Hash: hash, Position: i, Date: date, Text: segment})
+		case position != i:
+			moved[hash] = i
+		}
+	}
+
+	var removed []string
+	for hash := range indexed {
+		if !seen[hash] {
+			removed = append(removed, hash)
+		}
+	}
+
+	if err := sms.index.Update(source, moved, removed); err != nil {
+		return nil, err
+	}
+
+	pending, err = sms.reuseVectors(pending)
+	if err != nil {
+		return nil, err
+	}
+
+	// An archive is only stamped once all of it is indexed, so chunks that fail to embed
+	// are retried by the next sync
+	if stamp != "" && len(pending) == 0 {
+		if err := sms.index.SetStamp(source, stamp); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+// reuseVectors indexes the chunks whose text is already embedded under another source,
+// such as history entries rotated into an archive, and returns the rest
+func (sms *SemanticMemoryStore) reuseVectors(pending []IndexedChunk) ([]IndexedChunk, error) {
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	hashes := make([]string, len(pending))
+	for i, chunk := range pending {
+		hashes[i] = chunk.Hash
+	}
+	vectors, err := sms.index.Vectors(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	var reused, remaining []IndexedChunk
+	for _, chunk := range pending {
+		if vector, ok := vectors[chunk.Hash]; ok {
+			chunk.Vector = vector
+			reused = append(reused, chunk)
+		} else {
+			remaining = append(remaining, chunk)
+		}
+	}
+	if len(reused) > 0 {
+		if err := sms.index.Add(reused); err != nil {
+			return nil, err
+		}
+	}
+	return remaining, nil
+}
+
+// embedChunks embeds the query together with the pending chunks, adds the chunks to the
+// index and returns the query's vector. An empty query only indexes the chunks.
+func embedChunks(ctx context.Context, embeddings providers.EmbeddingsProvider, index *MemoryIndex, query string, pending []IndexedChunk) ([]float64, error) {
+	texts := make([]string, 0, len(pending)+1)
+	for _, chunk := range pending {
+		texts = append(texts, chunk.Text)
+	}
+	if query != "" {
+		texts = append(texts, query)
+	}
+
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += maxEmbedBatch {
+		batch := texts[start:min(start+maxEmbedBatch, len(texts))]
+		batchVectors, err := embeddings.Embed(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed memory: %w", err)
+		}
+		if len(batchVectors) != len(batch) {
+			return nil, fmt.Errorf("embedding provider returned %d vectors for %d texts", len(batchVectors), len(batch))
+		}
+		vectors = append(vectors, batchVectors...)
+	}
+
+	for i := range pending {
+		pending[i].Vector = vectors[i]
+	}
+	if err := index.Add(pending); err != nil {
+		return nil, err
+	}
+
+	if query == "" {
+		return nil, nil
+	}
+	return vectors[len(vectors)-1], nil
+}
+
+// chunkHash identifies a chunk by its text
+func chunkHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// historyEntryDate parses the "[2006-01-02 15:04:05]" prefix AppendHistory writes
+func historyEntryDate(segment string) (time.Time, bool) {
+	const layout = "2006-01-02 15:04:05"
+	if len(segment) < len(layout)+2 || segment[0] != '[' || segment[len(layout)+1] != ']' {
+		return time.Time{}, false
+	}
+	date, err := time.ParseInLocation(layout, segment[1:len(layout)+1], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
 }
 
 // segmentText breaks the text into manageable segments
-func (sms *SemanticMemoryStore) segmentText(text string) []string {
+func segmentText(text string) []string {
 	const maxSegmentLength = 500
 	segments := make([]string, 0)
 
@@ -172,6 +419,11 @@ func (sms *SemanticMemoryStore) segmentText(text string) []string {
 	paragraphs := strings.Split(text, "\n\n")
 
 	for _, paragraph := range paragraphs {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
 		if len(paragraph) <= maxSegmentLength {
 			segments = append(segments, paragraph)
 		} else {
@@ -186,14 +438,14 @@ func (sms *SemanticMemoryStore) segmentText(text string) []string {
 					currentSegment += sentence
 				} else {
 					if currentSegment != "" {
-						segments = append(segments, currentSegment)
+						segments = append(segments, strings.TrimSpace(currentSegment))
 					}
 					currentSegment = sentence
 				}
 			}
 
 			if currentSegment != "" {
-				segments = append(segments, currentSegment)
+				segments = append(segments, strings.TrimSpace(currentSegment))
 			}
 		}
 	}
@@ -205,55 +457,7 @@ func (sms *SemanticMemoryStore) segmentText(text string) []string {
 type MemorySearchResult struct {
 	Segment    string
 	Similarity float64
-	Index      int
-}
-
-// SearchHistory performs semantic search on the history log
-func (sms *SemanticMemoryStore) SearchHistory(query string, limit int) ([]MemorySearchResult, error) {
-	// Read the history file
-	content, err := sms.readHistoryFile()
-	if err != nil {
-		return nil, err
-	}
-
-	if content == "" {
-		return []MemorySearchResult{}, nil
-	}
-
-	// Segment the history content
-	segments := sms.segmentText(content)
-	queryVector := sms.vectorizer.Vectorize(query)
-	results := make([]MemorySearchResult, 0)
-
-	for i, segment := range segments {
-		segmentVector := sms.vectorizer.Vectorize(segment)
-		similarity := cosineSimilarity(queryVector, segmentVector)
-
-		if similarity > 0.1 { // Threshold to filter out low-similarity results
-			results = append(results, MemorySearchResult{
-				Segment:    segment,
-				Similarity: similarity,
-				Index:      i,
-			})
-		}
-	}
-
-	// Sort results by similarity in descending order
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Similarity > results[j].Similarity
-	})
-
-	// Limit results
-	if limit > 0 && len(results) > limit {
-		results = results[:limit]
-	}
-
-	return results, nil
+	Index      int       // Position of the segment in its source
+	Source     string    // SourceMemory, SourceHistory, a history archive, or a knowledge base file
+	Date       time.Time // Zero when the segment has no timestamp
 }
-
-// readHistoryFile reads the history file content
-func (sms *SemanticMemoryStore) readHistoryFile() (string, error) {
-	// In a real implementation, this would read the actual history file
-	// For now, returning empty string to indicate no implementation
-	return "", nil
-}
\ No newline at end of file
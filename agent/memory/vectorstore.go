@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"nanotalon/config"
+)
+
+// VectorStore is an external backend a MemoryIndex can search instead of scanning its own
+// vectors. It only holds vectors with the source and date needed to filter them; chunk
+// text stays in the index. Several indexes can share one collection, each in its namespace.
+type VectorStore interface {
+	// Name identifies the backend and collection, so an index notices when it is moved
+	// to another one and sends its vectors again
+	Name() string
+
+	// Upsert inserts or replaces documents by ID
+	Upsert(ctx context.Context, docs []VectorDocument) error
+
+	// Query returns the documents matching the filter closest to the vector, best match first
+	Query(ctx context.Context, vector []float64, filter VectorFilter, limit int) ([]VectorMatch, error)
+
+	// Delete removes documents by ID
+	Delete(ctx context.Context, ids ...string) error
+
+	// DeleteNamespace removes every document of a namespace
+	DeleteNamespace(ctx context.Context, namespace string) error
+
+	// Close releases any resources held by the backend
+	Close() error
+}
+
+// VectorDocument is the embedding of a chunk with the fields searches filter on
+type VectorDocument struct {
+	ID        string
+	Namespace string
+	Source    string
+	Date      int64 // Unix milliseconds, or 0 when the chunk has none
+	Vector    []float64
+}
+
+// VectorFilter restricts a query to a namespace and, like SearchFilter, to some sources
+// and a date range
+type VectorFilter struct {
+	Namespace string
+	SearchFilter
+}
+
+// VectorMatch is a query result with its similarity score
+type VectorMatch struct {
+	ID    string
+	Score float64
+}
+
+// NewVectorStore creates the vector store backend selected in the config. The embedded
+// backend is the index's own scan, so it returns nil.
+func NewVectorStore(cfg config.VectorStoreConfig) (VectorStore, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case "", "embedded":
+		return nil, nil
+	case "qdrant":
+		return NewQdrantVectorStore(cfg.URL, cfg.APIKey, cfg.Collection, cfg.Dimensions)
+	case "pgvector":
+		return NewPgVectorStore(cfg.DSN, cfg.Collection, cfg.Dimensions)
+	default:
+		return nil, fmt.Errorf("unknown vector store backend: %s", cfg.Backend)
+	}
+}
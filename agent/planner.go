@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"nanotalon/logging"
+	"nanotalon/providers"
+)
+
+// Planning limits. Each step gets its own tool-loop budget so one step can't use up the
+// iterations the rest of the plan needs.
+const (
+	maxPlanSteps              = 8
+	defaultPlanStepIterations = 8
+)
+
+// planDataKey is the session data key holding the session's most recent plan
+const planDataKey = "plan"
+
+// Plan step statuses
+const (
+	stepPending    = "pending"
+	stepDone       = "done"
+	stepIncomplete = "incomplete"
+)
+
+// planPrompt asks the model for a step list before any work is done
+const planPrompt = `Before doing anything, draft a plan for the user's latest request.
+Reply with a numbered list of at most %d short steps, one per line, and nothing else.
+Each step should be a concrete piece of work, such as a search, reading a file or writing
+a section. A simple request needs only one step. Don't call any tools yet.`
+
+// plan is a step list drafted for a task, with the outcome of each step
+type plan struct {
+	Task      string     `json:"task"`
+	Steps     []planStep `json:"steps"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// planStep is one step of a plan
+type planStep struct {
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Result      string `json:"result,omitempty"`
+}
+
+// planLinePattern matches "1. step", "2) step", "- step" and "* step"
+var planLinePattern = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*])\s+(.+)$`)
+
+// isPlanCommand reports whether a chat message is a /plan command
+func isPlanCommand(message string) bool {
+	fields := strings.Fields(message)
+	return len(fields) > 0 && fields[0] == "/plan"
+}
+
+// planTask returns the task given to /plan, or "" for a bare /plan
+func planTask(message string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(message), "/plan"))
+}
+
+// runPlanned drafts a step list for the task, runs each step as its own tool loop and
+// then asks for the final answer. When show is set the plan heads the reply. Tasks the
+// model doesn't split into several steps run as a normal turn.
+func (al *AgentLoop) runPlanned(t *turn, task string, show bool) (string, error) {
+	p, err := al.draftPlan(t, task)
+	if err != nil {
+		return "", err
+	}
+	if t.budgetErr != nil {
+		return budgetReply("", t.budgetErr), nil
+	}
+	if len(p.Steps) < 2 {
+		return al.runToolLoop(t, al.maxIterations)
+	}
+	al.savePlan(t.sessionID, p)
+
+	stepIterations := al.config.Agents.Defaults.PlanStepIterations
+	if stepIterations <= 0 {
+		stepIterations = defaultPlanStepIterations
+	}
+
+	outline := formatPlanSteps(p)
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		budget := min(stepIterations, al.maxIterations-t.iterations)
+		if budget <= 0 || t.ctx.Err() != nil {
+			break
+		}
+		t.progress.stepStarted(i+1, len(p.Steps), step.Description)
+
+		t.messages = append(t.messages, providers.Message{
+			Role: "system",
+			Content: fmt.Sprintf("Plan:\n%s\n\nNow carry out step %d of %d: %s\n"+
+				"Use tools as needed. When this step is done, reply with a brief summary of what you found or did, "+
+				"without starting the next step.", outline, i+1, len(p.Steps), step.Description),
+		})
+		result, err := al.runToolLoop(t, budget)
+		if err != nil {
+			return "", err
+		}
+		if t.halted() {
+			return result, nil
+		}
+
+		step.Status, step.Result = stepDone, result
+		if result == "" {
+			step.Status, step.Result = stepIncomplete, t.partialContent
+		}
+		if step.Result != "" {
+			t.messages = append(t.messages, providers.Message{Role: "assistant", Content: step.Result})
+		}
+		al.savePlan(t.sessionID, p)
+	}
+	if t.ctx.Err() != nil {
+		return "", nil
+	}
+
+	// The answer gets whatever budget is left, but always at least one model call
+	t.messages = append(t.messages, providers.Message{
+		Role: "system",
+		Content: "The plan has been carried out. Write the final answer to the user's request from the step results above. " +
+			"Mention any step that couldn't be completed.",
+	})
+	answer, err := al.runToolLoop(t, max(1, min(stepIterations, al.maxIterations-t.iterations)))
+	if err != nil || answer == "" || !show {
+		return answer, err
+	}
+	return formatPlan(p) + "\n\n" + answer, nil
+}
+
+// draftPlan asks the model for a step list without offering it any tools
+func (al *AgentLoop) draftPlan(t *turn, task string) (*plan, error) {
+	t.progress.working()
+
+	messages := append(append([]providers.Message(nil), t.messages...), providers.Message{
+		Role:    "system",
+		Content: fmt.Sprintf(planPrompt, maxPlanSteps),
+	})
+	response, err := al.chat(t, providers.ChatRequest{
+		Messages:    messages,
+		Model:       t.model,
+		Temperature: t.temperature,
+		MaxTokens:   al.maxTokens,
+	})
+	if err != nil {
+		var budgetErr *budgetExceededError
+		if errors.As(err, &budgetErr) {
+			t.budgetErr = err
+			return &plan{Task: task}, nil
+		}
+		if t.ctx.Err() != nil {
+			return &plan{Task: task}, nil
+		}
+		return nil, fmt.Errorf("error drafting plan: %w", err)
+	}
+
+	p := &plan{Task: task, CreatedAt: time.Now()}
+	for _, description := range parsePlanSteps(response.Content) {
+		p.Steps = append(p.Steps, planStep{Description: description, Status: stepPending})
+	}
+	slog.InfoContext(t.ctx, "Planned task", "steps", len(p.Steps))
+	return p, nil
+}
+
+// parsePlanSteps extracts list items from the model's plan, keeping at most maxPlanSteps
+func parsePlanSteps(content string) []string {
+	var steps []string
+	for _, line := range strings.Split(content, "\n") {
+		match := planLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if step := strings.TrimSpace(match[1]); step != "" {
+			steps = append(steps, step)
+		}
+		if len(steps) == maxPlanSteps {
+			break
+		}
+	}
+	return steps
+}
+
+// savePlan stores a plan as the session's latest, logging rather than failing on error
+func (al *AgentLoop) savePlan(sessionID string, p *plan) {
+	if err := al.sessionManager.UpdateSessionData(sessionID, map[string]interface{}{planDataKey: p}); err != nil {
+		slog.Warn("Could not save plan", logging.SessionKey, sessionID, "error", err)
+	}
+}
+
+// loadPlan reads the session's latest plan. Data loaded from disk holds generic JSON
+// values, so it is re-encoded into a plan.
+func (al *AgentLoop) loadPlan(sessionID string) *plan {
+	data, err := al.sessionManager.GetData(sessionID)
+	if err != nil || data[planDataKey] == nil {
+		return nil
+	}
+	if p, ok := data[planDataKey].(*plan); ok {
+		return p
+	}
+
+	raw, err := json.Marshal(data[planDataKey])
+	if err != nil {
+		return nil
+	}
+	var p plan
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil
+	}
+	return &p
+}
+
+// describePlan answers a bare /plan with the session's latest plan
+func (al *AgentLoop) describePlan(sessionID string) string {
+	p := al.loadPlan(sessionID)
+	if p == nil {
+		return "No plan yet. Send /plan <task> to plan and carry out a multi-step task."
+	}
+	return fmt.Sprintf("Task: %s\n\n%s", p.Task, formatPlan(p))
+}
+
+// formatPlan renders a plan as a checklist
+func formatPlan(p *plan) string {
+	var sb strings.Builder
+	sb.WriteString("Plan:")
+	for i, step := range p.Steps {
+		mark := "[ ]"
+		switch step.Status {
+		case stepDone:
+			mark = "[x]"
+		case stepIncomplete:
+			mark = "[!]"
+		}
+		fmt.Fprintf(&sb, "\n%s %d. %s", mark, i+1, step.Description)
+	}
+	return sb.String()
+}
+
+// formatPlanSteps renders the plan's steps as a numbered list for the model
+func formatPlanSteps(p *plan) string {
+	lines := make([]string, len(p.Steps))
+	for i, step := range p.Steps {
+		lines[i] = fmt.Sprintf("%d. %s", i+1, step.Description)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"nanotalon/bus"
+	"nanotalon/logging"
+	"nanotalon/providers"
+)
+
+// Throttling for messages sent while a turn is in progress. Typing indicators expire
+// after about five seconds on most platforms, so they are refreshed a little sooner.
+const (
+	progressInterval = 10 * time.Second
+	typingInterval   = 4 * time.Second
+	toolHintMaxChars = 80
+)
+
+// toolNotices are the friendly progress notices shown for each tool
+var toolNotices = map[string]string{
+	"web_search":          "Searching the web…",
+	"web_search_advanced": "Searching the web…",
+	"web_fetch":           "Reading a web page…",
+	"execute_command":     "Running a command…",
+	"run_code":            "Running code…",
+	"read_file":           "Reading files…",
+	"list_directory":      "Looking through files…",
+	"write_file":          "Writing a file…",
+	"edit_file":           "Editing a file…",
+	"weather":             "Checking the weather…",
+	"cron":                "Updating scheduled tasks…",
+	"process_list":        "Checking on background processes…",
+	"process_logs":        "Checking on a background process…",
+	"process_kill":        "Stopping a background process…",
+}
+
+// progressReporter publishes throttled progress notices and typing indicators to the
+// chat a turn came from, honoring channels.send_progress, channels.send_tool_hints and
+// channels.send_typing. A nil reporter does nothing, which is what turns without a chat
+// (cron, CLI) use.
+type progressReporter struct {
+	messageBus    *bus.MessageBus
+	channel       string
+	chatID        string
+	sendProgress  bool
+	sendToolHints bool
+	sendTyping    bool
+
+	mu           sync.Mutex
+	lastNotice   string
+	lastNoticeAt time.Time
+	lastTypingAt time.Time
+}
+
+// newProgressReporter returns a reporter for a chat, or nil if nothing should be sent
+func (al *AgentLoop) newProgressReporter(channel, chatID string) *progressReporter {
+	sendProgress := al.config.Channels.SendProgress
+	sendToolHints := al.config.Channels.SendToolHints
+	sendTyping := al.config.Channels.SendTyping
+	if al.messageBus == nil || (!sendProgress && !sendToolHints && !sendTyping) || channel == "" || chatID == "" {
+		return nil
+	}
+
+	return &progressReporter{
+		messageBus:    al.messageBus,
+		channel:       channel,
+		chatID:        chatID,
+		sendProgress:  sendProgress,
+		sendToolHints: sendToolHints,
+		sendTyping:    sendTyping,
+	}
+}
+
+// working refreshes the typing indicator while the model or tools are busy
+func (p *progressReporter) working() {
+	if p == nil || !p.sendTyping {
+		return
+	}
+
+	p.mu.Lock()
+	if time.Since(p.lastTypingAt) < typingInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastTypingAt = time.Now()
+	p.mu.Unlock()
+
+	p.publish(bus.KindTyping, "")
+}
+
+// toolStarted announces a tool call. Tool hints name the tool and its main argument;
+// otherwise a friendly notice is sent. Repeats and bursts are suppressed.
+func (p *progressReporter) toolStarted(tc providers.ToolCall) {
+	if p == nil || (!p.sendProgress && !p.sendToolHints) {
+		return
+	}
+
+	notice := toolNotice(tc.Name)
+	if p.sendToolHints {
+		notice = toolHint(tc)
+	}
+	p.notice(notice)
+}
+
+// toolProgress passes on what a running tool reports about its progress, such as the
+// progress notifications of MCP servers
+func (p *progressReporter) toolProgress(tc providers.ToolCall, message string) {
+	if p == nil || (!p.sendProgress && !p.sendToolHints) {
+		return
+	}
+
+	if p.sendToolHints {
+		message = fmt.Sprintf("🔧 %s: %s", tc.Name, message)
+	}
+	p.notice(message)
+}
+
+// notice publishes a progress notice, suppressing repeats and bursts
+func (p *progressReporter) notice(notice string) {
+	p.mu.Lock()
+	if notice == p.lastNotice || time.Since(p.lastNoticeAt) < progressInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastNotice = notice
+	p.lastNoticeAt = time.Now()
+	p.mu.Unlock()
+
+	p.publish(bus.KindProgress, notice)
+}
+
+// stepStarted announces the plan step a planned turn is working on
+func (p *progressReporter) stepStarted(n, total int, description string) {
+	if p == nil || !p.sendProgress {
+		return
+	}
+	p.publish(bus.KindProgress, fmt.Sprintf("Step %d/%d: %s", n, total, description))
+}
+
+// publish sends a progress message to the originating chat
+func (p *progressReporter) publish(kind, content string) {
+	err := p.messageBus.PublishOutbound(bus.OutboundMessage{
+		Channel:  p.channel,
+		ChatID:   p.chatID,
+		Content:  content,
+		Metadata: map[string]interface{}{bus.MetadataKind: kind},
+	})
+	if err != nil {
+		slog.Warn("Could not publish update", "kind", kind, logging.ChannelKey, p.channel, "chat", p.chatID, "error", err)
+	}
+}
+
+// markRead sends a read receipt for an inbound message when channels.send_read_receipts
+// is on and the channel gave the message an ID
+func (al *AgentLoop) markRead(msg bus.InboundMessage) {
+	messageID, ok := msg.Metadata[bus.MetadataMessageID]
+	if al.messageBus == nil || !al.config.Channels.SendReadReceipts || !ok {
+		return
+	}
+
+	err := al.messageBus.PublishOutbound(bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Metadata: map[string]interface{}{
+			bus.MetadataKind:      bus.KindRead,
+			bus.MetadataMessageID: fmt.Sprint(messageID),
+		},
+	})
+	if err != nil {
+		slog.Warn("Could not publish read receipt", logging.ChannelKey, msg.Channel, "chat", msg.ChatID, "error", err)
+	}
+}
+
+// toolNotice returns the friendly notice for a tool
+func toolNotice(name string) string {
+	if notice, ok := toolNotices[name]; ok {
+		return notice
+	}
+	return "Working on it…"
+}
+
+// toolHint describes a tool call by name and its most telling argument
+func toolHint(tc providers.ToolCall) string {
+	var detail string
+	for _, key := range []string{"query", "command", "url", "path", "location", "code"} {
+		if value, ok := tc.Args[key].(string); ok && value != "" {
+			detail = value
+			break
+		}
+	}
+	if detail == "" && len(tc.Args) > 0 {
+		args, _ := json.Marshal(tc.Args)
+		detail = string(args)
+	}
+
+	if runes := []rune(detail); len(runes) > toolHintMaxChars {
+		detail = string(runes[:toolHintMaxChars]) + "…"
+	}
+	if detail == "" {
+		return fmt.Sprintf("🔧 %s", tc.Name)
+	}
+	return fmt.Sprintf("🔧 %s: %s", tc.Name, detail)
+}
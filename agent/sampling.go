@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"log/slog"
+	"nanotalon/agent/mcp"
+	"nanotalon/config"
+	"nanotalon/providers"
+	"nanotalon/session"
+)
+
+// mcpSampling returns the handler answering an MCP server's sampling requests with the
+// agent's provider. Completions are capped at the configured number of tokens and count
+// toward the daily token budget.
+func (al *AgentLoop) mcpSampling(serverName string, cfg config.MCPSamplingConfig) mcp.SamplingHandler {
+	return func(ctx context.Context, req *mcp.SamplingRequest) (*mcp.SamplingResult, error) {
+		model := cfg.Model
+		if model == "" {
+			model = al.model
+		}
+		limit := cfg.MaxTokens
+		if limit <= 0 {
+			limit = al.maxTokens
+		}
+		maxTokens := req.MaxTokens
+		if maxTokens <= 0 || maxTokens > limit {
+			maxTokens = limit
+		}
+		temperature := al.defaultTemperature()
+		if req.Temperature != nil {
+			temperature = *req.Temperature
+		}
+
+		chatReq := providers.ChatRequest{Model: model, MaxTokens: maxTokens, Temperature: temperature}
+		if req.SystemPrompt != "" {
+			chatReq.Messages = append(chatReq.Messages, providers.Message{Role: "system", Content: req.SystemPrompt})
+		}
+		for _, msg := range req.Messages {
+			if msg.Role != "user" && msg.Role != "assistant" {
+				return nil, fmt.Errorf("unsupported message role %q", msg.Role)
+			}
+			content := msg.Content.Text
+			if msg.Content.Type != "text" {
+				content = fmt.Sprintf("[%s content omitted]", msg.Content.Type)
+			}
+			chatReq.Messages = append(chatReq.Messages, providers.Message{Role: msg.Role, Content: content})
+		}
+
+		estimate := estimateRequestTokens(chatReq) + maxTokens
+		if err := al.tokenBudget.check(0, estimate); err != nil {
+			return nil, err
+		}
+		provider, err := al.providerFor(model)
+		if err != nil {
+			return nil, err
+		}
+		response, err := provider.Chat(ctx, chatReq)
+		if err != nil {
+			return nil, fmt.Errorf("model request failed: %w", err)
+		}
+
+		used := response.Usage.TotalTokens
+		if used == 0 {
+			used = estimateRequestTokens(chatReq) + session.EstimateTokens(response.Content)
+		}
+		al.tokenBudget.record(used)
+		slog.Info("MCP server sampled the model", "server", serverName, "model", model, "tokens", used)
+
+		return &mcp.SamplingResult{
+			Role:       "assistant",
+			Content:    mcp.ContentBlock{Type: "text", Text: response.Content},
+			Model:      model,
+			StopReason: "endTurn",
+		}, nil
+	}
+}
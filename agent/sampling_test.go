@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"nanotalon/agent/mcp"
+	"nanotalon/clock"
+	"nanotalon/config"
+	"nanotalon/providers"
+)
+
+func TestMCPSampling(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{{Content: "A summary.", Usage: providers.Usage{TotalTokens: 50}}}}
+	al := newTestAgentLoop(t, provider)
+	al.maxTokens = 4096
+	sample := al.mcpSampling("docs", config.MCPSamplingConfig{Enabled: true, MaxTokens: 200})
+
+	result, err := sample(context.Background(), &mcp.SamplingRequest{
+		SystemPrompt: "Summarize.",
+		Messages:     []mcp.SamplingMessage{{Role: "user", Content: mcp.ContentBlock{Type: "text", Text: "Long text"}}},
+		MaxTokens:    1000,
+	})
+	if err != nil {
+		t.Fatalf("Sampling failed: %v", err)
+	}
+	if result.Content.Text != "A summary." || result.Model != "test/echo" || result.Role != "assistant" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	req := provider.requests[0]
+	if req.MaxTokens != 200 {
+		t.Errorf("Expected the completion to be capped at 200 tokens, got %d", req.MaxTokens)
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[1].Content != "Long text" {
+		t.Errorf("Unexpected messages %+v", req.Messages)
+	}
+}
+
+func TestMCPSamplingRespectsDailyBudget(t *testing.T) {
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{{Content: "unused"}}}
+	al := newTestAgentLoop(t, provider)
+	al.tokenBudget = newTokenBudget(0, 100, filepath.Join(al.workspace, "usage.json"), clock.New())
+	sample := al.mcpSampling("docs", config.MCPSamplingConfig{Enabled: true, MaxTokens: 500})
+
+	_, err := sample(context.Background(), &mcp.SamplingRequest{
+		Messages: []mcp.SamplingMessage{{Role: "user", Content: mcp.ContentBlock{Type: "text", Text: "hi"}}},
+	})
+	if err == nil || len(provider.requests) != 0 {
+		t.Errorf("Expected the request to be refused over the daily budget, got %v after %d calls", err, len(provider.requests))
+	}
+}
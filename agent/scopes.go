@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"log/slog"
+	"strings"
+
+	"nanotalon/agent/memory"
+	"nanotalon/agent/tools"
+)
+
+// memoryView returns the memory a chat reads and writes, from memory.scopes and any
+// override for its channel
+func (al *AgentLoop) memoryView(channel, chatID string) memory.View {
+	scopes := al.config.Memory.Scopes
+	write, read := scopes.Write, scopes.Read
+	if policy, ok := scopes.Channels[strings.ToLower(channel)]; ok {
+		if policy.Write != "" {
+			write = policy.Write
+		}
+		if len(policy.Read) > 0 {
+			read = policy.Read
+		}
+	}
+	return al.scopes().View(channel, chatID, write, read)
+}
+
+// scopeCronTool replaces the cron tool a turn may use with one that delivers to its chat
+func scopeCronTool(toolRegistry *tools.ToolRegistry, channel, chatID string) {
+	if cronTool, ok := toolRegistry.Get("cron").(*tools.CronTool); ok {
+		toolRegistry.Register(cronTool.ForChat(channel, chatID))
+	}
+}
+
+// scopes returns the memory scopes of the workspace, created on first use
+func (al *AgentLoop) scopes() *memory.Scopes {
+	al.scopesOnce.Do(func() {
+		if al.memoryScopes == nil {
+			al.memoryScopes = memory.NewScopes(al.workspace)
+		}
+	})
+	return al.memoryScopes
+}
+
+// scopeFactTools replaces the fact tools a turn may use with ones bound to its memory view:
+// facts are asserted in the write scope and queried and retracted across the read scopes
+func (al *AgentLoop) scopeFactTools(toolRegistry *tools.ToolRegistry, view memory.View) {
+	var readStores []*memory.FactStore
+	for _, scope := range view.Read {
+		store, err := al.scopes().Facts(scope)
+		if err != nil {
+			slog.Warn("Could not open fact store", "error", err)
+			continue
+		}
+		readStores = append(readStores, store)
+	}
+	writeStore, err := al.scopes().Facts(view.Write)
+	if err != nil {
+		slog.Warn("Could not open fact store", "error", err)
+	}
+
+	if toolRegistry.Get("fact_assert") != nil {
+		if writeStore != nil {
+			toolRegistry.Register(tools.NewFactAssertTool(writeStore))
+		} else {
+			toolRegistry.Unregister("fact_assert")
+		}
+	}
+	if toolRegistry.Get("fact_query") != nil {
+		toolRegistry.Register(tools.NewFactQueryTool(readStores...))
+	}
+	if toolRegistry.Get("fact_retract") != nil {
+		toolRegistry.Register(tools.NewFactRetractTool(readStores...))
+	}
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"sync"
+)
+
+// sessionLocks serializes turns for the same session while different sessions run in
+// parallel. Waiters queue on a one-slot channel, which the runtime serves in arrival
+// order, and a session's entry is dropped once nobody holds or waits for it.
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+// sessionLock is the queue for one session key
+type sessionLock struct {
+	slot chan struct{}
+	refs int
+}
+
+// lock blocks until the caller holds the session's turn and returns the function releasing it
+func (l *sessionLocks) lock(sessionKey string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sessionLock)
+	}
+	sl, ok := l.locks[sessionKey]
+	if !ok {
+		sl = &sessionLock{slot: make(chan struct{}, 1)}
+		l.locks[sessionKey] = sl
+	}
+	sl.refs++
+	l.mu.Unlock()
+
+	sl.slot <- struct{}{}
+
+	return func() {
+		<-sl.slot
+
+		l.mu.Lock()
+		sl.refs--
+		if sl.refs == 0 {
+			delete(l.locks, sessionKey)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSessionLocksSerializeSameSession(t *testing.T) {
+	var locks sessionLocks
+	var active, maxActive int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.lock("telegram:1")
+			defer unlock()
+
+			n := atomic.AddInt32(&active, 1)
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+		}()
+	}
+	wg.Wait()
+
+	if maxActive != 1 {
+		t.Errorf("Expected turns for one session to run one at a time, saw %d at once", maxActive)
+	}
+	if len(locks.locks) != 0 {
+		t.Errorf("Expected idle session locks to be released, %d remain", len(locks.locks))
+	}
+}
+
+func TestSessionLocksParallelAcrossSessions(t *testing.T) {
+	var locks sessionLocks
+	unlock := locks.lock("telegram:1")
+	defer unlock()
+
+	done := make(chan struct{})
+	go func() {
+		locks.lock("telegram:2")()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("A different session was blocked by an unrelated turn")
+	}
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"nanotalon/providers"
+	"nanotalon/session"
+)
+
+// settingsUsage describes the /settings chat command
+const settingsUsage = `Usage:
+/settings - show this chat's settings
+/settings model <name> - use a different model in this chat
+/settings temperature <0-2> - change sampling temperature
+/settings persona <text> - extra instructions added to the system prompt
+/settings reset [model|temperature|persona] - go back to the defaults`
+
+// isSettingsCommand reports whether a chat message is a /settings command
+func isSettingsCommand(message string) bool {
+	fields := strings.Fields(message)
+	return len(fields) > 0 && fields[0] == "/settings"
+}
+
+// handleSettingsCommand shows or changes the per-session settings and returns the reply
+func (al *AgentLoop) handleSettingsCommand(sessionID, message string) string {
+	args := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(message), "/settings"))
+	if args == "" {
+		return al.describeSettings(sessionID)
+	}
+
+	name, value, _ := strings.Cut(args, " ")
+	name = strings.ToLower(name)
+
+	if name == "help" {
+		return settingsUsage
+	}
+
+	// The session may not exist yet if the first message in a chat is a command
+	al.sessionManager.GetOrCreateSession(sessionID)
+
+	if name == "reset" {
+		keys := session.SettingKeys
+		if value = strings.TrimSpace(value); value != "" {
+			key, ok := session.SettingKey(value)
+			if !ok {
+				return fmt.Sprintf("Unknown setting %q.\n\n%s", value, settingsUsage)
+			}
+			keys = []string{key}
+		}
+
+		update := make(map[string]interface{})
+		for _, key := range keys {
+			update[key] = nil
+		}
+		if err := al.sessionManager.UpdateSessionData(sessionID, update); err != nil {
+			return fmt.Sprintf("Could not reset settings: %v", err)
+		}
+		return "Settings reset.\n\n" + al.describeSettings(sessionID)
+	}
+
+	key, parsed, err := session.ParseSetting(name, value)
+	if err != nil {
+		return fmt.Sprintf("%v\n\n%s", err, settingsUsage)
+	}
+	if key == session.DataKeyModel {
+		if _, err := al.providerFor(parsed.(string)); err != nil {
+			return fmt.Sprintf("Can't use model %s: %v", parsed, err)
+		}
+	}
+
+	if err := al.sessionManager.UpdateSessionData(sessionID, map[string]interface{}{key: parsed}); err != nil {
+		return fmt.Sprintf("Could not save setting: %v", err)
+	}
+	return fmt.Sprintf("Updated %s.\n\n%s", key, al.describeSettings(sessionID))
+}
+
+// describeSettings lists the effective settings of a session, marking overrides
+func (al *AgentLoop) describeSettings(sessionID string) string {
+	settings, _ := al.sessionManager.GetSettings(sessionID)
+
+	model, modelSource := al.model, "default"
+	if settings.Model != "" {
+		model, modelSource = settings.Model, "this chat"
+	}
+	temperature, temperatureSource := al.defaultTemperature(), "default"
+	if settings.Temperature != nil {
+		temperature, temperatureSource = *settings.Temperature, "this chat"
+	}
+	persona := "(none)"
+	if settings.SystemPromptExtra != "" {
+		persona = settings.SystemPromptExtra
+	}
+
+	return fmt.Sprintf("Model: %s (%s)\nTemperature: %.2g (%s)\nPersona: %s",
+		model, modelSource, temperature, temperatureSource, persona)
+}
+
+// providerFor returns the provider serving model, creating and caching one for
+// models other than the configured default
+func (al *AgentLoop) providerFor(model string) (providers.LLMProvider, error) {
+	if model == "" || model == al.model {
+		return al.provider, nil
+	}
+
+	al.providersMu.Lock()
+	defer al.providersMu.Unlock()
+
+	if provider, ok := al.modelProviders[model]; ok {
+		return provider, nil
+	}
+
+	cfg := *al.config
+	cfg.Agents.Defaults.Model = model
+	provider, err := providers.ProviderFactory(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if al.modelProviders == nil {
+		al.modelProviders = make(map[string]providers.LLMProvider)
+	}
+	al.modelProviders[model] = provider
+	return provider, nil
+}
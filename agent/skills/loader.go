@@ -45,6 +45,11 @@ func NewSkillsLoader(workspace string, builtinSkillsDir string) *SkillsLoader {
 	}
 }
 
+// Dirs returns the directories skills are loaded from, workspace skills first
+func (sl *SkillsLoader) Dirs() []string {
+	return []string{sl.workspaceSkills, sl.builtinSkills}
+}
+
 // ListSkills lists all available skills
 func (sl *SkillsLoader) ListSkills(filterUnavailable bool) ([]Skill, error) {
 	var skills []Skill
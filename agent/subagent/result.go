@@ -0,0 +1,175 @@
+package subagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TaskResult is what a finished subagent reports, kept as
+// <workspace>/subagents/<id>/result.json so its outputs can be reviewed later
+type TaskResult struct {
+	TaskID     string      `json:"task_id"`
+	Label      string      `json:"label"`
+	Status     TaskStatus  `json:"status"`
+	Summary    string      `json:"summary"`
+	Artifacts  []string    `json:"artifacts,omitempty"` // Files the subagent produced, relative to the workspace when inside it
+	Metrics    TaskMetrics `json:"metrics"`
+	FinishedAt time.Time   `json:"finished_at"`
+}
+
+// TaskMetrics measures the work a subagent did
+type TaskMetrics struct {
+	Iterations int   `json:"iterations"`  // Model calls
+	ToolCalls  int   `json:"tool_calls"`  // Tools executed
+	Tokens     int   `json:"tokens"`      // As reported by the provider; zero when it doesn't
+	DurationMS int64 `json:"duration_ms"` // From the start of the run to its end
+}
+
+// ResultDir returns where a workspace keeps the result of a subagent task
+func ResultDir(workspace, taskID string) string {
+	return filepath.Join(workspace, "subagents", taskID)
+}
+
+// resultPath returns the file a task's result is written to
+func resultPath(workspace, taskID string) string {
+	return filepath.Join(ResultDir(workspace, taskID), "result.json")
+}
+
+// LoadResult reads the result a subagent task left in the workspace
+func LoadResult(workspace, taskID string) (*TaskResult, error) {
+	data, err := os.ReadFile(resultPath(workspace, taskID))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("subagent %s has no result", taskID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read result of subagent %s: %w", taskID, err)
+	}
+
+	var result TaskResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse result of subagent %s: %w", taskID, err)
+	}
+	return &result, nil
+}
+
+// writeResult writes a task's result to its directory in the workspace. Failures are
+// logged; the result is still recorded with the task and announced.
+func (sm *SubagentManager) writeResult(result *TaskResult) {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(ResultDir(sm.workspace, result.TaskID), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(resultPath(sm.workspace, result.TaskID), data, 0644)
+	}
+	if err != nil {
+		slog.Warn("Subagent could not write its result", "subagent", result.TaskID, "error", err)
+	}
+}
+
+// artifactPath resolves a path the subagent gave against the workspace, returning it
+// relative to the workspace when it's inside it
+func artifactPath(workspace, path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workspace, path)
+	}
+	path = filepath.Clean(path)
+	if rel, err := filepath.Rel(workspace, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rel
+	}
+	return path
+}
+
+// addArtifact records a file the subagent produced, once
+func (r *TaskResult) addArtifact(path string) {
+	for _, artifact := range r.Artifacts {
+		if artifact == path {
+			return
+		}
+	}
+	r.Artifacts = append(r.Artifacts, path)
+}
+
+// ReportTool implements the tool a subagent finishes with, reporting its summary and the
+// files it produced
+type ReportTool struct {
+	workspace string
+	result    *TaskResult
+	reported  bool
+}
+
+// NewReportTool creates a report tool that fills in result
+func NewReportTool(workspace string, result *TaskResult) *ReportTool {
+	return &ReportTool{workspace: workspace, result: result}
+}
+
+// Name returns the name of the tool
+func (t *ReportTool) Name() string {
+	return "report_result"
+}
+
+// Description returns the description of the tool
+func (t *ReportTool) Description() string {
+	return "Finish the task, reporting a summary of the outcome and the files you produced for the main agent to review"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ReportTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"summary": map[string]interface{}{"type": "string", "description": "What was found or done"},
+			"artifacts": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Paths of the files produced, relative to the workspace",
+			},
+		},
+		"required": []string{"summary"},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *ReportTool) Call(args map[string]interface{}) (string, error) {
+	summary, ok := args["summary"].(string)
+	if !ok || strings.TrimSpace(summary) == "" {
+		return "", fmt.Errorf("missing 'summary' argument")
+	}
+
+	var paths []string
+	if list, ok := args["artifacts"].([]interface{}); ok {
+		var missing []string
+		for _, item := range list {
+			path, ok := item.(string)
+			if !ok || path == "" {
+				continue
+			}
+			path = artifactPath(t.workspace, path)
+			resolved := path
+			if !filepath.IsAbs(resolved) {
+				resolved = filepath.Join(t.workspace, resolved)
+			}
+			if _, err := os.Stat(resolved); err != nil {
+				missing = append(missing, path)
+				continue
+			}
+			paths = append(paths, path)
+		}
+		// Let the subagent correct itself rather than reporting files that aren't there
+		if len(missing) > 0 {
+			return fmt.Sprintf("Not reported: %s doesn't exist. Report again with the paths of files you wrote.", strings.Join(missing, ", ")), nil
+		}
+	}
+
+	t.result.Summary = strings.TrimSpace(summary)
+	for _, path := range paths {
+		t.result.addArtifact(path)
+	}
+	t.reported = true
+	return "Result reported.", nil
+}
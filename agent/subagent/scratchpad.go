@@ -0,0 +1,226 @@
+package subagent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"nanotalon/clock"
+)
+
+// defaultScratchpadEntries is how many of the latest entries scratchpad_read returns
+const defaultScratchpadEntries = 20
+
+// ScratchpadPath returns where a workspace keeps the scratchpad shared by the main
+// agent and its subagents
+func ScratchpadPath(workspace string) string {
+	return filepath.Join(workspace, "subagents", "scratchpad.jsonl")
+}
+
+// ScratchpadEntry is a note one agent left for the others
+type ScratchpadEntry struct {
+	Time    time.Time `json:"time"`
+	Author  string    `json:"author"`        // "main", or the subagent's label and short ID
+	Key     string    `json:"key,omitempty"` // Groups related notes, such as "numbers" or "draft"
+	Content string    `json:"content"`
+}
+
+// Scratchpad is an append-only log of notes the main agent and its subagents share, so
+// cooperating tasks can pass data along. Entries are never changed or removed, and each
+// records who wrote it; a later entry under the same key supersedes earlier ones.
+type Scratchpad struct {
+	path  string
+	clock clock.Clock
+	mu    sync.Mutex // Serializes appends from concurrent agents
+}
+
+// NewScratchpad creates a scratchpad kept at path
+func NewScratchpad(path string, clk clock.Clock) *Scratchpad {
+	return &Scratchpad{path: path, clock: clk}
+}
+
+// Append adds a note by author under key, which may be empty
+func (s *Scratchpad) Append(author, key, content string) (ScratchpadEntry, error) {
+	entry := ScratchpadEntry{Time: s.clock.Now(), Author: author, Key: strings.TrimSpace(key), Content: content}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return entry, fmt.Errorf("failed to encode scratchpad entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return entry, fmt.Errorf("failed to create scratchpad directory: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return entry, fmt.Errorf("failed to open scratchpad: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return entry, fmt.Errorf("failed to write scratchpad: %w", err)
+	}
+	return entry, nil
+}
+
+// Entries returns the notes under key, or all of them if key is empty, oldest first
+func (s *Scratchpad) Entries(key string) ([]ScratchpadEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scratchpad: %w", err)
+	}
+	defer f.Close()
+
+	var entries []ScratchpadEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry ScratchpadEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // Skip a line cut short by a crash
+		}
+		if key == "" || entry.Key == key {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read scratchpad: %w", err)
+	}
+	return entries, nil
+}
+
+// formatScratchpadEntry describes an entry for an agent to read
+func formatScratchpadEntry(entry ScratchpadEntry) string {
+	line := fmt.Sprintf("[%s] %s", entry.Time.Format("2006-01-02 15:04:05"), entry.Author)
+	if entry.Key != "" {
+		line += " on " + entry.Key
+	}
+	return line + ":\n" + entry.Content
+}
+
+// ScratchpadWriteTool implements a tool to add a note to the shared scratchpad
+type ScratchpadWriteTool struct {
+	scratchpad *Scratchpad
+	author     string
+}
+
+// NewScratchpadWriteTool creates a scratchpad write tool whose notes are signed by author
+func NewScratchpadWriteTool(scratchpad *Scratchpad, author string) *ScratchpadWriteTool {
+	return &ScratchpadWriteTool{scratchpad: scratchpad, author: author}
+}
+
+// Name returns the name of the tool
+func (t *ScratchpadWriteTool) Name() string {
+	return "scratchpad_write"
+}
+
+// Description returns the description of the tool
+func (t *ScratchpadWriteTool) Description() string {
+	return "Add a note to the scratchpad shared by the main agent and its subagents, to pass data to cooperating tasks. " +
+		"Notes can't be changed; write a new one under the same key to supersede an earlier one."
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ScratchpadWriteTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"content": map[string]interface{}{"type": "string", "description": "The note"},
+			"key":     map[string]interface{}{"type": "string", "description": "Optional key grouping related notes, such as \"numbers\""},
+		},
+		"required": []string{"content"},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *ScratchpadWriteTool) Call(args map[string]interface{}) (string, error) {
+	content, ok := args["content"].(string)
+	if !ok || strings.TrimSpace(content) == "" {
+		return "", fmt.Errorf("missing 'content' argument")
+	}
+	key, _ := args["key"].(string)
+
+	entry, err := t.scratchpad.Append(t.author, key, content)
+	if err != nil {
+		return "", err
+	}
+	if entry.Key != "" {
+		return fmt.Sprintf("Added a note on %s to the scratchpad", entry.Key), nil
+	}
+	return "Added a note to the scratchpad", nil
+}
+
+// ScratchpadReadTool implements a tool to read the shared scratchpad
+type ScratchpadReadTool struct {
+	scratchpad *Scratchpad
+}
+
+// NewScratchpadReadTool creates a scratchpad read tool
+func NewScratchpadReadTool(scratchpad *Scratchpad) *ScratchpadReadTool {
+	return &ScratchpadReadTool{scratchpad: scratchpad}
+}
+
+// Name returns the name of the tool
+func (t *ScratchpadReadTool) Name() string {
+	return "scratchpad_read"
+}
+
+// Description returns the description of the tool
+func (t *ScratchpadReadTool) Description() string {
+	return "Read the latest notes on the scratchpad shared by the main agent and its subagents, with who wrote them"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ScratchpadReadTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"key":   map[string]interface{}{"type": "string", "description": "Only read notes under this key"},
+			"limit": map[string]interface{}{"type": "integer", "description": fmt.Sprintf("How many of the latest notes to read (default %d)", defaultScratchpadEntries)},
+		},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *ScratchpadReadTool) Call(args map[string]interface{}) (string, error) {
+	key, _ := args["key"].(string)
+	limit := defaultScratchpadEntries
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+
+	entries, err := t.scratchpad.Entries(strings.TrimSpace(key))
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		if key != "" {
+			return fmt.Sprintf("No notes on %s in the scratchpad.", key), nil
+		}
+		return "The scratchpad is empty.", nil
+	}
+
+	var result strings.Builder
+	if len(entries) > limit {
+		result.WriteString(fmt.Sprintf("Latest %d of %d notes:\n\n", limit, len(entries)))
+		entries = entries[len(entries)-limit:]
+	}
+	for i, entry := range entries {
+		if i > 0 {
+			result.WriteString("\n\n")
+		}
+		result.WriteString(formatScratchpadEntry(entry))
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,283 @@
+package subagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxTaskHistory     = 100             // How many finished tasks are kept
+	cancelPollInterval = 2 * time.Second // How often cancel requests from other processes are checked
+)
+
+// DefaultStorePath returns where a workspace's subagent tasks are persisted
+func DefaultStorePath(workspace string) string {
+	return filepath.Join(workspace, "data", "subagents.json")
+}
+
+// taskStore is the persisted form of the manager's tasks
+type taskStore struct {
+	Tasks   []*SubagentTask `json:"tasks"`   // Pending and running
+	History []*SubagentTask `json:"history"` // Finished, oldest first
+}
+
+// LoadTaskHistory reads the tasks persisted at path without resuming them: pending and
+// running tasks first, then finished ones newest first
+func LoadTaskHistory(path string) ([]SubagentTask, error) {
+	store, err := readTaskStore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []SubagentTask
+	for _, task := range store.Tasks {
+		tasks = append(tasks, *task)
+	}
+	for i := len(store.History) - 1; i >= 0; i-- {
+		tasks = append(tasks, *store.History[i])
+	}
+	return tasks, nil
+}
+
+// readTaskStore reads a task store; a missing file holds no tasks
+func readTaskStore(path string) (taskStore, error) {
+	var store taskStore
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return store, fmt.Errorf("failed to read subagent tasks: %w", err)
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return store, fmt.Errorf("failed to parse subagent tasks: %w", err)
+	}
+	return store, nil
+}
+
+// SetStorePath persists tasks at path from now on and restores the tasks persisted there.
+// Tasks still waiting for their dependencies are resumed. Tasks that were running when the
+// process stopped can't be picked up where they left off, so they are recorded as
+// interrupted instead.
+func (sm *SubagentManager) SetStorePath(path string) error {
+	store, err := readTaskStore(path)
+	if err != nil {
+		return err
+	}
+
+	sm.runningTasksMu.Lock()
+	sm.storePath = path
+	sm.history = store.History
+	var resumed []*SubagentTask
+	for _, task := range store.Tasks {
+		if task.Status != TaskPending {
+			now := sm.clock.Now()
+			task.Status = TaskInterrupted
+			task.Result = "Interrupted by a restart before it finished."
+			task.FinishedAt = &now
+			sm.history = append(sm.history, task)
+			slog.Warn("Subagent was interrupted by a restart", "subagent", task.ID, "label", task.Label)
+			continue
+		}
+		task.Context, task.Cancel = context.WithCancel(context.Background())
+		sm.runningTasks[task.ID] = task
+		sm.addWaiterLocked(task)
+		resumed = append(resumed, task)
+	}
+	sm.trimHistoryLocked()
+	sm.runningTasksMu.Unlock()
+
+	for _, task := range resumed {
+		slog.Info("Subagent resumed, waiting for dependencies", "subagent", task.ID, "label", task.Label)
+		go sm.waitForDependencies(task)
+	}
+	sm.saveTasks()
+
+	sm.watchOnce.Do(func() { go sm.watchCancelRequests() })
+	return nil
+}
+
+// cancelRequestsPath returns where other processes leave the IDs of tasks to cancel
+func cancelRequestsPath(storePath string) string {
+	return strings.TrimSuffix(storePath, filepath.Ext(storePath)) + "-cancel.txt"
+}
+
+// RequestCancel asks the process running the tasks persisted at storePath, such as the
+// gateway, to cancel a pending or running task by its ID or an ID prefix. It picks the
+// request up within a few seconds.
+func RequestCancel(storePath, taskID string) error {
+	store, err := readTaskStore(storePath)
+	if err != nil {
+		return err
+	}
+	var known []SubagentTask
+	for _, task := range append(store.Tasks, store.History...) {
+		known = append(known, *task)
+	}
+	if taskID, err = ResolveTaskID(known, taskID); err != nil {
+		return err
+	}
+
+	for _, task := range store.Tasks {
+		if task.ID != taskID {
+			continue
+		}
+		f, err := os.OpenFile(cancelRequestsPath(storePath), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to request cancellation: %w", err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(taskID + "\n"); err != nil {
+			return fmt.Errorf("failed to request cancellation: %w", err)
+		}
+		return nil
+	}
+
+	for _, task := range store.History {
+		if task.ID == taskID {
+			return fmt.Errorf("task %s already %s", taskID, task.Status)
+		}
+	}
+	return fmt.Errorf("task %s not found", taskID)
+}
+
+// watchCancelRequests cancels the tasks other processes asked to cancel with RequestCancel
+func (sm *SubagentManager) watchCancelRequests() {
+	ticker := sm.clock.NewTicker(cancelPollInterval)
+	defer ticker.Stop()
+	for range ticker.C() {
+		sm.runningTasksMu.RLock()
+		path := cancelRequestsPath(sm.storePath)
+		sm.runningTasksMu.RUnlock()
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		os.Remove(path)
+		for _, taskID := range strings.Fields(string(data)) {
+			if err := sm.CancelTask(taskID); err != nil {
+				slog.Warn("Could not cancel subagent", "subagent", taskID, "error", err)
+			}
+		}
+	}
+}
+
+// Tasks returns the pending and running tasks, oldest first
+func (sm *SubagentManager) Tasks() []SubagentTask {
+	sm.runningTasksMu.RLock()
+	defer sm.runningTasksMu.RUnlock()
+
+	tasks := make([]SubagentTask, 0, len(sm.runningTasks))
+	for _, task := range sm.runningTasks {
+		tasks = append(tasks, *task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.Before(tasks[j].CreatedAt) })
+	return tasks
+}
+
+// Task returns a pending, running or finished task by its ID
+func (sm *SubagentManager) Task(taskID string) (SubagentTask, bool) {
+	sm.runningTasksMu.RLock()
+	defer sm.runningTasksMu.RUnlock()
+
+	if task, ok := sm.runningTasks[taskID]; ok {
+		return *task, true
+	}
+	for _, task := range sm.history {
+		if task.ID == taskID {
+			return *task, true
+		}
+	}
+	return SubagentTask{}, false
+}
+
+// History returns finished tasks, newest first, at most limit of them unless limit is 0
+func (sm *SubagentManager) History(limit int) []SubagentTask {
+	sm.runningTasksMu.RLock()
+	defer sm.runningTasksMu.RUnlock()
+
+	var tasks []SubagentTask
+	for i := len(sm.history) - 1; i >= 0; i-- {
+		if limit > 0 && len(tasks) == limit {
+			break
+		}
+		tasks = append(tasks, *sm.history[i])
+	}
+	return tasks
+}
+
+// finishTask records the outcome of a task, moving it from the running tasks to the
+// history, writes its result to the workspace and wakes the tasks waiting for it
+func (sm *SubagentManager) finishTask(task *SubagentTask, result *TaskResult) {
+	sm.runningTasksMu.Lock()
+	now := sm.clock.Now()
+	result.TaskID, result.Label, result.FinishedAt = task.ID, task.Label, now
+	metrics := result.Metrics
+	task.Status = result.Status
+	task.Result = result.Summary
+	task.Artifacts = result.Artifacts
+	task.Metrics = &metrics
+	task.FinishedAt = &now
+	delete(sm.runningTasks, task.ID)
+	sm.history = append(sm.history, task)
+	sm.trimHistoryLocked()
+	sm.runningTasksMu.Unlock()
+
+	sm.writeResult(result)
+	sm.saveTasks()
+	sm.notifyWaiters(task.ID)
+}
+
+// trimHistoryLocked drops the oldest finished tasks past maxTaskHistory. The caller holds
+// runningTasksMu.
+func (sm *SubagentManager) trimHistoryLocked() {
+	if len(sm.history) > maxTaskHistory {
+		sm.history = append([]*SubagentTask(nil), sm.history[len(sm.history)-maxTaskHistory:]...)
+	}
+}
+
+// saveTasks persists the pending, running and finished tasks, if a store path is set.
+// Failures are logged; a task shouldn't fail because its record couldn't be written.
+func (sm *SubagentManager) saveTasks() {
+	sm.saveMu.Lock()
+	defer sm.saveMu.Unlock()
+
+	sm.runningTasksMu.RLock()
+	if sm.storePath == "" {
+		sm.runningTasksMu.RUnlock()
+		return
+	}
+	store := taskStore{Tasks: []*SubagentTask{}, History: append([]*SubagentTask{}, sm.history...)}
+	for _, task := range sm.runningTasks {
+		store.Tasks = append(store.Tasks, task)
+	}
+	sort.Slice(store.Tasks, func(i, j int) bool { return store.Tasks[i].CreatedAt.Before(store.Tasks[j].CreatedAt) })
+	data, err := json.MarshalIndent(store, "", "  ")
+	path := sm.storePath
+	sm.runningTasksMu.RUnlock()
+	if err != nil {
+		slog.Warn("Could not encode subagent tasks", "error", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		slog.Warn("Could not create subagent task store", "error", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		slog.Warn("Could not save subagent tasks", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		slog.Warn("Could not save subagent tasks", "error", err)
+	}
+}
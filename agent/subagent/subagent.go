@@ -4,15 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"nanotalon/agent/tools"
+	"nanotalon/audit"
 	"nanotalon/bus"
+	"nanotalon/clock"
+	"nanotalon/logging"
 	"nanotalon/providers"
+
+	"github.com/google/uuid"
 )
 
+// shortIDLength is how much of a task ID is shown in chats and listings
+const shortIDLength = 8
+
 // SubagentManager manages background subagent execution
 type SubagentManager struct {
 	provider                providers.LLMProvider
@@ -20,6 +30,7 @@ type SubagentManager struct {
 	bus                     *bus.MessageBus
 	model                   string
 	temperature             float64
+	temperatureMu           sync.RWMutex
 	maxTokens               int
 	braveAPIKey             string
 	restrictToWorkspace     bool
@@ -28,20 +39,45 @@ type SubagentManager struct {
 	onTaskCompletedCallback func(taskID, label, result string)
 	taskDependencies        map[string][]string // Maps task ID to its dependencies
 	dependencyWaiters       map[string][]string // Maps dependency ID to tasks waiting for it
+	clock                   clock.Clock
+	commandFilter           *tools.CommandFilter
+	storePath               string          // Where tasks are persisted; empty keeps them in memory only
+	history                 []*SubagentTask // Finished tasks, oldest first, at most maxTaskHistory
+	saveMu                  sync.Mutex
+	watchOnce               sync.Once
+	scratchpad              *Scratchpad                              // Shared with the main agent; nil when disabled
+	maxOutputChars          int                                      // Tool output beyond this is offloaded to an artifact
+	auditLog                *audit.Logger                            // Records subagent tool calls; nil when auditing is off
+	toolPolicies            func(channel string) []*tools.ToolPolicy // The tools each origin channel allows; nil allows all
 }
 
 // SubagentTask represents a running subagent task
 type SubagentTask struct {
-	ID           string
-	Label        string
-	Task         string
-	Context      context.Context
-	Cancel       context.CancelFunc
-	Status       TaskStatus
-	CreatedAt    time.Time
-	Dependencies []string
+	ID            string             `json:"id"`
+	Label         string             `json:"label"`
+	Task          string             `json:"task"`
+	Context       context.Context    `json:"-"`
+	Cancel        context.CancelFunc `json:"-"`
+	Status        TaskStatus         `json:"status"`
+	CreatedAt     time.Time          `json:"created_at"`
+	Dependencies  []string           `json:"dependencies,omitempty"`
+	OriginChannel string             `json:"origin_channel"`      // Channel of the chat that asked for the task
+	OriginChatID  string             `json:"origin_chat_id"`      // Chat the result is announced in
+	Result        string             `json:"result,omitempty"`    // The summary of the task's result
+	Artifacts     []string           `json:"artifacts,omitempty"` // Files the subagent produced
+	Metrics       *TaskMetrics       `json:"metrics,omitempty"`
+	FinishedAt    *time.Time         `json:"finished_at,omitempty"`
+	Template      string             `json:"template,omitempty"`       // The template the task was made from
+	Model         string             `json:"model,omitempty"`          // Overrides the manager's model
+	Tools         []string           `json:"tools,omitempty"`          // Limits the tools the subagent gets
+	DisabledTools []string           `json:"disabled_tools,omitempty"` // Tools the origin channel doesn't allow
+
+	wake chan struct{} // Signalled when a dependency finishes, while the task is pending
 }
 
+// SenderID is the sender of the inbound messages that announce finished tasks
+const SenderID = "subagent"
+
 // TaskStatus represents the status of a task
 type TaskStatus string
 
@@ -50,6 +86,11 @@ const (
 	TaskRunning   TaskStatus = "running"
 	TaskCompleted TaskStatus = "completed"
 	TaskFailed    TaskStatus = "failed"
+
+	// TaskInterrupted marks a task that was running when the process stopped
+	TaskInterrupted TaskStatus = "interrupted"
+	// TaskCancelled marks a task that was cancelled before it finished
+	TaskCancelled TaskStatus = "cancelled"
 )
 
 // NewSubagentManager creates a new subagent manager
@@ -75,9 +116,64 @@ func NewSubagentManager(
 		runningTasks:        make(map[string]*SubagentTask),
 		taskDependencies:    make(map[string][]string),
 		dependencyWaiters:   make(map[string][]string),
+		clock:               clock.New(),
+		maxOutputChars:      16000,
 	}
 }
 
+// SetMaxOutputChars sets how much of a tool's output subagents see before the rest is
+// offloaded to an artifact file; 0 disables the limit
+func (sm *SubagentManager) SetMaxOutputChars(maxChars int) {
+	sm.maxOutputChars = maxChars
+}
+
+// SetAuditLog records the tool calls of subagents in the main agent's audit log
+func (sm *SubagentManager) SetAuditLog(auditLog *audit.Logger) {
+	sm.auditLog = auditLog
+}
+
+// SetToolPolicies limits each task to the tools its origin channel allows, so a chat can't
+// reach a tool disabled for it by spawning a subagent
+func (sm *SubagentManager) SetToolPolicies(policies func(channel string) []*tools.ToolPolicy) {
+	sm.toolPolicies = policies
+}
+
+// SetTemperature changes the temperature of the tasks that start from now on
+func (sm *SubagentManager) SetTemperature(temperature float64) {
+	sm.temperatureMu.Lock()
+	defer sm.temperatureMu.Unlock()
+	sm.temperature = temperature
+}
+
+// currentTemperature returns the temperature tasks run with
+func (sm *SubagentManager) currentTemperature() float64 {
+	sm.temperatureMu.RLock()
+	defer sm.temperatureMu.RUnlock()
+	return sm.temperature
+}
+
+// SetClock replaces the clock used for timestamps and dependency polling
+func (sm *SubagentManager) SetClock(clk clock.Clock) {
+	sm.clock = clk
+}
+
+// SetMessageBus sets the bus finished tasks are announced on. Without one, results are
+// only logged and passed to the completion callback.
+func (sm *SubagentManager) SetMessageBus(messageBus *bus.MessageBus) {
+	sm.bus = messageBus
+}
+
+// SetScratchpad gives subagents the scratchpad shared with the main agent
+func (sm *SubagentManager) SetScratchpad(scratchpad *Scratchpad) {
+	sm.scratchpad = scratchpad
+}
+
+// SetCommandFilter screens the commands subagents run. Subagents have no user to ask,
+// so commands that would need approval are refused.
+func (sm *SubagentManager) SetCommandFilter(filter *tools.CommandFilter) {
+	sm.commandFilter = filter.Strict()
+}
+
 // Spawn spawns a subagent to execute a task in the background
 func (sm *SubagentManager) Spawn(
 	task string,
@@ -86,7 +182,6 @@ func (sm *SubagentManager) Spawn(
 	originChatID string,
 	dependencies ...string,
 ) (string, error) {
-	taskID := sm.generateTaskID()
 	displayLabel := task[:min(len(task), 30)]
 	if len(task) > 30 {
 		displayLabel += "..."
@@ -95,35 +190,66 @@ func (sm *SubagentManager) Spawn(
 		displayLabel = *label
 	}
 
-	// Create context for the task
-	ctx, cancel := context.WithCancel(context.Background())
+	return sm.spawnTask(&SubagentTask{
+		Label:         displayLabel,
+		Task:          task,
+		Dependencies:  dependencies,
+		OriginChannel: originChannel,
+		OriginChatID:  originChatID,
+	})
+}
 
-	// Check if dependencies exist
-	for _, depID := range dependencies {
-		if !sm.taskExists(depID) {
-			return "", fmt.Errorf("dependency task %s does not exist", depID)
+// spawnTask starts a task filled in by Spawn or SpawnTemplate, or schedules it to start
+// once its dependencies complete
+func (sm *SubagentManager) spawnTask(subagentTask *SubagentTask) (string, error) {
+	taskID := sm.generateTaskID()
+	displayLabel := subagentTask.Label
+	dependencies := append([]string(nil), subagentTask.Dependencies...)
+
+	// Check if dependencies exist, resolving short IDs to full ones
+	for i, depID := range dependencies {
+		resolved, err := sm.ResolveTaskID(depID)
+		if err != nil {
+			return "", fmt.Errorf("dependency %w", err)
 		}
+		dependencies[i] = resolved
 	}
 
+	// Keep the task to the tools of the chat that spawned it, even across restarts
+	subagentTask.DisabledTools = sm.disabledTools(subagentTask.OriginChannel)
+
+	// Create context for the task
+	ctx, cancel := context.WithCancel(context.Background())
+
 	// Store task info
-	subagentTask := &SubagentTask{
-		ID:           taskID,
-		Label:        displayLabel,
-		Task:         task,
-		Context:      ctx,
-		Cancel:       cancel,
-		Status:       TaskPending,
-		CreatedAt:    time.Now(),
-		Dependencies: dependencies,
-	}
+	subagentTask.ID = taskID
+	subagentTask.Dependencies = dependencies
+	subagentTask.Context = ctx
+	subagentTask.Cancel = cancel
+	subagentTask.Status = TaskPending
+	subagentTask.CreatedAt = sm.clock.Now()
 
 	// Check if dependencies are met
 	if len(dependencies) > 0 {
-		if !sm.areDependenciesMet(dependencies) {
+		sm.runningTasksMu.Lock()
+		met, err := sm.dependenciesMetLocked(dependencies)
+		if err != nil {
+			sm.runningTasksMu.Unlock()
+			cancel()
+			return "", err
+		}
+		if !met {
+			// Track the task while it waits, so it survives a restart
+			sm.runningTasks[taskID] = subagentTask
+			sm.addWaiterLocked(subagentTask)
+			sm.runningTasksMu.Unlock()
+			sm.saveTasks()
+
 			// Wait for dependencies to complete
 			go sm.waitForDependencies(subagentTask)
-			return fmt.Sprintf("Subagent [%s] scheduled (id: %s). Waiting for dependencies to complete before starting.", displayLabel, taskID), nil
+			return fmt.Sprintf("Subagent [%s] scheduled (id: %s). Waiting for dependencies to complete before starting.", displayLabel, ShortID(taskID)), nil
 		}
+		sm.runningTasksMu.Unlock()
 	}
 
 	// Update status and run the task
@@ -131,123 +257,204 @@ func (sm *SubagentManager) Spawn(
 	sm.runningTasksMu.Lock()
 	sm.runningTasks[taskID] = subagentTask
 	sm.runningTasksMu.Unlock()
+	sm.saveTasks()
 
 	// Run the subagent in a goroutine
-	go func() {
-		defer func() {
-			// Remove from running tasks when done
-			sm.runningTasksMu.Lock()
-			delete(sm.runningTasks, taskID)
-			sm.runningTasksMu.Unlock()
-
-			// Notify tasks that were waiting for this task to complete
-			sm.notifyWaiters(taskID)
-		}()
-
-		result, err := sm.runSubagent(taskID, task, displayLabel, originChannel, originChatID)
-		if err != nil {
-			log.Printf("Subagent [%s] failed: %v", taskID, err)
-			subagentTask.Status = TaskFailed
-			result = fmt.Sprintf("Error: %v", err)
-		} else {
-			subagentTask.Status = TaskCompleted
-		}
-
-		// Announce result
-		sm.announceResult(taskID, displayLabel, task, result, originChannel, originChatID)
-	}()
+	go sm.runTask(subagentTask)
 
-	log.Printf("Spawned subagent [%s]: %s", taskID, displayLabel)
-	return fmt.Sprintf("Subagent [%s] started (id: %s). I'll notify you when it completes.", displayLabel, taskID), nil
+	slog.Info("Spawned subagent", "subagent", taskID, "label", displayLabel)
+	return fmt.Sprintf("Subagent [%s] started (id: %s). I'll notify you when it completes.", displayLabel, ShortID(taskID)), nil
 }
 
-// waitForDependencies waits for dependencies to complete before starting the task
+// waitForDependencies starts the task once all its dependencies have completed. If one of
+// them fails or is cancelled instead, so does the task.
 func (sm *SubagentManager) waitForDependencies(task *SubagentTask) {
 	for {
+		sm.runningTasksMu.RLock()
+		met, err := sm.dependenciesMetLocked(task.Dependencies)
+		sm.runningTasksMu.RUnlock()
+		if err != nil {
+			slog.Warn("Subagent can't start", "subagent", task.ID, "error", err)
+			sm.finishTask(task, &TaskResult{Status: TaskFailed, Summary: fmt.Sprintf("Error: %v", err)})
+			sm.announceResult(task, task.Result)
+			return
+		}
+		if met {
+			// Dependencies are met, start the task
+			sm.runningTasksMu.Lock()
+			task.Status = TaskRunning
+			sm.runningTasksMu.Unlock()
+			sm.saveTasks()
+			go sm.runTask(task)
+			return
+		}
+
 		select {
 		case <-task.Context.Done():
 			// Task was cancelled while waiting
+			sm.finishTask(task, &TaskResult{Status: TaskCancelled, Summary: "Cancelled before it started."})
+			sm.announceResult(task, task.Result)
 			return
-		default:
-			if sm.areDependenciesMet(task.Dependencies) {
-				// Dependencies are met, start the task
-				task.Status = TaskRunning
-				go func() {
-					result, err := sm.runSubagent(task.ID, task.Task, task.Label, "cli", "direct") // Use default channel/chat for dependency tasks
-					if err != nil {
-						log.Printf("Subagent [%s] failed: %v", task.ID, err)
-						task.Status = TaskFailed
-						result = fmt.Sprintf("Error: %v", err)
-					} else {
-						task.Status = TaskCompleted
-					}
+		case <-task.wake: // A dependency finished; check again
+		}
+	}
+}
 
-					// Announce result
-					sm.announceResult(task.ID, task.Label, task.Task, result, "cli", "direct")
-				}()
-				return
-			}
-			time.Sleep(1 * time.Second) // Wait before checking again
+// buildTools builds the tools every subagent gets, unless its template limits them
+func (sm *SubagentManager) buildTools() *tools.ToolRegistry {
+	toolRegistry := tools.NewToolRegistry()
+	toolRegistry.SetOutputLimiter(tools.NewOutputLimiter(sm.maxOutputChars, filepath.Join(sm.workspace, "artifacts")))
+	allowedDir := ""
+	if sm.restrictToWorkspace {
+		allowedDir = sm.workspace
+	}
+
+	toolRegistry.Register(tools.NewReadFileTool(sm.workspace, allowedDir))
+	toolRegistry.Register(tools.NewWriteFileTool(sm.workspace, allowedDir))
+	toolRegistry.Register(tools.NewEditFileTool(sm.workspace, allowedDir))
+	toolRegistry.Register(tools.NewListDirTool(sm.workspace, allowedDir))
+	execTool := tools.NewExecTool(sm.workspace, 60, sm.restrictToWorkspace) // 60s timeout default
+	execTool.SetCommandFilter(sm.commandFilter)
+	toolRegistry.Register(execTool)
+	toolRegistry.Register(tools.NewWebSearchTool(sm.braveAPIKey, 5)) // 5 results max
+	toolRegistry.Register(tools.NewWebFetchTool())
+	return toolRegistry
+}
+
+// disabledTools returns the subagent tools the tool policies don't allow for a channel
+func (sm *SubagentManager) disabledTools(channel string) []string {
+	if sm.toolPolicies == nil {
+		return nil
+	}
+	available := sm.buildTools()
+	if sm.scratchpad != nil {
+		available.Register(NewScratchpadWriteTool(sm.scratchpad, ""))
+		available.Register(NewScratchpadReadTool(sm.scratchpad))
+	}
+	allowed := available.Filter(sm.toolPolicies(channel)...)
+
+	var disabled []string
+	for _, name := range available.Names() {
+		if allowed.Get(name) == nil {
+			disabled = append(disabled, name)
 		}
 	}
+	return disabled
 }
 
-// areDependenciesMet checks if all dependencies for a task are completed
-func (sm *SubagentManager) areDependenciesMet(dependencies []string) bool {
-	sm.runningTasksMu.RLock()
-	defer sm.runningTasksMu.RUnlock()
+// runTask runs a started task to the end, records its result and announces it
+func (sm *SubagentManager) runTask(task *SubagentTask) {
+	result, err := sm.runSubagent(task)
+	result.Status = TaskCompleted
+	switch {
+	case task.Context.Err() != nil:
+		slog.Info("Subagent cancelled", "subagent", task.ID)
+		result.Status = TaskCancelled
+		result.Summary = "Cancelled before it finished."
+	case err != nil:
+		slog.Error("Subagent failed", "subagent", task.ID, "error", err)
+		result.Status = TaskFailed
+		result.Summary = fmt.Sprintf("Error: %v", err)
+	}
+
+	// Record the result, which also wakes the tasks waiting for this one
+	sm.finishTask(task, result)
+
+	// Announce result
+	sm.announceResult(task, result.Summary)
+}
 
+// dependenciesMetLocked reports whether all dependencies have completed. It fails if one
+// of them never will, having failed, been cancelled or been forgotten. The caller holds
+// runningTasksMu.
+func (sm *SubagentManager) dependenciesMetLocked(dependencies []string) (bool, error) {
+	met := true
 	for _, depID := range dependencies {
-		task, exists := sm.runningTasks[depID]
-		if !exists || task.Status != TaskCompleted {
-			return false
+		if _, running := sm.runningTasks[depID]; running {
+			met = false
+			continue
+		}
+		dep := sm.finishedTaskLocked(depID)
+		if dep == nil {
+			return false, fmt.Errorf("dependency task %s no longer exists", depID)
+		}
+		if dep.Status != TaskCompleted {
+			return false, fmt.Errorf("dependency task %s %s", depID, dep.Status)
 		}
 	}
-	return true
+	return met, nil
 }
 
-// taskExists checks if a task exists
-func (sm *SubagentManager) taskExists(taskID string) bool {
-	sm.runningTasksMu.RLock()
-	defer sm.runningTasksMu.RUnlock()
+// finishedTaskLocked looks a task up in the history. The caller holds runningTasksMu.
+func (sm *SubagentManager) finishedTaskLocked(taskID string) *SubagentTask {
+	for i := len(sm.history) - 1; i >= 0; i-- {
+		if sm.history[i].ID == taskID {
+			return sm.history[i]
+		}
+	}
+	return nil
+}
 
-	_, exists := sm.runningTasks[taskID]
-	return exists
+// addWaiterLocked registers a pending task to be woken as each of its dependencies
+// finishes. The caller holds runningTasksMu.
+func (sm *SubagentManager) addWaiterLocked(task *SubagentTask) {
+	task.wake = make(chan struct{}, 1)
+	for _, depID := range task.Dependencies {
+		sm.dependencyWaiters[depID] = append(sm.dependencyWaiters[depID], task.ID)
+	}
 }
 
-// notifyWaiters notifies tasks that were waiting for a task to complete
+// notifyWaiters wakes the tasks that were waiting for a task to finish
 func (sm *SubagentManager) notifyWaiters(taskID string) {
-	// In a real implementation, this would check which tasks were waiting for this taskID
-	// and update their states accordingly
+	sm.runningTasksMu.Lock()
+	defer sm.runningTasksMu.Unlock()
+
+	for _, waiterID := range sm.dependencyWaiters[taskID] {
+		if waiter, ok := sm.runningTasks[waiterID]; ok && waiter.wake != nil {
+			select {
+			case waiter.wake <- struct{}{}:
+			default: // Already due to check
+			}
+		}
+	}
+	delete(sm.dependencyWaiters, taskID)
 }
 
-// runSubagent executes the subagent task and returns the result
-func (sm *SubagentManager) runSubagent(
-	taskID string,
-	task string,
-	label string,
-	originChannel string,
-	originChatID string,
-) (string, error) {
-	log.Printf("Subagent [%s] starting task: %s", taskID, label)
+// runSubagent executes the subagent task and returns its result, with the files it wrote
+// and what the run took. The result is returned even if the run fails, with the metrics
+// gathered until then.
+func (sm *SubagentManager) runSubagent(subagentTask *SubagentTask) (*TaskResult, error) {
+	ctx, taskID, task := subagentTask.Context, subagentTask.ID, subagentTask.Task
+	slog.Info("Subagent starting task", "subagent", taskID, "label", subagentTask.Label)
+
+	result := &TaskResult{TaskID: taskID, Label: subagentTask.Label}
+	started := sm.clock.Now()
+	defer func() {
+		result.Metrics.DurationMS = sm.clock.Now().Sub(started).Milliseconds()
+	}()
 
 	// Build subagent tools (no message tool, no spawn tool)
-	toolRegistry := tools.NewToolRegistry()
-	allowedDir := ""
-	if sm.restrictToWorkspace {
-		allowedDir = sm.workspace
+	toolRegistry := sm.buildTools()
+	if len(subagentTask.Tools) > 0 {
+		toolRegistry = toolRegistry.Filter(tools.NewToolPolicy(subagentTask.Tools, nil))
+	}
+	if sm.scratchpad != nil {
+		author := fmt.Sprintf("subagent %s (%s)", subagentTask.Label, ShortID(taskID))
+		toolRegistry.Register(NewScratchpadWriteTool(sm.scratchpad, author))
+		toolRegistry.Register(NewScratchpadReadTool(sm.scratchpad))
+	}
+	if len(subagentTask.DisabledTools) > 0 {
+		toolRegistry = toolRegistry.Filter(tools.NewToolPolicy(nil, subagentTask.DisabledTools))
+	}
+	reportTool := NewReportTool(sm.workspace, result)
+	toolRegistry.Register(reportTool)
+	model := sm.model
+	if subagentTask.Model != "" {
+		model = subagentTask.Model
 	}
-
-	toolRegistry.Register(tools.NewReadFileTool(sm.workspace, allowedDir))
-	toolRegistry.Register(tools.NewWriteFileTool(sm.workspace, allowedDir))
-	toolRegistry.Register(tools.NewEditFileTool(sm.workspace, allowedDir))
-	toolRegistry.Register(tools.NewListDirTool(sm.workspace, allowedDir))
-	toolRegistry.Register(tools.NewExecTool(sm.workspace, 60, sm.restrictToWorkspace)) // 60s timeout default
-	toolRegistry.Register(tools.NewWebSearchTool(sm.braveAPIKey, 5))                   // 5 results max
-	toolRegistry.Register(tools.NewWebFetchTool())
 
 	// Build messages with subagent-specific prompt
-	systemPrompt := sm.buildSubagentPrompt(task)
+	systemPrompt := sm.buildSubagentPrompt(taskID, task)
 	messages := []providers.Message{
 		{Role: "system", Content: systemPrompt},
 		{Role: "user", Content: task},
@@ -255,25 +462,28 @@ func (sm *SubagentManager) runSubagent(
 
 	// Run agent loop (limited iterations)
 	maxIterations := 15
-	iteration := 0
 	var finalResult string
 
-	for iteration < maxIterations {
-		iteration++
+	for result.Metrics.Iterations < maxIterations && !reportTool.reported {
+		result.Metrics.Iterations++
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
 
 		// Prepare tool definitions for the provider
 		toolDefs := sm.getToolDefinitions(toolRegistry)
 
-		response, err := sm.provider.Chat(context.Background(), providers.ChatRequest{
+		response, err := sm.provider.Chat(ctx, providers.ChatRequest{
 			Messages:    messages,
-			Model:       sm.model,
-			Temperature: sm.temperature,
+			Model:       model,
+			Temperature: sm.currentTemperature(),
 			MaxTokens:   sm.maxTokens,
 			Tools:       toolDefs,
 		})
 		if err != nil {
-			return "", err
+			return result, err
 		}
+		result.Metrics.Tokens += response.Usage.TotalTokens
 
 		if len(response.ToolCalls) > 0 {
 			// Add assistant message with tool calls
@@ -287,16 +497,29 @@ func (sm *SubagentManager) runSubagent(
 					Content: fmt.Sprintf("Calling tool: %s", tc.Name),
 				})
 
-				log.Printf("Subagent [%s] executing: %s with arguments: %s", taskID, tc.Name, string(argsBytes))
+				slog.Debug("Subagent executing tool", "subagent", taskID, "tool", tc.Name, "args", string(argsBytes))
 
-				result, err := toolRegistry.Execute(tc.Name, tc.Args)
+				toolStarted := sm.clock.Now()
+				output, err := toolRegistry.Execute(tc.Name, tc.Args)
+				sm.recordToolCall(subagentTask, tc, toolStarted, output, err)
+				result.Metrics.ToolCalls++
 				if err != nil {
-					return "", fmt.Errorf("tool execution failed: %w", err)
+					return result, fmt.Errorf("tool execution failed: %w", err)
+				}
+
+				// Files the subagent writes are artifacts even if it doesn't report them
+				if tc.Name == "write_file" || tc.Name == "edit_file" {
+					if path, ok := tc.Args["path"].(string); ok {
+						if abs, err := filepath.Abs(path); err == nil {
+							path = abs
+						}
+						result.addArtifact(artifactPath(sm.workspace, path))
+					}
 				}
 
 				messages = append(messages, providers.Message{
 					Role:    "tool",
-					Content: result,
+					Content: output,
 					Name:    tc.Name,
 				})
 			}
@@ -306,39 +529,89 @@ func (sm *SubagentManager) runSubagent(
 		}
 	}
 
-	if finalResult == "" {
-		finalResult = "Task completed but no final response was generated."
+	// Without a report, the final response is the summary
+	if !reportTool.reported {
+		result.Summary = finalResult
+	}
+	if result.Summary == "" {
+		result.Summary = "Task completed but no final response was generated."
 	}
 
-	log.Printf("Subagent [%s] completed successfully", taskID)
-	return finalResult, nil
+	slog.Info("Subagent completed", "subagent", taskID)
+	return result, nil
 }
 
-// announceResult announces the subagent result to the main agent via the message bus
-func (sm *SubagentManager) announceResult(
-	taskID string,
-	label string,
-	task string,
-	result string,
-	originChannel string,
-	originChatID string,
-) {
-	_ = originChannel // use variables to avoid "not used" error
-	_ = originChatID
-	_ = task
+// recordToolCall appends a subagent's tool invocation to the audit log if auditing is enabled.
+// The session is the task's, so its calls can be told apart from the chat that spawned it.
+func (sm *SubagentManager) recordToolCall(task *SubagentTask, tc providers.ToolCall, started time.Time, result string, callErr error) {
+	if sm.auditLog == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Time:       started,
+		Session:    "subagent:" + task.ID,
+		Channel:    task.OriginChannel,
+		Tool:       tc.Name,
+		Args:       tc.Args,
+		DurationMS: sm.clock.Now().Sub(started).Milliseconds(),
+		Result:     result,
+	}
+	if callErr != nil {
+		entry.Error = callErr.Error()
+	}
 
-	// For now, we'll just log the result. In a real implementation, we'd publish to the bus
-	log.Printf("Subagent [%s] result announced: %s", taskID, result)
+	if err := sm.auditLog.Record(entry); err != nil {
+		slog.Warn("Could not write audit log", "subagent", task.ID, "error", err)
+	}
+}
+
+// announceResult announces the subagent result to the main agent via the message bus. The
+// announcement arrives as a message in the chat that asked for the task, so the main agent
+// takes the result into that conversation and tells the user there.
+func (sm *SubagentManager) announceResult(task *SubagentTask, result string) {
+	slog.Debug("Subagent result announced", "subagent", task.ID, logging.ChannelKey, task.OriginChannel, "result", result)
+
+	if sm.bus != nil && task.OriginChannel != "" {
+		outcome := "finished"
+		switch task.Status {
+		case TaskFailed:
+			outcome = "failed"
+		case TaskCancelled:
+			outcome = "was cancelled"
+		}
+		var files string
+		if len(task.Artifacts) > 0 {
+			files = "\n\nFiles:\n- " + strings.Join(task.Artifacts, "\n- ")
+		}
+		content := fmt.Sprintf("Subagent [%s] %s (id: %s).\n\nTask: %s\n\nResult:\n%s%s\n\n"+
+			"The full result is in %s. Summarize this for the user in a sentence or two, without mentioning subagents or task IDs.",
+			task.Label, outcome, ShortID(task.ID), task.Task, result, files, resultPath(sm.workspace, task.ID))
+		if err := sm.bus.PublishInbound(bus.InboundMessage{
+			Channel:  task.OriginChannel,
+			SenderID: SenderID,
+			ChatID:   task.OriginChatID,
+			Content:  content,
+		}); err != nil {
+			slog.Error("Subagent could not announce result", "subagent", task.ID, logging.ChannelKey, task.OriginChannel, "error", err)
+		}
+	}
 
 	// If there's a callback, call it
 	if sm.onTaskCompletedCallback != nil {
-		sm.onTaskCompletedCallback(taskID, label, result)
+		sm.onTaskCompletedCallback(task.ID, task.Label, result)
 	}
 }
 
 // buildSubagentPrompt builds a focused system prompt for the subagent
-func (sm *SubagentManager) buildSubagentPrompt(task string) string {
-	now := fmt.Sprintf("%s (%s)", time.Now().Format("2006-01-02 15:04"), time.Now().Weekday().String())
+func (sm *SubagentManager) buildSubagentPrompt(taskID, task string) string {
+	current := sm.clock.Now()
+	now := fmt.Sprintf("%s (%s)", current.Format("2006-01-02 15:04"), current.Weekday().String())
+
+	var scratchpad string
+	if sm.scratchpad != nil {
+		scratchpad = "\n- Share data with the main agent and other subagents on the scratchpad (scratchpad_read, scratchpad_write)"
+	}
 
 	return fmt.Sprintf(`# Subagent
 
@@ -349,14 +622,14 @@ You are a subagent spawned by the main agent to complete a specific task.
 
 ## Rules
 1. Stay focused - complete only the assigned task, nothing else
-2. Your final response will be reported back to the main agent
+2. Finish by calling report_result with a summary and the files you produced; it is reported back to the main agent
 3. Do not initiate conversations or take on side tasks
 4. Be concise but informative in your findings
 
 ## What You Can Do
 - Read and write files in the workspace
 - Execute shell commands
-- Search the web and fetch web pages
+- Search the web and fetch web pages%s
 - Complete the task thoroughly
 
 ## What You Cannot Do
@@ -368,8 +641,9 @@ You are a subagent spawned by the main agent to complete a specific task.
 Your workspace is at: %s
 Skills are available at: %s/skills/ (read SKILL.md files as needed)
 
-When you have completed the task, provide a clear summary of your findings or actions.`,
-		now, sm.workspace, sm.workspace)
+When you have completed the task, call report_result with a clear summary of your findings or actions.
+Write any files worth keeping in %s and list them as artifacts.`,
+		now, scratchpad, sm.workspace, sm.workspace, ResultDir(sm.workspace, taskID))
 }
 
 // getToolDefinitions converts the tool registry to provider tool definitions
@@ -402,11 +676,50 @@ func (sm *SubagentManager) getToolDefinitions(toolRegistry *tools.ToolRegistry)
 	return toolDefs
 }
 
-// generateTaskID generates a simple task ID
+// generateTaskID generates a unique task ID
 func (sm *SubagentManager) generateTaskID() string {
-	// In a real implementation, you'd want a proper UUID
-	// For now, we'll use a timestamp-based ID
-	return fmt.Sprintf("%d", time.Now().Unix())
+	return uuid.NewString()
+}
+
+// ShortID returns the prefix of a task ID shown in chats and listings. Any prefix that
+// matches a single task can stand for its ID.
+func ShortID(taskID string) string {
+	if len(taskID) > shortIDLength {
+		return taskID[:shortIDLength]
+	}
+	return taskID
+}
+
+// ResolveTaskID finds the task a full ID or an ID prefix refers to
+func ResolveTaskID(tasks []SubagentTask, ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", fmt.Errorf("missing task id")
+	}
+
+	var matches []string
+	for _, task := range tasks {
+		if task.ID == ref {
+			return task.ID, nil
+		}
+		if strings.HasPrefix(task.ID, ref) {
+			matches = append(matches, task.ID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("task %s not found", ref)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("task id %s is ambiguous, it matches %s", ref, strings.Join(matches, ", "))
+}
+
+// ResolveTaskID finds the pending, running or finished task a full ID or an ID prefix
+// refers to
+func (sm *SubagentManager) ResolveTaskID(ref string) (string, error) {
+	tasks := sm.Tasks()
+	return ResolveTaskID(append(tasks, sm.History(0)...), ref)
 }
 
 // GetRunningCount returns the number of currently running subagents
@@ -423,6 +736,10 @@ func (sm *SubagentManager) SetOnTaskCompletedCallback(callback func(taskID, labe
 
 // GetTaskStatus returns the status of a specific task
 func (sm *SubagentManager) GetTaskStatus(taskID string) (TaskStatus, bool) {
+	if resolved, err := sm.ResolveTaskID(taskID); err == nil {
+		taskID = resolved
+	}
+
 	sm.runningTasksMu.RLock()
 	defer sm.runningTasksMu.RUnlock()
 
@@ -449,18 +766,22 @@ func (sm *SubagentManager) GetRunningTasks() []string {
 	return tasks
 }
 
-// CancelTask cancels a running task
+// CancelTask cancels a pending or running task. A running task stops at its next step
+// and is recorded as cancelled.
 func (sm *SubagentManager) CancelTask(taskID string) error {
-	sm.runningTasksMu.Lock()
-	defer sm.runningTasksMu.Unlock()
+	taskID, err := sm.ResolveTaskID(taskID)
+	if err != nil {
+		return err
+	}
 
+	sm.runningTasksMu.RLock()
 	task, exists := sm.runningTasks[taskID]
+	sm.runningTasksMu.RUnlock()
 	if !exists {
 		return fmt.Errorf("task %s not found", taskID)
 	}
 
 	task.Cancel()
-	task.Status = TaskFailed
 	return nil
 }
 
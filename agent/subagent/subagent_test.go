@@ -0,0 +1,687 @@
+package subagent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nanotalon/agent/tools"
+	"nanotalon/audit"
+	"nanotalon/bus"
+	"nanotalon/clock"
+	"nanotalon/providers"
+)
+
+// replyProvider answers every request with the same content
+type replyProvider struct {
+	content string
+}
+
+func (p *replyProvider) Chat(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	return &providers.ChatResponse{Content: p.content}, nil
+}
+
+func (p *replyProvider) GetDefaultModel() string {
+	return "test/reply"
+}
+
+func TestResultIsAnnouncedInOriginChat(t *testing.T) {
+	messageBus := bus.NewMessageBus()
+	manager := NewSubagentManager(&replyProvider{content: "Found 3 flights under $200"}, t.TempDir(), nil, "test/reply", 0, 0, "", true)
+	manager.SetMessageBus(messageBus)
+
+	label := "flights"
+	if _, err := manager.Spawn("Find cheap flights to Lisbon", &label, "telegram", "42"); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("Expected the result to be announced: %v", err)
+	}
+	if msg.Channel != "telegram" || msg.ChatID != "42" || msg.SenderID != SenderID {
+		t.Errorf("Expected an announcement from the subagent in telegram:42, got %+v", msg)
+	}
+	for _, want := range []string{"Subagent [flights] finished", "Task: Find cheap flights to Lisbon", "Found 3 flights under $200"} {
+		if !strings.Contains(msg.Content, want) {
+			t.Errorf("Expected %q in the announcement, got %q", want, msg.Content)
+		}
+	}
+}
+
+func TestTasksPersistAcrossRestarts(t *testing.T) {
+	storePath := DefaultStorePath(t.TempDir())
+	fc := clock.NewFake(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	manager := NewSubagentManager(&replyProvider{content: "Report written"}, t.TempDir(), nil, "test/reply", 0, 0, "", true)
+	manager.SetClock(fc)
+	manager.SetMessageBus(bus.NewMessageBus())
+	if err := manager.SetStorePath(storePath); err != nil {
+		t.Fatalf("SetStorePath failed: %v", err)
+	}
+	if _, err := manager.Spawn("Write the weekly report", nil, "slack", "C1"); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+
+	waitForStatus(t, manager, taskIDByLabel(t, manager, "Write the weekly report"), TaskCompleted)
+	history := manager.History(0)
+	if len(history) != 1 || history[0].Status != TaskCompleted || history[0].Result != "Report written" || history[0].FinishedAt == nil {
+		t.Fatalf("Expected the finished task in the history, got %+v", history)
+	}
+
+	// A restart finds a task that was running and two waiting for dependencies
+	started := time.Now()
+	task := func(id, status string, dependencies ...string) string {
+		return mustJSON(t, map[string]interface{}{"id": id, "label": id, "task": "Work on " + id, "status": status,
+			"created_at": started, "dependencies": dependencies, "origin_channel": "slack", "origin_chat_id": "C1"})
+	}
+	store := `{"tasks": [` + task("crawl", "running") + `, ` + task("report", "pending", history[0].ID) + `, ` +
+		task("summarize", "pending", "crawl") + `], "history": ` + mustJSON(t, history) + `}`
+	if err := os.WriteFile(storePath, []byte(store), 0644); err != nil {
+		t.Fatalf("Failed to write task store: %v", err)
+	}
+
+	restarted := NewSubagentManager(&replyProvider{content: "Sent"}, t.TempDir(), nil, "test/reply", 0, 0, "", true)
+	if err := restarted.SetStorePath(storePath); err != nil {
+		t.Fatalf("SetStorePath failed: %v", err)
+	}
+
+	// The running task can't be resumed; the waiting ones go on once their dependencies finish
+	if crawl, ok := restarted.Task("crawl"); !ok || crawl.Status != TaskInterrupted {
+		t.Errorf("Expected the running task recorded as interrupted, got %+v", crawl)
+	}
+	waitForStatus(t, restarted, "report", TaskCompleted)
+	waitForStatus(t, restarted, "summarize", TaskFailed)
+	if summarize, _ := restarted.Task("summarize"); summarize.Result != "Error: dependency task crawl interrupted" {
+		t.Errorf("Expected the dependent of the interrupted task to fail, got %q", summarize.Result)
+	}
+
+	tasks, err := LoadTaskHistory(storePath)
+	if err != nil {
+		t.Fatalf("LoadTaskHistory failed: %v", err)
+	}
+	if len(tasks) != 4 || tasks[3].Result != "Report written" {
+		t.Errorf("Unexpected persisted tasks: %+v", tasks)
+	}
+}
+
+func mustJSON(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	return string(data)
+}
+
+// blockingProvider answers once the request is cancelled
+type blockingProvider struct{}
+
+func (p *blockingProvider) Chat(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (p *blockingProvider) GetDefaultModel() string {
+	return "test/blocking"
+}
+
+func TestListAndCancelSubagents(t *testing.T) {
+	fc := clock.NewFake(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	storePath := DefaultStorePath(t.TempDir())
+	manager := NewSubagentManager(&blockingProvider{}, t.TempDir(), nil, "test/blocking", 0, 0, "", true)
+	manager.SetClock(fc)
+	if err := manager.SetStorePath(storePath); err != nil {
+		t.Fatalf("SetStorePath failed: %v", err)
+	}
+	fc.BlockUntil(1) // The watch for cancel requests from other processes
+
+	crawl, summarize := "crawl", "summarize"
+	if _, err := manager.Spawn("Crawl the docs", &crawl, "slack", "C1"); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	crawlID := manager.Tasks()[0].ID
+	fc.Advance(time.Second)
+	if _, err := manager.Spawn("Summarize the crawl", &summarize, "slack", "C1", crawlID); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	summarizeID := manager.Tasks()[1].ID
+
+	listed, err := NewListTool(manager).Call(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("subagent_list failed: %v", err)
+	}
+	for _, want := range []string{
+		"- crawl (id: " + ShortID(crawlID) + ", running, started 1s ago)",
+		"- summarize (id: " + ShortID(summarizeID) + ", pending, started 0s ago)\n  Depends on: crawl (id: " + ShortID(crawlID) + ", running)",
+	} {
+		if !strings.Contains(listed, want) {
+			t.Errorf("Expected %q in the list, got %q", want, listed)
+		}
+	}
+
+	// Cancelling from another process goes through the store, and takes short IDs too
+	if err := RequestCancel(storePath, ShortID(summarizeID)); err != nil {
+		t.Fatalf("RequestCancel failed: %v", err)
+	}
+	fc.Advance(cancelPollInterval)
+	waitForStatus(t, manager, summarizeID, TaskCancelled)
+
+	// Cancelling from the agent stops the running task
+	if result, err := NewCancelTool(manager).Call(map[string]interface{}{"id": ShortID(crawlID)}); err != nil || result != "Subagent "+ShortID(crawlID)+" cancelled" {
+		t.Fatalf("subagent_cancel returned %q (err %v)", result, err)
+	}
+	waitForStatus(t, manager, crawlID, TaskCancelled)
+	status, err := NewStatusTool(manager).Call(map[string]interface{}{"id": crawlID})
+	if err != nil || !strings.Contains(status, "cancelled") || !strings.Contains(status, "Result: Cancelled before it finished.") {
+		t.Errorf("Unexpected status %q (err %v)", status, err)
+	}
+	if err := RequestCancel(storePath, crawlID); err == nil || !strings.Contains(err.Error(), "already cancelled") {
+		t.Errorf("Expected cancelling a finished task to fail, got %v", err)
+	}
+}
+
+// taskIDByLabel finds the ID of the task spawned with the label
+func taskIDByLabel(t *testing.T, manager *SubagentManager, label string) string {
+	t.Helper()
+	for _, task := range manager.knownTasks() {
+		if task.Label == label {
+			return task.ID
+		}
+	}
+	t.Fatalf("No task labelled %s", label)
+	return ""
+}
+
+func TestTaskIDsAreUniqueAndShortIDsResolve(t *testing.T) {
+	fc := clock.NewFake(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	workspace := t.TempDir()
+	manager := NewSubagentManager(&blockingProvider{}, workspace, nil, "test/blocking", 0, 0, "", true)
+	manager.SetClock(fc)
+	defer func() {
+		// Wait for the cancelled tasks to write their results before the workspace is removed
+		for _, task := range manager.Tasks() {
+			manager.CancelTask(task.ID)
+			for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				if _, err := LoadResult(workspace, task.ID); err == nil {
+					break
+				}
+			}
+		}
+	}()
+
+	// Spawns in the same second used to get the same ID and replace each other
+	first, second := "first", "second"
+	for _, label := range []*string{&first, &second} {
+		if _, err := manager.Spawn("Wait", label, "cli", "direct"); err != nil {
+			t.Fatalf("Spawn failed: %v", err)
+		}
+	}
+	if manager.GetRunningCount() != 2 {
+		t.Fatalf("Expected two running tasks, got %d", manager.GetRunningCount())
+	}
+
+	firstID := taskIDByLabel(t, manager, first)
+	if id, err := manager.ResolveTaskID(ShortID(firstID)); err != nil || id != firstID {
+		t.Errorf("Expected the short ID to resolve to %s, got %q (err %v)", firstID, id, err)
+	}
+	if _, err := manager.ResolveTaskID("nope"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected an unknown ID to fail, got %v", err)
+	}
+	tasks := []SubagentTask{{ID: "abc123"}, {ID: "abd456"}}
+	if _, err := ResolveTaskID(tasks, "ab"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Expected an ambiguous prefix to fail, got %v", err)
+	}
+}
+
+// waitForStatus waits for a task to finish with the status and for the store to record it
+func waitForStatus(t *testing.T, manager *SubagentManager, taskID string, status TaskStatus) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		tasks, _ := LoadTaskHistory(manager.storePath)
+		for _, task := range tasks {
+			if task.ID != taskID || task.FinishedAt == nil {
+				continue
+			}
+			if task.Status != status {
+				t.Fatalf("Expected task %s to be %s, got %s", taskID, status, task.Status)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Task %s didn't finish", taskID)
+}
+
+// gatedProvider answers each task with its own text, once the gate is open
+type gatedProvider struct {
+	gate  chan struct{}
+	mu    sync.Mutex
+	tasks []string
+}
+
+func (p *gatedProvider) Chat(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	<-p.gate
+	task, _ := req.Messages[len(req.Messages)-1].Content.(string)
+	p.mu.Lock()
+	p.tasks = append(p.tasks, task)
+	p.mu.Unlock()
+	return &providers.ChatResponse{Content: "Done: " + task}, nil
+}
+
+func (p *gatedProvider) GetDefaultModel() string {
+	return "test/gated"
+}
+
+func TestDependentTaskStartsWhenDependencyCompletes(t *testing.T) {
+	fc := clock.NewFake(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	provider := &gatedProvider{gate: make(chan struct{})}
+	manager := NewSubagentManager(provider, t.TempDir(), nil, "test/gated", 0, 0, "", true)
+	manager.SetClock(fc)
+	if err := manager.SetStorePath(DefaultStorePath(t.TempDir())); err != nil {
+		t.Fatalf("SetStorePath failed: %v", err)
+	}
+
+	if _, err := manager.Spawn("Gather the numbers", nil, "cli", "direct"); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	gatherID := manager.Tasks()[0].ID
+	fc.Advance(time.Second)
+	result, err := manager.Spawn("Draft the report", nil, "cli", "direct", gatherID)
+	if err != nil || !strings.Contains(result, "scheduled") {
+		t.Fatalf("Expected the report to wait for the numbers, got %q (err %v)", result, err)
+	}
+	reportID := manager.Tasks()[1].ID
+	if status, _ := manager.GetTaskStatus(reportID); status != TaskPending {
+		t.Errorf("Expected the report to be pending, got %s", status)
+	}
+
+	close(provider.gate)
+	waitForStatus(t, manager, gatherID, TaskCompleted)
+	waitForStatus(t, manager, reportID, TaskCompleted)
+	if len(provider.tasks) != 2 || provider.tasks[0] != "Gather the numbers" || provider.tasks[1] != "Draft the report" {
+		t.Errorf("Expected the stages to run in order, got %v", provider.tasks)
+	}
+
+	// Depending on a task that failed is refused outright
+	manager.finishTask(&SubagentTask{ID: "broken", Status: TaskRunning}, &TaskResult{Status: TaskFailed, Summary: "Error: boom"})
+	if _, err := manager.Spawn("Use the broken output", nil, "cli", "direct", "broken"); err == nil || !strings.Contains(err.Error(), "dependency task broken failed") {
+		t.Errorf("Expected spawning after a failed dependency to fail, got %v", err)
+	}
+}
+
+// recordingProvider answers with the same content and records the requests
+type recordingProvider struct {
+	mu       sync.Mutex
+	requests []providers.ChatRequest
+}
+
+func (p *recordingProvider) Chat(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+	return &providers.ChatResponse{Content: "No vulnerable dependencies"}, nil
+}
+
+func (p *recordingProvider) GetDefaultModel() string {
+	return "test/recording"
+}
+
+func TestSpawnTemplate(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.MkdirAll(TemplatesDir(workspace), 0755); err != nil {
+		t.Fatalf("Failed to create templates directory: %v", err)
+	}
+	audit := "---\ndescription: Audit dependencies\nparameters: repo, branch=main\ntools: read_file, web_search\nmodel: test/small\n---\n" +
+		"Audit the dependencies of {{repo}} on branch {{ branch }}.\n"
+	if err := os.WriteFile(filepath.Join(TemplatesDir(workspace), "audit.md"), []byte(audit), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	broken := "---\nparameters: repo\n---\nSummarize {{repo}} for {{audience}}.\n"
+	if err := os.WriteFile(filepath.Join(TemplatesDir(workspace), "broken.md"), []byte(broken), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	template, err := LoadTemplate(workspace, "audit")
+	if err != nil {
+		t.Fatalf("LoadTemplate failed: %v", err)
+	}
+	if template.Description != "Audit dependencies" || template.Model != "test/small" || len(template.Tools) != 2 || len(template.Parameters) != 2 {
+		t.Errorf("Unexpected template: %+v", template)
+	}
+	if _, err := template.Render(map[string]string{"branch": "dev"}); err == nil || !strings.Contains(err.Error(), "needs a value for repo") {
+		t.Errorf("Expected a missing parameter to fail, got %v", err)
+	}
+	if _, err := template.Render(map[string]string{"repo": "x", "owner": "y"}); err == nil {
+		t.Errorf("Expected an unknown parameter to fail")
+	}
+	if _, err := LoadTemplate(workspace, "broken"); err == nil || !strings.Contains(err.Error(), "{{audience}}") {
+		t.Errorf("Expected an undeclared placeholder to fail, got %v", err)
+	}
+	if _, err := LoadTemplate(workspace, "../audit"); err == nil {
+		t.Errorf("Expected a path outside the templates directory to fail")
+	}
+
+	provider := &recordingProvider{}
+	fc := clock.NewFake(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	manager := NewSubagentManager(provider, workspace, nil, "test/default", 0, 0, "", true)
+	manager.SetClock(fc)
+	if err := manager.SetStorePath(DefaultStorePath(workspace)); err != nil {
+		t.Fatalf("SetStorePath failed: %v", err)
+	}
+	if _, err := manager.SpawnTemplate("audit", map[string]string{"repo": "nanotalon"}, "", ""); err != nil {
+		t.Fatalf("SpawnTemplate failed: %v", err)
+	}
+	taskID := taskIDByLabel(t, manager, "audit")
+	waitForStatus(t, manager, taskID, TaskCompleted)
+
+	task, _ := manager.Task(taskID)
+	if task.Template != "audit" || task.Label != "audit" || task.Task != "Audit the dependencies of nanotalon on branch main." {
+		t.Errorf("Unexpected task: %+v", task)
+	}
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if len(provider.requests) != 1 || provider.requests[0].Model != "test/small" {
+		t.Fatalf("Expected one request with the template's model, got %+v", provider.requests)
+	}
+	var tools []string
+	for _, def := range provider.requests[0].Tools {
+		tools = append(tools, def.Function.Name)
+	}
+	sort.Strings(tools)
+	if strings.Join(tools, ",") != "read_file,report_result,web_search" {
+		t.Errorf("Expected only the template's tools and report_result, got %v", tools)
+	}
+}
+
+func TestSubagentsKeepToTheChannelsTools(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.MkdirAll(TemplatesDir(workspace), 0755); err != nil {
+		t.Fatalf("Failed to create templates directory: %v", err)
+	}
+	audit := "---\ntools: read_file, web_search\n---\nAudit the dependencies.\n"
+	if err := os.WriteFile(filepath.Join(TemplatesDir(workspace), "audit.md"), []byte(audit), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	provider := &recordingProvider{}
+	manager := NewSubagentManager(provider, workspace, nil, "test/default", 0, 0, "", true)
+	manager.SetScratchpad(NewScratchpad(ScratchpadPath(workspace), clock.New()))
+	manager.SetToolPolicies(func(channel string) []*tools.ToolPolicy {
+		policies := []*tools.ToolPolicy{tools.NewToolPolicy(nil, []string{"web_fetch"})}
+		if channel == "telegram" {
+			policies = append(policies, tools.NewToolPolicy(nil, []string{"execute_command", "web_search", "scratchpad_write"}))
+		}
+		return policies
+	})
+	if err := manager.SetStorePath(DefaultStorePath(workspace)); err != nil {
+		t.Fatalf("SetStorePath failed: %v", err)
+	}
+
+	requestTools := func(taskID string) string {
+		waitForStatus(t, manager, taskID, TaskCompleted)
+		provider.mu.Lock()
+		defer provider.mu.Unlock()
+		var names []string
+		for _, def := range provider.requests[len(provider.requests)-1].Tools {
+			names = append(names, def.Function.Name)
+		}
+		sort.Strings(names)
+		return strings.Join(names, ",")
+	}
+
+	label := "from telegram"
+	if _, err := manager.Spawn("Look around", &label, "telegram", "42"); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	taskID := taskIDByLabel(t, manager, label)
+	if got := requestTools(taskID); got != "edit_file,list_directory,read_file,report_result,scratchpad_read,write_file" {
+		t.Errorf("Expected the telegram policy to apply, got %s", got)
+	}
+	if task, _ := manager.Task(taskID); strings.Join(task.DisabledTools, ",") != "execute_command,scratchpad_write,web_fetch,web_search" {
+		t.Errorf("Expected the disabled tools to be kept with the task, got %v", task.DisabledTools)
+	}
+
+	label = "from the cli"
+	if _, err := manager.Spawn("Look around", &label, "cli", "direct"); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	if got := requestTools(taskIDByLabel(t, manager, label)); got != "edit_file,execute_command,list_directory,read_file,report_result,scratchpad_read,scratchpad_write,web_search,write_file" {
+		t.Errorf("Expected only the global policy to apply, got %s", got)
+	}
+
+	// Templates can't bring back a tool the channel disables
+	if _, err := manager.SpawnTemplate("audit", nil, "telegram", "42"); err != nil {
+		t.Fatalf("SpawnTemplate failed: %v", err)
+	}
+	if got := requestTools(taskIDByLabel(t, manager, "audit")); got != "read_file,report_result,scratchpad_read" {
+		t.Errorf("Expected the template's tools the channel allows, got %s", got)
+	}
+}
+
+// scriptedProvider answers with its responses in turn
+type scriptedProvider struct {
+	mu        sync.Mutex
+	responses []*providers.ChatResponse
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.responses) == 0 {
+		return &providers.ChatResponse{Content: "Out of script"}, nil
+	}
+	response := p.responses[0]
+	p.responses = p.responses[1:]
+	return response, nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string {
+	return "test/scripted"
+}
+
+func TestStructuredResultWithArtifacts(t *testing.T) {
+	workspace := t.TempDir()
+	fc := clock.NewFake(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	notes := filepath.Join(workspace, "reports", "flights.md")
+
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{
+			ToolCalls: []providers.ToolCall{{ID: "1", Name: "write_file", Args: map[string]interface{}{"path": notes, "content": "# Flights\n"}}},
+			Usage:     providers.Usage{TotalTokens: 120},
+		},
+		{
+			ToolCalls: []providers.ToolCall{{ID: "2", Name: "report_result", Args: map[string]interface{}{
+				"summary":   "Found 3 flights under $200",
+				"artifacts": []interface{}{"missing.csv"},
+			}}},
+			Usage: providers.Usage{TotalTokens: 80},
+		},
+		{
+			ToolCalls: []providers.ToolCall{{ID: "3", Name: "report_result", Args: map[string]interface{}{
+				"summary":   "Found 3 flights under $200",
+				"artifacts": []interface{}{filepath.Join("reports", "flights.md")},
+			}}},
+			Usage: providers.Usage{TotalTokens: 50},
+		},
+	}}
+	messageBus := bus.NewMessageBus()
+	manager := NewSubagentManager(provider, workspace, nil, "test/scripted", 0, 0, "", true)
+	manager.SetClock(fc)
+	manager.SetMessageBus(messageBus)
+	if err := manager.SetStorePath(DefaultStorePath(workspace)); err != nil {
+		t.Fatalf("SetStorePath failed: %v", err)
+	}
+
+	label := "flights"
+	if _, err := manager.Spawn("Find cheap flights to Lisbon", &label, "telegram", "42"); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	taskID := taskIDByLabel(t, manager, label)
+	waitForStatus(t, manager, taskID, TaskCompleted)
+
+	result, err := LoadResult(workspace, taskID)
+	if err != nil {
+		t.Fatalf("LoadResult failed: %v", err)
+	}
+	artifact := filepath.Join("reports", "flights.md")
+	if result.Status != TaskCompleted || result.Summary != "Found 3 flights under $200" || result.Label != "flights" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if len(result.Artifacts) != 1 || result.Artifacts[0] != artifact {
+		t.Errorf("Expected the written file as the only artifact, got %v", result.Artifacts)
+	}
+	if result.Metrics.Iterations != 3 || result.Metrics.ToolCalls != 3 || result.Metrics.Tokens != 250 {
+		t.Errorf("Unexpected metrics: %+v", result.Metrics)
+	}
+
+	task, _ := manager.Task(taskID)
+	if task.Result != result.Summary || len(task.Artifacts) != 1 || task.Metrics == nil {
+		t.Errorf("Expected the task to record the result, got %+v", task)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("Expected the result to be announced: %v", err)
+	}
+	for _, want := range []string{"Found 3 flights under $200", "Files:\n- " + artifact, filepath.Join(ResultDir(workspace, taskID), "result.json")} {
+		if !strings.Contains(msg.Content, want) {
+			t.Errorf("Expected %q in the announcement, got %q", want, msg.Content)
+		}
+	}
+}
+
+func TestScratchpadIsSharedWithSubagents(t *testing.T) {
+	workspace := t.TempDir()
+	fc := clock.NewFake(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	scratchpad := NewScratchpad(ScratchpadPath(workspace), fc)
+
+	// The main agent leaves a note; the subagent reads it and adds its own
+	if _, err := NewScratchpadWriteTool(scratchpad, "main").Call(map[string]interface{}{"key": "sources", "content": "Use the Q1 sales sheet"}); err != nil {
+		t.Fatalf("scratchpad_write failed: %v", err)
+	}
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "1", Name: "scratchpad_read", Args: map[string]interface{}{"key": "sources"}}}},
+		{ToolCalls: []providers.ToolCall{{ID: "2", Name: "scratchpad_write", Args: map[string]interface{}{"key": "numbers", "content": "Revenue: $1.2M"}}}},
+		{Content: "Gathered the numbers"},
+	}}
+	manager := NewSubagentManager(provider, workspace, nil, "test/scripted", 0, 0, "", true)
+	manager.SetClock(fc)
+	manager.SetScratchpad(scratchpad)
+	if err := manager.SetStorePath(DefaultStorePath(workspace)); err != nil {
+		t.Fatalf("SetStorePath failed: %v", err)
+	}
+
+	label := "gather"
+	if _, err := manager.Spawn("Gather the numbers", &label, "cli", "direct"); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	taskID := taskIDByLabel(t, manager, label)
+	waitForStatus(t, manager, taskID, TaskCompleted)
+
+	entries, err := scratchpad.Entries("")
+	if err != nil {
+		t.Fatalf("Entries failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Author != "main" || entries[1].Author != "subagent gather ("+ShortID(taskID)+")" || entries[1].Key != "numbers" {
+		t.Fatalf("Expected a note from each agent, got %+v", entries)
+	}
+
+	read, err := NewScratchpadReadTool(scratchpad).Call(map[string]interface{}{"key": "numbers"})
+	if err != nil || !strings.Contains(read, "subagent gather ("+ShortID(taskID)+") on numbers:\nRevenue: $1.2M") || strings.Contains(read, "Q1 sales") {
+		t.Errorf("Expected only the note on numbers, got %q (err %v)", read, err)
+	}
+	if read, _ := NewScratchpadReadTool(scratchpad).Call(map[string]interface{}{"limit": float64(1)}); !strings.Contains(read, "Latest 1 of 2 notes") {
+		t.Errorf("Expected the read to be limited, got %q", read)
+	}
+}
+
+func TestSubagentToolsUseMaxOutputChars(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "big.txt"), []byte(strings.Repeat("a", 2000)), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	manager := NewSubagentManager(&replyProvider{}, workspace, nil, "test/reply", 0, 0, "", true)
+	read := func() string {
+		output, err := manager.buildTools().Execute("read_file", map[string]interface{}{"path": filepath.Join(workspace, "big.txt")})
+		if err != nil {
+			t.Fatalf("read_file failed: %v", err)
+		}
+		return output
+	}
+
+	if output := read(); strings.Contains(output, "characters omitted") {
+		t.Errorf("Expected the default limit to leave 2000 characters alone, got %q", output)
+	}
+
+	manager.SetMaxOutputChars(500)
+	if output := read(); !strings.Contains(output, "characters omitted") || len(output) > 1000 {
+		t.Errorf("Expected the output to be limited to the configured size, got %d characters", len(output))
+	}
+}
+
+func TestSubagentToolCallsAreAudited(t *testing.T) {
+	workspace := t.TempDir()
+	notes := filepath.Join(workspace, "notes.md")
+	provider := &scriptedProvider{responses: []*providers.ChatResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "1", Name: "write_file", Args: map[string]interface{}{"path": notes, "content": "# Notes\n"}}}},
+		{ToolCalls: []providers.ToolCall{{ID: "2", Name: "read_file", Args: map[string]interface{}{"path": filepath.Join(workspace, "missing.md")}}}},
+	}}
+	auditLog := audit.NewLogger(audit.DefaultPath(workspace))
+	manager := NewSubagentManager(provider, workspace, nil, "test/scripted", 0, 0, "", true)
+	manager.SetAuditLog(auditLog)
+	if err := manager.SetStorePath(DefaultStorePath(workspace)); err != nil {
+		t.Fatalf("SetStorePath failed: %v", err)
+	}
+
+	label := "notes"
+	if _, err := manager.Spawn("Write some notes", &label, "telegram", "42"); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	taskID := taskIDByLabel(t, manager, label)
+	waitForStatus(t, manager, taskID, TaskFailed)
+
+	entries, err := audit.ReadEntries(auditLog.Path(), audit.Filter{})
+	if err != nil {
+		t.Fatalf("ReadEntries failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected both tool calls in the audit log, got %+v", entries)
+	}
+	for _, entry := range entries {
+		if entry.Session != "subagent:"+taskID || entry.Channel != "telegram" {
+			t.Errorf("Expected the entry to name the task and its channel, got %+v", entry)
+		}
+	}
+	if entries[0].Tool != "write_file" || entries[0].Args["path"] != notes || entries[0].Error != "" {
+		t.Errorf("Unexpected write_file entry: %+v", entries[0])
+	}
+	// The failed call ends the task but is still recorded
+	if entries[1].Tool != "read_file" || entries[1].Error == "" {
+		t.Errorf("Expected the failed read_file call with its error, got %+v", entries[1])
+	}
+}
+
+func TestSubagentToolsHaveSchemas(t *testing.T) {
+	workspace := t.TempDir()
+	manager := NewSubagentManager(&replyProvider{}, workspace, nil, "test/reply", 0, 0, "", true)
+	registry := manager.buildTools()
+	registry.Register(NewReportTool(workspace, &TaskResult{}))
+	registry.Register(NewScratchpadWriteTool(NewScratchpad(ScratchpadPath(workspace), clock.New()), "subagent"))
+	registry.Register(NewScratchpadReadTool(NewScratchpad(ScratchpadPath(workspace), clock.New())))
+
+	for _, name := range registry.Names() {
+		if _, ok := registry.Get(name).(tools.SchemaTool); !ok {
+			t.Errorf("Tool %s doesn't describe its arguments with a schema", name)
+		}
+	}
+}
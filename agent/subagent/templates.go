@@ -0,0 +1,210 @@
+package subagent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// templateFrontmatter matches the "---" delimited header of a template file
+var templateFrontmatter = regexp.MustCompile(`(?s)^---\n(.*?)\n---\n?`)
+
+// templatePlaceholder matches a {{parameter}} in a template's task
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_-]+)\s*\}\}`)
+
+// Template is a reusable subagent task, kept as <workspace>/subagents/templates/<name>.md:
+//
+//	---
+//	description: Check a repository's dependencies for known vulnerabilities
+//	parameters: repo, branch=main
+//	tools: read_file, list_directory, execute_command, web_search
+//	model: openai/gpt-4o-mini
+//	---
+//	Audit the dependencies of {{repo}} on branch {{branch}} and list anything to upgrade.
+//
+// Every header line is optional. A parameter without a default must be given.
+type Template struct {
+	Name        string
+	Description string
+	Parameters  []TemplateParameter
+	Tools       []string // Limits the subagent's tools; empty for all of them
+	Model       string   // Overrides the default model
+	Task        string   // The task, with {{parameter}} placeholders
+}
+
+// TemplateParameter is a value filled into a template's task
+type TemplateParameter struct {
+	Name     string
+	Default  string
+	Required bool
+}
+
+// TemplatesDir returns where a workspace keeps its subagent templates
+func TemplatesDir(workspace string) string {
+	return filepath.Join(workspace, "subagents", "templates")
+}
+
+// LoadTemplate reads a template from the workspace by name
+func LoadTemplate(workspace, name string) (*Template, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid template name %q", name)
+	}
+
+	content, err := os.ReadFile(filepath.Join(TemplatesDir(workspace), name+".md"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("template %s not found in %s", name, TemplatesDir(workspace))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+	return parseTemplate(name, string(content))
+}
+
+// ListTemplates reads every template in the workspace, sorted by name
+func ListTemplates(workspace string) ([]*Template, error) {
+	entries, err := os.ReadDir(TemplatesDir(workspace))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	var templates []*Template
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".md")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		template, err := LoadTemplate(workspace, name)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// parseTemplate parses a template file's header and task
+func parseTemplate(name, content string) (*Template, error) {
+	template := &Template{Name: name}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if match := templateFrontmatter.FindStringSubmatch(content); match != nil {
+		content = content[len(match[0]):]
+		for _, line := range strings.Split(match[1], "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			value = strings.Trim(strings.TrimSpace(value), `"'`)
+			switch strings.TrimSpace(key) {
+			case "description":
+				template.Description = value
+			case "model":
+				template.Model = value
+			case "tools":
+				template.Tools = splitList(value)
+			case "parameters":
+				for _, param := range splitList(value) {
+					paramName, def, hasDefault := strings.Cut(param, "=")
+					template.Parameters = append(template.Parameters, TemplateParameter{
+						Name:     strings.TrimSpace(paramName),
+						Default:  strings.TrimSpace(def),
+						Required: !hasDefault,
+					})
+				}
+			}
+		}
+	}
+
+	template.Task = strings.TrimSpace(content)
+	if template.Task == "" {
+		return nil, fmt.Errorf("template %s has no task", name)
+	}
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(template.Task, -1) {
+		if template.parameter(match[1]) == nil {
+			return nil, fmt.Errorf("template %s uses {{%s}}, which isn't in its parameters", name, match[1])
+		}
+	}
+	return template, nil
+}
+
+// splitList splits a comma separated header value, also accepting a [a, b] list
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(strings.Trim(value, "[]"), ",") {
+		if item = strings.Trim(strings.TrimSpace(item), `"'`); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parameter looks up a parameter by name
+func (t *Template) parameter(name string) *TemplateParameter {
+	for i := range t.Parameters {
+		if t.Parameters[i].Name == name {
+			return &t.Parameters[i]
+		}
+	}
+	return nil
+}
+
+// Render fills the arguments into the task, using defaults for the parameters left out
+func (t *Template) Render(args map[string]string) (string, error) {
+	for name := range args {
+		if t.parameter(name) == nil {
+			return "", fmt.Errorf("template %s has no parameter %s", t.Name, name)
+		}
+	}
+
+	values := make(map[string]string, len(t.Parameters))
+	for _, param := range t.Parameters {
+		value, ok := args[param.Name]
+		if !ok {
+			if param.Required {
+				return "", fmt.Errorf("template %s needs a value for %s", t.Name, param.Name)
+			}
+			value = param.Default
+		}
+		values[param.Name] = value
+	}
+
+	return templatePlaceholder.ReplaceAllStringFunc(t.Task, func(placeholder string) string {
+		return values[templatePlaceholder.FindStringSubmatch(placeholder)[1]]
+	}), nil
+}
+
+// SpawnTemplate spawns a subagent for a workspace template filled in with args. Like Spawn,
+// the result is announced in the origin chat, if there is one.
+func (sm *SubagentManager) SpawnTemplate(name string, args map[string]string, originChannel, originChatID string) (string, error) {
+	template, err := LoadTemplate(sm.workspace, name)
+	if err != nil {
+		return "", err
+	}
+	task, err := template.Render(args)
+	if err != nil {
+		return "", err
+	}
+
+	available := sm.buildTools()
+	for _, tool := range template.Tools {
+		if available.Get(tool) == nil {
+			return "", fmt.Errorf("template %s allows unknown tool %s; subagents have %s", name, tool, strings.Join(available.Names(), ", "))
+		}
+	}
+
+	return sm.spawnTask(&SubagentTask{
+		Label:         name,
+		Task:          task,
+		OriginChannel: originChannel,
+		OriginChatID:  originChatID,
+		Template:      name,
+		Model:         template.Model,
+		Tools:         template.Tools,
+	})
+}
@@ -0,0 +1,260 @@
+package subagent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// recentFinished is how many finished tasks subagent_list shows
+const recentFinished = 5
+
+// FormatTask describes a task on one line, with a second line for its dependencies and
+// their status. known resolves dependency IDs; unknown ones are shown as such.
+func FormatTask(task SubagentTask, known map[string]SubagentTask, now time.Time) string {
+	line := fmt.Sprintf("- %s (id: %s, %s, %s)", task.Label, ShortID(task.ID), task.Status, formatAge(task, now))
+	if len(task.Dependencies) == 0 {
+		return line
+	}
+
+	deps := make([]string, 0, len(task.Dependencies))
+	for _, depID := range task.Dependencies {
+		if dep, ok := known[depID]; ok {
+			deps = append(deps, fmt.Sprintf("%s (id: %s, %s)", dep.Label, ShortID(dep.ID), dep.Status))
+		} else {
+			deps = append(deps, fmt.Sprintf("%s (unknown)", ShortID(depID)))
+		}
+	}
+	return line + "\n  Depends on: " + strings.Join(deps, ", ")
+}
+
+// FormatTasks describes tasks one after another, resolving dependencies among them
+func FormatTasks(tasks []SubagentTask, now time.Time) string {
+	known := make(map[string]SubagentTask, len(tasks))
+	for _, task := range tasks {
+		known[task.ID] = task
+	}
+
+	lines := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		lines = append(lines, FormatTask(task, known, now))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FormatTaskDetails describes a task in full, result included
+func FormatTaskDetails(task SubagentTask, known map[string]SubagentTask, now time.Time) string {
+	var details strings.Builder
+	details.WriteString(FormatTask(task, known, now))
+	details.WriteString("\n  ID: " + task.ID)
+	details.WriteString("\n  Task: " + task.Task)
+	if task.OriginChannel != "" {
+		details.WriteString(fmt.Sprintf("\n  Asked in: %s:%s", task.OriginChannel, task.OriginChatID))
+	}
+	details.WriteString("\n  Created: " + task.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	if task.FinishedAt != nil {
+		details.WriteString("\n  Finished: " + task.FinishedAt.Format("2006-01-02 15:04:05 MST"))
+	}
+	if task.Result != "" {
+		details.WriteString("\n  Result: " + task.Result)
+	}
+	if len(task.Artifacts) > 0 {
+		details.WriteString("\n  Artifacts: " + strings.Join(task.Artifacts, ", "))
+	}
+	if task.Metrics != nil {
+		details.WriteString(fmt.Sprintf("\n  Metrics: %d iterations, %d tool calls, %d tokens, %s",
+			task.Metrics.Iterations, task.Metrics.ToolCalls, task.Metrics.Tokens,
+			roundDuration(time.Duration(task.Metrics.DurationMS)*time.Millisecond)))
+	}
+	return details.String()
+}
+
+// formatAge tells how long ago a task was created, or how long it took once finished
+func formatAge(task SubagentTask, now time.Time) string {
+	if task.FinishedAt != nil {
+		return "took " + roundDuration(task.FinishedAt.Sub(task.CreatedAt))
+	}
+	return "started " + roundDuration(now.Sub(task.CreatedAt)) + " ago"
+}
+
+// roundDuration rounds to seconds, or to minutes past an hour
+func roundDuration(d time.Duration) string {
+	if d >= time.Hour {
+		return d.Round(time.Minute).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// knownTasks maps the manager's pending, running and finished tasks by ID
+func (sm *SubagentManager) knownTasks() map[string]SubagentTask {
+	known := make(map[string]SubagentTask)
+	for _, task := range sm.History(0) {
+		known[task.ID] = task
+	}
+	for _, task := range sm.Tasks() {
+		known[task.ID] = task
+	}
+	return known
+}
+
+// ListTool implements a tool to list background subagents
+type ListTool struct {
+	manager *SubagentManager
+}
+
+// NewListTool creates a new subagent list tool
+func NewListTool(manager *SubagentManager) *ListTool {
+	return &ListTool{manager: manager}
+}
+
+// Name returns the name of the tool
+func (t *ListTool) Name() string {
+	return "subagent_list"
+}
+
+// Description returns the description of the tool
+func (t *ListTool) Description() string {
+	return "List background subagents that are waiting or running, and the most recently finished ones, with their dependencies"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ListTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+		"required":   []string{},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *ListTool) Call(args map[string]interface{}) (string, error) {
+	now := t.manager.clock.Now()
+	known := t.manager.knownTasks()
+	active := t.manager.Tasks()
+	finished := t.manager.History(recentFinished)
+	if len(active) == 0 && len(finished) == 0 {
+		return "No subagents.", nil
+	}
+
+	var result strings.Builder
+	if len(active) == 0 {
+		result.WriteString("No subagents are waiting or running.\n")
+	} else {
+		result.WriteString("Waiting or running:\n")
+		for _, task := range active {
+			result.WriteString(FormatTask(task, known, now) + "\n")
+		}
+	}
+	if len(finished) > 0 {
+		result.WriteString("Recently finished:\n")
+		for _, task := range finished {
+			result.WriteString(FormatTask(task, known, now) + "\n")
+		}
+	}
+	return result.String(), nil
+}
+
+// StatusTool implements a tool to show a subagent in full
+type StatusTool struct {
+	manager *SubagentManager
+}
+
+// NewStatusTool creates a new subagent status tool
+func NewStatusTool(manager *SubagentManager) *StatusTool {
+	return &StatusTool{manager: manager}
+}
+
+// Name returns the name of the tool
+func (t *StatusTool) Name() string {
+	return "subagent_status"
+}
+
+// Description returns the description of the tool
+func (t *StatusTool) Description() string {
+	return "Show a subagent's task, status, dependencies and, once finished, its result"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *StatusTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{"type": "string", "description": "The subagent's id, or enough of its start to be unique"},
+		},
+		"required": []string{"id"},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *StatusTool) Call(args map[string]interface{}) (string, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing 'id' argument")
+	}
+
+	id, err := t.manager.ResolveTaskID(id)
+	if err != nil {
+		return "", err
+	}
+	task, ok := t.manager.Task(id)
+	if !ok {
+		return "", fmt.Errorf("no such subagent: %s", id)
+	}
+	return FormatTaskDetails(task, t.manager.knownTasks(), t.manager.clock.Now()), nil
+}
+
+// CancelTool implements a tool to cancel a subagent
+type CancelTool struct {
+	manager *SubagentManager
+}
+
+// NewCancelTool creates a new subagent cancel tool
+func NewCancelTool(manager *SubagentManager) *CancelTool {
+	return &CancelTool{manager: manager}
+}
+
+// Name returns the name of the tool
+func (t *CancelTool) Name() string {
+	return "subagent_cancel"
+}
+
+// Description returns the description of the tool
+func (t *CancelTool) Description() string {
+	return "Cancel a subagent that is waiting or running, by its id"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *CancelTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{"type": "string", "description": "The subagent's id, or enough of its start to be unique"},
+		},
+		"required": []string{"id"},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *CancelTool) Call(args map[string]interface{}) (string, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing 'id' argument")
+	}
+
+	id, err := t.manager.ResolveTaskID(id)
+	if err != nil {
+		return "", err
+	}
+	task, ok := t.manager.Task(id)
+	if !ok {
+		return "", fmt.Errorf("no such subagent: %s", id)
+	}
+	if task.FinishedAt != nil {
+		return fmt.Sprintf("Subagent %s already %s", ShortID(id), task.Status), nil
+	}
+
+	if err := t.manager.CancelTask(id); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Subagent %s cancelled", ShortID(id)), nil
+}
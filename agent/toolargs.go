@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"nanotalon/agent/tools"
+	"nanotalon/providers"
+)
+
+// defaultMaxToolRetries is used when agents.defaults.max_tool_retries isn't set
+const defaultMaxToolRetries = 3
+
+// invalidToolCall is the structured error fed back to the model for a call that couldn't
+// run because its arguments didn't parse or didn't match the tool's schema
+type invalidToolCall struct {
+	Error       string `json:"error"`
+	Tool        string `json:"tool"`
+	Message     string `json:"message"`
+	Received    string `json:"received,omitempty"`
+	RetriesLeft int    `json:"retries_left"`
+	Hint        string `json:"hint"`
+}
+
+// checkToolCall returns why a call can't run as sent, or nil if it is well-formed
+func checkToolCall(toolRegistry *tools.ToolRegistry, tc providers.ToolCall) error {
+	if tc.ArgsError != "" {
+		return fmt.Errorf("arguments are not valid JSON: %s", tc.ArgsError)
+	}
+	return toolRegistry.ValidateArgs(tc.Name, tc.Args)
+}
+
+// invalidToolCallResult renders the tool result telling the model what to fix
+func invalidToolCallResult(tc providers.ToolCall, problem error, retriesLeft int) string {
+	received := tc.RawArgs
+	if received == "" {
+		args, _ := json.Marshal(tc.Args)
+		received = string(args)
+	}
+	if retriesLeft < 0 {
+		retriesLeft = 0
+	}
+
+	result, _ := json.Marshal(invalidToolCall{
+		Error:       "invalid_tool_call",
+		Tool:        tc.Name,
+		Message:     problem.Error(),
+		Received:    received,
+		RetriesLeft: retriesLeft,
+		Hint:        "The tool was not run. Send the call again with arguments that are valid JSON and match the tool's parameters.",
+	})
+	return string(result)
+}
@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Attacher is implemented by tools whose calls attach a file to the agent's reply
+type Attacher interface {
+	Tool
+	// AttachmentPath returns the absolute path of the file a call attaches
+	AttachmentPath(args map[string]interface{}) (string, error)
+}
+
+// AttachFileTool lets the agent send files it created, such as reports or images, along
+// with its reply. Relative paths are resolved against the workspace.
+type AttachFileTool struct {
+	workspace  string
+	allowedDir string // If set, only files inside this directory can be sent
+}
+
+// NewAttachFileTool creates a new attach file tool
+func NewAttachFileTool(workspace string, allowedDir string) *AttachFileTool {
+	return &AttachFileTool{
+		workspace:  workspace,
+		allowedDir: allowedDir,
+	}
+}
+
+// Name returns the name of the tool
+func (t *AttachFileTool) Name() string {
+	return "attach_file"
+}
+
+// Description returns the description of the tool
+func (t *AttachFileTool) Description() string {
+	return "Send a file to the user along with your reply, e.g. a report, image or export you created. " +
+		"Relative paths are resolved against the workspace."
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *AttachFileTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{"type": "string", "description": "Path of the file to send"},
+		},
+		"required": []string{"path"},
+	}
+}
+
+// Call checks the file can be sent; the agent delivers it with the reply
+func (t *AttachFileTool) Call(args map[string]interface{}) (string, error) {
+	path, err := t.AttachmentPath(args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Attached %s; it will be sent with your reply.", filepath.Base(path)), nil
+}
+
+// AttachmentPath returns the absolute path of the file a call attaches
+func (t *AttachFileTool) AttachmentPath(args map[string]interface{}) (string, error) {
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return "", fmt.Errorf("missing 'path' argument")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(t.workspace, path)
+	}
+
+	if err := checkPathAllowed(path, t.allowedDir); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	return filepath.Clean(path), nil
+}
@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits on the answers one offer_choices call can offer
+const (
+	maxChoices     = 8
+	maxChoiceChars = 40
+)
+
+// Chooser is implemented by tools whose calls offer the user answers to pick from
+type Chooser interface {
+	Tool
+	// Choices returns the answers a call offers
+	Choices(args map[string]interface{}) ([]string, error)
+}
+
+// OfferChoicesTool lets the agent offer the user a few answers to a question, such as
+// yes/no before creating a cron job or the options of a multiple-choice question. Channels
+// that can show buttons show them under the reply; picking one sends its text back.
+type OfferChoicesTool struct{}
+
+// NewOfferChoicesTool creates a new offer choices tool
+func NewOfferChoicesTool() *OfferChoicesTool {
+	return &OfferChoicesTool{}
+}
+
+// Name returns the name of the tool
+func (t *OfferChoicesTool) Name() string {
+	return "offer_choices"
+}
+
+// Description returns the description of the tool
+func (t *OfferChoicesTool) Description() string {
+	return "Offer the user a few short answers to the question in your reply, e.g. \"Yes\" and \"No\" before " +
+		"creating a scheduled task, or the options of a multiple-choice question. Where the chat supports it they " +
+		"appear as buttons; the answer picked comes back as the user's next message. Still ask the question in your reply."
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *OfferChoicesTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"choices": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": fmt.Sprintf("Between 2 and %d short answers, at most %d characters each", maxChoices, maxChoiceChars),
+			},
+		},
+		"required": []string{"choices"},
+	}
+}
+
+// Call checks the choices; the agent shows them with the reply
+func (t *OfferChoicesTool) Call(args map[string]interface{}) (string, error) {
+	choices, err := t.Choices(args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Offering %s with your reply.", strings.Join(choices, " / ")), nil
+}
+
+// Choices returns the answers a call offers
+func (t *OfferChoicesTool) Choices(args map[string]interface{}) ([]string, error) {
+	raw, ok := args["choices"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("missing 'choices' argument")
+	}
+
+	var choices []string
+	for _, item := range raw {
+		choice, ok := item.(string)
+		choice = strings.TrimSpace(choice)
+		if !ok || choice == "" {
+			return nil, fmt.Errorf("choices must be non-empty strings")
+		}
+		if len([]rune(choice)) > maxChoiceChars {
+			return nil, fmt.Errorf("choice %q is longer than %d characters", choice, maxChoiceChars)
+		}
+		choices = append(choices, choice)
+	}
+	if len(choices) < 2 || len(choices) > maxChoices {
+		return nil, fmt.Errorf("offer between 2 and %d choices, got %d", maxChoices, len(choices))
+	}
+	return choices, nil
+}
@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Command filter modes, as used in tools.exec.safety.mode
+const (
+	CommandFilterApprove = "approve" // Matching commands wait for the user's approval
+	CommandFilterRefuse  = "refuse"  // Matching commands are refused outright
+	CommandFilterOff     = "off"     // No filtering
+)
+
+// CommandRule flags shell commands matching Pattern, a regular expression.
+// Reason completes the sentence "the command ...".
+type CommandRule struct {
+	Pattern string
+	Reason  string
+}
+
+// credentialPaths matches files that commonly hold secrets
+const credentialPaths = `(\.ssh/|id_rsa|id_ecdsa|id_ed25519|\.aws/credentials|\.netrc|\.git-credentials|\.kube/config|\.docker/config\.json|\.gnupg/|/etc/shadow|\.env\b)`
+
+// networkCommands matches commands that can send data off the machine
+const networkCommands = `\b(curl|wget|nc|ncat|netcat|scp|sftp|ftp|rsync|telnet|socat)\b`
+
+// DefaultCommandRules are the built-in rules; configured rules are added to them
+var DefaultCommandRules = []CommandRule{
+	{
+		Pattern: `\brm\s+(-\S+\s+)*-[a-zA-Z]*[rR][a-zA-Z]*\s+(-\S+\s+)*(/|/\*|~|~/|\$HOME|\$HOME/)(\s|;|&|\||$)`,
+		Reason:  "recursively deletes the filesystem root or the home directory",
+	},
+	{
+		Pattern: `\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z|da|k|fi)?sh\b`,
+		Reason:  "pipes a downloaded script straight into a shell",
+	},
+	{
+		Pattern: `:\s*\(\s*\)\s*\{[^}]*:\s*\|\s*:`,
+		Reason:  "is a fork bomb",
+	},
+	{
+		Pattern: `\bmkfs(\.\w+)?\b|\bdd\b.*\bof=/dev/|>\s*/dev/(sd|nvme|hd|disk)`,
+		Reason:  "overwrites a disk or formats a filesystem",
+	},
+	{
+		Pattern: `\bchmod\s+(-\S+\s+)*-[a-zA-Z]*R[a-zA-Z]*\s+\S+\s+/(\s|$)`,
+		Reason:  "changes permissions of the whole filesystem",
+	},
+	{
+		Pattern: networkCommands + `.*` + credentialPaths + `|` + credentialPaths + `.*` + networkCommands,
+		Reason:  "sends credentials or keys over the network",
+	},
+	{
+		Pattern: `\b(env|printenv)\b[^|]*\|\s*.*` + networkCommands,
+		Reason:  "sends environment variables, which often hold secrets, over the network",
+	},
+}
+
+// CommandFilter checks shell commands against deny rules before they run.
+// Commands matching an allow pattern are never flagged.
+type CommandFilter struct {
+	mode  string
+	deny  []compiledRule
+	allow []*regexp.Regexp
+}
+
+// compiledRule is a CommandRule with its pattern compiled
+type compiledRule struct {
+	pattern *regexp.Regexp
+	reason  string
+}
+
+// NewCommandFilter builds a filter from the built-in rules plus extra deny rules and allow
+// patterns. It returns nil, which allows everything, when mode is "off".
+func NewCommandFilter(mode string, deny []CommandRule, allow []string) (*CommandFilter, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		mode = CommandFilterApprove
+	case CommandFilterApprove, CommandFilterRefuse:
+	case CommandFilterOff:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown command filter mode %q (use %s, %s or %s)",
+			mode, CommandFilterApprove, CommandFilterRefuse, CommandFilterOff)
+	}
+
+	f := &CommandFilter{mode: mode}
+	for _, rule := range append(append([]CommandRule(nil), DefaultCommandRules...), deny...) {
+		pattern, err := regexp.Compile(`(?i)` + rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", rule.Pattern, err)
+		}
+		reason := rule.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("matches the deny pattern %q", rule.Pattern)
+		}
+		f.deny = append(f.deny, compiledRule{pattern: pattern, reason: reason})
+	}
+	for _, expr := range allow {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow pattern %q: %w", expr, err)
+		}
+		f.allow = append(f.allow, pattern)
+	}
+	return f, nil
+}
+
+// CommandBlockedError is returned for commands stopped by the filter
+type CommandBlockedError struct {
+	Command       string
+	Reason        string
+	NeedsApproval bool
+}
+
+func (e *CommandBlockedError) Error() string {
+	if e.NeedsApproval {
+		return fmt.Sprintf("the command needs the user's approval because it %s", e.Reason)
+	}
+	return fmt.Sprintf("the command was refused because it %s", e.Reason)
+}
+
+// Check returns a *CommandBlockedError if the command matches a deny rule, or nil
+func (f *CommandFilter) Check(command string) error {
+	if f == nil {
+		return nil
+	}
+	for _, pattern := range f.allow {
+		if pattern.MatchString(command) {
+			return nil
+		}
+	}
+	for _, rule := range f.deny {
+		if rule.pattern.MatchString(command) {
+			return &CommandBlockedError{
+				Command:       command,
+				Reason:        rule.reason,
+				NeedsApproval: f.mode == CommandFilterApprove,
+			}
+		}
+	}
+	return nil
+}
+
+// Strict returns a copy of the filter that refuses commands instead of asking for
+// approval, for runs with no user to ask
+func (f *CommandFilter) Strict() *CommandFilter {
+	if f == nil {
+		return nil
+	}
+	strict := *f
+	strict.mode = CommandFilterRefuse
+	return &strict
+}
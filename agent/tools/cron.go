@@ -2,6 +2,8 @@ package tools
 
 import (
 	"fmt"
+	"strings"
+	"time"
 	"nanotalon/cron"
 )
 
@@ -19,10 +21,14 @@ func NewCronTool(cronService *cron.CronService) *CronTool {
 	}
 }
 
-// SetContext sets the current session context for delivery
-func (t *CronTool) SetContext(channel string, chatID string) {
-	t.channel = channel
-	t.chatID = chatID
+// ForChat returns a copy of the tool that schedules jobs for delivery to a chat. The agent
+// binds one per turn, since turns of different chats run at the same time.
+func (t *CronTool) ForChat(channel, chatID string) *CronTool {
+	return &CronTool{
+		cronService: t.cronService,
+		channel:     channel,
+		chatID:      chatID,
+	}
 }
 
 // Name returns the name of the tool
@@ -32,7 +38,31 @@ func (t *CronTool) Name() string {
 
 // Description returns the description of the tool
 func (t *CronTool) Description() string {
-	return "Schedule reminders and recurring tasks. Actions: add, list, remove."
+	return "Schedule reminders and recurring tasks. Actions: add, list, remove, update."
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *CronTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action":         map[string]interface{}{"type": "string", "enum": []string{"add", "list", "remove", "update"}, "description": "What to do"},
+			"message":        map[string]interface{}{"type": "string", "description": "Reminder or task text (add, update)"},
+			"every_seconds":  map[string]interface{}{"type": "integer", "minimum": 1, "description": "Repeat at this interval (add, update)"},
+			"cron_expr":      map[string]interface{}{"type": "string", "description": "Cron expression such as \"0 9 * * 1-5\" (add, update)"},
+			"at":             map[string]interface{}{"type": "string", "description": "Run once at this time: RFC3339, \"2006-01-02 15:04\" or \"15:04\" for its next occurrence (add, update)"},
+			"tz":             map[string]interface{}{"type": "string", "description": "IANA timezone for cron_expr and at, e.g. Europe/Berlin (default local time)"},
+			"catch_up":       map[string]interface{}{"type": "string", "enum": []string{cron.CatchUpSkip, cron.CatchUpRunOnce, cron.CatchUpRunAll}, "description": "What to do with runs missed while stopped"},
+			"overlap":        map[string]interface{}{"type": "string", "enum": []string{cron.OverlapSkip, cron.OverlapDelay, cron.OverlapAllow}, "description": "What to do when a run is due while the previous one is still going"},
+			"jitter_seconds": map[string]interface{}{"type": "number", "minimum": 0, "description": "Delay each run by up to this many random seconds"},
+			"job_id":         map[string]interface{}{"type": "string", "description": "Job to change (remove, update)"},
+			"name":           map[string]interface{}{"type": "string", "description": "New job name (update)"},
+			"deliver":        map[string]interface{}{"type": "boolean", "description": "Whether the response of each run is sent to the chat (update)"},
+			"channel":        map[string]interface{}{"type": "string", "description": "Channel to deliver to instead of this chat's (update)"},
+			"to":             map[string]interface{}{"type": "string", "description": "Chat to deliver to instead of this one (update)"},
+		},
+		"required": []string{"action"},
+	}
 }
 
 // Call executes the tool with the given arguments
@@ -49,6 +79,8 @@ func (t *CronTool) Call(args map[string]interface{}) (string, error) {
 		return t.listJobs()
 	case "remove":
 		return t.removeJob(args)
+	case "update":
+		return t.updateJob(args)
 	default:
 		return "", fmt.Errorf("unknown action: %s", action)
 	}
@@ -65,47 +97,190 @@ func (t *CronTool) addJob(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("no session context (channel/chat_id)")
 	}
 
-	// Parse schedule options
-	var schedule cron.CronSchedule
-	var err error
+	schedule, at, ok, err := scheduleFromArgs(args)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("either 'every_seconds', 'cron_expr', or 'at' is required for add action")
+	}
+
+	if catchUp, ok := args["catch_up"].(string); ok {
+		schedule.CatchUp = catchUp
+	}
+	if overlap, ok := args["overlap"].(string); ok {
+		schedule.Overlap = overlap
+	}
+	if jitter, ok := args["jitter_seconds"].(float64); ok {
+		schedule.JitterMS = int64(jitter * 1000)
+	}
+
+	// Add the job to cron service
+	job, err := t.cronService.AddJob(message, schedule, message, true, t.chatID, t.channel, schedule.Kind == "at")
+	if err != nil {
+		return "", fmt.Errorf("failed to add job: %w", err)
+	}
+
+	if schedule.Kind == "at" {
+		return fmt.Sprintf("Created one-time job '%s' (id: %s), runs at %s", job.Name, job.ID, at.Format(atConfirmFormat)), nil
+	}
+	return fmt.Sprintf("Created job '%s' (id: %s)", job.Name, job.ID), nil
+}
+
+// updateJob changes the schedule, message or delivery of a scheduled job
+func (t *CronTool) updateJob(args map[string]interface{}) (string, error) {
+	jobID, ok := args["job_id"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing 'job_id' argument for update action")
+	}
+	current := t.cronService.GetJob(jobID)
+	if current == nil {
+		return fmt.Sprintf("Job %s not found", jobID), nil
+	}
+
+	var update cron.JobUpdate
+	if name, ok := args["name"].(string); ok {
+		update.Name = &name
+	}
+	if message, ok := args["message"].(string); ok {
+		update.Message = &message
+	}
+	if deliver, ok := args["deliver"].(bool); ok {
+		update.Deliver = &deliver
+	}
+	if to, ok := args["to"].(string); ok {
+		update.To = &to
+	}
+	if channel, ok := args["channel"].(string); ok {
+		update.Channel = &channel
+	}
+
+	// Policies carry over to a new schedule unless they are changed too
+	schedule, at, newSchedule, err := scheduleFromArgs(args)
+	if err != nil {
+		return "", err
+	}
+	if !newSchedule {
+		schedule = current.Schedule
+	} else {
+		schedule.CatchUp = current.Schedule.CatchUp
+		schedule.Overlap = current.Schedule.Overlap
+		schedule.JitterMS = current.Schedule.JitterMS
+	}
+	catchUp, changeCatchUp := args["catch_up"].(string)
+	if changeCatchUp {
+		schedule.CatchUp = catchUp
+	}
+	overlap, changeOverlap := args["overlap"].(string)
+	if changeOverlap {
+		schedule.Overlap = overlap
+	}
+	jitter, changeJitter := args["jitter_seconds"].(float64)
+	if changeJitter {
+		schedule.JitterMS = int64(jitter * 1000)
+	}
+	if newSchedule || changeCatchUp || changeOverlap || changeJitter {
+		update.Schedule = &schedule
+	}
+	if newSchedule {
+		// Like added ones, one-time jobs are removed once they have run
+		deleteAfterRun := schedule.Kind == "at"
+		update.DeleteAfterRun = &deleteAfterRun
+	}
+
+	if update == (cron.JobUpdate{}) {
+		return "", fmt.Errorf("nothing to update, give a new schedule, message or delivery")
+	}
 
+	job, err := t.cronService.UpdateJob(jobID, update)
+	if err != nil {
+		return "", fmt.Errorf("failed to update job: %w", err)
+	}
+
+	if newSchedule && schedule.Kind == "at" {
+		return fmt.Sprintf("Updated job '%s' (id: %s), runs once at %s", job.Name, job.ID, at.Format(atConfirmFormat)), nil
+	}
+	return fmt.Sprintf("Updated job '%s' (id: %s)", job.Name, job.ID), nil
+}
+
+// scheduleFromArgs builds a schedule from the every_seconds, cron_expr, at and tz arguments,
+// reporting false if none of them is given. For 'at' it also returns the resolved time.
+func scheduleFromArgs(args map[string]interface{}) (cron.CronSchedule, time.Time, bool, error) {
 	if everySeconds, ok := args["every_seconds"].(float64); ok {
 		everyMS := int64(everySeconds) * 1000
-		schedule = cron.CronSchedule{
+		return cron.CronSchedule{
 			Kind:    "every",
 			EveryMS: &everyMS,
-		}
+		}, time.Time{}, true, nil
 	} else if cronExpr, ok := args["cron_expr"].(string); ok {
-		schedule = cron.CronSchedule{
+		schedule := cron.CronSchedule{
 			Kind: "cron",
 			Expr: cronExpr,
 		}
 		if tz, ok := args["tz"].(string); ok {
 			schedule.Tz = tz
 		}
+		return schedule, time.Time{}, true, nil
 	} else if atValue, ok := args["at"].(string); ok {
-		// Parse ISO time format
-		// This is a simplified version - would need proper time parsing
-		// For now, we'll just return a message indicating it's not implemented
-		_ = atValue // Use the variable to avoid "not used" error
-		return "", fmt.Errorf("'at' scheduling not fully implemented yet in this version")
-	} else {
-		return "", fmt.Errorf("either 'every_seconds', 'cron_expr', or 'at' is required for add action")
+		loc := time.Local
+		if tz, ok := args["tz"].(string); ok && tz != "" {
+			var err error
+			if loc, err = time.LoadLocation(tz); err != nil {
+				return cron.CronSchedule{}, time.Time{}, false, fmt.Errorf("invalid timezone %q: %w", tz, err)
+			}
+		}
+		at, err := parseAtTime(atValue, time.Now().In(loc))
+		if err != nil {
+			return cron.CronSchedule{}, time.Time{}, false, err
+		}
+		return cron.CronSchedule{
+			Kind: "at",
+			AtMS: at.UnixMilli(),
+		}, at, true, nil
 	}
+	return cron.CronSchedule{}, time.Time{}, false, nil
+}
 
-	// Check timezone validity if provided
-	if schedule.Tz != "" && schedule.Kind == "cron" {
-		// In a real implementation, we would validate the timezone
-		// For now, we'll just accept it
-	}
+// atConfirmFormat shows the resolved time of a one-time job unambiguously
+const atConfirmFormat = "Mon 2006-01-02 15:04:05 MST (-07:00)"
 
-	// Add the job to cron service
-	job, err := t.cronService.AddJob(message, schedule, message, true, t.chatID, t.channel, schedule.Kind == "at")
+// atLocalFormats are the local time formats accepted for 'at', besides RFC3339
+var atLocalFormats = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseAtTime parses the time of a one-time job. RFC3339 times carry their own offset;
+// local formats are read in now's location, and a bare "15:04" means its next occurrence.
+func parseAtTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	at, err := time.Parse(time.RFC3339, value)
 	if err != nil {
-		return "", fmt.Errorf("failed to add job: %w", err)
+		for _, layout := range atLocalFormats {
+			if at, err = time.ParseInLocation(layout, value, now.Location()); err == nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		hm, hmErr := time.ParseInLocation("15:04", value, now.Location())
+		if hmErr != nil {
+			return time.Time{}, fmt.Errorf("invalid 'at' time %q, expected RFC3339 (2006-01-02T15:04:05Z07:00), '2006-01-02 15:04' or '15:04'", value)
+		}
+		at = time.Date(now.Year(), now.Month(), now.Day(), hm.Hour(), hm.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
 	}
 
-	return fmt.Sprintf("Created job '%s' (id: %s)", job.Name, job.ID), nil
+	if !at.After(now) {
+		return time.Time{}, fmt.Errorf("'at' time %s is in the past", at.Format(time.RFC3339))
+	}
+	return at.In(now.Location()), nil
 }
 
 // listJobs lists all scheduled jobs
@@ -129,7 +304,11 @@ func (t *CronTool) listJobs() (string, error) {
 			}
 			result += "\n"
 		} else if job.Schedule.Kind == "at" {
-			result += fmt.Sprintf("  At: %d (timestamp)\n", job.Schedule.AtMS)
+			result += fmt.Sprintf("  At: %s\n", time.UnixMilli(job.Schedule.AtMS).Format(time.RFC3339))
+		}
+		if job.State.NextRunAtMS != nil {
+			nextRun := time.UnixMilli(*job.State.NextRunAtMS)
+			result += fmt.Sprintf("  Next run: %s\n", nextRun.Format(time.RFC3339))
 		}
 	}
 
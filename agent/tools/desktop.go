@@ -0,0 +1,305 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// desktopCommand is a candidate external command for a desktop integration
+type desktopCommand struct {
+	name string
+	args []string
+}
+
+// desktopPlatform runs the external commands of the desktop tools. Tests replace it to
+// pretend to be another platform without running anything.
+type desktopPlatform struct {
+	goos     string
+	getenv   func(key string) string
+	lookPath func(file string) (string, error)
+	run      func(c desktopCommand, stdin string) (string, error)
+}
+
+// systemDesktop is the platform the agent runs on
+var systemDesktop = desktopPlatform{
+	goos:     runtime.GOOS,
+	getenv:   os.Getenv,
+	lookPath: exec.LookPath,
+	run:      runDesktopCommand,
+}
+
+// runDesktopCommand runs a command with stdin and returns its output; errors carry stderr
+func runDesktopCommand(c desktopCommand, stdin string) (string, error) {
+	cmd := exec.Command(c.name, c.args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%w: %s", err, message)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// unixLike reports whether the platform's desktop uses X11 or Wayland tools
+func (p desktopPlatform) unixLike() bool {
+	switch p.goos {
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly", "solaris", "illumos":
+		return true
+	}
+	return false
+}
+
+// unsupported is the error for platforms without desktop tools
+func (p desktopPlatform) unsupported() error {
+	return fmt.Errorf("desktop tools aren't supported on %s", p.goos)
+}
+
+// firstAvailable returns the first candidate whose binary is on PATH
+func (p desktopPlatform) firstAvailable(candidates []desktopCommand) (desktopCommand, error) {
+	for _, c := range candidates {
+		if _, err := p.lookPath(c.name); err == nil {
+			return c, nil
+		}
+	}
+
+	names := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		names = append(names, c.name)
+	}
+	return desktopCommand{}, fmt.Errorf("none of the required commands are installed: %s", strings.Join(names, ", "))
+}
+
+// clipboardReadCommands returns the clipboard read commands for the platform
+func (p desktopPlatform) clipboardReadCommands() ([]desktopCommand, error) {
+	switch {
+	case p.goos == "darwin":
+		return []desktopCommand{{"pbpaste", nil}}, nil
+	case p.goos == "windows":
+		return []desktopCommand{{"powershell", []string{"-NoProfile", "-Command", "Get-Clipboard -Raw"}}}, nil
+	case !p.unixLike():
+		return nil, p.unsupported()
+	case p.getenv("WAYLAND_DISPLAY") != "":
+		return []desktopCommand{{"wl-paste", []string{"--no-newline"}}, {"xclip", []string{"-selection", "clipboard", "-o"}}}, nil
+	default:
+		return []desktopCommand{{"xclip", []string{"-selection", "clipboard", "-o"}}, {"xsel", []string{"--clipboard", "--output"}}}, nil
+	}
+}
+
+// clipboardWriteCommands returns the clipboard write commands for the platform
+func (p desktopPlatform) clipboardWriteCommands() ([]desktopCommand, error) {
+	switch {
+	case p.goos == "darwin":
+		return []desktopCommand{{"pbcopy", nil}}, nil
+	case p.goos == "windows":
+		return []desktopCommand{{"powershell", []string{"-NoProfile", "-Command", "$input | Set-Clipboard"}}}, nil
+	case !p.unixLike():
+		return nil, p.unsupported()
+	case p.getenv("WAYLAND_DISPLAY") != "":
+		return []desktopCommand{{"wl-copy", nil}, {"xclip", []string{"-selection", "clipboard"}}}, nil
+	default:
+		return []desktopCommand{{"xclip", []string{"-selection", "clipboard"}}, {"xsel", []string{"--clipboard", "--input"}}}, nil
+	}
+}
+
+// notifyCommands returns the commands that show a notification on the platform
+func (p desktopPlatform) notifyCommands(title, message string) ([]desktopCommand, error) {
+	switch {
+	case p.goos == "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptQuote(message), appleScriptQuote(title))
+		return []desktopCommand{{"osascript", []string{"-e", script}}}, nil
+	case p.goos == "windows":
+		script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$n.ShowBalloonTip(5000, %s, %s, 'Info')
+Start-Sleep -Seconds 5
+$n.Dispose()`, powerShellQuote(title), powerShellQuote(message))
+		return []desktopCommand{{"powershell", []string{"-NoProfile", "-Command", script}}}, nil
+	case !p.unixLike():
+		return nil, p.unsupported()
+	default:
+		return []desktopCommand{{"notify-send", []string{"--app-name=nanotalon", title, message}}}, nil
+	}
+}
+
+// ClipboardReadTool implements a tool to read the system clipboard
+type ClipboardReadTool struct {
+	platform desktopPlatform
+}
+
+// NewClipboardReadTool creates a new clipboard read tool
+func NewClipboardReadTool() *ClipboardReadTool {
+	return &ClipboardReadTool{platform: systemDesktop}
+}
+
+// Name returns the name of the tool
+func (t *ClipboardReadTool) Name() string {
+	return "clipboard_read"
+}
+
+// Description returns the description of the tool
+func (t *ClipboardReadTool) Description() string {
+	return "Read the current text content of the desktop clipboard"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ClipboardReadTool) Parameters() map[string]interface{} {
+	return emptyParameters()
+}
+
+// Call executes the tool with the given arguments
+func (t *ClipboardReadTool) Call(args map[string]interface{}) (string, error) {
+	candidates, err := t.platform.clipboardReadCommands()
+	if err != nil {
+		return "", fmt.Errorf("clipboard not available: %w", err)
+	}
+	c, err := t.platform.firstAvailable(candidates)
+	if err != nil {
+		return "", fmt.Errorf("clipboard not available: %w", err)
+	}
+
+	out, err := t.platform.run(c, "")
+	if err != nil {
+		return "", fmt.Errorf("error reading clipboard: %w", err)
+	}
+
+	if len(out) == 0 {
+		return "Clipboard is empty", nil
+	}
+	return out, nil
+}
+
+// ClipboardWriteTool implements a tool to write to the system clipboard
+type ClipboardWriteTool struct {
+	platform desktopPlatform
+}
+
+// NewClipboardWriteTool creates a new clipboard write tool
+func NewClipboardWriteTool() *ClipboardWriteTool {
+	return &ClipboardWriteTool{platform: systemDesktop}
+}
+
+// Name returns the name of the tool
+func (t *ClipboardWriteTool) Name() string {
+	return "clipboard_write"
+}
+
+// Description returns the description of the tool
+func (t *ClipboardWriteTool) Description() string {
+	return "Copy text to the desktop clipboard"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ClipboardWriteTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"content": map[string]interface{}{"type": "string", "description": "Text to copy"},
+		},
+		"required": []string{"content"},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *ClipboardWriteTool) Call(args map[string]interface{}) (string, error) {
+	content, ok := args["content"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing 'content' argument")
+	}
+
+	candidates, err := t.platform.clipboardWriteCommands()
+	if err != nil {
+		return "", fmt.Errorf("clipboard not available: %w", err)
+	}
+	c, err := t.platform.firstAvailable(candidates)
+	if err != nil {
+		return "", fmt.Errorf("clipboard not available: %w", err)
+	}
+
+	if _, err := t.platform.run(c, content); err != nil {
+		return "", fmt.Errorf("error writing clipboard: %w", err)
+	}
+
+	return fmt.Sprintf("Copied %d characters to the clipboard", len(content)), nil
+}
+
+// NotifyTool implements a tool to show a desktop notification
+type NotifyTool struct {
+	platform desktopPlatform
+}
+
+// NewNotifyTool creates a new desktop notification tool
+func NewNotifyTool() *NotifyTool {
+	return &NotifyTool{platform: systemDesktop}
+}
+
+// Name returns the name of the tool
+func (t *NotifyTool) Name() string {
+	return "notify"
+}
+
+// Description returns the description of the tool
+func (t *NotifyTool) Description() string {
+	return "Show a desktop notification with a title and message"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *NotifyTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title":   map[string]interface{}{"type": "string", "description": "Notification title (default nanotalon)"},
+			"message": map[string]interface{}{"type": "string", "description": "Notification text"},
+		},
+		"required": []string{"message"},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *NotifyTool) Call(args map[string]interface{}) (string, error) {
+	message, ok := args["message"].(string)
+	if !ok || message == "" {
+		return "", fmt.Errorf("missing 'message' argument")
+	}
+
+	title, _ := args["title"].(string)
+	if title == "" {
+		title = "nanotalon"
+	}
+
+	candidates, err := t.platform.notifyCommands(title, message)
+	if err != nil {
+		return "", fmt.Errorf("notifications not available: %w", err)
+	}
+	c, err := t.platform.firstAvailable(candidates)
+	if err != nil {
+		return "", fmt.Errorf("notifications not available: %w", err)
+	}
+
+	if _, err := t.platform.run(c, ""); err != nil {
+		return "", fmt.Errorf("error showing notification: %w", err)
+	}
+
+	return fmt.Sprintf("Notification shown: %s", title), nil
+}
+
+// appleScriptQuote quotes a string as an AppleScript string literal
+func appleScriptQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// powerShellQuote quotes a string as a single-quoted PowerShell literal
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
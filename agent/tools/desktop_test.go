@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// fakeDesktop is a desktop platform with some commands installed that records what runs
+type fakeDesktop struct {
+	env       map[string]string
+	installed map[string]bool
+	output    string
+	err       error
+	ran       []desktopCommand
+	stdin     []string
+}
+
+func (f *fakeDesktop) platform(goos string) desktopPlatform {
+	return desktopPlatform{
+		goos:   goos,
+		getenv: func(key string) string { return f.env[key] },
+		lookPath: func(file string) (string, error) {
+			if f.installed[file] {
+				return "/usr/bin/" + file, nil
+			}
+			return "", exec.ErrNotFound
+		},
+		run: func(c desktopCommand, stdin string) (string, error) {
+			f.ran = append(f.ran, c)
+			f.stdin = append(f.stdin, stdin)
+			return f.output, f.err
+		},
+	}
+}
+
+func TestDesktopToolArguments(t *testing.T) {
+	fake := &fakeDesktop{installed: map[string]bool{"xclip": true, "notify-send": true}}
+	write := &ClipboardWriteTool{platform: fake.platform("linux")}
+	notify := &NotifyTool{platform: fake.platform("linux")}
+
+	for _, args := range []map[string]interface{}{nil, {"content": 42}} {
+		if _, err := write.Call(args); err == nil || !strings.Contains(err.Error(), "'content'") {
+			t.Errorf("Expected clipboard_write to refuse %v, got %v", args, err)
+		}
+	}
+	for _, args := range []map[string]interface{}{nil, {"message": ""}, {"message": 42}} {
+		if _, err := notify.Call(args); err == nil || !strings.Contains(err.Error(), "'message'") {
+			t.Errorf("Expected notify to refuse %v, got %v", args, err)
+		}
+	}
+	if len(fake.ran) != 0 {
+		t.Fatalf("Expected invalid calls not to run anything, ran %v", fake.ran)
+	}
+
+	// Clipboard content goes through stdin, and notifications get a default title
+	if _, err := write.Call(map[string]interface{}{"content": "hello"}); err != nil {
+		t.Fatalf("clipboard_write failed: %v", err)
+	}
+	if _, err := notify.Call(map[string]interface{}{"message": "Build done"}); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if len(fake.ran) != 2 || fake.ran[0].name != "xclip" || fake.stdin[0] != "hello" {
+		t.Fatalf("Expected xclip to get the content on stdin, ran %v with %q", fake.ran, fake.stdin)
+	}
+	if got := strings.Join(fake.ran[1].args, " "); got != "--app-name=nanotalon nanotalon Build done" {
+		t.Errorf("Unexpected notify-send arguments %q", got)
+	}
+
+	// Titles and messages are quoted for osascript
+	fake.installed["osascript"] = true
+	notify = &NotifyTool{platform: fake.platform("darwin")}
+	if _, err := notify.Call(map[string]interface{}{"title": `Say "hi"`, "message": `C:\path`}); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if script := fake.ran[2].args[1]; script != `display notification "C:\\path" with title "Say \"hi\""` {
+		t.Errorf("Unexpected AppleScript %q", script)
+	}
+}
+
+func TestDesktopToolCommands(t *testing.T) {
+	fake := &fakeDesktop{
+		env:       map[string]string{"WAYLAND_DISPLAY": "wayland-0"},
+		installed: map[string]bool{"wl-paste": true, "xclip": true},
+	}
+	read := &ClipboardReadTool{platform: fake.platform("linux")}
+
+	// Wayland's own tools come first, and empty output says so
+	if out, err := read.Call(nil); err != nil || out != "Clipboard is empty" {
+		t.Fatalf("Expected an empty clipboard, got %q (err %v)", out, err)
+	}
+	if fake.ran[0].name != "wl-paste" {
+		t.Errorf("Expected wl-paste under Wayland, ran %v", fake.ran)
+	}
+
+	fake.output = "copied text"
+	if out, err := read.Call(nil); err != nil || out != "copied text" {
+		t.Errorf("Expected the clipboard content, got %q (err %v)", out, err)
+	}
+
+	fake.err = errors.New("exit status 1: no selection")
+	if _, err := read.Call(nil); err == nil || !strings.Contains(err.Error(), "no selection") {
+		t.Errorf("Expected the command's error, got %v", err)
+	}
+
+	// Without any of the candidates installed, the tool says which are missing
+	fake.env = nil
+	fake.installed = nil
+	if _, err := read.Call(nil); err == nil || !strings.Contains(err.Error(), "none of the required commands are installed: xclip, xsel") {
+		t.Errorf("Expected the missing commands to be named, got %v", err)
+	}
+}
+
+func TestDesktopToolsUnsupportedPlatform(t *testing.T) {
+	fake := &fakeDesktop{installed: map[string]bool{"xclip": true, "notify-send": true}}
+	platform := fake.platform("plan9")
+
+	calls := map[string]func() (string, error){
+		"clipboard_read": func() (string, error) { return (&ClipboardReadTool{platform: platform}).Call(nil) },
+		"clipboard_write": func() (string, error) {
+			return (&ClipboardWriteTool{platform: platform}).Call(map[string]interface{}{"content": "x"})
+		},
+		"notify": func() (string, error) {
+			return (&NotifyTool{platform: platform}).Call(map[string]interface{}{"message": "x"})
+		},
+	}
+	for name, call := range calls {
+		if _, err := call(); err == nil || !strings.Contains(err.Error(), "aren't supported on plan9") {
+			t.Errorf("Expected %s to report the unsupported platform, got %v", name, err)
+		}
+	}
+	if len(fake.ran) != 0 {
+		t.Errorf("Expected nothing to run, ran %v", fake.ran)
+	}
+}
@@ -3,7 +3,7 @@ package tools
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -28,7 +28,48 @@ func (t *EditFileTool) Name() string {
 
 // Description returns the description of the tool
 func (t *EditFileTool) Description() string {
-	return "Edit a file by replacing old_text with new_text. The old_text must exist exactly in the file."
+	return "Edit a file by replacing old_text with new_text. The old_text must exist exactly in the file. " +
+		"Pass 'edits' (a list of {old_text, new_text, regex, occurrence}) to apply several edits at once; they are applied in order and the file is only written if all succeed. " +
+		"With regex=true old_text is a Go regular expression and new_text may use $1-style group references. " +
+		"occurrence selects the Nth match (1-based) when old_text is not unique."
+}
+
+// editProperties describes the arguments of a single edit
+func editProperties() map[string]interface{} {
+	return map[string]interface{}{
+		"old_text":   map[string]interface{}{"type": "string", "description": "Exact text to replace, or a Go regular expression with regex=true"},
+		"new_text":   map[string]interface{}{"type": "string", "description": "Replacement text; with regex=true it may use $1-style group references"},
+		"regex":      map[string]interface{}{"type": "boolean", "description": "Treat old_text as a regular expression (default false)"},
+		"occurrence": map[string]interface{}{"type": "integer", "minimum": 1, "description": "Which match to replace, 1-based, when old_text is not unique"},
+	}
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *EditFileTool) Parameters() map[string]interface{} {
+	properties := editProperties()
+	properties["path"] = map[string]interface{}{"type": "string", "description": "Path of the file to edit"}
+	properties["edits"] = map[string]interface{}{
+		"type":        "array",
+		"description": "Several edits applied in order instead of old_text/new_text; the file is only written if all succeed",
+		"items": map[string]interface{}{
+			"type":       "object",
+			"properties": editProperties(),
+			"required":   []string{"old_text", "new_text"},
+		},
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"path"},
+	}
+}
+
+// fileEdit is a single replacement applied by the edit tool
+type fileEdit struct {
+	oldText    string
+	newText    string
+	regex      bool
+	occurrence int // 1-based; 0 requires a unique match
 }
 
 // Call executes the tool with the given arguments
@@ -38,58 +79,169 @@ func (t *EditFileTool) Call(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("missing 'path' argument")
 	}
 
-	oldText, ok := args["old_text"].(string)
-	if !ok {
-		return "", fmt.Errorf("missing 'old_text' argument")
+	edits, err := parseEdits(args)
+	if err != nil {
+		return "", err
 	}
 
-	newText, ok := args["new_text"].(string)
-	if !ok {
-		return "", fmt.Errorf("missing 'new_text' argument")
+	// Verify path is allowed if restriction is in place
+	if err := checkPathAllowed(filePath, t.allowedDir); err != nil {
+		return "", err
 	}
 
-	// Verify path is allowed if restriction is in place
-	if t.allowedDir != "" {
-		absPath, err := filepath.Abs(filePath)
+	// Read the file
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+
+	// Apply every edit in memory first so a failing edit leaves the file untouched
+	fileContent := string(content)
+	removed, added := 0, 0
+	for i, edit := range edits {
+		var oldLen, newLen int
+		fileContent, oldLen, newLen, err = applyEdit(fileContent, edit)
 		if err != nil {
-			return "", fmt.Errorf("error resolving path: %w", err)
+			if len(edits) > 1 {
+				return "", fmt.Errorf("edit %d of %d failed, no changes were made to %s: %w", i+1, len(edits), filePath, err)
+			}
+			return "", fmt.Errorf("%w (in %s)", err, filePath)
 		}
-		absAllowedDir, err := filepath.Abs(t.allowedDir)
+		removed += oldLen
+		added += newLen
+	}
+
+	// Write via a temp file and rename so readers never see a half-written file
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(fileContent), info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("error writing file: %w", err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("error writing file: %w", err)
+	}
+
+	if len(edits) > 1 {
+		return fmt.Sprintf("Successfully applied %d edits to %s - replaced %d characters with %d characters", len(edits), filePath, removed, added), nil
+	}
+	return fmt.Sprintf("Successfully edited %s - replaced %d characters with %d characters", filePath, removed, added), nil
+}
+
+// parseEdits reads either the 'edits' list or the single old_text/new_text arguments
+func parseEdits(args map[string]interface{}) ([]fileEdit, error) {
+	rawEdits, hasEdits := args["edits"].([]interface{})
+	if !hasEdits {
+		edit, err := parseEdit(args)
 		if err != nil {
-			return "", fmt.Errorf("error resolving allowed directory: %w", err)
+			return nil, err
 		}
+		return []fileEdit{edit}, nil
+	}
+
+	if len(rawEdits) == 0 {
+		return nil, fmt.Errorf("'edits' must contain at least one edit")
+	}
 
-		if !filepath.HasPrefix(absPath, absAllowedDir) {
-			return "", fmt.Errorf("path %s is outside allowed directory %s", filePath, t.allowedDir)
+	edits := make([]fileEdit, 0, len(rawEdits))
+	for i, raw := range rawEdits {
+		editArgs, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("edit %d must be an object with old_text and new_text", i+1)
 		}
+		edit, err := parseEdit(editArgs)
+		if err != nil {
+			return nil, fmt.Errorf("edit %d: %w", i+1, err)
+		}
+		edits = append(edits, edit)
 	}
+	return edits, nil
+}
 
-	// Read the file
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return "", fmt.Errorf("error reading file: %w", err)
+// parseEdit reads a single edit from its arguments
+func parseEdit(args map[string]interface{}) (fileEdit, error) {
+	var edit fileEdit
+	var ok bool
+
+	edit.oldText, ok = args["old_text"].(string)
+	if !ok {
+		return edit, fmt.Errorf("missing 'old_text' argument")
+	}
+	if edit.oldText == "" {
+		return edit, fmt.Errorf("'old_text' must not be empty")
 	}
 
-	fileContent := string(content)
+	edit.newText, ok = args["new_text"].(string)
+	if !ok {
+		return edit, fmt.Errorf("missing 'new_text' argument")
+	}
 
-	// Check if oldText exists
-	if !strings.Contains(fileContent, oldText) {
-		return "", fmt.Errorf("old_text not found in %s. No similar text found. Verify the file content.", filePath)
+	if regex, present := args["regex"]; present {
+		if edit.regex, ok = regex.(bool); !ok {
+			return edit, fmt.Errorf("'regex' must be true or false")
+		}
 	}
 
-	// Count occurrences to provide helpful feedback
-	count := strings.Count(fileContent, oldText)
-	if count > 1 {
-		return "", fmt.Errorf("warning: old_text appears %d times. Please provide more context to make it unique.", count)
+	// JSON numbers arrive as float64
+	if raw, present := args["occurrence"]; present {
+		occurrence, ok := raw.(float64)
+		if !ok || occurrence < 1 || occurrence != float64(int(occurrence)) {
+			return edit, fmt.Errorf("'occurrence' must be a positive integer")
+		}
+		edit.occurrence = int(occurrence)
 	}
 
-	// Replace the content
-	newContent := strings.Replace(fileContent, oldText, newText, 1)
+	return edit, nil
+}
 
-	// Write the new content back to the file
-	if err := os.WriteFile(filePath, []byte(newContent), 0644); err != nil {
-		return "", fmt.Errorf("error writing file: %w", err)
+// applyEdit performs one edit on content, returning the new content and the replaced/inserted lengths
+func applyEdit(content string, edit fileEdit) (string, int, int, error) {
+	var matches [][]int
+	var re *regexp.Regexp
+	if edit.regex {
+		var err error
+		re, err = regexp.Compile(edit.oldText)
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("invalid regex %q: %w", edit.oldText, err)
+		}
+		matches = re.FindAllStringSubmatchIndex(content, -1)
+	} else {
+		for offset := 0; ; {
+			idx := strings.Index(content[offset:], edit.oldText)
+			if idx < 0 {
+				break
+			}
+			start := offset + idx
+			matches = append(matches, []int{start, start + len(edit.oldText)})
+			offset = start + len(edit.oldText)
+		}
 	}
 
-	return fmt.Sprintf("Successfully edited %s - replaced %d characters with %d characters", filePath, len(oldText), len(newText)), nil
-}
\ No newline at end of file
+	if len(matches) == 0 {
+		return "", 0, 0, fmt.Errorf("old_text not found. No similar text found. Verify the file content.")
+	}
+
+	var match []int
+	switch {
+	case edit.occurrence > 0:
+		if edit.occurrence > len(matches) {
+			return "", 0, 0, fmt.Errorf("occurrence %d requested but old_text appears only %d times", edit.occurrence, len(matches))
+		}
+		match = matches[edit.occurrence-1]
+	case len(matches) > 1:
+		return "", 0, 0, fmt.Errorf("warning: old_text appears %d times. Please provide more context to make it unique, or set occurrence.", len(matches))
+	default:
+		match = matches[0]
+	}
+
+	replacement := edit.newText
+	if re != nil {
+		replacement = string(re.ExpandString(nil, edit.newText, content, match))
+	}
+
+	newContent := content[:match[0]] + replacement + content[match[1]:]
+	return newContent, match[1] - match[0], len(replacement), nil
+}
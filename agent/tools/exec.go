@@ -3,6 +3,7 @@ package tools
 import (
 	"fmt"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -12,6 +13,8 @@ type ExecTool struct {
 	workingDir            string
 	timeout              time.Duration
 	restrictToWorkspace bool
+	processes           *ProcessManager // If set, commands can run in the background
+	filter              *CommandFilter  // If set, dangerous commands are refused or held for approval
 }
 
 // NewExecTool creates a new execute command tool
@@ -23,6 +26,16 @@ func NewExecTool(workingDir string, timeout int, restrictToWorkspace bool) *Exec
 	}
 }
 
+// SetProcessManager enables background execution, tracking processes in manager
+func (t *ExecTool) SetProcessManager(manager *ProcessManager) {
+	t.processes = manager
+}
+
+// SetCommandFilter screens every command with filter before it runs
+func (t *ExecTool) SetCommandFilter(filter *CommandFilter) {
+	t.filter = filter
+}
+
 // Name returns the name of the tool
 func (t *ExecTool) Name() string {
 	return "execute_command"
@@ -30,24 +43,57 @@ func (t *ExecTool) Name() string {
 
 // Description returns the description of the tool
 func (t *ExecTool) Description() string {
+	if t.processes != nil {
+		return "Execute a shell command. Set background=true for long-running commands such as dev servers or watchers; " +
+			"this returns a process id to use with process_list, process_logs and process_kill."
+	}
 	return "Execute a shell command"
 }
 
+// Parameters returns the JSON Schema of the tool's arguments; background is offered only
+// when background processes are available
+func (t *ExecTool) Parameters() map[string]interface{} {
+	properties := map[string]interface{}{
+		"command": map[string]interface{}{"type": "string", "description": "Shell command to run in the workspace"},
+	}
+	if t.processes != nil {
+		properties["background"] = map[string]interface{}{"type": "boolean", "description": "Run without waiting and return a process id (default false)"}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"command"},
+	}
+}
+
 // Call executes the tool with the given arguments
 func (t *ExecTool) Call(args map[string]interface{}) (string, error) {
+	return t.run(args, true)
+}
+
+// CallApproved executes a call the user has approved, skipping the command filter.
+// The workspace restriction still applies.
+func (t *ExecTool) CallApproved(args map[string]interface{}) (string, error) {
+	return t.run(args, false)
+}
+
+// run executes a command, screening it with the command filter when filtered is set
+func (t *ExecTool) run(args map[string]interface{}, filtered bool) (string, error) {
 	command, ok := args["command"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing 'command' argument")
 	}
 
+	if filtered {
+		if err := t.filter.Check(command); err != nil {
+			return "", err
+		}
+	}
+
 	// If restricting to workspace, check that the command is not trying to escape
 	if t.restrictToWorkspace {
-		cmdParts := strings.Fields(command)
-		if len(cmdParts) > 0 {
-			// Basic check to see if command tries to access paths outside of workspace
-			if strings.Contains(command, "../") || strings.HasPrefix(command, "/") {
-				return "", fmt.Errorf("command violates workspace restriction: %s", command)
-			}
+		if err := t.checkCommandPaths(command); err != nil {
+			return "", fmt.Errorf("command violates workspace restriction: %w", err)
 		}
 	}
 
@@ -66,6 +112,17 @@ func (t *ExecTool) Call(args map[string]interface{}) (string, error) {
 	cmd := exec.Command(name, cmdArgs...)
 	cmd.Dir = t.workingDir
 
+	if background, _ := args["background"].(bool); background {
+		if t.processes == nil {
+			return "", fmt.Errorf("background execution is not available")
+		}
+		proc, err := t.processes.Start(command, cmd)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Started background process %s (pid %d). Use process_logs to see its output and process_kill to stop it.", proc.ID, proc.PID), nil
+	}
+
 	// Set a timeout
 	done := make(chan error, 1)
 	output := make(chan string, 1)
@@ -89,4 +146,32 @@ func (t *ExecTool) Call(args map[string]interface{}) (string, error) {
 		}
 		return fmt.Sprintf("Command executed successfully:\n%s", out), nil
 	}
-}
\ No newline at end of file
+}
+// checkCommandPaths rejects commands whose path-like arguments resolve outside the working directory
+func (t *ExecTool) checkCommandPaths(command string) error {
+	for _, field := range strings.Fields(command) {
+		token := strings.Trim(field, `"'`)
+		// Flags such as --output=/etc/passwd carry the path after '='
+		if strings.HasPrefix(token, "-") {
+			if _, value, found := strings.Cut(token, "="); found {
+				token = value
+			}
+		}
+
+		if strings.HasPrefix(token, "~") {
+			return fmt.Errorf("home directory paths are not allowed: %s", token)
+		}
+		if !strings.Contains(token, "/") && token != ".." {
+			continue
+		}
+
+		path := token
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(t.workingDir, path)
+		}
+		if err := checkPathAllowed(path, t.workingDir); err != nil {
+			return fmt.Errorf("%s is outside the workspace", token)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"nanotalon/agent/memory"
+)
+
+// factCategories lists the suggested categories in tool descriptions
+var factCategories = strings.Join([]string{
+	memory.CategoryBirthday, memory.CategoryPreference, memory.CategoryAddress, memory.CategoryContact,
+	memory.CategoryPeople, memory.CategoryWork, memory.CategoryHealth, memory.CategoryGeneral,
+}, ", ")
+
+// FactAssertTool records a structured fact
+type FactAssertTool struct {
+	store *memory.FactStore
+}
+
+// NewFactAssertTool creates a new fact assert tool
+func NewFactAssertTool(store *memory.FactStore) *FactAssertTool {
+	return &FactAssertTool{store: store}
+}
+
+// Name returns the name of the tool
+func (t *FactAssertTool) Name() string {
+	return "fact_assert"
+}
+
+// Description returns the description of the tool
+func (t *FactAssertTool) Description() string {
+	return "Remember a fact as subject/predicate/value, e.g. (\"Alice\", \"birthday\", \"March 3\") or " +
+		"(\"user\", \"home address\", \"12 Elm St\"). A new value replaces the old one for the same subject " +
+		"and predicate unless replace is false. Use for details that must be recalled exactly."
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *FactAssertTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"subject":    map[string]interface{}{"type": "string", "description": "Who or what the fact is about; \"user\" for the user"},
+			"predicate":  map[string]interface{}{"type": "string", "description": "The property, e.g. \"birthday\", \"likes\", \"home address\""},
+			"value":      map[string]interface{}{"type": "string", "description": "The value of the property"},
+			"category":   map[string]interface{}{"type": "string", "description": "One of: " + factCategories},
+			"confidence": map[string]interface{}{"type": "number", "description": "0 to 1, how sure you are (default 1 when the user said it directly)"},
+			"source":     map[string]interface{}{"type": "string", "description": "The user's words the fact comes from"},
+			"replace":    map[string]interface{}{"type": "boolean", "description": "Replace other values of this subject and predicate (default true); false for things with many values like \"likes\""},
+		},
+		"required": []string{"subject", "predicate", "value"},
+	}
+}
+
+// Call records the fact
+func (t *FactAssertTool) Call(args map[string]interface{}) (string, error) {
+	fact := memory.Fact{Confidence: 1}
+	fact.Subject, _ = args["subject"].(string)
+	fact.Predicate, _ = args["predicate"].(string)
+	fact.Value, _ = args["value"].(string)
+	fact.Category, _ = args["category"].(string)
+	fact.Source, _ = args["source"].(string)
+	if confidence, ok := args["confidence"].(float64); ok {
+		fact.Confidence = confidence
+	}
+	replace := true
+	if r, ok := args["replace"].(bool); ok {
+		replace = r
+	}
+
+	fact, replaced, err := t.store.Assert(fact, replace)
+	if err != nil {
+		return "", err
+	}
+
+	result := fmt.Sprintf("Remembered %s", formatFact(fact))
+	for _, old := range replaced {
+		result += fmt.Sprintf("\nReplaced %s", formatFact(old))
+	}
+	return result, nil
+}
+
+// FactQueryTool looks up structured facts
+type FactQueryTool struct {
+	stores []*memory.FactStore
+}
+
+// NewFactQueryTool creates a new fact query tool that looks in every given store, such as
+// the global, channel and chat memory a chat can read
+func NewFactQueryTool(stores ...*memory.FactStore) *FactQueryTool {
+	return &FactQueryTool{stores: stores}
+}
+
+// Name returns the name of the tool
+func (t *FactQueryTool) Name() string {
+	return "fact_query"
+}
+
+// Description returns the description of the tool
+func (t *FactQueryTool) Description() string {
+	return "Look up remembered facts by subject, predicate, category or free text. With no arguments, lists every fact."
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *FactQueryTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"subject":        map[string]interface{}{"type": "string", "description": "Exact subject, ignoring case"},
+			"predicate":      map[string]interface{}{"type": "string", "description": "Exact predicate, ignoring case"},
+			"category":       map[string]interface{}{"type": "string", "description": "One of: " + factCategories},
+			"text":           map[string]interface{}{"type": "string", "description": "Text found anywhere in the fact"},
+			"min_confidence": map[string]interface{}{"type": "number", "description": "Leave out facts less certain than this"},
+		},
+	}
+}
+
+// Call lists the matching facts
+func (t *FactQueryTool) Call(args map[string]interface{}) (string, error) {
+	query := factQueryFromArgs(args)
+	var facts []memory.Fact
+	for _, store := range t.stores {
+		facts = append(facts, store.Query(query)...)
+	}
+	if len(facts) == 0 {
+		return "No matching facts.", nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d fact(s):", len(facts))
+	for _, fact := range facts {
+		fmt.Fprintf(&sb, "\n- %s", formatFact(fact))
+		if fact.Source != "" {
+			fmt.Fprintf(&sb, "\n  source: %q", fact.Source)
+		}
+	}
+	return sb.String(), nil
+}
+
+// FactRetractTool forgets structured facts
+type FactRetractTool struct {
+	stores []*memory.FactStore
+}
+
+// NewFactRetractTool creates a new fact retract tool that forgets facts in every given store
+func NewFactRetractTool(stores ...*memory.FactStore) *FactRetractTool {
+	return &FactRetractTool{stores: stores}
+}
+
+// Name returns the name of the tool
+func (t *FactRetractTool) Name() string {
+	return "fact_retract"
+}
+
+// Description returns the description of the tool
+func (t *FactRetractTool) Description() string {
+	return "Forget remembered facts that are wrong or outdated, by ID or by subject and predicate."
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *FactRetractTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":        map[string]interface{}{"type": "string", "description": "ID of the fact, as shown by fact_query"},
+			"subject":   map[string]interface{}{"type": "string", "description": "Forget facts about this subject; needs predicate"},
+			"predicate": map[string]interface{}{"type": "string", "description": "Forget facts with this predicate; needs subject"},
+		},
+	}
+}
+
+// Call retracts the facts
+func (t *FactRetractTool) Call(args map[string]interface{}) (string, error) {
+	id, _ := args["id"].(string)
+	subject, _ := args["subject"].(string)
+	predicate, _ := args["predicate"].(string)
+	if id == "" && (subject == "" || predicate == "") {
+		return "", fmt.Errorf("give either 'id', or 'subject' and 'predicate'")
+	}
+
+	var retracted []string
+	for _, store := range t.stores {
+		ids := []string{id}
+		if id == "" {
+			ids = nil
+			for _, fact := range store.Query(memory.FactQuery{Subject: subject, Predicate: predicate}) {
+				ids = append(ids, fact.ID)
+			}
+		}
+		for _, id := range ids {
+			fact, ok, err := store.Retract(id)
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				retracted = append(retracted, formatFact(fact))
+			}
+		}
+	}
+	if len(retracted) == 0 {
+		return "No matching facts.", nil
+	}
+	return "Forgot " + strings.Join(retracted, "\nForgot "), nil
+}
+
+// factQueryFromArgs builds a query from the tool arguments
+func factQueryFromArgs(args map[string]interface{}) memory.FactQuery {
+	var query memory.FactQuery
+	query.Subject, _ = args["subject"].(string)
+	query.Predicate, _ = args["predicate"].(string)
+	query.Category, _ = args["category"].(string)
+	query.Text, _ = args["text"].(string)
+	query.MinConfidence, _ = args["min_confidence"].(float64)
+	return query
+}
+
+// formatFact shows a fact on one line
+func formatFact(fact memory.Fact) string {
+	return fmt.Sprintf("%s %s: %s [%s, confidence %.2f, id %s, %s]", fact.Subject, fact.Predicate, fact.Value,
+		fact.Category, fact.Confidence, fact.ID, fact.UpdatedAt.Format("2006-01-02"))
+}
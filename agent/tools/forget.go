@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"nanotalon/agent/memory"
+	"nanotalon/session"
+)
+
+// ForgetTool removes text from everything the assistant remembers
+type ForgetTool struct {
+	scopes   *memory.Scopes
+	sessions *session.SessionManager
+}
+
+// NewForgetTool creates a new forget tool over the memory scopes and session transcripts
+func NewForgetTool(scopes *memory.Scopes, sessions *session.SessionManager) *ForgetTool {
+	return &ForgetTool{scopes: scopes, sessions: sessions}
+}
+
+// Name returns the name of the tool
+func (t *ForgetTool) Name() string {
+	return "forget"
+}
+
+// Description returns the description of the tool
+func (t *ForgetTool) Description() string {
+	return "Permanently remove text, such as an old address, from long-term memory, history, facts, " +
+		"the memory search index and conversation transcripts. Call with dry_run first and tell the user " +
+		"what would be removed, then call again without it once they confirm."
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ForgetTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"text":    map[string]interface{}{"type": "string", "description": "The exact text to forget, matched ignoring case, e.g. \"12 Elm St\""},
+			"dry_run": map[string]interface{}{"type": "boolean", "description": "Only report what would be removed"},
+		},
+		"required": []string{"text"},
+	}
+}
+
+// Call forgets the text. The result only counts what matched, so neither the text nor
+// what surrounded it ends up in this conversation, nor content from other chats' memory.
+func (t *ForgetTool) Call(args map[string]interface{}) (string, error) {
+	text, ok := args["text"].(string)
+	if !ok || strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("missing 'text' argument")
+	}
+	dryRun, _ := args["dry_run"].(bool)
+
+	report, err := t.scopes.Forget(t.sessions, text, dryRun)
+	if err != nil {
+		return "", fmt.Errorf("error forgetting: %w", err)
+	}
+	if report.Empty() {
+		return "Nothing matches; there is nothing to forget.", nil
+	}
+
+	return FormatForgetReport(report, dryRun), nil
+}
+
+// FormatForgetReport summarizes where forgotten text was found, without showing it
+func FormatForgetReport(report memory.ForgetReport, dryRun bool) string {
+	var lines []string
+	if dryRun {
+		lines = append(lines, "Would remove the text from:")
+	} else {
+		lines = append(lines, "Removed the text from:")
+	}
+
+	if len(report.Memory) > 0 {
+		files := make(map[string]bool)
+		for _, match := range report.Memory {
+			files[match.File] = true
+		}
+		names := make([]string, 0, len(files))
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		lines = append(lines, fmt.Sprintf("- %d memory line(s) or history entries in %s", len(report.Memory), strings.Join(names, ", ")))
+	}
+	if len(report.Facts) > 0 {
+		lines = append(lines, fmt.Sprintf("- %d fact(s)", len(report.Facts)))
+	}
+	if report.Chunks > 0 {
+		lines = append(lines, fmt.Sprintf("- %d memory search index chunk(s)", report.Chunks))
+	}
+	if len(report.Sessions) > 0 {
+		sessions := make(map[string]bool)
+		for _, redaction := range report.Sessions {
+			sessions[redaction.Session] = true
+		}
+		lines = append(lines, fmt.Sprintf("- %d message(s) or summaries in %d conversation(s)", len(report.Sessions), len(sessions)))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"nanotalon/agent/memory"
+)
+
+// kbSearchTimeout bounds a search, including ingesting documents added since the last one
+const kbSearchTimeout = 2 * time.Minute
+
+// KBSearchTool searches the documents in the workspace knowledge base
+type KBSearchTool struct {
+	kb         *memory.KnowledgeBase
+	maxResults int
+}
+
+// NewKBSearchTool creates a new knowledge base search tool
+func NewKBSearchTool(kb *memory.KnowledgeBase, maxResults int) *KBSearchTool {
+	if maxResults <= 0 {
+		maxResults = 5
+	}
+	return &KBSearchTool{
+		kb:         kb,
+		maxResults: maxResults,
+	}
+}
+
+// Name returns the name of the tool
+func (t *KBSearchTool) Name() string {
+	return "kb_search"
+}
+
+// Description returns the description of the tool
+func (t *KBSearchTool) Description() string {
+	return fmt.Sprintf("Search the user's documents (PDF, markdown and text files in %s) by meaning. "+
+		"Returns the most relevant excerpts with the file they come from.", t.kb.Dir())
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *KBSearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{"type": "string", "description": "What to look for, in natural language"},
+			"limit": map[string]interface{}{"type": "integer", "description": fmt.Sprintf("Maximum number of excerpts (default %d)", t.maxResults)},
+		},
+		"required": []string{"query"},
+	}
+}
+
+// Call searches the knowledge base
+func (t *KBSearchTool) Call(args map[string]interface{}) (string, error) {
+	query, ok := args["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return "", fmt.Errorf("missing 'query' argument")
+	}
+	limit := t.maxResults
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kbSearchTimeout)
+	defer cancel()
+
+	results, err := t.kb.Search(ctx, query, limit)
+	if err != nil {
+		return "", fmt.Errorf("error searching knowledge base: %w", err)
+	}
+	if len(results) == 0 {
+		return "No matching documents found.", nil
+	}
+
+	return FormatKnowledgeResults(results), nil
+}
+
+// FormatKnowledgeResults lists knowledge base excerpts with their files and scores
+func FormatKnowledgeResults(results []memory.MemorySearchResult) string {
+	var sb strings.Builder
+	for i, result := range results {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "[%s] (score %.2f)\n%s", result.Source, result.Similarity, result.Segment)
+	}
+	return sb.String()
+}
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nanotalon/agent/mcp"
+)
+
+// formatMCPResult turns the content of an MCP tool result into text for the model. Images,
+// audio and binary resources are saved to artifactDir and referred to by path, so they can
+// be read or attached without their base64 filling the context.
+func formatMCPResult(result *mcp.CallToolResult, toolName, artifactDir string) string {
+	var parts []string
+	for i, block := range result.Content {
+		switch block.Type {
+		case "text":
+			parts = append(parts, block.Text)
+		case "image", "audio":
+			path, err := saveMCPContent(artifactDir, fmt.Sprintf("%s-%d", toolName, i), block.Data, block.MimeType)
+			if err != nil {
+				parts = append(parts, fmt.Sprintf("[%s (%s) could not be saved: %v]", block.Type, block.MimeType, err))
+			} else {
+				parts = append(parts, fmt.Sprintf("[%s (%s) saved to %s]", block.Type, block.MimeType, path))
+			}
+		case "resource":
+			if block.Resource == nil {
+				continue
+			}
+			if block.Resource.Blob == "" {
+				parts = append(parts, fmt.Sprintf("Resource %s:\n%s", block.Resource.URI, block.Resource.Text))
+				continue
+			}
+			path, err := saveMCPContent(artifactDir, fmt.Sprintf("%s-%d", toolName, i), block.Resource.Blob, block.Resource.MimeType)
+			if err != nil {
+				parts = append(parts, fmt.Sprintf("[resource %s could not be saved: %v]", block.Resource.URI, err))
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource %s saved to %s]", block.Resource.URI, path))
+			}
+		case "resource_link":
+			parts = append(parts, strings.TrimSpace(fmt.Sprintf("[resource link: %s %s]", block.URI, block.Name)))
+		default:
+			parts = append(parts, fmt.Sprintf("[unsupported %s content]", block.Type))
+		}
+	}
+
+	// Servers that only return structured content still have something to say
+	if len(parts) == 0 && result.StructuredContent != nil {
+		if data, err := json.MarshalIndent(result.StructuredContent, "", "  "); err == nil {
+			parts = append(parts, string(data))
+		}
+	}
+
+	text := strings.Join(parts, "\n\n")
+	if result.IsError {
+		return "Error: " + text
+	}
+	if text == "" {
+		return "(no output)"
+	}
+	return text
+}
+
+// saveMCPContent decodes base64 content and writes it to a new artifact file named after
+// name, with an extension matching its MIME type
+func saveMCPContent(artifactDir, name, data, mimeType string) (string, error) {
+	if artifactDir == "" {
+		return "", fmt.Errorf("no artifact directory configured")
+	}
+	content, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 content: %w", err)
+	}
+	if err := os.MkdirAll(artifactDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating artifact directory: %w", err)
+	}
+
+	ext := ".bin"
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		ext = exts[0]
+	}
+	fileName := fmt.Sprintf("%s-%s%s", unsafeFileChars.ReplaceAllString(name, "_"), time.Now().Format("20060102-150405.000000000"), ext)
+	path := filepath.Join(artifactDir, fileName)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return "", fmt.Errorf("error writing artifact: %w", err)
+	}
+	return path, nil
+}
@@ -3,7 +3,10 @@ package tools
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"nanotalon/agent/mcp"
+	"path"
+	"strings"
 )
 
 // MCPTollWrapper wraps an MCP server tool as a native nanobot tool
@@ -14,6 +17,7 @@ type MCPToolWrapper struct {
 	timeout      int
 	manager      *mcp.MCPServerManager // Need to keep reference to manager to find sessions
 	origToolName string                // Original tool name without prefix
+	artifactDir  string                // Where images and binary resources in results are saved
 }
 
 // NewMCPToolWrapper creates a new MCP tool wrapper
@@ -28,6 +32,11 @@ func NewMCPToolWrapper(session *mcp.MCPSession, serverName string, origToolName
 	}
 }
 
+// SetArtifactDir sets where images and binary resources the tool returns are saved
+func (mtw *MCPToolWrapper) SetArtifactDir(dir string) {
+	mtw.artifactDir = dir
+}
+
 // Name returns the tool name with server prefix
 func (mtw *MCPToolWrapper) Name() string {
 	return fmt.Sprintf("mcp_%s_%s", mtw.serverName, mtw.origToolName)
@@ -38,8 +47,36 @@ func (mtw *MCPToolWrapper) Description() string {
 	return mtw.toolDef.Description
 }
 
+// Parameters returns the input schema the MCP server declared for the tool
+func (mtw *MCPToolWrapper) Parameters() map[string]interface{} {
+	return mcpParameters(mtw.toolDef.InputSchema)
+}
+
+// mcpParameters adapts an MCP input schema for function calling: an object schema with
+// properties, without the $schema keyword some providers reject
+func mcpParameters(inputSchema map[string]interface{}) map[string]interface{} {
+	parameters := make(map[string]interface{}, len(inputSchema)+2)
+	for key, value := range inputSchema {
+		if key != "$schema" {
+			parameters[key] = value
+		}
+	}
+	if _, ok := parameters["type"]; !ok {
+		parameters["type"] = "object"
+	}
+	if _, ok := parameters["properties"].(map[string]interface{}); !ok {
+		parameters["properties"] = map[string]interface{}{}
+	}
+	return parameters
+}
+
 // Call executes the tool with the given arguments
 func (mtw *MCPToolWrapper) Call(args map[string]interface{}) (string, error) {
+	return mtw.CallWithProgress(args, nil)
+}
+
+// CallWithProgress executes the tool, passing the progress the server reports to progress
+func (mtw *MCPToolWrapper) CallWithProgress(args map[string]interface{}, progress func(message string)) (string, error) {
 	// Create context with timeout
 	ctx := context.Background()
 	// In a real implementation, we'd use a proper timeout context
@@ -51,126 +88,119 @@ func (mtw *MCPToolWrapper) Call(args map[string]interface{}) (string, error) {
 	}
 
 	// Call the MCP server
-	result, err := session.CallTool(ctx, mtw.origToolName, args)
+	var onProgress func(mcp.Progress)
+	if progress != nil {
+		onProgress = func(update mcp.Progress) {
+			if message := progressMessage(update); message != "" {
+				progress(message)
+			}
+		}
+	}
+	result, err := session.CallToolWithProgress(ctx, mtw.origToolName, args, onProgress)
 	if err != nil {
 		return fmt.Sprintf("Error calling MCP tool: %v", err), nil
 	}
 
-	// Format the result appropriately
-	return fmt.Sprintf("MCP tool result: %v", result), nil
+	return formatMCPResult(result, mtw.Name(), mtw.artifactDir), nil
+}
+
+// progressMessage describes a progress update, or returns "" if it says nothing
+func progressMessage(update mcp.Progress) string {
+	switch {
+	case update.Message != "" && update.Total > 0:
+		return fmt.Sprintf("%s (%.0f%%)", update.Message, 100*update.Progress/update.Total)
+	case update.Message != "":
+		return update.Message
+	case update.Total > 0:
+		return fmt.Sprintf("%.0f%% done", 100*update.Progress/update.Total)
+	}
+	return ""
 }
 
-// ConnectMCPServers connects to configured MCP servers and registers their tools
-func ConnectMCPServers(mcpServers map[string]interface{}, registry *ToolRegistry) error {
+// ConnectMCPServers connects to MCP servers and registers their tools. Images and binary
+// resources their tools return are saved to artifactDir.
+func ConnectMCPServers(servers []mcp.MCPServer, registry *ToolRegistry, artifactDir string) error {
 	manager := mcp.NewMCPServerManager()
 
-	for name, cfg := range mcpServers {
-		serverCfg := mcp.MCPServer{
-			Name: name,
+	for _, serverCfg := range servers {
+		if err := manager.AddServer(serverCfg); err != nil {
+			slog.Warn("Skipping MCP server", "server", serverCfg.Name, "error", err)
 		}
+	}
 
-		// Parse the config based on the type (could be map with command/args or URL)
-		if cfgMap, ok := cfg.(map[string]interface{}); ok {
-			if cmd, exists := cfgMap["command"].(string); exists {
-				serverCfg.Command = cmd
-				// Parse args if they exist
-				if argsIf, exists := cfgMap["args"]; exists {
-					if argsSlice, ok := argsIf.([]interface{}); ok {
-						for _, arg := range argsSlice {
-							if argStr, ok := arg.(string); ok {
-								serverCfg.Args = append(serverCfg.Args, argStr)
-							}
-						}
-					}
-				}
-
-				// Parse environment if it exists
-				if envIf, exists := cfgMap["env"]; exists {
-					if envMap, ok := envIf.(map[string]interface{}); ok {
-						serverCfg.Env = make(map[string]string)
-						for k, v := range envMap {
-							if vStr, ok := v.(string); ok {
-								serverCfg.Env[k] = vStr
-							}
-						}
-					}
-				}
-			} else if url, exists := cfgMap["url"].(string); exists {
-				serverCfg.URL = url
-				// Parse headers if they exist
-				if headersIf, exists := cfgMap["headers"]; exists {
-					if headersMap, ok := headersIf.(map[string]interface{}); ok {
-						serverCfg.Headers = make(map[string]string)
-						for k, v := range headersMap {
-							if vStr, ok := v.(string); ok {
-								serverCfg.Headers[k] = vStr
-							}
-						}
-					}
-				}
-			} else {
-				continue // Skip if neither command nor URL is provided
-			}
-
-			// Set timeout if provided
-			if timeoutIf, exists := cfgMap["toolTimeout"]; exists {
-				if timeoutFloat, ok := timeoutIf.(float64); ok {
-					serverCfg.Timeout = int(timeoutFloat)
-				}
-			} else {
-				serverCfg.Timeout = 30 // Default timeout of 30 seconds
-			}
+	// Register each server's tools once it is connected, and again whenever it reconnects,
+	// so the tools of a server that crashed come back when it does, or says they changed
+	for serverName, session := range manager.GetSessions() {
+		serverName, session := serverName, session
+		refresh := func() {
+			registerMCPTools(manager, registry, serverName, session, artifactDir)
 		}
+		session.SetOnReconnect(refresh)
+		session.SetOnToolsChanged(refresh)
+	}
 
-		// Add server to manager
-		if err := manager.AddServer(serverCfg); err != nil {
-			continue
+	// Connect all servers; those that fail keep being retried in the background
+	connectErr := manager.ConnectAll(context.Background())
+	for serverName, session := range manager.GetSessions() {
+		if session.Connected() {
+			registerMCPTools(manager, registry, serverName, session, artifactDir)
 		}
 	}
-
-	// Connect all servers
-	ctx := context.Background()
-	if err := manager.ConnectAll(ctx); err != nil {
-		return fmt.Errorf("failed to connect to MCP servers: %v", err)
+	if connectErr != nil {
+		return fmt.Errorf("failed to connect to MCP servers: %v", connectErr)
 	}
 
-	// Get tools from all servers and register them
-	tools, err := manager.GetTools(ctx)
+	return nil
+}
+
+// registerMCPTools registers the tools a server offers, replacing those it offered before
+func registerMCPTools(manager *mcp.MCPServerManager, registry *ToolRegistry, serverName string, session *mcp.MCPSession, artifactDir string) {
+	tools, err := session.ListTools(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to get tools from MCP servers: %v", err)
+		slog.Error("Failed to list tools from MCP server", "server", serverName, "error", err)
+		return
 	}
 
-	// For each tool, register it with the appropriate session
-	// We'll iterate through each server separately to ensure proper session references
-	for serverName, session := range manager.GetSessions() {
-		// Get tools specifically for this server by filtering
-		serverTools := getToolsForServer(tools, serverName)
-
-		for _, toolDef := range serverTools {
-			// Extract original tool name (remove server prefix)
-			origToolName := toolDef.Name
-			if len(origToolName) > len(serverName)+5 { // mcp_ + serverName + _
-				origToolName = toolDef.Name[len("mcp_"+serverName+"_"):]
-			}
-
-			wrapper := NewMCPToolWrapper(session, serverName, origToolName, toolDef, 30, manager)
-			registry.Register(wrapper)
+	offered := make(map[string]bool, len(tools))
+	hidden := 0
+	for _, toolDef := range tools {
+		if !mcpToolAllowed(session.Server, toolDef.Name) {
+			hidden++
+			continue
 		}
+		wrapper := NewMCPToolWrapper(session, serverName, toolDef.Name, toolDef, 30, manager)
+		wrapper.SetArtifactDir(artifactDir)
+		registry.Register(wrapper)
+		offered[wrapper.Name()] = true
 	}
 
-	return nil
-}
+	if hidden > 0 {
+		slog.Info("MCP server tools hidden by allowed_tools/blocked_tools", "server", serverName, "hidden", hidden, "tools", len(tools))
+	}
 
-// getToolsForServer filters tools for a specific server
-func getToolsForServer(allTools []mcp.ToolDefinition, serverName string) []mcp.ToolDefinition {
-	var serverTools []mcp.ToolDefinition
 	prefix := fmt.Sprintf("mcp_%s_", serverName)
-
-	for _, tool := range allTools {
-		if len(tool.Name) >= len(prefix) && tool.Name[:len(prefix)] == prefix {
-			serverTools = append(serverTools, tool)
+	for _, name := range registry.Names() {
+		if strings.HasPrefix(name, prefix) && !offered[name] {
+			registry.Unregister(name)
 		}
 	}
+}
 
-	return serverTools
+// mcpToolAllowed reports whether a server's tool may be offered to the agent: it has to
+// match one of the server's allowed patterns, if any, and none of its blocked ones
+func mcpToolAllowed(server *mcp.MCPServer, name string) bool {
+	if matchesAnyPattern(server.BlockedTools, name) {
+		return false
+	}
+	return len(server.AllowedTools) == 0 || matchesAnyPattern(server.AllowedTools, name)
+}
+
+// matchesAnyPattern reports whether name matches one of the glob patterns
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
 }
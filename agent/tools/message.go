@@ -31,6 +31,19 @@ func (t *MessageTool) Description() string {
 	return "Send a message to a specific channel/chat"
 }
 
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *MessageTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"content": map[string]interface{}{"type": "string", "description": "Message text"},
+			"channel": map[string]interface{}{"type": "string", "description": "Channel to send on, e.g. telegram (default the current one)"},
+			"chat_id": map[string]interface{}{"type": "string", "description": "Chat to send to (default the current one)"},
+		},
+		"required": []string{"content"},
+	}
+}
+
 // Call executes the tool with the given arguments
 func (t *MessageTool) Call(args map[string]interface{}) (string, error) {
 	content, ok := args["content"].(string)
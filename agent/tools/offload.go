@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// unsafeFileChars matches characters that shouldn't appear in artifact file names
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// OutputLimiter caps tool output returned to the model. Output longer than
+// maxChars is written in full to an artifact file and replaced by its head,
+// its tail and the artifact path, so the model can read the rest on demand.
+type OutputLimiter struct {
+	maxChars    int
+	artifactDir string
+}
+
+// NewOutputLimiter creates a new output limiter; maxChars <= 0 disables limiting
+func NewOutputLimiter(maxChars int, artifactDir string) *OutputLimiter {
+	return &OutputLimiter{
+		maxChars:    maxChars,
+		artifactDir: artifactDir,
+	}
+}
+
+// Limit returns the output unchanged if it fits, otherwise a summary pointing at the offloaded artifact
+func (l *OutputLimiter) Limit(toolName string, output string) string {
+	if l == nil || l.maxChars <= 0 || len(output) <= l.maxChars {
+		return output
+	}
+
+	// Keep most of the budget for the head, where answers and errors usually start
+	headLen := l.maxChars * 3 / 4
+	head := output[:runeStart(output, headLen)]
+	tail := output[runeStart(output, len(output)-(l.maxChars-headLen)):]
+	omitted := len(output) - len(head) - len(tail)
+
+	path, err := l.offload(toolName, output)
+	if err != nil {
+		return fmt.Sprintf("%s\n\n... [%d characters omitted; could not save full output: %v] ...\n\n%s",
+			head, omitted, err, tail)
+	}
+
+	return fmt.Sprintf("%s\n\n... [%d characters omitted; full output (%d characters) saved to %s — use read_file to see more] ...\n\n%s",
+		head, omitted, len(output), path, tail)
+}
+
+// runeStart moves a byte offset back to the start of the character it falls in, so
+// slicing there doesn't split a multi-byte character
+func runeStart(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
+// offload writes the full output to a new artifact file and returns its path
+func (l *OutputLimiter) offload(toolName string, output string) (string, error) {
+	if l.artifactDir == "" {
+		return "", fmt.Errorf("no artifact directory configured")
+	}
+	if err := os.MkdirAll(l.artifactDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating artifact directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.txt", unsafeFileChars.ReplaceAllString(toolName, "_"), time.Now().Format("20060102-150405.000000000"))
+	path := filepath.Join(l.artifactDir, name)
+	if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+		return "", fmt.Errorf("error writing artifact: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkPathAllowed returns an error unless path resolves to a location inside allowedDir.
+// Symlinks are resolved on both sides, so a link inside the directory pointing elsewhere
+// is rejected, and containment is checked with filepath.Rel so sibling directories that
+// share a prefix (/workspace-evil vs /workspace) don't pass.
+func checkPathAllowed(path string, allowedDir string) error {
+	if allowedDir == "" {
+		return nil
+	}
+
+	realAllowedDir, err := resolveRealPath(allowedDir)
+	if err != nil {
+		return fmt.Errorf("error resolving allowed directory: %w", err)
+	}
+	realPath, err := resolveRealPath(path)
+	if err != nil {
+		return fmt.Errorf("error resolving path: %w", err)
+	}
+
+	if !isWithinDir(realPath, realAllowedDir) {
+		return fmt.Errorf("path %s is outside allowed directory %s", path, allowedDir)
+	}
+	return nil
+}
+
+// isWithinDir reports whether path is dir or lies beneath it; both must be absolute and clean
+func isWithinDir(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// resolveRealPath returns the absolute path with all symlinks resolved. For paths that
+// don't exist yet (e.g. a file about to be written) the deepest existing ancestor is
+// resolved and the remaining components are appended.
+func resolveRealPath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	current := absPath
+	for {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return absPath, nil
+		}
+		missing = append([]string{filepath.Base(current)}, missing...)
+		current = parent
+	}
+}
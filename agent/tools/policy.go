@@ -0,0 +1,34 @@
+package tools
+
+// ToolPolicy decides which tools are available for a request.
+// An empty enabled list allows every tool; the disabled list always wins.
+type ToolPolicy struct {
+	enabled  map[string]bool
+	disabled map[string]bool
+}
+
+// NewToolPolicy creates a new tool policy from enabled and disabled tool names
+func NewToolPolicy(enabled []string, disabled []string) *ToolPolicy {
+	p := &ToolPolicy{
+		enabled:  make(map[string]bool, len(enabled)),
+		disabled: make(map[string]bool, len(disabled)),
+	}
+	for _, name := range enabled {
+		p.enabled[name] = true
+	}
+	for _, name := range disabled {
+		p.disabled[name] = true
+	}
+	return p
+}
+
+// Allows reports whether the named tool may be used under this policy
+func (p *ToolPolicy) Allows(name string) bool {
+	if p == nil {
+		return true
+	}
+	if p.disabled[name] {
+		return false
+	}
+	return len(p.enabled) == 0 || p.enabled[name]
+}
@@ -0,0 +1,346 @@
+package tools
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxProcessLogBytes is how much recent output is kept for each background process
+const maxProcessLogBytes = 256 * 1024
+
+// BackgroundProcess is a long-running command started by the exec tool
+type BackgroundProcess struct {
+	ID      string
+	Command string
+	PID     int
+	Started time.Time
+
+	cmd      *exec.Cmd
+	logs     *processLog
+	mu       sync.Mutex
+	finished time.Time
+	exitErr  error
+	done     chan struct{}
+}
+
+// Running reports whether the process is still running
+func (p *BackgroundProcess) Running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Status returns a short human-readable status for the process
+func (p *BackgroundProcess) Status() string {
+	if p.Running() {
+		return fmt.Sprintf("running for %s", time.Since(p.Started).Round(time.Second))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.exitErr != nil {
+		return fmt.Sprintf("exited (%v) at %s", p.exitErr, p.finished.Format("15:04:05"))
+	}
+	return fmt.Sprintf("exited (0) at %s", p.finished.Format("15:04:05"))
+}
+
+// processLog is a concurrency-safe buffer that keeps only the most recent output
+type processLog struct {
+	mu        sync.Mutex
+	buf       []byte
+	discarded int
+}
+
+// Write appends output, dropping the oldest bytes beyond the limit
+func (l *processLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, p...)
+	if over := len(l.buf) - maxProcessLogBytes; over > 0 {
+		l.buf = append([]byte(nil), l.buf[over:]...)
+		l.discarded += over
+	}
+	return len(p), nil
+}
+
+// Tail returns the last n lines of output, or everything if n <= 0
+func (l *processLog) Tail(n int) (string, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := string(l.buf)
+	if n > 0 {
+		lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+		if len(lines) > n {
+			lines = lines[len(lines)-n:]
+		}
+		out = strings.Join(lines, "\n")
+	}
+	return out, l.discarded
+}
+
+// ProcessManager tracks background processes started by the exec tool
+type ProcessManager struct {
+	mu        sync.Mutex
+	processes map[string]*BackgroundProcess
+	nextID    int
+}
+
+// NewProcessManager creates a new background process manager
+func NewProcessManager() *ProcessManager {
+	return &ProcessManager{
+		processes: make(map[string]*BackgroundProcess),
+	}
+}
+
+// Start launches cmd in the background and returns its handle
+func (pm *ProcessManager) Start(command string, cmd *exec.Cmd) (*BackgroundProcess, error) {
+	logs := &processLog{}
+	cmd.Stdout = logs
+	cmd.Stderr = logs
+	setProcessGroup(cmd)
+	// Don't let a grandchild holding the output pipe keep Wait from returning
+	cmd.WaitDelay = 2 * time.Second
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting command: %w", err)
+	}
+
+	pm.mu.Lock()
+	pm.nextID++
+	proc := &BackgroundProcess{
+		ID:      fmt.Sprintf("proc-%d", pm.nextID),
+		Command: command,
+		PID:     cmd.Process.Pid,
+		Started: time.Now(),
+		cmd:     cmd,
+		logs:    logs,
+		done:    make(chan struct{}),
+	}
+	pm.processes[proc.ID] = proc
+	pm.mu.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+		proc.mu.Lock()
+		proc.exitErr = err
+		proc.finished = time.Now()
+		proc.mu.Unlock()
+		close(proc.done)
+	}()
+
+	return proc, nil
+}
+
+// Get returns the process with the given ID, or nil
+func (pm *ProcessManager) Get(id string) *BackgroundProcess {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.processes[id]
+}
+
+// List returns all tracked processes ordered by start time
+func (pm *ProcessManager) List() []*BackgroundProcess {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	procs := make([]*BackgroundProcess, 0, len(pm.processes))
+	for _, p := range pm.processes {
+		procs = append(procs, p)
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].Started.Before(procs[j].Started)
+	})
+	return procs
+}
+
+// Kill terminates a running process and waits briefly for it to exit
+func (pm *ProcessManager) Kill(id string) error {
+	proc := pm.Get(id)
+	if proc == nil {
+		return fmt.Errorf("no such process: %s", id)
+	}
+	if !proc.Running() {
+		return nil
+	}
+
+	if err := killProcessTree(proc.cmd); err != nil {
+		return fmt.Errorf("error killing process %s: %w", id, err)
+	}
+
+	select {
+	case <-proc.done:
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("process %s did not exit after kill", id)
+	}
+	return nil
+}
+
+// KillAll terminates every running process, used on shutdown
+func (pm *ProcessManager) KillAll() {
+	for _, proc := range pm.List() {
+		if proc.Running() {
+			pm.Kill(proc.ID)
+		}
+	}
+}
+
+// ProcessListTool implements a tool to list background processes
+type ProcessListTool struct {
+	manager *ProcessManager
+}
+
+// NewProcessListTool creates a new process list tool
+func NewProcessListTool(manager *ProcessManager) *ProcessListTool {
+	return &ProcessListTool{manager: manager}
+}
+
+// Name returns the name of the tool
+func (t *ProcessListTool) Name() string {
+	return "process_list"
+}
+
+// Description returns the description of the tool
+func (t *ProcessListTool) Description() string {
+	return "List background processes started with execute_command (background=true)"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ProcessListTool) Parameters() map[string]interface{} {
+	return emptyParameters()
+}
+
+// Call executes the tool with the given arguments
+func (t *ProcessListTool) Call(args map[string]interface{}) (string, error) {
+	procs := t.manager.List()
+	if len(procs) == 0 {
+		return "No background processes.", nil
+	}
+
+	var result strings.Builder
+	result.WriteString("Background processes:\n")
+	for _, p := range procs {
+		result.WriteString(fmt.Sprintf("- %s (pid %d): %s [%s]\n", p.ID, p.PID, p.Command, p.Status()))
+	}
+	return result.String(), nil
+}
+
+// ProcessKillTool implements a tool to stop a background process
+type ProcessKillTool struct {
+	manager *ProcessManager
+}
+
+// NewProcessKillTool creates a new process kill tool
+func NewProcessKillTool(manager *ProcessManager) *ProcessKillTool {
+	return &ProcessKillTool{manager: manager}
+}
+
+// Name returns the name of the tool
+func (t *ProcessKillTool) Name() string {
+	return "process_kill"
+}
+
+// Description returns the description of the tool
+func (t *ProcessKillTool) Description() string {
+	return "Stop a background process by its id (e.g. proc-1)"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ProcessKillTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{"type": "string", "description": "Process id from execute_command or process_list, e.g. proc-1"},
+		},
+		"required": []string{"id"},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *ProcessKillTool) Call(args map[string]interface{}) (string, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing 'id' argument")
+	}
+
+	proc := t.manager.Get(id)
+	if proc == nil {
+		return "", fmt.Errorf("no such process: %s", id)
+	}
+	if !proc.Running() {
+		return fmt.Sprintf("Process %s already %s", id, proc.Status()), nil
+	}
+
+	if err := t.manager.Kill(id); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Process %s stopped", id), nil
+}
+
+// ProcessLogsTool implements a tool to read output from a background process
+type ProcessLogsTool struct {
+	manager *ProcessManager
+}
+
+// NewProcessLogsTool creates a new process logs tool
+func NewProcessLogsTool(manager *ProcessManager) *ProcessLogsTool {
+	return &ProcessLogsTool{manager: manager}
+}
+
+// Name returns the name of the tool
+func (t *ProcessLogsTool) Name() string {
+	return "process_logs"
+}
+
+// Description returns the description of the tool
+func (t *ProcessLogsTool) Description() string {
+	return "Show recent output of a background process by its id; 'lines' limits output to the last N lines (default 100)"
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ProcessLogsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":    map[string]interface{}{"type": "string", "description": "Process id from execute_command or process_list, e.g. proc-1"},
+			"lines": map[string]interface{}{"type": "integer", "minimum": 1, "description": "How many of the last lines to show (default 100)"},
+		},
+		"required": []string{"id"},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *ProcessLogsTool) Call(args map[string]interface{}) (string, error) {
+	id, ok := args["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing 'id' argument")
+	}
+
+	lines := 100
+	if n, ok := args["lines"].(float64); ok {
+		lines = int(n)
+	}
+
+	proc := t.manager.Get(id)
+	if proc == nil {
+		return "", fmt.Errorf("no such process: %s", id)
+	}
+
+	output, discarded := proc.logs.Tail(lines)
+	header := fmt.Sprintf("%s (pid %d): %s [%s]\n", proc.ID, proc.PID, proc.Command, proc.Status())
+	if discarded > 0 {
+		header += fmt.Sprintf("(%d earlier bytes of output were discarded)\n", discarded)
+	}
+	if output == "" {
+		return header + "No output yet.", nil
+	}
+	return header + output, nil
+}
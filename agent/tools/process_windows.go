@@ -0,0 +1,15 @@
+//go:build windows
+
+package tools
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessTree kills the command; child processes are not tracked on Windows
+func killProcessTree(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
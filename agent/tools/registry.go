@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 )
 
 // Tool defines the interface for a tool
@@ -37,6 +39,17 @@ func (t *ReadFileTool) Description() string {
 	return "Read the content of a file"
 }
 
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ReadFileTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{"type": "string", "description": "Path of the file to read"},
+		},
+		"required": []string{"path"},
+	}
+}
+
 // Call executes the tool with the given arguments
 func (t *ReadFileTool) Call(args map[string]interface{}) (string, error) {
 	filePath, ok := args["path"].(string)
@@ -45,19 +58,8 @@ func (t *ReadFileTool) Call(args map[string]interface{}) (string, error) {
 	}
 
 	// Verify path is allowed if restriction is in place
-	if t.allowedDir != "" {
-		absPath, err := filepath.Abs(filePath)
-		if err != nil {
-			return "", fmt.Errorf("error resolving path: %w", err)
-		}
-		absAllowedDir, err := filepath.Abs(t.allowedDir)
-		if err != nil {
-			return "", fmt.Errorf("error resolving allowed directory: %w", err)
-		}
-
-		if !filepath.HasPrefix(absPath, absAllowedDir) {
-			return "", fmt.Errorf("path %s is outside allowed directory %s", filePath, t.allowedDir)
-		}
+	if err := checkPathAllowed(filePath, t.allowedDir); err != nil {
+		return "", err
 	}
 
 	content, err := os.ReadFile(filePath)
@@ -92,6 +94,18 @@ func (t *WriteFileTool) Description() string {
 	return "Write content to a file"
 }
 
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *WriteFileTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path":    map[string]interface{}{"type": "string", "description": "Path of the file to write"},
+			"content": map[string]interface{}{"type": "string", "description": "Full content to write"},
+		},
+		"required": []string{"path", "content"},
+	}
+}
+
 // Call executes the tool with the given arguments
 func (t *WriteFileTool) Call(args map[string]interface{}) (string, error) {
 	filePath, ok := args["path"].(string)
@@ -105,19 +119,8 @@ func (t *WriteFileTool) Call(args map[string]interface{}) (string, error) {
 	}
 
 	// Verify path is allowed if restriction is in place
-	if t.allowedDir != "" {
-		absPath, err := filepath.Abs(filePath)
-		if err != nil {
-			return "", fmt.Errorf("error resolving path: %w", err)
-		}
-		absAllowedDir, err := filepath.Abs(t.allowedDir)
-		if err != nil {
-			return "", fmt.Errorf("error resolving allowed directory: %w", err)
-		}
-
-		if !filepath.HasPrefix(absPath, absAllowedDir) {
-			return "", fmt.Errorf("path %s is outside allowed directory %s", filePath, t.allowedDir)
-		}
+	if err := checkPathAllowed(filePath, t.allowedDir); err != nil {
+		return "", err
 	}
 
 	// Create directory if it doesn't exist
@@ -157,6 +160,17 @@ func (t *ListDirTool) Description() string {
 	return "List the contents of a directory"
 }
 
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *ListDirTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{"type": "string", "description": "Directory to list (default: current directory)"},
+		},
+		"required": []string{},
+	}
+}
+
 // Call executes the tool with the given arguments
 func (t *ListDirTool) Call(args map[string]interface{}) (string, error) {
 	dirPath, ok := args["path"].(string)
@@ -166,19 +180,8 @@ func (t *ListDirTool) Call(args map[string]interface{}) (string, error) {
 	}
 
 	// Verify path is allowed if restriction is in place
-	if t.allowedDir != "" {
-		absPath, err := filepath.Abs(dirPath)
-		if err != nil {
-			return "", fmt.Errorf("error resolving path: %w", err)
-		}
-		absAllowedDir, err := filepath.Abs(t.allowedDir)
-		if err != nil {
-			return "", fmt.Errorf("error resolving allowed directory: %w", err)
-		}
-
-		if !filepath.HasPrefix(absPath, absAllowedDir) {
-			return "", fmt.Errorf("path %s is outside allowed directory %s", dirPath, t.allowedDir)
-		}
+	if err := checkPathAllowed(dirPath, t.allowedDir); err != nil {
+		return "", err
 	}
 
 	entries, err := os.ReadDir(dirPath)
@@ -198,9 +201,12 @@ func (t *ListDirTool) Call(args map[string]interface{}) (string, error) {
 	return result, nil
 }
 
-// ToolRegistry manages available tools
+// ToolRegistry manages available tools. It is safe for concurrent use, as tools of MCP
+// servers come and go while the agent runs.
 type ToolRegistry struct {
-	tools map[string]Tool
+	mu      sync.RWMutex
+	tools   map[string]Tool
+	limiter *OutputLimiter
 }
 
 // NewToolRegistry creates a new tool registry
@@ -212,32 +218,83 @@ func NewToolRegistry() *ToolRegistry {
 
 // Register adds a tool to the registry
 func (tr *ToolRegistry) Register(tool Tool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
 	tr.tools[tool.Name()] = tool
 }
 
+// Unregister removes a tool from the registry
+func (tr *ToolRegistry) Unregister(name string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	delete(tr.tools, name)
+}
+
+// SetOutputLimiter sets the limiter applied to tool output returned by Execute
+func (tr *ToolRegistry) SetOutputLimiter(limiter *OutputLimiter) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.limiter = limiter
+}
+
 // Get retrieves a tool by name
 func (tr *ToolRegistry) Get(name string) Tool {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
 	return tr.tools[name]
 }
 
+// Names returns the names of all registered tools in sorted order
+func (tr *ToolRegistry) Names() []string {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	names := make([]string, 0, len(tr.tools))
+	for name := range tr.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Filter returns a new registry containing only the tools allowed by every policy
+func (tr *ToolRegistry) Filter(policies ...*ToolPolicy) *ToolRegistry {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	filtered := NewToolRegistry()
+	filtered.limiter = tr.limiter
+	for name, tool := range tr.tools {
+		allowed := true
+		for _, policy := range policies {
+			if !policy.Allows(name) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			filtered.tools[name] = tool
+		}
+	}
+	return filtered
+}
+
 // GetDefinitions returns tool definitions for API
 func (tr *ToolRegistry) GetDefinitions() []interface{} {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
 	definitions := make([]interface{}, 0, len(tr.tools))
 
 	for _, tool := range tr.tools {
+		parameters := emptyParameters()
+		if schemaTool, ok := tool.(SchemaTool); ok {
+			parameters = schemaTool.Parameters()
+		}
+
 		def := map[string]interface{}{
 			"type": "function",
 			"function": map[string]interface{}{
 				"name":        tool.Name(),
 				"description": tool.Description(),
-				"parameters": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						// Define parameters based on tool type
-						// For now, we'll use a simple structure
-					},
-					"required": []string{}, // Define required parameters based on tool
-				},
+				"parameters":  parameters,
 			},
 		}
 		definitions = append(definitions, def)
@@ -246,12 +303,61 @@ func (tr *ToolRegistry) GetDefinitions() []interface{} {
 	return definitions
 }
 
+// ProgressTool is implemented by tools that report progress while a call runs
+type ProgressTool interface {
+	Tool
+	CallWithProgress(args map[string]interface{}, progress func(message string)) (string, error)
+}
+
 // Execute runs a tool with the given arguments
 func (tr *ToolRegistry) Execute(name string, args map[string]interface{}) (string, error) {
+	return tr.ExecuteWithProgress(name, args, nil)
+}
+
+// ExecuteWithProgress runs a tool, passing what it reports about its progress to progress
+// if it isn't nil and the tool reports any
+func (tr *ToolRegistry) ExecuteWithProgress(name string, args map[string]interface{}, progress func(message string)) (string, error) {
+	tr.mu.RLock()
 	tool, exists := tr.tools[name]
+	limiter := tr.limiter
+	tr.mu.RUnlock()
 	if !exists {
 		return "", fmt.Errorf("unknown tool: %s", name)
 	}
 
-	return tool.Call(args)
-}
\ No newline at end of file
+	var result string
+	var err error
+	if progressTool, ok := tool.(ProgressTool); ok && progress != nil {
+		result, err = progressTool.CallWithProgress(args, progress)
+	} else {
+		result, err = tool.Call(args)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	return limiter.Limit(name, result), nil
+}
+// ApprovableTool is implemented by tools that hold some calls for the user's approval
+type ApprovableTool interface {
+	Tool
+	CallApproved(args map[string]interface{}) (string, error)
+}
+
+// ExecuteApproved runs a call the user has approved, skipping the tool's approval check
+func (tr *ToolRegistry) ExecuteApproved(name string, args map[string]interface{}) (string, error) {
+	tr.mu.RLock()
+	tool, ok := tr.tools[name].(ApprovableTool)
+	limiter := tr.limiter
+	tr.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("tool %s does not take approvals", name)
+	}
+
+	result, err := tool.CallApproved(args)
+	if err != nil {
+		return result, err
+	}
+
+	return limiter.Limit(name, result), nil
+}
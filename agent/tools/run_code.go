@@ -0,0 +1,265 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pythonFigureHook saves any open matplotlib figures when the snippet exits.
+// It is installed as sitecustomize.py so line numbers in tracebacks match the snippet.
+const pythonFigureHook = `import atexit as _nt_atexit, sys as _nt_sys
+def _nt_save_figures():
+    if "matplotlib.pyplot" not in _nt_sys.modules:
+        return
+    _plt = _nt_sys.modules["matplotlib.pyplot"]
+    for _num in _plt.get_fignums():
+        _plt.figure(_num).savefig("figure_%d.png" % _num)
+_nt_atexit.register(_nt_save_figures)
+`
+
+// runCodeEnv lists the variables snippets inherit; anything else, such as API keys, stays out.
+// Windows needs SYSTEMROOT to start the interpreters at all.
+var runCodeEnv = []string{"PATH", "LANG", "SYSTEMROOT"}
+
+// codeStringPattern matches the string literals of a snippet
+var codeStringPattern = regexp.MustCompile(`"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'|` + "`[^`]*`")
+
+// RunCodeTool implements a tool to run short Python or JavaScript snippets
+type RunCodeTool struct {
+	workspace           string
+	timeout             time.Duration
+	memoryMB            int
+	restrictToWorkspace bool
+}
+
+// NewRunCodeTool creates a new code interpreter tool. With restrictToWorkspace, snippets
+// naming paths outside the workspace are refused.
+func NewRunCodeTool(workspace string, timeout int, memoryMB int, restrictToWorkspace bool) *RunCodeTool {
+	if timeout <= 0 {
+		timeout = 30
+	}
+	if memoryMB <= 0 {
+		memoryMB = 512
+	}
+	return &RunCodeTool{
+		workspace:           workspace,
+		timeout:             time.Duration(timeout) * time.Second,
+		memoryMB:            memoryMB,
+		restrictToWorkspace: restrictToWorkspace,
+	}
+}
+
+// Name returns the name of the tool
+func (t *RunCodeTool) Name() string {
+	return "run_code"
+}
+
+// Description returns the description of the tool
+func (t *RunCodeTool) Description() string {
+	return "Run a short Python or JavaScript (Node) snippet, given as code in the chosen language, with time and memory limits. Files the snippet writes to its working directory (including matplotlib figures) are kept in the workspace."
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *RunCodeTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"code":     map[string]interface{}{"type": "string", "description": "Source of the snippet; print what you want to see"},
+			"language": map[string]interface{}{"type": "string", "enum": []string{"python", "javascript"}, "description": "Runtime to use (default python)"},
+		},
+		"required": []string{"code"},
+	}
+}
+
+// Call executes the tool with the given arguments
+func (t *RunCodeTool) Call(args map[string]interface{}) (string, error) {
+	code, ok := args["code"].(string)
+	if !ok || strings.TrimSpace(code) == "" {
+		return "", fmt.Errorf("missing 'code' argument")
+	}
+
+	language, _ := args["language"].(string)
+	if language == "" {
+		language = "python"
+	}
+
+	var interpreter, fileName string
+	var interpreterArgs []string
+	switch strings.ToLower(language) {
+	case "python", "py", "python3":
+		interpreter, fileName = "python3", "main.py"
+	case "javascript", "js", "node":
+		interpreter, fileName = "node", "main.js"
+		// V8 reserves far more virtual memory than it uses, so cap the heap instead of the address space
+		interpreterArgs = append(interpreterArgs, fmt.Sprintf("--max-old-space-size=%d", t.memoryMB))
+	default:
+		return "", fmt.Errorf("unsupported language: %s (use python or javascript)", language)
+	}
+
+	if _, err := exec.LookPath(interpreter); err != nil {
+		return "", fmt.Errorf("%s interpreter not found on PATH", interpreter)
+	}
+
+	// Each run gets its own directory so artifacts don't collide
+	runDir := filepath.Join(t.workspace, "runs", time.Now().Format("20060102-150405.000000000"))
+
+	if t.restrictToWorkspace {
+		if err := t.checkCodePaths(code, runDir); err != nil {
+			return "", fmt.Errorf("code violates workspace restriction: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating run directory: %w", err)
+	}
+
+	scriptPath := filepath.Join(runDir, fileName)
+	if err := os.WriteFile(scriptPath, []byte(code), 0644); err != nil {
+		return "", fmt.Errorf("error writing script: %w", err)
+	}
+
+	// HOME points at a throwaway directory so the snippet can't read the user's dotfiles
+	home, err := os.MkdirTemp("", "nanotalon-run-")
+	if err != nil {
+		return "", fmt.Errorf("error creating home directory: %w", err)
+	}
+	defer os.RemoveAll(home)
+
+	env := []string{"HOME=" + home, "MPLBACKEND=Agg", "PYTHONUNBUFFERED=1"}
+	for _, name := range runCodeEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	if _, ok := os.LookupEnv("LANG"); !ok {
+		env = append(env, "LANG=C.UTF-8")
+	}
+	if interpreter == "python3" {
+		if err := os.WriteFile(filepath.Join(runDir, "sitecustomize.py"), []byte(pythonFigureHook), 0644); err != nil {
+			return "", fmt.Errorf("error writing figure hook: %w", err)
+		}
+		env = append(env, "PYTHONPATH="+runDir)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	cmd := t.buildCommand(ctx, interpreter, interpreterArgs, fileName, interpreter == "python3")
+	cmd.Dir = runDir
+	cmd.Env = env
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	runErr := cmd.Run()
+
+	os.WriteFile(filepath.Join(runDir, "stdout.txt"), stdout.Bytes(), 0644)
+	os.WriteFile(filepath.Join(runDir, "stderr.txt"), stderr.Bytes(), 0644)
+
+	var result strings.Builder
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		result.WriteString(fmt.Sprintf("Execution timed out after %v\n", t.timeout))
+	case runErr != nil:
+		result.WriteString(fmt.Sprintf("Execution failed: %v\n", runErr))
+	default:
+		result.WriteString("Execution finished successfully\n")
+	}
+
+	if stdout.Len() > 0 {
+		result.WriteString("\nstdout:\n")
+		result.WriteString(truncateOutput(stdout.String(), 8000))
+	}
+	if stderr.Len() > 0 {
+		result.WriteString("\nstderr:\n")
+		result.WriteString(truncateOutput(stderr.String(), 4000))
+	}
+
+	if artifacts := listArtifacts(runDir, fileName); len(artifacts) > 0 {
+		result.WriteString("\nArtifacts:\n")
+		for _, artifact := range artifacts {
+			result.WriteString(fmt.Sprintf("  %s\n", filepath.Join(runDir, artifact)))
+		}
+	}
+
+	return result.String(), nil
+}
+
+// buildCommand wraps the interpreter so the memory limit is enforced where the OS supports it
+func (t *RunCodeTool) buildCommand(ctx context.Context, interpreter string, interpreterArgs []string, fileName string, limitAddressSpace bool) *exec.Cmd {
+	args := append(interpreterArgs, fileName)
+
+	if runtime.GOOS == "windows" || !limitAddressSpace {
+		return exec.CommandContext(ctx, interpreter, args...)
+	}
+
+	// ulimit -v takes kilobytes; exec keeps the interpreter as the direct child so timeouts kill it
+	script := fmt.Sprintf("ulimit -v %d && exec \"$0\" \"$@\"", t.memoryMB*1024)
+	return exec.CommandContext(ctx, "sh", append([]string{"-c", script, interpreter}, args...)...)
+}
+
+// listArtifacts returns the files produced by a run, excluding the script and captured output
+func listArtifacts(runDir, scriptName string) []string {
+	entries, err := os.ReadDir(runDir)
+	if err != nil {
+		return nil
+	}
+
+	var artifacts []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == scriptName || name == "sitecustomize.py" || name == "stdout.txt" || name == "stderr.txt" {
+			continue
+		}
+		artifacts = append(artifacts, name)
+	}
+	sort.Strings(artifacts)
+	return artifacts
+}
+
+// checkCodePaths rejects snippets whose string literals name paths outside the workspace.
+// Like the exec tool's check this is a guard against mistakes, not a sandbox: code can
+// always build a path at run time.
+func (t *RunCodeTool) checkCodePaths(code, runDir string) error {
+	for _, literal := range codeStringPattern.FindAllString(code, -1) {
+		token := literal[1 : len(literal)-1]
+
+		if strings.HasPrefix(token, "~") {
+			return fmt.Errorf("home directory paths are not allowed: %s", token)
+		}
+		// URLs and separators on their own, as in split("/"), aren't paths
+		if strings.Contains(token, "://") || strings.Trim(token, "/") == "" {
+			continue
+		}
+		if !strings.Contains(token, "/") && token != ".." {
+			continue
+		}
+
+		path := token
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(runDir, path)
+		}
+		if err := checkPathAllowed(path, t.workspace); err != nil {
+			return fmt.Errorf("%s is outside the workspace", token)
+		}
+	}
+	return nil
+}
+
+// truncateOutput limits output to maxLen bytes, cutting at a character boundary
+func truncateOutput(output string, maxLen int) string {
+	if len(output) <= maxLen {
+		return output
+	}
+	return output[:runeStart(output, maxLen)] + "\n... (output truncated)"
+}
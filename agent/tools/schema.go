@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// SchemaTool is implemented by tools that describe their arguments with a JSON Schema.
+// The schema is sent to the model and used to validate calls before they run.
+type SchemaTool interface {
+	Tool
+	Parameters() map[string]interface{}
+}
+
+// emptyParameters is the schema advertised for tools that don't describe their arguments
+func emptyParameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+		"required":   []string{},
+	}
+}
+
+// ValidateArgs checks a call against the tool's schema: the tool must exist, required
+// arguments must be present and declared arguments must have the declared JSON type and
+// one of the declared values. Tools without a schema accept any arguments.
+func (tr *ToolRegistry) ValidateArgs(name string, args map[string]interface{}) error {
+	tool := tr.Get(name)
+	if tool == nil {
+		return fmt.Errorf("unknown tool %q; available tools: %s", name, strings.Join(tr.Names(), ", "))
+	}
+
+	schemaTool, ok := tool.(SchemaTool)
+	if !ok {
+		return nil
+	}
+	schema := schemaTool.Parameters()
+
+	var problems []string
+	for _, required := range stringList(schema["required"]) {
+		if _, present := args[required]; !present {
+			problems = append(problems, fmt.Sprintf("missing required argument %q", required))
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(args))
+	for argName := range args {
+		names = append(names, argName)
+	}
+	sort.Strings(names)
+	for _, argName := range names {
+		property, _ := properties[argName].(map[string]interface{})
+		expected, _ := property["type"].(string)
+		if expected != "" && !matchesJSONType(args[argName], expected) {
+			problems = append(problems, fmt.Sprintf("argument %q must be of type %s", argName, expected))
+			continue
+		}
+		if values := stringList(property["enum"]); len(values) > 0 && !slices.Contains(values, fmt.Sprint(args[argName])) {
+			problems = append(problems, fmt.Sprintf("argument %q must be one of %s", argName, strings.Join(values, ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// stringList reads a list of names from a schema, such as its required arguments or a
+// property's allowed values, which may be []string or decoded JSON
+func stringList(list interface{}) []string {
+	switch v := list.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		var names []string
+		for _, item := range v {
+			if name, ok := item.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// matchesJSONType reports whether a decoded JSON value has the given schema type
+func matchesJSONType(value interface{}, jsonType string) bool {
+	switch jsonType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		switch value.(type) {
+		case float64, float32, int, int64:
+			return true
+		}
+		return false
+	case "integer":
+		switch v := value.(type) {
+		case float64:
+			return v == float64(int64(v))
+		case int, int64:
+			return true
+		}
+		return false
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return true
+}
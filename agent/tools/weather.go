@@ -0,0 +1,288 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WeatherTool implements a tool to look up current weather and forecasts via Open-Meteo
+type WeatherTool struct {
+	defaultLocation string
+	units           string
+	geocodingURL    string
+	forecastURL     string
+	client          *http.Client
+}
+
+// NewWeatherTool creates a new weather tool; units is "metric" or "imperial"
+func NewWeatherTool(defaultLocation string, units string) *WeatherTool {
+	if units != "imperial" {
+		units = "metric"
+	}
+	return &WeatherTool{
+		defaultLocation: defaultLocation,
+		units:           units,
+		geocodingURL:    "https://geocoding-api.open-meteo.com/v1/search",
+		forecastURL:     "https://api.open-meteo.com/v1/forecast",
+		client:          &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// SetEndpoints overrides the Open-Meteo geocoding and forecast URLs
+func (t *WeatherTool) SetEndpoints(geocodingURL, forecastURL string) {
+	t.geocodingURL = geocodingURL
+	t.forecastURL = forecastURL
+}
+
+// Name returns the name of the tool
+func (t *WeatherTool) Name() string {
+	return "weather"
+}
+
+// Description returns the description of the tool
+func (t *WeatherTool) Description() string {
+	desc := "Get current weather and a daily forecast (up to 7 days) for a place name or 'lat,lon' coordinates."
+	if t.defaultLocation != "" {
+		desc += fmt.Sprintf(" Defaults to %s when no location is given.", t.defaultLocation)
+	}
+	return desc
+}
+
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *WeatherTool) Parameters() map[string]interface{} {
+	location := "Place name, e.g. \"Lisbon\", or \"lat,lon\" coordinates"
+	if t.defaultLocation != "" {
+		location += fmt.Sprintf(" (default %s)", t.defaultLocation)
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"location": map[string]interface{}{"type": "string", "description": location},
+			"units":    map[string]interface{}{"type": "string", "enum": []string{"metric", "imperial"}, "description": "Units to report in (default " + t.units + ")"},
+			"days":     map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 7, "description": "Days of forecast (default 3)"},
+		},
+		"required": []string{},
+	}
+}
+
+// geoLocation is a resolved place
+type geoLocation struct {
+	Name      string  `json:"name"`
+	Country   string  `json:"country"`
+	Admin1    string  `json:"admin1"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Call executes the tool with the given arguments
+func (t *WeatherTool) Call(args map[string]interface{}) (string, error) {
+	location, _ := args["location"].(string)
+	location = strings.TrimSpace(location)
+	if location == "" {
+		location = t.defaultLocation
+	}
+	if location == "" {
+		return "", fmt.Errorf("missing 'location' argument and no default location configured (tools.weather.default_location)")
+	}
+
+	days := 3
+	if d, ok := args["days"].(float64); ok {
+		days = int(d)
+	}
+	if days < 1 {
+		days = 1
+	}
+	if days > 7 {
+		days = 7
+	}
+
+	units := t.units
+	if u, ok := args["units"].(string); ok && (u == "metric" || u == "imperial") {
+		units = u
+	}
+
+	place, err := t.resolveLocation(location)
+	if err != nil {
+		return "", err
+	}
+
+	return t.forecast(place, days, units)
+}
+
+// resolveLocation turns a place name or "lat,lon" string into coordinates
+func (t *WeatherTool) resolveLocation(location string) (*geoLocation, error) {
+	if lat, lon, ok := parseCoordinates(location); ok {
+		return &geoLocation{Name: location, Latitude: lat, Longitude: lon}, nil
+	}
+
+	params := url.Values{}
+	params.Set("name", location)
+	params.Set("count", "1")
+	params.Set("format", "json")
+
+	var result struct {
+		Results []geoLocation `json:"results"`
+	}
+	if err := t.getJSON(t.geocodingURL+"?"+params.Encode(), &result); err != nil {
+		return nil, fmt.Errorf("error looking up location: %w", err)
+	}
+	if len(result.Results) == 0 {
+		return nil, fmt.Errorf("location not found: %s", location)
+	}
+	return &result.Results[0], nil
+}
+
+// forecast fetches and formats the weather for a resolved place
+func (t *WeatherTool) forecast(place *geoLocation, days int, units string) (string, error) {
+	params := url.Values{}
+	params.Set("latitude", strconv.FormatFloat(place.Latitude, 'f', 4, 64))
+	params.Set("longitude", strconv.FormatFloat(place.Longitude, 'f', 4, 64))
+	params.Set("current", "temperature_2m,apparent_temperature,relative_humidity_2m,weather_code,wind_speed_10m")
+	params.Set("daily", "weather_code,temperature_2m_max,temperature_2m_min,precipitation_probability_max")
+	params.Set("timezone", "auto")
+	params.Set("forecast_days", strconv.Itoa(days))
+
+	tempUnit, windUnit := "°C", "km/h"
+	if units == "imperial" {
+		params.Set("temperature_unit", "fahrenheit")
+		params.Set("wind_speed_unit", "mph")
+		tempUnit, windUnit = "°F", "mph"
+	}
+
+	var data struct {
+		Current struct {
+			Temperature         float64 `json:"temperature_2m"`
+			ApparentTemperature float64 `json:"apparent_temperature"`
+			Humidity            float64 `json:"relative_humidity_2m"`
+			WeatherCode         int     `json:"weather_code"`
+			WindSpeed           float64 `json:"wind_speed_10m"`
+		} `json:"current"`
+		Daily struct {
+			Time              []string  `json:"time"`
+			WeatherCode       []int     `json:"weather_code"`
+			TemperatureMax    []float64 `json:"temperature_2m_max"`
+			TemperatureMin    []float64 `json:"temperature_2m_min"`
+			PrecipitationProb []float64 `json:"precipitation_probability_max"`
+		} `json:"daily"`
+	}
+	if err := t.getJSON(t.forecastURL+"?"+params.Encode(), &data); err != nil {
+		return "", fmt.Errorf("error fetching forecast: %w", err)
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Weather for %s\n", place.displayName()))
+	result.WriteString(fmt.Sprintf("Now: %s, %.1f%s (feels like %.1f%s), humidity %.0f%%, wind %.0f %s\n",
+		weatherDescription(data.Current.WeatherCode),
+		data.Current.Temperature, tempUnit,
+		data.Current.ApparentTemperature, tempUnit,
+		data.Current.Humidity,
+		data.Current.WindSpeed, windUnit))
+
+	if len(data.Daily.Time) > 0 {
+		result.WriteString("\nForecast:\n")
+	}
+	for i, day := range data.Daily.Time {
+		if i >= len(data.Daily.WeatherCode) || i >= len(data.Daily.TemperatureMax) || i >= len(data.Daily.TemperatureMin) {
+			break
+		}
+		line := fmt.Sprintf("- %s: %s, %.0f%s / %.0f%s", day, weatherDescription(data.Daily.WeatherCode[i]),
+			data.Daily.TemperatureMin[i], tempUnit, data.Daily.TemperatureMax[i], tempUnit)
+		if i < len(data.Daily.PrecipitationProb) {
+			line += fmt.Sprintf(", %.0f%% chance of precipitation", data.Daily.PrecipitationProb[i])
+		}
+		result.WriteString(line + "\n")
+	}
+
+	return result.String(), nil
+}
+
+// getJSON performs a GET request and decodes the JSON response into out
+func (t *WeatherTool) getJSON(requestURL string, out interface{}) error {
+	resp, err := t.client.Get(requestURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// displayName formats a place as "Name, Region, Country"
+func (g *geoLocation) displayName() string {
+	parts := []string{g.Name}
+	if g.Admin1 != "" && g.Admin1 != g.Name {
+		parts = append(parts, g.Admin1)
+	}
+	if g.Country != "" {
+		parts = append(parts, g.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseCoordinates parses a "lat,lon" string
+func parseCoordinates(s string) (float64, float64, bool) {
+	latStr, lonStr, found := strings.Cut(s, ",")
+	if !found {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// weatherDescription maps a WMO weather interpretation code to text
+func weatherDescription(code int) string {
+	switch code {
+	case 0:
+		return "clear sky"
+	case 1:
+		return "mainly clear"
+	case 2:
+		return "partly cloudy"
+	case 3:
+		return "overcast"
+	case 45, 48:
+		return "fog"
+	case 51, 53, 55:
+		return "drizzle"
+	case 56, 57:
+		return "freezing drizzle"
+	case 61, 63, 65:
+		return "rain"
+	case 66, 67:
+		return "freezing rain"
+	case 71, 73, 75:
+		return "snow"
+	case 77:
+		return "snow grains"
+	case 80, 81, 82:
+		return "rain showers"
+	case 85, 86:
+		return "snow showers"
+	case 95:
+		return "thunderstorm"
+	case 96, 99:
+		return "thunderstorm with hail"
+	default:
+		return fmt.Sprintf("weather code %d", code)
+	}
+}
@@ -25,6 +25,17 @@ func (t *WebFetchTool) Description() string {
 	return "Fetch content from a web page"
 }
 
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *WebFetchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"url": map[string]interface{}{"type": "string", "description": "URL of the page, http or https"},
+		},
+		"required": []string{"url"},
+	}
+}
+
 // Call executes the tool with the given arguments
 func (t *WebFetchTool) Call(args map[string]interface{}) (string, error) {
 	urlStr, ok := args["url"].(string)
@@ -36,6 +36,18 @@ func (t *WebSearchTool) Description() string {
 	return "Search the web using the Brave Search API. Returns titles, URLs, and snippets."
 }
 
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *WebSearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{"type": "string", "description": "Search query"},
+			"count": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 10, "description": fmt.Sprintf("Number of results (default %d)", t.maxResults)},
+		},
+		"required": []string{"query"},
+	}
+}
+
 // Call executes the tool with the given arguments
 func (t *WebSearchTool) Call(args map[string]interface{}) (string, error) {
 	query, ok := args["query"].(string)
@@ -39,6 +39,19 @@ func (t *AdvancedWebSearchTool) Description() string {
 	return "Advanced search the web using the Brave Search API with optional summarization. Returns titles, URLs, and summaries/snippets."
 }
 
+// Parameters returns the JSON Schema of the tool's arguments
+func (t *AdvancedWebSearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query":     map[string]interface{}{"type": "string", "description": "Search query"},
+			"count":     map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 10, "description": fmt.Sprintf("Number of results (default %d)", t.maxResults)},
+			"summarize": map[string]interface{}{"type": "boolean", "description": "Summarize the results instead of listing snippets"},
+		},
+		"required": []string{"query"},
+	}
+}
+
 // Call executes the tool with the given arguments
 func (t *AdvancedWebSearchTool) Call(args map[string]interface{}) (string, error) {
 	query, ok := args["query"].(string)
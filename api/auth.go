@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"nanotalon/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// Token scopes
+const (
+	ScopeChat  = "chat"  // Run turns and follow them
+	ScopeRead  = "read"  // View sessions, memory, jobs, subagents, channels and status
+	ScopeAdmin = "admin" // Everything, such as clearing and deleting sessions
+)
+
+// token is an API token and the scopes it grants
+type token struct {
+	name   string
+	secret []byte
+	scopes map[string]bool
+}
+
+// allows reports whether the token grants scope
+func (t token) allows(scope string) bool {
+	return t.scopes[ScopeAdmin] || t.scopes[scope]
+}
+
+// checkSession reports an error unless the token may run turns in the session. Sessions
+// of other channels, such as telegram:42, are only open to admin tokens.
+func (t token) checkSession(sessionKey string) error {
+	if strings.HasPrefix(sessionKey, "api:") || t.allows(ScopeAdmin) {
+		return nil
+	}
+	return fmt.Errorf("only admin tokens may use the session %s of another channel", sessionKey)
+}
+
+// tokenKey is the request context key of the token a request carries
+type tokenKey struct{}
+
+// requestToken returns the token of a request to an endpoint registered with handle
+func requestToken(r *http.Request) token {
+	t, _ := r.Context().Value(tokenKey{}).(token)
+	return t
+}
+
+// apiTokens returns the configured tokens: the full-access token, then the scoped ones.
+// Tokens without a secret are skipped and unknown scopes ignored, with a warning.
+func apiTokens(cfg config.APIConfig) []token {
+	var tokens []token
+	if cfg.Token != "" {
+		tokens = append(tokens, token{name: "token", secret: []byte(cfg.Token), scopes: map[string]bool{ScopeAdmin: true}})
+	}
+	for i, scoped := range cfg.Tokens {
+		name := scoped.Name
+		if name == "" {
+			name = "tokens[" + strconv.Itoa(i) + "]"
+		}
+		if scoped.Token == "" {
+			slog.Warn("Skipping API token: it has no token", "name", name)
+			continue
+		}
+		t := token{name: name, secret: []byte(scoped.Token), scopes: make(map[string]bool)}
+		for _, scope := range scoped.Scopes {
+			switch scope = strings.ToLower(strings.TrimSpace(scope)); scope {
+			case ScopeChat, ScopeRead, ScopeAdmin:
+				t.scopes[scope] = true
+			default:
+				slog.Warn("Ignoring unknown scope of API token", "scope", scope, "name", name)
+			}
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// authenticate returns the token the request carries, if it is one of the API's. Browsers
+// can't set headers on WebSocket connections, which may pass it as ?token instead.
+func (s *Server) authenticate(r *http.Request) (token, bool) {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && websocket.IsWebSocketUpgrade(r) {
+		bearer, ok = r.URL.Query().Get("token"), r.URL.Query().Has("token")
+	}
+	if !ok {
+		return token{}, false
+	}
+	bearer = strings.TrimSpace(bearer)
+
+	// Compare against every token so the time taken doesn't reveal which one matched
+	var found token
+	matched := false
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(bearer), t.secret) == 1 {
+			found, matched = t, true
+		}
+	}
+	return found, matched
+}
+
+// handle registers an API endpoint for tokens granting scope
+func (s *Server) handle(pattern, scope string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		t, ok := s.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="nanotalon"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		if !t.allows(scope) {
+			slog.WarnContext(r.Context(), "API token refused: it lacks the scope",
+				"name", t.name, "client", r.RemoteAddr, "method", r.Method, "path", r.URL.Path, "scope", scope)
+			writeError(w, http.StatusForbidden, "the token doesn't have the "+scope+" scope")
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, t)))
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package api
+
+import "errors"
+
+// freeDiskSpace isn't supported on this platform
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
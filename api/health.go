@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	minFreeDisk      = 100 << 20        // Below this much free space in the workspace, the gateway isn't ready
+	providerCheckTTL = 30 * time.Second // How long a provider check is reused, so frequent probes don't hammer the API
+	providerTimeout  = 5 * time.Second  // How long a provider check may take
+)
+
+// Check statuses
+const (
+	checkOK      = "ok"
+	checkFailing = "failing"
+	checkSkipped = "skipped" // There's nothing to check
+)
+
+// providerPinger is implemented by agents that can check their provider is reachable
+type providerPinger interface {
+	PingProvider(ctx context.Context) error
+}
+
+// Check is the result of one readiness check
+type Check struct {
+	Status string      `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+	Info   interface{} `json:"info,omitempty"`
+}
+
+// Readiness is the gateway's readiness: whether it can serve chats, and why not
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks map[string]Check `json:"checks"` // provider, channels, cron and disk
+}
+
+// Failing returns the names of the failing checks
+func (r Readiness) Failing() []string {
+	var failing []string
+	for _, name := range []string{"provider", "channels", "cron", "disk"} {
+		if r.Checks[name].Status == checkFailing {
+			failing = append(failing, name)
+		}
+	}
+	return failing
+}
+
+// providerHealth caches the last provider check
+type providerHealth struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// handleHealthz reports the gateway is alive; it answers as long as the process serves HTTP
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports the gateway's readiness checks, with 503 while any fails
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	readiness := s.Readiness(r.Context())
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, readiness)
+}
+
+// statusResponse is the reply to GET /v1/status
+type statusResponse struct {
+	Model     string    `json:"model,omitempty"`
+	Workspace string    `json:"workspace,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Readiness Readiness `json:"readiness"`
+}
+
+// handleStatus shows what the gateway runs and its readiness checks
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, statusResponse{
+		Model:     s.services.Model,
+		Workspace: s.services.Workspace,
+		StartedAt: s.started,
+		Readiness: s.Readiness(r.Context()),
+	})
+}
+
+// Readiness runs the readiness checks: the provider is reachable, the enabled channels are
+// running, the scheduler is started and the workspace has disk space left
+func (s *Server) Readiness(ctx context.Context) Readiness {
+	readiness := Readiness{Checks: map[string]Check{
+		"provider": s.checkProvider(ctx),
+		"channels": s.checkChannels(),
+		"cron":     s.checkCron(),
+		"disk":     s.checkDisk(),
+	}}
+	readiness.Ready = len(readiness.Failing()) == 0
+	return readiness
+}
+
+// checkProvider pings the agent's provider, reusing a recent result
+func (s *Server) checkProvider(ctx context.Context) Check {
+	pinger, ok := s.services.Agent.(providerPinger)
+	if !ok {
+		return Check{Status: checkSkipped, Detail: "the provider can't be checked"}
+	}
+
+	s.provider.mu.Lock()
+	defer s.provider.mu.Unlock()
+	if s.provider.checkedAt.IsZero() || time.Since(s.provider.checkedAt) > providerCheckTTL {
+		ctx, cancel := context.WithTimeout(ctx, providerTimeout)
+		s.provider.err = pinger.PingProvider(ctx)
+		cancel()
+		s.provider.checkedAt = time.Now()
+	}
+	if s.provider.err != nil {
+		return Check{Status: checkFailing, Detail: s.provider.err.Error()}
+	}
+	return Check{Status: checkOK}
+}
+
+// checkChannels fails while an enabled channel isn't running
+func (s *Server) checkChannels() Check {
+	if s.services.Channels == nil {
+		return Check{Status: checkSkipped, Detail: "channels aren't available"}
+	}
+	statuses := s.services.Channels.Status()
+	if len(statuses) == 0 {
+		return Check{Status: checkSkipped, Detail: "no channels enabled"}
+	}
+	var stopped []string
+	for _, status := range statuses {
+		if !status.Running {
+			stopped = append(stopped, status.Name)
+		}
+	}
+	if len(stopped) > 0 {
+		return Check{Status: checkFailing, Detail: "not running: " + strings.Join(stopped, ", "), Info: statuses}
+	}
+	return Check{Status: checkOK, Info: statuses}
+}
+
+// checkCron fails while the scheduler isn't started
+func (s *Server) checkCron() Check {
+	if s.services.Cron == nil {
+		return Check{Status: checkSkipped, Detail: "the scheduler isn't available"}
+	}
+	status := s.services.Cron.Status()
+	if running, _ := status["running"].(bool); !running {
+		return Check{Status: checkFailing, Detail: "the scheduler isn't running", Info: status}
+	}
+	return Check{Status: checkOK, Info: status}
+}
+
+// checkDisk fails when the workspace is nearly out of space
+func (s *Server) checkDisk() Check {
+	if s.services.Workspace == "" {
+		return Check{Status: checkSkipped, Detail: "the workspace isn't available"}
+	}
+	free, err := freeDiskSpace(s.services.Workspace)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return Check{Status: checkSkipped, Detail: "disk space can't be checked on this platform"}
+	}
+	if err != nil {
+		return Check{Status: checkFailing, Detail: err.Error()}
+	}
+	info := map[string]uint64{"free_bytes": free}
+	if free < minFreeDisk {
+		return Check{Status: checkFailing, Detail: fmt.Sprintf("only %d MB free in the workspace", free>>20), Info: info}
+	}
+	return Check{Status: checkOK, Info: info}
+}
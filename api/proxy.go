@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// WithBasePath serves handler under prefix, such as /nanotalon when a reverse proxy forwards
+// that path unchanged; requests outside it get a 404. An empty or "/" prefix serves handler
+// as is.
+func WithBasePath(prefix string, handler http.Handler) http.Handler {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		return handler
+	}
+	stripped := http.StripPrefix(prefix, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == prefix:
+			http.Redirect(w, r, prefix+"/", http.StatusFound)
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			stripped.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// TrustProxies takes the client's address from X-Forwarded-For, or X-Real-IP, on requests
+// from the given proxies (IPs or CIDRs), so logs and handlers see the client rather than
+// the proxy. Headers from other peers are ignored, since anyone can set them.
+func TrustProxies(proxies []string, handler http.Handler) (http.Handler, error) {
+	var trusted []netip.Prefix
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			trusted = append(trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: want an IP or CIDR", proxy)
+		}
+		trusted = append(trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	if len(trusted) == 0 {
+		return handler, nil
+	}
+
+	isTrusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		for _, prefix := range trusted {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err == nil && isTrusted(peer.Addr()) {
+			if client, ok := forwardedClient(r, isTrusted); ok {
+				r2 := r.Clone(r.Context())
+				r2.RemoteAddr = net.JoinHostPort(client.String(), "0")
+				r = r2
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}), nil
+}
+
+// forwardedClient returns the client a trusted proxy forwarded the request for. Proxies
+// append to X-Forwarded-For, so it is read from the right, skipping further trusted proxies;
+// the entries left of the first untrusted one could be forged.
+func forwardedClient(r *http.Request, isTrusted func(netip.Addr) bool) (netip.Addr, bool) {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !isTrusted(client) {
+			return client, true
+		}
+	}
+	if client.IsValid() {
+		return client, true // Every hop was a trusted proxy; the leftmost is the closest to a client
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
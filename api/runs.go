@@ -0,0 +1,288 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"nanotalon/agent"
+
+	"github.com/google/uuid"
+)
+
+const (
+	runRetention      = 10 * time.Minute // How long a finished run's events can still be streamed
+	keepaliveInterval = 15 * time.Second // Comments sent on an idle stream so proxies keep it open
+)
+
+// Run statuses
+const (
+	runRunning  = "running"
+	runFinished = "finished"
+	runFailed   = "failed"
+)
+
+// runIDPattern is what a client-chosen run ID may look like
+var runIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// run is a turn started through the API, with the agent events of its session while it
+// runs. Turns in a session run one at a time, so these are the run's own events unless
+// another turn in the same session was still going when it started.
+type run struct {
+	ID       string `json:"id"`
+	Session  string `json:"session"`
+	Status   string `json:"status"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	events     []agent.Event
+	finishedAt time.Time
+	changed    chan struct{} // Closed, and replaced, whenever the run gets an event or finishes
+}
+
+// runDone is the last event of a run's stream
+type runDone struct {
+	Status   string `json:"status"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// runs keeps the API's runs until a while after they finish
+type runs struct {
+	mu   sync.Mutex
+	runs map[string]*run
+}
+
+// start runs message in the session as run id, in the background. It fails if a run
+// with the ID is still kept.
+func (rs *runs) start(a Agent, id, sessionKey, message string) (*run, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	// Forget runs that finished a while ago
+	for runID, r := range rs.runs {
+		if r.Status != runRunning && time.Since(r.finishedAt) > runRetention {
+			delete(rs.runs, runID)
+		}
+	}
+	if _, exists := rs.runs[id]; exists {
+		return nil, fmt.Errorf("run %s already exists", id)
+	}
+
+	r := &run{ID: id, Session: sessionKey, Status: runRunning, changed: make(chan struct{})}
+	rs.runs[id] = r
+
+	// Subscribe before the turn starts so none of its events are missed
+	events := a.Events()
+	done := make(chan runDone, 1)
+	go func() {
+		response, err := a.ProcessDirect(message, sessionKey)
+		if err != nil {
+			done <- runDone{Status: runFailed, Error: err.Error()}
+			return
+		}
+		done <- runDone{Status: runFinished, Response: response}
+	}()
+	go func() {
+		defer a.CloseEvents(events)
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					events = nil // The agent stopped; wait for the turn to return
+					continue
+				}
+				rs.addEvent(r, event)
+			case result := <-done:
+				// Events are published before the turn returns; take the ones still queued
+			drain:
+				for events != nil {
+					select {
+					case event, ok := <-events:
+						if !ok {
+							break drain
+						}
+						rs.addEvent(r, event)
+					default:
+						break drain
+					}
+				}
+				rs.finish(r, result)
+				return
+			}
+		}
+	}()
+	return r, nil
+}
+
+// addEvent records an event of the run's session
+func (rs *runs) addEvent(r *run, event agent.Event) {
+	if event.SessionKey != r.Session {
+		return
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r.events = append(r.events, event)
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// finish records the outcome of a run
+func (rs *runs) finish(r *run, result runDone) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r.Status, r.Response, r.Error = result.Status, result.Response, result.Error
+	r.finishedAt = time.Now()
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// get returns a copy of a run's status
+func (rs *runs) get(id string) (run, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r, ok := rs.runs[id]
+	if !ok {
+		return run{}, false
+	}
+	return run{ID: r.ID, Session: r.Session, Status: r.Status, Response: r.Response, Error: r.Error}, true
+}
+
+// since returns the run's events from index on, whether it has finished and a channel
+// closed at its next change
+func (rs *runs) since(r *run, index int) ([]agent.Event, *runDone, <-chan struct{}) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	events := append([]agent.Event(nil), r.events[index:]...)
+	if r.Status == runRunning {
+		return events, nil, r.changed
+	}
+	return events, &runDone{Status: r.Status, Response: r.Response, Error: r.Error}, r.changed
+}
+
+// lookup returns the run with the ID
+func (rs *runs) lookup(id string) (*run, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r, ok := rs.runs[id]
+	return r, ok
+}
+
+// handleStartRun starts a run in the background; its events are streamed from
+// /v1/runs/{id}/events
+func (s *Server) handleStartRun(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeChatRequest(w, r)
+	if !ok {
+		return
+	}
+	sessionKey, ok := requestSessionKey(w, r, req.Session)
+	if !ok {
+		return
+	}
+	started, err := s.runs.start(s.services.Agent, uuid.NewString(), sessionKey, req.Message)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"id":      started.ID,
+		"session": started.Session,
+		"events":  "/v1/runs/" + started.ID + "/events",
+	})
+}
+
+// handleRun shows a run's status and, once it's done, its response
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	found, ok := s.runs.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "run "+r.PathValue("id")+" not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, found)
+}
+
+// handleRunEvents streams a run's events as server-sent events. A POST starts the run
+// under the ID first, with the same body as /v1/chat, so a client can run a turn and
+// follow it in one request.
+func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var target *run
+	if r.Method == http.MethodPost {
+		if !runIDPattern.MatchString(id) {
+			writeError(w, http.StatusBadRequest, "run ids are up to 64 letters, digits, - and _")
+			return
+		}
+		req, ok := decodeChatRequest(w, r)
+		if !ok {
+			return
+		}
+		sessionKey, ok := requestSessionKey(w, r, req.Session)
+		if !ok {
+			return
+		}
+		started, err := s.runs.start(s.services.Agent, id, sessionKey, req.Message)
+		if err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		target = started
+	} else {
+		found, ok := s.runs.lookup(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "run "+id+" not found")
+			return
+		}
+		target = found
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming isn't supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+	next := 0
+	for {
+		events, done, changed := s.runs.since(target, next)
+		for _, event := range events {
+			writeEvent(w, event.Type, event)
+		}
+		next += len(events)
+		if done != nil {
+			writeEvent(w, "done", done)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one server-sent event with value as its JSON data
+func writeEvent(w http.ResponseWriter, name string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		slog.Warn("Error encoding API event", "error", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
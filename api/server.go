@@ -0,0 +1,391 @@
+// Package api serves the gateway's HTTP API: chatting with the agent over HTTP or a
+// WebSocket, following its runs live and inspecting its sessions, memory, scheduled jobs,
+// subagents and channels, next to the web UI built on it and the channels' platform webhooks.
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"nanotalon/agent"
+	"nanotalon/channels"
+	"nanotalon/config"
+	"nanotalon/cron"
+	"nanotalon/logging"
+	"nanotalon/session"
+
+	"github.com/google/uuid"
+)
+
+// maxRequestBody caps the size of a request body
+const maxRequestBody = 1 << 20
+
+// Agent processes chat messages for the API
+type Agent interface {
+	// ProcessDirect runs a turn for message in the session and returns the reply
+	ProcessDirect(message, sessionID string) (string, error)
+	// Events subscribes to the events of every turn
+	Events() <-chan agent.Event
+	// CloseEvents ends a subscription returned by Events
+	CloseEvents(events <-chan agent.Event)
+}
+
+// Services are what the API serves; nil ones leave their endpoints unavailable
+type Services struct {
+	Workspace string // Where memory and subagent tasks are read from
+	Model     string // The default model, shown in the status
+	Agent     Agent
+	Sessions  *session.SessionManager
+	Cron      *cron.CronService
+	Channels  *channels.Manager
+}
+
+// Server is the gateway's HTTP handler
+type Server struct {
+	tokens   []token
+	services Services
+	started  time.Time
+	mux      *http.ServeMux
+	runs     runs
+	provider providerHealth
+}
+
+// NewServer creates the HTTP handler. Requests to /v1/ must carry one of the configured
+// tokens as a bearer token, with the scope the endpoint needs; without tokens the API is
+// off and only the webhooks and health checks are served.
+func NewServer(cfg config.APIConfig, services Services) *Server {
+	s := &Server{
+		tokens:   apiTokens(cfg),
+		services: services,
+		started:  time.Now(),
+		mux:      http.NewServeMux(),
+		runs:     runs{runs: make(map[string]*run)},
+	}
+
+	// Platforms authenticate their webhook requests in their own ways
+	if services.Channels != nil {
+		s.mux.Handle("/webhooks/", services.Channels)
+	}
+
+	// Probes from systemd or an orchestrator carry no token
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+
+	if len(s.tokens) == 0 {
+		slog.Info("HTTP API disabled: set gateway.api.token or gateway.api.tokens to enable it")
+		return s
+	}
+	s.handle("POST /v1/chat", ScopeChat, s.needsAgent(s.handleChat))
+	s.handle("POST /v1/runs", ScopeChat, s.needsAgent(s.handleStartRun))
+	s.handle("GET /v1/runs/{id}", ScopeChat, s.handleRun)
+	s.handle("GET /v1/runs/{id}/events", ScopeChat, s.handleRunEvents)
+	s.handle("POST /v1/runs/{id}/events", ScopeChat, s.needsAgent(s.handleRunEvents))
+	s.handle("GET /v1/ws", ScopeChat, s.needsAgent(s.handleWebSocket))
+	s.handle("GET /v1/status", ScopeRead, s.handleStatus)
+	s.handle("GET /v1/sessions", ScopeRead, s.handleSessions)
+	s.handle("GET /v1/sessions/{key}", ScopeRead, s.handleSession)
+	s.handle("GET /v1/sessions/{key}/messages", ScopeRead, s.handleSessionMessages)
+	s.handle("POST /v1/sessions/{key}/clear", ScopeAdmin, s.handleClearSession)
+	s.handle("DELETE /v1/sessions/{key}", ScopeAdmin, s.handleDeleteSession)
+	s.handle("GET /v1/memory", ScopeRead, s.needsWorkspace(s.handleMemory))
+	s.handle("GET /v1/subagents", ScopeRead, s.needsWorkspace(s.handleSubagents))
+	s.handle("GET /v1/jobs", ScopeRead, s.handleJobs)
+	s.handle("GET /v1/jobs/{id}", ScopeRead, s.handleJob)
+	s.handle("GET /v1/channels", ScopeRead, s.handleChannels)
+
+	// The web UI asks for the token itself, so its files are public
+	s.mux.Handle("GET /ui/", http.StripPrefix("/ui/", http.FileServerFS(webFiles)))
+	s.mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		// A relative redirect keeps the base path the gateway may be served under
+		w.Header().Set("Location", "ui/")
+		w.WriteHeader(http.StatusFound)
+	})
+	return s
+}
+
+// ServeHTTP routes a request, under the ID in its X-Request-ID header or a new one. The
+// ID is sent back in the response and tags the entries logged for the request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get("X-Request-ID")
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+	w.Header().Set("X-Request-ID", id)
+	s.mux.ServeHTTP(w, r.WithContext(logging.With(r.Context(), logging.RequestKey, id)))
+}
+
+// validRequestID reports whether a client's request ID is safe to log and send back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// needsAgent refuses requests while there's no agent to run turns
+func (s *Server) needsAgent(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.services.Agent == nil {
+			writeError(w, http.StatusServiceUnavailable, "the agent isn't available")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// chatRequest is the body of POST /v1/chat
+type chatRequest struct {
+	Session string `json:"session"` // Defaults to "default"; kept as api:<session> unless it names a channel
+	Message string `json:"message"`
+}
+
+// chatResponse is the reply to POST /v1/chat
+type chatResponse struct {
+	Session  string `json:"session"`
+	Response string `json:"response"`
+}
+
+// decodeChatRequest reads the body of a request to run a turn, replying with the error
+// if it isn't valid
+func decodeChatRequest(w http.ResponseWriter, r *http.Request) (chatRequest, bool) {
+	var req chatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return req, false
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		writeError(w, http.StatusBadRequest, "missing message")
+		return req, false
+	}
+	return req, true
+}
+
+// handleChat runs a turn and replies with the agent's response
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeChatRequest(w, r)
+	if !ok {
+		return
+	}
+
+	sessionKey, ok := requestSessionKey(w, r, req.Session)
+	if !ok {
+		return
+	}
+	response, err := s.services.Agent.ProcessDirect(req.Message, sessionKey)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error running chat turn", logging.SessionKey, sessionKey, "error", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, chatResponse{Session: sessionKey, Response: response})
+}
+
+// requestSessionKey returns the session a request runs turns in, replying 403 if its
+// token may not use it
+func requestSessionKey(w http.ResponseWriter, r *http.Request, session string) (string, bool) {
+	sessionKey := SessionKey(session)
+	if err := requestToken(r).checkSession(sessionKey); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return "", false
+	}
+	return sessionKey, true
+}
+
+// SessionKey returns the session a chat request goes to: api:<session>, unless session
+// already names a channel's chat such as telegram:42, which needs an admin token
+func SessionKey(session string) string {
+	session = strings.TrimSpace(session)
+	if session == "" {
+		session = "default"
+	}
+	if strings.Contains(session, ":") {
+		return session
+	}
+	return "api:" + session
+}
+
+// handleSessions lists the sessions, most recently active first
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if s.services.Sessions == nil {
+		writeError(w, http.StatusServiceUnavailable, "sessions aren't available")
+		return
+	}
+	sessions := s.services.Sessions.ListSessionInfo()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": sessions})
+}
+
+// sessionResponse is the reply to GET /v1/sessions/{key}
+type sessionResponse struct {
+	session.SessionInfo
+	Summary         string            `json:"summary,omitempty"`
+	SummarizedCount int               `json:"summarized_count,omitempty"` // Leading messages the summary covers
+	Messages        []session.Message `json:"messages"`                   // The latest ones
+}
+
+// handleSession shows a session with its summary and latest messages, at most ?limit of
+// them (20 by default, 0 for all)
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if s.services.Sessions == nil {
+		writeError(w, http.StatusServiceUnavailable, "sessions aren't available")
+		return
+	}
+	limit, ok := limitParam(w, r, 20)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	sess, exists := s.services.Sessions.GetSession(key)
+	if !exists {
+		writeError(w, http.StatusNotFound, "session "+key+" not found")
+		return
+	}
+
+	response := sessionResponse{SessionInfo: sess.Info()}
+	if limit == 0 {
+		limit = response.MessageCount
+	}
+	var err error
+	if response.Summary, response.SummarizedCount, err = s.services.Sessions.GetSummary(key); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if response.Messages, err = s.services.Sessions.GetMessageHistory(key, limit); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleClearSession removes a session's messages and summary, keeping its settings
+func (s *Server) handleClearSession(w http.ResponseWriter, r *http.Request) {
+	s.changeSession(w, r, s.services.Sessions.ClearSession)
+}
+
+// handleDeleteSession deletes a session and everything stored for it
+func (s *Server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	s.changeSession(w, r, s.services.Sessions.DeleteSession)
+}
+
+// changeSession applies change to the session named in the path
+func (s *Server) changeSession(w http.ResponseWriter, r *http.Request, change func(key string) error) {
+	if s.services.Sessions == nil {
+		writeError(w, http.StatusServiceUnavailable, "sessions aren't available")
+		return
+	}
+	key := r.PathValue("key")
+	if _, exists := s.services.Sessions.GetSession(key); !exists {
+		writeError(w, http.StatusNotFound, "session "+key+" not found")
+		return
+	}
+	if err := change(key); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"session": key})
+}
+
+// handleSessionMessages lists a session's latest messages, at most ?limit of them (50 by default)
+func (s *Server) handleSessionMessages(w http.ResponseWriter, r *http.Request) {
+	if s.services.Sessions == nil {
+		writeError(w, http.StatusServiceUnavailable, "sessions aren't available")
+		return
+	}
+	limit, ok := limitParam(w, r, 50)
+	if !ok {
+		return
+	}
+	if limit == 0 {
+		writeError(w, http.StatusBadRequest, "limit must be a positive number")
+		return
+	}
+
+	key := r.PathValue("key")
+	messages, err := s.services.Sessions.GetMessageHistory(key, limit)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"session": key, "messages": messages})
+}
+
+// handleJobs lists the scheduled jobs, disabled ones included, with the scheduler's status
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if s.services.Cron == nil {
+		writeError(w, http.StatusServiceUnavailable, "the scheduler isn't available")
+		return
+	}
+	// Copies, since running jobs update their state while the response is written
+	jobs := make([]*cron.CronJob, 0)
+	for _, job := range s.services.Cron.ListJobs(true) {
+		if snapshot := s.services.Cron.GetJob(job.ID); snapshot != nil {
+			jobs = append(jobs, snapshot)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": s.services.Cron.Status(),
+		"jobs":   jobs,
+	})
+}
+
+// handleJob shows one scheduled job, with its recent runs
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if s.services.Cron == nil {
+		writeError(w, http.StatusServiceUnavailable, "the scheduler isn't available")
+		return
+	}
+	job := s.services.Cron.GetJob(r.PathValue("id"))
+	if job == nil {
+		writeError(w, http.StatusNotFound, "job "+r.PathValue("id")+" not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// handleChannels lists the enabled channels and whether they are running
+func (s *Server) handleChannels(w http.ResponseWriter, r *http.Request) {
+	if s.services.Channels == nil {
+		writeError(w, http.StatusServiceUnavailable, "channels aren't available")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"channels": s.services.Channels.Status()})
+}
+
+// limitParam reads the ?limit parameter, replying with the error if it isn't a number
+// from 0 up
+func limitParam(w http.ResponseWriter, r *http.Request, fallback int) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return fallback, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		writeError(w, http.StatusBadRequest, "limit must be a number from 0 up")
+		return 0, false
+	}
+	return limit, true
+}
+
+// writeJSON writes value as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Warn("Error writing API response", "error", err)
+	}
+}
+
+// writeError writes an error as {"error": message}
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,677 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nanotalon/agent"
+	"nanotalon/agent/memory"
+	"nanotalon/agent/subagent"
+	"nanotalon/channels"
+	"nanotalon/config"
+	"nanotalon/cron"
+	"nanotalon/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// echoAgent replies with the message it got, publishing the turn's events, and records
+// the sessions it was asked in
+type echoAgent struct {
+	mu          sync.Mutex
+	sessions    []string
+	subscribers []chan agent.Event
+}
+
+func (a *echoAgent) ProcessDirect(message, sessionID string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sessions = append(a.sessions, sessionID)
+	reply := "echo: " + message
+	for _, event := range []agent.Event{
+		{Type: agent.EventTurnStarted, SessionKey: sessionID, Content: message},
+		{Type: agent.EventTurnStarted, SessionKey: "telegram:42", Content: "another chat"},
+		{Type: agent.EventTokens, SessionKey: sessionID, Content: reply, Tokens: 12},
+		{Type: agent.EventTurnFinished, SessionKey: sessionID, Content: reply},
+	} {
+		for _, ch := range a.subscribers {
+			ch <- event
+		}
+	}
+	return reply, nil
+}
+
+func (a *echoAgent) Events() <-chan agent.Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ch := make(chan agent.Event, 16)
+	a.subscribers = append(a.subscribers, ch)
+	return ch
+}
+
+func (a *echoAgent) CloseEvents(events <-chan agent.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, ch := range a.subscribers {
+		if ch == events {
+			a.subscribers = append(a.subscribers[:i], a.subscribers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+// call makes a request to the server and decodes the response, if it's JSON
+func call(t *testing.T, server http.Handler, method, path, token, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	var decoded map[string]interface{}
+	if rec.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("%s %s returned invalid JSON %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code, decoded
+}
+
+func TestAPI(t *testing.T) {
+	dir := t.TempDir()
+	echo := &echoAgent{}
+	sessions := session.NewSessionManager(dir)
+	if err := sessions.SaveMessage("telegram:42", "user", "hi"); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	cronService, err := cron.NewCronService(filepath.Join(dir, "cron", "jobs.json"))
+	if err != nil {
+		t.Fatalf("NewCronService failed: %v", err)
+	}
+	every := int64(3600000)
+	job, err := cronService.AddJob("digest", cron.CronSchedule{Kind: "every", EveryMS: &every}, "Send the digest", false, "", "", false)
+	if err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	channelManager := channels.NewManager(&config.Config{Channels: config.ChannelsConfig{
+		Telegram: config.TelegramConfig{Enabled: true, Token: "test-token"},
+	}})
+
+	server := NewServer(config.APIConfig{Token: "secret"}, Services{Agent: echo, Sessions: sessions, Cron: cronService, Channels: channelManager})
+
+	// Every endpoint needs the token
+	if code, body := call(t, server, "GET", "/v1/sessions", "", ""); code != http.StatusUnauthorized || body["error"] == nil {
+		t.Errorf("Expected a request without a token to be refused, got %d %v", code, body)
+	}
+	if code, _ := call(t, server, "POST", "/v1/chat", "wrong", `{"message": "hi"}`); code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong token to be refused, got %d", code)
+	}
+
+	code, body := call(t, server, "POST", "/v1/chat", "secret", `{"session": "web", "message": "hello"}`)
+	if code != http.StatusOK || body["session"] != "api:web" || body["response"] != "echo: hello" {
+		t.Errorf("Unexpected chat response %d %v", code, body)
+	}
+	if len(echo.sessions) != 1 || echo.sessions[0] != "api:web" {
+		t.Errorf("Expected the turn to run in api:web, got %v", echo.sessions)
+	}
+	if code, _ := call(t, server, "POST", "/v1/chat", "secret", `{"session": "web"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected a chat without a message to fail, got %d", code)
+	}
+	if code, _ := call(t, server, "GET", "/v1/chat", "secret", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET /v1/chat to be refused, got %d", code)
+	}
+
+	code, body = call(t, server, "GET", "/v1/sessions", "secret", "")
+	list, _ := body["sessions"].([]interface{})
+	if code != http.StatusOK || len(list) != 1 || list[0].(map[string]interface{})["key"] != "telegram:42" {
+		t.Errorf("Unexpected sessions %d %v", code, body)
+	}
+
+	code, body = call(t, server, "GET", "/v1/jobs", "secret", "")
+	jobs, _ := body["jobs"].([]interface{})
+	if code != http.StatusOK || len(jobs) != 1 || jobs[0].(map[string]interface{})["name"] != "digest" {
+		t.Errorf("Unexpected jobs %d %v", code, body)
+	}
+	if code, body := call(t, server, "GET", "/v1/jobs/"+job.ID, "secret", ""); code != http.StatusOK || body["id"] != job.ID {
+		t.Errorf("Unexpected job %d %v", code, body)
+	}
+	if code, _ := call(t, server, "GET", "/v1/jobs/nope", "secret", ""); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown job to be 404, got %d", code)
+	}
+
+	code, body = call(t, server, "GET", "/v1/channels", "secret", "")
+	statuses, _ := body["channels"].([]interface{})
+	if code != http.StatusOK || len(statuses) != 1 || statuses[0].(map[string]interface{})["name"] != "telegram" {
+		t.Errorf("Unexpected channels %d %v", code, body)
+	}
+}
+
+func TestAPIIsOffWithoutToken(t *testing.T) {
+	server := NewServer(config.APIConfig{}, Services{Agent: &echoAgent{}})
+	if code, _ := call(t, server, "POST", "/v1/chat", "", `{"message": "hi"}`); code != http.StatusNotFound {
+		t.Errorf("Expected the API to be off without a token, got %d", code)
+	}
+}
+
+func TestSessionKey(t *testing.T) {
+	for session, want := range map[string]string{"": "api:default", "web": "api:web", "telegram:42": "telegram:42"} {
+		if got := SessionKey(session); got != want {
+			t.Errorf("SessionKey(%q) = %q, want %q", session, got, want)
+		}
+	}
+}
+
+func TestRunEventsStream(t *testing.T) {
+	server := NewServer(config.APIConfig{Token: "secret"}, Services{Agent: &echoAgent{}})
+
+	// A POST starts the run and streams it to the end
+	req := httptest.NewRequest("POST", "/v1/runs/run-1/events", strings.NewReader(`{"session": "web", "message": "hello"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	want := []string{"turn_started", "tokens", "turn_finished", "done"}
+	var names []string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			names = append(names, name)
+		}
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected the events of the run's session then done, got %v in %q", names, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `data: {"status":"finished","response":"echo: hello"}`) {
+		t.Errorf("Expected the response in the done event, got %q", rec.Body.String())
+	}
+
+	// The finished run can be streamed again and looked up, but not started twice
+	req = httptest.NewRequest("GET", "/v1/runs/run-1/events", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "event: turn_finished") || !strings.Contains(rec.Body.String(), "event: done") {
+		t.Errorf("Expected the finished run to be replayed, got %q", rec.Body.String())
+	}
+	if code, body := call(t, server, "GET", "/v1/runs/run-1", "secret", ""); code != http.StatusOK || body["status"] != "finished" || body["response"] != "echo: hello" {
+		t.Errorf("Unexpected run %d %v", code, body)
+	}
+	if code, _ := call(t, server, "POST", "/v1/runs/run-1/events", "secret", `{"message": "again"}`); code != http.StatusConflict {
+		t.Errorf("Expected starting a run twice to conflict, got %d", code)
+	}
+
+	// POST /v1/runs starts one in the background
+	code, body := call(t, server, "POST", "/v1/runs", "secret", `{"message": "later"}`)
+	if code != http.StatusAccepted || body["session"] != "api:default" || !strings.HasSuffix(body["events"].(string), "/events") {
+		t.Errorf("Unexpected run %d %v", code, body)
+	}
+	if code, _ := call(t, server, "GET", "/v1/runs/nope/events", "secret", ""); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown run to be 404, got %d", code)
+	}
+}
+
+func TestWorkspaceEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	sessions := session.NewSessionManager(dir)
+	if err := sessions.SaveMessage("api:web", "user", "hi"); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	if err := sessions.SaveMessage("api:web", "assistant", "hello"); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	store := memory.NewMemoryStore(dir)
+	if err := store.WriteLongTerm("Likes tea"); err != nil {
+		t.Fatalf("WriteLongTerm failed: %v", err)
+	}
+	if err := store.AppendHistory("Talked about tea"); err != nil {
+		t.Fatalf("AppendHistory failed: %v", err)
+	}
+	tasks := `{"tasks": [], "history": [{"id": "3f2a9c1e-0000-4000-8000-000000000000", "label": "digest", "status": "completed"}]}`
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(subagent.DefaultStorePath(dir), []byte(tasks), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	server := NewServer(config.APIConfig{Token: "secret"}, Services{Workspace: dir, Agent: &echoAgent{}, Sessions: sessions})
+
+	code, body := call(t, server, "GET", "/v1/sessions/api:web/messages?limit=1", "secret", "")
+	messages, _ := body["messages"].([]interface{})
+	if code != http.StatusOK || len(messages) != 1 || messages[0].(map[string]interface{})["content"] != "hello" {
+		t.Errorf("Expected the latest message, got %d %v", code, body)
+	}
+	if code, _ := call(t, server, "GET", "/v1/sessions/api:nope/messages", "secret", ""); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown session to be 404, got %d", code)
+	}
+
+	code, body = call(t, server, "GET", "/v1/memory", "secret", "")
+	history, _ := body["history"].([]interface{})
+	if code != http.StatusOK || body["scope"] != "global" || body["long_term"] != "Likes tea" || len(history) != 1 {
+		t.Errorf("Unexpected memory %d %v", code, body)
+	}
+	if code, _ := call(t, server, "GET", "/v1/memory?scope=nope", "secret", ""); code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid scope to be refused, got %d", code)
+	}
+
+	code, body = call(t, server, "GET", "/v1/subagents", "secret", "")
+	list, _ := body["tasks"].([]interface{})
+	if code != http.StatusOK || len(list) != 1 || list[0].(map[string]interface{})["label"] != "digest" {
+		t.Errorf("Unexpected subagents %d %v", code, body)
+	}
+}
+
+func TestWebUI(t *testing.T) {
+	server := NewServer(config.APIConfig{Token: "secret"}, Services{})
+
+	// The page itself needs no token; it asks for one
+	req := httptest.NewRequest("GET", "/ui/", nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<script src="app.js">`) {
+		t.Errorf("Expected the UI page, got %d %q", rec.Code, rec.Body.String())
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "ui/" {
+		t.Errorf("Expected / to redirect to the UI, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// It's off along with the API
+	req = httptest.NewRequest("GET", "/ui/", nil)
+	rec = httptest.NewRecorder()
+	NewServer(config.APIConfig{}, Services{}).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected no UI without a token, got %d", rec.Code)
+	}
+}
+
+// pingAgent is an echoAgent whose provider check returns err
+type pingAgent struct {
+	echoAgent
+	err error
+}
+
+func (a *pingAgent) PingProvider(ctx context.Context) error {
+	return a.err
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	dir := t.TempDir()
+	cronService, err := cron.NewCronService(filepath.Join(dir, "cron", "jobs.json"))
+	if err != nil {
+		t.Fatalf("NewCronService failed: %v", err)
+	}
+	pinger := &pingAgent{err: errors.New("connection refused")}
+	server := NewServer(config.APIConfig{}, Services{Workspace: dir, Agent: pinger, Cron: cronService})
+
+	// Probes need no token, even with the API off
+	if code, body := call(t, server, "GET", "/healthz", "", ""); code != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("Unexpected health %d %v", code, body)
+	}
+
+	code, body := call(t, server, "GET", "/readyz", "", "")
+	checks, _ := body["checks"].(map[string]interface{})
+	status := func(name string) interface{} {
+		check, _ := checks[name].(map[string]interface{})
+		return check["status"]
+	}
+	if code != http.StatusServiceUnavailable || body["ready"] != false || status("provider") != "failing" || status("cron") != "failing" {
+		t.Errorf("Expected the unreachable provider and stopped scheduler to fail, got %d %v", code, body)
+	}
+	if status("disk") != "ok" || status("channels") != "skipped" {
+		t.Errorf("Unexpected disk and channel checks %v", checks)
+	}
+
+	// The provider check is reused for a while
+	pinger.err = nil
+	if failing := server.Readiness(context.Background()).Failing(); strings.Join(failing, ",") != "provider,cron" {
+		t.Errorf("Expected the cached provider check and the scheduler to fail, got %v", failing)
+	}
+	server.provider.checkedAt = time.Time{}
+	cronService.Start()
+	defer cronService.Stop()
+	if code, body := call(t, server, "GET", "/readyz", "", ""); code != http.StatusOK || body["ready"] != true {
+		t.Errorf("Expected the gateway to be ready, got %d %v", code, body)
+	}
+}
+
+func TestScopedTokens(t *testing.T) {
+	sessions := session.NewSessionManager(t.TempDir())
+	for _, key := range []string{"telegram:42", "slack:C1"} {
+		if err := sessions.SaveMessage(key, "user", "hi"); err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+	}
+	server := NewServer(config.APIConfig{Tokens: []config.APIToken{
+		{Name: "dashboard", Token: "reader", Scopes: []string{"read"}},
+		{Name: "bot", Token: "chatter", Scopes: []string{"chat"}},
+		{Name: "ops", Token: "admin", Scopes: []string{"admin"}},
+		{Name: "empty", Scopes: []string{"admin"}},
+	}}, Services{Agent: &echoAgent{}, Sessions: sessions, Model: "openai/gpt-4o"})
+
+	if code, _ := call(t, server, "GET", "/v1/sessions", "reader", ""); code != http.StatusOK {
+		t.Errorf("Expected the read token to list sessions, got %d", code)
+	}
+	if code, body := call(t, server, "POST", "/v1/chat", "reader", `{"message": "hi"}`); code != http.StatusForbidden || body["error"] == nil {
+		t.Errorf("Expected the read token to be refused a chat, got %d %v", code, body)
+	}
+	if code, _ := call(t, server, "POST", "/v1/chat", "chatter", `{"message": "hi"}`); code != http.StatusOK {
+		t.Errorf("Expected the chat token to chat, got %d", code)
+	}
+	// Only admin tokens may run turns in other channels' sessions
+	if code, body := call(t, server, "POST", "/v1/chat", "chatter", `{"session": "telegram:42", "message": "hi"}`); code != http.StatusForbidden || body["error"] == nil {
+		t.Errorf("Expected the chat token to be refused a telegram session, got %d %v", code, body)
+	}
+	if code, _ := call(t, server, "POST", "/v1/runs", "chatter", `{"session": "slack:C1", "message": "hi"}`); code != http.StatusForbidden {
+		t.Errorf("Expected the chat token to be refused a run in a slack session, got %d", code)
+	}
+	if code, body := call(t, server, "POST", "/v1/chat", "admin", `{"session": "telegram:42", "message": "hi"}`); code != http.StatusOK || body["session"] != "telegram:42" {
+		t.Errorf("Expected the admin token to chat in a telegram session, got %d %v", code, body)
+	}
+	if code, _ := call(t, server, "GET", "/v1/sessions", "chatter", ""); code != http.StatusForbidden {
+		t.Errorf("Expected the chat token to be refused the sessions, got %d", code)
+	}
+	if code, _ := call(t, server, "DELETE", "/v1/sessions/telegram:42", "reader", ""); code != http.StatusForbidden {
+		t.Errorf("Expected the read token to be refused a delete, got %d", code)
+	}
+	if code, _ := call(t, server, "GET", "/v1/sessions", "", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected a request without a token to be refused, got %d", code)
+	}
+
+	// Admin tokens can do everything
+	code, body := call(t, server, "GET", "/v1/sessions/telegram:42?limit=0", "admin", "")
+	messages, _ := body["messages"].([]interface{})
+	if code != http.StatusOK || body["key"] != "telegram:42" || body["message_count"] != float64(1) || len(messages) != 1 {
+		t.Errorf("Unexpected session %d %v", code, body)
+	}
+	if code, _ := call(t, server, "POST", "/v1/sessions/telegram:42/clear", "admin", ""); code != http.StatusOK {
+		t.Errorf("Expected the admin token to clear a session, got %d", code)
+	}
+	if history, _ := sessions.GetMessageHistory("telegram:42", 10); len(history) != 0 {
+		t.Errorf("Expected the session to be cleared, got %v", history)
+	}
+	if code, _ := call(t, server, "DELETE", "/v1/sessions/slack:C1", "admin", ""); code != http.StatusOK {
+		t.Errorf("Expected the admin token to delete a session, got %d", code)
+	}
+	if _, exists := sessions.GetSession("slack:C1"); exists {
+		t.Error("Expected the session to be deleted")
+	}
+	if code, _ := call(t, server, "DELETE", "/v1/sessions/slack:C1", "admin", ""); code != http.StatusNotFound {
+		t.Errorf("Expected deleting an unknown session to be 404, got %d", code)
+	}
+
+	code, body = call(t, server, "GET", "/v1/status", "admin", "")
+	if code != http.StatusOK || body["model"] != "openai/gpt-4o" || body["readiness"] == nil {
+		t.Errorf("Unexpected status %d %v", code, body)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	ts := httptest.NewServer(NewServer(config.APIConfig{Token: "secret"}, Services{Agent: &echoAgent{}}))
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/ws"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected a connection without a token to be refused, got %v", err)
+	}
+
+	// Browsers pass the token in the URL
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?token=secret&session=phone", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var frame wsOutbound
+	if err := conn.ReadJSON(&frame); err != nil || frame.Type != "bound" || frame.Session != "api:phone" {
+		t.Fatalf("Expected the connection to be bound to api:phone, got %+v %v", frame, err)
+	}
+
+	if err := conn.WriteJSON(wsInbound{Type: "message", ID: "m1", Content: "hello"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var events []string
+	for {
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("ReadJSON failed: %v", err)
+		}
+		if frame.Type == "event" {
+			if frame.Session != "api:phone" {
+				t.Errorf("Expected only the bound session's events, got one of %s", frame.Session)
+			}
+			events = append(events, frame.Event.Type)
+			continue
+		}
+		if frame.Type != "response" || frame.ID != "m1" || frame.Content != "echo: hello" {
+			t.Fatalf("Unexpected frame %+v", frame)
+		}
+		break
+	}
+	// The response may overtake the last events
+	if len(events) < 2 || events[0] != "turn_started" {
+		t.Errorf("Expected the turn's events before the response, got %v", events)
+	}
+
+	// Rebinding moves later messages to another session
+	if err := conn.WriteJSON(wsInbound{Type: "bind", Session: "telegram:42"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	for {
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("ReadJSON failed: %v", err)
+		}
+		if frame.Type == "bound" {
+			break
+		}
+	}
+	if frame.Session != "telegram:42" {
+		t.Errorf("Expected the connection to be bound to telegram:42, got %+v", frame)
+	}
+	if err := conn.WriteJSON(wsInbound{Type: "shout"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	for {
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("ReadJSON failed: %v", err)
+		}
+		if frame.Type == "error" {
+			break
+		}
+	}
+	if !strings.Contains(frame.Error, "unknown frame type") {
+		t.Errorf("Expected an unknown frame to be refused, got %+v", frame)
+	}
+}
+
+func TestWebSocketSessionScope(t *testing.T) {
+	ts := httptest.NewServer(NewServer(config.APIConfig{Tokens: []config.APIToken{
+		{Name: "bot", Token: "chatter", Scopes: []string{"chat"}},
+	}}, Services{Agent: &echoAgent{}}))
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/ws?token=chatter"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+"&session=telegram:42", nil); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected a chat token to be refused a telegram session, got %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"&session=phone", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var frame wsOutbound
+	if err := conn.ReadJSON(&frame); err != nil || frame.Type != "bound" {
+		t.Fatalf("Expected the connection to be bound, got %+v %v", frame, err)
+	}
+	if err := conn.WriteJSON(wsInbound{Type: "bind", ID: "b1", Session: "telegram:42"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	if err := conn.ReadJSON(&frame); err != nil || frame.Type != "error" || frame.ID != "b1" || !strings.Contains(frame.Error, "admin") {
+		t.Fatalf("Expected the bind to be refused, got %+v %v", frame, err)
+	}
+	if err := conn.WriteJSON(wsInbound{Type: "ping"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	if err := conn.ReadJSON(&frame); err != nil || frame.Type != "pong" {
+		t.Fatalf("Expected the connection to stay open, got %+v %v", frame, err)
+	}
+}
+
+func TestBasePathAndTrustedProxies(t *testing.T) {
+	var remoteAddr string
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+		NewServer(config.APIConfig{Token: "secret"}, Services{}).ServeHTTP(w, r)
+	})
+	handler, err := TrustProxies([]string{"10.0.0.0/8", "192.168.1.5"}, WithBasePath("/nanotalon/", inner))
+	if err != nil {
+		t.Fatalf("TrustProxies failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"/nanotalon/healthz", http.StatusOK, ""},
+		{"/nanotalon", http.StatusFound, "/nanotalon/"},
+		{"/nanotalon/", http.StatusFound, "ui/"},
+		{"/healthz", http.StatusNotFound, ""},
+		{"/nanotalonx/healthz", http.StatusNotFound, ""},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status || rec.Header().Get("Location") != tc.location {
+			t.Errorf("GET %s: expected %d %q, got %d %q", tc.path, tc.status, tc.location, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	for _, tc := range []struct {
+		peer, forwardedFor, realIP, want string
+	}{
+		{"10.1.2.3:4000", "203.0.113.7", "", "203.0.113.7:0"},
+		{"10.1.2.3:4000", "198.51.100.1, 203.0.113.7, 10.9.9.9", "", "203.0.113.7:0"}, // The leftmost entry could be forged
+		{"192.168.1.5:4000", "", "203.0.113.7", "203.0.113.7:0"},
+		{"192.168.1.6:4000", "203.0.113.7", "", "192.168.1.6:4000"}, // Not a trusted proxy
+		{"10.1.2.3:4000", "", "", "10.1.2.3:4000"},
+	} {
+		req := httptest.NewRequest("GET", "/nanotalon/healthz", nil)
+		req.RemoteAddr = tc.peer
+		if tc.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+		}
+		if tc.realIP != "" {
+			req.Header.Set("X-Real-IP", tc.realIP)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if remoteAddr != tc.want {
+			t.Errorf("From %s with X-Forwarded-For %q: expected the client %s, got %s", tc.peer, tc.forwardedFor, tc.want, remoteAddr)
+		}
+	}
+
+	if _, err := TrustProxies([]string{"proxy.local"}, inner); err == nil {
+		t.Error("Expected a host name to be refused as a trusted proxy")
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert := func(name string) {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+		os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	}
+	commonName := func(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) string {
+		t.Helper()
+		cert, err := getCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("GetCertificate failed: %v", err)
+		}
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Subject.CommonName
+	}
+
+	if _, err := TLSConfig(certFile, keyFile); err == nil {
+		t.Error("Expected missing files to fail")
+	}
+	writeCert("first")
+	cfg, err := TLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("TLSConfig failed: %v", err)
+	}
+	if name := commonName(cfg.GetCertificate); name != "first" {
+		t.Errorf("Expected the first certificate, got %q", name)
+	}
+
+	// A renewed certificate is picked up at the next check; a broken one is ignored
+	c := &certificate{certFile: certFile, keyFile: keyFile}
+	if err := c.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	writeCert("renewed")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if name := commonName(c.get); name != "first" {
+		t.Errorf("Expected the certificate to be kept until the next check, got %q", name)
+	}
+	c.checkedAt = time.Time{}
+	if name := commonName(c.get); name != "renewed" {
+		t.Errorf("Expected the renewed certificate, got %q", name)
+	}
+	os.WriteFile(keyFile, []byte("not a key"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+	c.checkedAt = time.Time{}
+	if name := commonName(c.get); name != "renewed" {
+		t.Errorf("Expected a broken pair to keep the current certificate, got %q", name)
+	}
+}
@@ -0,0 +1,15 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// webFS holds the web UI, a single page that talks to the API with the token the user
+// enters
+//
+//go:embed web
+var webFS embed.FS
+
+// webFiles are the web UI's files, served under /ui/
+var webFiles, _ = fs.Sub(webFS, "web")
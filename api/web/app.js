@@ -0,0 +1,323 @@
+// The nanotalon web UI: a thin client of the gateway's HTTP API. The token is kept in
+// localStorage and sent as a bearer token with every request.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+let currentSession = localStorage.getItem("nanotalon.session") || "api:web";
+
+function token() {
+  return localStorage.getItem("nanotalon.token") || "";
+}
+
+async function api(method, path, body) {
+  const options = { method, headers: { Authorization: "Bearer " + token() } };
+  if (body !== undefined) {
+    options.headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(body);
+  }
+  // Relative to /ui/, so the UI works under the gateway's base path
+  const response = await fetch(".." + path, options);
+  const data = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    throw new Error(data.error || response.status + " " + response.statusText);
+  }
+  return data;
+}
+
+function element(tag, className, text) {
+  const el = document.createElement(tag);
+  if (className) el.className = className;
+  if (text !== undefined) el.textContent = text;
+  return el;
+}
+
+function table(target, headings, rows) {
+  target.replaceChildren();
+  const head = element("tr");
+  headings.forEach((heading) => head.appendChild(element("th", "", heading)));
+  target.appendChild(head);
+  rows.forEach((row) => {
+    const tr = element("tr");
+    row.forEach((cell) => tr.appendChild(element("td", "", cell == null ? "" : String(cell))));
+    target.appendChild(tr);
+  });
+  if (rows.length === 0) {
+    const tr = element("tr");
+    const td = element("td", "", "Nothing here yet.");
+    td.colSpan = headings.length;
+    tr.appendChild(td);
+    target.appendChild(tr);
+  }
+}
+
+function when(value) {
+  return value ? new Date(value).toLocaleString() : "";
+}
+
+function showError(target, err) {
+  target.replaceChildren(element("div", "message error", err.message));
+}
+
+// Tabs
+
+const loaders = {
+  chat: loadChat,
+  memory: loadMemory,
+  jobs: loadJobs,
+  subagents: loadSubagents,
+  settings: loadSettings,
+};
+
+document.querySelectorAll("nav button").forEach((button) => {
+  button.addEventListener("click", () => {
+    document.querySelectorAll("nav button, .tab").forEach((el) => el.classList.remove("active"));
+    button.classList.add("active");
+    $(button.dataset.tab).classList.add("active");
+    loaders[button.dataset.tab]();
+  });
+});
+
+$("login").addEventListener("submit", (event) => {
+  event.preventDefault();
+  localStorage.setItem("nanotalon.token", $("token").value.trim());
+  $("token").value = "";
+  document.querySelector("nav button.active").click();
+});
+
+// Chat
+
+function selectSession(key) {
+  currentSession = key;
+  localStorage.setItem("nanotalon.session", key);
+  loadChat();
+}
+
+async function loadChat() {
+  $("session-name").textContent = currentSession;
+  try {
+    const data = await api("GET", "/v1/sessions");
+    const list = $("sessions");
+    list.replaceChildren();
+    data.sessions.forEach((info) => {
+      const item = element("li", info.key === currentSession ? "active" : "", info.key);
+      item.appendChild(element("small", "", info.message_count + " messages, " + when(info.updated_at)));
+      item.addEventListener("click", () => selectSession(info.key));
+      list.appendChild(item);
+    });
+  } catch (err) {
+    showError($("messages"), err);
+    return;
+  }
+
+  try {
+    const data = await api("GET", "/v1/sessions/" + encodeURIComponent(currentSession) + "/messages?limit=100");
+    $("messages").replaceChildren();
+    data.messages
+      .filter((message) => (message.role === "user" || message.role === "assistant") && message.content)
+      .forEach((message) => addMessage(message.role, message.content));
+  } catch (err) {
+    $("messages").replaceChildren(); // A new session has no messages yet
+  }
+}
+
+function addMessage(role, text) {
+  const el = element("div", "message " + role, text);
+  $("messages").appendChild(el);
+  $("messages").scrollTop = $("messages").scrollHeight;
+  return el;
+}
+
+$("new-session").addEventListener("click", () => {
+  const name = prompt("Session name", "web-" + Date.now().toString(36));
+  if (name) selectSession(name.includes(":") ? name : "api:" + name);
+});
+
+$("message").addEventListener("keydown", (event) => {
+  if (event.key === "Enter" && (event.ctrlKey || event.metaKey)) {
+    $("send").requestSubmit();
+  }
+});
+
+$("send").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const message = $("message").value.trim();
+  if (!message) return;
+  $("message").value = "";
+  addMessage("user", message);
+  try {
+    await streamRun(message, currentSession);
+  } catch (err) {
+    addMessage("error", err.message);
+  }
+  $("activity").textContent = "";
+});
+
+// streamRun runs a turn through POST /v1/runs/{id}/events, showing its progress
+async function streamRun(message, session) {
+  const id = "web-" + Date.now().toString(36) + Math.random().toString(36).slice(2, 8);
+  const response = await fetch("../v1/runs/" + id + "/events", {
+    method: "POST",
+    headers: { Authorization: "Bearer " + token(), "Content-Type": "application/json" },
+    body: JSON.stringify({ session, message }),
+  });
+  if (!response.ok) {
+    const data = await response.json().catch(() => ({}));
+    throw new Error(data.error || response.status + " " + response.statusText);
+  }
+
+  const reader = response.body.getReader();
+  const decoder = new TextDecoder();
+  let buffer = "";
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) break;
+    buffer += decoder.decode(value, { stream: true });
+    let end;
+    while ((end = buffer.indexOf("\n\n")) >= 0) {
+      const block = buffer.slice(0, end);
+      buffer = buffer.slice(end + 2);
+      let name = "message";
+      let data = "";
+      block.split("\n").forEach((line) => {
+        if (line.startsWith("event: ")) name = line.slice(7);
+        if (line.startsWith("data: ")) data += line.slice(6);
+      });
+      if (data) handleRunEvent(name, JSON.parse(data));
+    }
+  }
+}
+
+function handleRunEvent(name, data) {
+  switch (name) {
+    case "turn_started":
+      $("activity").textContent = "Thinking…";
+      break;
+    case "tool_call":
+      $("activity").textContent = "Running " + data.tool + "…";
+      break;
+    case "tool_result":
+      $("activity").textContent = data.error ? data.tool + " failed: " + data.error : data.tool + " done";
+      break;
+    case "done":
+      if (data.status === "finished") {
+        addMessage("assistant", data.response);
+      } else {
+        addMessage("error", data.error || "The run failed");
+      }
+      break;
+  }
+}
+
+// Memory
+
+async function loadMemory() {
+  try {
+    const data = await api("GET", "/v1/memory?scope=" + encodeURIComponent($("scope").value.trim()));
+    $("long-term").textContent = data.long_term || "(empty)";
+    table($("facts"), ["Subject", "Predicate", "Value", "Category", "Confidence"],
+      data.facts.map((fact) => [fact.subject, fact.predicate, fact.value, fact.category, fact.confidence]));
+    $("history").replaceChildren(...data.history.slice().reverse().map((entry) => element("div", "", entry)));
+  } catch (err) {
+    showError($("history"), err);
+  }
+}
+
+$("memory-scope").addEventListener("submit", (event) => {
+  event.preventDefault();
+  loadMemory();
+});
+
+// Jobs
+
+async function loadJobs() {
+  try {
+    const data = await api("GET", "/v1/jobs");
+    const next = data.status.next_run_at_ms;
+    $("cron-status").textContent = data.jobs.length + " jobs" + (next ? ", next run at " + when(next) : "");
+    table($("job-list"), ["ID", "Name", "Enabled", "Schedule", "Next run", "Last run", "Last status"],
+      data.jobs.map((job) => {
+        const runs = job.state.runs || [];
+        const last = runs[runs.length - 1] || {};
+        return [
+          job.id,
+          job.name,
+          job.enabled ? "yes" : "no",
+          describeSchedule(job.schedule),
+          when(job.state.next_run_at_ms),
+          when(last.started_at_ms),
+          last.error ? last.status + ": " + last.error : last.status,
+        ];
+      }));
+  } catch (err) {
+    showError($("cron-status"), err);
+  }
+}
+
+function describeSchedule(schedule) {
+  switch (schedule.kind) {
+    case "every":
+      return "every " + Math.round(schedule.every_ms / 1000) + "s";
+    case "cron":
+      return schedule.expr + (schedule.tz ? " (" + schedule.tz + ")" : "");
+    case "at":
+      return "at " + when(schedule.at_ms);
+    default:
+      return schedule.kind || "";
+  }
+}
+
+// Subagents
+
+async function loadSubagents() {
+  try {
+    const data = await api("GET", "/v1/subagents");
+    table($("task-list"), ["ID", "Label", "Status", "Created", "Finished", "Result"],
+      data.tasks.map((task) => [
+        task.id.slice(0, 8),
+        task.label,
+        task.status,
+        when(task.created_at),
+        when(task.finished_at),
+        task.result,
+      ]));
+  } catch (err) {
+    showError($("task-list"), err);
+  }
+}
+
+// Settings go through the /settings chat command, so they are checked the same way as in
+// any other chat
+
+async function settingsCommand(command) {
+  try {
+    const data = await api("POST", "/v1/chat", { session: currentSession, message: command });
+    $("settings-output").textContent = data.response;
+  } catch (err) {
+    $("settings-output").textContent = err.message;
+  }
+}
+
+function loadSettings() {
+  $("settings-session").textContent = currentSession;
+  settingsCommand("/settings");
+}
+
+$("settings-form").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const fields = { model: $("setting-model"), temperature: $("setting-temperature"), persona: $("setting-persona") };
+  for (const [name, input] of Object.entries(fields)) {
+    const value = input.value.trim();
+    if (value) {
+      await settingsCommand("/settings " + name + " " + value);
+      input.value = "";
+    }
+  }
+  await settingsCommand("/settings");
+});
+
+$("settings-reset").addEventListener("click", async () => {
+  await settingsCommand("/settings reset");
+  await settingsCommand("/settings");
+});
+
+loadChat();
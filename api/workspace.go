@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"nanotalon/agent/memory"
+	"nanotalon/agent/subagent"
+)
+
+// recentHistory is how many of a scope's latest history entries /v1/memory returns
+const recentHistory = 20
+
+// memoryResponse is the reply to GET /v1/memory
+type memoryResponse struct {
+	Scope    string        `json:"scope"`
+	LongTerm string        `json:"long_term"`
+	Facts    []memory.Fact `json:"facts"`
+	History  []string      `json:"history"` // The latest entries, oldest first
+}
+
+// needsWorkspace refuses requests while there's no workspace to read
+func (s *Server) needsWorkspace(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.services.Workspace == "" {
+			writeError(w, http.StatusServiceUnavailable, "the workspace isn't available")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleMemory shows the long-term memory, facts and recent history of the ?scope, which
+// is named as in "nanotalon memory --scope" and defaults to global
+func (s *Server) handleMemory(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("scope")
+	if name == "" {
+		name = memory.TierGlobal
+	}
+	scope, err := memory.NewScopes(s.services.Workspace).Parse(name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	store := memory.NewMemoryStoreAt(scope.Dir)
+	response := memoryResponse{Scope: scope.Name, Facts: []memory.Fact{}, History: []string{}}
+	if response.LongTerm, err = store.ReadLongTerm(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	facts, err := memory.NewFactStoreAt(scope.Dir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Facts = append(response.Facts, facts.Query(memory.FactQuery{})...)
+	entries, err := store.HistoryEntries()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(entries) > recentHistory {
+		entries = entries[len(entries)-recentHistory:]
+	}
+	for _, entry := range entries {
+		response.History = append(response.History, strings.TrimSpace(entry))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleSubagents lists the subagent tasks: pending and running ones first, then finished
+// ones newest first
+func (s *Server) handleSubagents(w http.ResponseWriter, r *http.Request) {
+	tasks, err := subagent.LoadTaskHistory(subagent.DefaultStorePath(s.services.Workspace))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if tasks == nil {
+		tasks = []subagent.SubagentTask{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tasks": tasks})
+}
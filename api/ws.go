@@ -0,0 +1,215 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"nanotalon/agent"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsPingInterval = 30 * time.Second   // How often the server pings the client
+	wsPongWait     = wsPingInterval * 2 // How long a connection may go without hearing from the client
+	wsWriteWait    = 10 * time.Second   // How long a write may take
+)
+
+// wsUpgrader accepts connections from apps and from pages served by the gateway itself;
+// browsers on other origins are refused
+var wsUpgrader = websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 4096}
+
+// wsInbound is a frame sent by the client
+type wsInbound struct {
+	Type    string `json:"type"`              // "message", "bind" or "ping"
+	ID      string `json:"id,omitempty"`      // Echoed in the response to a message
+	Session string `json:"session,omitempty"` // The session to bind to
+	Content string `json:"content,omitempty"` // The message to the agent
+}
+
+// wsOutbound is a frame sent to the client
+type wsOutbound struct {
+	Type    string       `json:"type"` // "bound", "event", "response", "error" or "pong"
+	ID      string       `json:"id,omitempty"`
+	Session string       `json:"session,omitempty"`
+	Content string       `json:"content,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Event   *agent.Event `json:"event,omitempty"`
+}
+
+// wsConn is one client connection, bound to a session
+type wsConn struct {
+	conn    *websocket.Conn
+	client  string // The client's address, as forwarded by a trusted proxy
+	agent   Agent
+	token   token           // Decides which sessions the connection may bind to
+	writeMu sync.Mutex      // Connections allow one writer at a time
+	results chan wsOutbound // Turn responses, sent after the turn's events
+
+	mu      sync.Mutex
+	session string
+}
+
+// handleWebSocket serves a bidirectional connection: the client sends messages for the
+// agent and gets every event of its session, whichever channel started the turn, plus the
+// response to each of its messages. The connection starts bound to ?session, as named in
+// POST /v1/chat, and can rebind with a bind frame.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		writeError(w, http.StatusBadRequest, "this endpoint only accepts WebSocket connections")
+		return
+	}
+	sessionKey, ok := requestSessionKey(w, r, r.URL.Query().Get("session"))
+	if !ok {
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // The upgrader has replied with the error
+	}
+	c := &wsConn{
+		conn:    conn,
+		client:  r.RemoteAddr,
+		agent:   s.services.Agent,
+		token:   requestToken(r),
+		results: make(chan wsOutbound),
+		session: sessionKey,
+	}
+	c.serve()
+}
+
+// serve runs the connection until the client leaves
+func (c *wsConn) serve() {
+	defer c.conn.Close()
+
+	// Subscribe before reading, so the events of the first message are all forwarded
+	events := c.agent.Events()
+	done := make(chan struct{})
+	defer close(done)
+	go c.forward(events, done)
+
+	c.conn.SetReadLimit(maxRequestBody)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	c.send(wsOutbound{Type: "bound", Session: c.boundSession()})
+
+	for {
+		var frame wsInbound
+		if err := c.conn.ReadJSON(&frame); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Info("WebSocket client disconnected", "client", c.client, "error", err)
+			}
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		switch frame.Type {
+		case "message":
+			if strings.TrimSpace(frame.Content) == "" {
+				c.send(wsOutbound{Type: "error", ID: frame.ID, Error: "missing content"})
+				continue
+			}
+			go c.run(frame.ID, c.boundSession(), frame.Content, done)
+		case "bind":
+			sessionKey := SessionKey(frame.Session)
+			if err := c.token.checkSession(sessionKey); err != nil {
+				c.send(wsOutbound{Type: "error", ID: frame.ID, Error: err.Error()})
+				continue
+			}
+			c.mu.Lock()
+			c.session = sessionKey
+			c.mu.Unlock()
+			c.send(wsOutbound{Type: "bound", Session: c.boundSession()})
+		case "ping":
+			c.send(wsOutbound{Type: "pong"})
+		default:
+			c.send(wsOutbound{Type: "error", ID: frame.ID, Error: "unknown frame type " + frame.Type})
+		}
+	}
+}
+
+// run runs a turn and hands its response to forward. Turns in a session run one at a
+// time, so the client may send messages while one is still going.
+func (c *wsConn) run(id, sessionKey, message string, done <-chan struct{}) {
+	result := wsOutbound{Type: "response", ID: id, Session: sessionKey}
+	response, err := c.agent.ProcessDirect(message, sessionKey)
+	if err != nil {
+		result.Type, result.Error = "error", err.Error()
+	} else {
+		result.Content = response
+	}
+	select {
+	case c.results <- result:
+	case <-done:
+	}
+}
+
+// forward sends the events of the bound session and the responses to the client's
+// messages, and pings the client, until done
+func (c *wsConn) forward(events <-chan agent.Event, done <-chan struct{}) {
+	defer c.agent.CloseEvents(events)
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil // The agent stopped; responses may still come
+				continue
+			}
+			c.sendEvent(event)
+		case result := <-c.results:
+			// Events are published before the turn returns; send the ones still queued first
+		drain:
+			for events != nil {
+				select {
+				case event, ok := <-events:
+					if !ok {
+						events = nil
+						break drain
+					}
+					c.sendEvent(event)
+				default:
+					break drain
+				}
+			}
+			c.send(result)
+		case <-ping.C:
+			// Control frames may be written alongside other writes
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// sendEvent sends an event if it belongs to the bound session
+func (c *wsConn) sendEvent(event agent.Event) {
+	if event.SessionKey == c.boundSession() {
+		c.send(wsOutbound{Type: "event", Session: event.SessionKey, Event: &event})
+	}
+}
+
+// boundSession returns the session the connection is bound to
+func (c *wsConn) boundSession() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// send writes a frame; a failed write closes the connection, which ends the read loop
+func (c *wsConn) send(frame wsOutbound) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := c.conn.WriteJSON(frame); err != nil {
+		c.conn.Close()
+	}
+}
@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxResultChars is how much of each tool result is kept in the audit log
+const maxResultChars = 500
+
+// Entry is a single recorded tool invocation
+type Entry struct {
+	Time       time.Time              `json:"time"`
+	Session    string                 `json:"session"`
+	Channel    string                 `json:"channel"`
+	Tool       string                 `json:"tool"`
+	Args       map[string]interface{} `json:"args,omitempty"`
+	DurationMS int64                  `json:"duration_ms"`
+	Result     string                 `json:"result,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// Filter selects entries when reading the audit log
+type Filter struct {
+	Tool       string
+	Session    string
+	Channel    string
+	Since      time.Time
+	ErrorsOnly bool
+	Limit      int // keep only the most recent N matches; 0 means no limit
+}
+
+// Logger appends tool invocations to a JSONL file
+type Logger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// DefaultPath returns the audit log location inside a workspace
+func DefaultPath(workspace string) string {
+	return filepath.Join(workspace, "audit", "tool_calls.jsonl")
+}
+
+// NewLogger creates a new audit logger writing to path
+func NewLogger(path string) *Logger {
+	return &Logger{path: path}
+}
+
+// Path returns the audit log file path
+func (l *Logger) Path() string {
+	return l.path
+}
+
+// Record appends an entry to the audit log, truncating the result
+func (l *Logger) Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if len(entry.Result) > maxResultChars {
+		entry.Result = entry.Result[:maxResultChars] + "... (truncated)"
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding audit entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("error creating audit directory: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	return nil
+}
+
+// ReadEntries reads the audit log at path and returns the entries matching the filter, oldest first
+func ReadEntries(path string, filter Filter) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Skip lines damaged by a crash mid-write
+			continue
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
+
+// matches reports whether an entry passes the filter
+func (f Filter) matches(entry Entry) bool {
+	if f.Tool != "" && entry.Tool != f.Tool {
+		return false
+	}
+	if f.Session != "" && entry.Session != f.Session {
+		return false
+	}
+	if f.Channel != "" && entry.Channel != f.Channel {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if f.ErrorsOnly && entry.Error == "" {
+		return false
+	}
+	return true
+}
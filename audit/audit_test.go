@@ -0,0 +1,67 @@
+package audit_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nanotalon/audit"
+)
+
+func TestRecordAndFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "tool_calls.jsonl")
+	logger := audit.NewLogger(path)
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := []audit.Entry{
+		{Time: start, Session: "cli:direct", Channel: "cli", Tool: "read_file", Args: map[string]interface{}{"path": "a.txt"}, Result: "hello"},
+		{Time: start.Add(time.Minute), Session: "discord:42", Channel: "discord", Tool: "execute_command", Error: "denied"},
+		{Time: start.Add(2 * time.Minute), Session: "cli:direct", Channel: "cli", Tool: "web_fetch", Result: strings.Repeat("x", 2000)},
+	}
+	for _, entry := range records {
+		if err := logger.Record(entry); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	all, err := audit.ReadEntries(path, audit.Filter{})
+	if err != nil || len(all) != 3 {
+		t.Fatalf("expected 3 entries, got %d (err %v)", len(all), err)
+	}
+	if len(all[2].Result) >= 2000 {
+		t.Errorf("expected long result to be truncated, got %d chars", len(all[2].Result))
+	}
+
+	cases := []struct {
+		name   string
+		filter audit.Filter
+		want   []string
+	}{
+		{"by channel", audit.Filter{Channel: "cli"}, []string{"read_file", "web_fetch"}},
+		{"by tool", audit.Filter{Tool: "execute_command"}, []string{"execute_command"}},
+		{"errors only", audit.Filter{ErrorsOnly: true}, []string{"execute_command"}},
+		{"since", audit.Filter{Since: start.Add(30 * time.Second)}, []string{"execute_command", "web_fetch"}},
+		{"limit keeps newest", audit.Filter{Limit: 1}, []string{"web_fetch"}},
+	}
+	for _, tc := range cases {
+		entries, err := audit.ReadEntries(path, tc.filter)
+		if err != nil {
+			t.Fatalf("%s: ReadEntries failed: %v", tc.name, err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Tool)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReadEntriesMissingFile(t *testing.T) {
+	entries, err := audit.ReadEntries(filepath.Join(t.TempDir(), "missing.jsonl"), audit.Filter{})
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected no entries and no error for a missing log, got %v, %v", entries, err)
+	}
+}
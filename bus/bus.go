@@ -1,6 +1,7 @@
 package bus
 
 import (
+	"context"
 	"sync"
 )
 
@@ -20,9 +21,34 @@ type OutboundMessage struct {
 	Channel  string                 `json:"channel"`
 	ChatID   string                `json:"chat_id"`
 	Content  string                `json:"content"`
+	Attachments []string           `json:"attachments,omitempty"` // Paths of files sent with the message
+	Buttons     []Button           `json:"buttons,omitempty"`     // Answers offered under the message
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// Button is an answer offered under a message; pressing it sends Data back as the user's message
+type Button struct {
+	Text string `json:"text"`
+	Data string `json:"data"`
+}
+
+// Kinds of non-reply outbound messages, stored under Metadata[MetadataKind]
+const (
+	MetadataKind = "kind"
+	KindProgress = "progress" // Intermediate notice sent while the agent is working
+	KindTyping   = "typing"   // Typing indicator; Content is empty
+	KindRead     = "read"     // Read receipt for Metadata[MetadataMessageID]; Content is empty
+)
+
+// MetadataMessageID holds the platform's ID of an inbound message; read receipts carry it back
+const MetadataMessageID = "message_id"
+
+// Kind returns the message kind, or "" for a regular reply
+func (m OutboundMessage) Kind() string {
+	kind, _ := m.Metadata[MetadataKind].(string)
+	return kind
+}
+
 // MessageBus handles routing of messages between components
 type MessageBus struct {
 	inboundQueue  chan InboundMessage
@@ -72,6 +98,26 @@ func (mb *MessageBus) ConsumeOutbound() (OutboundMessage, error) {
 	return msg, nil
 }
 
+// ConsumeInboundContext waits for an inbound message until ctx is cancelled
+func (mb *MessageBus) ConsumeInboundContext(ctx context.Context) (InboundMessage, error) {
+	select {
+	case msg := <-mb.inboundQueue:
+		return msg, nil
+	case <-ctx.Done():
+		return InboundMessage{}, ctx.Err()
+	}
+}
+
+// ConsumeOutboundContext waits for an outbound message until ctx is cancelled
+func (mb *MessageBus) ConsumeOutboundContext(ctx context.Context) (OutboundMessage, error) {
+	select {
+	case msg := <-mb.outboundQueue:
+		return msg, nil
+	case <-ctx.Done():
+		return OutboundMessage{}, ctx.Err()
+	}
+}
+
 // Subscribe creates a subscription to receive messages of a specific type
 func (mb *MessageBus) Subscribe(subscriberID string) <-chan InboundMessage {
 	mb.mutex.Lock()
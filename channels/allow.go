@@ -0,0 +1,74 @@
+package channels
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mentionPrefix marks an allow_from entry that only admits messages addressed to the bot
+const mentionPrefix = "mention:"
+
+// allowFromMatches reports whether any of ids (a sender ID, username, chat ID...) passes
+// allow_from. An empty list allows everyone. Entries are matched case-insensitively and
+// may be:
+//
+//	"*"              anyone
+//	"12345", "@bob"  an exact ID or username; a leading @ or + is ignored on both sides
+//	"*@example.com"  a pattern, where * matches any run of characters and ? any one
+//	"mention:<entry>" the entry, but only when addressed is true: a direct message, a
+//	                  mention of the bot or a reply to it
+func allowFromMatches(allowFrom []string, addressed bool, ids ...string) bool {
+	if len(allowFrom) == 0 {
+		// If no allowed chats specified, allow all
+		return true
+	}
+
+	for _, entry := range allowFrom {
+		entry = strings.TrimSpace(entry)
+		if rest, ok := cutPrefixFold(entry, mentionPrefix); ok {
+			if !addressed {
+				continue
+			}
+			entry = rest
+		}
+
+		for _, id := range ids {
+			if id != "" && allowEntryMatches(entry, id) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// allowEntryMatches matches one allow_from entry against an ID
+func allowEntryMatches(entry, id string) bool {
+	entry, id = normalizeAllowID(entry), normalizeAllowID(id)
+	if entry == "" {
+		return false
+	}
+	if !strings.ContainsAny(entry, "*?") {
+		return entry == id
+	}
+
+	pattern := regexp.QuoteMeta(entry)
+	pattern = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(pattern)
+	matched, _ := regexp.MatchString("^"+pattern+"$", id)
+	return matched
+}
+
+// normalizeAllowID lowercases an ID and drops the @ of usernames and the + of phone numbers
+func normalizeAllowID(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	id = strings.TrimPrefix(id, "@")
+	return strings.TrimPrefix(id, "+")
+}
+
+// cutPrefixFold is strings.CutPrefix, ignoring case
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
@@ -0,0 +1,49 @@
+package channels
+
+import (
+	"testing"
+
+	"nanotalon/config"
+)
+
+func TestAllowFromMatches(t *testing.T) {
+	cases := []struct {
+		name      string
+		allowFrom []string
+		addressed bool
+		ids       []string
+		want      bool
+	}{
+		{"empty allows all", nil, false, []string{"42"}, true},
+		{"exact id", []string{"42"}, false, []string{"7", "42"}, true},
+		{"no match", []string{"42"}, true, []string{"7"}, false},
+		{"wildcard", []string{"*"}, false, []string{"7"}, true},
+		{"username ignores @ and case", []string{"@Alice"}, false, []string{"alice"}, true},
+		{"phone ignores +", []string{"+4915550"}, false, []string{"4915550"}, true},
+		{"pattern", []string{"team-*"}, false, []string{"Team-Ops"}, true},
+		{"pattern is anchored", []string{"team-?"}, false, []string{"team-ops"}, false},
+		{"mention rule when addressed", []string{"mention:-100200"}, true, []string{"-100200"}, true},
+		{"mention rule when not addressed", []string{"mention:-100200"}, false, []string{"-100200"}, false},
+		{"mention rule with wildcard", []string{"Mention:*"}, true, []string{"7"}, true},
+	}
+	for _, tc := range cases {
+		if got := allowFromMatches(tc.allowFrom, tc.addressed, tc.ids...); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEmailAllowFromDomains(t *testing.T) {
+	channel := NewEmailChannel(&config.EmailConfig{AllowFrom: []string{"@example.com", "*@*.example.org"}})
+	for addr, want := range map[string]bool{
+		"Bob@Example.com":        true,
+		"bob@mail.example.org":   true,
+		"bob@example.org":        false,
+		"bob@notexample.com":     false,
+		"example.com@attack.net": false,
+	} {
+		if got := channel.isAllowed(addr); got != want {
+			t.Errorf("isAllowed(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
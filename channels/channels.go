@@ -1,8 +1,18 @@
 package channels
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"nanotalon/bus"
 	"nanotalon/config"
+	"nanotalon/logging"
+	"nanotalon/media"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // Channel represents a chat platform channel
@@ -20,10 +30,51 @@ type Channel interface {
 	Send(chatID, message string) error
 }
 
+// TypingNotifier is implemented by channels that can show a typing indicator
+type TypingNotifier interface {
+	// SendTyping shows the bot as typing in a chat for a few seconds
+	SendTyping(chatID string) error
+}
+
+// ReadMarker is implemented by channels that can mark incoming messages as read
+type ReadMarker interface {
+	// MarkRead marks a message in a chat as read, by the ID it was published with
+	MarkRead(chatID, messageID string) error
+}
+
+// AttachmentSender is implemented by channels that can send files
+type AttachmentSender interface {
+	// SendAttachments sends a message followed by the files at paths
+	SendAttachments(chatID, message string, paths []string) error
+}
+
+// ButtonSender is implemented by channels that can show answers as buttons under a message
+type ButtonSender interface {
+	// SendButtons sends a message with buttons; pressing one comes back as a message with its Data
+	SendButtons(chatID, message string, buttons []bus.Button) error
+}
+
+// WebhookReceiver is implemented by channels whose platform posts events to the gateway's
+// HTTP server, at /webhooks/<channel name>
+type WebhookReceiver interface {
+	// ServeWebhook handles one event request
+	ServeWebhook(w http.ResponseWriter, r *http.Request)
+}
+
+// InboundChannel is implemented by channels that publish incoming messages to the agent
+type InboundChannel interface {
+	// SetMessageBus sets where incoming messages are published
+	SetMessageBus(messageBus *bus.MessageBus)
+}
+
 // Manager manages multiple channels
 type Manager struct {
-	channels map[string]Channel
-	config   *config.Config
+	mu         sync.RWMutex
+	channels   map[string]Channel
+	config     *config.Config
+	media      *media.Store
+	messageBus *bus.MessageBus
+	started    bool
 }
 
 // NewManager creates a new channel manager
@@ -41,106 +92,214 @@ func NewManager(cfg *config.Config) *Manager {
 
 // initChannels initializes channels based on configuration
 func (cm *Manager) initChannels() {
+	for _, channel := range newChannels(cm.config) {
+		cm.Register(channel)
+	}
+}
+
+// newChannels creates the channels enabled in a configuration
+func newChannels(cfg *config.Config) []Channel {
+	var channels []Channel
+
 	// Initialize Telegram if enabled
-	if cm.config.Channels.Telegram.Enabled {
-		telegram := NewTelegramChannel(cm.config.Channels.Telegram.Token, cm.config.Channels.Telegram.AllowFrom)
-		cm.Register(telegram)
+	if cfg.Channels.Telegram.Enabled {
+		telegram := NewTelegramChannel(cfg.Channels.Telegram.Token, cfg.Channels.Telegram.AllowFrom)
+		channels = append(channels, telegram)
 	}
 
 	// Initialize Discord if enabled
-	if cm.config.Channels.Discord.Enabled {
-		discord := NewDiscordChannel(cm.config.Channels.Discord.Token, cm.config.Channels.Discord.AllowFrom)
-		cm.Register(discord)
+	if cfg.Channels.Discord.Enabled {
+		discord := NewDiscordChannel(cfg.Channels.Discord.Token, cfg.Channels.Discord.AllowFrom)
+		channels = append(channels, discord)
 	}
 
 	// Initialize Slack if enabled
-	if cm.config.Channels.Slack.Enabled {
-		slack := NewSlackChannel(cm.config.Channels.Slack.BotToken, cm.config.Channels.Slack.AppToken, cm.config.Channels.Slack.AllowFrom)
-		cm.Register(slack)
+	if cfg.Channels.Slack.Enabled {
+		slack := NewSlackChannel(cfg.Channels.Slack.BotToken, cfg.Channels.Slack.AppToken, cfg.Channels.Slack.AllowFrom)
+		channels = append(channels, slack)
 	}
 
 	// Initialize Feishu if enabled
-	if cm.config.Channels.Feishu.Enabled {
+	if cfg.Channels.Feishu.Enabled {
 		feishu := NewFeishuChannel(
-			cm.config.Channels.Feishu.AppID,
-			cm.config.Channels.Feishu.AppSecret,
-			cm.config.Channels.Feishu.EncryptKey,
-			cm.config.Channels.Feishu.Verification,
-			cm.config.Channels.Feishu.AllowFrom,
+			cfg.Channels.Feishu.AppID,
+			cfg.Channels.Feishu.AppSecret,
+			cfg.Channels.Feishu.EncryptKey,
+			cfg.Channels.Feishu.Verification,
+			cfg.Channels.Feishu.AllowFrom,
 		)
-		cm.Register(feishu)
+		channels = append(channels, feishu)
 	}
 
 	// Initialize Mochat if enabled
-	if cm.config.Channels.Mochat.Enabled {
+	if cfg.Channels.Mochat.Enabled {
 		mochat := NewMochatChannel(
-			cm.config.Channels.Mochat.BaseURL,
-			cm.config.Channels.Mochat.ClawToken,
-			cm.config.Channels.Mochat.AllowFrom,
+			cfg.Channels.Mochat.BaseURL,
+			cfg.Channels.Mochat.ClawToken,
+			cfg.Channels.Mochat.AllowFrom,
 		)
-		cm.Register(mochat)
+		channels = append(channels, mochat)
 	}
 
 	// Initialize DingTalk if enabled
-	if cm.config.Channels.DingTalk.Enabled {
+	if cfg.Channels.DingTalk.Enabled {
 		dingtalk := NewDingTalkChannel(
-			cm.config.Channels.DingTalk.ClientID,
-			cm.config.Channels.DingTalk.Secret,
-			cm.config.Channels.DingTalk.AllowFrom,
+			cfg.Channels.DingTalk.ClientID,
+			cfg.Channels.DingTalk.Secret,
+			cfg.Channels.DingTalk.AllowFrom,
 		)
-		cm.Register(dingtalk)
+		channels = append(channels, dingtalk)
 	}
 
 	// Initialize Email if enabled
-	if cm.config.Channels.Email.Enabled {
-		email := NewEmailChannel(&cm.config.Channels.Email)
-		cm.Register(email)
+	if cfg.Channels.Email.Enabled {
+		email := NewEmailChannel(&cfg.Channels.Email)
+		channels = append(channels, email)
 	}
 
 	// Initialize QQ if enabled
-	if cm.config.Channels.QQ.Enabled {
+	if cfg.Channels.QQ.Enabled {
 		qq := NewQQChannel(
-			cm.config.Channels.QQ.AppID,
-			cm.config.Channels.QQ.Secret,
-			cm.config.Channels.QQ.AllowFrom,
+			cfg.Channels.QQ.AppID,
+			cfg.Channels.QQ.Secret,
+			cfg.Channels.QQ.AllowFrom,
 		)
-		cm.Register(qq)
+		channels = append(channels, qq)
+	}
+
+	// Initialize Mattermost if enabled
+	if cfg.Channels.Mattermost.Enabled {
+		mattermost := NewMattermostChannel(
+			cfg.Channels.Mattermost.URL,
+			cfg.Channels.Mattermost.Token,
+			cfg.Channels.Mattermost.AllowFrom,
+		)
+		channels = append(channels, mattermost)
+	}
+
+	// Initialize Rocket.Chat if enabled
+	if cfg.Channels.RocketChat.Enabled {
+		rocketchat := NewRocketChatChannel(
+			cfg.Channels.RocketChat.URL,
+			cfg.Channels.RocketChat.UserID,
+			cfg.Channels.RocketChat.Token,
+			cfg.Channels.RocketChat.AllowFrom,
+		)
+		channels = append(channels, rocketchat)
 	}
 
 	// Initialize WhatsApp if enabled
-	if cm.config.Channels.WhatsApp.Enabled {
+	if cfg.Channels.WhatsApp.Enabled {
 		waConfig := &WhatsAppConfig{
-			Enabled:   cm.config.Channels.WhatsApp.Enabled,
-			AllowFrom: cm.config.Channels.WhatsApp.AllowFrom,
+			Enabled:     cfg.Channels.WhatsApp.Enabled,
+			AllowFrom:   cfg.Channels.WhatsApp.AllowFrom,
+			SessionPath: cfg.Channels.WhatsApp.SessionPath,
 		}
 		whatsapp := NewWhatsAppChannel(waConfig)
-		cm.Register(whatsapp)
+		channels = append(channels, whatsapp)
+	}
+
+	return channels
+}
+
+// channelSections returns each channel's configuration section by channel name
+func channelSections(cfg *config.Config) map[string]interface{} {
+	return map[string]interface{}{
+		"telegram":   cfg.Channels.Telegram,
+		"discord":    cfg.Channels.Discord,
+		"slack":      cfg.Channels.Slack,
+		"feishu":     cfg.Channels.Feishu,
+		"mochat":     cfg.Channels.Mochat,
+		"dingtalk":   cfg.Channels.DingTalk,
+		"email":      cfg.Channels.Email,
+		"qq":         cfg.Channels.QQ,
+		"mattermost": cfg.Channels.Mattermost,
+		"rocketchat": cfg.Channels.RocketChat,
+		"whatsapp":   cfg.Channels.WhatsApp,
 	}
 }
 
-// Register registers a channel
+// Register registers a channel; channels that receive attachments save them to the workspace
 func (cm *Manager) Register(channel Channel) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.register(channel)
+}
+
+// register registers a channel; the caller holds mu
+func (cm *Manager) register(channel Channel) {
+	if receiver, ok := channel.(MediaReceiver); ok {
+		receiver.SetMediaStore(cm.mediaStore())
+	}
+	if receiver, ok := channel.(GroupReceiver); ok {
+		receiver.SetGroupPolicy(groupPolicy(cm.config))
+	}
+	if inbound, ok := channel.(InboundChannel); ok && cm.messageBus != nil {
+		inbound.SetMessageBus(cm.messageBus)
+	}
 	cm.channels[channel.Name()] = channel
 }
 
+// SetMessageBus connects the channels that receive messages to the agent's message bus
+func (cm *Manager) SetMessageBus(messageBus *bus.MessageBus) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.messageBus = messageBus
+	for _, channel := range cm.channels {
+		if inbound, ok := channel.(InboundChannel); ok {
+			inbound.SetMessageBus(messageBus)
+		}
+	}
+}
+
+// groupPolicy returns the configured group chat policy
+func groupPolicy(cfg *config.Config) GroupPolicy {
+	return GroupPolicy{
+		RequireMention:  cfg.Channels.Groups.RequireMention,
+		ContextMessages: cfg.Channels.Groups.ContextMessages,
+	}
+}
+
+// mediaStore returns the store for inbound attachments, creating it on first use
+func (cm *Manager) mediaStore() *media.Store {
+	if cm.media == nil {
+		maxBytes := int64(cm.config.Channels.Media.MaxSizeMB) << 20
+		cm.media = media.NewStore(cm.config.GetWorkspacePath(), maxBytes)
+	}
+	return cm.media
+}
+
 // Get returns a channel by name
 func (cm *Manager) Get(name string) (Channel, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
 	channel, exists := cm.channels[name]
 	return channel, exists
 }
 
-// StartAll starts all registered channels
+// StartAll starts all registered channels. One failing to start doesn't keep the others
+// from starting; each failure is logged and the last one returned.
 func (cm *Manager) StartAll() error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.started = true
+
+	var lastErr error
 	for name, channel := range cm.channels {
 		if err := channel.Start(); err != nil {
-			return fmt.Errorf("failed to start channel %s: %w", name, err)
+			lastErr = fmt.Errorf("failed to start channel %s: %w", name, err)
+			slog.Error("Failed to start channel", logging.ChannelKey, name, "error", err)
 		}
 	}
-	return nil
+	return lastErr
 }
 
 // StopAll stops all registered channels
 func (cm *Manager) StopAll() error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.started = false
+
 	var lastErr error
 	for name, channel := range cm.channels {
 		if err := channel.Stop(); err != nil {
@@ -150,6 +309,86 @@ func (cm *Manager) StopAll() error {
 	return lastErr
 }
 
+// Reload applies a changed configuration. Channels whose section changed are stopped and,
+// if still enabled, recreated from the new section and started, so tokens can be rotated
+// and channels switched on or off; the other channels keep running untouched. Failures are
+// logged and the last one returned.
+func (cm *Manager) Reload(cfg *config.Config) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	oldSections, newSections := channelSections(cm.config), channelSections(cfg)
+	cm.config = cfg
+
+	fresh := make(map[string]Channel)
+	for _, channel := range newChannels(cfg) {
+		fresh[channel.Name()] = channel
+	}
+
+	var lastErr error
+	for name, section := range newSections {
+		if reflect.DeepEqual(oldSections[name], section) {
+			continue
+		}
+
+		if channel, exists := cm.channels[name]; exists {
+			delete(cm.channels, name)
+			if cm.started {
+				if err := channel.Stop(); err != nil {
+					lastErr = fmt.Errorf("failed to stop channel %s: %w", name, err)
+					slog.Error("Failed to stop channel", logging.ChannelKey, name, "error", err)
+				}
+				slog.Info("Channel stopped after a config change", logging.ChannelKey, name)
+			}
+		}
+
+		channel, enabled := fresh[name]
+		if !enabled {
+			continue
+		}
+		cm.register(channel)
+		if !cm.started {
+			continue
+		}
+		if err := channel.Start(); err != nil {
+			lastErr = fmt.Errorf("failed to start channel %s: %w", name, err)
+			slog.Error("Failed to start channel", logging.ChannelKey, name, "error", err)
+			continue
+		}
+		slog.Info("Channel started after a config change", logging.ChannelKey, name)
+	}
+
+	// The group policy applies to all channels, so running ones pick it up too
+	for _, channel := range cm.channels {
+		if receiver, ok := channel.(GroupReceiver); ok {
+			receiver.SetGroupPolicy(groupPolicy(cfg))
+		}
+	}
+	return lastErr
+}
+
+// ReloadKeys lists the config keys Reload applies: each channel's section and the group policy
+func (cm *Manager) ReloadKeys() []string {
+	keys := []string{"channels.groups"}
+	for name := range channelSections(&config.Config{}) {
+		keys = append(keys, "channels."+name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ServeHTTP routes requests to /webhooks/<channel name> to the channel's webhook
+func (cm *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/webhooks/"), "/")
+	channel, exists := cm.Get(name)
+	receiver, ok := channel.(WebhookReceiver)
+	if !exists || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	receiver.ServeWebhook(w, r)
+}
+
 // SendToChannel sends a message to a specific channel
 func (cm *Manager) SendToChannel(channelName, chatID, message string) error {
 	channel, exists := cm.Get(channelName)
@@ -160,8 +399,158 @@ func (cm *Manager) SendToChannel(channelName, chatID, message string) error {
 	return channel.Send(chatID, message)
 }
 
+// Target is a chat on a channel, such as one a broadcast goes to
+type Target struct {
+	Channel string
+	ChatID  string
+}
+
+// ParseTarget parses a target written as "<channel>:<chat ID>"
+func ParseTarget(s string) (Target, error) {
+	channel, chatID, found := strings.Cut(strings.TrimSpace(s), ":")
+	if !found || channel == "" || chatID == "" {
+		return Target{}, fmt.Errorf("invalid target %q, expected <channel>:<chat ID>", s)
+	}
+	return Target{Channel: channel, ChatID: chatID}, nil
+}
+
+// String returns the target as "<channel>:<chat ID>"
+func (t Target) String() string {
+	return t.Channel + ":" + t.ChatID
+}
+
+// Broadcast sends a message as is to each target, without going through the agent. A
+// target that fails doesn't stop the others; their errors are returned together.
+func (cm *Manager) Broadcast(message string, targets []Target) error {
+	var errs []error
+	for _, target := range targets {
+		if err := cm.SendToChannel(target.Channel, target.ChatID, message); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SendWithFallback sends a message as is to the first target that accepts it, trying the
+// others in order. If every target fails, their errors are returned together.
+func (cm *Manager) SendWithFallback(message string, targets []Target) error {
+	if len(targets) == 0 {
+		return fmt.Errorf("no target to send to")
+	}
+	var errs []error
+	for _, target := range targets {
+		err := cm.SendToChannel(target.Channel, target.ChatID, message)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", target, err))
+	}
+	return errors.Join(errs...)
+}
+
+// SendWithAttachments sends a message with files attached. Channels that can't send files
+// get the message with the files' paths listed instead.
+func (cm *Manager) SendWithAttachments(channelName, chatID, message string, attachments []string) error {
+	channel, exists := cm.Get(channelName)
+	if !exists {
+		return fmt.Errorf("channel %s not found", channelName)
+	}
+
+	if len(attachments) == 0 {
+		return channel.Send(chatID, message)
+	}
+	if sender, ok := channel.(AttachmentSender); ok {
+		return sender.SendAttachments(chatID, message, attachments)
+	}
+	return channel.Send(chatID, strings.TrimSpace(message+"\n\nFiles can't be sent here; they are saved at:\n- "+strings.Join(attachments, "\n- ")))
+}
+
+// SendReply sends an agent reply with its attachments and buttons. Channels that can't
+// show buttons get the answers listed under the message instead.
+func (cm *Manager) SendReply(msg bus.OutboundMessage) error {
+	if len(msg.Buttons) == 0 {
+		return cm.SendWithAttachments(msg.Channel, msg.ChatID, msg.Content, msg.Attachments)
+	}
+	channel, exists := cm.Get(msg.Channel)
+	if !exists {
+		return fmt.Errorf("channel %s not found", msg.Channel)
+	}
+
+	sender, ok := channel.(ButtonSender)
+	if !ok {
+		var answers []string
+		for _, button := range msg.Buttons {
+			answers = append(answers, button.Data)
+		}
+		content := strings.TrimSpace(msg.Content + "\n\nReply with one of:\n- " + strings.Join(answers, "\n- "))
+		return cm.SendWithAttachments(msg.Channel, msg.ChatID, content, msg.Attachments)
+	}
+
+	// Files go first so the buttons end up under the last message
+	if len(msg.Attachments) > 0 {
+		if err := cm.SendWithAttachments(msg.Channel, msg.ChatID, "", msg.Attachments); err != nil {
+			return err
+		}
+	}
+	return sender.SendButtons(msg.ChatID, msg.Content, msg.Buttons)
+}
+
+// SendTyping shows a typing indicator in a chat; channels without one ignore it
+func (cm *Manager) SendTyping(channelName, chatID string) error {
+	channel, exists := cm.Get(channelName)
+	if !exists {
+		return fmt.Errorf("channel %s not found", channelName)
+	}
+
+	notifier, ok := channel.(TypingNotifier)
+	if !ok {
+		return nil
+	}
+	return notifier.SendTyping(chatID)
+}
+
+// MarkRead marks a message as read; channels without read receipts ignore it
+func (cm *Manager) MarkRead(channelName, chatID, messageID string) error {
+	channel, exists := cm.Get(channelName)
+	if !exists {
+		return fmt.Errorf("channel %s not found", channelName)
+	}
+
+	marker, ok := channel.(ReadMarker)
+	if !ok {
+		return nil
+	}
+	return marker.MarkRead(chatID, messageID)
+}
+
+// ChannelStatus describes a channel for the gateway's status endpoints
+type ChannelStatus struct {
+	Name    string `json:"name"`
+	Running bool   `json:"running"` // Started, and for channels that track it, still connected
+	Webhook bool   `json:"webhook"` // Receives events at /webhooks/<name>
+}
+
+// Status describes the enabled channels, sorted by name
+func (cm *Manager) Status() []ChannelStatus {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	statuses := make([]ChannelStatus, 0, len(cm.channels))
+	for name, channel := range cm.channels {
+		status := ChannelStatus{Name: name, Running: cm.started}
+		if reporter, ok := channel.(interface{ IsRunning() bool }); ok {
+			status.Running = reporter.IsRunning()
+		}
+		_, status.Webhook = channel.(WebhookReceiver)
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
 // GetEnabledChannels returns a list of enabled channel names
 func (cm *Manager) GetEnabledChannels() []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
 	var enabled []string
 	for name := range cm.channels {
 		enabled = append(enabled, name)
@@ -1,15 +1,33 @@
 package channels
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/open-dingtalk/dingtalk-stream-sdk-go/chatbot"
 	"github.com/open-dingtalk/dingtalk-stream-sdk-go/client"
+
+	"nanotalon/bus"
+	"nanotalon/logging"
 )
 
-// DingTalkChannel implements the DingTalk channel
+// dingTalkAPIBase is the host of DingTalk's OpenAPI
+const dingTalkAPIBase = "https://api.dingtalk.com"
+
+// maxDingTalkTitleChars caps the title of markdown messages, shown in notifications
+const maxDingTalkTitleChars = 20
+
+// DingTalkChannel implements the DingTalk channel. Messages arrive over the Stream API;
+// replies use the session webhook of the conversation while it is valid, and the robot
+// OpenAPI otherwise, both as markdown messages.
 type DingTalkChannel struct {
 	clientID     string
 	secret       string
@@ -17,6 +35,24 @@ type DingTalkChannel struct {
 	name         string
 	running      bool
 	dtClient     *client.StreamClient
+	apiBase      string
+	httpClient   *http.Client
+	messageBus   *bus.MessageBus
+
+	tokenMu     sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+
+	// Conversations an allowed user wrote in, by conversation ID
+	conversations sync.Map
+}
+
+// dingTalkConversation is what a reply to a conversation needs
+type dingTalkConversation struct {
+	group          bool
+	userID         string // Staff ID of the sender, for 1:1 conversations
+	sessionWebhook string
+	expires        time.Time
 }
 
 // NewDingTalkChannel creates a new DingTalk channel
@@ -26,35 +62,43 @@ func NewDingTalkChannel(clientID, secret string, allowedChats []string) *DingTal
 		secret:       secret,
 		allowedChats: allowedChats,
 		name:         "dingtalk",
+		apiBase:      dingTalkAPIBase,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
 	}
 }
 
+// SetMessageBus sets where incoming DingTalk messages are published
+func (dc *DingTalkChannel) SetMessageBus(messageBus *bus.MessageBus) {
+	dc.messageBus = messageBus
+}
+
 // Start starts the DingTalk channel
 func (dc *DingTalkChannel) Start() error {
 	if dc.clientID == "" || dc.secret == "" {
 		return fmt.Errorf("dingtalk client id and secret must be configured")
 	}
 
+	// Without a message bus the channel only sends, through the OpenAPI; a stream connection
+	// would share messages with the gateway's
+	if dc.messageBus == nil {
+		dc.running = true
+		slog.Info("DingTalk channel started (send only)", logging.ChannelKey, dc.name)
+		return nil
+	}
+
 	// Create credential config
 	cred := client.NewAppCredentialConfig(dc.clientID, dc.secret)
 
 	// Initialize DingTalk client
 	dtClient := client.NewStreamClient(
 		client.WithAppCredential(cred),
-		client.WithOpenApiHost("https://api.dingtalk.com"),
+		client.WithOpenApiHost(dc.apiBase),
 	)
 
 	dc.dtClient = dtClient
 
-	// Set up a simple chatbot handler to receive messages
-	handlerFunc := func(ctx context.Context, data *chatbot.BotCallbackDataModel) ([]byte, error) {
-		log.Printf("Received DingTalk message from %s: %s", data.SenderNick, data.Text.Content)
-		// Process the incoming message as needed
-		return nil, nil
-	}
-
 	// Register the chatbot handler directly as the message handler
-	dtClient.RegisterChatBotCallbackRouter(handlerFunc)
+	dtClient.RegisterChatBotCallbackRouter(dc.handleMessage)
 
 	// Start the client
 	ctx := context.Background()
@@ -64,11 +108,52 @@ func (dc *DingTalkChannel) Start() error {
 	}
 
 	dc.running = true
-	log.Printf("DingTalk channel started (using DingTalk Streaming SDK)")
+	slog.Info("DingTalk channel started (using DingTalk Streaming SDK)", logging.ChannelKey, dc.name)
 
 	return nil
 }
 
+// handleMessage publishes a text message from an allowed user to the message bus
+func (dc *DingTalkChannel) handleMessage(ctx context.Context, data *chatbot.BotCallbackDataModel) ([]byte, error) {
+	if data.Msgtype != "text" {
+		slog.Info("Ignoring message, only text is supported", logging.ChannelKey, dc.name, "type", data.Msgtype, "sender", data.SenderNick)
+		return nil, nil
+	}
+
+	// Group messages only reach the bot when it is mentioned
+	group := data.ConversationType == "2"
+	addressed := !group || data.IsInAtList
+	if !allowFromMatches(dc.allowedChats, addressed, data.SenderStaffId, data.SenderNick, data.ConversationId) {
+		slog.Info("Ignoring message, sender not in allow_from", logging.ChannelKey, dc.name, "sender", data.SenderNick, "chat", data.ConversationId)
+		return nil, nil
+	}
+	if dc.messageBus == nil {
+		slog.Warn("No message bus, dropping message", logging.ChannelKey, dc.name, "sender", data.SenderNick)
+		return nil, nil
+	}
+
+	dc.conversations.Store(data.ConversationId, dingTalkConversation{
+		group:          group,
+		userID:         data.SenderStaffId,
+		sessionWebhook: data.SessionWebhook,
+		expires:        time.UnixMilli(data.SessionWebhookExpiredTime),
+	})
+
+	text := strings.TrimSpace(data.Text.Content)
+	if text == "" {
+		return nil, nil
+	}
+	dc.messageBus.PublishInbound(bus.InboundMessage{
+		Channel:    dc.name,
+		SenderID:   data.SenderStaffId,
+		ChatID:     data.ConversationId,
+		Content:    text,
+		SessionKey: fmt.Sprintf("%s:%s", dc.name, data.ConversationId),
+		Metadata:   map[string]interface{}{"username": data.SenderNick, bus.MetadataMessageID: data.MsgId},
+	})
+	return nil, nil
+}
+
 // Stop stops the DingTalk channel
 func (dc *DingTalkChannel) Stop() error {
 	dc.running = false
@@ -77,7 +162,7 @@ func (dc *DingTalkChannel) Stop() error {
 		dc.dtClient.Close()
 	}
 
-	log.Printf("DingTalk channel stopped")
+	slog.Info("DingTalk channel stopped", logging.ChannelKey, dc.name)
 	return nil
 }
 
@@ -86,47 +171,140 @@ func (dc *DingTalkChannel) Name() string {
 	return dc.name
 }
 
-// Send sends a message to a DingTalk chat
+// Send sends a markdown message to a DingTalk conversation. chatID is a conversation ID,
+// or the staff ID of a user for a 1:1 message to someone who hasn't written yet.
 func (dc *DingTalkChannel) Send(chatID, message string) error {
 	if !dc.running {
 		return fmt.Errorf("dingtalk channel not running")
 	}
 
-	if !dc.isAllowed(chatID) {
+	value, known := dc.conversations.Load(chatID)
+	if !dc.isAllowed(chatID) && !known {
 		return fmt.Errorf("chat %s not allowed", chatID)
 	}
 
-	// For now, we'll simulate sending since the full message sending implementation
-	// requires additional components like webhook callbacks or using DingTalk's OpenAPI
-	log.Printf("Sending to DingTalk chat %s: %.100s...", chatID, message)
+	conversation, _ := value.(dingTalkConversation)
+	if conversation.sessionWebhook != "" && time.Now().Before(conversation.expires) {
+		title := markdownTitle(message)
+		if err := chatbot.NewChatbotReplier().SimpleReplyMarkdown(context.Background(), conversation.sessionWebhook, []byte(title), []byte(message)); err != nil {
+			return fmt.Errorf("failed to send dingtalk message: %w", err)
+		}
+		return nil
+	}
 
-	// In a real implementation, we would use DingTalk's OpenAPI to send messages
-	// This would involve getting an access token and calling the message sending API
-	return dc.sendViaOpenAPI(chatID, message)
+	return dc.sendViaOpenAPI(chatID, conversation, message)
 }
 
-// sendViaOpenAPI sends a message using DingTalk's OpenAPI
-func (dc *DingTalkChannel) sendViaOpenAPI(chatID, message string) error {
-	// This is a simplified implementation
-	// In a real scenario, we'd need to:
-	// 1. Get access token from DingTalk API using clientID and secret
-	// 2. Call the message sending API with the access token
-	log.Printf("Would send to DingTalk OpenAPI: chat=%s, message=%.100s...", chatID, message)
+// sendViaOpenAPI sends a markdown message with the robot OpenAPI, to a group conversation
+// or to one user
+func (dc *DingTalkChannel) sendViaOpenAPI(chatID string, conversation dingTalkConversation, message string) error {
+	msgParam, err := json.Marshal(map[string]string{"title": markdownTitle(message), "text": message})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	body := map[string]interface{}{
+		"robotCode": dc.clientID,
+		"msgKey":    "sampleMarkdown",
+		"msgParam":  string(msgParam),
+	}
+	path := "/v1.0/robot/oToMessages/batchSend"
+	switch {
+	case conversation.group || (conversation.userID == "" && strings.HasPrefix(chatID, "cid")):
+		// Conversation IDs start with "cid"; without a known user they are groups
+		path = "/v1.0/robot/groupMessages/send"
+		body["openConversationId"] = chatID
+	case conversation.userID != "":
+		body["userIds"] = []string{conversation.userID}
+	default:
+		body["userIds"] = []string{chatID}
+	}
+
+	token, err := dc.getAccessToken()
+	if err != nil {
+		return err
+	}
+	if err := dc.api(path, token, body, nil); err != nil {
+		return fmt.Errorf("failed to send dingtalk message: %w", err)
+	}
 	return nil
 }
 
-// isAllowed checks if a chat is allowed
-func (dc *DingTalkChannel) isAllowed(chatID string) bool {
-	if len(dc.allowedChats) == 0 {
-		// If no allowed chats specified, allow all
-		return true
+// getAccessToken returns the app's access token, fetching a new one shortly before it expires
+func (dc *DingTalkChannel) getAccessToken() (string, error) {
+	dc.tokenMu.Lock()
+	defer dc.tokenMu.Unlock()
+
+	if dc.accessToken != "" && time.Now().Before(dc.tokenExpiry) {
+		return dc.accessToken, nil
 	}
 
-	for _, allowed := range dc.allowedChats {
-		if allowed == chatID {
-			return true
-		}
+	var resp struct {
+		AccessToken string `json:"accessToken"`
+		ExpireIn    int    `json:"expireIn"`
+	}
+	credentials := map[string]string{"appKey": dc.clientID, "appSecret": dc.secret}
+	if err := dc.api("/v1.0/oauth2/accessToken", "", credentials, &resp); err != nil {
+		return "", fmt.Errorf("failed to get dingtalk access token: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("failed to get dingtalk access token: empty token")
+	}
+
+	dc.accessToken = resp.AccessToken
+	dc.tokenExpiry = time.Now().Add(time.Duration(resp.ExpireIn)*time.Second - 5*time.Minute)
+	return dc.accessToken, nil
+}
+
+// api posts a request to DingTalk's OpenAPI, decoding the response into out if it isn't nil
+func (dc *DingTalkChannel) api(path, token string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	return false
+	req, err := http.NewRequest(http.MethodPost, dc.apiBase+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("x-acs-dingtalk-access-token", token)
+	}
+
+	resp, err := dc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("dingtalk API returned error (status: %d): %s", resp.StatusCode, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// markdownTitle returns the first line of a markdown message without heading marks, shortened
+func markdownTitle(message string) string {
+	title := strings.TrimSpace(message)
+	if line, _, found := strings.Cut(title, "\n"); found {
+		title = line
+	}
+	title = strings.TrimSpace(strings.TrimLeft(title, "#>*- "))
+	if runes := []rune(title); len(runes) > maxDingTalkTitleChars {
+		title = string(runes[:maxDingTalkTitleChars]) + "…"
+	}
+	if title == "" {
+		title = "Message"
+	}
+	return title
+}
+
+// isAllowed checks if a chat is allowed
+func (dc *DingTalkChannel) isAllowed(chatID string) bool {
+	return allowFromMatches(dc.allowedChats, true, chatID)
 }
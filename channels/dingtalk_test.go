@@ -0,0 +1,104 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/open-dingtalk/dingtalk-stream-sdk-go/chatbot"
+
+	"nanotalon/bus"
+)
+
+func TestDingTalkChannel(t *testing.T) {
+	type request struct {
+		path  string
+		token string
+		body  map[string]interface{}
+	}
+	requests := make(chan request, 10)
+	tokens := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path == "/v1.0/oauth2/accessToken" {
+			tokens++
+			json.NewEncoder(w).Encode(map[string]interface{}{"accessToken": "token-1", "expireIn": 7200})
+			return
+		}
+		requests <- request{r.URL.Path, r.Header.Get("x-acs-dingtalk-access-token"), body}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	channel := NewDingTalkChannel("robot-code", "secret", []string{"alice"})
+	channel.apiBase = server.URL
+	channel.running = true
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+
+	channel.handleMessage(context.Background(), &chatbot.BotCallbackDataModel{
+		ConversationId:            "cidGroup",
+		ConversationType:          "2",
+		IsInAtList:                true,
+		SenderStaffId:             "alice",
+		SenderNick:                "Alice",
+		MsgId:                     "msg1",
+		Msgtype:                   "text",
+		Text:                      chatbot.BotCallbackDataTextModel{Content: " deploy status?"},
+		SessionWebhook:            server.URL + "/robot/sendBySession",
+		SessionWebhookExpiredTime: time.Now().Add(time.Hour).UnixMilli(),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	if msg.Content != "deploy status?" || msg.ChatID != "cidGroup" || msg.SenderID != "alice" {
+		t.Errorf("Unexpected inbound message: %+v", msg)
+	}
+
+	// Replies use the session webhook while it is valid
+	if err := channel.Send("cidGroup", "## All green\n\nEvery check passed."); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	sent := <-requests
+	markdown, _ := sent.body["markdown"].(map[string]interface{})
+	if sent.path != "/robot/sendBySession" || markdown["title"] != "All green" {
+		t.Errorf("Expected a markdown reply over the session webhook, got %+v", sent)
+	}
+
+	// Once it has expired they go through the OpenAPI, reusing the access token
+	value, _ := channel.conversations.Load("cidGroup")
+	conversation := value.(dingTalkConversation)
+	conversation.expires = time.Now().Add(-time.Minute)
+	channel.conversations.Store("cidGroup", conversation)
+
+	if err := channel.Send("cidGroup", "Still green."); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	sent = <-requests
+	if sent.path != "/v1.0/robot/groupMessages/send" || sent.token != "token-1" || sent.body["openConversationId"] != "cidGroup" || sent.body["msgKey"] != "sampleMarkdown" {
+		t.Errorf("Expected a group message over the OpenAPI, got %+v", sent)
+	}
+
+	if err := channel.Send("alice", "Hi Alice."); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	sent = <-requests
+	if sent.path != "/v1.0/robot/oToMessages/batchSend" || sent.body["robotCode"] != "robot-code" {
+		t.Errorf("Expected a 1:1 message over the OpenAPI, got %+v", sent)
+	}
+	if tokens != 1 {
+		t.Errorf("Expected the access token to be fetched once, got %d", tokens)
+	}
+
+	if err := channel.Send("cidOther", "Hello"); err == nil {
+		t.Error("Expected sending to a chat not in allow_from to fail")
+	}
+}
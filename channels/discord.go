@@ -2,18 +2,34 @@ package channels
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
+
+	"nanotalon/bus"
+	"nanotalon/logging"
+	"nanotalon/media"
 )
 
-// DiscordChannel implements the Discord channel
+// DiscordChannel implements the Discord channel. The bot answers direct messages, and in
+// servers mentions and replies to it; each channel or thread has its own session.
 type DiscordChannel struct {
 	token        string
 	allowedChats []string
 	name         string
 	running      bool
 	session      *discordgo.Session
+	botUserID    string
+	media        *media.Store // If set, attachments are downloaded into the workspace
+	messageBus   *bus.MessageBus
+
+	// Channels an allowed user wrote in, so replies reach them
+	activeChats sync.Map
+	groups      *groupChats
 }
 
 // NewDiscordChannel creates a new Discord channel
@@ -23,9 +39,15 @@ func NewDiscordChannel(token string, allowedChats []string) *DiscordChannel {
 		allowedChats: allowedChats,
 		name:         "discord",
 		running:      false,
+		groups:       newGroupChats(),
 	}
 }
 
+// SetMessageBus sets where incoming Discord messages are published
+func (dc *DiscordChannel) SetMessageBus(messageBus *bus.MessageBus) {
+	dc.messageBus = messageBus
+}
+
 // Start starts the Discord channel
 func (dc *DiscordChannel) Start() error {
 	if dc.token == "" {
@@ -38,6 +60,12 @@ func (dc *DiscordChannel) Start() error {
 		return fmt.Errorf("error creating Discord session: %w", err)
 	}
 
+	// Message content needs the privileged Message Content intent enabled for the bot
+	session.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentsMessageContent
+	session.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		dc.handleMessage(m.Message)
+	})
+
 	// Try to open the websocket and connect
 	err = session.Open()
 	if err != nil {
@@ -46,19 +74,88 @@ func (dc *DiscordChannel) Start() error {
 	}
 
 	dc.session = session
+	if session.State != nil && session.State.User != nil {
+		dc.botUserID = session.State.User.ID
+	}
 	dc.running = true
-	log.Printf("Discord channel started")
+	slog.Info("Discord channel started", logging.ChannelKey, dc.name)
 
 	return nil
 }
 
+// handleMessage publishes a message from an allowed user to the message bus. In servers,
+// messages that don't mention or reply to the bot are kept as context for the next one that
+// does, unless the group policy answers every message.
+func (dc *DiscordChannel) handleMessage(message *discordgo.Message) {
+	if message.Author == nil || message.Author.Bot || message.Author.ID == dc.botUserID {
+		return
+	}
+
+	direct := message.GuildID == ""
+	addressed := direct || dc.isAddressed(message)
+	if !direct && !dc.groups.answers(addressed) {
+		if dc.isAllowed(addressed, message.Author.ID, message.Author.Username, message.ChannelID) {
+			dc.groups.remember(message.ChannelID, message.Author.Username, message.Content)
+		}
+		return
+	}
+
+	if !dc.isAllowed(addressed, message.Author.ID, message.Author.Username, message.ChannelID) {
+		slog.Info("Ignoring message, sender not in allow_from", logging.ChannelKey, dc.name, "sender", message.Author.Username, "chat", message.ChannelID)
+		return
+	}
+	if dc.messageBus == nil {
+		slog.Warn("No message bus, dropping message", logging.ChannelKey, dc.name, "sender", message.Author.Username)
+		return
+	}
+	dc.activeChats.Store(message.ChannelID, true)
+
+	text := message.Content
+	if dc.botUserID != "" {
+		text = strings.NewReplacer("<@"+dc.botUserID+">", "", "<@!"+dc.botUserID+">", "").Replace(text)
+	}
+	text = strings.TrimSpace(text)
+	attachments := dc.downloadAttachments(message)
+	if text == "" && len(attachments) == 0 {
+		return
+	}
+	if !direct {
+		text = dc.groups.withContext(message.ChannelID, text)
+	}
+
+	// Threads are channels of their own, so the channel ID keys the session
+	dc.messageBus.PublishInbound(bus.InboundMessage{
+		Channel:    dc.name,
+		SenderID:   message.Author.ID,
+		ChatID:     message.ChannelID,
+		Content:    text,
+		SessionKey: fmt.Sprintf("%s:%s", dc.name, message.ChannelID),
+		Media:      attachments,
+		Metadata:   map[string]interface{}{"username": message.Author.Username, bus.MetadataMessageID: message.ID},
+	})
+}
+
+// isAddressed reports whether a server message mentions the bot or replies to it
+func (dc *DiscordChannel) isAddressed(message *discordgo.Message) bool {
+	if dc.botUserID == "" {
+		return false
+	}
+	for _, user := range message.Mentions {
+		if user.ID == dc.botUserID {
+			return true
+		}
+	}
+	reply := message.ReferencedMessage
+	return reply != nil && reply.Author != nil && reply.Author.ID == dc.botUserID
+}
+
 // Stop stops the Discord channel
 func (dc *DiscordChannel) Stop() error {
 	if dc.session != nil {
 		dc.session.Close()
 	}
 	dc.running = false
-	log.Printf("Discord channel stopped")
+	slog.Info("Discord channel stopped", logging.ChannelKey, dc.name)
 	return nil
 }
 
@@ -73,7 +170,7 @@ func (dc *DiscordChannel) Send(chatID, message string) error {
 		return fmt.Errorf("discord channel not running")
 	}
 
-	if !dc.isAllowed(chatID) {
+	if !dc.isAllowed(true, chatID) && !dc.isActiveChat(chatID) {
 		return fmt.Errorf("channel %s not allowed", chatID)
 	}
 
@@ -87,23 +184,82 @@ func (dc *DiscordChannel) Send(chatID, message string) error {
 		return fmt.Errorf("failed to send discord message: %w", err)
 	}
 
-	log.Printf("Discord message sent successfully to channel %s", chatID)
+	slog.Debug("Message sent", logging.ChannelKey, dc.name, "chat", chatID)
 
 	return nil
 }
 
-// isAllowed checks if a chat/channel is allowed
-func (dc *DiscordChannel) isAllowed(chatID string) bool {
-	if len(dc.allowedChats) == 0 {
-		// If no allowed chats specified, allow all
-		return true
+// maxDiscordFiles is how many files Discord accepts in one message
+const maxDiscordFiles = 10
+
+// SendAttachments sends a message to a Discord channel with files uploaded alongside it
+func (dc *DiscordChannel) SendAttachments(chatID, message string, paths []string) error {
+	if !dc.running {
+		return fmt.Errorf("discord channel not running")
+	}
+
+	if !dc.isAllowed(true, chatID) && !dc.isActiveChat(chatID) {
+		return fmt.Errorf("channel %s not allowed", chatID)
 	}
 
-	for _, allowed := range dc.allowedChats {
-		if allowed == chatID {
-			return true
+	if dc.session == nil {
+		return fmt.Errorf("discord session not initialized")
+	}
+
+	// The message goes with the first batch of files
+	for start := 0; start < len(paths); start += maxDiscordFiles {
+		end := min(start+maxDiscordFiles, len(paths))
+		if err := dc.sendFiles(chatID, message, paths[start:end]); err != nil {
+			return err
+		}
+		message = ""
+	}
+	return nil
+}
+
+// sendFiles uploads files in a single Discord message
+func (dc *DiscordChannel) sendFiles(chatID, message string, paths []string) error {
+	send := &discordgo.MessageSend{Content: message}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open attachment: %w", err)
 		}
+		defer file.Close()
+
+		send.Files = append(send.Files, &discordgo.File{
+			Name:        filepath.Base(path),
+			ContentType: media.DetectType(path),
+			Reader:      file,
+		})
+	}
+
+	if _, err := dc.session.ChannelMessageSendComplex(chatID, send); err != nil {
+		return fmt.Errorf("failed to send discord attachments: %w", err)
+	}
+	return nil
+}
+
+// SendTyping shows the bot as typing in a Discord channel
+func (dc *DiscordChannel) SendTyping(chatID string) error {
+	if !dc.running || dc.session == nil {
+		return fmt.Errorf("discord channel not running")
+	}
+
+	if err := dc.session.ChannelTyping(chatID); err != nil {
+		return fmt.Errorf("failed to send typing indicator: %w", err)
 	}
+	return nil
+}
+
+// isAllowed checks if any of a user, username or channel ID is in allow_from; addressed
+// tells whether the message is a DM, mentions the bot or replies to it
+func (dc *DiscordChannel) isAllowed(addressed bool, ids ...string) bool {
+	return allowFromMatches(dc.allowedChats, addressed, ids...)
+}
 
-	return false
+// isActiveChat reports whether an allowed user has written in a channel
+func (dc *DiscordChannel) isActiveChat(channelID string) bool {
+	_, ok := dc.activeChats.Load(channelID)
+	return ok
 }
\ No newline at end of file
@@ -1,13 +1,19 @@
 package channels
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/mail"
+	"strings"
 	"sync"
+	"time"
 
+	"nanotalon/bus"
 	"nanotalon/config"
+	"nanotalon/logging"
+	"nanotalon/media"
 
 	"gopkg.in/gomail.v2"
 )
@@ -20,6 +26,18 @@ type EmailChannel struct {
 	name          string
 	running       bool
 	mutex         sync.Mutex
+	receiver      *EmailReceiver
+	messageBus    *bus.MessageBus
+	media         *media.Store // If set, attachments are saved into the workspace
+
+	// Latest email from each sender, so replies continue its thread
+	threads sync.Map
+}
+
+// emailThread is what a reply needs to continue a sender's thread
+type emailThread struct {
+	subject    string
+	references string // Message IDs of the thread so far, space separated
 }
 
 // NewEmailChannel creates a new Email channel from config
@@ -33,6 +51,16 @@ func NewEmailChannel(cfg *config.EmailConfig) *EmailChannel {
 	}
 }
 
+// SetMessageBus sets where incoming emails are published
+func (ec *EmailChannel) SetMessageBus(messageBus *bus.MessageBus) {
+	ec.messageBus = messageBus
+}
+
+// SetMediaStore sets where email attachments are saved
+func (ec *EmailChannel) SetMediaStore(store *media.Store) {
+	ec.media = store
+}
+
 // Start starts the Email channel
 func (ec *EmailChannel) Start() error {
 	if !ec.enabled {
@@ -55,14 +83,21 @@ func (ec *EmailChannel) Start() error {
 		}
 	}
 
+	// Incoming email is polled over IMAP when it's configured and there is a message bus to
+	// publish it to; otherwise the channel only sends and leaves the mailbox alone
+	var receiver *EmailReceiver
+	if ec.messageBus != nil {
+		receiver = NewEmailReceiver(ec)
+		if err := receiver.Start(); err != nil {
+			return err
+		}
+	}
+
 	ec.mutex.Lock()
 	defer ec.mutex.Unlock()
+	ec.receiver = receiver
 	ec.running = true
-	log.Printf("Email channel started")
-
-	// In a full implementation, we would start an IMAP listener to poll for emails
-	// This would involve connecting to the IMAP server and monitoring for new messages
-	// For now, we only support outbound email via SMTP
+	slog.Info("Email channel started", logging.ChannelKey, ec.name)
 
 	return nil
 }
@@ -71,11 +106,67 @@ func (ec *EmailChannel) Start() error {
 func (ec *EmailChannel) Stop() error {
 	ec.mutex.Lock()
 	defer ec.mutex.Unlock()
+	if ec.receiver != nil {
+		if err := ec.receiver.Stop(); err != nil {
+			slog.Error("Error logging out of IMAP server", logging.ChannelKey, ec.name, "error", err)
+		}
+		ec.receiver = nil
+	}
 	ec.running = false
-	log.Printf("Email channel stopped")
+	slog.Info("Email channel stopped", logging.ChannelKey, ec.name)
 	return nil
 }
 
+// handleEmail publishes an email from an allowed sender. Each sender address is its own
+// session, and replies to it continue the thread of their latest email.
+func (ec *EmailChannel) handleEmail(email *inboundEmail) {
+	if !ec.isAllowed(email.From) {
+		slog.Info("Ignoring message, sender not in allow_from", logging.ChannelKey, ec.name, "sender", email.From)
+		return
+	}
+	if ec.messageBus == nil {
+		slog.Warn("No message bus, dropping message", logging.ChannelKey, ec.name, "sender", email.From)
+		return
+	}
+
+	references := email.References
+	if email.MessageID != "" {
+		references = strings.TrimSpace(references + " " + email.MessageID)
+	}
+	ec.threads.Store(strings.ToLower(email.From), emailThread{subject: email.Subject, references: references})
+
+	var paths []string
+	if ec.media != nil {
+		for _, attachment := range email.Attachments {
+			path, err := ec.media.Save(ec.name, attachment.Filename, attachment.MimeType, bytes.NewReader(attachment.Data))
+			if err != nil {
+				slog.Warn("Could not save attachment", logging.ChannelKey, ec.name, "file", attachment.Filename, "error", err)
+				continue
+			}
+			paths = append(paths, path)
+		}
+	}
+
+	// The subject says what a new thread is about; replies only repeat it
+	content := email.Text
+	if email.Subject != "" && email.References == "" {
+		content = fmt.Sprintf("Subject: %s\n\n%s", email.Subject, email.Text)
+	}
+	if strings.TrimSpace(content) == "" && len(paths) == 0 {
+		return
+	}
+
+	ec.messageBus.PublishInbound(bus.InboundMessage{
+		Channel:    ec.name,
+		SenderID:   email.From,
+		ChatID:     email.From,
+		Content:    content,
+		Media:      paths,
+		SessionKey: fmt.Sprintf("%s:%s", ec.name, strings.ToLower(email.From)),
+		Metadata:   map[string]interface{}{"subject": email.Subject, bus.MetadataMessageID: email.MessageID},
+	})
+}
+
 // Name returns the channel name
 func (ec *EmailChannel) Name() string {
 	return ec.name
@@ -83,6 +174,11 @@ func (ec *EmailChannel) Name() string {
 
 // Send sends a message to an email address
 func (ec *EmailChannel) Send(toAddr, message string) error {
+	return ec.SendAttachments(toAddr, message, nil)
+}
+
+// SendAttachments sends a message to an email address with files attached
+func (ec *EmailChannel) SendAttachments(toAddr, message string, paths []string) error {
 	ec.mutex.Lock()
 	running := ec.running
 	ec.mutex.Unlock()
@@ -103,14 +199,14 @@ func (ec *EmailChannel) Send(toAddr, message string) error {
 	}
 
 	// Log the email sending attempt
-	log.Printf("Sending email to %s: %s", toAddr, message)
+	slog.Debug("Sending email", logging.ChannelKey, ec.name, "to", toAddr, "message", message)
 
 	// Send via SMTP
-	return ec.sendViaSMTP(toAddr, message)
+	return ec.sendViaSMTP(toAddr, message, paths)
 }
 
 // sendViaSMTP sends an email via SMTP
-func (ec *EmailChannel) sendViaSMTP(toAddr, message string) error {
+func (ec *EmailChannel) sendViaSMTP(toAddr, message string, attachments []string) error {
 	// Create a new message
 	m := gomail.NewMessage()
 
@@ -123,8 +219,11 @@ func (ec *EmailChannel) sendViaSMTP(toAddr, message string) error {
 
 	m.SetHeader("From", fromAddr)
 	m.SetHeader("To", toAddr)
-	m.SetHeader("Subject", "Nanobot Message")
+	ec.setThreadHeaders(m, fromAddr, toAddr)
 	m.SetBody("text/plain", message)
+	for _, path := range attachments {
+		m.Attach(path)
+	}
 
 	// Create the dialer for SMTP connection
 	port := ec.config.SMTPPort
@@ -142,14 +241,60 @@ func (ec *EmailChannel) sendViaSMTP(toAddr, message string) error {
 	// Attempt to send the email
 	err := dialer.DialAndSend(m)
 	if err != nil {
-		log.Printf("Failed to send email via SMTP: %v", err)
+		slog.Error("Failed to send email via SMTP", logging.ChannelKey, ec.name, "to", toAddr, "error", err)
 		return fmt.Errorf("failed to send email: %v", err)
 	}
 
-	log.Printf("Successfully sent email to %s", toAddr)
+	slog.Debug("Sent email", logging.ChannelKey, ec.name, "to", toAddr)
 	return nil
 }
 
+// setThreadHeaders sets the subject and, when the recipient has written before, the
+// In-Reply-To and References headers that keep the reply in their thread
+func (ec *EmailChannel) setThreadHeaders(m *gomail.Message, fromAddr, toAddr string) {
+	messageID := newMessageID(fromAddr)
+	m.SetHeader("Message-ID", messageID)
+
+	key := toAddr
+	if addr, err := mail.ParseAddress(toAddr); err == nil {
+		key = addr.Address
+	}
+	key = strings.ToLower(key)
+
+	value, ok := ec.threads.Load(key)
+	if !ok {
+		m.SetHeader("Subject", "Nanobot Message")
+		return
+	}
+	thread := value.(emailThread)
+
+	subject := thread.subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = strings.TrimSpace("Re: " + subject)
+	}
+	m.SetHeader("Subject", subject)
+	if thread.references != "" {
+		fields := strings.Fields(thread.references)
+		m.SetHeader("In-Reply-To", fields[len(fields)-1])
+		m.SetHeader("References", thread.references)
+	}
+
+	// Later replies follow on from this one
+	thread.references = strings.TrimSpace(thread.references + " " + messageID)
+	ec.threads.Store(key, thread)
+}
+
+// newMessageID returns a unique Message-ID in the domain of the sending address
+func newMessageID(fromAddr string) string {
+	domain := "nanotalon.local"
+	if addr, err := mail.ParseAddress(fromAddr); err == nil {
+		if _, host, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = host
+		}
+	}
+	return fmt.Sprintf("<%d.nanotalon@%s>", time.Now().UnixNano(), domain)
+}
+
 // SendHTML sends an HTML formatted message to an email address
 func (ec *EmailChannel) SendHTML(toAddr, subject, htmlContent string) error {
 	ec.mutex.Lock()
@@ -172,7 +317,7 @@ func (ec *EmailChannel) SendHTML(toAddr, subject, htmlContent string) error {
 	}
 
 	// Log the email sending attempt
-	log.Printf("Sending HTML email to %s with subject: %s", toAddr, subject)
+	slog.Debug("Sending HTML email", logging.ChannelKey, ec.name, "to", toAddr, "subject", subject)
 
 	// Create a new message
 	m := gomail.NewMessage()
@@ -205,11 +350,11 @@ func (ec *EmailChannel) SendHTML(toAddr, subject, htmlContent string) error {
 	// Attempt to send the email
 	err = dialer.DialAndSend(m)
 	if err != nil {
-		log.Printf("Failed to send HTML email via SMTP: %v", err)
+		slog.Error("Failed to send HTML email via SMTP", logging.ChannelKey, ec.name, "to", toAddr, "error", err)
 		return fmt.Errorf("failed to send HTML email: %v", err)
 	}
 
-	log.Printf("Successfully sent HTML email to %s", toAddr)
+	slog.Debug("Sent HTML email", logging.ChannelKey, ec.name, "to", toAddr)
 	return nil
 }
 
@@ -225,18 +370,12 @@ func (ec *EmailChannel) GetConfig() *config.EmailConfig {
 	return ec.config
 }
 
-// isAllowed checks if an email address is allowed
+// isAllowed checks if an email address is allowed. Besides the patterns every channel
+// takes, "@example.com" allows a whole domain.
 func (ec *EmailChannel) isAllowed(emailAddr string) bool {
-	if len(ec.allowedEmails) == 0 {
-		// If no allowed emails specified, allow all
-		return true
+	ids := []string{emailAddr}
+	if _, domain, ok := strings.Cut(emailAddr, "@"); ok {
+		ids = append(ids, "@"+domain)
 	}
-
-	for _, allowed := range ec.allowedEmails {
-		if allowed == emailAddr {
-			return true
-		}
-	}
-
-	return false
+	return allowFromMatches(ec.allowedEmails, true, ids...)
 }
@@ -2,10 +2,22 @@ package channels
 
 import (
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
-	"log"
+	"html"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
 	"time"
 
+	"nanotalon/logging"
+
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
 )
@@ -30,7 +42,7 @@ func (er *EmailReceiver) Start() error {
 	cfg := er.channel.GetConfig()
 
 	if cfg.IMAPHost == "" || cfg.IMAPPort == 0 {
-		log.Println("IMAP settings not configured, skipping incoming email monitoring")
+		slog.Info("IMAP settings not configured, skipping incoming email monitoring", logging.ChannelKey, er.channel.name)
 		return nil // Not an error, just disabled
 	}
 
@@ -48,7 +60,7 @@ func (er *EmailReceiver) Start() error {
 		return fmt.Errorf("failed to login to IMAP server: %v", err)
 	}
 
-	log.Printf("Successfully connected to IMAP server: %s", cfg.IMAPHost)
+	slog.Info("Connected to IMAP server", logging.ChannelKey, er.channel.name, "host", cfg.IMAPHost)
 
 	// Start monitoring for new emails in a separate goroutine
 	go er.monitorMailbox()
@@ -73,19 +85,20 @@ func (er *EmailReceiver) monitorMailbox() {
 	defer ticker.Stop()
 
 	for {
+		if err := er.checkNewEmails(); err != nil {
+			slog.Error("Error checking new emails", logging.ChannelKey, er.channel.name, "error", err)
+		}
+
 		select {
 		case <-er.stopChan:
-			log.Println("Email receiver stopped")
+			slog.Info("Email receiver stopped", logging.ChannelKey, er.channel.name)
 			return
 		case <-ticker.C:
-			if err := er.checkNewEmails(); err != nil {
-				log.Printf("Error checking new emails: %v", err)
-			}
 		}
 	}
 }
 
-// checkNewEmails checks for new unread emails and processes them
+// checkNewEmails fetches unread emails, hands them to the channel and marks them as read
 func (er *EmailReceiver) checkNewEmails() error {
 	// Select the INBOX
 	mbox, err := er.imapClient.Select("INBOX", false)
@@ -100,7 +113,7 @@ func (er *EmailReceiver) checkNewEmails() error {
 	// Search for unread messages
 	criteria := &imap.SearchCriteria{}
 	criteria.WithoutFlags = []string{imap.SeenFlag}
-	uids, err := er.imapClient.Search(criteria)
+	uids, err := er.imapClient.UidSearch(criteria)
 	if err != nil {
 		return fmt.Errorf("failed to search for unread messages: %v", err)
 	}
@@ -109,29 +122,177 @@ func (er *EmailReceiver) checkNewEmails() error {
 		return nil // No unread messages
 	}
 
-	// For each unread message, we'll just mark it as read without processing the content
-	// In a real implementation, you would fetch the full message content
-	for _, uid := range uids {
-		seqSet := new(imap.SeqSet)
-		seqSet.AddNum(uid)
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
 
-		// In a real implementation, you would fetch the full message body
-		// For now we just log the UID
-		log.Printf("Found unread message with UID: %d", uid)
+	// Peek so a message stays unread if the fetch fails halfway
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, len(uids))
+	if err := er.imapClient.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages); err != nil {
+		return fmt.Errorf("failed to fetch unread messages: %v", err)
+	}
 
-		// Check sender and mark as read
-		seenSeqSet := new(imap.SeqSet)
-		seenSeqSet.AddNum(uid)
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			slog.Warn("Skipping message without a body", logging.ChannelKey, er.channel.name, "uid", msg.Uid)
+			continue
+		}
 
-		err = er.imapClient.UidStore(seenSeqSet, imap.AddFlags, []interface{}{imap.SeenFlag}, nil)
+		email, err := parseEmail(body)
 		if err != nil {
-			log.Printf("Error marking message as read: %v", err)
+			slog.Error("Error parsing message", logging.ChannelKey, er.channel.name, "uid", msg.Uid, "error", err)
+			continue
 		}
+		er.channel.handleEmail(email)
+	}
+
+	// Mark everything fetched as read, including messages that couldn't be parsed, so
+	// they aren't fetched again on every check
+	if err := er.imapClient.UidStore(seqSet, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil); err != nil {
+		slog.Error("Error marking messages as read", logging.ChannelKey, er.channel.name, "error", err)
 	}
 
 	return nil
 }
 
+// inboundEmail is an incoming email reduced to what the channel uses
+type inboundEmail struct {
+	From        string // Bare sender address
+	Subject     string
+	MessageID   string
+	References  string // Message IDs of earlier emails in the thread, space separated
+	Text        string // Plain text body, or the HTML body with tags stripped
+	Attachments []emailAttachment
+}
+
+// emailAttachment is a file attached to an incoming email
+type emailAttachment struct {
+	Filename string
+	MimeType string
+	Data     []byte
+}
+
+// parseEmail reads an RFC 5322 message, decoding its MIME parts into the text body and attachments
+func parseEmail(r io.Reader) (*inboundEmail, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %v", err)
+	}
+
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid From header: %v", err)
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	email := &inboundEmail{
+		From:       from.Address,
+		Subject:    subject,
+		MessageID:  strings.TrimSpace(msg.Header.Get("Message-Id")),
+		References: strings.Join(strings.Fields(msg.Header.Get("References")), " "),
+	}
+
+	var htmlBody string
+	if err := email.readPart(textproto.MIMEHeader(msg.Header), msg.Body, &htmlBody); err != nil {
+		return nil, err
+	}
+	if email.Text == "" && htmlBody != "" {
+		email.Text = htmlToText(htmlBody)
+	}
+	email.Text = stripQuotedReply(email.Text)
+	return email, nil
+}
+
+// readPart walks a MIME part, keeping the first text/plain and text/html bodies and any attachments
+func (e *inboundEmail) readPart(header textproto.MIMEHeader, body io.Reader, htmlBody *string) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read MIME part: %v", err)
+			}
+			if err := e.readPart(part.Header, part, htmlBody); err != nil {
+				return err
+			}
+		}
+	}
+
+	// multipart.Reader already decodes quoted-printable parts and drops the header
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("failed to decode MIME part: %v", err)
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	switch {
+	case disposition == "attachment" || filename != "" || !strings.HasPrefix(mediaType, "text/"):
+		e.Attachments = append(e.Attachments, emailAttachment{Filename: filename, MimeType: mediaType, Data: data})
+	case mediaType == "text/html":
+		if *htmlBody == "" {
+			*htmlBody = string(data)
+		}
+	case e.Text == "":
+		e.Text = string(data)
+	}
+	return nil
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</tr>`)
+	htmlTags   = regexp.MustCompile(`(?s)<style.*?</style>|<script.*?</script>|<[^>]*>`)
+	blankLines = regexp.MustCompile(`\n\s*\n\s*\n+`)
+)
+
+// htmlToText reduces an HTML body to readable text for emails without a plain text part
+func htmlToText(body string) string {
+	text := htmlBreaks.ReplaceAllString(body, "\n")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n"))
+}
+
+// stripQuotedReply drops the quoted earlier message a reply carries below the new text, which
+// the session already has
+func stripQuotedReply(text string) string {
+	var kept []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "On ") && strings.HasSuffix(trimmed, "wrote:") {
+			break
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
 // IsConnected returns whether the IMAP client is connected
 func (er *EmailReceiver) IsConnected() bool {
 	if er.imapClient == nil {
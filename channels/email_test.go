@@ -0,0 +1,139 @@
+package channels
+
+import (
+	"context"
+	"mime"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/gomail.v2"
+
+	"nanotalon/bus"
+	"nanotalon/config"
+	"nanotalon/media"
+)
+
+const testEmail = "From: Alice <Alice@Example.com>\r\n" +
+	"To: bot@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Caf=C3=A9_plans?=\r\n" +
+	"Message-ID: <m2@example.com>\r\n" +
+	"References: <m0@example.com>\r\n" +
+	" <m1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Shall we meet at the caf=C3=A9?\r\n" +
+	"\r\n" +
+	"On Mon, Bot wrote:\r\n" +
+	"> Earlier reply\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Shall we meet at the caf&eacute;?</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Disposition: attachment; filename=\"menu.txt\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"Q29mZmVl\r\n" +
+	"--outer--\r\n"
+
+func TestParseEmail(t *testing.T) {
+	email, err := parseEmail(strings.NewReader(testEmail))
+	if err != nil {
+		t.Fatalf("parseEmail failed: %v", err)
+	}
+
+	if email.From != "Alice@Example.com" || email.Subject != "Café plans" || email.MessageID != "<m2@example.com>" {
+		t.Errorf("Unexpected headers: %+v", email)
+	}
+	if email.References != "<m0@example.com> <m1@example.com>" {
+		t.Errorf("Expected folded references to be joined, got %q", email.References)
+	}
+	if email.Text != "Shall we meet at the café?" {
+		t.Errorf("Expected the plain text body without the quoted reply, got %q", email.Text)
+	}
+	if len(email.Attachments) != 1 || email.Attachments[0].Filename != "menu.txt" || string(email.Attachments[0].Data) != "Coffee" {
+		t.Errorf("Expected the decoded attachment, got %+v", email.Attachments)
+	}
+
+	htmlOnly := "From: bob@example.com\r\nContent-Type: text/html\r\n\r\n<div>Hi &amp; bye</div><style>p{}</style>"
+	email, err = parseEmail(strings.NewReader(htmlOnly))
+	if err != nil {
+		t.Fatalf("parseEmail failed: %v", err)
+	}
+	if email.Text != "Hi & bye" {
+		t.Errorf("Expected text from the HTML body, got %q", email.Text)
+	}
+}
+
+func TestEmailInbound(t *testing.T) {
+	workspace := t.TempDir()
+	channel := NewEmailChannel(&config.EmailConfig{AllowFrom: []string{"alice@example.com"}})
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+	channel.SetMediaStore(media.NewStore(workspace, 0))
+
+	channel.handleEmail(&inboundEmail{From: "mallory@example.com", Text: "hi"})
+
+	email, err := parseEmail(strings.NewReader(testEmail))
+	if err != nil {
+		t.Fatalf("parseEmail failed: %v", err)
+	}
+	channel.handleEmail(email)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	if msg.SenderID != "Alice@Example.com" || msg.SessionKey != "email:alice@example.com" {
+		t.Errorf("Unexpected sender or session: %+v", msg)
+	}
+	if msg.Content != "Shall we meet at the café?" {
+		t.Errorf("Expected a reply's subject to be left out, got %q", msg.Content)
+	}
+	if len(msg.Media) != 1 {
+		t.Fatalf("Expected the attachment to be saved, got %v", msg.Media)
+	}
+	if data, err := os.ReadFile(msg.Media[0]); err != nil || string(data) != "Coffee" {
+		t.Errorf("Unexpected saved attachment: %q, %v", data, err)
+	}
+
+	// Replies continue the sender's thread, and each reply extends it
+	first := gomail.NewMessage()
+	channel.setThreadHeaders(first, "bot@example.com", "alice@example.com")
+	subject, _ := new(mime.WordDecoder).DecodeHeader(first.GetHeader("Subject")[0])
+	if subject != "Re: Café plans" {
+		t.Errorf("Unexpected subject: %q", subject)
+	}
+	if got := first.GetHeader("In-Reply-To"); len(got) != 1 || got[0] != "<m2@example.com>" {
+		t.Errorf("Unexpected In-Reply-To: %v", got)
+	}
+	if got := first.GetHeader("References"); len(got) != 1 || got[0] != "<m0@example.com> <m1@example.com> <m2@example.com>" {
+		t.Errorf("Unexpected References: %v", got)
+	}
+
+	second := gomail.NewMessage()
+	channel.setThreadHeaders(second, "bot@example.com", "alice@example.com")
+	if got := second.GetHeader("In-Reply-To"); len(got) != 1 || got[0] != first.GetHeader("Message-ID")[0] {
+		t.Errorf("Expected the second reply to follow the first, got %v", got)
+	}
+
+	fresh := gomail.NewMessage()
+	channel.setThreadHeaders(fresh, "bot@example.com", "carol@example.com")
+	if got := fresh.GetHeader("In-Reply-To"); len(got) != 0 {
+		t.Errorf("Expected no thread for a new recipient, got %v", got)
+	}
+}
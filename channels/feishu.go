@@ -4,13 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
 
 	lark "github.com/larksuite/oapi-sdk-go/v3"
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+	"github.com/larksuite/oapi-sdk-go/v3/core/httpserverext"
+	larkevent "github.com/larksuite/oapi-sdk-go/v3/event"
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher"
 	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+
+	"nanotalon/bus"
+	"nanotalon/logging"
 )
 
-// FeishuChannel implements the Feishu channel
+// FeishuChannel implements the Feishu channel. Message events are posted by Feishu's event
+// subscription to the gateway at /webhooks/feishu; the bot answers direct messages and mentions.
 type FeishuChannel struct {
 	appID        string
 	appSecret    string
@@ -20,11 +31,17 @@ type FeishuChannel struct {
 	name         string
 	running      bool
 	larkClient   *lark.Client
+	botOpenID    string
+	webhook      http.HandlerFunc
+	messageBus   *bus.MessageBus
+
+	// Chats an allowed user wrote in, so replies reach them
+	activeChats sync.Map
 }
 
 // NewFeishuChannel creates a new Feishu channel
 func NewFeishuChannel(appID, appSecret, encryptKey, verification string, allowedChats []string) *FeishuChannel {
-	return &FeishuChannel{
+	fc := &FeishuChannel{
 		appID:        appID,
 		appSecret:    appSecret,
 		encryptKey:   encryptKey,
@@ -32,6 +49,17 @@ func NewFeishuChannel(appID, appSecret, encryptKey, verification string, allowed
 		allowedChats: allowedChats,
 		name:         "feishu",
 	}
+
+	// The dispatcher answers the URL verification challenge, decrypts events with the
+	// encrypt key and checks their signature
+	events := dispatcher.NewEventDispatcher(verification, encryptKey).OnP2MessageReceiveV1(fc.handleMessage)
+	fc.webhook = httpserverext.NewEventHandlerFunc(events, larkevent.WithLogLevel(larkcore.LogLevelError))
+	return fc
+}
+
+// SetMessageBus sets where incoming Feishu messages are published
+func (fc *FeishuChannel) SetMessageBus(messageBus *bus.MessageBus) {
+	fc.messageBus = messageBus
 }
 
 // Start starts the Feishu channel
@@ -47,19 +75,128 @@ func (fc *FeishuChannel) Start() error {
 	)
 
 	fc.larkClient = larkClient
+	if err := fc.fetchBotOpenID(); err != nil {
+		slog.Warn("Failed to get bot info, any mention in a group addresses the bot", logging.ChannelKey, fc.name, "error", err)
+	}
 	fc.running = true
-	log.Printf("Feishu channel started (using Lark OAPI SDK)")
+	slog.Info("Feishu channel started (using Lark OAPI SDK)", logging.ChannelKey, fc.name, "webhook", "/webhooks/"+fc.name)
+
+	return nil
+}
+
+// fetchBotOpenID looks up the bot's open_id, to tell mentions of the bot from other mentions
+func (fc *FeishuChannel) fetchBotOpenID() error {
+	resp, err := fc.larkClient.Get(context.Background(), "/open-apis/bot/v3/info", nil, larkcore.AccessTokenTypeTenant)
+	if err != nil {
+		return err
+	}
+
+	var info struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Bot  struct {
+			OpenID string `json:"open_id"`
+		} `json:"bot"`
+	}
+	if err := json.Unmarshal(resp.RawBody, &info); err != nil {
+		return fmt.Errorf("failed to decode bot info: %w", err)
+	}
+	if info.Code != 0 {
+		return fmt.Errorf("feishu API returned error: %s", info.Msg)
+	}
+	fc.botOpenID = info.Bot.OpenID
+	return nil
+}
+
+// ServeWebhook handles a request from Feishu's event subscription
+func (fc *FeishuChannel) ServeWebhook(w http.ResponseWriter, r *http.Request) {
+	if !fc.running {
+		http.Error(w, "feishu channel not running", http.StatusServiceUnavailable)
+		return
+	}
+	fc.webhook(w, r)
+}
+
+// handleMessage publishes a text message from an allowed user to the message bus
+func (fc *FeishuChannel) handleMessage(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
+	if fc.verification != "" && (event.EventV2Base == nil || event.EventV2Base.Header == nil || event.EventV2Base.Header.Token != fc.verification) {
+		return fmt.Errorf("feishu event verification token mismatch")
+	}
+	if event.Event == nil || event.Event.Message == nil || event.Event.Sender == nil {
+		return nil
+	}
+	message, sender := event.Event.Message, event.Event.Sender
+	if larkcore.StringValue(sender.SenderType) != "user" {
+		return nil
+	}
+
+	chatID := larkcore.StringValue(message.ChatId)
+	var senderID string
+	if sender.SenderId != nil {
+		senderID = larkcore.StringValue(sender.SenderId.OpenId)
+	}
+	if larkcore.StringValue(message.MessageType) != larkim.MsgTypeText {
+		slog.Info("Ignoring message, only text is supported", logging.ChannelKey, fc.name, "type", larkcore.StringValue(message.MessageType), "sender", senderID)
+		return nil
+	}
 
-	// In a real implementation, we would set up event handlers and webhook receivers
-	// For now, this is a functional implementation using Feishu API
+	var content struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal([]byte(larkcore.StringValue(message.Content)), &content); err != nil {
+		return nil
+	}
 
+	// Mentions appear in the text as keys like @_user_1; the bot's are dropped, others named
+	direct := larkcore.StringValue(message.ChatType) == "p2p"
+	addressed := direct
+	text := content.Text
+	for _, mention := range message.Mentions {
+		key := larkcore.StringValue(mention.Key)
+		if key == "" {
+			continue
+		}
+		var openID string
+		if mention.Id != nil {
+			openID = larkcore.StringValue(mention.Id.OpenId)
+		}
+		if openID == fc.botOpenID || fc.botOpenID == "" {
+			addressed = true
+			text = strings.ReplaceAll(text, key, "")
+			continue
+		}
+		text = strings.ReplaceAll(text, key, "@"+larkcore.StringValue(mention.Name))
+	}
+	text = strings.TrimSpace(text)
+	if !addressed || text == "" {
+		return nil
+	}
+
+	if !fc.isAllowed(senderID, chatID) {
+		slog.Info("Ignoring message, sender not in allow_from", logging.ChannelKey, fc.name, "sender", senderID, "chat", chatID)
+		return nil
+	}
+	if fc.messageBus == nil {
+		slog.Warn("No message bus, dropping message", logging.ChannelKey, fc.name, "sender", senderID)
+		return nil
+	}
+	fc.activeChats.Store(chatID, true)
+
+	fc.messageBus.PublishInbound(bus.InboundMessage{
+		Channel:    fc.name,
+		SenderID:   senderID,
+		ChatID:     chatID,
+		Content:    text,
+		SessionKey: fmt.Sprintf("%s:%s", fc.name, chatID),
+		Metadata:   map[string]interface{}{bus.MetadataMessageID: larkcore.StringValue(message.MessageId)},
+	})
 	return nil
 }
 
 // Stop stops the Feishu channel
 func (fc *FeishuChannel) Stop() error {
 	fc.running = false
-	log.Printf("Feishu channel stopped")
+	slog.Info("Feishu channel stopped", logging.ChannelKey, fc.name)
 	return nil
 }
 
@@ -74,7 +211,7 @@ func (fc *FeishuChannel) Send(chatID, message string) error {
 		return fmt.Errorf("feishu channel not running")
 	}
 
-	if !fc.isAllowed(chatID) {
+	if !fc.isAllowed(chatID) && !fc.isActiveChat(chatID) {
 		return fmt.Errorf("chat %s not allowed", chatID)
 	}
 
@@ -91,6 +228,7 @@ func (fc *FeishuChannel) Send(chatID, message string) error {
 	// Make the API call - simplified approach
 	resp, err := fc.larkClient.Im.Message.Create(context.Background(),
 		larkim.NewCreateMessageReqBuilder().
+			ReceiveIdType(larkim.ReceiveIdTypeChatId).
 			Body(larkim.NewCreateMessageReqBodyBuilder().
 				ReceiveId(chatID).
 				MsgType(larkim.MsgTypeText).
@@ -106,23 +244,18 @@ func (fc *FeishuChannel) Send(chatID, message string) error {
 		return fmt.Errorf("feishu API returned error: %s", resp.CodeError.Msg)
 	}
 
-	log.Printf("Feishu message sent successfully to %s, message id: %s", chatID, *resp.Data.MessageId)
+	slog.Debug("Message sent", logging.ChannelKey, fc.name, "chat", chatID, "message_id", *resp.Data.MessageId)
 
 	return nil
 }
 
-// isAllowed checks if a chat is allowed
-func (fc *FeishuChannel) isAllowed(chatID string) bool {
-	if len(fc.allowedChats) == 0 {
-		// If no allowed chats specified, allow all
-		return true
-	}
-
-	for _, allowed := range fc.allowedChats {
-		if allowed == chatID {
-			return true
-		}
-	}
+// isAllowed checks if any of a user or chat ID is in allow_from
+func (fc *FeishuChannel) isAllowed(ids ...string) bool {
+	return allowFromMatches(fc.allowedChats, true, ids...)
+}
 
-	return false
+// isActiveChat reports whether an allowed user has written in a chat
+func (fc *FeishuChannel) isActiveChat(chatID string) bool {
+	_, ok := fc.activeChats.Load(chatID)
+	return ok
 }
@@ -0,0 +1,121 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	larkevent "github.com/larksuite/oapi-sdk-go/v3/event"
+
+	"nanotalon/bus"
+)
+
+// feishuRequest encrypts and signs an event the way Feishu's event subscription does
+func feishuRequest(t *testing.T, encryptKey string, event string) *http.Request {
+	key := sha256.Sum256([]byte(encryptKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatalf("NewCipher failed: %v", err)
+	}
+	padding := aes.BlockSize - len(event)%aes.BlockSize
+	plain := append([]byte(event), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	iv := bytes.Repeat([]byte{7}, aes.BlockSize)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+
+	body, _ := json.Marshal(map[string]string{"encrypt": base64.StdEncoding.EncodeToString(append(iv, encrypted...))})
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/feishu", bytes.NewReader(body))
+	req.Header.Set(larkevent.EventRequestTimestamp, "1700000000")
+	req.Header.Set(larkevent.EventRequestNonce, "nonce")
+	req.Header.Set(larkevent.EventSignature, larkevent.Signature("1700000000", "nonce", encryptKey, string(body)))
+	return req
+}
+
+// feishuMessageEvent is a message event with the given token, chat type and text, where
+// @_user_1 mentions the bot and @_user_2 Bob
+func feishuMessageEvent(token, chatType, text string) string {
+	content, _ := json.Marshal(map[string]string{"text": text})
+	var mentions []map[string]interface{}
+	if strings.Contains(text, "@_user_1") {
+		mentions = append(mentions, map[string]interface{}{"key": "@_user_1", "id": map[string]string{"open_id": "ou_bot"}, "name": "Talon"})
+	}
+	if strings.Contains(text, "@_user_2") {
+		mentions = append(mentions, map[string]interface{}{"key": "@_user_2", "id": map[string]string{"open_id": "ou_bob"}, "name": "Bob"})
+	}
+	event, _ := json.Marshal(map[string]interface{}{
+		"schema": "2.0",
+		"header": map[string]string{"event_id": "e1", "event_type": "im.message.receive_v1", "token": token},
+		"event": map[string]interface{}{
+			"sender": map[string]interface{}{"sender_id": map[string]string{"open_id": "ou_alice"}, "sender_type": "user"},
+			"message": map[string]interface{}{
+				"message_id":   "om_1",
+				"chat_id":      "oc_team",
+				"chat_type":    chatType,
+				"message_type": "text",
+				"content":      string(content),
+				"mentions":     mentions,
+			},
+		},
+	})
+	return string(event)
+}
+
+func TestFeishuWebhook(t *testing.T) {
+	channel := NewFeishuChannel("app", "secret", "encrypt-key", "verify-token", []string{"ou_alice"})
+	channel.botOpenID = "ou_bot"
+	channel.running = true
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+
+	// URL verification echoes the challenge
+	recorder := httptest.NewRecorder()
+	channel.ServeWebhook(recorder, feishuRequest(t, "encrypt-key", `{"type": "url_verification", "challenge": "abc", "token": "verify-token"}`))
+	if !strings.Contains(recorder.Body.String(), `"abc"`) {
+		t.Errorf("Expected the challenge to be echoed, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	// Forged signatures and tokens are rejected
+	forged := feishuRequest(t, "encrypt-key", feishuMessageEvent("verify-token", "group", "@_user_1 forged"))
+	forged.Header.Set(larkevent.EventSignature, "0000")
+	recorder = httptest.NewRecorder()
+	channel.ServeWebhook(recorder, forged)
+	if recorder.Code == http.StatusOK {
+		t.Error("Expected a request with a bad signature to be rejected")
+	}
+	recorder = httptest.NewRecorder()
+	channel.ServeWebhook(recorder, feishuRequest(t, "encrypt-key", feishuMessageEvent("wrong-token", "group", "@_user_1 forged")))
+	if recorder.Code == http.StatusOK {
+		t.Error("Expected an event with the wrong verification token to be rejected")
+	}
+
+	// Group messages that don't mention the bot are ignored
+	recorder = httptest.NewRecorder()
+	channel.ServeWebhook(recorder, feishuRequest(t, "encrypt-key", feishuMessageEvent("verify-token", "group", "@_user_2 lunch?")))
+	recorder = httptest.NewRecorder()
+	channel.ServeWebhook(recorder, feishuRequest(t, "encrypt-key", feishuMessageEvent("verify-token", "group", "@_user_1 ask @_user_2 about the release")))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected the event to be accepted, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	if msg.Content != "ask @Bob about the release" || msg.ChatID != "oc_team" || msg.SenderID != "ou_alice" {
+		t.Errorf("Unexpected inbound message: %+v", msg)
+	}
+	if msg.Metadata[bus.MetadataMessageID] != "om_1" {
+		t.Errorf("Expected the message ID in metadata, got %v", msg.Metadata)
+	}
+}
@@ -0,0 +1,103 @@
+package channels
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// maxGroupContextChars caps each remembered group message
+const maxGroupContextChars = 500
+
+// GroupPolicy decides when the bot answers in group chats
+type GroupPolicy struct {
+	RequireMention  bool // Only answer when mentioned or replied to
+	ContextMessages int  // Recent group messages sent along with one the bot answers
+}
+
+// defaultGroupPolicy applies until the manager sets the configured one
+var defaultGroupPolicy = GroupPolicy{RequireMention: true, ContextMessages: 10}
+
+// GroupReceiver is implemented by channels that tell group chats from direct messages
+type GroupReceiver interface {
+	// SetGroupPolicy sets when the channel answers in group chats
+	SetGroupPolicy(policy GroupPolicy)
+}
+
+// groupChats applies a channel's group policy and remembers recent messages of its group
+// chats that the bot didn't answer, so they can go along with the next one it does
+type groupChats struct {
+	mu     sync.Mutex
+	policy GroupPolicy
+	recent map[string][]string
+}
+
+// newGroupChats creates group chat state with the default policy
+func newGroupChats() *groupChats {
+	return &groupChats{policy: defaultGroupPolicy, recent: make(map[string][]string)}
+}
+
+// setPolicy replaces the policy
+func (g *groupChats) setPolicy(policy GroupPolicy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policy = policy
+}
+
+// answers reports whether the bot answers a group message
+func (g *groupChats) answers(addressed bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return addressed || !g.policy.RequireMention
+}
+
+// remember records a group message the bot doesn't answer, keeping the latest few per chat
+func (g *groupChats) remember(chatID, sender, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	if runes := []rune(text); len(runes) > maxGroupContextChars {
+		text = string(runes[:maxGroupContextChars]) + "…"
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.policy.ContextMessages <= 0 {
+		return
+	}
+	lines := append(g.recent[chatID], fmt.Sprintf("%s: %s", sender, text))
+	if len(lines) > g.policy.ContextMessages {
+		lines = lines[len(lines)-g.policy.ContextMessages:]
+	}
+	g.recent[chatID] = lines
+}
+
+// withContext puts the messages remembered for a chat before content and forgets them; once
+// sent they are part of the session's history
+func (g *groupChats) withContext(chatID, content string) string {
+	g.mu.Lock()
+	lines := g.recent[chatID]
+	delete(g.recent, chatID)
+	g.mu.Unlock()
+
+	if len(lines) == 0 {
+		return content
+	}
+	return fmt.Sprintf("[Earlier in this chat:\n%s]\n%s", strings.Join(lines, "\n"), content)
+}
+
+// SetGroupPolicy sets when the bot answers in Telegram groups
+func (tc *TelegramChannel) SetGroupPolicy(policy GroupPolicy) {
+	tc.groups.setPolicy(policy)
+}
+
+// SetGroupPolicy sets when the bot answers in Discord servers
+func (dc *DiscordChannel) SetGroupPolicy(policy GroupPolicy) {
+	dc.groups.setPolicy(policy)
+}
+
+// SetGroupPolicy sets when the bot answers in Slack channels
+func (sc *SlackChannel) SetGroupPolicy(policy GroupPolicy) {
+	sc.groups.setPolicy(policy)
+}
@@ -0,0 +1,98 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/slack-go/slack/slackevents"
+
+	"nanotalon/bus"
+)
+
+func TestDiscordGroupMessages(t *testing.T) {
+	channel := NewDiscordChannel("fake-token", []string{"alice", "mention:*"})
+	channel.botUserID = "BOT"
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+
+	alice := &discordgo.User{ID: "U1", Username: "alice"}
+	bob := &discordgo.User{ID: "U2", Username: "bob"}
+	bot := &discordgo.User{ID: "BOT", Username: "talon", Bot: true}
+
+	channel.handleMessage(&discordgo.Message{ID: "1", GuildID: "G", ChannelID: "C1", Author: alice, Content: "the build is red"})
+	channel.handleMessage(&discordgo.Message{ID: "2", GuildID: "G", ChannelID: "C1", Author: bob, Content: "not me"})
+	channel.handleMessage(&discordgo.Message{ID: "3", GuildID: "G", ChannelID: "C1", Author: bob, Content: "<@BOT> why?", Mentions: []*discordgo.User{bot}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	// bob is only allowed when addressing the bot, so only alice's message is context
+	if msg.Content != "[Earlier in this chat:\nalice: the build is red]\nwhy?" || msg.SessionKey != "discord:C1" || msg.SenderID != "U2" {
+		t.Errorf("Unexpected inbound message: %+v", msg)
+	}
+
+	// Replies to the bot address it; DMs always do
+	channel.handleMessage(&discordgo.Message{ID: "4", GuildID: "G", ChannelID: "C1", Author: alice, Content: "thanks", ReferencedMessage: &discordgo.Message{Author: bot}})
+	if msg, err = messageBus.ConsumeInboundContext(ctx); err != nil || msg.Content != "thanks" {
+		t.Errorf("Expected the reply to the bot, got %q, %v", msg.Content, err)
+	}
+	channel.handleMessage(&discordgo.Message{ID: "5", ChannelID: "D1", Author: alice, Content: "hi"})
+	if msg, err = messageBus.ConsumeInboundContext(ctx); err != nil || msg.ChatID != "D1" {
+		t.Errorf("Expected the DM, got %+v, %v", msg, err)
+	}
+
+	// With mentions not required, every message is answered
+	channel.SetGroupPolicy(GroupPolicy{RequireMention: false})
+	channel.handleMessage(&discordgo.Message{ID: "6", GuildID: "G", ChannelID: "C1", Author: alice, Content: "status?"})
+	if msg, err = messageBus.ConsumeInboundContext(ctx); err != nil || msg.Content != "status?" {
+		t.Errorf("Expected the message to be answered, got %q, %v", msg.Content, err)
+	}
+}
+
+func TestSlackChannelMessages(t *testing.T) {
+	channel := NewSlackChannel("xoxb-test", "xapp-test", nil)
+	channel.botUserID = "UBOT"
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+
+	// A channel message is context for the mention that starts a thread
+	channel.handleChannelMessage(&slackevents.MessageEvent{User: "U1", Channel: "C1", Text: "prod is slow", TimeStamp: "1.1"})
+	channel.handleChannelMessage(&slackevents.MessageEvent{User: "U2", Channel: "C1", Text: "<@UBOT> look into it", TimeStamp: "1.2"})
+	channel.handleMessage("U2", "C1", "<@UBOT> look into it", "1.2", "1.2", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	if msg.Content != "[Earlier in this chat:\n<@U1>: prod is slow]\nlook into it" || msg.ChatID != "C1/1.2" {
+		t.Errorf("Unexpected inbound message: %+v", msg)
+	}
+
+	// Replies in that thread address the bot without a mention; other threads don't
+	channel.handleChannelMessage(&slackevents.MessageEvent{User: "U3", Channel: "C1", Text: "unrelated", TimeStamp: "2.1", ThreadTimeStamp: "2.0"})
+	channel.handleChannelMessage(&slackevents.MessageEvent{User: "U1", Channel: "C1", Text: "any update?", TimeStamp: "1.3", ThreadTimeStamp: "1.2"})
+	if msg, err = messageBus.ConsumeInboundContext(ctx); err != nil || msg.Content != "any update?" || msg.ChatID != "C1/1.2" {
+		t.Errorf("Expected the thread reply, got %+v, %v", msg, err)
+	}
+}
+
+func TestGroupChatsContextLimit(t *testing.T) {
+	groups := newGroupChats()
+	groups.setPolicy(GroupPolicy{RequireMention: true, ContextMessages: 2})
+	for _, text := range []string{"one", "two", "three"} {
+		groups.remember("C", "alice", text)
+	}
+	if got := groups.withContext("C", "four"); got != "[Earlier in this chat:\nalice: two\nalice: three]\nfour" {
+		t.Errorf("Expected the latest two messages, got %q", got)
+	}
+	if groups.answers(false) || !groups.answers(true) {
+		t.Error("Expected only addressed messages to be answered")
+	}
+}
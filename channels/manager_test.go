@@ -1,6 +1,7 @@
 package channels_test
 
 import (
+	"strings"
 	"testing"
 	"nanotalon/channels"
 	"nanotalon/config"
@@ -97,4 +98,135 @@ func (mc *mockChannel) Name() string {
 func (mc *mockChannel) Send(chatID, message string) error {
 	// Simulate sending a message
 	return nil
-}
\ No newline at end of file
+}
+// recordingChannel records what it was asked to send
+type recordingChannel struct {
+	mockChannel
+	sent     []string
+	attached []string
+}
+
+func (rc *recordingChannel) Send(chatID, message string) error {
+	rc.sent = append(rc.sent, message)
+	return nil
+}
+
+// filesChannel can send attachments
+type filesChannel struct {
+	recordingChannel
+}
+
+func (fc *filesChannel) SendAttachments(chatID, message string, paths []string) error {
+	fc.sent = append(fc.sent, message)
+	fc.attached = append(fc.attached, paths...)
+	return nil
+}
+
+func TestSendWithAttachments(t *testing.T) {
+	manager := channels.NewManager(&config.Config{})
+	plain := &recordingChannel{mockChannel: mockChannel{name: "plain"}}
+	files := &filesChannel{recordingChannel{mockChannel: mockChannel{name: "files"}}}
+	manager.Register(plain)
+	manager.Register(files)
+
+	if err := manager.SendWithAttachments("files", "1", "report", []string{"/ws/report.pdf"}); err != nil {
+		t.Fatalf("SendWithAttachments failed: %v", err)
+	}
+	if len(files.attached) != 1 || files.attached[0] != "/ws/report.pdf" || files.sent[0] != "report" {
+		t.Errorf("Expected the file to be sent as an attachment, got %v %v", files.sent, files.attached)
+	}
+
+	if err := manager.SendWithAttachments("plain", "1", "report", []string{"/ws/report.pdf"}); err != nil {
+		t.Fatalf("SendWithAttachments failed: %v", err)
+	}
+	if len(plain.sent) != 1 || !strings.Contains(plain.sent[0], "report\n\nFiles can't be sent here") || !strings.Contains(plain.sent[0], "- /ws/report.pdf") {
+		t.Errorf("Expected the file to be listed in the message, got %q", plain.sent)
+	}
+}
+
+func TestReload(t *testing.T) {
+	cfg := &config.Config{
+		Channels: config.ChannelsConfig{
+			Telegram: config.TelegramConfig{Enabled: true, Token: "old-token"},
+			Discord:  config.DiscordConfig{Enabled: true, Token: "discord-token"},
+		},
+	}
+	manager := channels.NewManager(cfg)
+	telegram, _ := manager.Get("telegram")
+	discord, _ := manager.Get("discord")
+
+	// Rotate the Telegram token and enable Slack; Discord is unchanged
+	changed := *cfg
+	changed.Channels.Telegram.Token = "new-token"
+	changed.Channels.Slack = config.SlackConfig{Enabled: true, BotToken: "xoxb", AppToken: "xapp"}
+	if err := manager.Reload(&changed); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if channel, _ := manager.Get("telegram"); channel == telegram {
+		t.Error("Expected the Telegram channel to be recreated with the new token")
+	}
+	if channel, _ := manager.Get("discord"); channel != discord {
+		t.Error("Expected the unchanged Discord channel to be kept")
+	}
+	if _, exists := manager.Get("slack"); !exists {
+		t.Error("Expected the newly enabled Slack channel")
+	}
+
+	disabled := changed
+	disabled.Channels.Telegram.Enabled = false
+	if err := manager.Reload(&disabled); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if _, exists := manager.Get("telegram"); exists {
+		t.Error("Expected the disabled Telegram channel to be removed")
+	}
+	if len(manager.GetEnabledChannels()) != 2 {
+		t.Errorf("Expected Discord and Slack, got %v", manager.GetEnabledChannels())
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	manager := channels.NewManager(&config.Config{})
+	ops := &recordingChannel{mockChannel: mockChannel{name: "ops"}}
+	manager.Register(ops)
+
+	targets := []channels.Target{{Channel: "ops", ChatID: "1"}, {Channel: "missing", ChatID: "2"}, {Channel: "ops", ChatID: "3"}}
+	err := manager.Broadcast("maintenance at 18:00", targets)
+	if err == nil || !strings.Contains(err.Error(), "missing:2") {
+		t.Errorf("Expected an error naming the missing target, got %v", err)
+	}
+	if len(ops.sent) != 2 {
+		t.Errorf("Expected the other targets to still get the message, got %q", ops.sent)
+	}
+
+	if target, err := channels.ParseTarget("slack:C123/1700000000.000100"); err != nil || target.Channel != "slack" || target.ChatID != "C123/1700000000.000100" {
+		t.Errorf("Unexpected target %+v, %v", target, err)
+	}
+	if _, err := channels.ParseTarget("telegram"); err == nil {
+		t.Error("Expected an error for a target without a chat ID")
+	}
+}
+
+func TestSendWithFallback(t *testing.T) {
+	manager := channels.NewManager(&config.Config{})
+	ops := &recordingChannel{mockChannel: mockChannel{name: "ops"}}
+	manager.Register(ops)
+
+	// The first target that accepts the message is the only one to get it
+	targets := []channels.Target{{Channel: "missing", ChatID: "1"}, {Channel: "ops", ChatID: "2"}, {Channel: "ops", ChatID: "3"}}
+	if err := manager.SendWithFallback("reminder", targets); err != nil {
+		t.Fatalf("Expected the fallback target to accept the message, got %v", err)
+	}
+	if len(ops.sent) != 1 {
+		t.Errorf("Expected the message to be sent once, got %q", ops.sent)
+	}
+
+	err := manager.SendWithFallback("reminder", []channels.Target{{Channel: "missing", ChatID: "1"}, {Channel: "gone", ChatID: "2"}})
+	if err == nil || !strings.Contains(err.Error(), "missing:1") || !strings.Contains(err.Error(), "gone:2") {
+		t.Errorf("Expected an error naming every target, got %v", err)
+	}
+	if err := manager.SendWithFallback("reminder", nil); err == nil {
+		t.Error("Expected an error without targets")
+	}
+}
@@ -0,0 +1,284 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"nanotalon/bus"
+	"nanotalon/logging"
+)
+
+// MattermostChannel implements the Mattermost channel. Events arrive over the websocket
+// API; the bot answers direct messages and mentions, replying in the thread.
+type MattermostChannel struct {
+	serverURL    string
+	token        string
+	allowedChats []string
+	name         string
+	running      bool
+	httpClient   *http.Client
+	botUserID    string
+	botUsername  string
+	cancel       context.CancelFunc
+	messageBus   *bus.MessageBus
+
+	// Channels an allowed user wrote in, so replies reach them
+	activeChats sync.Map
+}
+
+// mattermostPost is the part of a Mattermost post the channel uses
+type mattermostPost struct {
+	ID        string `json:"id,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	ChannelID string `json:"channel_id"`
+	RootID    string `json:"root_id,omitempty"`
+	Message   string `json:"message"`
+}
+
+// NewMattermostChannel creates a new Mattermost channel for a server URL and bot access token
+func NewMattermostChannel(serverURL, token string, allowedChats []string) *MattermostChannel {
+	return &MattermostChannel{
+		serverURL:    strings.TrimRight(serverURL, "/"),
+		token:        token,
+		allowedChats: allowedChats,
+		name:         "mattermost",
+		running:      false,
+		httpClient:   &http.Client{},
+	}
+}
+
+// SetMessageBus sets where incoming Mattermost messages are published
+func (mc *MattermostChannel) SetMessageBus(messageBus *bus.MessageBus) {
+	mc.messageBus = messageBus
+}
+
+// Start starts the Mattermost channel
+func (mc *MattermostChannel) Start() error {
+	if mc.serverURL == "" || mc.token == "" {
+		return fmt.Errorf("mattermost url and token must be configured")
+	}
+
+	var me struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := mc.api(http.MethodGet, "/api/v4/users/me", nil, &me); err != nil {
+		return fmt.Errorf("failed to authenticate with mattermost: %w", err)
+	}
+	mc.botUserID, mc.botUsername = me.ID, me.Username
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mc.cancel = cancel
+	mc.running = true
+	go runReconnecting(ctx, "Mattermost", mc.listen)
+
+	slog.Info("Mattermost channel started", logging.ChannelKey, mc.name, "user", me.Username)
+	return nil
+}
+
+// listen reads events from one websocket connection until it drops or ctx is cancelled
+func (mc *MattermostChannel) listen(ctx context.Context) error {
+	wsURL, err := websocketURL(mc.serverURL, "/api/v4/websocket")
+	if err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, http.Header{"Authorization": {"Bearer " + mc.token}})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	challenge := map[string]interface{}{
+		"seq":    1,
+		"action": "authentication_challenge",
+		"data":   map[string]string{"token": mc.token},
+	}
+	if err := conn.WriteJSON(challenge); err != nil {
+		return err
+	}
+
+	for {
+		var event struct {
+			Event string                 `json:"event"`
+			Data  map[string]interface{} `json:"data"`
+		}
+		if err := conn.ReadJSON(&event); err != nil {
+			return err
+		}
+		if event.Event == "posted" {
+			mc.handlePosted(event.Data)
+		}
+	}
+}
+
+// handlePosted publishes a post from an allowed user that is a direct message or mentions
+// the bot. The chat ID is "<channel>/<root post>" for threads, and each thread is its own session.
+func (mc *MattermostChannel) handlePosted(data map[string]interface{}) {
+	postJSON, _ := data["post"].(string)
+	var post mattermostPost
+	if err := json.Unmarshal([]byte(postJSON), &post); err != nil || post.UserID == mc.botUserID {
+		return
+	}
+
+	channelType, _ := data["channel_type"].(string)
+	mentions, _ := data["mentions"].(string)
+	direct := channelType == "D"
+	if !direct && (mc.botUserID == "" || !strings.Contains(mentions, mc.botUserID)) {
+		return
+	}
+
+	senderName, _ := data["sender_name"].(string)
+	senderName = strings.TrimPrefix(senderName, "@")
+	if !mc.isAllowed(post.UserID, senderName, post.ChannelID) {
+		slog.Info("Ignoring message, sender not in allow_from", logging.ChannelKey, mc.name, "sender", senderName, "chat", post.ChannelID)
+		return
+	}
+	if mc.messageBus == nil {
+		slog.Warn("No message bus, dropping message", logging.ChannelKey, mc.name, "sender", senderName)
+		return
+	}
+	mc.activeChats.Store(post.ChannelID, true)
+
+	text := post.Message
+	if mc.botUsername != "" {
+		text = strings.TrimSpace(strings.ReplaceAll(text, "@"+mc.botUsername, ""))
+	}
+	if text == "" {
+		return
+	}
+
+	// Mentions in channels start a thread under the post; DMs only stay in a thread they are in
+	rootID := post.RootID
+	if rootID == "" && !direct {
+		rootID = post.ID
+	}
+	chatID := post.ChannelID
+	if rootID != "" {
+		chatID += "/" + rootID
+	}
+
+	mc.messageBus.PublishInbound(bus.InboundMessage{
+		Channel:    mc.name,
+		SenderID:   post.UserID,
+		ChatID:     chatID,
+		Content:    text,
+		SessionKey: fmt.Sprintf("%s:%s", mc.name, chatID),
+		Metadata:   map[string]interface{}{"username": senderName, bus.MetadataMessageID: post.ID},
+	})
+}
+
+// Stop stops the Mattermost channel
+func (mc *MattermostChannel) Stop() error {
+	if mc.cancel != nil {
+		mc.cancel()
+	}
+	mc.running = false
+	slog.Info("Mattermost channel stopped", logging.ChannelKey, mc.name)
+	return nil
+}
+
+// Name returns the channel name
+func (mc *MattermostChannel) Name() string {
+	return mc.name
+}
+
+// Send posts a message to a Mattermost channel, or to a thread when chatID is "<channel>/<root post>"
+func (mc *MattermostChannel) Send(chatID, message string) error {
+	if !mc.running {
+		return fmt.Errorf("mattermost channel not running")
+	}
+
+	channelID, rootID, _ := strings.Cut(chatID, "/")
+	if !mc.isAllowed(channelID) && !mc.isActiveChat(channelID) {
+		return fmt.Errorf("channel %s not allowed", channelID)
+	}
+
+	post := mattermostPost{ChannelID: channelID, RootID: rootID, Message: message}
+	if err := mc.api(http.MethodPost, "/api/v4/posts", post, nil); err != nil {
+		return fmt.Errorf("failed to send mattermost message: %w", err)
+	}
+	return nil
+}
+
+// SendTyping shows the bot as typing in a Mattermost channel or thread
+func (mc *MattermostChannel) SendTyping(chatID string) error {
+	if !mc.running {
+		return fmt.Errorf("mattermost channel not running")
+	}
+
+	channelID, rootID, _ := strings.Cut(chatID, "/")
+	typing := map[string]string{"channel_id": channelID, "parent_id": rootID}
+	if err := mc.api(http.MethodPost, "/api/v4/users/me/typing", typing, nil); err != nil {
+		return fmt.Errorf("failed to send typing indicator: %w", err)
+	}
+	return nil
+}
+
+// MarkRead marks a Mattermost channel as viewed by the bot, up to its latest post
+func (mc *MattermostChannel) MarkRead(chatID, messageID string) error {
+	if !mc.running {
+		return fmt.Errorf("mattermost channel not running")
+	}
+
+	channelID, _, _ := strings.Cut(chatID, "/")
+	if err := mc.api(http.MethodPost, "/api/v4/channels/members/me/view", map[string]string{"channel_id": channelID}, nil); err != nil {
+		return fmt.Errorf("failed to mark channel read: %w", err)
+	}
+	return nil
+}
+
+// api calls the Mattermost REST API, decoding the response into out if it isn't nil
+func (mc *MattermostChannel) api(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, mc.serverURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+mc.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := mc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("mattermost API returned error (status: %d): %s", resp.StatusCode, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// isAllowed checks if any of a user, username or channel ID is in allow_from
+func (mc *MattermostChannel) isAllowed(ids ...string) bool {
+	return allowFromMatches(mc.allowedChats, true, ids...)
+}
+
+// isActiveChat reports whether an allowed user has written in a channel
+func (mc *MattermostChannel) isActiveChat(channelID string) bool {
+	_, ok := mc.activeChats.Load(channelID)
+	return ok
+}
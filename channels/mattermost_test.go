@@ -0,0 +1,80 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"nanotalon/bus"
+)
+
+func TestMattermostChannel(t *testing.T) {
+	posts := make(chan mattermostPost, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v4/users/me":
+			json.NewEncoder(w).Encode(map[string]string{"id": "bot1", "username": "talon"})
+		case "/api/v4/websocket":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			var challenge map[string]interface{}
+			if conn.ReadJSON(&challenge) != nil || challenge["action"] != "authentication_challenge" {
+				return
+			}
+			post, _ := json.Marshal(mattermostPost{ID: "p1", UserID: "u1", ChannelID: "c1", Message: "@talon what's new?"})
+			conn.WriteJSON(map[string]interface{}{
+				"event": "posted",
+				"data":  map[string]interface{}{"post": string(post), "channel_type": "O", "mentions": `["bot1"]`, "sender_name": "@bob"},
+			})
+			conn.ReadMessage() // Hold the connection open until the client closes it
+		case "/api/v4/posts":
+			var post mattermostPost
+			json.NewDecoder(r.Body).Decode(&post)
+			posts <- post
+		}
+	}))
+	defer server.Close()
+
+	channel := NewMattermostChannel(server.URL, "test-token", []string{"@bob"})
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+	if err := channel.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer channel.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	if msg.Content != "what's new?" || msg.ChatID != "c1/p1" || msg.SessionKey != "mattermost:c1/p1" {
+		t.Errorf("Unexpected inbound message: %+v", msg)
+	}
+
+	if err := channel.Send(msg.ChatID, "Not much."); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	select {
+	case post := <-posts:
+		if post.ChannelID != "c1" || post.RootID != "p1" || post.Message != "Not much." {
+			t.Errorf("Expected the reply in the thread, got %+v", post)
+		}
+	case <-ctx.Done():
+		t.Fatal("Reply was not posted")
+	}
+}
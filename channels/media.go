@@ -0,0 +1,127 @@
+package channels
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/slack-go/slack/slackevents"
+
+	"nanotalon/logging"
+	"nanotalon/media"
+)
+
+// MediaReceiver is implemented by channels that download attachments of incoming messages;
+// the saved paths go in bus.InboundMessage.Media
+type MediaReceiver interface {
+	SetMediaStore(store *media.Store)
+}
+
+// SetMediaStore sets where Telegram attachments are saved
+func (tc *TelegramChannel) SetMediaStore(store *media.Store) {
+	tc.media = store
+}
+
+// downloadAttachments saves the photo, document, voice note, audio or video of a message
+func (tc *TelegramChannel) downloadAttachments(message *tgbotapi.Message) []string {
+	if tc.media == nil || tc.bot == nil {
+		return nil
+	}
+
+	var downloads []media.Download
+	if n := len(message.Photo); n > 0 {
+		// Sizes are listed smallest first
+		downloads = append(downloads, media.Download{URL: message.Photo[n-1].FileID, Filename: "photo.jpg", MimeType: "image/jpeg"})
+	}
+	if d := message.Document; d != nil {
+		downloads = append(downloads, media.Download{URL: d.FileID, Filename: d.FileName, MimeType: d.MimeType})
+	}
+	if v := message.Voice; v != nil {
+		downloads = append(downloads, media.Download{URL: v.FileID, Filename: "voice.ogg", MimeType: v.MimeType})
+	}
+	if a := message.Audio; a != nil {
+		downloads = append(downloads, media.Download{URL: a.FileID, Filename: a.FileName, MimeType: a.MimeType})
+	}
+	if v := message.Video; v != nil {
+		downloads = append(downloads, media.Download{URL: v.FileID, Filename: v.FileName, MimeType: v.MimeType})
+	}
+
+	// Telegram identifies files by ID; the download URL is looked up just before fetching
+	for i := range downloads {
+		url, err := tc.bot.GetFileDirectURL(downloads[i].URL)
+		if err != nil {
+			slog.Warn("Could not look up attachment", logging.ChannelKey, tc.name, "file", downloads[i].Filename, "error", err)
+			downloads[i].URL = ""
+			continue
+		}
+		downloads[i].URL = url
+	}
+	return saveAttachments(tc.media, tc.name, downloads)
+}
+
+// SetMediaStore sets where Discord attachments are saved
+func (dc *DiscordChannel) SetMediaStore(store *media.Store) {
+	dc.media = store
+}
+
+// downloadAttachments saves the attachments of a Discord message
+func (dc *DiscordChannel) downloadAttachments(message *discordgo.Message) []string {
+	if dc.media == nil {
+		return nil
+	}
+
+	downloads := make([]media.Download, 0, len(message.Attachments))
+	for _, attachment := range message.Attachments {
+		downloads = append(downloads, media.Download{
+			URL:      attachment.URL,
+			Filename: attachment.Filename,
+			MimeType: attachment.ContentType,
+		})
+	}
+	return saveAttachments(dc.media, dc.name, downloads)
+}
+
+// SetMediaStore sets where Slack files are saved
+func (sc *SlackChannel) SetMediaStore(store *media.Store) {
+	sc.media = store
+}
+
+// downloadFiles saves files shared in a Slack message; private file URLs need the bot token
+func (sc *SlackChannel) downloadFiles(files []slackevents.File) []string {
+	if sc.media == nil {
+		return nil
+	}
+
+	header := http.Header{"Authorization": {"Bearer " + sc.botToken}}
+	downloads := make([]media.Download, 0, len(files))
+	for _, file := range files {
+		downloads = append(downloads, media.Download{
+			URL:      file.URLPrivateDownload,
+			Filename: file.Name,
+			MimeType: file.Mimetype,
+			Header:   header,
+		})
+	}
+	return saveAttachments(sc.media, sc.name, downloads)
+}
+
+// saveAttachments downloads attachments into the store and returns the saved paths.
+// Attachments that fail are logged and left out, so the message still goes through.
+func saveAttachments(store *media.Store, channel string, downloads []media.Download) []string {
+	var paths []string
+	for _, download := range downloads {
+		if download.URL == "" {
+			continue
+		}
+		download.Channel = channel
+		path, err := store.Download(context.Background(), download)
+		if err != nil {
+			slog.Warn("Could not save attachment", logging.ChannelKey, channel, "file", download.Filename, "error", err)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+
+	"nanotalon/logging"
 )
 
 // MochatChannel implements the Mochat channel
@@ -38,7 +40,7 @@ func (mc *MochatChannel) Start() error {
 	}
 
 	mc.running = true
-	log.Printf("Mochat channel started (endpoint: %s)", mc.baseURL)
+	slog.Info("Mochat channel started", logging.ChannelKey, mc.name, "endpoint", mc.baseURL)
 
 	return nil
 }
@@ -46,7 +48,7 @@ func (mc *MochatChannel) Start() error {
 // Stop stops the Mochat channel
 func (mc *MochatChannel) Stop() error {
 	mc.running = false
-	log.Printf("Mochat channel stopped")
+	slog.Info("Mochat channel stopped", logging.ChannelKey, mc.name)
 	return nil
 }
 
@@ -105,7 +107,7 @@ func (mc *MochatChannel) Send(chatID, message string) error {
 	}
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		log.Printf("Mochat message sent successfully to %s, response: %s", chatID, string(respBody))
+		slog.Debug("Message sent", logging.ChannelKey, mc.name, "chat", chatID, "response", string(respBody))
 		return nil
 	} else {
 		return fmt.Errorf("mochat API returned error (status: %d): %s", resp.StatusCode, string(respBody))
@@ -114,16 +116,5 @@ func (mc *MochatChannel) Send(chatID, message string) error {
 
 // isAllowed checks if a chat is allowed
 func (mc *MochatChannel) isAllowed(chatID string) bool {
-	if len(mc.allowedChats) == 0 {
-		// If no allowed chats specified, allow all
-		return true
-	}
-
-	for _, allowed := range mc.allowedChats {
-		if allowed == chatID {
-			return true
-		}
-	}
-
-	return false
+	return allowFromMatches(mc.allowedChats, true, chatID)
 }
\ No newline at end of file
@@ -2,7 +2,9 @@ package channels
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+
+	"nanotalon/logging"
 )
 
 // QQChannel implements the QQ channel
@@ -31,7 +33,7 @@ func (qq *QQChannel) Start() error {
 	}
 
 	qq.running = true
-	log.Printf("QQ channel started")
+	slog.Info("QQ channel started", logging.ChannelKey, qq.name)
 
 	// In a real implementation, we would authenticate with QQ and establish
 	// a connection to the QQ bot API
@@ -42,7 +44,7 @@ func (qq *QQChannel) Start() error {
 // Stop stops the QQ channel
 func (qq *QQChannel) Stop() error {
 	qq.running = false
-	log.Printf("QQ channel stopped")
+	slog.Info("QQ channel stopped", logging.ChannelKey, qq.name)
 	return nil
 }
 
@@ -61,7 +63,7 @@ func (qq *QQChannel) Send(userID, message string) error {
 		return fmt.Errorf("user %s not allowed", userID)
 	}
 
-	log.Printf("Sending to QQ user %s: %s", userID, message)
+	slog.Debug("Sending message", logging.ChannelKey, qq.name, "user", userID, "message", message)
 
 	// Actually send via HTTP request to QQ Bot API
 	return qq.sendToQQAPI(userID, message)
@@ -74,22 +76,11 @@ func (qq *QQChannel) sendToQQAPI(userID, message string) error {
 	// With proper authentication headers and message body
 
 	// For this placeholder implementation, we'll just log the attempt
-	log.Printf("Would send to QQ API: appID=%s, user=%s, message=%.100s...", qq.appID, userID, message)
+	slog.Debug("Would send to QQ API", logging.ChannelKey, qq.name, "app_id", qq.appID, "user", userID, "message", fmt.Sprintf("%.100s...", message))
 	return nil
 }
 
 // isAllowed checks if a user is allowed
 func (qq *QQChannel) isAllowed(userID string) bool {
-	if len(qq.allowedUsers) == 0 {
-		// If no allowed users specified, allow all
-		return true
-	}
-
-	for _, allowed := range qq.allowedUsers {
-		if allowed == userID {
-			return true
-		}
-	}
-
-	return false
+	return allowFromMatches(qq.allowedUsers, true, userID)
 }
\ No newline at end of file
@@ -0,0 +1,308 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"nanotalon/bus"
+	"nanotalon/logging"
+)
+
+// RocketChatChannel implements the Rocket.Chat channel. Messages arrive over the realtime
+// (DDP) API; the bot answers direct messages and mentions, replying in the thread. It signs
+// in with a personal access token and the ID of the user it belongs to.
+type RocketChatChannel struct {
+	serverURL    string
+	userID       string
+	token        string
+	allowedChats []string
+	name         string
+	running      bool
+	httpClient   *http.Client
+	botUsername  string
+	cancel       context.CancelFunc
+	messageBus   *bus.MessageBus
+
+	// Rooms an allowed user wrote in, so replies reach them
+	activeChats sync.Map
+}
+
+// rocketChatMessage is the part of a Rocket.Chat message the channel uses
+type rocketChatMessage struct {
+	ID       string      `json:"_id"`
+	RoomID   string      `json:"rid"`
+	Text     string      `json:"msg"`
+	ThreadID string      `json:"tmid"`
+	Type     string      `json:"t"` // Set for system messages such as joins
+	EditedAt interface{} `json:"editedAt"`
+	User     struct {
+		ID       string `json:"_id"`
+		Username string `json:"username"`
+	} `json:"u"`
+	Mentions []struct {
+		ID string `json:"_id"`
+	} `json:"mentions"`
+}
+
+// NewRocketChatChannel creates a new Rocket.Chat channel for a server URL, user ID and access token
+func NewRocketChatChannel(serverURL, userID, token string, allowedChats []string) *RocketChatChannel {
+	return &RocketChatChannel{
+		serverURL:    strings.TrimRight(serverURL, "/"),
+		userID:       userID,
+		token:        token,
+		allowedChats: allowedChats,
+		name:         "rocketchat",
+		running:      false,
+		httpClient:   &http.Client{},
+	}
+}
+
+// SetMessageBus sets where incoming Rocket.Chat messages are published
+func (rc *RocketChatChannel) SetMessageBus(messageBus *bus.MessageBus) {
+	rc.messageBus = messageBus
+}
+
+// Start starts the Rocket.Chat channel
+func (rc *RocketChatChannel) Start() error {
+	if rc.serverURL == "" || rc.userID == "" || rc.token == "" {
+		return fmt.Errorf("rocket.chat url, user_id and token must be configured")
+	}
+
+	var me struct {
+		Username string `json:"username"`
+	}
+	if err := rc.api(http.MethodGet, "/api/v1/me", nil, &me); err != nil {
+		return fmt.Errorf("failed to authenticate with rocket.chat: %w", err)
+	}
+	rc.botUsername = me.Username
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rc.cancel = cancel
+	rc.running = true
+	go runReconnecting(ctx, "Rocket.Chat", rc.listen)
+
+	slog.Info("Rocket.Chat channel started", logging.ChannelKey, rc.name, "user", me.Username)
+	return nil
+}
+
+// listen signs in over the realtime API, subscribes to the messages of every room the bot
+// is in, and reads them until the connection drops or ctx is cancelled
+func (rc *RocketChatChannel) listen(ctx context.Context) error {
+	wsURL, err := websocketURL(rc.serverURL, "/websocket")
+	if err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	handshake := []map[string]interface{}{
+		{"msg": "connect", "version": "1", "support": []string{"1"}},
+		{"msg": "method", "method": "login", "id": "login", "params": []interface{}{map[string]string{"resume": rc.token}}},
+		{"msg": "sub", "id": "messages", "name": "stream-room-messages", "params": []interface{}{"__my_messages__", false}},
+	}
+	for _, frame := range handshake {
+		if err := conn.WriteJSON(frame); err != nil {
+			return err
+		}
+	}
+
+	for {
+		var frame struct {
+			Msg        string `json:"msg"`
+			ID         string `json:"id"`
+			Collection string `json:"collection"`
+			Error      *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			Fields struct {
+				Args []json.RawMessage `json:"args"`
+			} `json:"fields"`
+		}
+		if err := conn.ReadJSON(&frame); err != nil {
+			return err
+		}
+
+		switch {
+		case frame.Msg == "ping":
+			if err := conn.WriteJSON(map[string]string{"msg": "pong"}); err != nil {
+				return err
+			}
+		case frame.Msg == "result" && frame.ID == "login" && frame.Error != nil:
+			return fmt.Errorf("login failed: %s", frame.Error.Message)
+		case frame.Msg == "changed" && frame.Collection == "stream-room-messages" && len(frame.Fields.Args) > 0:
+			var message rocketChatMessage
+			if err := json.Unmarshal(frame.Fields.Args[0], &message); err != nil {
+				continue
+			}
+			var room struct {
+				RoomType string `json:"roomType"`
+			}
+			if len(frame.Fields.Args) > 1 {
+				json.Unmarshal(frame.Fields.Args[1], &room)
+			}
+			rc.handleMessage(message, room.RoomType == "d")
+		}
+	}
+}
+
+// handleMessage publishes a new message from an allowed user that is a direct message or
+// mentions the bot. The chat ID is "<room>/<thread>" for threads, and each thread is its
+// own session.
+func (rc *RocketChatChannel) handleMessage(message rocketChatMessage, direct bool) {
+	if message.User.ID == rc.userID || message.Type != "" || message.EditedAt != nil {
+		return
+	}
+	mentioned := false
+	for _, mention := range message.Mentions {
+		mentioned = mentioned || mention.ID == rc.userID
+	}
+	if !direct && !mentioned {
+		return
+	}
+
+	if !rc.isAllowed(message.User.ID, message.User.Username, message.RoomID) {
+		slog.Info("Ignoring message, sender not in allow_from", logging.ChannelKey, rc.name, "sender", message.User.Username, "chat", message.RoomID)
+		return
+	}
+	if rc.messageBus == nil {
+		slog.Warn("No message bus, dropping message", logging.ChannelKey, rc.name, "sender", message.User.Username)
+		return
+	}
+	rc.activeChats.Store(message.RoomID, true)
+
+	text := message.Text
+	if rc.botUsername != "" {
+		text = strings.TrimSpace(strings.ReplaceAll(text, "@"+rc.botUsername, ""))
+	}
+	if text == "" {
+		return
+	}
+
+	// Mentions in rooms start a thread under the message; DMs only stay in a thread they are in
+	threadID := message.ThreadID
+	if threadID == "" && !direct {
+		threadID = message.ID
+	}
+	chatID := message.RoomID
+	if threadID != "" {
+		chatID += "/" + threadID
+	}
+
+	rc.messageBus.PublishInbound(bus.InboundMessage{
+		Channel:    rc.name,
+		SenderID:   message.User.ID,
+		ChatID:     chatID,
+		Content:    text,
+		SessionKey: fmt.Sprintf("%s:%s", rc.name, chatID),
+		Metadata:   map[string]interface{}{"username": message.User.Username, bus.MetadataMessageID: message.ID},
+	})
+}
+
+// Stop stops the Rocket.Chat channel
+func (rc *RocketChatChannel) Stop() error {
+	if rc.cancel != nil {
+		rc.cancel()
+	}
+	rc.running = false
+	slog.Info("Rocket.Chat channel stopped", logging.ChannelKey, rc.name)
+	return nil
+}
+
+// Name returns the channel name
+func (rc *RocketChatChannel) Name() string {
+	return rc.name
+}
+
+// Send sends a message to a Rocket.Chat room, or to a thread when chatID is "<room>/<thread>"
+func (rc *RocketChatChannel) Send(chatID, message string) error {
+	if !rc.running {
+		return fmt.Errorf("rocket.chat channel not running")
+	}
+
+	roomID, threadID, _ := strings.Cut(chatID, "/")
+	if !rc.isAllowed(roomID) && !rc.isActiveChat(roomID) {
+		return fmt.Errorf("room %s not allowed", roomID)
+	}
+
+	msg := map[string]string{"rid": roomID, "msg": message}
+	if threadID != "" {
+		msg["tmid"] = threadID
+	}
+	if err := rc.api(http.MethodPost, "/api/v1/chat.sendMessage", map[string]interface{}{"message": msg}, nil); err != nil {
+		return fmt.Errorf("failed to send rocket.chat message: %w", err)
+	}
+	return nil
+}
+
+// MarkRead marks a Rocket.Chat room as read by the bot, up to its latest message
+func (rc *RocketChatChannel) MarkRead(chatID, messageID string) error {
+	if !rc.running {
+		return fmt.Errorf("rocket.chat channel not running")
+	}
+
+	roomID, _, _ := strings.Cut(chatID, "/")
+	if err := rc.api(http.MethodPost, "/api/v1/subscriptions.read", map[string]string{"rid": roomID}, nil); err != nil {
+		return fmt.Errorf("failed to mark room read: %w", err)
+	}
+	return nil
+}
+
+// api calls the Rocket.Chat REST API, decoding the response into out if it isn't nil
+func (rc *RocketChatChannel) api(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, rc.serverURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("X-User-Id", rc.userID)
+	req.Header.Set("X-Auth-Token", rc.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := rc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("rocket.chat API returned error (status: %d): %s", resp.StatusCode, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// isAllowed checks if any of a user, username or room ID is in allow_from
+func (rc *RocketChatChannel) isAllowed(ids ...string) bool {
+	return allowFromMatches(rc.allowedChats, true, ids...)
+}
+
+// isActiveChat reports whether an allowed user has written in a room
+func (rc *RocketChatChannel) isActiveChat(roomID string) bool {
+	_, ok := rc.activeChats.Load(roomID)
+	return ok
+}
@@ -0,0 +1,61 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nanotalon/bus"
+)
+
+func TestRocketChatChannel(t *testing.T) {
+	sent := make(chan map[string]map[string]string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-User-Id") != "bot1" || r.Header.Get("X-Auth-Token") != "test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		sent <- body
+	}))
+	defer server.Close()
+
+	channel := NewRocketChatChannel(server.URL, "bot1", "test-token", []string{"alice"})
+	channel.botUsername = "talon"
+	channel.running = true
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+
+	var message rocketChatMessage
+	json.Unmarshal([]byte(`{"_id": "m1", "rid": "r1", "msg": "@talon deploy status?", "u": {"_id": "u1", "username": "alice"}, "mentions": [{"_id": "bot1"}]}`), &message)
+	edited := message
+	edited.EditedAt = map[string]interface{}{"$date": 1}
+	unmentioned := message
+	unmentioned.Mentions = nil
+
+	channel.handleMessage(unmentioned, false)
+	channel.handleMessage(edited, false)
+	channel.handleMessage(message, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	if msg.Content != "deploy status?" || msg.ChatID != "r1/m1" || msg.SenderID != "u1" {
+		t.Errorf("Unexpected inbound message: %+v", msg)
+	}
+
+	if err := channel.Send(msg.ChatID, "All green."); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	body := <-sent
+	if body["message"]["rid"] != "r1" || body["message"]["tmid"] != "m1" || body["message"]["msg"] != "All green." {
+		t.Errorf("Expected the reply in the thread, got %v", body)
+	}
+}
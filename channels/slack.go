@@ -1,13 +1,31 @@
 package channels
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+
+	"nanotalon/bus"
+	"nanotalon/logging"
+	"nanotalon/media"
+)
+
+// Block Kit limits: characters in a section's text and blocks in one message
+const (
+	maxSlackSectionChars = 3000
+	maxSlackBlocks       = 50
 )
 
-// SlackChannel implements the Slack channel
+// SlackChannel implements the Slack channel. Events arrive over Socket Mode, so no public
+// URL is needed: the bot answers direct messages, mentions and replies in threads it answered
+// in, replying in the thread. Other channel messages are kept as context.
 type SlackChannel struct {
 	botToken     string
 	appToken     string
@@ -15,6 +33,18 @@ type SlackChannel struct {
 	name         string
 	running      bool
 	client       *slack.Client
+	socket       *socketmode.Client
+	cancel       context.CancelFunc
+	botUserID    string
+	media        *media.Store // If set, shared files are downloaded into the workspace
+	messageBus   *bus.MessageBus
+
+	// Channels an allowed user wrote in, so replies reach them
+	activeChats sync.Map
+	groups      *groupChats
+
+	// Channel threads the bot answered in, as "<channel>/<thread>"
+	threads sync.Map
 }
 
 // NewSlackChannel creates a new Slack channel
@@ -25,27 +55,195 @@ func NewSlackChannel(botToken, appToken string, allowedChats []string) *SlackCha
 		allowedChats: allowedChats,
 		name:         "slack",
 		running:      false,
+		groups:       newGroupChats(),
 	}
 }
 
-// Start starts the Slack channel
+// SetMessageBus sets where incoming Slack messages are published
+func (sc *SlackChannel) SetMessageBus(messageBus *bus.MessageBus) {
+	sc.messageBus = messageBus
+}
+
+// Start connects to Slack in Socket Mode with the app-level token
 func (sc *SlackChannel) Start() error {
 	if sc.botToken == "" {
 		return fmt.Errorf("slack bot token must be configured")
 	}
+	if sc.appToken == "" {
+		return fmt.Errorf("slack app token must be configured for socket mode")
+	}
+
+	client := slack.New(sc.botToken, slack.OptionAppLevelToken(sc.appToken))
+	auth, err := client.AuthTest()
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with slack: %w", err)
+	}
 
-	client := slack.New(sc.botToken)
+	ctx, cancel := context.WithCancel(context.Background())
 	sc.client = client
+	sc.socket = socketmode.New(client)
+	sc.cancel = cancel
+	sc.botUserID = auth.UserID
 	sc.running = true
-	log.Printf("Slack channel started")
 
+	// Without a message bus the channel only sends; socket mode would share events with
+	// the gateway's connection
+	if sc.messageBus == nil {
+		slog.Info("Slack channel started (send only)", logging.ChannelKey, sc.name, "user", auth.User)
+		return nil
+	}
+
+	go sc.handleEvents(ctx)
+	go func() {
+		if err := sc.socket.RunContext(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Slack socket mode stopped", logging.ChannelKey, sc.name, "error", err)
+		}
+	}()
+
+	slog.Info("Slack channel started", logging.ChannelKey, sc.name, "user", auth.User)
+	return nil
+}
+
+// handleEvents acknowledges Socket Mode events and handles messages and mentions
+func (sc *SlackChannel) handleEvents(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt := <-sc.socket.Events:
+			if evt.Type != socketmode.EventTypeEventsAPI {
+				continue
+			}
+			eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
+			if !ok {
+				continue
+			}
+			if evt.Request != nil {
+				sc.socket.Ack(*evt.Request)
+			}
+
+			switch ev := eventsAPIEvent.InnerEvent.Data.(type) {
+			case *slackevents.AppMentionEvent:
+				if ev.BotID == "" {
+					sc.handleMessage(ev.User, ev.Channel, ev.Text, ev.TimeStamp, threadOf(ev.ThreadTimeStamp, ev.TimeStamp), nil)
+				}
+			case *slackevents.MessageEvent:
+				if ev.BotID != "" || (ev.SubType != "" && ev.SubType != "file_share") {
+					continue
+				}
+				if ev.ChannelType == "im" {
+					sc.handleMessage(ev.User, ev.Channel, ev.Text, ev.TimeStamp, ev.ThreadTimeStamp, ev.Files)
+					continue
+				}
+				sc.handleChannelMessage(ev)
+			}
+		}
+	}
+}
+
+// handleChannelMessage handles a message in a channel that doesn't mention the bot: a reply
+// in a thread the bot answered in addresses it, others are answered only if the group policy
+// doesn't require a mention and are kept as context otherwise
+func (sc *SlackChannel) handleChannelMessage(ev *slackevents.MessageEvent) {
+	// Mentions arrive again as app_mention
+	if sc.botUserID != "" && strings.Contains(ev.Text, "<@"+sc.botUserID+">") {
+		return
+	}
+
+	key := ev.Channel
+	if ev.ThreadTimeStamp != "" {
+		key += "/" + ev.ThreadTimeStamp
+	}
+	_, addressed := sc.threads.Load(key)
+	if !sc.groups.answers(addressed) {
+		if sc.isAllowed(ev.User, ev.Channel) {
+			sc.groups.remember(key, "<@"+ev.User+">", ev.Text)
+		}
+		return
+	}
+	sc.handleMessage(ev.User, ev.Channel, ev.Text, ev.TimeStamp, threadOf(ev.ThreadTimeStamp, ev.TimeStamp), ev.Files)
+}
+
+// threadOf returns the thread a reply belongs in: the existing thread, or a new one under the message
+func threadOf(threadTS, ts string) string {
+	if threadTS != "" {
+		return threadTS
+	}
+	return ts
+}
+
+// handleMessage publishes a message from an allowed user to the message bus. Replies to a
+// thread go back into it: the chat ID is "<channel>/<thread ts>" and each thread is its
+// own session. ts is the message's own timestamp, which read receipts refer to.
+func (sc *SlackChannel) handleMessage(userID, channelID, text, ts, threadTS string, files []slackevents.File) {
+	if !sc.isAllowed(userID, channelID) {
+		slog.Info("Ignoring message, sender not in allow_from", logging.ChannelKey, sc.name, "sender", userID, "chat", channelID)
+		return
+	}
+	if sc.messageBus == nil {
+		slog.Warn("No message bus, dropping message", logging.ChannelKey, sc.name, "sender", userID)
+		return
+	}
+	sc.activeChats.Store(channelID, true)
+
+	if sc.botUserID != "" {
+		text = strings.TrimSpace(strings.ReplaceAll(text, "<@"+sc.botUserID+">", ""))
+	}
+	attachments := sc.downloadFiles(files)
+	if text == "" && len(attachments) == 0 {
+		return
+	}
+
+	chatID := channelID
+	if threadTS != "" {
+		chatID += "/" + threadTS
+	}
+
+	// DM channel IDs start with D; in other channels, messages the bot wasn't addressed in
+	// go along, from the channel for a new thread and from the thread for a reply in one
+	if !strings.HasPrefix(channelID, "D") {
+		contextKey := chatID
+		if threadTS == ts {
+			contextKey = channelID
+		}
+		text = sc.groups.withContext(contextKey, text)
+		sc.threads.Store(chatID, true)
+	}
+	sc.messageBus.PublishInbound(bus.InboundMessage{
+		Channel:    sc.name,
+		SenderID:   userID,
+		ChatID:     chatID,
+		Content:    text,
+		SessionKey: fmt.Sprintf("%s:%s", sc.name, chatID),
+		Media:      attachments,
+		Metadata:   map[string]interface{}{bus.MetadataMessageID: ts},
+	})
+}
+
+// slackReadReaction is the emoji added to a message once the bot starts on it; bots
+// can't show a typing indicator over the Events API, so this is the feedback Slack gets
+const slackReadReaction = "eyes"
+
+// MarkRead reacts to a message so the user sees it is being worked on
+func (sc *SlackChannel) MarkRead(chatID, messageID string) error {
+	if !sc.running || sc.client == nil {
+		return fmt.Errorf("slack channel not running")
+	}
+
+	channelID, _, _ := strings.Cut(chatID, "/")
+	if err := sc.client.AddReaction(slackReadReaction, slack.NewRefToMessage(channelID, messageID)); err != nil {
+		return fmt.Errorf("failed to add slack reaction: %w", err)
+	}
 	return nil
 }
 
 // Stop stops the Slack channel
 func (sc *SlackChannel) Stop() error {
+	if sc.cancel != nil {
+		sc.cancel()
+	}
 	sc.running = false
-	log.Printf("Slack channel stopped")
+	slog.Info("Slack channel stopped", logging.ChannelKey, sc.name)
 	return nil
 }
 
@@ -54,43 +252,123 @@ func (sc *SlackChannel) Name() string {
 	return sc.name
 }
 
-// Send sends a message to a Slack channel
+// Send sends a message to a Slack channel, or to a thread when chatID is "<channel>/<thread ts>".
+// Long answers and answers with code are rendered as Block Kit sections.
 func (sc *SlackChannel) Send(chatID, message string) error {
 	if !sc.running {
 		return fmt.Errorf("slack channel not running")
 	}
 
-	if !sc.isAllowed(chatID) {
-		return fmt.Errorf("channel %s not allowed", chatID)
+	channelID, threadTS, _ := strings.Cut(chatID, "/")
+	if !sc.isAllowed(channelID) && !sc.isActiveChat(channelID) {
+		return fmt.Errorf("channel %s not allowed", channelID)
 	}
 
 	if sc.client == nil {
 		return fmt.Errorf("slack client not initialized")
 	}
 
-	// Send the message to the specified channel
-	_, _, err := sc.client.PostMessage(chatID, slack.MsgOptionText(message, false))
-	if err != nil {
-		return fmt.Errorf("failed to send slack message: %w", err)
+	// Block Kit caps the blocks per message, so very long answers take several messages;
+	// the text is then only the notification preview
+	text, batches := message, [][]slack.Block{nil}
+	if blocks := slackBlocks(message); len(blocks) > 0 {
+		text, batches = previewText(message), nil
+		for start := 0; start < len(blocks); start += maxSlackBlocks {
+			batches = append(batches, blocks[start:min(start+maxSlackBlocks, len(blocks))])
+		}
+	}
+
+	for _, batch := range batches {
+		options := []slack.MsgOption{slack.MsgOptionText(text, false)}
+		if batch != nil {
+			options = append(options, slack.MsgOptionBlocks(batch...))
+		}
+		if threadTS != "" {
+			options = append(options, slack.MsgOptionTS(threadTS))
+		}
+		if _, _, err := sc.client.PostMessage(channelID, options...); err != nil {
+			return fmt.Errorf("failed to send slack message: %w", err)
+		}
 	}
 
-	log.Printf("Slack message sent successfully to channel %s", chatID)
+	slog.Debug("Message sent", logging.ChannelKey, sc.name, "chat", chatID)
 
 	return nil
 }
 
-// isAllowed checks if a chat/channel is allowed
-func (sc *SlackChannel) isAllowed(chatID string) bool {
-	if len(sc.allowedChats) == 0 {
-		// If no allowed chats specified, allow all
-		return true
+// codeFence matches fenced code blocks, with an optional language after the opening fence
+var codeFence = regexp.MustCompile("(?s)```[a-zA-Z0-9_+-]*\\n?(.*?)```")
+
+// slackBlocks renders a long answer, or one with code, as Block Kit sections: prose is split
+// into sections at paragraph breaks and each code block gets its own section. Short plain
+// answers return nil and are sent as text.
+func slackBlocks(message string) []slack.Block {
+	if len(message) <= maxSlackSectionChars && !strings.Contains(message, "```") {
+		return nil
 	}
 
-	for _, allowed := range sc.allowedChats {
-		if allowed == chatID {
-			return true
+	var blocks []slack.Block
+	addSection := func(text string) {
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+	}
+
+	last := 0
+	for _, match := range codeFence.FindAllStringSubmatchIndex(message, -1) {
+		for _, chunk := range splitText(message[last:match[0]], maxSlackSectionChars) {
+			addSection(chunk)
+		}
+		code := strings.TrimRight(message[match[2]:match[3]], "\n")
+		for _, chunk := range splitText(code, maxSlackSectionChars-8) {
+			addSection("```\n" + chunk + "\n```")
 		}
+		last = match[1]
 	}
+	for _, chunk := range splitText(message[last:], maxSlackSectionChars) {
+		addSection(chunk)
+	}
+	return blocks
+}
+
+// previewText shortens an answer sent as blocks to the first line, for notifications
+func previewText(message string) string {
+	preview, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	if runes := []rune(preview); len(runes) > 150 {
+		preview = string(runes[:150]) + "…"
+	}
+	return preview
+}
 
-	return false
-}
\ No newline at end of file
+// splitText splits text into chunks of at most limit bytes, preferring paragraph and line breaks
+func splitText(text string, limit int) []string {
+	text = strings.Trim(text, "\n")
+	var chunks []string
+	for len(text) > limit {
+		cut := strings.LastIndex(text[:limit], "\n\n")
+		if cut <= 0 {
+			cut = strings.LastIndex(text[:limit], "\n")
+		}
+		if cut <= 0 {
+			cut = limit
+		}
+		chunks = append(chunks, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n")
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// isAllowed checks if any of a user or channel ID is in allow_from
+func (sc *SlackChannel) isAllowed(ids ...string) bool {
+	return allowFromMatches(sc.allowedChats, true, ids...)
+}
+
+// isActiveChat reports whether an allowed user has written in a channel
+func (sc *SlackChannel) isActiveChat(channelID string) bool {
+	_, ok := sc.activeChats.Load(channelID)
+	return ok
+}
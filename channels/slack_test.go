@@ -0,0 +1,68 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"nanotalon/bus"
+)
+
+func TestSlackInbound(t *testing.T) {
+	channel := NewSlackChannel("xoxb-test", "xapp-test", []string{"U123"})
+	channel.botUserID = "UBOT"
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+
+	channel.handleMessage("U999", "C1", "<@UBOT> hello", "1700000000.000200", "1700000000.000100", nil)
+	channel.handleMessage("U123", "C1", "<@UBOT> summarize this thread", "1700000000.000300", "1700000000.000100", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	if msg.SenderID != "U123" || msg.ChatID != "C1/1700000000.000100" || msg.SessionKey != "slack:C1/1700000000.000100" {
+		t.Errorf("Unexpected routing: %+v", msg)
+	}
+	if msg.Metadata[bus.MetadataMessageID] != "1700000000.000300" {
+		t.Errorf("Expected the message timestamp for read receipts, got %v", msg.Metadata)
+	}
+	if msg.Content != "summarize this thread" {
+		t.Errorf("Expected the mention to be stripped, got %q", msg.Content)
+	}
+	if !channel.isActiveChat("C1") {
+		t.Error("Expected replies to be allowed in the channel U123 wrote in")
+	}
+}
+
+func TestSlackBlocks(t *testing.T) {
+	if blocks := slackBlocks("Short answer."); blocks != nil {
+		t.Errorf("Expected a short answer to be sent as text, got %d blocks", len(blocks))
+	}
+
+	blocks := slackBlocks("Run this:\n```go\nfmt.Println(1)\n```\nThen check the output.")
+	var texts []string
+	for _, block := range blocks {
+		section, ok := block.(*slack.SectionBlock)
+		if !ok {
+			t.Fatalf("Expected section blocks, got %T", block)
+		}
+		texts = append(texts, section.Text.Text)
+	}
+	want := []string{"Run this:", "```\nfmt.Println(1)\n```", "Then check the output."}
+	if strings.Join(texts, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected sections %q, got %q", want, texts)
+	}
+
+	long := strings.Repeat(strings.Repeat("word ", 100)+"\n\n", 20)
+	for _, block := range slackBlocks(long) {
+		if text := block.(*slack.SectionBlock).Text.Text; len(text) > maxSlackSectionChars {
+			t.Errorf("Section of %d chars is over the limit", len(text))
+		}
+	}
+}
@@ -2,11 +2,19 @@ package channels
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"nanotalon/bus"
+	"nanotalon/logging"
+	"nanotalon/media"
 )
 
 // TelegramChannel implements the Telegram channel
@@ -17,8 +25,29 @@ type TelegramChannel struct {
 	name         string
 	running      bool
 	httpClient   *http.Client
+	media        *media.Store // If set, attachments are downloaded into the workspace
+	messageBus   *bus.MessageBus
+	done         chan struct{} // Closed by Stop to end the update loop
+
+	// Chats an allowed user wrote in, so replies reach group chats not listed in allow_from
+	activeChats sync.Map
+	groups      *groupChats
+
+	// Button data too long for Telegram's callback data, by the short key sent instead
+	callbacks    sync.Map
+	callbackKeys atomic.Int64
 }
 
+// telegramAPIEndpoint is the Bot API URL format; tests point it at a fake server
+var telegramAPIEndpoint = tgbotapi.APIEndpoint
+
+// Telegram limits: characters per message (4096, with room to spare) and bytes of
+// callback data per button
+const (
+	maxTelegramChars        = 4000
+	maxTelegramCallbackData = 64
+)
+
 // NewTelegramChannel creates a new Telegram channel
 func NewTelegramChannel(token string, allowedChats []string) *TelegramChannel {
 	return &TelegramChannel{
@@ -26,6 +55,7 @@ func NewTelegramChannel(token string, allowedChats []string) *TelegramChannel {
 		allowedChats: allowedChats,
 		name:         "telegram",
 		httpClient:   &http.Client{},
+		groups:       newGroupChats(),
 	}
 }
 
@@ -35,7 +65,7 @@ func (tc *TelegramChannel) Start() error {
 		return fmt.Errorf("telegram token not configured")
 	}
 
-	bot, err := tgbotapi.NewBotAPI(tc.token)
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(tc.token, telegramAPIEndpoint)
 	if err != nil {
 		return fmt.Errorf("failed to create telegram bot: %w", err)
 	}
@@ -43,32 +73,67 @@ func (tc *TelegramChannel) Start() error {
 	tc.bot = bot
 	tc.running = true
 
-	log.Printf("Authorized on account %s", bot.Self.UserName)
+	slog.Info("Authorized on Telegram account", logging.ChannelKey, tc.name, "user", bot.Self.UserName)
+
+	// Without a message bus the channel only sends, leaving updates to the gateway
+	if tc.messageBus == nil {
+		slog.Info("Telegram channel started (send only)", logging.ChannelKey, tc.name)
+		return nil
+	}
 
 	// Set up updates configuration
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
 	updates := bot.GetUpdatesChan(u)
+	done := make(chan struct{})
+	tc.done = done
 
-	// Handle incoming messages in a goroutine
+	// Handle incoming messages in a goroutine until the channel is stopped; /start and
+	// /help are answered here, other commands such as /stop go to the agent
 	go func() {
-		for update := range updates {
-			if update.Message != nil && update.Message.IsCommand() {
+		for {
+			var update tgbotapi.Update
+			var ok bool
+			select {
+			case <-done:
+				return
+			case update, ok = <-updates:
+				if !ok {
+					return
+				}
+			}
+			// A poll still in flight when the channel stopped may return updates; they
+			// belong to whichever channel replaced this one
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			if update.CallbackQuery != nil {
+				tc.handleCallback(update.CallbackQuery)
+				continue
+			}
+			if update.Message == nil {
+				continue
+			}
+			switch update.Message.Command() {
+			case "start", "help":
 				tc.handleCommand(update.Message)
-			} else if update.Message != nil {
+			default:
 				tc.handleMessage(update.Message)
 			}
 		}
 	}()
 
-	log.Printf("Telegram channel started")
+	slog.Info("Telegram channel started", logging.ChannelKey, tc.name)
 	return nil
 }
 
 // handleCommand processes commands from Telegram
 func (tc *TelegramChannel) handleCommand(message *tgbotapi.Message) {
-	log.Printf("[%s] %s", message.From.UserName, message.Command())
+	slog.Debug("Received command", logging.ChannelKey, tc.name, "sender", message.From.UserName, "command", message.Command())
 
 	switch message.Command() {
 	case "help":
@@ -80,21 +145,151 @@ func (tc *TelegramChannel) handleCommand(message *tgbotapi.Message) {
 	}
 }
 
-// handleMessage processes incoming messages from Telegram
+// SetMessageBus sets where incoming Telegram messages are published
+func (tc *TelegramChannel) SetMessageBus(messageBus *bus.MessageBus) {
+	tc.messageBus = messageBus
+}
+
+// handleMessage publishes an incoming message from an allowed user to the message bus.
+// The session is per chat; the message being replied to is quoted for context. In groups,
+// messages that don't address the bot are kept as context for the next one that does,
+// unless the group policy answers every message.
 func (tc *TelegramChannel) handleMessage(message *tgbotapi.Message) {
+	addressed := tc.isAddressed(message)
+	if message.Chat != nil && !message.Chat.IsPrivate() && message.From != nil && !tc.groups.answers(addressed) {
+		senderID := strconv.FormatInt(message.From.ID, 10)
+		chatID := strconv.FormatInt(message.Chat.ID, 10)
+		if tc.isAllowed(addressed, senderID, "@"+message.From.UserName, chatID) {
+			tc.groups.remember(chatID, senderName(message.From), message.Text+message.Caption)
+		}
+		return
+	}
+	tc.receive(message, addressed)
+}
+
+// handleCallback handles a press on one of the buttons SendButtons showed. The answer goes
+// to the agent as if the user had typed it, and replaces the buttons so it can't be sent twice.
+func (tc *TelegramChannel) handleCallback(query *tgbotapi.CallbackQuery) {
+	if query.Message == nil || query.Message.Chat == nil || query.From == nil {
+		return
+	}
+
+	// Answer so the button stops showing a spinner
+	if _, err := tc.bot.Request(tgbotapi.NewCallback(query.ID, "")); err != nil {
+		slog.Warn("Could not answer callback query", logging.ChannelKey, tc.name, "error", err)
+	}
+
+	data := query.Data
+	if long, ok := tc.callbacks.Load(data); ok {
+		data = long.(string)
+	}
+	answer := &tgbotapi.Message{MessageID: query.Message.MessageID, From: query.From, Chat: query.Message.Chat, Text: data}
+	if !tc.receive(answer, true) {
+		return
+	}
+	tc.callbacks.Delete(query.Data)
+
+	label := data
+	if markup := query.Message.ReplyMarkup; markup != nil {
+		for _, row := range markup.InlineKeyboard {
+			for _, button := range row {
+				if button.CallbackData != nil && *button.CallbackData == query.Data {
+					label = button.Text
+				}
+			}
+		}
+	}
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, fmt.Sprintf("%s\n\n→ %s", query.Message.Text, label))
+	if _, err := tc.bot.Send(edit); err != nil {
+		slog.Warn("Could not remove buttons", logging.ChannelKey, tc.name, "error", err)
+	}
+}
+
+// receive publishes a message from an allowed user, reporting whether it was accepted;
+// addressed says whether it was meant for the bot, for "mention:" entries in allow_from
+func (tc *TelegramChannel) receive(message *tgbotapi.Message, addressed bool) bool {
+	if message.From == nil {
+		return false
+	}
 	senderID := strconv.FormatInt(message.From.ID, 10)
+	chatID := strconv.FormatInt(message.Chat.ID, 10)
+
+	if !tc.isAllowed(addressed, senderID, "@"+message.From.UserName, chatID) {
+		slog.Info("Ignoring message, sender not in allow_from", logging.ChannelKey, tc.name, "sender", senderID, "chat", chatID)
+		return false
+	}
+	if tc.messageBus == nil {
+		slog.Warn("No message bus, dropping message", logging.ChannelKey, tc.name, "sender", senderID)
+		return false
+	}
+	tc.activeChats.Store(chatID, true)
+
 	content := message.Text
+	if content == "" {
+		content = message.Caption
+	}
+	if reply := message.ReplyToMessage; reply != nil {
+		if quoted := replyText(reply); quoted != "" {
+			content = fmt.Sprintf("[Replying to %s: %s]\n%s", senderName(reply.From), quoted, content)
+		}
+	}
+	attachments := tc.downloadAttachments(message)
+	if strings.TrimSpace(content) == "" && len(attachments) == 0 {
+		return false
+	}
+	if !message.Chat.IsPrivate() {
+		content = tc.groups.withContext(chatID, content)
+	}
 
-	log.Printf("Received message from %s: %s", senderID, content)
+	metadata := map[string]interface{}{
+		bus.MetadataMessageID: message.MessageID,
+		"username":            message.From.UserName,
+	}
+	if message.ReplyToMessage != nil {
+		metadata["reply_to_message_id"] = message.ReplyToMessage.MessageID
+	}
 
-	// Here you would normally process the message with the bot
-	// For now, just log it
+	tc.messageBus.PublishInbound(bus.InboundMessage{
+		Channel:    tc.name,
+		SenderID:   senderID,
+		ChatID:     chatID,
+		Content:    content,
+		SessionKey: fmt.Sprintf("%s:%s", tc.name, chatID),
+		Media:      attachments,
+		Metadata:   metadata,
+	})
+	return true
+}
+
+// replyText returns the text of a message being replied to
+func replyText(message *tgbotapi.Message) string {
+	if message.Text != "" {
+		return message.Text
+	}
+	return message.Caption
+}
+
+// senderName names a Telegram user for the model
+func senderName(user *tgbotapi.User) string {
+	switch {
+	case user == nil:
+		return "a message"
+	case user.UserName != "":
+		return "@" + user.UserName
+	default:
+		return strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
 }
 
 // Stop stops the Telegram channel
 func (tc *TelegramChannel) Stop() error {
 	tc.running = false
-	log.Printf("Telegram channel stopped")
+	if tc.done != nil {
+		close(tc.done)
+		tc.done = nil
+		tc.bot.StopReceivingUpdates()
+	}
+	slog.Info("Telegram channel stopped", logging.ChannelKey, tc.name)
 	return nil
 }
 
@@ -109,7 +304,7 @@ func (tc *TelegramChannel) Send(chatID, message string) error {
 		return fmt.Errorf("telegram channel not running")
 	}
 
-	if !tc.isChatAllowed(chatID) {
+	if !tc.isAllowed(true, chatID) && !tc.isActiveChat(chatID) {
 		return fmt.Errorf("chat %s not allowed", chatID)
 	}
 
@@ -120,7 +315,7 @@ func (tc *TelegramChannel) Send(chatID, message string) error {
 	}
 
 	// Telegram has a message length limit of 4096 characters
-	const maxLength = 4000
+	const maxLength = maxTelegramChars
 	if len(message) > maxLength {
 		// Split the message into chunks if needed
 		for len(message) > 0 {
@@ -149,18 +344,146 @@ func (tc *TelegramChannel) Send(chatID, message string) error {
 	return nil
 }
 
-// isChatAllowed checks if a chat is allowed
-func (tc *TelegramChannel) isChatAllowed(chatID string) bool {
-	if len(tc.allowedChats) == 0 {
-		// If no allowed chats specified, allow all
-		return true
+// SendButtons sends a message to a Telegram chat with an inline keyboard under it
+func (tc *TelegramChannel) SendButtons(chatID, message string, buttons []bus.Button) error {
+	if !tc.running {
+		return fmt.Errorf("telegram channel not running")
+	}
+	if !tc.isAllowed(true, chatID) && !tc.isActiveChat(chatID) {
+		return fmt.Errorf("chat %s not allowed", chatID)
 	}
 
-	for _, allowed := range tc.allowedChats {
-		if allowed == chatID {
-			return true
+	chatIDInt, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	// Long messages go out in chunks, with the keyboard under the last one
+	for len(message) > maxTelegramChars {
+		if err := tc.Send(chatID, message[:maxTelegramChars]); err != nil {
+			return err
+		}
+		message = message[maxTelegramChars:]
+	}
+	if strings.TrimSpace(message) == "" {
+		message = "Choose an option:"
+	}
+
+	msg := tgbotapi.NewMessage(chatIDInt, message)
+	msg.ReplyMarkup = tc.keyboard(buttons)
+	if _, err := tc.bot.Send(msg); err != nil {
+		return fmt.Errorf("failed to send telegram message: %w", err)
+	}
+	return nil
+}
+
+// keyboard lays out buttons in one row when there are up to three short ones, otherwise
+// one per row
+func (tc *TelegramChannel) keyboard(buttons []bus.Button) tgbotapi.InlineKeyboardMarkup {
+	oneRow := len(buttons) <= 3
+	for _, button := range buttons {
+		oneRow = oneRow && len([]rune(button.Text)) <= 12
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, button := range buttons {
+		key := tgbotapi.NewInlineKeyboardButtonData(button.Text, tc.callbackData(button.Data))
+		if oneRow && len(rows) == 1 {
+			rows[0] = append(rows[0], key)
+		} else {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(key))
+		}
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// callbackData returns the callback data for a button. Data over Telegram's limit is kept
+// here and the button carries a short key for it instead.
+func (tc *TelegramChannel) callbackData(data string) string {
+	if len(data) <= maxTelegramCallbackData {
+		return data
+	}
+	key := fmt.Sprintf("choice:%d", tc.callbackKeys.Add(1))
+	tc.callbacks.Store(key, data)
+	return key
+}
+
+// SendAttachments sends a message to a Telegram chat followed by files; pictures are sent
+// as photos, anything else as documents
+func (tc *TelegramChannel) SendAttachments(chatID, message string, paths []string) error {
+	if message != "" {
+		if err := tc.Send(chatID, message); err != nil {
+			return err
+		}
+	}
+	if !tc.running {
+		return fmt.Errorf("telegram channel not running")
+	}
+	if !tc.isAllowed(true, chatID) && !tc.isActiveChat(chatID) {
+		return fmt.Errorf("chat %s not allowed", chatID)
+	}
+
+	chatIDInt, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	for _, path := range paths {
+		var file tgbotapi.Chattable
+		switch media.DetectType(path) {
+		case "image/jpeg", "image/png", "image/webp":
+			file = tgbotapi.NewPhoto(chatIDInt, tgbotapi.FilePath(path))
+		default:
+			file = tgbotapi.NewDocument(chatIDInt, tgbotapi.FilePath(path))
+		}
+		if _, err := tc.bot.Send(file); err != nil {
+			return fmt.Errorf("failed to send telegram attachment %s: %w", filepath.Base(path), err)
 		}
 	}
+	return nil
+}
+
+// SendTyping shows the bot as typing in a Telegram chat
+func (tc *TelegramChannel) SendTyping(chatID string) error {
+	if !tc.running {
+		return fmt.Errorf("telegram channel not running")
+	}
+
+	chatIDInt, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
 
-	return false
-}
\ No newline at end of file
+	if _, err := tc.bot.Request(tgbotapi.NewChatAction(chatIDInt, tgbotapi.ChatTyping)); err != nil {
+		return fmt.Errorf("failed to send typing action: %w", err)
+	}
+	return nil
+}
+
+// isAllowed checks if any of a user ID, @username or chat ID is in allow_from; addressed
+// says whether the message was meant for the bot, for "mention:" entries
+func (tc *TelegramChannel) isAllowed(addressed bool, ids ...string) bool {
+	return allowFromMatches(tc.allowedChats, addressed, ids...)
+}
+
+// isAddressed reports whether a message is meant for the bot: it's a private chat, it
+// mentions the bot, or it replies to one of the bot's messages
+func (tc *TelegramChannel) isAddressed(message *tgbotapi.Message) bool {
+	if message.Chat != nil && message.Chat.IsPrivate() {
+		return true
+	}
+	if tc.bot == nil {
+		return false
+	}
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == tc.bot.Self.ID {
+		return true
+	}
+	text := message.Text + message.Caption
+	return tc.bot.Self.UserName != "" && strings.Contains(strings.ToLower(text), "@"+strings.ToLower(tc.bot.Self.UserName))
+}
+
+// isActiveChat reports whether an allowed user has written in a chat
+func (tc *TelegramChannel) isActiveChat(chatID string) bool {
+	_, ok := tc.activeChats.Load(chatID)
+	return ok
+}
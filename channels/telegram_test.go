@@ -0,0 +1,271 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"nanotalon/bus"
+	"nanotalon/config"
+)
+
+func TestTelegramInbound(t *testing.T) {
+	channel := NewTelegramChannel("fake-token", []string{"@alice"})
+	channel.SetGroupPolicy(GroupPolicy{RequireMention: false})
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+
+	group := &tgbotapi.Chat{ID: -100200}
+	channel.handleMessage(&tgbotapi.Message{MessageID: 1, From: &tgbotapi.User{ID: 7, UserName: "mallory"}, Chat: group, Text: "ignore me"})
+	channel.handleMessage(&tgbotapi.Message{
+		MessageID:      2,
+		From:           &tgbotapi.User{ID: 42, UserName: "alice"},
+		Chat:           group,
+		Text:           "what does this mean?",
+		ReplyToMessage: &tgbotapi.Message{MessageID: 1, From: &tgbotapi.User{ID: 7, UserName: "mallory"}, Text: "ignore me"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	if msg.SenderID != "42" || msg.ChatID != "-100200" || msg.SessionKey != "telegram:-100200" {
+		t.Errorf("Unexpected routing: %+v", msg)
+	}
+	if !strings.HasPrefix(msg.Content, "[Replying to @mallory: ignore me]\n") || !strings.HasSuffix(msg.Content, "what does this mean?") {
+		t.Errorf("Expected the reply context to be quoted, got %q", msg.Content)
+	}
+	if msg.Metadata["reply_to_message_id"] != 1 {
+		t.Errorf("Expected reply metadata, got %v", msg.Metadata)
+	}
+
+	// Replies may go to a group chat an allowed user wrote in, but no other
+	if !channel.isActiveChat("-100200") || channel.isActiveChat("-100300") {
+		t.Error("Expected only the chat alice wrote in to be active")
+	}
+}
+
+func TestTelegramMentionRule(t *testing.T) {
+	channel := NewTelegramChannel("fake-token", []string{"mention:-100200"})
+	channel.bot = &tgbotapi.BotAPI{Self: tgbotapi.User{ID: 99, UserName: "talon_bot"}}
+	group := &tgbotapi.Chat{ID: -100200, Type: "supergroup"}
+
+	for text, want := range map[string]bool{
+		"just chatting":            false,
+		"@Talon_Bot what's up?":    true,
+		"/summary@talon_bot today": true,
+	} {
+		message := &tgbotapi.Message{From: &tgbotapi.User{ID: 42}, Chat: group, Text: text}
+		if got := channel.isAllowed(channel.isAddressed(message), "42", "-100200"); got != want {
+			t.Errorf("%q: got %v, want %v", text, got, want)
+		}
+	}
+
+	reply := &tgbotapi.Message{From: &tgbotapi.User{ID: 42}, Chat: group, Text: "thanks", ReplyToMessage: &tgbotapi.Message{From: &tgbotapi.User{ID: 99}}}
+	if !channel.isAddressed(reply) {
+		t.Error("Expected a reply to the bot to address it")
+	}
+}
+
+func TestTelegramGroupContext(t *testing.T) {
+	channel := NewTelegramChannel("fake-token", []string{"-100200"})
+	channel.bot = &tgbotapi.BotAPI{Self: tgbotapi.User{ID: 99, UserName: "talon_bot"}}
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+	group := &tgbotapi.Chat{ID: -100200, Type: "group"}
+	alice := &tgbotapi.User{ID: 42, UserName: "alice"}
+
+	// Messages that don't address the bot are only remembered
+	channel.handleMessage(&tgbotapi.Message{MessageID: 1, From: alice, Chat: group, Text: "the deploy failed again"})
+	channel.handleMessage(&tgbotapi.Message{MessageID: 2, From: &tgbotapi.User{ID: 7, FirstName: "Bob"}, Chat: group, Text: "same error as yesterday"})
+	channel.handleMessage(&tgbotapi.Message{MessageID: 3, From: alice, Chat: group, Text: "@talon_bot any idea why?"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	want := "[Earlier in this chat:\n@alice: the deploy failed again\nBob: same error as yesterday]\n@talon_bot any idea why?"
+	if msg.Content != want || msg.Metadata[bus.MetadataMessageID] != 3 {
+		t.Errorf("Expected the addressed message with the group context, got %q", msg.Content)
+	}
+
+	// The context goes along once
+	channel.handleMessage(&tgbotapi.Message{MessageID: 4, From: alice, Chat: group, Text: "@talon_bot thanks"})
+	if msg, err = messageBus.ConsumeInboundContext(ctx); err != nil || msg.Content != "@talon_bot thanks" {
+		t.Errorf("Expected the next message without context, got %q, %v", msg.Content, err)
+	}
+}
+
+func TestTelegramButtons(t *testing.T) {
+	requests := make(map[string]url.Values)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		method := path.Base(r.URL.Path)
+		requests[method] = r.PostForm
+		switch method {
+		case "getMe":
+			fmt.Fprint(w, `{"ok":true,"result":{"id":99,"is_bot":true,"username":"talon_bot"}}`)
+		case "answerCallbackQuery":
+			fmt.Fprint(w, `{"ok":true,"result":true}`)
+		default:
+			fmt.Fprint(w, `{"ok":true,"result":{"message_id":5,"date":0,"chat":{"id":42,"type":"private"}}}`)
+		}
+	}))
+	defer server.Close()
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("fake-token", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatalf("NewBotAPIWithAPIEndpoint failed: %v", err)
+	}
+	channel := NewTelegramChannel("fake-token", []string{"42"})
+	channel.bot = bot
+	channel.running = true
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+
+	long := "Every weekday at nine, starting next Monday, until the end of the quarter"
+	if err := channel.SendButtons("42", "How often?", []bus.Button{{Text: "Daily", Data: "Daily"}, {Text: "Weekdays", Data: long}}); err != nil {
+		t.Fatalf("SendButtons failed: %v", err)
+	}
+	var markup tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(requests["sendMessage"].Get("reply_markup")), &markup); err != nil {
+		t.Fatalf("Invalid reply markup: %v", err)
+	}
+	if len(markup.InlineKeyboard) != 1 || len(markup.InlineKeyboard[0]) != 2 {
+		t.Fatalf("Expected both buttons in one row, got %+v", markup.InlineKeyboard)
+	}
+	data := *markup.InlineKeyboard[0][1].CallbackData
+	if len(data) > maxTelegramCallbackData {
+		t.Errorf("Expected long data to be replaced by a short key, got %q", data)
+	}
+
+	channel.handleCallback(&tgbotapi.CallbackQuery{
+		ID:      "q1",
+		From:    &tgbotapi.User{ID: 42},
+		Data:    data,
+		Message: &tgbotapi.Message{MessageID: 5, Chat: &tgbotapi.Chat{ID: 42, Type: "private"}, Text: "How often?", ReplyMarkup: &markup},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	if msg.Content != long || msg.ChatID != "42" {
+		t.Errorf("Expected the pressed answer as a message, got %+v", msg)
+	}
+	if requests["answerCallbackQuery"].Get("callback_query_id") != "q1" {
+		t.Error("Expected the callback query to be answered")
+	}
+	if text := requests["editMessageText"].Get("text"); text != "How often?\n\n→ Weekdays" {
+		t.Errorf("Expected the buttons to be replaced by the answer, got %q", text)
+	}
+}
+
+func TestTelegramReloadStopsOldBot(t *testing.T) {
+	var mu sync.Mutex
+	queued := map[string][]string{} // Texts waiting to be polled, by bot token
+	polls := map[string]int{}
+	updateID := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(path.Dir(r.URL.Path), "/bot")
+		switch path.Base(r.URL.Path) {
+		case "getMe":
+			fmt.Fprint(w, `{"ok":true,"result":{"id":99,"is_bot":true,"username":"talon_bot"}}`)
+		case "getUpdates":
+			mu.Lock()
+			polls[token]++
+			mu.Unlock()
+			// A short long poll: wait a little for a queued message
+			for i := 0; i < 5; i++ {
+				mu.Lock()
+				if texts := queued[token]; len(texts) > 0 {
+					queued[token] = texts[1:]
+					updateID++
+					fmt.Fprintf(w, `{"ok":true,"result":[{"update_id":%d,"message":{"message_id":%d,"from":{"id":42,"username":"alice"},"chat":{"id":42,"type":"private"},"date":0,"text":%q}}]}`,
+						updateID, updateID, texts[0])
+					mu.Unlock()
+					return
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+			}
+			fmt.Fprint(w, `{"ok":true,"result":[]}`)
+		default:
+			fmt.Fprint(w, `{"ok":true,"result":true}`)
+		}
+	}))
+	defer server.Close()
+	telegramAPIEndpoint = server.URL + "/bot%s/%s"
+	defer func() { telegramAPIEndpoint = tgbotapi.APIEndpoint }()
+
+	send := func(token, text string) {
+		mu.Lock()
+		defer mu.Unlock()
+		queued[token] = append(queued[token], text)
+	}
+	pollCount := func(token string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return polls[token]
+	}
+	messageBus := bus.NewMessageBus()
+	receive := func() (string, bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		msg, err := messageBus.ConsumeInboundContext(ctx)
+		return msg.Content, err == nil
+	}
+
+	cfg := &config.Config{Channels: config.ChannelsConfig{
+		Telegram: config.TelegramConfig{Enabled: true, Token: "old-token", AllowFrom: []string{"42"}},
+	}}
+	manager := NewManager(cfg)
+	manager.SetMessageBus(messageBus)
+	if err := manager.StartAll(); err != nil {
+		t.Fatalf("StartAll failed: %v", err)
+	}
+	defer manager.StopAll()
+
+	send("old-token", "before")
+	if content, ok := receive(); !ok || content != "before" {
+		t.Fatalf("Expected the running bot to deliver, got %q (%v)", content, ok)
+	}
+
+	rotated := *cfg
+	rotated.Channels.Telegram.Token = "new-token"
+	if err := manager.Reload(&rotated); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	// The old bot stops polling once its last request returns and delivers nothing more
+	time.Sleep(100 * time.Millisecond)
+	stopped := pollCount("old-token")
+	send("old-token", "stale")
+	if content, ok := receive(); ok {
+		t.Errorf("Expected the replaced bot to stop delivering, got %q", content)
+	}
+	if polls := pollCount("old-token"); polls != stopped {
+		t.Errorf("Expected the replaced bot to stop polling, it polled %d more times", polls-stopped)
+	}
+
+	send("new-token", "after")
+	if content, ok := receive(); !ok || content != "after" {
+		t.Errorf("Expected the new bot to deliver, got %q (%v)", content, ok)
+	}
+}
@@ -0,0 +1,61 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"nanotalon/logging"
+)
+
+// Backoff between reconnect attempts of websocket channels
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// websocketURL turns an http(s) server URL into the ws(s) URL of path on that server
+func websocketURL(serverURL, path string) (string, error) {
+	u, err := url.Parse(strings.TrimRight(serverURL, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL: %w", err)
+	}
+	switch u.Scheme {
+	case "https", "wss":
+		u.Scheme = "wss"
+	case "http", "ws":
+		u.Scheme = "ws"
+	default:
+		return "", fmt.Errorf("invalid server URL %q: expected http(s)", serverURL)
+	}
+	u.Path += path
+	return u.String(), nil
+}
+
+// runReconnecting keeps a websocket connection up until ctx is cancelled. connect runs
+// one connection and returns when it drops; failures are retried with growing delays,
+// which start over once a connection has stayed up for a while.
+func runReconnecting(ctx context.Context, name string, connect func(ctx context.Context) error) {
+	delay := minReconnectDelay
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := connect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+		slog.Warn("Connection lost, reconnecting", logging.ChannelKey, name, "retry_in", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
@@ -1,21 +1,71 @@
 package channels
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"nanotalon/bus"
+	"nanotalon/logging"
 )
 
 // WhatsAppConfig contains WhatsApp channel configuration
 type WhatsAppConfig struct {
-	Enabled   bool     `mapstructure:"enabled"`
-	AllowFrom []string `mapstructure:"allow_from"`
+	Enabled     bool     `mapstructure:"enabled"`
+	AllowFrom   []string `mapstructure:"allow_from"`
+	SessionPath string   `mapstructure:"session_path"` // Linked device store; defaults to DefaultWhatsAppSessionPath
+}
+
+// DefaultWhatsAppSessionPath returns where the linked WhatsApp session is kept by default
+func DefaultWhatsAppSessionPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".nanotalon", "data", "whatsapp", "session.db")
+}
+
+// WhatsAppMessage is an incoming WhatsApp text message
+type WhatsAppMessage struct {
+	ID        string
+	SenderID  string // Phone number of the sender
+	ChatID    string // JID of the chat, where replies go
+	Text      string
+	Mentioned bool // The message mentions the linked account or replies to it
+}
+
+// WhatsAppClient is the connection to WhatsApp used by the channel. The default client,
+// see NewWhatsAppClient, links to a phone as a companion device.
+type WhatsAppClient interface {
+	// Login links a new session, passing each QR code to show to onQR until one is scanned
+	Login(ctx context.Context, onQR func(code string)) error
+
+	// Connect connects with the linked session and calls onMessage for each incoming message
+	Connect(onMessage func(WhatsAppMessage)) error
+
+	// SendText sends a text message to a chat JID or phone number
+	SendText(chatID, text string) error
+
+	// SendTyping shows the linked account as typing in a chat
+	SendTyping(chatID string) error
+
+	// MarkRead sends a read receipt for a message senderID sent in a chat
+	MarkRead(chatID, senderID, messageID string) error
+
+	// Disconnect closes the connection
+	Disconnect()
 }
 
 // WhatsAppChannel implements the WhatsApp channel
 type WhatsAppChannel struct {
-	Config       *WhatsAppConfig
-	name         string
-	running      bool
+	Config     *WhatsAppConfig
+	name       string
+	running    bool
+	client     WhatsAppClient
+	messageBus *bus.MessageBus
+
+	// Senders of published messages by message ID, which group read receipts need
+	senders sync.Map
 }
 
 // NewWhatsAppChannel creates a new WhatsApp channel
@@ -27,22 +77,50 @@ func NewWhatsAppChannel(config *WhatsAppConfig) *WhatsAppChannel {
 	}
 }
 
-// Start starts the WhatsApp channel
+// SetClient sets the WhatsApp connection to use instead of the default client
+func (wc *WhatsAppChannel) SetClient(client WhatsAppClient) {
+	wc.client = client
+}
+
+// SetMessageBus sets where incoming WhatsApp messages are published
+func (wc *WhatsAppChannel) SetMessageBus(messageBus *bus.MessageBus) {
+	wc.messageBus = messageBus
+}
+
+// Start starts the WhatsApp channel with the session linked by `nanotalon channels login whatsapp`
 func (wc *WhatsAppChannel) Start() error {
 	if !wc.Config.Enabled {
 		return fmt.Errorf("whatsapp channel not enabled in config")
 	}
 
+	if wc.client == nil {
+		sessionPath := wc.Config.SessionPath
+		if sessionPath == "" {
+			sessionPath = DefaultWhatsAppSessionPath()
+		}
+		client, err := NewWhatsAppClient(sessionPath)
+		if err != nil {
+			return fmt.Errorf("failed to create whatsapp client: %w", err)
+		}
+		wc.client = client
+	}
+
+	if err := wc.client.Connect(wc.handleMessage); err != nil {
+		return fmt.Errorf("failed to connect to whatsapp: %w", err)
+	}
+
 	wc.running = true
-	log.Printf("WhatsApp channel started")
-	// In a real implementation, this would connect to WhatsApp Business API or similar
+	slog.Info("WhatsApp channel started", logging.ChannelKey, wc.name)
 	return nil
 }
 
 // Stop stops the WhatsApp channel
 func (wc *WhatsAppChannel) Stop() error {
+	if wc.client != nil && wc.running {
+		wc.client.Disconnect()
+	}
 	wc.running = false
-	log.Printf("WhatsApp channel stopped")
+	slog.Info("WhatsApp channel stopped", logging.ChannelKey, wc.name)
 	return nil
 }
 
@@ -57,28 +135,84 @@ func (wc *WhatsAppChannel) Send(chatID, message string) error {
 		return fmt.Errorf("whatsapp channel not running")
 	}
 
-	if !wc.isAllowed(chatID) {
+	if !wc.isAllowed(true, chatID) {
 		return fmt.Errorf("chat %s not allowed", chatID)
 	}
 
-	// Log the message as sent (would integrate with WhatsApp Business API in real implementation)
-	log.Printf("WhatsApp message sent to %s: %s", chatID, message)
+	if err := wc.client.SendText(chatID, message); err != nil {
+		return fmt.Errorf("failed to send whatsapp message: %w", err)
+	}
+	return nil
+}
+
+// handleMessage publishes an incoming message from an allowed sender to the message bus
+func (wc *WhatsAppChannel) handleMessage(msg WhatsAppMessage) {
+	// Group chats have JIDs on the g.us server; anything else is a direct chat
+	addressed := msg.Mentioned || !strings.HasSuffix(msg.ChatID, "@g.us")
+	if !wc.isAllowed(addressed, msg.SenderID, msg.ChatID) {
+		slog.Info("Ignoring message, sender not in allow_from", logging.ChannelKey, wc.name, "sender", msg.SenderID)
+		return
+	}
+	if wc.messageBus == nil {
+		slog.Warn("No message bus, dropping message", logging.ChannelKey, wc.name, "sender", msg.SenderID)
+		return
+	}
 
+	metadata := map[string]interface{}{}
+	if msg.ID != "" {
+		wc.senders.Store(msg.ID, msg.SenderID)
+		metadata[bus.MetadataMessageID] = msg.ID
+	}
+
+	wc.messageBus.PublishInbound(bus.InboundMessage{
+		Channel:    wc.name,
+		SenderID:   msg.SenderID,
+		ChatID:     msg.ChatID,
+		Content:    msg.Text,
+		SessionKey: fmt.Sprintf("%s:%s", wc.name, msg.ChatID),
+		Metadata:   metadata,
+	})
+}
+
+// SendTyping shows the linked account as typing in a WhatsApp chat
+func (wc *WhatsAppChannel) SendTyping(chatID string) error {
+	if !wc.running {
+		return fmt.Errorf("whatsapp channel not running")
+	}
+	if err := wc.client.SendTyping(chatID); err != nil {
+		return fmt.Errorf("failed to send typing indicator: %w", err)
+	}
 	return nil
 }
 
-// isAllowed checks if a chat is allowed
-func (wc *WhatsAppChannel) isAllowed(chatID string) bool {
-	if len(wc.Config.AllowFrom) == 0 {
-		// If no allowed chats specified, allow all
-		return true
+// MarkRead sends a read receipt (blue ticks) for a message published earlier
+func (wc *WhatsAppChannel) MarkRead(chatID, messageID string) error {
+	if !wc.running {
+		return fmt.Errorf("whatsapp channel not running")
+	}
+	sender, ok := wc.senders.LoadAndDelete(messageID)
+	if !ok {
+		return fmt.Errorf("unknown whatsapp message %s", messageID)
+	}
+	if err := wc.client.MarkRead(chatID, sender.(string), messageID); err != nil {
+		return fmt.Errorf("failed to send read receipt: %w", err)
 	}
+	return nil
+}
 
-	for _, allowed := range wc.Config.AllowFrom {
-		if allowed == chatID {
-			return true
-		}
+// isAllowed checks if any of a chat or sender is allowed. Phone numbers match with or
+// without a leading + and chat JIDs match by their user part as well; addressed says
+// whether the message was meant for the bot, for "mention:" entries.
+func (wc *WhatsAppChannel) isAllowed(addressed bool, ids ...string) bool {
+	var candidates []string
+	for _, id := range ids {
+		candidates = append(candidates, id, whatsAppUser(id))
 	}
+	return allowFromMatches(wc.Config.AllowFrom, addressed, candidates...)
+}
 
-	return false
-}
\ No newline at end of file
+// whatsAppUser reduces a phone number or JID to its user part
+func whatsAppUser(id string) string {
+	user, _, _ := strings.Cut(strings.TrimSpace(id), "@")
+	return strings.TrimPrefix(user, "+")
+}
@@ -1,10 +1,49 @@
 package channels_test
 
 import (
+	"context"
 	"testing"
+	"time"
+	"nanotalon/bus"
 	"nanotalon/channels"
 )
 
+// fakeWhatsAppClient stands in for a linked WhatsApp session
+type fakeWhatsAppClient struct {
+	onMessage func(channels.WhatsAppMessage)
+	sent      map[string]string
+	read      []string
+}
+
+func (c *fakeWhatsAppClient) Login(ctx context.Context, onQR func(code string)) error {
+	onQR("2@fake-qr")
+	return nil
+}
+
+func (c *fakeWhatsAppClient) Connect(onMessage func(channels.WhatsAppMessage)) error {
+	c.onMessage = onMessage
+	return nil
+}
+
+func (c *fakeWhatsAppClient) SendText(chatID, text string) error {
+	if c.sent == nil {
+		c.sent = make(map[string]string)
+	}
+	c.sent[chatID] = text
+	return nil
+}
+
+func (c *fakeWhatsAppClient) SendTyping(chatID string) error {
+	return nil
+}
+
+func (c *fakeWhatsAppClient) MarkRead(chatID, senderID, messageID string) error {
+	c.read = append(c.read, chatID+"/"+senderID+"/"+messageID)
+	return nil
+}
+
+func (c *fakeWhatsAppClient) Disconnect() {}
+
 func TestWhatsAppChannel(t *testing.T) {
 	config := &channels.WhatsAppConfig{
 		Enabled:   true,
@@ -12,6 +51,8 @@ func TestWhatsAppChannel(t *testing.T) {
 	}
 
 	channel := channels.NewWhatsAppChannel(config)
+	client := &fakeWhatsAppClient{}
+	channel.SetClient(client)
 
 	if channel.Name() != "whatsapp" {
 		t.Errorf("Expected name 'whatsapp', got '%s'", channel.Name())
@@ -28,6 +69,9 @@ func TestWhatsAppChannel(t *testing.T) {
 	if err != nil {
 		t.Errorf("Send to allowed user failed: %v", err)
 	}
+	if client.sent["test-user"] != "Hello World" {
+		t.Errorf("Expected the message to go through the client, got %v", client.sent)
+	}
 
 	// Test send to disallowed user (with empty AllowFrom list it should pass)
 	channel.Config.AllowFrom = []string{}
@@ -63,4 +107,42 @@ func TestWhatsAppChannelDisabled(t *testing.T) {
 	if err == nil {
 		t.Error("Start should fail when channel is disabled")
 	}
-}
\ No newline at end of file
+}
+func TestWhatsAppInbound(t *testing.T) {
+	channel := channels.NewWhatsAppChannel(&channels.WhatsAppConfig{
+		Enabled:   true,
+		AllowFrom: []string{"+15551234567"},
+	})
+	client := &fakeWhatsAppClient{}
+	channel.SetClient(client)
+	messageBus := bus.NewMessageBus()
+	channel.SetMessageBus(messageBus)
+	if err := channel.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	client.onMessage(channels.WhatsAppMessage{SenderID: "15550000000", ChatID: "15550000000@s.whatsapp.net", Text: "spam"})
+	client.onMessage(channels.WhatsAppMessage{ID: "M1", SenderID: "15551234567", ChatID: "15551234567@s.whatsapp.net", Text: "hi"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := messageBus.ConsumeInboundContext(ctx)
+	if err != nil {
+		t.Fatalf("No inbound message published: %v", err)
+	}
+	if msg.Content != "hi" || msg.SessionKey != "whatsapp:15551234567@s.whatsapp.net" || msg.SenderID != "15551234567" {
+		t.Errorf("Unexpected inbound message: %+v", msg)
+	}
+
+	if err := channel.Send(msg.ChatID, "hello"); err != nil {
+		t.Errorf("Expected the reply to an allowed chat to be sent, got %v", err)
+	}
+
+	// Read receipts name the sender, which the channel remembers from the message
+	if err := channel.MarkRead(msg.ChatID, msg.Metadata[bus.MetadataMessageID].(string)); err != nil {
+		t.Fatalf("MarkRead failed: %v", err)
+	}
+	if len(client.read) != 1 || client.read[0] != "15551234567@s.whatsapp.net/15551234567/M1" {
+		t.Errorf("Unexpected read receipts: %v", client.read)
+	}
+}
@@ -0,0 +1,181 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mdp/qrterminal/v3"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/protobuf/proto"
+	_ "modernc.org/sqlite"
+)
+
+// whatsmeowClient is the WhatsApp client built on whatsmeow; the linked device's keys are
+// kept in a SQLite database
+type whatsmeowClient struct {
+	client *whatsmeow.Client
+}
+
+// NewWhatsAppClient opens the WhatsApp session stored at sessionPath, creating it if needed
+func NewWhatsAppClient(sessionPath string) (WhatsAppClient, error) {
+	if err := os.MkdirAll(filepath.Dir(sessionPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create whatsapp session directory: %w", err)
+	}
+
+	ctx := context.Background()
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", sessionPath)
+	container, err := sqlstore.New(ctx, "sqlite", dsn, waLog.Noop)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open whatsapp session: %w", err)
+	}
+	device, err := container.GetFirstDevice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load whatsapp device: %w", err)
+	}
+
+	return &whatsmeowClient{client: whatsmeow.NewClient(device, waLog.Noop)}, nil
+}
+
+// Login links a new session by QR code; an already linked session is kept
+func (c *whatsmeowClient) Login(ctx context.Context, onQR func(code string)) error {
+	if c.client.Store.ID != nil {
+		return nil
+	}
+
+	qrChan, err := c.client.GetQRChannel(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start pairing: %w", err)
+	}
+	if err := c.client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	for item := range qrChan {
+		switch item.Event {
+		case whatsmeow.QRChannelEventCode:
+			onQR(item.Code)
+		case whatsmeow.QRChannelSuccess.Event:
+			return nil
+		case whatsmeow.QRChannelTimeout.Event:
+			return fmt.Errorf("timed out waiting for the QR code to be scanned")
+		case whatsmeow.QRChannelEventError:
+			return fmt.Errorf("pairing failed: %w", item.Error)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("pairing ended before a QR code was scanned")
+}
+
+// Connect connects with the linked session and delivers incoming text messages to onMessage
+func (c *whatsmeowClient) Connect(onMessage func(WhatsAppMessage)) error {
+	if c.client.Store.ID == nil {
+		return fmt.Errorf("whatsapp is not linked yet; run `nanotalon channels login whatsapp` first")
+	}
+
+	c.client.AddEventHandler(func(evt interface{}) {
+		message, ok := evt.(*events.Message)
+		if !ok || message.Info.IsFromMe {
+			return
+		}
+		text := message.Message.GetConversation()
+		if text == "" {
+			text = message.Message.GetExtendedTextMessage().GetText()
+		}
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		onMessage(WhatsAppMessage{
+			ID:        message.Info.ID,
+			SenderID:  message.Info.Sender.User,
+			ChatID:    message.Info.Chat.String(),
+			Text:      text,
+			Mentioned: c.mentionsMe(message),
+		})
+	})
+
+	return c.client.Connect()
+}
+
+// mentionsMe reports whether a message mentions the linked account or replies to it
+func (c *whatsmeowClient) mentionsMe(message *events.Message) bool {
+	if c.client.Store.ID == nil {
+		return false
+	}
+	me := c.client.Store.ID.ToNonAD().String()
+	info := message.Message.GetExtendedTextMessage().GetContextInfo()
+	if info.GetParticipant() == me {
+		return true
+	}
+	for _, jid := range info.GetMentionedJID() {
+		if jid == me {
+			return true
+		}
+	}
+	return false
+}
+
+// SendText sends a text message to a chat JID or phone number
+func (c *whatsmeowClient) SendText(chatID, text string) error {
+	jid, err := parseWhatsAppJID(chatID)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.SendMessage(context.Background(), jid, &waE2E.Message{Conversation: proto.String(text)})
+	return err
+}
+
+// SendTyping shows the linked account as composing a message in a chat
+func (c *whatsmeowClient) SendTyping(chatID string) error {
+	jid, err := parseWhatsAppJID(chatID)
+	if err != nil {
+		return err
+	}
+	return c.client.SendChatPresence(context.Background(), jid, types.ChatPresenceComposing, types.ChatPresenceMediaText)
+}
+
+// MarkRead sends a read receipt for a message senderID sent in a chat
+func (c *whatsmeowClient) MarkRead(chatID, senderID, messageID string) error {
+	chat, err := parseWhatsAppJID(chatID)
+	if err != nil {
+		return err
+	}
+	sender, err := parseWhatsAppJID(senderID)
+	if err != nil {
+		return err
+	}
+	return c.client.MarkRead(context.Background(), []types.MessageID{messageID}, time.Now(), chat, sender)
+}
+
+// Disconnect closes the connection
+func (c *whatsmeowClient) Disconnect() {
+	c.client.Disconnect()
+}
+
+// parseWhatsAppJID accepts a full JID or a phone number for a one-to-one chat
+func parseWhatsAppJID(chatID string) (types.JID, error) {
+	if strings.Contains(chatID, "@") {
+		jid, err := types.ParseJID(chatID)
+		if err != nil {
+			return types.JID{}, fmt.Errorf("invalid chat ID %s: %w", chatID, err)
+		}
+		return jid, nil
+	}
+	return types.NewJID(whatsAppUser(chatID), types.DefaultUserServer), nil
+}
+
+// PrintQR renders a pairing QR code on a terminal
+func PrintQR(w io.Writer, code string) {
+	qrterminal.GenerateHalfBlock(code, qrterminal.L, w)
+}
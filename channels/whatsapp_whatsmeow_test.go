@@ -0,0 +1,70 @@
+package channels
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWhatsmeowClient(t *testing.T) {
+	sessionPath := filepath.Join(t.TempDir(), "whatsapp", "session.db")
+	client, err := NewWhatsAppClient(sessionPath)
+	if err != nil {
+		t.Fatalf("NewWhatsAppClient failed: %v", err)
+	}
+	defer client.Disconnect()
+
+	// A fresh session has no linked device to connect with
+	if err := client.Connect(func(WhatsAppMessage) {}); err == nil || !strings.Contains(err.Error(), "not linked yet") {
+		t.Errorf("Expected an unlinked session to refuse to connect, got %v", err)
+	}
+
+	// Mentions and replies to the linked account address it
+	wc := client.(*whatsmeowClient)
+	if wc.mentionsMe(&events.Message{Message: &waE2E.Message{}}) {
+		t.Error("Expected no mention before the device is linked")
+	}
+	wc.client.Store.ID = &types.JID{User: "15550001111", Device: 3, Server: types.DefaultUserServer}
+	me := "15550001111@s.whatsapp.net"
+	message := func(info *waE2E.ContextInfo) *events.Message {
+		return &events.Message{Message: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:        proto.String("hi"),
+			ContextInfo: info,
+		}}}
+	}
+	if !wc.mentionsMe(message(&waE2E.ContextInfo{MentionedJID: []string{"15550002222@s.whatsapp.net", me}})) {
+		t.Error("Expected a mention of the linked account")
+	}
+	if !wc.mentionsMe(message(&waE2E.ContextInfo{Participant: proto.String(me)})) {
+		t.Error("Expected a reply to the linked account")
+	}
+	if wc.mentionsMe(message(&waE2E.ContextInfo{MentionedJID: []string{"15550002222@s.whatsapp.net"}})) {
+		t.Error("Expected a mention of someone else not to count")
+	}
+}
+
+func TestParseWhatsAppJID(t *testing.T) {
+	cases := map[string]string{
+		"+15550001111":               "15550001111@s.whatsapp.net",
+		"15550001111@s.whatsapp.net": "15550001111@s.whatsapp.net",
+		"120363001234567890@g.us":    "120363001234567890@g.us",
+	}
+	for chatID, want := range cases {
+		jid, err := parseWhatsAppJID(chatID)
+		if err != nil || jid.String() != want {
+			t.Errorf("parseWhatsAppJID(%q) = %q, %v; want %q", chatID, jid.String(), err, want)
+		}
+	}
+
+	var out bytes.Buffer
+	PrintQR(&out, "2@pairing-code")
+	if out.Len() == 0 || strings.Contains(out.String(), "2@pairing-code") {
+		t.Errorf("Expected a QR code rather than the raw pairing code, got %q", out.String())
+	}
+}
@@ -0,0 +1,108 @@
+package clock
+
+import (
+	"time"
+)
+
+// Clock abstracts time so that time-based behavior (schedules, timers, waits)
+// can be driven deterministically in tests
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current time on the returned channel
+	After(d time.Duration) <-chan time.Time
+
+	// Sleep pauses the current goroutine for at least the duration
+	Sleep(d time.Duration)
+
+	// NewTicker returns a ticker that fires every d
+	NewTicker(d time.Duration) Ticker
+
+	// NewTimer returns a timer that fires once after d
+	NewTimer(d time.Duration) Timer
+
+	// AfterFunc calls f in its own goroutine after d; useful for debouncing
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker is the subset of time.Ticker used by the application
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer is the subset of time.Timer used by the application
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// realClock implements Clock using the standard library
+type realClock struct{}
+
+// New returns a Clock backed by the real system time
+func New() Clock {
+	return realClock{}
+}
+
+// Now returns the current time
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the duration to elapse
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Sleep pauses the current goroutine
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// NewTicker returns a real ticker
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(d)}
+}
+
+// NewTimer returns a real timer
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{timer: time.NewTimer(d)}
+}
+
+// AfterFunc calls f after d using a real timer
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return &realTimer{timer: time.AfterFunc(d, f)}
+}
+
+// realTicker wraps time.Ticker
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// realTimer wraps time.Timer
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t *realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (t *realTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
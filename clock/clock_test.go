@@ -0,0 +1,67 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"nanotalon/clock"
+)
+
+func TestFakeClockTimersAndTickers(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+
+	timer := fake.NewTimer(10 * time.Second)
+	ticker := fake.NewTicker(3 * time.Second)
+	defer ticker.Stop()
+
+	fired := false
+	fake.AfterFunc(5*time.Second, func() { fired = true })
+
+	fake.Advance(4 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("Timer fired too early")
+	default:
+	}
+	if got := <-ticker.C(); !got.Equal(start.Add(3 * time.Second)) {
+		t.Errorf("Ticker fired at %v, want %v", got, start.Add(3*time.Second))
+	}
+	if fired {
+		t.Error("AfterFunc ran too early")
+	}
+
+	fake.Advance(6 * time.Second)
+	if !fired {
+		t.Error("AfterFunc did not run")
+	}
+	if got := <-timer.C(); !got.Equal(start.Add(10 * time.Second)) {
+		t.Errorf("Timer fired at %v, want %v", got, start.Add(10*time.Second))
+	}
+	if !fake.Now().Equal(start.Add(10 * time.Second)) {
+		t.Errorf("Now() = %v, want %v", fake.Now(), start.Add(10*time.Second))
+	}
+
+	if timer.Stop() {
+		t.Error("Stop on a fired timer should report false")
+	}
+}
+
+func TestFakeClockSleep(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+
+	done := make(chan struct{})
+	go func() {
+		fake.Sleep(time.Minute)
+		close(done)
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sleep did not return after advancing the clock")
+	}
+}
@@ -0,0 +1,202 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a manually advanced Clock for tests. Timers, tickers and sleeps
+// only fire when Advance moves the clock past their deadline.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a pending timer, ticker or sleep registered with a FakeClock
+type fakeWaiter struct {
+	clock    *FakeClock
+	deadline time.Time
+	period   time.Duration // non-zero for tickers
+	ch       chan time.Time
+	fn       func() // set for AfterFunc timers
+	active   bool
+}
+
+// NewFake creates a fake clock starting at the given time
+func NewFake(start time.Time) *FakeClock {
+	fc := &FakeClock{now: start}
+	fc.cond = sync.NewCond(&fc.mu)
+	return fc
+}
+
+// Now returns the fake current time
+func (fc *FakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+// After returns a channel that receives once the clock is advanced past d
+func (fc *FakeClock) After(d time.Duration) <-chan time.Time {
+	return fc.NewTimer(d).C()
+}
+
+// Sleep blocks until the clock is advanced past d
+func (fc *FakeClock) Sleep(d time.Duration) {
+	<-fc.After(d)
+}
+
+// NewTicker returns a ticker that fires each time the clock advances by d
+func (fc *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return &fakeTicker{waiter: fc.addWaiter(d, d, nil)}
+}
+
+// NewTimer returns a timer that fires once the clock advances by d
+func (fc *FakeClock) NewTimer(d time.Duration) Timer {
+	return fc.addWaiter(d, 0, nil)
+}
+
+// AfterFunc calls f once the clock advances by d
+func (fc *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return fc.addWaiter(d, 0, f)
+}
+
+// Advance moves the clock forward, firing every timer and ticker that falls due
+// in deadline order. AfterFunc callbacks run synchronously before Advance returns.
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	target := fc.now.Add(d)
+
+	for {
+		next := fc.nextDueLocked(target)
+		if next == nil {
+			break
+		}
+
+		fc.now = next.deadline
+		fireAt := fc.now
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+		} else {
+			next.active = false
+			fc.removeLocked(next)
+		}
+
+		if next.fn != nil {
+			fc.mu.Unlock()
+			next.fn()
+			fc.mu.Lock()
+			continue
+		}
+
+		// Like the real implementations, drop the tick if the receiver hasn't caught up
+		select {
+		case next.ch <- fireAt:
+		default:
+		}
+	}
+
+	fc.now = target
+	fc.mu.Unlock()
+}
+
+// BlockUntil blocks until at least n timers, tickers or sleeps are waiting on the clock.
+// Tests use it to make sure a goroutine has registered its wait before calling Advance.
+func (fc *FakeClock) BlockUntil(n int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for len(fc.waiters) < n {
+		fc.cond.Wait()
+	}
+}
+
+// addWaiter registers a new pending timer or ticker
+func (fc *FakeClock) addWaiter(d, period time.Duration, fn func()) *fakeWaiter {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	w := &fakeWaiter{
+		clock:    fc,
+		deadline: fc.now.Add(d),
+		period:   period,
+		ch:       make(chan time.Time, 1),
+		fn:       fn,
+		active:   true,
+	}
+	fc.waiters = append(fc.waiters, w)
+	fc.cond.Broadcast()
+	return w
+}
+
+// nextDueLocked returns the earliest waiter due at or before target
+func (fc *FakeClock) nextDueLocked(target time.Time) *fakeWaiter {
+	var next *fakeWaiter
+	for _, w := range fc.waiters {
+		if w.deadline.After(target) {
+			continue
+		}
+		if next == nil || w.deadline.Before(next.deadline) {
+			next = w
+		}
+	}
+	return next
+}
+
+// removeLocked removes a waiter from the pending list
+func (fc *FakeClock) removeLocked(target *fakeWaiter) {
+	for i, w := range fc.waiters {
+		if w == target {
+			fc.waiters = append(fc.waiters[:i], fc.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// C returns the channel the waiter fires on
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+// Stop cancels the waiter, reporting whether it was still pending
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+
+	wasActive := w.active
+	w.active = false
+	w.clock.removeLocked(w)
+	return wasActive
+}
+
+// Reset reschedules the waiter to fire after d, reporting whether it was still pending
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+
+	wasActive := w.active
+	w.deadline = w.clock.now.Add(d)
+	if !wasActive {
+		w.active = true
+		w.clock.waiters = append(w.clock.waiters, w)
+		w.clock.cond.Broadcast()
+	}
+	return wasActive
+}
+
+// fakeTicker adapts a periodic waiter to the Ticker interface
+type fakeTicker struct {
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.waiter.Stop()
+}
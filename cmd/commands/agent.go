@@ -3,12 +3,12 @@ package commands
 import (
 	"bufio"
 	"fmt"
-	"log"
 	"os"
 	"strings"
 
 	"nanotalon/agent"
 	"nanotalon/config"
+	"nanotalon/logging"
 
 	"github.com/spf13/cobra"
 )
@@ -27,11 +27,6 @@ or by providing a single message.`,
 		markdown, _ := cmd.Flags().GetBool("markdown")
 		showLogs, _ := cmd.Flags().GetBool("logs")
 
-		// Set up logging based on flag
-		if !showLogs {
-			log.SetOutput(os.Stdout)
-		}
-
 		// Load configuration
 		cfg, err := config.LoadConfig()
 		if err != nil {
@@ -39,12 +34,23 @@ or by providing a single message.`,
 			os.Exit(1)
 		}
 
+		// Without --logs, only errors reach the terminal; a log file gets everything
+		if !showLogs && cfg.Logging.File == "" {
+			cfg.Logging.Level = "error"
+		}
+		if err := logging.Setup(cfg.Logging); err != nil {
+			fmt.Fprintf(os.Stderr, "Error setting up logging: %v\n", err)
+			os.Exit(1)
+		}
+		defer logging.Close()
+
 		// Initialize agent
 		agentLoop, err := agent.NewAgentLoop(cfg)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error initializing agent: %v\n", err)
 			os.Exit(1)
 		}
+		defer agentLoop.Stop()
 
 		if message != "" {
 			// Single message mode
@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"nanotalon/audit"
+	"nanotalon/config"
+
+	"github.com/spf13/cobra"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the tool call audit log",
+	Long:  `Show recorded tool invocations, optionally filtered by tool, session, channel or time.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		tool, _ := cmd.Flags().GetString("tool")
+		sessionKey, _ := cmd.Flags().GetString("session")
+		channel, _ := cmd.Flags().GetString("channel")
+		since, _ := cmd.Flags().GetDuration("since")
+		errorsOnly, _ := cmd.Flags().GetBool("errors")
+		limit, _ := cmd.Flags().GetInt("limit")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+
+		filter := audit.Filter{
+			Tool:       tool,
+			Session:    sessionKey,
+			Channel:    channel,
+			ErrorsOnly: errorsOnly,
+			Limit:      limit,
+		}
+		if since > 0 {
+			filter.Since = time.Now().Add(-since)
+		}
+
+		entries, err := audit.ReadEntries(audit.DefaultPath(cfg.GetWorkspacePath()), filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading audit log: %v\n", err)
+			os.Exit(1)
+		}
+
+		if asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			for _, entry := range entries {
+				encoder.Encode(entry)
+			}
+			return
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("No audit entries.")
+			return
+		}
+
+		for _, entry := range entries {
+			status := "ok"
+			if entry.Error != "" {
+				status = "error"
+			}
+
+			fmt.Printf("%s  %s  %s  (%dms, %s)\n", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Session, entry.Tool, entry.DurationMS, status)
+			if len(entry.Args) > 0 {
+				argsBytes, _ := json.Marshal(entry.Args)
+				fmt.Printf("  Args: %s\n", argsBytes)
+			}
+			if entry.Error != "" {
+				fmt.Printf("  Error: %s\n", entry.Error)
+			} else if entry.Result != "" {
+				fmt.Printf("  Result: %s\n", oneLine(entry.Result, 200))
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().String("tool", "", "Only show calls to this tool")
+	auditCmd.Flags().String("session", "", "Only show calls from this session (e.g. 'cli:direct')")
+	auditCmd.Flags().String("channel", "", "Only show calls from this channel (e.g. 'telegram')")
+	auditCmd.Flags().Duration("since", 0, "Only show calls within this duration (e.g. '24h')")
+	auditCmd.Flags().Bool("errors", false, "Only show failed calls")
+	auditCmd.Flags().IntP("limit", "n", 50, "Show at most N most recent entries (0 for all)")
+	auditCmd.Flags().Bool("json", false, "Print raw JSONL entries")
+}
+
+// oneLine collapses whitespace and shortens text for single-line display
+func oneLine(text string, maxLen int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > maxLen {
+		return text[:maxLen] + "..."
+	}
+	return text
+}
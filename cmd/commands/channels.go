@@ -1,9 +1,12 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 
+	"nanotalon/channels"
 	"nanotalon/config"
 
 	"github.com/spf13/cobra"
@@ -139,6 +142,77 @@ var channelsStatusCmd = &cobra.Command{
 			emailConfig = cfg.Channels.Email.IMAPHost
 		}
 		fmt.Printf("  %-12s %s (%s)\n", "Email", enabled, emailConfig)
+
+		// Mattermost
+		enabled = "✗"
+		if cfg.Channels.Mattermost.Enabled {
+			enabled = "✓"
+		}
+		mattermostConfig := "[not configured]"
+		if cfg.Channels.Mattermost.URL != "" {
+			mattermostConfig = cfg.Channels.Mattermost.URL
+		}
+		fmt.Printf("  %-12s %s (%s)\n", "Mattermost", enabled, mattermostConfig)
+
+		// Rocket.Chat
+		enabled = "✗"
+		if cfg.Channels.RocketChat.Enabled {
+			enabled = "✓"
+		}
+		rocketchatConfig := "[not configured]"
+		if cfg.Channels.RocketChat.URL != "" {
+			rocketchatConfig = cfg.Channels.RocketChat.URL
+		}
+		fmt.Printf("  %-12s %s (%s)\n", "Rocket.Chat", enabled, rocketchatConfig)
+	},
+}
+
+// channelsLoginCmd represents the channels login command
+var channelsLoginCmd = &cobra.Command{
+	Use:   "login <channel>",
+	Short: "Link a channel account",
+	Long: `Link a channel that signs in as a device rather than with a token.
+
+For WhatsApp, scan the QR code with WhatsApp on your phone (Settings → Linked devices
+→ Link a device). The session is saved to channels.whatsapp.session_path and used by
+the gateway from then on.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if args[0] != "whatsapp" {
+			fmt.Fprintf(os.Stderr, "Error: %s doesn't need a login; configure its token instead\n", args[0])
+			os.Exit(1)
+		}
+
+		// Load configuration
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+
+		sessionPath := cfg.Channels.WhatsApp.SessionPath
+		if sessionPath == "" {
+			sessionPath = channels.DefaultWhatsAppSessionPath()
+		}
+		client, err := channels.NewWhatsAppClient(sessionPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer client.Disconnect()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		err = client.Login(ctx, func(code string) {
+			fmt.Println("Scan this QR code with WhatsApp (Settings → Linked devices → Link a device):")
+			channels.PrintQR(os.Stdout, code)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error linking WhatsApp: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ WhatsApp is linked (session saved to %s)\n", sessionPath)
 	},
 }
 
@@ -147,4 +221,5 @@ func init() {
 
 	// Add subcommands
 	channelsCmd.AddCommand(channelsStatusCmd)
+	channelsCmd.AddCommand(channelsLoginCmd)
 }
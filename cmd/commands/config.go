@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"nanotalon/config"
+
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Read, change and check the configuration",
+	Long: `Read, change and check the configuration file (see --config), with the files in
+config.d next to it and the selected profile (see --profile) merged over it.
+
+Keys are dotted paths into the file, such as agents.defaults.model,
+channels.telegram.allow_from or tools.mcp_servers.github.command.`,
+}
+
+// configGetCmd represents the config get command
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a key",
+	Long:  `Print the value a key takes: the config file's, or the default when the file doesn't set it.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := mustLoadConfig()
+		value, err := config.Get(cfg, args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(value)
+	},
+}
+
+// configSetCmd represents the config set command
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a key in the config file",
+	Long: `Set a key in the config file, keeping its other settings and comments. With --profile,
+the key is set in the profile's file, which is created if needed.
+
+The value must suit the key: true or false, a number, or text. Lists are
+comma-separated or written as YAML ([a, b]), maps as YAML ({name: value}).`,
+	Example: `  nanotalon config set agents.defaults.model openai/gpt-4o
+  nanotalon config set channels.telegram.allow_from "123456789, @alice"
+  nanotalon config set gateway.heartbeat.enabled false`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := args[0]
+		value, err := config.ParseValue(key, args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		path, err := config.ConfigPath()
+		if name := config.Profile(); name != "" {
+			path, err = config.ProfilePath(name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding config file: %v\n", err)
+			os.Exit(1)
+		}
+		if err := config.SetValue(path, key, value); err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Set %s in %s\n", key, path)
+		fmt.Println("A running gateway applies the change right away, or logs that it needs a restart.")
+	},
+}
+
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show [key]",
+	Short: "Print the effective configuration, with secrets redacted",
+	Long: `Print the effective configuration: the config file merged with the defaults. API keys,
+tokens, passwords and other secrets are redacted, so the output can be shared. A key
+limits it to one section, such as gateway.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := mustLoadConfig()
+		key := ""
+		if len(args) > 0 {
+			key = args[0]
+		}
+		data, err := config.Show(cfg, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(string(data))
+	},
+}
+
+// configValidateCmd represents the config validate command
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file for unknown keys and invalid values",
+	Long: `Check the config file, the config.d files and the profile against the configuration
+schema, listing unknown keys and values of the wrong type with their line numbers, then
+check the merged settings themselves.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := config.ConfigPath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding config file: %v\n", err)
+			os.Exit(1)
+		}
+		overlays, err := config.OverlayPaths()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		problems := 0
+		for _, file := range append([]string{path}, overlays...) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading config file: %v\n", err)
+				os.Exit(1)
+			}
+			for _, e := range config.Validate(data) {
+				problem := e.Message
+				if e.Key != "" {
+					problem = e.Key + ": " + problem
+				}
+				fmt.Fprintf(os.Stderr, "%s:%d: %s\n", file, e.Line, problem)
+				problems++
+			}
+		}
+		if problems > 0 {
+			fmt.Fprintf(os.Stderr, "%d problem(s) found\n", problems)
+			os.Exit(1)
+		}
+		// Checks that span keys, such as an MCP server's command or URL
+		if _, err := config.LoadConfig(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			os.Exit(1)
+		}
+		for _, file := range append([]string{path}, overlays...) {
+			fmt.Printf("✓ %s is valid\n", file)
+		}
+	},
+}
+
+// mustLoadConfig loads the configuration, exiting on error
+func mustLoadConfig() *config.Config {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+}
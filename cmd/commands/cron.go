@@ -3,9 +3,11 @@ package commands
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
-	"nanotalon/config"
 	"nanotalon/cron"
 
 	"github.com/spf13/cobra"
@@ -26,24 +28,20 @@ var cronListCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		all, _ := cmd.Flags().GetBool("all")
 
-		// Load config to get store path
-		cfg, err := config.LoadConfig()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-			os.Exit(1)
-		}
-
-		dataDir := cfg.GetWorkspacePath() // Use workspace path for simplicity
-		storePath := fmt.Sprintf("%s/data/cron/jobs.json", dataDir)
-
-		// Create cron service
-		service, err := cron.NewCronService(storePath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error initializing cron service: %v\n", err)
-			os.Exit(1)
+		var jobs []*cron.CronJob
+		if gateway := remote(); gateway != nil {
+			var response struct {
+				Jobs []*cron.CronJob `json:"jobs"`
+			}
+			mustRemote(gateway.get("/v1/jobs", &response))
+			for _, job := range response.Jobs {
+				if all || job.Enabled {
+					jobs = append(jobs, job)
+				}
+			}
+		} else {
+			jobs = openCronService().ListJobs(all)
 		}
-
-		jobs := service.ListJobs(all)
 		if len(jobs) == 0 {
 			fmt.Println("No scheduled jobs.")
 			return
@@ -69,7 +67,18 @@ var cronListCmd = &cobra.Command{
 				atTime := time.UnixMilli(job.Schedule.AtMS)
 				fmt.Printf("  At: %s\n", atTime.Format("2006-01-02 15:04:05"))
 			}
-			fmt.Printf("  Message: %s\n", job.Payload.Message)
+			if job.State.NextRunAtMS != nil {
+				nextRun := time.UnixMilli(*job.State.NextRunAtMS)
+				fmt.Printf("  Next run: %s\n", nextRun.Format("2006-01-02 15:04:05 MST"))
+			}
+			if run := job.State.LastRun(); run != nil && run.Status == "error" {
+				fmt.Printf("  Last run failed: %s\n", run.Error)
+			}
+			if job.Payload.Template != "" {
+				fmt.Printf("  Template: %s%s\n", job.Payload.Template, formatTemplateArgs(job.Payload.Args))
+			} else {
+				fmt.Printf("  Message: %s\n", job.Payload.Message)
+			}
 			fmt.Println()
 		}
 	},
@@ -83,78 +92,179 @@ var cronAddCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		name, _ := cmd.Flags().GetString("name")
 		message, _ := cmd.Flags().GetString("message")
-		every, _ := cmd.Flags().GetInt("every")
-		cronExpr, _ := cmd.Flags().GetString("cron")
-		tz, _ := cmd.Flags().GetString("tz")
-		at, _ := cmd.Flags().GetString("at")
 		deliver, _ := cmd.Flags().GetBool("deliver")
 		to, _ := cmd.Flags().GetString("to")
 		channel, _ := cmd.Flags().GetString("channel")
-
-		if tz != "" && cronExpr == "" {
-			fmt.Fprintf(os.Stderr, "Error: --tz can only be used with --cron\n")
+		catchUp, _ := cmd.Flags().GetString("catch-up")
+		overlap, _ := cmd.Flags().GetString("overlap")
+		jitter, _ := cmd.Flags().GetInt("jitter")
+		template, _ := cmd.Flags().GetString("template")
+		templateArgs := mustTemplateArgs(cmd)
+
+		if message == "" && template == "" {
+			fmt.Fprintf(os.Stderr, "Error: Must specify --message or --template\n")
 			os.Exit(1)
 		}
+		if message == "" {
+			message = fmt.Sprintf("Run the %s subagent template", template)
+		}
 
-		// Create schedule based on inputs
-		var schedule cron.CronSchedule
-		if every > 0 {
-			everyMS := int64(every * 1000)
-			schedule = cron.CronSchedule{
-				Kind:    "every",
-				EveryMS: &everyMS,
-			}
-		} else if cronExpr != "" {
-			schedule = cron.CronSchedule{
-				Kind: "cron",
-				Expr: cronExpr,
-				Tz:   tz,
-			}
-		} else if at != "" {
-			// Parse ISO time format
-			dt, err := time.Parse(time.RFC3339, at)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error parsing time: %v\n", err)
-				os.Exit(1)
-			}
-			atMS := dt.UnixMilli()
-			schedule = cron.CronSchedule{
-				Kind: "at",
-				AtMS: atMS,
-			}
-		} else {
+		schedule, ok := scheduleFromFlags(cmd)
+		if !ok {
 			fmt.Fprintf(os.Stderr, "Error: Must specify --every, --cron, or --at\n")
 			os.Exit(1)
 		}
+		schedule.CatchUp = catchUp
+		schedule.Overlap = overlap
+		schedule.JitterMS = int64(jitter) * 1000
+
+		service := openCronService()
 
-		// Load config to get store path
-		cfg, err := config.LoadConfig()
+		// Add job
+		job, err := service.AddJob(name, schedule, message, deliver, to, channel, false)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error adding job: %v\n", err)
 			os.Exit(1)
 		}
+		if template != "" {
+			if job, err = service.UpdateJob(job.ID, cron.JobUpdate{Template: &template, Args: &templateArgs}); err != nil {
+				fmt.Fprintf(os.Stderr, "Error adding job: %v\n", err)
+				os.Exit(1)
+			}
+		}
 
-		dataDir := cfg.GetWorkspacePath() // Use workspace path for simplicity
-		storePath := fmt.Sprintf("%s/data/cron/jobs.json", dataDir)
+		fmt.Printf("Added job '%s' (id: %s)\n", job.Name, job.ID)
+	},
+}
 
-		// Create cron service
-		service, err := cron.NewCronService(storePath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error initializing cron service: %v\n", err)
+// cronUpdateCmd represents the cron update command
+var cronUpdateCmd = &cobra.Command{
+	Use:   "update [job-id]",
+	Short: "Update a scheduled job",
+	Long: `Update the schedule, message or delivery of a scheduled job.
+
+Only the given flags change; a new --every, --cron or --at replaces the whole schedule.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		jobID := args[0]
+		service := openCronService()
+
+		current := service.GetJob(jobID)
+		if current == nil {
+			fmt.Printf("Job %s not found\n", jobID)
+			return
+		}
+
+		var update cron.JobUpdate
+		flags := cmd.Flags()
+		if flags.Changed("name") {
+			name, _ := flags.GetString("name")
+			update.Name = &name
+		}
+		if flags.Changed("message") {
+			message, _ := flags.GetString("message")
+			update.Message = &message
+		}
+		if flags.Changed("deliver") {
+			deliver, _ := flags.GetBool("deliver")
+			update.Deliver = &deliver
+		}
+		if flags.Changed("to") {
+			to, _ := flags.GetString("to")
+			update.To = &to
+		}
+		if flags.Changed("channel") {
+			channel, _ := flags.GetString("channel")
+			update.Channel = &channel
+		}
+		if flags.Changed("template") {
+			template, _ := flags.GetString("template")
+			update.Template = &template
+		}
+		if flags.Changed("arg") {
+			templateArgs := mustTemplateArgs(cmd)
+			update.Args = &templateArgs
+		}
+
+		// Policies carry over to a new schedule unless they are changed too
+		schedule, ok := scheduleFromFlags(cmd)
+		if !ok {
+			schedule = current.Schedule
+		} else {
+			schedule.CatchUp = current.Schedule.CatchUp
+			schedule.Overlap = current.Schedule.Overlap
+			schedule.JitterMS = current.Schedule.JitterMS
+		}
+		if flags.Changed("catch-up") {
+			schedule.CatchUp, _ = flags.GetString("catch-up")
+		}
+		if flags.Changed("overlap") {
+			schedule.Overlap, _ = flags.GetString("overlap")
+		}
+		if flags.Changed("jitter") {
+			jitter, _ := flags.GetInt("jitter")
+			schedule.JitterMS = int64(jitter) * 1000
+		}
+		if ok || flags.Changed("catch-up") || flags.Changed("overlap") || flags.Changed("jitter") {
+			update.Schedule = &schedule
+		}
+
+		if update == (cron.JobUpdate{}) {
+			fmt.Fprintf(os.Stderr, "Error: Nothing to update\n")
 			os.Exit(1)
 		}
 
-		// Add job
-		job, err := service.AddJob(name, schedule, message, deliver, to, channel, false)
+		job, err := service.UpdateJob(jobID, update)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error adding job: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error updating job: %v\n", err)
 			os.Exit(1)
 		}
 
-		fmt.Printf("Added job '%s' (id: %s)\n", job.Name, job.ID)
+		fmt.Printf("Updated job '%s' (id: %s)\n", job.Name, job.ID)
 	},
 }
 
+// scheduleFromFlags builds a schedule from the --every, --cron, --tz and --at flags,
+// reporting false if none of them is set. It exits on invalid flags.
+func scheduleFromFlags(cmd *cobra.Command) (cron.CronSchedule, bool) {
+	every, _ := cmd.Flags().GetInt("every")
+	cronExpr, _ := cmd.Flags().GetString("cron")
+	tz, _ := cmd.Flags().GetString("tz")
+	at, _ := cmd.Flags().GetString("at")
+
+	if tz != "" && cronExpr == "" {
+		fmt.Fprintf(os.Stderr, "Error: --tz can only be used with --cron\n")
+		os.Exit(1)
+	}
+
+	// Create schedule based on inputs
+	if every > 0 {
+		everyMS := int64(every * 1000)
+		return cron.CronSchedule{
+			Kind:    "every",
+			EveryMS: &everyMS,
+		}, true
+	} else if cronExpr != "" {
+		return cron.CronSchedule{
+			Kind: "cron",
+			Expr: cronExpr,
+			Tz:   tz,
+		}, true
+	} else if at != "" {
+		// Parse ISO time format
+		dt, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing time: %v\n", err)
+			os.Exit(1)
+		}
+		return cron.CronSchedule{
+			Kind: "at",
+			AtMS: dt.UnixMilli(),
+		}, true
+	}
+	return cron.CronSchedule{}, false
+}
+
 // cronRemoveCmd represents the cron remove command
 var cronRemoveCmd = &cobra.Command{
 	Use:   "remove [job-id]",
@@ -164,22 +274,7 @@ var cronRemoveCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		jobID := args[0]
 
-		// Load config to get store path
-		cfg, err := config.LoadConfig()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-			os.Exit(1)
-		}
-
-		dataDir := cfg.GetWorkspacePath() // Use workspace path for simplicity
-		storePath := fmt.Sprintf("%s/data/cron/jobs.json", dataDir)
-
-		// Create cron service
-		service, err := cron.NewCronService(storePath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error initializing cron service: %v\n", err)
-			os.Exit(1)
-		}
+		service := openCronService()
 
 		if service.RemoveJob(jobID) {
 			fmt.Printf("Removed job %s\n", jobID)
@@ -199,22 +294,7 @@ var cronEnableCmd = &cobra.Command{
 		jobID := args[0]
 		disable, _ := cmd.Flags().GetBool("disable")
 
-		// Load config to get store path
-		cfg, err := config.LoadConfig()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-			os.Exit(1)
-		}
-
-		dataDir := cfg.GetWorkspacePath() // Use workspace path for simplicity
-		storePath := fmt.Sprintf("%s/data/cron/jobs.json", dataDir)
-
-		// Create cron service
-		service, err := cron.NewCronService(storePath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error initializing cron service: %v\n", err)
-			os.Exit(1)
-		}
+		service := openCronService()
 
 		job := service.EnableJob(jobID, !disable)
 		if job != nil {
@@ -229,6 +309,87 @@ var cronEnableCmd = &cobra.Command{
 	},
 }
 
+// cronHistoryCmd represents the cron history command
+var cronHistoryCmd = &cobra.Command{
+	Use:   "history [job-id]",
+	Short: "Show recent runs of a job",
+	Long:  `Show the most recent runs of a scheduled job, newest first.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		jobID := args[0]
+		service := openCronService()
+
+		job := service.GetJob(jobID)
+		if job == nil {
+			fmt.Printf("Job %s not found\n", jobID)
+			return
+		}
+		if len(job.State.Runs) == 0 {
+			fmt.Printf("Job '%s' hasn't run yet.\n", job.Name)
+			return
+		}
+
+		fmt.Printf("Runs of '%s' (id: %s):\n", job.Name, job.ID)
+		for i := len(job.State.Runs) - 1; i >= 0; i-- {
+			run := job.State.Runs[i]
+			startedAt := time.UnixMilli(run.StartedAtMS)
+			duration := time.Duration(run.DurationMS) * time.Millisecond
+			fmt.Printf("- %s (%s, took %s)\n", startedAt.Format("2006-01-02 15:04:05 MST"), run.Status, duration)
+			if run.Error != "" {
+				fmt.Printf("  Error: %s\n", run.Error)
+			}
+			if run.Response != "" {
+				fmt.Printf("  Response: %s\n", run.Response)
+			}
+		}
+	},
+}
+
+// mustTemplateArgs parses the --arg key=value flags, exiting if one has no value
+func mustTemplateArgs(cmd *cobra.Command) map[string]string {
+	pairs, _ := cmd.Flags().GetStringArray("arg")
+	templateArgs := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Error: --arg must look like key=value, got %q\n", pair)
+			os.Exit(1)
+		}
+		templateArgs[key] = value
+	}
+	return templateArgs
+}
+
+// formatTemplateArgs shows template arguments as " key=value ...", sorted by key
+func formatTemplateArgs(templateArgs map[string]string) string {
+	keys := make([]string, 0, len(templateArgs))
+	for key := range templateArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var formatted strings.Builder
+	for _, key := range keys {
+		formatted.WriteString(" " + key + "=" + templateArgs[key])
+	}
+	return formatted.String()
+}
+
+// cronStorePath returns where the gateway keeps its scheduled jobs
+func cronStorePath() string {
+	return filepath.Join(os.Getenv("HOME"), ".nanotalon", "data", "cron", "jobs.json")
+}
+
+// openCronService opens the gateway's job store, exiting if it can't be read
+func openCronService() *cron.CronService {
+	service, err := cron.NewCronService(cronStorePath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing cron service: %v\n", err)
+		os.Exit(1)
+	}
+	return service
+}
+
 func init() {
 	rootCmd.AddCommand(cronCmd)
 
@@ -237,13 +398,16 @@ func init() {
 	cronCmd.AddCommand(cronAddCmd)
 	cronCmd.AddCommand(cronRemoveCmd)
 	cronCmd.AddCommand(cronEnableCmd)
+	cronCmd.AddCommand(cronHistoryCmd)
+	cronCmd.AddCommand(cronUpdateCmd)
+	supportsRemote(cronListCmd)
 
 	// Cron list flags
 	cronListCmd.Flags().Bool("all", false, "Include disabled jobs")
 
 	// Cron add flags
 	cronAddCmd.Flags().StringP("name", "n", "", "Job name (required)")
-	cronAddCmd.Flags().StringP("message", "m", "", "Message for agent (required)")
+	cronAddCmd.Flags().StringP("message", "m", "", "Message for agent (required without --template)")
 	cronAddCmd.Flags().IntP("every", "e", 0, "Run every N seconds")
 	cronAddCmd.Flags().StringP("cron", "c", "", "Cron expression (e.g. '0 9 * * *')")
 	cronAddCmd.Flags().String("tz", "", "IANA timezone for cron (e.g. 'America/Vancouver')")
@@ -251,10 +415,30 @@ func init() {
 	cronAddCmd.Flags().Bool("deliver", false, "Deliver response to channel")
 	cronAddCmd.Flags().String("to", "", "Recipient for delivery")
 	cronAddCmd.Flags().String("channel", "", "Channel for delivery (e.g. 'telegram', 'whatsapp')")
+	cronAddCmd.Flags().String("overlap", "", "When triggered while the last run is still going: skip, delay or allow (default: skip)")
+	cronAddCmd.Flags().Int("jitter", 0, "Start scheduled runs up to N seconds late, at random")
+	cronAddCmd.Flags().String("catch-up", "", "Runs missed while the gateway was down: skip, run_once or run_all (default: run_once for --at, skip otherwise)")
+	cronAddCmd.Flags().String("template", "", "Spawn a subagent from this workspace template instead of messaging the agent")
+	cronAddCmd.Flags().StringArray("arg", nil, "Template parameter as key=value (repeatable)")
+
+	// Cron update flags
+	cronUpdateCmd.Flags().StringP("name", "n", "", "New job name")
+	cronUpdateCmd.Flags().StringP("message", "m", "", "New message for agent")
+	cronUpdateCmd.Flags().IntP("every", "e", 0, "Run every N seconds instead")
+	cronUpdateCmd.Flags().StringP("cron", "c", "", "Cron expression to run on instead (e.g. '0 9 * * *')")
+	cronUpdateCmd.Flags().String("tz", "", "IANA timezone for cron (e.g. 'America/Vancouver')")
+	cronUpdateCmd.Flags().String("at", "", "Run once at time instead (ISO format, e.g. '2026-02-12T10:30:00Z')")
+	cronUpdateCmd.Flags().Bool("deliver", false, "Deliver response to channel (--deliver=false to stop)")
+	cronUpdateCmd.Flags().String("to", "", "Recipient for delivery")
+	cronUpdateCmd.Flags().String("channel", "", "Channel for delivery (e.g. 'telegram', 'whatsapp')")
+	cronUpdateCmd.Flags().String("overlap", "", "When triggered while the last run is still going: skip, delay or allow")
+	cronUpdateCmd.Flags().Int("jitter", 0, "Start scheduled runs up to N seconds late, at random")
+	cronUpdateCmd.Flags().String("catch-up", "", "Runs missed while the gateway was down: skip, run_once or run_all")
+	cronUpdateCmd.Flags().String("template", "", "Subagent template to spawn instead (empty to message the agent again)")
+	cronUpdateCmd.Flags().StringArray("arg", nil, "Template parameter as key=value (repeatable); replaces all of them")
 
 	// Mark required flags
 	cronAddCmd.MarkFlagRequired("name")
-	cronAddCmd.MarkFlagRequired("message")
 
 	// Cron enable flags
 	cronEnableCmd.Flags().Bool("disable", false, "Disable instead of enable")
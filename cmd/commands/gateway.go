@@ -1,17 +1,27 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"nanotalon/agent"
+	"nanotalon/api"
 	"nanotalon/bus"
 	"nanotalon/channels"
 	"nanotalon/config"
 	"nanotalon/cron"
 	"nanotalon/heartbeat"
+	"nanotalon/logging"
 	"nanotalon/session"
 
 	"github.com/spf13/cobra"
@@ -26,15 +36,8 @@ var gatewayCmd = &cobra.Command{
 The gateway combines all nanotalon services including the agent, channels,
 scheduled tasks, and heartbeat services.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		port, _ := cmd.Flags().GetInt("port")
 		verbose, _ := cmd.Flags().GetBool("verbose")
 
-		if verbose {
-			log.SetOutput(os.Stdout)
-		}
-
-		fmt.Printf("🐈 Starting nanotalon gateway on port %d...\n", port)
-
 		// Load configuration
 		cfg, err := config.LoadConfig()
 		if err != nil {
@@ -42,8 +45,26 @@ scheduled tasks, and heartbeat services.`,
 			os.Exit(1)
 		}
 
+		// --verbose logs at debug level, whatever logging.level says
+		if verbose {
+			cfg.Logging.Level = "debug"
+		}
+		if err := logging.Setup(cfg.Logging); err != nil {
+			fmt.Fprintf(os.Stderr, "Error setting up logging: %v\n", err)
+			os.Exit(1)
+		}
+		defer logging.Close()
+
+		// The flag overrides gateway.port
+		port := cfg.Gateway.Port
+		if cmd.Flags().Changed("port") {
+			port, _ = cmd.Flags().GetInt("port")
+		}
+
+		fmt.Printf("🐈 Starting nanotalon gateway on port %d...\n", port)
+
 		// Initialize message bus
-		_ = bus.NewMessageBus() // For now, just declare but not use it
+		messageBus := bus.NewMessageBus()
 
 		// Initialize provider and agent
 		agentLoop, err := agent.NewAgentLoop(cfg)
@@ -51,39 +72,62 @@ scheduled tasks, and heartbeat services.`,
 			fmt.Fprintf(os.Stderr, "Error initializing agent: %v\n", err)
 			os.Exit(1)
 		}
+		agentLoop.SetMessageBus(messageBus)
+
+		// Background tasks outlive a restart; the gateway is the one process that runs them
+		if err := agentLoop.RestoreSubagents(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not restore subagent tasks: %v\n", err)
+		}
+
+		// Each step of every turn is logged at debug level
+		go logAgentEvents(agentLoop.Events())
 
 		// Initialize session manager
-		sessionManager := session.NewSessionManager(cfg.GetWorkspacePath())
+		sessionStore, err := session.NewStore(cfg.Session, cfg.GetWorkspacePath())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing session store: %v\n", err)
+			os.Exit(1)
+		}
+		sessionManager := session.NewSessionManagerWithStore(cfg.GetWorkspacePath(), sessionStore)
 
 		// Initialize cron service
-		dataDir := filepath.Join(os.Getenv("HOME"), ".nanotalon", "data")
-		cronStorePath := filepath.Join(dataDir, "cron", "jobs.json")
-		cronService, err := cron.NewCronService(cronStorePath)
+		cronService, err := cron.NewCronService(cronStorePath())
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error initializing cron service: %v\n", err)
 			os.Exit(1)
 		}
-
-		// Set cron callback
-		cronService.SetOnJobCallback(func(job *cron.CronJob) (string, error) {
-			response, err := agentLoop.ProcessDirect(job.Payload.Message, fmt.Sprintf("cron:%s", job.ID))
-			if err != nil {
-				return "", err
-			}
-
-			if job.Payload.Deliver && job.Payload.To != "" {
-				// In a real implementation, send the response via the appropriate channel
-				fmt.Printf("Cron job result delivered to %s:%s\n", job.Payload.Channel, job.Payload.To)
-			}
-
-			return response, nil
-		})
+		cronService.SetMaxConcurrent(cfg.Gateway.Cron.MaxConcurrent)
+		quiet := cfg.Gateway.Cron.QuietHours
+		quietHours, err := cron.ParseQuietHours(quiet.Start, quiet.End, quiet.Timezone)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in gateway.cron.quiet_hours: %v\n", err)
+			os.Exit(1)
+		}
+		cronService.SetQuietHours(quietHours)
 
 		// Add cron service to agent
 		agentLoop.SetCronService(cronService)
 
-		// Initialize channel manager
+		// Initialize channel manager; incoming messages go to the agent over the bus
 		channelManager := channels.NewManager(cfg)
+		channelManager.SetMessageBus(messageBus)
+
+		// Set cron callbacks; a failed delivery marks the run as failed
+		cronService.SetOnJobCallback(func(job *cron.CronJob) (string, error) {
+			if job.Payload.Template != "" {
+				// The subagent announces its result in the delivery chat once it finishes
+				var channel, chatID string
+				if targets := cronTargets(job.Payload); job.Payload.Deliver && len(targets) > 0 {
+					channel, chatID = targets[0].Channel, targets[0].ChatID
+				}
+				_, err := agentLoop.SpawnTemplate(job.Payload.Template, job.Payload.Args, channel, chatID)
+				return "", err
+			}
+			return agentLoop.ProcessDirect(job.Payload.Message, fmt.Sprintf("cron:%s", job.ID))
+		})
+		cronService.SetOnDeliverCallback(func(job *cron.CronJob, response string) error {
+			return channelManager.SendWithFallback(response, cronTargets(job.Payload))
+		})
 
 		// Helper function to pick heartbeat target
 		pickHeartbeatTarget := func() (string, string) {
@@ -129,15 +173,11 @@ scheduled tasks, and heartbeat services.`,
 				return response, err
 			},
 			func(response string) error {
-				// Delivery mechanism would go here
 				channel, chatID := pickHeartbeatTarget()
 				if channel == "cli" {
 					return nil // No external channel available
 				}
-
-				// In a real implementation, send the heartbeat response to the user's channel
-				fmt.Printf("Heartbeat response delivered to %s:%s\n", channel, chatID)
-				return nil
+				return channelManager.Broadcast(response, []channels.Target{{Channel: channel, ChatID: chatID}})
 			},
 			cfg.Gateway.Heartbeat.IntervalS,
 			cfg.Gateway.Heartbeat.Enabled,
@@ -154,6 +194,9 @@ scheduled tasks, and heartbeat services.`,
 		cronStatus := cronService.Status()
 		if jobs, ok := cronStatus["jobs"].(int); ok && jobs > 0 {
 			fmt.Printf("[✓] Cron: %d scheduled jobs\n", jobs)
+			if next, ok := cronStatus["next_run_at_ms"].(int64); ok {
+				fmt.Printf("[✓] Cron: next run at %s\n", time.UnixMilli(next).Format("2006-01-02 15:04:05 MST"))
+			}
 		}
 
 		fmt.Printf("[✓] Heartbeat: every %ds\n", cfg.Gateway.Heartbeat.IntervalS)
@@ -166,14 +209,198 @@ scheduled tasks, and heartbeat services.`,
 			os.Exit(1)
 		}
 
+		// Channels that fail to start are logged; the others keep running
+		channelManager.StartAll()
+
+		// Apply the config changes that are safe to make at runtime; the reloader logs the
+		// others as needing a restart, and failures
+		reloader := config.NewReloader(cfg)
+		reloader.Handle(channelManager.Reload, channelManager.ReloadKeys()...)
+		reloader.Handle(func(newCfg *config.Config) error {
+			agentLoop.SetTemperature(newCfg.Agents.Defaults.Temperature)
+			return nil
+		}, "agents.defaults.temperature")
+		reloader.Handle(func(newCfg *config.Config) error {
+			return heartbeatService.SetSchedule(newCfg.Gateway.Heartbeat.IntervalS, newCfg.Gateway.Heartbeat.Enabled)
+		}, "gateway.heartbeat")
+		reloader.Handle(func(newCfg *config.Config) error {
+			if verbose {
+				return nil
+			}
+			return logging.SetLevel(newCfg.Logging.Level)
+		}, "logging.level")
+		config.WatchConfig(reloader.Apply)
+
+		// Serve the HTTP API and platform webhooks, such as Feishu's event subscription
+		apiServer := api.NewServer(cfg.Gateway.API, api.Services{
+			Workspace: cfg.GetWorkspacePath(),
+			Model:     cfg.Agents.Defaults.Model,
+			Agent:     agentLoop,
+			Sessions:  agentLoop.Sessions(),
+			Cron:      cronService,
+			Channels:  channelManager,
+		})
+		handler, err := api.TrustProxies(cfg.Gateway.TrustedProxies, api.WithBasePath(cfg.Gateway.BasePath, apiServer))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in gateway.trusted_proxies: %v\n", err)
+			os.Exit(1)
+		}
+		server := &http.Server{
+			Addr:              net.JoinHostPort(cfg.Gateway.Host, strconv.Itoa(port)),
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		if tlsCfg := cfg.Gateway.TLS; tlsCfg.CertFile != "" || tlsCfg.KeyFile != "" {
+			if server.TLSConfig, err = api.TLSConfig(tlsCfg.CertFile, tlsCfg.KeyFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Error in gateway.tls: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("[✓] Gateway: serving HTTPS")
+		}
+		go func() {
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ListenAndServeTLS("", "") // The certificate comes from TLSConfig
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Fprintf(os.Stderr, "Error running HTTP server: %v\n", err)
+			}
+		}()
+
+		// Process inbound messages until interrupted, delivering replies to their channels
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		agentDone := make(chan struct{})
+		go func() {
+			defer close(agentDone)
+			if err := agentLoop.Run(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "Error running agent loop: %v\n", err)
+			}
+		}()
+		go func() {
+			for {
+				msg, err := messageBus.ConsumeOutboundContext(ctx)
+				if err != nil {
+					return
+				}
+				switch msg.Kind() {
+				case bus.KindTyping:
+					if err := channelManager.SendTyping(msg.Channel, msg.ChatID); err != nil {
+						slog.Warn("Error sending typing indicator", logging.ChannelKey, msg.Channel, "chat", msg.ChatID, "error", err)
+					}
+					continue
+				case bus.KindRead:
+					messageID, _ := msg.Metadata[bus.MetadataMessageID].(string)
+					if err := channelManager.MarkRead(msg.Channel, msg.ChatID, messageID); err != nil {
+						slog.Warn("Error sending read receipt", logging.ChannelKey, msg.Channel, "chat", msg.ChatID, "error", err)
+					}
+					continue
+				}
+				if err := channelManager.SendReply(msg); err != nil {
+					slog.Error("Error delivering reply", logging.ChannelKey, msg.Channel, "chat", msg.ChatID, "error", err)
+				}
+			}
+		}()
+
 		fmt.Println("Gateway services started successfully!")
 
-		// In a real implementation, we would run the agent loop and channel manager here
-		// For now, we'll just keep the program running
-		select {} // Block forever (in a real implementation, handle shutdown properly)
+		// Under systemd with Type=notify, report startup and keep the watchdog fed
+		notifySystemd("READY=1")
+		go feedWatchdog(ctx, apiServer)
+
+		<-ctx.Done()
+		fmt.Println("Shutting down gateway...")
+		notifySystemd("STOPPING=1")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		server.Shutdown(shutdownCtx)
+		cancel()
+		heartbeatService.Stop()
+		cronService.Stop()
+		channelManager.StopAll()
+		<-agentDone
+		agentLoop.Stop()
 	},
 }
 
+// cronTargets returns where a job's result goes: its delivery target, then the chat it was
+// created for if that has since changed
+func cronTargets(payload cron.CronPayload) []channels.Target {
+	var targets []channels.Target
+	if payload.Channel != "" && payload.To != "" {
+		targets = append(targets, channels.Target{Channel: payload.Channel, ChatID: payload.To})
+	}
+	if origin, err := channels.ParseTarget(payload.Origin); err == nil && (len(targets) == 0 || origin != targets[0]) {
+		targets = append(targets, origin)
+	}
+	return targets
+}
+
+// logAgentEvents logs the agent's event stream at debug level until it is closed
+func logAgentEvents(events <-chan agent.Event) {
+	for event := range events {
+		attrs := []any{logging.SessionKey, event.SessionKey}
+		switch event.Type {
+		case agent.EventToolCall:
+			attrs = append(attrs, "tool", event.Tool, "args", event.Args)
+		case agent.EventToolResult:
+			attrs = append(attrs, "tool", event.Tool, "chars", len(event.Result))
+			if event.Error != "" {
+				attrs = append(attrs, "error", event.Error)
+			}
+		case agent.EventTokens:
+			attrs = append(attrs, "tokens", event.Tokens)
+		case agent.EventError:
+			attrs = append(attrs, "error", event.Error)
+		}
+		slog.Debug("Agent "+event.Type, attrs...)
+	}
+}
+
+// notifySystemd sends a state such as READY=1 to systemd's notification socket, when the
+// gateway runs as a notify service
+func notifySystemd(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		slog.Warn("Error notifying systemd", "error", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("Error notifying systemd", "error", err)
+	}
+}
+
+// feedWatchdog pings systemd's watchdog at half its interval while the gateway runs,
+// reporting the failing readiness checks as the service status
+func feedWatchdog(ctx context.Context, server *api.Server) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+	defer ticker.Stop()
+	for {
+		status := "Ready"
+		if failing := server.Readiness(ctx).Failing(); len(failing) > 0 {
+			status = "Not ready: " + strings.Join(failing, ", ")
+		}
+		notifySystemd("WATCHDOG=1\nSTATUS=" + status)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // Helper function to find rune in string
 func findRune(s string, r rune) int {
 	for i, c := range s {
@@ -188,5 +415,5 @@ func init() {
 	rootCmd.AddCommand(gatewayCmd)
 
 	gatewayCmd.Flags().IntP("port", "p", 18790, "Gateway port")
-	gatewayCmd.Flags().Bool("verbose", false, "Verbose output")
+	gatewayCmd.Flags().Bool("verbose", false, "Log at debug level, including each step of every turn")
 }
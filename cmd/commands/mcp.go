@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"nanotalon/agent/mcp"
+	"nanotalon/config"
+
+	"github.com/spf13/cobra"
+)
+
+// mcpLoginTimeout bounds the wait for the user to authorize in the browser
+const mcpLoginTimeout = 5 * time.Minute
+
+// mcpCmd represents the mcp command
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Manage MCP servers",
+	Long:  `Manage the MCP servers configured under tools.mcp_servers.`,
+}
+
+// mcpLoginCmd represents the mcp login command
+var mcpLoginCmd = &cobra.Command{
+	Use:   "login [server]",
+	Short: "Authorize with a remote MCP server",
+	Long: `Authorize nanotalon with a remote MCP server that requires OAuth.
+
+Opening the printed URL in a browser lets you sign in with the server's
+authorization server, which then redirects to a local callback. The tokens are
+saved in ~/.nanotalon/data/mcp/tokens.json and refreshed as they expire.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		server := loadMCPServer(args[0])
+
+		ctx, cancel := context.WithTimeout(context.Background(), mcpLoginTimeout)
+		defer cancel()
+
+		err := mcp.Login(ctx, server, func(authURL string) {
+			fmt.Println("Open this URL in your browser to authorize nanotalon:")
+			fmt.Println()
+			fmt.Println(authURL)
+			fmt.Println()
+			fmt.Println("Waiting for authorization...")
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Authorized with MCP server %s\n", server.Name)
+	},
+}
+
+// mcpLogoutCmd represents the mcp logout command
+var mcpLogoutCmd = &cobra.Command{
+	Use:   "logout [server]",
+	Short: "Forget the tokens of a remote MCP server",
+	Long:  `Forget the OAuth tokens saved for a remote MCP server.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		server := loadMCPServer(args[0])
+		if err := mcp.Logout(server); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Logged out of MCP server %s\n", server.Name)
+	},
+}
+
+// loadMCPServer returns the configuration of a remote MCP server, exiting if there is none
+func loadMCPServer(name string) mcp.MCPServer {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	serverCfg, exists := cfg.Tools.MCPServers[name]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Error: MCP server %s is not configured\n", name)
+		os.Exit(1)
+	}
+	server := mcp.ServerFromConfig(name, serverCfg)
+	if server.URL == "" {
+		fmt.Fprintf(os.Stderr, "Error: MCP server %s has no URL; only remote servers use OAuth\n", name)
+		os.Exit(1)
+	}
+	return server
+}
+
+func init() {
+	rootCmd.AddCommand(mcpCmd)
+
+	// Add subcommands
+	mcpCmd.AddCommand(mcpLoginCmd)
+	mcpCmd.AddCommand(mcpLogoutCmd)
+}
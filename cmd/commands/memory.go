@@ -0,0 +1,441 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"nanotalon/agent/memory"
+	"nanotalon/config"
+	"nanotalon/providers"
+
+	"github.com/spf13/cobra"
+)
+
+// memoryCmd represents the memory command
+var memoryCmd = &cobra.Command{
+	Use:   "memory",
+	Short: "Inspect and manage what the assistant remembers",
+	Long: `Inspect, search, edit and delete the assistant's long-term memory, facts and history.
+Commands work on global memory unless --scope names another, such as channel:slack or chat:telegram:42.`,
+}
+
+// memoryShowCmd represents the memory show command
+var memoryShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show remembered memory and facts",
+	Long:  `Show the long-term memory and facts of a scope, with a summary of its history log.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		historyLimit, _ := cmd.Flags().GetInt("history")
+
+		_, scope := mustMemoryScope(cmd)
+		store := memory.NewMemoryStoreAt(scope.Dir)
+		fmt.Printf("Memory scope: %s (%s)\n", scope.Name, scope.Dir)
+
+		longTerm, err := store.ReadLongTerm()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading long-term memory: %v\n", err)
+			os.Exit(1)
+		}
+		if strings.TrimSpace(longTerm) == "" {
+			fmt.Println("\nLong-term memory is empty.")
+		} else {
+			fmt.Printf("\nLong-term memory:\n%s\n", strings.TrimRight(longTerm, "\n"))
+		}
+
+		facts := mustFactStore(scope).Query(memory.FactQuery{})
+		if len(facts) == 0 {
+			fmt.Println("\nNo facts.")
+		} else {
+			fmt.Printf("\nFacts (%d):\n", len(facts))
+			printFacts(facts)
+		}
+
+		entries, err := store.HistoryEntries()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
+			os.Exit(1)
+		}
+		months, _ := store.HistoryArchives()
+		fmt.Printf("\nHistory: %d entries", len(entries))
+		if len(months) > 0 {
+			fmt.Printf(", archived from %s to %s", months[0], months[len(months)-1])
+		}
+		fmt.Println()
+
+		if historyLimit > 0 && len(entries) > 0 {
+			if len(entries) > historyLimit {
+				entries = entries[len(entries)-historyLimit:]
+			}
+			fmt.Println()
+			for _, entry := range entries {
+				fmt.Println(strings.TrimSpace(entry))
+			}
+		}
+	},
+}
+
+// memorySearchCmd represents the memory search command
+var memorySearchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search memory by meaning",
+	Long: `Search long-term memory and history, archives included, by meaning using the configured
+embedding model, and list the facts that mention the query.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		query := strings.Join(args, " ")
+		limit, _ := cmd.Flags().GetInt("limit")
+		source, _ := cmd.Flags().GetString("source")
+
+		cfg, scope := mustMemoryScope(cmd)
+
+		var filter memory.SearchFilter
+		switch strings.ToLower(source) {
+		case "", "all":
+		case memory.SourceMemory, memory.SourceHistory:
+			filter.Sources = []string{strings.ToLower(source)}
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown source %q (use memory, history or all)\n", source)
+			os.Exit(1)
+		}
+
+		embeddings, err := providers.EmbeddingsFactory(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating embeddings provider: %v\n", err)
+			os.Exit(1)
+		}
+		store, err := memory.NewSemanticMemoryStoreAt(scope.Dir, embeddings)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening memory index: %v\n", err)
+			os.Exit(1)
+		}
+		defer store.Close()
+
+		vectors, err := memory.NewVectorStore(cfg.Memory.VectorStore)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating vector store: %v\n", err)
+			os.Exit(1)
+		}
+		if vectors != nil {
+			if err := store.UseVectorStore(vectors); err != nil {
+				fmt.Fprintf(os.Stderr, "Error attaching vector store: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		results, err := store.Search(ctx, query, filter, limit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error searching memory: %v\n", err)
+			os.Exit(1)
+		}
+		facts := mustFactStore(scope).Query(memory.FactQuery{Text: query})
+
+		if len(results) == 0 && len(facts) == 0 {
+			fmt.Println("Nothing found.")
+			return
+		}
+		for _, result := range results {
+			label := result.Source
+			if !result.Date.IsZero() {
+				label += ", " + result.Date.Format("2006-01-02 15:04")
+			}
+			fmt.Printf("[%s] (score %.2f)\n%s\n\n", label, result.Similarity, result.Segment)
+		}
+		if len(facts) > 0 {
+			fmt.Printf("Facts mentioning %q:\n", query)
+			printFacts(facts)
+		}
+	},
+}
+
+// memoryEditCmd represents the memory edit command
+var memoryEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit long-term memory in your editor",
+	Long:  `Open MEMORY.md, or HISTORY.md with --history, in $VISUAL or $EDITOR (vi if neither is set).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		history, _ := cmd.Flags().GetBool("history")
+
+		_, scope := mustMemoryScope(cmd)
+		path := filepath.Join(scope.Dir, "MEMORY.md")
+		if history {
+			path = filepath.Join(scope.Dir, "HISTORY.md")
+		}
+
+		if err := os.MkdirAll(scope.Dir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating memory directory: %v\n", err)
+			os.Exit(1)
+		}
+		if f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644); err == nil {
+			f.Close()
+		}
+
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+		}
+
+		// The editor may carry arguments, as in EDITOR="code --wait"
+		fields := strings.Fields(editor)
+		editCmd := exec.Command(fields[0], append(fields[1:], path)...)
+		editCmd.Stdin = os.Stdin
+		editCmd.Stdout = os.Stdout
+		editCmd.Stderr = os.Stderr
+		if err := editCmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running %s: %v\n", editor, err)
+			os.Exit(1)
+		}
+	},
+}
+
+// memoryForgetCmd represents the memory forget command
+var memoryForgetCmd = &cobra.Command{
+	Use:   "forget [text]",
+	Short: "Delete remembered entries",
+	Long: `Delete text, ignoring case, everywhere it is remembered: lines of long-term memory, history
+entries (archives included), facts and the memory search index of every scope, and session transcripts,
+where it is replaced with [forgotten]. With --fact, delete a single fact of --scope instead.
+Use --dry-run to see what would go. Stop the gateway first so running sessions don't write the text back.`,
+	Args: cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		factID, _ := cmd.Flags().GetString("fact")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		text := strings.Join(args, " ")
+
+		cfg, scope := mustMemoryScope(cmd)
+
+		if factID != "" {
+			factStore := mustFactStore(scope)
+			facts := factStore.Query(memory.FactQuery{})
+			for _, fact := range facts {
+				if fact.ID != factID {
+					continue
+				}
+				if dryRun {
+					fmt.Println("Would forget:")
+				} else if _, _, err := factStore.Retract(factID); err != nil {
+					fmt.Fprintf(os.Stderr, "Error forgetting fact: %v\n", err)
+					os.Exit(1)
+				} else {
+					fmt.Println("Forgot:")
+				}
+				printFacts([]memory.Fact{fact})
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Fact %s not found\n", factID)
+			os.Exit(1)
+		}
+
+		if strings.TrimSpace(text) == "" {
+			fmt.Fprintln(os.Stderr, "Give the text to forget, or --fact <id>")
+			os.Exit(1)
+		}
+
+		sessionManager := openSessionManager()
+		defer sessionManager.Close()
+
+		report, err := memory.NewScopes(cfg.GetWorkspacePath()).Forget(sessionManager, text, dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error forgetting: %v\n", err)
+			os.Exit(1)
+		}
+
+		if report.Empty() {
+			fmt.Println("Nothing matches.")
+			return
+		}
+		verb := "Forgot"
+		if dryRun {
+			verb = "Would forget"
+		}
+		for _, match := range report.Memory {
+			fmt.Printf("%s from %s: %s\n", verb, match.File, match.Text)
+		}
+		if len(report.Facts) > 0 {
+			fmt.Printf("%s %d fact(s):\n", verb, len(report.Facts))
+			printFacts(report.Facts)
+		}
+		if report.Chunks > 0 {
+			fmt.Printf("%s %d chunk(s) of the memory search index\n", verb, report.Chunks)
+		}
+		for _, redaction := range report.Sessions {
+			fmt.Printf("%s from session %s (%s): %s\n", verb, redaction.Session, redaction.Role, redaction.Excerpt)
+		}
+	},
+}
+
+// memoryExport is the JSON form of memory export
+type memoryExport struct {
+	Scope    string        `json:"scope"`
+	LongTerm string        `json:"long_term"`
+	Facts    []memory.Fact `json:"facts"`
+	History  []string      `json:"history"`
+}
+
+// memoryExportCmd represents the memory export command
+var memoryExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export memory, facts and history",
+	Long:  `Export the long-term memory, facts and full history of a scope as markdown or JSON to stdout or a file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		_, scope := mustMemoryScope(cmd)
+		store := memory.NewMemoryStoreAt(scope.Dir)
+
+		export := memoryExport{Scope: scope.Name, Facts: []memory.Fact{}, History: []string{}}
+		export.Facts = append(export.Facts, mustFactStore(scope).Query(memory.FactQuery{})...)
+		var err error
+		if export.LongTerm, err = store.ReadLongTerm(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading long-term memory: %v\n", err)
+			os.Exit(1)
+		}
+		entries, err := store.HistoryEntries()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
+			os.Exit(1)
+		}
+		for _, entry := range entries {
+			export.History = append(export.History, strings.TrimSpace(entry))
+		}
+
+		var content []byte
+		switch strings.ToLower(format) {
+		case "markdown", "md":
+			content = []byte(memoryToMarkdown(export))
+		case "json":
+			data, err := json.MarshalIndent(export, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error encoding memory: %v\n", err)
+				os.Exit(1)
+			}
+			content = append(data, '\n')
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown format %q (use markdown or json)\n", format)
+			os.Exit(1)
+		}
+
+		if output == "" || output == "-" {
+			os.Stdout.Write(content)
+			return
+		}
+		if err := os.WriteFile(output, content, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", output, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Memory of %s exported to %s\n", scope.Name, output)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(memoryCmd)
+
+	// Add subcommands
+	memoryCmd.AddCommand(memoryShowCmd)
+	memoryCmd.AddCommand(memorySearchCmd)
+	memoryCmd.AddCommand(memoryEditCmd)
+	memoryCmd.AddCommand(memoryForgetCmd)
+	memoryCmd.AddCommand(memoryExportCmd)
+
+	memoryCmd.PersistentFlags().String("scope", memory.TierGlobal, "Memory scope: global, channel:<channel> or chat:<channel>:<chat id>")
+
+	// Memory show flags
+	memoryShowCmd.Flags().Int("history", 0, "Also show the last N history entries")
+
+	// Memory search flags
+	memorySearchCmd.Flags().IntP("limit", "n", 10, "Show at most N results")
+	memorySearchCmd.Flags().String("source", "all", "Search memory, history or all")
+
+	// Memory edit flags
+	memoryEditCmd.Flags().Bool("history", false, "Edit HISTORY.md instead of MEMORY.md")
+
+	// Memory forget flags
+	memoryForgetCmd.Flags().String("fact", "", "Forget the fact with this ID")
+	memoryForgetCmd.Flags().Bool("dry-run", false, "Show what would be forgotten without deleting it")
+
+	// Memory export flags
+	memoryExportCmd.Flags().StringP("format", "f", "markdown", "Export format: markdown or json")
+	memoryExportCmd.Flags().StringP("output", "o", "", "Output file (default stdout)")
+}
+
+// mustMemoryScope loads the config and resolves the --scope flag, exiting on error
+func mustMemoryScope(cmd *cobra.Command) (*config.Config, memory.Scope) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	name, _ := cmd.Flags().GetString("scope")
+	scope, err := memory.NewScopes(cfg.GetWorkspacePath()).Parse(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return cfg, scope
+}
+
+// mustFactStore loads the facts of a scope, exiting on error
+func mustFactStore(scope memory.Scope) *memory.FactStore {
+	store, err := memory.NewFactStoreAt(scope.Dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading facts: %v\n", err)
+		os.Exit(1)
+	}
+	return store
+}
+
+// printFacts lists facts as a table
+func printFacts(facts []memory.Fact) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSUBJECT\tPREDICATE\tVALUE\tCATEGORY\tCONFIDENCE\tUPDATED")
+	for _, fact := range facts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.2f\t%s\n", fact.ID, fact.Subject, fact.Predicate, fact.Value,
+			fact.Category, fact.Confidence, fact.UpdatedAt.Local().Format("2006-01-02"))
+	}
+	w.Flush()
+}
+
+// memoryToMarkdown renders a memory export as markdown
+func memoryToMarkdown(export memoryExport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Memory (%s)\n\n", export.Scope)
+
+	b.WriteString("## Long-term Memory\n\n")
+	if strings.TrimSpace(export.LongTerm) == "" {
+		b.WriteString("(empty)\n")
+	} else {
+		b.WriteString(strings.TrimRight(export.LongTerm, "\n") + "\n")
+	}
+
+	b.WriteString("\n## Facts\n\n")
+	if len(export.Facts) == 0 {
+		b.WriteString("(none)\n")
+	}
+	for _, fact := range export.Facts {
+		fmt.Fprintf(&b, "- %s %s: %s (%s, confidence %.2f, id %s)\n", fact.Subject, fact.Predicate, fact.Value,
+			fact.Category, fact.Confidence, fact.ID)
+	}
+
+	b.WriteString("\n## History\n\n")
+	if len(export.History) == 0 {
+		b.WriteString("(empty)\n")
+	}
+	for _, entry := range export.History {
+		b.WriteString(entry + "\n\n")
+	}
+	return b.String()
+}
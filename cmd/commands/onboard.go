@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"nanotalon/config"
+
 	"github.com/spf13/cobra"
 )
 
@@ -17,17 +19,15 @@ var onboardCmd = &cobra.Command{
 This command creates the necessary configuration files and workspace directory
 for nanotalon to operate.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		homeDir, err := os.UserHomeDir()
+		// --config or $NANOTALON_CONFIG choose where the config goes
+		configPath, err := config.ConfigPath()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting home directory: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error finding config file: %v\n", err)
 			os.Exit(1)
 		}
 
-		configDir := filepath.Join(homeDir, ".nanotalon")
-		configPath := filepath.Join(configDir, "config.yaml")
-
 		// Create config directory
-		if err := os.MkdirAll(configDir, 0755); err != nil {
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 			fmt.Fprintf(os.Stderr, "Error creating config directory: %v\n", err)
 			os.Exit(1)
 		}
@@ -53,6 +53,7 @@ agents:
     temperature: 0.1
     max_tool_iterations: 40
     memory_window: 100
+    max_history_tokens: 32000
 
 providers:
   openrouter:
@@ -65,6 +66,11 @@ providers:
 channels:
   send_progress: true
   send_tool_hints: false
+  send_typing: true
+  send_read_receipts: true
+  groups:
+    require_mention: true
+    context_messages: 10
   telegram:
     enabled: false
     token: ""
@@ -93,7 +99,11 @@ tools:
 		fmt.Printf("✓ Created config at %s\n", configPath)
 
 		// Create workspace directory
-		workspacePath := filepath.Join(configDir, "workspace")
+		workspacePath, err := config.DefaultWorkspace()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding workspace directory: %v\n", err)
+			os.Exit(1)
+		}
 		if err := os.MkdirAll(workspacePath, 0755); err != nil {
 			fmt.Fprintf(os.Stderr, "Error creating workspace directory: %v\n", err)
 			os.Exit(1)
@@ -105,7 +115,7 @@ tools:
 
 		fmt.Println("\n🐈 nanotalon is ready!")
 		fmt.Println("\nNext steps:")
-		fmt.Println("  1. Add your API key to ~/.nanotalon/config.yaml")
+		fmt.Printf("  1. Add your API key to %s\n", configPath)
 		fmt.Println("     Get one at: https://openrouter.ai/keys")
 		fmt.Println("  2. Chat: nanotalon agent -m \"Hello!\"")
 	},
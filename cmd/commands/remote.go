@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// remoteAnnotation marks the commands that can run against a gateway with --remote
+const remoteAnnotation = "remote"
+
+var (
+	remoteURL   string
+	remoteToken string
+)
+
+// remoteGateway calls the HTTP API of a running gateway, so commands see the gateway's
+// state instead of reading the files it keeps in memory
+type remoteGateway struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// remote returns the gateway set with --remote, or nil to work on local files
+func remote() *remoteGateway {
+	if remoteURL == "" {
+		return nil
+	}
+	return &remoteGateway{
+		baseURL: strings.TrimRight(remoteURL, "/"),
+		token:   remoteToken,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// supportsRemote marks commands that can run against a gateway with --remote
+func supportsRemote(cmds ...*cobra.Command) {
+	for _, cmd := range cmds {
+		if cmd.Annotations == nil {
+			cmd.Annotations = make(map[string]string)
+		}
+		cmd.Annotations[remoteAnnotation] = "true"
+	}
+}
+
+// checkRemote refuses --remote for commands that only work on local files, since running
+// them locally would act on state the gateway may not see. Commands that support it fall
+// back to $NANOTALON_REMOTE and $NANOTALON_TOKEN.
+func checkRemote(cmd *cobra.Command, args []string) error {
+	if cmd.Annotations[remoteAnnotation] != "true" {
+		if remoteURL != "" {
+			return fmt.Errorf("'%s' doesn't support --remote; run it on the gateway's host", cmd.CommandPath())
+		}
+		return nil
+	}
+	if remoteURL == "" {
+		remoteURL = os.Getenv("NANOTALON_REMOTE")
+	}
+	if remoteToken == "" {
+		remoteToken = os.Getenv("NANOTALON_TOKEN")
+	}
+	return nil
+}
+
+// get fetches an API path into out
+func (g *remoteGateway) get(path string, out interface{}) error {
+	return g.do("GET", path, out)
+}
+
+// do calls an API path and decodes the JSON response into out, if it isn't nil
+func (g *remoteGateway) do(method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, g.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("invalid --remote URL: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the gateway: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read the gateway's response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("the gateway refused %s %s: %s", method, path, apiErr.Error)
+		}
+		return fmt.Errorf("the gateway refused %s %s with status %d", method, path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode the gateway's response: %w", err)
+	}
+	return nil
+}
+
+// sessionPath returns the API path of a session
+func sessionPath(key string) string {
+	return "/v1/sessions/" + url.PathEscape(key)
+}
+
+// mustRemote runs a call against the gateway, exiting on error
+func mustRemote(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"fmt"
 	"os"
 
+	"nanotalon/config"
+	"nanotalon/logging"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+	cfgFile   string
+	profile   string
+	workspace string
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -17,6 +24,7 @@ var rootCmd = &cobra.Command{
 	Long: `nanotalon - Personal AI Assistant
 
 Ultra-Lightweight Personal AI Assistant`,
+	PersistentPreRunE: checkRemote,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -31,30 +39,30 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.nanotalon/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $NANOTALON_CONFIG, then $HOME/.nanotalon/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "profile merged over the config, from profiles/<name>.yaml next to it (or $NANOTALON_PROFILE)")
+	rootCmd.PersistentFlags().StringVar(&workspace, "workspace", "", "workspace to use, by name from agents.workspaces or by path (or $NANOTALON_WORKSPACE)")
+	rootCmd.PersistentFlags().StringVar(&remoteURL, "remote", "", "URL of a running gateway to work on instead of local files, such as http://host:18790 (or $NANOTALON_REMOTE)")
+	rootCmd.PersistentFlags().StringVar(&remoteToken, "token", "", "API token for --remote (or $NANOTALON_TOKEN)")
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-// initConfig reads in config file and ENV variables if set.
+// initConfig points the config package at the --config file, --profile and --workspace,
+// and reads environment variables
 func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := os.UserHomeDir()
-		cobra.CheckErr(err)
-
-		// Search config in home directory with name ".nanotalon" (without extension).
-		viper.AddConfigPath(home + "/.nanotalon")
-		viper.SetConfigType("yaml")
-		viper.SetConfigName("config")
-	}
-
+	config.SetConfigFile(cfgFile)
+	config.SetProfile(profile)
+	config.SetWorkspace(workspace)
 	viper.AutomaticEnv() // read in environment variables that match
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	// Commands that run the agent apply the logging section once they've loaded the config
+	logging.Setup(config.LoggingConfig{})
+
+	if path, err := config.ConfigPath(); err == nil && fileExists(path) {
+		if name := config.Profile(); name != "" {
+			fmt.Fprintf(os.Stderr, "Using config file: %s (profile %s)\n", path, name)
+		} else {
+			fmt.Fprintln(os.Stderr, "Using config file:", path)
+		}
 	}
 }
@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"nanotalon/channels"
+	"nanotalon/config"
+
+	"github.com/spf13/cobra"
+)
+
+// sendCmd represents the send command
+var sendCmd = &cobra.Command{
+	Use:   "send [message]",
+	Short: "Send a message to chats",
+	Long: `Send a message as is to one or more chats, without going through the agent.
+
+Each --to is a chat ID on --channel, or a <channel>:<chat ID> pair to reach several
+channels at once. Without a message argument the message is read from stdin. Chats
+must pass the channel's allow_from. The channels only send: the gateway keeps
+receiving messages while this runs.
+
+Examples:
+  nanotalon send --channel telegram --to 123456789 "Deploy finished"
+  nanotalon send --to telegram:123456789 --to slack:C0123ABC "Maintenance at 18:00"
+  echo "Backup done" | nanotalon send --channel email --to ops@example.com`,
+	Run: func(cmd *cobra.Command, args []string) {
+		channelName, _ := cmd.Flags().GetString("channel")
+		to, _ := cmd.Flags().GetStringArray("to")
+
+		targets, err := sendTargets(channelName, to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		message := strings.Join(args, " ")
+		if len(args) == 0 {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading message: %v\n", err)
+				os.Exit(1)
+			}
+			message = string(data)
+		}
+		message = strings.TrimSpace(message)
+		if message == "" {
+			fmt.Fprintln(os.Stderr, "Error: the message is empty")
+			os.Exit(1)
+		}
+
+		// Load configuration
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Start the channels the targets are on; without a message bus they only send
+		channelManager := channels.NewManager(cfg)
+		started := make(map[string]channels.Channel)
+		for _, target := range targets {
+			if _, ok := started[target.Channel]; ok {
+				continue
+			}
+			channel, exists := channelManager.Get(target.Channel)
+			if !exists {
+				fmt.Fprintf(os.Stderr, "Error: channel %s is not enabled\n", target.Channel)
+				os.Exit(1)
+			}
+			if err := channel.Start(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error starting %s: %v\n", target.Channel, err)
+				os.Exit(1)
+			}
+			started[target.Channel] = channel
+		}
+
+		err = channelManager.Broadcast(message, targets)
+		for _, channel := range started {
+			channel.Stop()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Sent to %d chat(s)\n", len(targets))
+	},
+}
+
+// sendTargets turns the --to values into targets; plain chat IDs are on defaultChannel
+func sendTargets(defaultChannel string, to []string) ([]channels.Target, error) {
+	if len(to) == 0 {
+		return nil, fmt.Errorf("at least one --to is required")
+	}
+
+	targets := make([]channels.Target, 0, len(to))
+	for _, value := range to {
+		if defaultChannel != "" {
+			targets = append(targets, channels.Target{Channel: defaultChannel, ChatID: value})
+			continue
+		}
+		target, err := channels.ParseTarget(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w (or set --channel)", err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func init() {
+	rootCmd.AddCommand(sendCmd)
+
+	sendCmd.Flags().String("channel", "", "Channel the chats are on (e.g. 'telegram')")
+	sendCmd.Flags().StringArray("to", nil, "Chat to send to, repeatable; a <channel>:<chat ID> pair without --channel")
+}
@@ -0,0 +1,355 @@
+package commands
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"nanotalon/config"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	serviceName  = "nanotalon"             // The systemd unit's name
+	launchdLabel = "com.nanotalon.gateway" // The launchd job's label
+)
+
+// serviceSpec describes how the service runs the gateway
+type serviceSpec struct {
+	Args      []string // The executable and its arguments
+	Workspace string
+	Env       []string // KEY=VALUE
+	LogFile   string   // Where launchd writes the output; systemd keeps it in the journal
+}
+
+// serviceBackend is the service manager of the platform
+type serviceBackend struct {
+	Name      string
+	Path      string // Where the service definition is installed
+	Render    func(spec serviceSpec) string
+	Replace   [][]string // Commands run before an installed definition is replaced; failures are ignored
+	Install   [][]string // Commands run after the definition is written
+	Uninstall [][]string // Commands run before the definition is removed
+	Status    []string
+	Hint      string // Shown after installing
+}
+
+// serviceCmd represents the service command
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Run the gateway as a background service",
+	Long: `Install the gateway as a service of the current user: a systemd user unit on Linux or a
+launchd agent on macOS. The service starts at login (or boot), restarts the gateway if it fails
+and runs it with the current config, workspace and environment.`,
+}
+
+// serviceInstallCmd represents the service install command
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install and start the gateway service",
+	Long: `Write the service definition for the gateway, then enable and start it. Installing again
+replaces the definition and restarts the service. HOME and PATH are passed to the service;
+add other variables, such as provider API keys kept out of the config, with --env.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		printOnly, _ := cmd.Flags().GetBool("print")
+		extraEnv, _ := cmd.Flags().GetStringArray("env")
+
+		backend := mustServiceBackend()
+		spec, err := currentServiceSpec(extraEnv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error preparing service: %v\n", err)
+			os.Exit(1)
+		}
+		definition := backend.Render(spec)
+		if printOnly {
+			fmt.Print(definition)
+			return
+		}
+
+		// The service fails to start without its working and log directories
+		dirs := []string{filepath.Dir(backend.Path), spec.Workspace}
+		if spec.LogFile != "" {
+			dirs = append(dirs, filepath.Dir(spec.LogFile))
+		}
+		for _, dir := range dirs {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", dir, err)
+				os.Exit(1)
+			}
+		}
+
+		if _, err := os.Stat(backend.Path); err == nil {
+			for _, command := range backend.Replace {
+				runServiceCommand(command)
+			}
+		}
+		if err := os.WriteFile(backend.Path, []byte(definition), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", backend.Path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s\n", backend.Path)
+
+		for _, command := range backend.Install {
+			if err := runServiceCommand(command); err != nil {
+				fmt.Fprintf(os.Stderr, "Error running %s: %v\n", strings.Join(command, " "), err)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("✓ Gateway service installed and started with %s\n", backend.Name)
+		if backend.Hint != "" {
+			fmt.Println(backend.Hint)
+		}
+	},
+}
+
+// serviceUninstallCmd represents the service uninstall command
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop and remove the gateway service",
+	Run: func(cmd *cobra.Command, args []string) {
+		backend := mustServiceBackend()
+		if _, err := os.Stat(backend.Path); os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "The gateway service isn't installed (%s not found)\n", backend.Path)
+			os.Exit(1)
+		}
+
+		// The service may already be stopped; removing it matters more
+		for _, command := range backend.Uninstall {
+			if err := runServiceCommand(command); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s failed: %v\n", strings.Join(command, " "), err)
+			}
+		}
+		if err := os.Remove(backend.Path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing %s: %v\n", backend.Path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Gateway service removed (%s)\n", backend.Path)
+	},
+}
+
+// serviceStatusCmd represents the service status command
+var serviceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the gateway service's status",
+	Run: func(cmd *cobra.Command, args []string) {
+		backend := mustServiceBackend()
+		if _, err := os.Stat(backend.Path); os.IsNotExist(err) {
+			fmt.Printf("The gateway service isn't installed. Run 'nanotalon service install' to install it.\n")
+			return
+		}
+		fmt.Printf("Service: %s (%s)\n\n", backend.Path, backend.Name)
+
+		// The status commands exit non-zero for a stopped service, which is still a status
+		runServiceCommand(backend.Status)
+	},
+}
+
+// mustServiceBackend returns the service manager of this platform, exiting if there's none
+func mustServiceBackend() *serviceBackend {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting home directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		return &serviceBackend{
+			Name:   "systemd",
+			Path:   filepath.Join(homeDir, ".config", "systemd", "user", serviceName+".service"),
+			Render: systemdUnit,
+			Install: [][]string{
+				{"systemctl", "--user", "daemon-reload"},
+				{"systemctl", "--user", "enable", serviceName},
+				{"systemctl", "--user", "restart", serviceName},
+			},
+			Uninstall: [][]string{
+				{"systemctl", "--user", "disable", "--now", serviceName},
+				{"systemctl", "--user", "daemon-reload"},
+			},
+			Status: []string{"systemctl", "--user", "status", "--no-pager", serviceName},
+			Hint: "Logs: journalctl --user -u " + serviceName + " -f\n" +
+				"To start it at boot without logging in, run: loginctl enable-linger " + os.Getenv("USER"),
+		}
+	case "darwin":
+		path := filepath.Join(homeDir, "Library", "LaunchAgents", launchdLabel+".plist")
+		return &serviceBackend{
+			Name:      "launchd",
+			Path:      path,
+			Render:    launchdPlist,
+			Replace:   [][]string{{"launchctl", "unload", path}},
+			Install:   [][]string{{"launchctl", "load", "-w", path}},
+			Uninstall: [][]string{{"launchctl", "unload", "-w", path}},
+			Status:    []string{"launchctl", "list", launchdLabel},
+			Hint:      "Logs: " + serviceLogFile(homeDir),
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Services aren't supported on %s; run 'nanotalon gateway' under your own supervisor\n", runtime.GOOS)
+		os.Exit(1)
+		return nil
+	}
+}
+
+// currentServiceSpec builds the service from this executable, its config and environment
+func currentServiceSpec(extraEnv []string) (serviceSpec, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return serviceSpec{}, fmt.Errorf("error loading config: %w", err)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return serviceSpec{}, fmt.Errorf("error finding the nanotalon executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return serviceSpec{}, fmt.Errorf("error getting home directory: %w", err)
+	}
+
+	spec := serviceSpec{
+		Args:      []string{executable, "gateway"},
+		Workspace: cfg.GetWorkspacePath(),
+		Env:       []string{"HOME=" + homeDir, "PATH=" + os.Getenv("PATH")},
+	}
+	if cfgFile != "" {
+		path, err := filepath.Abs(cfgFile)
+		if err != nil {
+			return serviceSpec{}, fmt.Errorf("error resolving %s: %w", cfgFile, err)
+		}
+		spec.Args = append(spec.Args, "--config", path)
+	}
+	if name := config.Profile(); name != "" {
+		spec.Args = append(spec.Args, "--profile", name)
+	}
+	if config.Workspace() != "" {
+		spec.Args = append(spec.Args, "--workspace", spec.Workspace)
+	}
+	for _, variable := range extraEnv {
+		if name, _, ok := strings.Cut(variable, "="); !ok || name == "" {
+			return serviceSpec{}, fmt.Errorf("invalid --env %q: use KEY=VALUE", variable)
+		}
+		spec.Env = append(spec.Env, variable)
+	}
+	if runtime.GOOS == "darwin" {
+		spec.LogFile = serviceLogFile(homeDir)
+	}
+	return spec, nil
+}
+
+// serviceLogFile is where launchd writes the gateway's output
+func serviceLogFile(homeDir string) string {
+	return filepath.Join(homeDir, ".nanotalon", "logs", "gateway.log")
+}
+
+// systemdUnit renders a systemd user unit. The gateway notifies systemd once it has
+// started and feeds the watchdog while it runs.
+func systemdUnit(spec serviceSpec) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=nanotalon gateway\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("Wants=network-online.target\n\n")
+
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=notify\n")
+	quoted := make([]string, len(spec.Args))
+	for i, arg := range spec.Args {
+		quoted[i] = systemdQuote(arg)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	if spec.Workspace != "" {
+		// Paths can't be quoted here, only their specifiers escaped
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", strings.ReplaceAll(spec.Workspace, "%", "%%"))
+	}
+	for _, variable := range spec.Env {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(variable))
+	}
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5\n")
+	b.WriteString("WatchdogSec=120\n")
+	b.WriteString("TimeoutStopSec=15\n\n")
+
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=default.target\n")
+	return b.String()
+}
+
+// systemdQuote quotes a value for a unit file, escaping specifiers such as %h
+func systemdQuote(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%").Replace(value)
+	return `"` + value + `"`
+}
+
+// launchdPlist renders a launchd agent that keeps the gateway running
+func launchdPlist(spec serviceSpec) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	plistKey(&b, "Label", launchdLabel)
+
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range spec.Args {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", xmlEscape(arg))
+	}
+	b.WriteString("\t</array>\n")
+
+	if spec.Workspace != "" {
+		plistKey(&b, "WorkingDirectory", spec.Workspace)
+	}
+	b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+	for _, variable := range spec.Env {
+		name, value, _ := strings.Cut(variable, "=")
+		fmt.Fprintf(&b, "\t\t<key>%s</key>\n\t\t<string>%s</string>\n", xmlEscape(name), xmlEscape(value))
+	}
+	b.WriteString("\t</dict>\n")
+
+	// Start at login and restart after a crash, but not after a clean shutdown
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>5</integer>\n")
+	if spec.LogFile != "" {
+		plistKey(&b, "StandardOutPath", spec.LogFile)
+		plistKey(&b, "StandardErrorPath", spec.LogFile)
+	}
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+// plistKey writes a string entry of a plist dict
+func plistKey(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, "\t<key>%s</key>\n\t<string>%s</string>\n", key, xmlEscape(value))
+}
+
+// xmlEscape escapes text for XML
+func xmlEscape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// runServiceCommand runs a service manager command, showing its output
+func runServiceCommand(command []string) error {
+	c := exec.Command(command[0], command[1:]...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+func init() {
+	rootCmd.AddCommand(serviceCmd)
+
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+	serviceCmd.AddCommand(serviceStatusCmd)
+
+	serviceInstallCmd.Flags().Bool("print", false, "Print the service definition instead of installing it")
+	serviceInstallCmd.Flags().StringArray("env", nil, "Environment variable for the service, as KEY=VALUE (repeatable)")
+}
@@ -0,0 +1,459 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"nanotalon/agent"
+	"nanotalon/config"
+	"nanotalon/session"
+
+	"github.com/spf13/cobra"
+)
+
+// sessionsCmd represents the sessions command
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Manage conversation sessions",
+	Long:  `Manage persisted conversation sessions.`,
+}
+
+// sessionsListCmd represents the sessions list command
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List sessions",
+	Long:  `List persisted sessions with their channel, message count and last activity.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		channel, _ := cmd.Flags().GetString("channel")
+
+		var all []session.SessionInfo
+		if gateway := remote(); gateway != nil {
+			var response struct {
+				Sessions []session.SessionInfo `json:"sessions"`
+			}
+			mustRemote(gateway.get("/v1/sessions", &response))
+			all = response.Sessions
+		} else {
+			sessionManager := openSessionManager()
+			defer sessionManager.Close()
+			all = sessionManager.ListSessionInfo()
+		}
+
+		var infos []session.SessionInfo
+		for _, info := range all {
+			if channel == "" || info.Channel() == channel {
+				infos = append(infos, info)
+			}
+		}
+
+		if len(infos) == 0 {
+			fmt.Println("No sessions.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tCHANNEL\tMESSAGES\tLAST ACTIVITY")
+		for _, info := range infos {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", info.Key, info.Channel(), info.MessageCount, formatActivity(info.UpdatedAt))
+		}
+		w.Flush()
+	},
+}
+
+// sessionsShowCmd represents the sessions show command
+var sessionsShowCmd = &cobra.Command{
+	Use:   "show <key>",
+	Short: "Show a session transcript",
+	Long:  `Show the summary and most recent messages of a session.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		var info session.SessionInfo
+		var summary string
+		var count int
+		var messages []session.Message
+		if gateway := remote(); gateway != nil {
+			// The gateway sends only the messages that are shown
+			var response struct {
+				session.SessionInfo
+				Summary         string            `json:"summary"`
+				SummarizedCount int               `json:"summarized_count"`
+				Messages        []session.Message `json:"messages"`
+			}
+			mustRemote(gateway.get(fmt.Sprintf("%s?limit=%d", sessionPath(args[0]), max(limit, 0)), &response))
+			info, summary, count, messages = response.SessionInfo, response.Summary, response.SummarizedCount, response.Messages
+		} else {
+			sessionManager := openSessionManager()
+			defer sessionManager.Close()
+
+			sess := mustGetSession(sessionManager, args[0])
+			info, messages = sess.Info(), sess.Messages
+			summary, count, _ = sessionManager.GetSummary(info.Key)
+			if limit > 0 && len(messages) > limit {
+				messages = messages[len(messages)-limit:]
+			}
+		}
+
+		fmt.Printf("Session: %s\n", info.Key)
+		fmt.Printf("Channel: %s\n", info.Channel())
+		fmt.Printf("Messages: %d\n", info.MessageCount)
+		fmt.Printf("Created: %s\n", info.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		fmt.Printf("Last activity: %s\n", formatActivity(info.UpdatedAt))
+
+		if summary != "" {
+			fmt.Printf("\nSummary of the first %d messages:\n%s\n", count, summary)
+		}
+
+		if len(messages) < info.MessageCount {
+			fmt.Printf("\n(showing the last %d of %d messages)\n", len(messages), info.MessageCount)
+		}
+		for _, msg := range messages {
+			fmt.Printf("\n[%s] %s:\n%s\n", msg.Timestamp.Local().Format("2006-01-02 15:04:05"), messageLabel(msg), msg.Content)
+			for _, tc := range msg.ToolCalls {
+				args, _ := json.Marshal(tc.Arguments)
+				fmt.Printf("→ %s %s\n", tc.Name, args)
+			}
+		}
+	},
+}
+
+// sessionsClearCmd represents the sessions clear command
+var sessionsClearCmd = &cobra.Command{
+	Use:   "clear <key>",
+	Short: "Clear a session's messages",
+	Long:  `Remove all messages and the summary from a session, keeping its settings.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if gateway := remote(); gateway != nil {
+			mustRemote(gateway.do("POST", sessionPath(args[0])+"/clear", nil))
+			fmt.Printf("Session %s cleared\n", args[0])
+			return
+		}
+
+		sessionManager := openSessionManager()
+		defer sessionManager.Close()
+
+		if err := sessionManager.ClearSession(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error clearing session: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Session %s cleared\n", args[0])
+	},
+}
+
+// sessionsDeleteCmd represents the sessions delete command
+var sessionsDeleteCmd = &cobra.Command{
+	Use:   "delete <key>",
+	Short: "Delete a session",
+	Long:  `Delete a session and everything stored for it.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if gateway := remote(); gateway != nil {
+			mustRemote(gateway.do("DELETE", sessionPath(args[0]), nil))
+			fmt.Printf("Session %s deleted\n", args[0])
+			return
+		}
+
+		sessionManager := openSessionManager()
+		defer sessionManager.Close()
+
+		if err := sessionManager.DeleteSession(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error deleting session: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Session %s deleted\n", args[0])
+	},
+}
+
+// sessionsExportCmd represents the sessions export command
+var sessionsExportCmd = &cobra.Command{
+	Use:   "export <key>",
+	Short: "Export a session transcript",
+	Long:  `Export a session transcript as markdown or JSON to stdout or a file.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		sessionManager := openSessionManager()
+		defer sessionManager.Close()
+
+		sess := mustGetSession(sessionManager, args[0])
+
+		var content []byte
+		switch strings.ToLower(format) {
+		case "markdown", "md":
+			content = []byte(sessionToMarkdown(sess))
+		case "json":
+			data, err := json.MarshalIndent(sess, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error encoding session: %v\n", err)
+				os.Exit(1)
+			}
+			content = append(data, '\n')
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown format %q (use markdown or json)\n", format)
+			os.Exit(1)
+		}
+
+		if output == "" || output == "-" {
+			os.Stdout.Write(content)
+			return
+		}
+		if err := os.WriteFile(output, content, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", output, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Session %s exported to %s\n", sess.Key, output)
+	},
+}
+
+// sessionsCheckpointCmd represents the sessions checkpoint command
+var sessionsCheckpointCmd = &cobra.Command{
+	Use:   "checkpoint <key> [name]",
+	Short: "Checkpoint a session",
+	Long:  `Record the current state of a session so it can later be rolled back or branched. Use --list to show existing checkpoints.`,
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		list, _ := cmd.Flags().GetBool("list")
+
+		sessionManager := openSessionManager()
+		defer sessionManager.Close()
+
+		if list {
+			checkpoints, err := sessionManager.ListCheckpoints(args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing checkpoints: %v\n", err)
+				os.Exit(1)
+			}
+			if len(checkpoints) == 0 {
+				fmt.Println("No checkpoints.")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tMESSAGES\tCREATED")
+			for _, checkpoint := range checkpoints {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", checkpoint.Name, checkpoint.MessageCount, formatActivity(checkpoint.CreatedAt))
+			}
+			w.Flush()
+			return
+		}
+
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		}
+		checkpoint, err := sessionManager.CreateCheckpoint(args[0], name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating checkpoint: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Checkpoint %s created at message %d of session %s\n", checkpoint.Name, checkpoint.MessageCount, args[0])
+	},
+}
+
+// sessionsRollbackCmd represents the sessions rollback command
+var sessionsRollbackCmd = &cobra.Command{
+	Use:   "rollback <key> <checkpoint>",
+	Short: "Roll a session back to a checkpoint",
+	Long:  `Discard every message after a checkpoint and restore the summary and settings saved with it.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		sessionManager := openSessionManager()
+		defer sessionManager.Close()
+
+		if err := sessionManager.RollbackToCheckpoint(args[0], args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error rolling back session: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Session %s rolled back to checkpoint %s\n", args[0], args[1])
+	},
+}
+
+// sessionsBranchCmd represents the sessions branch command
+var sessionsBranchCmd = &cobra.Command{
+	Use:   "branch <key> <new-key>",
+	Short: "Branch a session into a new one",
+	Long:  `Copy a session, as it is now or as it was at a checkpoint, into a new session. The original is left untouched.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		from, _ := cmd.Flags().GetString("from")
+
+		sessionManager := openSessionManager()
+		defer sessionManager.Close()
+
+		if err := sessionManager.BranchSession(args[0], from, args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error branching session: %v\n", err)
+			os.Exit(1)
+		}
+		if from != "" {
+			fmt.Printf("Session %s branched from checkpoint %s of %s\n", args[1], from, args[0])
+			return
+		}
+		fmt.Printf("Session %s branched from %s\n", args[1], args[0])
+	},
+}
+
+// sessionsCompactCmd represents the sessions compact command
+var sessionsCompactCmd = &cobra.Command{
+	Use:   "compact <key>",
+	Short: "Summarize older turns of a session",
+	Long:  `Fold all but the most recent messages of a session into its rolling summary using the configured model.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sessionKey := args[0]
+		keep, _ := cmd.Flags().GetInt("keep")
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+
+		agentLoop, err := agent.NewAgentLoop(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing agent: %v\n", err)
+			os.Exit(1)
+		}
+		defer agentLoop.Stop()
+
+		compacted, err := agentLoop.CompactSession(context.Background(), sessionKey, keep)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error compacting session: %v\n", err)
+			os.Exit(1)
+		}
+
+		if !compacted {
+			fmt.Printf("Session %s has nothing to compact\n", sessionKey)
+			return
+		}
+		fmt.Printf("Session %s compacted; the last %d messages are kept verbatim\n", sessionKey, keep)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+
+	// Add subcommands
+	sessionsCmd.AddCommand(sessionsListCmd)
+	sessionsCmd.AddCommand(sessionsShowCmd)
+	sessionsCmd.AddCommand(sessionsClearCmd)
+	sessionsCmd.AddCommand(sessionsDeleteCmd)
+	sessionsCmd.AddCommand(sessionsExportCmd)
+	sessionsCmd.AddCommand(sessionsCompactCmd)
+	sessionsCmd.AddCommand(sessionsCheckpointCmd)
+	sessionsCmd.AddCommand(sessionsRollbackCmd)
+	sessionsCmd.AddCommand(sessionsBranchCmd)
+	supportsRemote(sessionsListCmd, sessionsShowCmd, sessionsClearCmd, sessionsDeleteCmd)
+
+	// Sessions list flags
+	sessionsListCmd.Flags().String("channel", "", "Only list sessions from this channel (e.g. 'telegram')")
+
+	// Sessions show flags
+	sessionsShowCmd.Flags().IntP("limit", "n", 20, "Show at most N most recent messages (0 for all)")
+
+	// Sessions export flags
+	sessionsExportCmd.Flags().StringP("format", "f", "markdown", "Export format: markdown or json")
+	sessionsExportCmd.Flags().StringP("output", "o", "", "Output file (default stdout)")
+
+	// Sessions compact flags
+	sessionsCompactCmd.Flags().IntP("keep", "k", 10, "Number of recent messages to keep out of the summary")
+
+	// Sessions checkpoint flags
+	sessionsCheckpointCmd.Flags().BoolP("list", "l", false, "List the session's checkpoints instead of creating one")
+
+	// Sessions branch flags
+	sessionsBranchCmd.Flags().String("from", "", "Branch from this checkpoint instead of the current state")
+}
+
+// openSessionManager opens the configured session store, exiting on error
+func openSessionManager() *session.SessionManager {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	store, err := session.NewStore(cfg.Session, cfg.GetWorkspacePath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening session store: %v\n", err)
+		os.Exit(1)
+	}
+	return session.NewSessionManagerWithStore(cfg.GetWorkspacePath(), store)
+}
+
+// mustGetSession loads a session, exiting if it doesn't exist
+func mustGetSession(sessionManager *session.SessionManager, key string) *session.Session {
+	sess, exists := sessionManager.GetSession(key)
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Session %s not found\n", key)
+		os.Exit(1)
+	}
+	return sess
+}
+
+// formatActivity formats a timestamp with a relative age
+func formatActivity(t time.Time) string {
+	age := time.Since(t)
+	var ago string
+	switch {
+	case age < time.Minute:
+		ago = "just now"
+	case age < time.Hour:
+		ago = fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < 24*time.Hour:
+		ago = fmt.Sprintf("%dh ago", int(age.Hours()))
+	default:
+		ago = fmt.Sprintf("%dd ago", int(age.Hours()/24))
+	}
+	return fmt.Sprintf("%s (%s)", t.Local().Format("2006-01-02 15:04"), ago)
+}
+
+// sessionToMarkdown renders a session transcript as markdown
+func sessionToMarkdown(sess *session.Session) string {
+	var b strings.Builder
+	info := sess.Info()
+
+	b.WriteString(fmt.Sprintf("# Session %s\n\n", info.Key))
+	b.WriteString(fmt.Sprintf("- Channel: %s\n", info.Channel()))
+	b.WriteString(fmt.Sprintf("- Created: %s\n", info.CreatedAt.Format(time.RFC3339)))
+	b.WriteString(fmt.Sprintf("- Last activity: %s\n", info.UpdatedAt.Format(time.RFC3339)))
+	b.WriteString(fmt.Sprintf("- Messages: %d\n", info.MessageCount))
+
+	if summary, _ := sess.Data[session.DataKeySummary].(string); summary != "" {
+		b.WriteString("\n## Summary\n\n")
+		b.WriteString(summary)
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n## Transcript\n")
+	for _, msg := range sess.Messages {
+		b.WriteString(fmt.Sprintf("\n### %s · %s\n\n", messageLabel(msg), msg.Timestamp.Format("2006-01-02 15:04:05")))
+		if msg.Role == "tool" {
+			b.WriteString("```\n" + msg.Content + "\n```\n")
+		} else if msg.Content != "" {
+			b.WriteString(msg.Content)
+			b.WriteString("\n")
+		}
+		for _, tc := range msg.ToolCalls {
+			args, _ := json.Marshal(tc.Arguments)
+			b.WriteString(fmt.Sprintf("- Called `%s` with `%s`\n", tc.Name, args))
+		}
+	}
+	return b.String()
+}
+
+// messageLabel names the speaker of a message, including the tool for tool results
+func messageLabel(msg session.Message) string {
+	if msg.Role == "tool" && msg.Name != "" {
+		return fmt.Sprintf("tool (%s)", msg.Name)
+	}
+	return msg.Role
+}
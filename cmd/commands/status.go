@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"nanotalon/api"
 	"nanotalon/config"
+	"nanotalon/cron"
 
 	"github.com/spf13/cobra"
 )
@@ -16,6 +19,11 @@ var statusCmd = &cobra.Command{
 	Short: "Show nanotalon status",
 	Long:  `Show the status of nanotalon installation and configuration.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if gateway := remote(); gateway != nil {
+			showRemoteStatus(gateway)
+			return
+		}
+
 		// Load configuration
 		cfg, err := config.LoadConfig()
 		if err != nil {
@@ -23,13 +31,11 @@ var statusCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		homeDir, err := os.UserHomeDir()
+		configPath, err := config.ConfigPath()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting home directory: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error finding config file: %v\n", err)
 			os.Exit(1)
 		}
-
-		configPath := filepath.Join(homeDir, ".nanotalon", "config.yaml")
 		workspace := cfg.GetWorkspacePath()
 
 		fmt.Println("🐈 nanotalon Status")
@@ -59,9 +65,75 @@ var statusCmd = &cobra.Command{
 		fmt.Printf("  Cron: %s\n", checkMark(true))
 		fmt.Printf("  Memory: %s\n", checkMark(dirExists(filepath.Join(workspace, "memory"))))
 		fmt.Printf("  Heartbeat: %s\n", checkMark(cfg.Gateway.Heartbeat.Enabled))
+
+		// Surface scheduled jobs whose last run failed, reading the store without scheduling them
+		if jobs, err := cron.LoadJobs(cronStorePath()); err == nil {
+			var failed []*cron.CronJob
+			for _, job := range jobs {
+				if run := job.State.LastRun(); run != nil && run.Status == "error" {
+					failed = append(failed, job)
+				}
+			}
+			if len(failed) > 0 {
+				fmt.Println()
+				fmt.Println("Failing cron jobs:")
+				for _, job := range failed {
+					fmt.Printf("  %s (id: %s): %s\n", job.Name, job.ID, job.State.LastRun().Error)
+				}
+				fmt.Println("Run 'nanotalon cron history <id>' for details.")
+			}
+		}
 	},
 }
 
+// showRemoteStatus shows the status of a running gateway: what it runs, its readiness
+// checks and failing cron jobs
+func showRemoteStatus(gateway *remoteGateway) {
+	var status struct {
+		Model     string        `json:"model"`
+		Workspace string        `json:"workspace"`
+		StartedAt time.Time     `json:"started_at"`
+		Readiness api.Readiness `json:"readiness"`
+	}
+	mustRemote(gateway.get("/v1/status", &status))
+
+	fmt.Printf("🐈 nanotalon Status (%s)\n", gateway.baseURL)
+	fmt.Println()
+	fmt.Printf("Model: %s\n", status.Model)
+	fmt.Printf("Workspace: %s\n", status.Workspace)
+	fmt.Printf("Running since: %s\n", formatActivity(status.StartedAt))
+	fmt.Printf("Ready: %s\n", checkMark(status.Readiness.Ready))
+
+	fmt.Println()
+	fmt.Println("Checks:")
+	for _, name := range []string{"provider", "channels", "cron", "disk"} {
+		check := status.Readiness.Checks[name]
+		line := fmt.Sprintf("  %s: %s", name, check.Status)
+		if check.Detail != "" {
+			line += " (" + check.Detail + ")"
+		}
+		fmt.Println(line)
+	}
+
+	var jobs struct {
+		Jobs []*cron.CronJob `json:"jobs"`
+	}
+	mustRemote(gateway.get("/v1/jobs", &jobs))
+	var failing []*cron.CronJob
+	for _, job := range jobs.Jobs {
+		if run := job.State.LastRun(); run != nil && run.Status == "error" {
+			failing = append(failing, job)
+		}
+	}
+	if len(failing) > 0 {
+		fmt.Println()
+		fmt.Println("Failing cron jobs:")
+		for _, job := range failing {
+			fmt.Printf("  %s (id: %s): %s\n", job.Name, job.ID, job.State.LastRun().Error)
+		}
+	}
+}
+
 // Helper function to check if file exists
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
@@ -98,4 +170,5 @@ func trimApiKey(key string) string {
 
 func init() {
 	rootCmd.AddCommand(statusCmd)
+	supportsRemote(statusCmd)
 }
@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"nanotalon/agent/subagent"
+	"nanotalon/config"
+
+	"github.com/spf13/cobra"
+)
+
+// subagentsCmd represents the subagents command
+var subagentsCmd = &cobra.Command{
+	Use:   "subagents",
+	Short: "Inspect and cancel background subagents",
+	Long:  `Inspect and cancel the background tasks the agent handed to subagents in the gateway.`,
+}
+
+// subagentsListCmd represents the subagents list command
+var subagentsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List subagents",
+	Long:  `List subagents that are waiting or running, and with --all the finished ones too, with their dependencies.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+
+		tasks := loadSubagentTasks()
+		var shown []subagent.SubagentTask
+		for _, task := range tasks {
+			if all || task.FinishedAt == nil {
+				shown = append(shown, task)
+			}
+		}
+		if len(shown) == 0 {
+			if all {
+				fmt.Println("No subagents.")
+			} else {
+				fmt.Println("No subagents are waiting or running.")
+			}
+			return
+		}
+
+		known := make(map[string]subagent.SubagentTask, len(tasks))
+		for _, task := range tasks {
+			known[task.ID] = task
+		}
+		fmt.Println("Subagents:")
+		for _, task := range shown {
+			fmt.Println(subagent.FormatTask(task, known, time.Now()))
+		}
+	},
+}
+
+// subagentsStatusCmd represents the subagents status command
+var subagentsStatusCmd = &cobra.Command{
+	Use:   "status <id>",
+	Short: "Show a subagent",
+	Long:  `Show a subagent's task, status, dependencies and, once finished, its result. The id can be shortened to any unique prefix.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		tasks := loadSubagentTasks()
+		known := make(map[string]subagent.SubagentTask, len(tasks))
+		for _, task := range tasks {
+			known[task.ID] = task
+		}
+
+		id, err := subagent.ResolveTaskID(tasks, args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(subagent.FormatTaskDetails(known[id], known, time.Now()))
+	},
+}
+
+// subagentsCancelCmd represents the subagents cancel command
+var subagentsCancelCmd = &cobra.Command{
+	Use:   "cancel <id>",
+	Short: "Cancel a subagent",
+	Long:  `Ask the running gateway to cancel a subagent that is waiting or running. It stops within a few seconds. The id can be shortened to any unique prefix.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := subagent.RequestCancel(subagentStorePath(), args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Asked the gateway to cancel subagent %s\n", args[0])
+	},
+}
+
+// subagentStorePath returns where the gateway keeps its subagent tasks
+func subagentStorePath() string {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	return subagent.DefaultStorePath(cfg.GetWorkspacePath())
+}
+
+// loadSubagentTasks reads the gateway's subagent tasks, exiting if they can't be read
+func loadSubagentTasks() []subagent.SubagentTask {
+	tasks, err := subagent.LoadTaskHistory(subagentStorePath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return tasks
+}
+
+func init() {
+	rootCmd.AddCommand(subagentsCmd)
+
+	subagentsCmd.AddCommand(subagentsListCmd)
+	subagentsCmd.AddCommand(subagentsStatusCmd)
+	subagentsCmd.AddCommand(subagentsCancelCmd)
+
+	subagentsListCmd.Flags().Bool("all", false, "Include finished subagents")
+}
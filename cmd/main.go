@@ -1,16 +1,12 @@
 package main
 
 import (
-	"log"
 	"os"
 
 	"nanotalon/cmd/commands"
 )
 
 func main() {
-	// Set up basic logging
-	log.SetOutput(os.Stdout)
-
 	// Check if any arguments are provided
 	if len(os.Args) == 1 {
 		// If no args, show help
@@ -1,11 +1,22 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
 )
 
 // Config represents the root configuration for nanobot
@@ -15,42 +26,111 @@ type Config struct {
 	Providers ProvidersConfig `mapstructure:"providers"`
 	Gateway   GatewayConfig   `mapstructure:"gateway"`
 	Tools     ToolsConfig     `mapstructure:"tools"`
+	Memory    MemoryConfig    `mapstructure:"memory"`
+	Session   SessionConfig   `mapstructure:"session"`
+	Models    []ModelConfig   `mapstructure:"models"`
+	Logging   LoggingConfig   `mapstructure:"logging"`
+}
+
+// LoggingConfig contains logging configuration
+type LoggingConfig struct {
+	Level      string `mapstructure:"level"`       // debug | info | warn | error
+	Format     string `mapstructure:"format"`      // text | json
+	File       string `mapstructure:"file"`        // Written instead of stderr when set
+	MaxSizeMB  int    `mapstructure:"max_size_mb"` // The file is rotated past this size; 0 never rotates
+	MaxBackups int    `mapstructure:"max_backups"` // Rotated files kept, <file>.1 being the newest
+}
+
+// Validate checks the level and format
+func (c LoggingConfig) Validate() error {
+	switch strings.ToLower(c.Level) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("level must be debug, info, warn or error, got %q", c.Level)
+	}
+	switch strings.ToLower(c.Format) {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("format must be text or json, got %q", c.Format)
+	}
+	if c.MaxSizeMB < 0 || c.MaxBackups < 0 {
+		return fmt.Errorf("max_size_mb and max_backups must not be negative")
+	}
+	return nil
 }
 
 // AgentsConfig contains agent-specific configurations
 type AgentsConfig struct {
-	Defaults AgentDefaults `mapstructure:"defaults"`
+	Defaults   AgentDefaults     `mapstructure:"defaults"`
+	Hooks      []HookConfig      `mapstructure:"hooks"`
+	Workspaces map[string]string `mapstructure:"workspaces"` // Named workspaces, chosen by name in defaults.workspace or with --workspace
+}
+
+// HookConfig runs a workspace script at one point of the agent loop
+type HookConfig struct {
+	Event   string `mapstructure:"event"`   // user_message | tool_call | tool_result | assistant_reply
+	Command string `mapstructure:"command"` // Run with sh -c in the workspace; JSON on stdin and stdout
+	Timeout int    `mapstructure:"timeout"` // Seconds; defaults to 10
 }
 
 // AgentDefaults contains default agent settings
 type AgentDefaults struct {
-	Workspace         string  `mapstructure:"workspace"`
-	Model             string  `mapstructure:"model"`
-	MaxTokens         int     `mapstructure:"max_tokens"`
-	Temperature       float64 `mapstructure:"temperature"`
-	MaxToolIterations int     `mapstructure:"max_tool_iterations"`
-	MemoryWindow      int     `mapstructure:"memory_window"`
+	Workspace          string  `mapstructure:"workspace"`
+	Model              string  `mapstructure:"model"`
+	MaxTokens          int     `mapstructure:"max_tokens"`
+	Temperature        float64 `mapstructure:"temperature"`
+	MaxToolIterations  int     `mapstructure:"max_tool_iterations"`
+	MemoryWindow       int     `mapstructure:"memory_window"`
+	MaxHistoryTokens   int     `mapstructure:"max_history_tokens"`
+	AutoCompact        bool    `mapstructure:"auto_compact"`
+	Workers            int     `mapstructure:"workers"`
+	MaxToolRetries     int     `mapstructure:"max_tool_retries"`
+	Planning           bool    `mapstructure:"planning"`
+	PlanStepIterations int     `mapstructure:"plan_step_iterations"`
+	MaxRequestTokens   int     `mapstructure:"max_request_tokens"` // 0 = no cap
+	DailyTokenBudget   int     `mapstructure:"daily_token_budget"` // 0 = no cap
+	Scratchpad         bool    `mapstructure:"scratchpad"`         // Notes shared by the agent and its subagents
 }
 
 // ChannelsConfig contains configurations for various chat channels
 type ChannelsConfig struct {
-	SendProgress   bool           `mapstructure:"send_progress"`
-	SendToolHints  bool           `mapstructure:"send_tool_hints"`
-	WhatsApp       WhatsAppConfig `mapstructure:"whatsapp"`
-	Telegram       TelegramConfig `mapstructure:"telegram"`
-	Discord        DiscordConfig  `mapstructure:"discord"`
-	Feishu         FeishuConfig   `mapstructure:"feishu"`
-	Mochat         MochatConfig   `mapstructure:"mochat"`
-	DingTalk       DingTalkConfig `mapstructure:"dingtalk"`
-	Email          EmailConfig    `mapstructure:"email"`
-	QQ             QQConfig       `mapstructure:"qq"`
-	Slack          SlackConfig    `mapstructure:"slack"`
+	SendProgress     bool             `mapstructure:"send_progress"`
+	SendToolHints    bool             `mapstructure:"send_tool_hints"`
+	SendTyping       bool             `mapstructure:"send_typing"`        // Typing indicator while a turn runs
+	SendReadReceipts bool             `mapstructure:"send_read_receipts"` // Mark messages read when a turn starts
+	Groups           GroupsConfig     `mapstructure:"groups"`
+	WhatsApp         WhatsAppConfig   `mapstructure:"whatsapp"`
+	Telegram         TelegramConfig   `mapstructure:"telegram"`
+	Discord          DiscordConfig    `mapstructure:"discord"`
+	Feishu           FeishuConfig     `mapstructure:"feishu"`
+	Mochat           MochatConfig     `mapstructure:"mochat"`
+	DingTalk         DingTalkConfig   `mapstructure:"dingtalk"`
+	Email            EmailConfig      `mapstructure:"email"`
+	QQ               QQConfig         `mapstructure:"qq"`
+	Slack            SlackConfig      `mapstructure:"slack"`
+	Mattermost       MattermostConfig `mapstructure:"mattermost"`
+	RocketChat       RocketChatConfig `mapstructure:"rocketchat"`
+	Media            MediaConfig      `mapstructure:"media"`
+}
+
+// GroupsConfig controls how the bot behaves in group chats on Telegram, Discord and Slack
+type GroupsConfig struct {
+	RequireMention  bool `mapstructure:"require_mention"`  // Only answer when mentioned or replied to
+	ContextMessages int  `mapstructure:"context_messages"` // Recent group messages sent along with one the bot answers
+}
+
+// MediaConfig controls how attachments of incoming messages are saved and described
+type MediaConfig struct {
+	MaxSizeMB         int    `mapstructure:"max_size_mb"`        // Larger attachments are skipped
+	OCRCommand        string `mapstructure:"ocr_command"`        // Prints an image's text; {file} is the path. Defaults to tesseract if installed
+	TranscribeCommand string `mapstructure:"transcribe_command"` // Prints an audio file's transcript; {file} is the path
 }
 
 // WhatsAppConfig contains WhatsApp channel configuration
 type WhatsAppConfig struct {
-	Enabled   bool     `mapstructure:"enabled"`
-	AllowFrom []string `mapstructure:"allow_from"`
+	Enabled     bool     `mapstructure:"enabled"`
+	AllowFrom   []string `mapstructure:"allow_from"`
+	SessionPath string   `mapstructure:"session_path"` // Linked device store, created by `channels login whatsapp`
 }
 
 // TelegramConfig contains Telegram channel configuration
@@ -125,6 +205,75 @@ type QQConfig struct {
 	AllowFrom []string `mapstructure:"allow_from"`
 }
 
+// MattermostConfig contains Mattermost channel configuration
+type MattermostConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	URL       string   `mapstructure:"url"`   // Server URL, e.g. https://chat.example.com
+	Token     string   `mapstructure:"token"` // Bot or personal access token
+	AllowFrom []string `mapstructure:"allow_from"`
+}
+
+// RocketChatConfig contains Rocket.Chat channel configuration
+type RocketChatConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	URL       string   `mapstructure:"url"`     // Server URL, e.g. https://chat.example.com
+	UserID    string   `mapstructure:"user_id"` // ID of the user the token belongs to
+	Token     string   `mapstructure:"token"`   // Personal access token
+	AllowFrom []string `mapstructure:"allow_from"`
+}
+
+// ModelConfig overrides the generation parameters of requests to the models it matches.
+// Every matching entry applies, in order, so a later one wins over an earlier one.
+type ModelConfig struct {
+	Match           string   `mapstructure:"match"`       // Glob against the model with or without its provider, e.g. openai/o* or *sonnet*
+	Temperature     *float64 `mapstructure:"temperature"` // Unset leaves the agent's
+	MaxTokens       int      `mapstructure:"max_tokens"`  // 0 leaves the agent's
+	TopP            *float64 `mapstructure:"top_p"`
+	Stop            []string `mapstructure:"stop"`
+	ReasoningEffort string   `mapstructure:"reasoning_effort"` // minimal | low | medium | high, for reasoning models
+}
+
+// Matches reports whether the entry applies to model, such as openai/gpt-4o or
+// openrouter/anthropic/claude-sonnet-4-5, with or without its provider prefixes
+func (c ModelConfig) Matches(model string) bool {
+	model = strings.ToLower(model)
+	pattern := strings.ToLower(c.Match)
+	for {
+		if ok, _ := path.Match(pattern, model); ok {
+			return true
+		}
+		var found bool
+		if _, model, found = strings.Cut(model, "/"); !found {
+			return false
+		}
+	}
+}
+
+// Validate checks the entry's pattern and parameters
+func (c ModelConfig) Validate() error {
+	if c.Match == "" {
+		return fmt.Errorf("needs a match pattern")
+	}
+	if _, err := path.Match(c.Match, ""); err != nil {
+		return fmt.Errorf("invalid match pattern %q", c.Match)
+	}
+	if c.Temperature != nil && (*c.Temperature < 0 || *c.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if c.TopP != nil && (*c.TopP <= 0 || *c.TopP > 1) {
+		return fmt.Errorf("top_p must be above 0 and at most 1")
+	}
+	if c.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative")
+	}
+	switch c.ReasoningEffort {
+	case "", "minimal", "low", "medium", "high":
+	default:
+		return fmt.Errorf("reasoning_effort must be minimal, low, medium or high, got %q", c.ReasoningEffort)
+	}
+	return nil
+}
+
 // ProvidersConfig contains configurations for LLM providers
 type ProvidersConfig struct {
 	Custom        ProviderConfig `mapstructure:"custom"`
@@ -155,9 +304,48 @@ type ProviderConfig struct {
 
 // GatewayConfig contains gateway/server configuration
 type GatewayConfig struct {
-	Host      string          `mapstructure:"host"`
-	Port      int             `mapstructure:"port"`
-	Heartbeat HeartbeatConfig `mapstructure:"heartbeat"`
+	Host           string           `mapstructure:"host"`
+	Port           int              `mapstructure:"port"`
+	BasePath       string           `mapstructure:"base_path"`       // Path prefix the gateway is served under, such as /nanotalon behind a proxy
+	TrustedProxies []string         `mapstructure:"trusted_proxies"` // IPs or CIDRs whose X-Forwarded-For is believed
+	TLS            GatewayTLSConfig `mapstructure:"tls"`
+	Heartbeat      HeartbeatConfig  `mapstructure:"heartbeat"`
+	Cron           CronConfig       `mapstructure:"cron"`
+	API            APIConfig        `mapstructure:"api"`
+}
+
+// GatewayTLSConfig serves the gateway over HTTPS while a certificate and key are set
+type GatewayTLSConfig struct {
+	CertFile string `mapstructure:"cert_file"` // PEM certificate chain, reloaded when it changes
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+// APIConfig contains the gateway's HTTP API configuration. The API is off while no token
+// is set.
+type APIConfig struct {
+	Token  string     `mapstructure:"token"`  // Bearer token with full access
+	Tokens []APIToken `mapstructure:"tokens"` // Further tokens limited to some scopes
+}
+
+// APIToken is an HTTP API token limited to some scopes: "chat" runs turns, "read" views
+// sessions, memory, jobs and status, and "admin" allows everything, such as deleting sessions
+type APIToken struct {
+	Name   string   `mapstructure:"name"` // Shown in the logs
+	Token  string   `mapstructure:"token"`
+	Scopes []string `mapstructure:"scopes"`
+}
+
+// CronConfig contains scheduled job configuration
+type CronConfig struct {
+	MaxConcurrent int              `mapstructure:"max_concurrent"` // Cron-driven agent runs at once, 0 for no limit
+	QuietHours    QuietHoursConfig `mapstructure:"quiet_hours"`
+}
+
+// QuietHoursConfig is a daily window when scheduled job results are held, to be delivered when it ends
+type QuietHoursConfig struct {
+	Start    string `mapstructure:"start"`    // "HH:MM", empty for no quiet hours
+	End      string `mapstructure:"end"`      // "HH:MM"; before start for a window that crosses midnight
+	Timezone string `mapstructure:"timezone"` // IANA timezone, the local one if empty
 }
 
 // HeartbeatConfig contains heartbeat service configuration
@@ -168,10 +356,96 @@ type HeartbeatConfig struct {
 
 // ToolsConfig contains tools configuration
 type ToolsConfig struct {
-	Web                 WebToolsConfig `mapstructure:"web"`
-	Exec                ExecToolConfig `mapstructure:"exec"`
-	RestrictToWorkspace bool           `mapstructure:"restrict_to_workspace"`
-	MCPServers          map[string]any `mapstructure:"mcp_servers"`
+	Web                 WebToolsConfig              `mapstructure:"web"`
+	Exec                ExecToolConfig              `mapstructure:"exec"`
+	RunCode             RunCodeConfig               `mapstructure:"run_code"`
+	Desktop             DesktopConfig               `mapstructure:"desktop"`
+	Weather             WeatherToolConfig           `mapstructure:"weather"`
+	RestrictToWorkspace bool                        `mapstructure:"restrict_to_workspace"`
+	MCPServers          map[string]MCPServerConfig  `mapstructure:"mcp_servers"`
+	Enabled             []string                    `mapstructure:"enabled"`
+	Disabled            []string                    `mapstructure:"disabled"`
+	Channels            map[string]ToolPolicyConfig `mapstructure:"channels"`
+	MaxOutputChars      int                         `mapstructure:"max_output_chars"`
+	AuditLog            bool                        `mapstructure:"audit_log"`
+}
+
+// MCPServerConfig configures an MCP server, either a command the agent starts and talks to
+// over stdio, or the URL of a remote server
+type MCPServerConfig struct {
+	Command      string            `mapstructure:"command"`
+	Args         []string          `mapstructure:"args"`
+	Env          map[string]string `mapstructure:"env"`
+	URL          string            `mapstructure:"url"`
+	Headers      map[string]string `mapstructure:"headers"`
+	Timeout      int               `mapstructure:"timeout"`     // Seconds a request waits for a response
+	ToolTimeout  int               `mapstructure:"tooltimeout"` // Older name of timeout
+	Enabled      *bool             `mapstructure:"enabled"`     // Defaults to true
+	AllowedTools []string          `mapstructure:"allowed_tools"` // Glob patterns; all tools if empty
+	BlockedTools []string          `mapstructure:"blocked_tools"` // Glob patterns, applied after allowed_tools
+	OAuth        MCPOAuthConfig    `mapstructure:"oauth"`
+	Sampling     MCPSamplingConfig `mapstructure:"sampling"`
+}
+
+// MCPSamplingConfig controls whether an MCP server may ask the agent's model for completions
+// (sampling/createMessage), and with what model and token cap. Servers may not by default.
+type MCPSamplingConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Model     string `mapstructure:"model"`      // Defaults to agents.defaults.model
+	MaxTokens int    `mapstructure:"max_tokens"` // Caps each completion; agents.defaults.max_tokens if 0
+}
+
+// MCPOAuthConfig configures OAuth for a remote MCP server
+type MCPOAuthConfig struct {
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	Scopes       []string `mapstructure:"scopes"`
+	CallbackPort int      `mapstructure:"callback_port"`
+}
+
+// IsEnabled reports whether the server is used
+func (c MCPServerConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// Validate checks that the server can be connected to
+func (c MCPServerConfig) Validate() error {
+	switch {
+	case c.Command == "" && c.URL == "":
+		return fmt.Errorf("needs a command or a url")
+	case c.Command != "" && c.URL != "":
+		return fmt.Errorf("has both a command and a url")
+	case c.Timeout < 0 || c.ToolTimeout < 0:
+		return fmt.Errorf("timeout must not be negative")
+	}
+
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "ws", "wss":
+		default:
+			return fmt.Errorf("url must be http(s):// or ws(s)://, got %q", c.URL)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("url %q has no host", c.URL)
+		}
+	}
+
+	for _, pattern := range append(append([]string{}, c.AllowedTools...), c.BlockedTools...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// ToolPolicyConfig restricts the tools available to messages from one channel
+type ToolPolicyConfig struct {
+	Enabled  []string `mapstructure:"enabled"`
+	Disabled []string `mapstructure:"disabled"`
 }
 
 // WebToolsConfig contains web tools configuration
@@ -187,7 +461,104 @@ type WebSearchConfig struct {
 
 // ExecToolConfig contains shell exec tool configuration
 type ExecToolConfig struct {
-	Timeout int `mapstructure:"timeout"`
+	Timeout int              `mapstructure:"timeout"`
+	Safety  ExecSafetyConfig `mapstructure:"safety"`
+}
+
+// ExecSafetyConfig screens commands for destructive or exfiltrating patterns before they run.
+// Deny rules are added to the built-in ones; commands matching an allow pattern always run.
+type ExecSafetyConfig struct {
+	Mode  string              `mapstructure:"mode"` // approve | refuse | off
+	Deny  []CommandRuleConfig `mapstructure:"deny"`
+	Allow []string            `mapstructure:"allow"`
+}
+
+// CommandRuleConfig flags commands matching a regular expression
+type CommandRuleConfig struct {
+	Pattern string `mapstructure:"pattern"`
+	Reason  string `mapstructure:"reason"` // Shown to the user, e.g. "deletes the production database"
+}
+
+// RunCodeConfig contains code interpreter tool configuration. The tool is opt-in since
+// snippets run unsandboxed on the host.
+type RunCodeConfig struct {
+	Enabled  bool `mapstructure:"enabled"`
+	Timeout  int  `mapstructure:"timeout"`
+	MemoryMB int  `mapstructure:"memory_mb"`
+}
+
+// WeatherToolConfig contains weather tool configuration
+type WeatherToolConfig struct {
+	DefaultLocation string `mapstructure:"default_location"`
+	Units           string `mapstructure:"units"`
+}
+
+// DesktopConfig contains opt-in local desktop integration tools
+type DesktopConfig struct {
+	Clipboard bool `mapstructure:"clipboard"`
+	Notify    bool `mapstructure:"notify"`
+}
+
+// SessionConfig contains session persistence configuration
+type SessionConfig struct {
+	Store string `mapstructure:"store"` // jsonl | sqlite
+	Path  string `mapstructure:"path"`
+}
+
+// MemoryConfig contains memory subsystem configuration
+type MemoryConfig struct {
+	VectorStore VectorStoreConfig  `mapstructure:"vector_store"`
+	Embeddings  EmbeddingsConfig   `mapstructure:"embeddings"`
+	Knowledge   KnowledgeConfig    `mapstructure:"knowledge"`
+	Scopes      MemoryScopesConfig `mapstructure:"scopes"`
+	History     HistoryConfig      `mapstructure:"history"`
+}
+
+// HistoryConfig controls the HISTORY.md log of each memory scope
+type HistoryConfig struct {
+	AutoCapture bool  `mapstructure:"auto_capture"` // Append a condensed record of each completed turn
+	MaxBytes    int64 `mapstructure:"max_bytes"`    // Rotate older entries into HISTORY-YYYY-MM.md past this size; -1 never rotates
+	KeepBytes   int64 `mapstructure:"keep_bytes"`   // Newest entries left in HISTORY.md after rotating
+}
+
+// MemoryScopesConfig keeps memory apart between chats. Each tier is "global" (shared by
+// all chats), "channel" (shared by the chats of one channel) or "chat" (one chat only).
+type MemoryScopesConfig struct {
+	Write    string                       `mapstructure:"write"`    // Tier new memories and facts go to
+	Read     []string                     `mapstructure:"read"`     // Tiers a chat can see; the write tier always is
+	Channels map[string]MemoryScopePolicy `mapstructure:"channels"` // Per-channel overrides
+}
+
+// MemoryScopePolicy overrides the memory tiers of one channel; empty fields keep the defaults
+type MemoryScopePolicy struct {
+	Write string   `mapstructure:"write"`
+	Read  []string `mapstructure:"read"`
+}
+
+// KnowledgeConfig contains knowledge base configuration. Documents dropped into
+// workspace/knowledge are indexed with the embedding model and searched with kb_search.
+type KnowledgeConfig struct {
+	AutoRetrieve bool    `mapstructure:"auto_retrieve"` // Add relevant excerpts to each message
+	MaxResults   int     `mapstructure:"max_results"`   // Excerpts per search
+	MinScore     float64 `mapstructure:"min_score"`     // Similarity an excerpt needs to be added automatically
+	PDFCommand   string  `mapstructure:"pdf_command"`   // Prints a PDF's text; {file} is the path. Defaults to pdftotext if installed
+}
+
+// EmbeddingsConfig selects the embedding model used for semantic memory search.
+// The API key and base URL come from the matching providers entry.
+type EmbeddingsConfig struct {
+	Model string `mapstructure:"model"` // e.g. "openai/text-embedding-3-small"
+}
+
+// VectorStoreConfig selects where memory and knowledge base searches run. The embedded
+// backend scans the local index; the others mirror its vectors to an external store.
+type VectorStoreConfig struct {
+	Backend    string `mapstructure:"backend"` // "embedded", "qdrant", "pgvector"
+	URL        string `mapstructure:"url"`     // qdrant: base URL
+	APIKey     string `mapstructure:"api_key"` // qdrant: optional API key
+	DSN        string `mapstructure:"dsn"`     // pgvector: postgres connection string
+	Collection string `mapstructure:"collection"`
+	Dimensions int    `mapstructure:"dimensions"`
 }
 
 // LoadConfig loads the configuration from the config file
@@ -198,52 +569,243 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("agents.defaults.temperature", 0.1)
 	viper.SetDefault("agents.defaults.max_tool_iterations", 40)
 	viper.SetDefault("agents.defaults.memory_window", 100)
+	viper.SetDefault("agents.defaults.max_history_tokens", 32000)
+	viper.SetDefault("agents.defaults.auto_compact", true)
+	viper.SetDefault("agents.defaults.workers", 4)
+	viper.SetDefault("agents.defaults.max_tool_retries", 3)
+	viper.SetDefault("agents.defaults.planning", false)
+	viper.SetDefault("agents.defaults.plan_step_iterations", 8)
+	viper.SetDefault("agents.defaults.max_request_tokens", 0)
+	viper.SetDefault("agents.defaults.daily_token_budget", 0)
+	viper.SetDefault("agents.defaults.scratchpad", false)
 	viper.SetDefault("gateway.host", "0.0.0.0")
 	viper.SetDefault("gateway.port", 18790)
 	viper.SetDefault("gateway.heartbeat.enabled", true)
 	viper.SetDefault("gateway.heartbeat.interval_s", 1800)
+	viper.SetDefault("gateway.cron.max_concurrent", 2)
 	viper.SetDefault("tools.exec.timeout", 60)
+	viper.SetDefault("channels.media.max_size_mb", 20)
+	viper.SetDefault("tools.exec.safety.mode", "approve")
+	viper.SetDefault("tools.run_code.enabled", false)
+	viper.SetDefault("tools.run_code.timeout", 30)
+	viper.SetDefault("tools.run_code.memory_mb", 512)
 	viper.SetDefault("tools.restrict_to_workspace", false)
+	viper.SetDefault("tools.max_output_chars", 16000)
+	viper.SetDefault("tools.audit_log", true)
+	viper.SetDefault("tools.weather.units", "metric")
+	viper.SetDefault("tools.desktop.clipboard", false)
+	viper.SetDefault("tools.desktop.notify", false)
 	viper.SetDefault("channels.send_progress", true)
 	viper.SetDefault("channels.send_tool_hints", false)
+	viper.SetDefault("channels.send_typing", true)
+	viper.SetDefault("channels.send_read_receipts", true)
+	viper.SetDefault("channels.groups.require_mention", true)
+	viper.SetDefault("channels.groups.context_messages", 10)
+	viper.SetDefault("session.store", "jsonl")
+	viper.SetDefault("memory.vector_store.backend", "embedded")
+	viper.SetDefault("memory.vector_store.collection", "nanotalon_memory")
+	viper.SetDefault("memory.embeddings.model", "openai/text-embedding-3-small")
+	viper.SetDefault("memory.knowledge.auto_retrieve", true)
+	viper.SetDefault("memory.knowledge.max_results", 3)
+	viper.SetDefault("memory.knowledge.min_score", 0.5)
+	viper.SetDefault("memory.scopes.write", "channel")
+	viper.SetDefault("memory.history.auto_capture", true)
+	viper.SetDefault("memory.history.max_bytes", 256*1024)
+	viper.SetDefault("memory.history.keep_bytes", 64*1024)
+	viper.SetDefault("memory.scopes.read", []string{"global", "channel"})
+	viper.SetDefault("logging.level", "info")
+	viper.SetDefault("logging.format", "text")
+	viper.SetDefault("logging.max_size_mb", 10)
+	viper.SetDefault("logging.max_backups", 5)
 
-	// Set config paths
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
+	if err := readConfig(); err != nil {
 		return nil, err
 	}
+	return unmarshalConfig()
+}
 
-	viper.AddConfigPath(filepath.Join(homeDir, ".nanobot"))
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-
-	// Read config
+// readConfig reads the config file into viper and merges the overlays over it
+func readConfig() error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	viper.SetConfigFile(path)
+	if filepath.Ext(path) == "" {
+		viper.SetConfigType("yaml")
+	}
 	if err := viper.ReadInConfig(); err != nil {
-		return nil, err
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("no config file at %s; run 'nanotalon onboard' to create one", path)
+		}
+		return err
 	}
+	return mergeOverlays()
+}
 
-	// Unmarshal config
+// mergeOverlays merges the config.d files and the profile over the config viper last read
+func mergeOverlays() error {
+	paths, err := OverlayPaths()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var overlay map[string]interface{}
+		if err := yaml.Unmarshal(data, &overlay); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if err := viper.MergeConfigMap(overlay); err != nil {
+			return fmt.Errorf("failed to merge %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// unmarshalConfig decodes the configuration viper last read
+func unmarshalConfig() (*Config, error) {
+	// Decode from a copy with the secrets that _cmd and _keychain keys fetch filled in
+	settings := viper.AllSettings()
+	if err := resolveSecrets(settings, configType, ""); err != nil {
+		return nil, err
+	}
+	resolved := viper.New()
+	if err := resolved.MergeConfigMap(settings); err != nil {
+		return nil, err
+	}
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	var metadata mapstructure.Metadata
+	if err := resolved.Unmarshal(&cfg, func(dc *mapstructure.DecoderConfig) { dc.Metadata = &metadata }); err != nil {
 		return nil, err
 	}
+	// Viper drops keys that match no setting, so a typo like telegramm would go unnoticed
+	for _, key := range unknownKeys(metadata.Unused) {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", key, unknownKeyMessage(key))
+	}
+	for name, server := range cfg.Tools.MCPServers {
+		if !server.IsEnabled() {
+			continue
+		}
+		if err := server.Validate(); err != nil {
+			return nil, fmt.Errorf("tools.mcp_servers.%s: %w", name, err)
+		}
+	}
+
+	for i, model := range cfg.Models {
+		if err := model.Validate(); err != nil {
+			return nil, fmt.Errorf("models.%d: %w", i, err)
+		}
+	}
 
-	// Set default workspace if not configured
-	if cfg.Agents.Defaults.Workspace == "" {
-		cfg.Agents.Defaults.Workspace = filepath.Join(homeDir, ".nanobot", "workspace")
+	if err := cfg.Logging.Validate(); err != nil {
+		return nil, fmt.Errorf("logging: %w", err)
+	}
+
+	workspace, err := resolveWorkspace(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Agents.Defaults.Workspace = workspace
+	if cfg.Logging.File != "" {
+		configPath, err := ConfigPath()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Logging.File = expandPath(cfg.Logging.File, filepath.Dir(configPath))
 	}
 
 	return &cfg, nil
 }
 
-// GetWorkspacePath returns the expanded workspace path
-func (c *Config) GetWorkspacePath() string {
-	workspace := c.Agents.Defaults.Workspace
-	if len(workspace) > 2 && workspace[:2] == "~/" {
-		homeDir, _ := os.UserHomeDir()
-		return filepath.Join(homeDir, workspace[2:])
+// reloadDelay is how long the config file has to stay unchanged before a change is applied,
+// so an editor's truncate-then-write save is read once, complete
+const reloadDelay = 500 * time.Millisecond
+
+// WatchConfig calls onChange with the new configuration each time the config file loaded by
+// LoadConfig, a config.d file or the profile changes. A file that fails to parse is logged
+// and the previous configuration kept.
+func WatchConfig(onChange func(*Config)) {
+	var mu sync.Mutex
+	var timer *time.Timer
+	reload := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Viper rereads the config file alone, so the overlays are merged again
+		if err := readConfig(); err != nil {
+			slog.Error("Error reloading config", "error", err)
+			return
+		}
+		cfg, err := unmarshalConfig()
+		if err != nil {
+			slog.Error("Error reloading config", "error", err)
+			return
+		}
+		onChange(cfg)
+	}
+	changed := func(fsnotify.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(reloadDelay, reload)
+	}
+
+	viper.OnConfigChange(changed)
+	viper.WatchConfig()
+	watchOverlays(changed)
+}
+
+// watchOverlays calls changed when a file in config.d or profiles, next to the config file,
+// changes. Directories that don't exist when the gateway starts aren't watched.
+func watchOverlays(changed func(fsnotify.Event)) {
+	path, err := ConfigPath()
+	if err != nil {
+		return
 	}
-	return workspace
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("Error watching config overlays", "error", err)
+		return
+	}
+	watching := false
+	for _, name := range []string{"config.d", "profiles"} {
+		if err := watcher.Add(filepath.Join(filepath.Dir(path), name)); err == nil {
+			watching = true
+		}
+	}
+	if !watching {
+		watcher.Close()
+		return
+	}
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if ext := filepath.Ext(event.Name); ext == ".yaml" || ext == ".yml" {
+					changed(event)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("Error watching config overlays", "error", err)
+			}
+		}
+	}()
+}
+
+// GetWorkspacePath returns the workspace path with ~ and $VARS expanded. LoadConfig has
+// already resolved a named or relative workspace.
+func (c *Config) GetWorkspacePath() string {
+	return expandPath(c.Agents.Defaults.Workspace, "")
 }
 
 // GetAPIKey returns the API key for the given model
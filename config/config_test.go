@@ -0,0 +1,600 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestMCPServersConfig(t *testing.T) {
+	defer viper.Reset()
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+tools:
+  mcp_servers:
+    github:
+      command: npx
+      args: ["-y", "@modelcontextprotocol/server-github"]
+      env:
+        GITHUB_TOKEN: secret
+      toolTimeout: 45
+      allowed_tools: [search_repositories]
+    notion:
+      url: https://mcp.notion.com/mcp
+      oauth:
+        scopes: [read]
+    old:
+      enabled: false
+`))
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	cfg, err := unmarshalConfig()
+	if err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+	github := cfg.Tools.MCPServers["github"]
+	if github.Command != "npx" || len(github.Args) != 2 || github.ToolTimeout != 45 || github.Env["github_token"] != "secret" {
+		t.Errorf("Unexpected github server %+v", github)
+	}
+	if len(github.AllowedTools) != 1 || !github.IsEnabled() {
+		t.Errorf("Expected github to be enabled with one allowed tool, got %+v", github)
+	}
+	if notion := cfg.Tools.MCPServers["notion"]; notion.URL != "https://mcp.notion.com/mcp" || len(notion.OAuth.Scopes) != 1 {
+		t.Errorf("Unexpected notion server %+v", notion)
+	}
+	if cfg.Tools.MCPServers["old"].IsEnabled() {
+		t.Error("Expected a disabled server not to be validated or enabled")
+	}
+}
+
+func TestMCPServersConfigNamesInvalidServer(t *testing.T) {
+	defer viper.Reset()
+	viper.SetConfigType("yaml")
+	viper.ReadConfig(strings.NewReader(`
+tools:
+  mcp_servers:
+    broken:
+      url: ftp://example.com
+`))
+
+	_, err := unmarshalConfig()
+	if err == nil || !strings.Contains(err.Error(), "tools.mcp_servers.broken") {
+		t.Errorf("Expected an error naming the server, got %v", err)
+	}
+}
+
+func TestMCPServerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MCPServerConfig
+		valid  bool
+	}{
+		{"command", MCPServerConfig{Command: "npx"}, true},
+		{"url", MCPServerConfig{URL: "wss://mcp.example.com/ws"}, true},
+		{"neither", MCPServerConfig{}, false},
+		{"both", MCPServerConfig{Command: "npx", URL: "https://mcp.example.com"}, false},
+		{"no host", MCPServerConfig{URL: "https:///mcp"}, false},
+		{"negative timeout", MCPServerConfig{Command: "npx", Timeout: -1}, false},
+		{"tool patterns", MCPServerConfig{Command: "npx", AllowedTools: []string{"search_*"}, BlockedTools: []string{"*delete*"}}, true},
+		{"bad tool pattern", MCPServerConfig{Command: "npx", BlockedTools: []string{"[delete"}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestModelConfig(t *testing.T) {
+	defer viper.Reset()
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+models:
+  - match: "openai/o*"
+    temperature: 1
+    reasoning_effort: high
+  - match: "*sonnet*"
+    max_tokens: 16000
+    top_p: 0.9
+    stop: ["</answer>"]
+`))
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	cfg, err := unmarshalConfig()
+	if err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+	if len(cfg.Models) != 2 || *cfg.Models[0].Temperature != 1 || *cfg.Models[1].TopP != 0.9 || cfg.Models[1].Stop[0] != "</answer>" {
+		t.Fatalf("Unexpected models %+v", cfg.Models)
+	}
+
+	matches := map[string][2]bool{
+		"openai/o3-mini":                {true, false},
+		"OpenAI/O1":                     {true, false},
+		"openai/gpt-4o":                 {false, false},
+		"anthropic/claude-sonnet-4-5":   {false, true},
+		"openrouter/anthropic/o-sonnet": {false, true},
+	}
+	for model, want := range matches {
+		for i, m := range cfg.Models {
+			if got := m.Matches(model); got != want[i] {
+				t.Errorf("%q matching %s: expected %v, got %v", m.Match, model, want[i], got)
+			}
+		}
+	}
+
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	viper.ReadConfig(strings.NewReader("models:\n  - match: gpt-*\n  - match: o1\n    reasoning_effort: extreme\n"))
+	if _, err := unmarshalConfig(); err == nil || !strings.Contains(err.Error(), "models.1: reasoning_effort") {
+		t.Errorf("Expected an error naming the entry, got %v", err)
+	}
+}
+
+func TestLoggingConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ProfileEnv, "")
+	t.Setenv(WorkspaceEnv, "")
+	defer viper.Reset()
+	defer SetConfigFile("")
+
+	dir := filepath.Join(home, "conf")
+	os.MkdirAll(dir, 0755)
+	SetConfigFile(filepath.Join(dir, "config.yaml"))
+	load := func(logging string) (*Config, error) {
+		viper.Reset()
+		os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("logging:\n"+logging), 0644)
+		return LoadConfig()
+	}
+
+	cfg, err := load("  format: json\n  file: logs/nanotalon.log\n")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	want := LoggingConfig{Level: "info", Format: "json", File: filepath.Join(dir, "logs", "nanotalon.log"), MaxSizeMB: 10, MaxBackups: 5}
+	if cfg.Logging != want {
+		t.Errorf("Expected %+v, got %+v", want, cfg.Logging)
+	}
+
+	for _, invalid := range []string{"  level: loud\n", "  format: xml\n", "  max_backups: -1\n"} {
+		if _, err := load(invalid); err == nil || !strings.HasPrefix(err.Error(), "logging: ") {
+			t.Errorf("Expected an error for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ConfigEnv, "")
+	defer SetConfigFile("")
+
+	// Without any config, onboard creates it in ~/.nanotalon
+	current := filepath.Join(home, ".nanotalon", "config.yaml")
+	if path, _ := ConfigPath(); path != current {
+		t.Errorf("Expected %s, got %s", current, path)
+	}
+
+	// A config left in ~/.nanobot is read while there's none in ~/.nanotalon
+	legacy := filepath.Join(home, ".nanobot", "config.yaml")
+	os.MkdirAll(filepath.Dir(legacy), 0755)
+	os.WriteFile(legacy, []byte("agents: {}\n"), 0644)
+	if path, _ := ConfigPath(); path != legacy {
+		t.Errorf("Expected the legacy config %s, got %s", legacy, path)
+	}
+	os.MkdirAll(filepath.Dir(current), 0755)
+	os.WriteFile(current, []byte("agents: {}\n"), 0644)
+	if path, _ := ConfigPath(); path != current {
+		t.Errorf("Expected %s to win over the legacy config, got %s", current, path)
+	}
+
+	// $NANOTALON_CONFIG, then --config, override both
+	t.Setenv(ConfigEnv, "/etc/nanotalon.yaml")
+	if path, _ := ConfigPath(); path != "/etc/nanotalon.yaml" {
+		t.Errorf("Expected $%s, got %s", ConfigEnv, path)
+	}
+	SetConfigFile("/tmp/flag.yaml")
+	if path, _ := ConfigPath(); path != "/tmp/flag.yaml" {
+		t.Errorf("Expected the --config file, got %s", path)
+	}
+}
+
+func TestOverlaysAndProfiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ProfileEnv, "")
+	defer viper.Reset()
+	defer SetConfigFile("")
+	defer SetProfile("")
+
+	dir := filepath.Join(home, "conf")
+	files := map[string]string{
+		"config.yaml":        "agents:\n  defaults:\n    model: openai/gpt-4o\n    max_tokens: 1000\nchannels:\n  telegram:\n    enabled: true\n",
+		"config.d/20-b.yaml": "agents:\n  defaults:\n    max_tokens: 3000\n",
+		"config.d/10-a.yml":  "agents:\n  defaults:\n    max_tokens: 2000\n    temperature: 0.5\n",
+		"config.d/notes.txt": "ignored",
+		"profiles/work.yaml": "agents:\n  defaults:\n    model: anthropic/claude-sonnet-4\nchannels:\n  telegram:\n    enabled: false\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	SetConfigFile(filepath.Join(dir, "config.yaml"))
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	defaults := cfg.Agents.Defaults
+	if defaults.Model != "openai/gpt-4o" || defaults.MaxTokens != 3000 || defaults.Temperature != 0.5 {
+		t.Errorf("Expected config.d merged in name order, got %+v", defaults)
+	}
+	if !cfg.Channels.Telegram.Enabled || defaults.Workspace != filepath.Join(home, ".nanotalon", "workspace") {
+		t.Errorf("Expected the base channels and workspace, got %v and %s", cfg.Channels.Telegram.Enabled, defaults.Workspace)
+	}
+
+	SetProfile("work")
+	viper.Reset()
+	if cfg, err = LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig with a profile failed: %v", err)
+	}
+	defaults = cfg.Agents.Defaults
+	if defaults.Model != "anthropic/claude-sonnet-4" || defaults.MaxTokens != 3000 || cfg.Channels.Telegram.Enabled {
+		t.Errorf("Expected the profile merged last, got %+v, telegram %v", defaults, cfg.Channels.Telegram.Enabled)
+	}
+	if defaults.Workspace != filepath.Join(home, ".nanotalon", "workspace-work") {
+		t.Errorf("Expected the profile's own workspace, got %s", defaults.Workspace)
+	}
+
+	SetProfile("home")
+	viper.Reset()
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), `no profile "home"`) {
+		t.Errorf("Expected a missing profile to fail, got %v", err)
+	}
+	if _, err := ProfilePath("../work"); err == nil {
+		t.Error("Expected a profile name with a path to be rejected")
+	}
+}
+
+func TestWorkspaces(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PROJECTS", "/srv/projects")
+	t.Setenv(ProfileEnv, "")
+	t.Setenv(WorkspaceEnv, "")
+	defer viper.Reset()
+	defer SetConfigFile("")
+	defer SetWorkspace("")
+
+	dir := filepath.Join(home, "conf")
+	os.MkdirAll(dir, 0755)
+	SetConfigFile(filepath.Join(dir, "config.yaml"))
+	load := func(defaults string) (*Config, error) {
+		viper.Reset()
+		os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(`agents:
+  defaults:
+    workspace: "`+defaults+`"
+  workspaces:
+    Work: "$PROJECTS/work"
+    notes: notes
+`), 0644)
+		return LoadConfig()
+	}
+
+	tests := map[string]string{
+		"~/assistant":     filepath.Join(home, "assistant"),
+		"$HOME/assistant": filepath.Join(home, "assistant"),
+		"data/assistant":  filepath.Join(dir, "data", "assistant"), // Relative to the config file
+		"work":            "/srv/projects/work",
+		"notes":           filepath.Join(dir, "notes"),
+		"":                filepath.Join(home, ".nanotalon", "workspace"),
+	}
+	for defaults, want := range tests {
+		cfg, err := load(defaults)
+		if err != nil {
+			t.Fatalf("LoadConfig with workspace %q failed: %v", defaults, err)
+		}
+		if got := cfg.GetWorkspacePath(); got != want {
+			t.Errorf("Workspace %q: expected %s, got %s", defaults, want, got)
+		}
+	}
+
+	// --workspace takes a name, or a path from the current directory
+	cwd, _ := os.Getwd()
+	selected := map[string]string{
+		"work":      "/srv/projects/work",
+		"./scratch": filepath.Join(cwd, "scratch"),
+	}
+	for name, want := range selected {
+		SetWorkspace(name)
+		cfg, err := load("~/assistant")
+		if err != nil {
+			t.Fatalf("LoadConfig with --workspace %s failed: %v", name, err)
+		}
+		if got := cfg.GetWorkspacePath(); got != want {
+			t.Errorf("--workspace %s: expected %s, got %s", name, want, got)
+		}
+	}
+	SetWorkspace("wrok")
+	if _, err := load(""); err == nil || !strings.Contains(err.Error(), `no workspace named "wrok"`) {
+		t.Errorf("Expected a misspelled name to fail, got %v", err)
+	}
+}
+
+func TestSecretCommands(t *testing.T) {
+	defer viper.Reset()
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+providers:
+  anthropic:
+    api_key: stale
+    api_key_cmd: printf 'sk-from-cmd\n'
+channels:
+  telegram:
+    token_cmd: echo 123:abc
+gateway:
+  api:
+    tokens:
+      - name: dashboard
+        token_cmd: echo read-secret
+`))
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	cfg, err := unmarshalConfig()
+	if err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+	if cfg.Providers.Anthropic.APIKey != "sk-from-cmd" {
+		t.Errorf("Expected the command's key to replace the file's, got %q", cfg.Providers.Anthropic.APIKey)
+	}
+	if cfg.Channels.Telegram.Token != "123:abc" {
+		t.Errorf("Expected the telegram token from its command, got %q", cfg.Channels.Telegram.Token)
+	}
+	if tokens := cfg.Gateway.API.Tokens; len(tokens) != 1 || tokens[0].Token != "read-secret" {
+		t.Errorf("Expected the API token from its command, got %+v", tokens)
+	}
+
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	viper.ReadConfig(strings.NewReader("channels:\n  slack:\n    bot_token_cmd: exit 3\n"))
+	if _, err := unmarshalConfig(); err == nil || !strings.Contains(err.Error(), "channels.slack.bot_token_cmd") {
+		t.Errorf("Expected a failing command to be named, got %v", err)
+	}
+
+	if errs := Validate([]byte("providers:\n  openai:\n    api_key_keychain: nanotalon/openai\n    api_base_cmd: x\n")); len(errs) != 1 || errs[0].Key != "providers.openai.api_base_cmd" {
+		t.Errorf("Expected only a non-secret's _cmd key to be unknown, got %v", errs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	errs := Validate([]byte(`agents:
+  defaults:
+    model: "openai/gpt-4o"
+    max_tokens: lots
+    modle: x
+channels:
+  telegram:
+    enabled: yes
+    allow_from: "123"
+  slack: []
+tools:
+  mcp_servers:
+    github:
+      args: [a, b]
+      timeout: 30
+`))
+	want := []string{
+		`line 4: agents.defaults.max_tokens: expected a whole number, got "lots"`,
+		"line 5: agents.defaults.modle: unknown key; did you mean agents.defaults.model?",
+		`line 8: channels.telegram.enabled: expected true or false, got "yes"`,
+		"line 10: channels.slack: expected a section of keys, got a list",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d problems, got %v", len(want), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("Expected %q, got %q", want[i], err.Error())
+		}
+	}
+
+	if errs := Validate([]byte("agents:\n  defaults: [\n")); len(errs) != 1 || errs[0].Line == 0 {
+		t.Errorf("Expected a syntax error with its line, got %v", errs)
+	}
+}
+
+func TestUnknownKeySuggestions(t *testing.T) {
+	tests := map[string]string{
+		"channels.telegramm":              "channels.telegram",
+		"telegram":                        "channels.telegram",
+		"agents.model":                    "agents.defaults.model",
+		"agents.defaults.max_token":       "agents.defaults.max_tokens",
+		"tools.mcp_servers.github.comand": "tools.mcp_servers.github.command",
+		"gateway.api.tokens.0.nme":        "gateway.api.tokens.0.name",
+		"enabled":                         "", // In too many places to guess
+		"channels.irc":                    "",
+	}
+	for key, want := range tests {
+		if got := suggestKey(key); got != want {
+			t.Errorf("suggestKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+
+	unused := []string{"channels.telegramm", "tools.mcp_servers[github].comand", "gateway.api.tokens[0].nme", "$schema", "x-common"}
+	want := []string{"channels.telegramm", "gateway.api.tokens.0.nme", "tools.mcp_servers.github.comand"}
+	if got := unknownKeys(unused); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected unknown keys %v, got %v", want, got)
+	}
+	if errs := Validate([]byte("$schema: x\nx-common: &c\n  enabled: true\nchannels:\n  telegram: *c\n")); len(errs) != 0 {
+		t.Errorf("Expected $schema and x- sections to be allowed, got %v", errs)
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		key, text string
+		want      interface{}
+	}{
+		{"agents.defaults.model", "openai/gpt-4o", "openai/gpt-4o"},
+		{"agents.defaults.max_tokens", "4096", 4096},
+		{"agents.defaults.temperature", "0.5", 0.5},
+		{"gateway.heartbeat.enabled", "false", false},
+		{"tools.mcp_servers.github.enabled", "true", true},
+		{"channels.telegram.allow_from", "123, @alice", []string{"123", "@alice"}},
+		{"channels.telegram.allow_from", "[a, 'b, c']", []string{"a", "b, c"}},
+		{"providers.openai.extra_headers", "{X-Team: ops}", map[string]string{"X-Team": "ops"}},
+	}
+	for _, tc := range tests {
+		got, err := ParseValue(tc.key, tc.text)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseValue(%s, %q) = %#v (err %v), want %#v", tc.key, tc.text, got, err, tc.want)
+		}
+	}
+	for _, key := range []string{"agents.defaults.nope", "agents.defaults", "gateway.api.tokens"} {
+		if _, err := ParseValue(key, "1"); err == nil {
+			t.Errorf("Expected %s to be refused", key)
+		}
+	}
+	if _, err := ParseValue("agents.defaults.max_tokens", "lots"); err == nil {
+		t.Error("Expected a word to be refused for a number")
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`# nanotalon configuration
+agents:
+  defaults:
+    model: "openai/gpt-4o" # the main model
+channels:
+`), 0600)
+
+	for _, set := range []struct {
+		key   string
+		value interface{}
+	}{
+		{"agents.defaults.model", "anthropic/claude-opus-4-5"},
+		{"agents.defaults.max_tokens", 4096},
+		{"channels.telegram.allow_from", []string{"123"}},
+	} {
+		if err := SetValue(path, set.key, set.value); err != nil {
+			t.Fatalf("SetValue(%s) failed: %v", set.key, err)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	want := `# nanotalon configuration
+agents:
+  defaults:
+    model: anthropic/claude-opus-4-5 # the main model
+    max_tokens: 4096
+channels:
+  telegram:
+    allow_from:
+      - "123"
+`
+	if got := string(data); got != want {
+		t.Errorf("Unexpected config file:\n%s\nwant:\n%s", got, want)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the file's permissions to be kept, got %v", info.Mode().Perm())
+	}
+	if errs := Validate(data); len(errs) > 0 {
+		t.Errorf("Expected the updated file to be valid, got %v", errs)
+	}
+}
+
+func TestShowRedactsSecrets(t *testing.T) {
+	enabled := true
+	cfg := &Config{}
+	cfg.Agents.Defaults.Model = "openai/gpt-4o"
+	cfg.Agents.Defaults.MaxTokens = 4096
+	cfg.Providers.OpenAI.APIKey = "sk-secret"
+	cfg.Channels.Email.SMTPPassword = "hunter2"
+	cfg.Gateway.API.Tokens = []APIToken{{Name: "dashboard", Token: "read-secret", Scopes: []string{"read"}}}
+	cfg.Tools.MCPServers = map[string]MCPServerConfig{
+		"github": {Command: "npx", Env: map[string]string{"github_token": "ghp_secret"}, Enabled: &enabled},
+	}
+
+	data, err := Show(cfg, "")
+	if err != nil {
+		t.Fatalf("Show failed: %v", err)
+	}
+	out := string(data)
+	for _, secret := range []string{"sk-secret", "hunter2", "read-secret", "ghp_secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected %s to be redacted from:\n%s", secret, out)
+		}
+	}
+	for _, kept := range []string{"model: openai/gpt-4o", "max_tokens: 4096", "name: dashboard", "command: npx"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("Expected %q in:\n%s", kept, out)
+		}
+	}
+
+	if data, _ := Show(cfg, "providers.openai.api_key"); strings.TrimSpace(string(data)) != "'********'" {
+		t.Errorf("Expected a secret key to be redacted on its own, got %q", data)
+	}
+	if value, err := Get(cfg, "providers.openai.api_key"); err != nil || value != "sk-secret" {
+		t.Errorf("Expected get to return the secret, got %q (err %v)", value, err)
+	}
+	if value, err := Get(cfg, "tools.mcp_servers.github.enabled"); err != nil || value != "true" {
+		t.Errorf("Expected true, got %q (err %v)", value, err)
+	}
+	if _, err := Get(cfg, "tools.mcp_servers.notion.url"); err == nil {
+		t.Error("Expected a missing MCP server to fail")
+	}
+}
+
+func TestReloader(t *testing.T) {
+	old := &Config{}
+	old.Agents.Defaults.Temperature = 0.1
+	old.Channels.Telegram.AllowFrom = []string{"123"}
+	reloader := NewReloader(old)
+
+	var channelReloads, temperatureReloads int
+	reloader.Handle(func(cfg *Config) error {
+		channelReloads++
+		return nil
+	}, "channels.telegram", "channels.discord")
+	reloader.Handle(func(cfg *Config) error {
+		temperatureReloads++
+		if cfg.Agents.Defaults.Temperature != 0.7 {
+			t.Errorf("Expected the new temperature, got %v", cfg.Agents.Defaults.Temperature)
+		}
+		return nil
+	}, "agents.defaults.temperature")
+
+	changed := *old
+	changed.Agents.Defaults.Temperature = 0.7
+	changed.Channels.Telegram.AllowFrom = []string{"123", "@alice"}
+	changed.Channels.Discord.Enabled = true
+	changed.Gateway.Port = 8080
+
+	want := []string{"agents.defaults.temperature", "channels.telegram.allow_from", "channels.discord.enabled", "gateway.port"}
+	if got := Changes(old, &changed); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected changes %v, got %v", want, got)
+	}
+
+	reloader.Apply(&changed)
+	if channelReloads != 1 || temperatureReloads != 1 {
+		t.Errorf("Expected each applier to run once, got %d channel and %d temperature reloads", channelReloads, temperatureReloads)
+	}
+
+	// Saving the file again without changes applies nothing
+	same := changed
+	reloader.Apply(&same)
+	if channelReloads != 1 || temperatureReloads != 1 {
+		t.Errorf("Expected no reloads without changes, got %d and %d", channelReloads, temperatureReloads)
+	}
+}
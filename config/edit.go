@@ -0,0 +1,263 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// redacted replaces secrets in Show's output
+const redacted = "********"
+
+// Get returns the effective value of a dotted key, the config file's or the default: a
+// plain value as is, a section or list as YAML
+func Get(cfg *Config, key string) (string, error) {
+	v, err := lookup(cfg, key)
+	if err != nil {
+		return "", err
+	}
+	switch value := plain(v, false).(type) {
+	case nil:
+		return "", nil
+	case string, bool, int, int64, float64:
+		return fmt.Sprint(value), nil
+	default:
+		data, err := encodeYAML(value)
+		return strings.TrimRight(string(data), "\n"), err
+	}
+}
+
+// Show returns the effective configuration, or the section at key if it isn't empty, as
+// YAML with API keys, tokens, passwords and other secrets redacted
+func Show(cfg *Config, key string) ([]byte, error) {
+	v := reflect.ValueOf(cfg).Elem()
+	if key != "" {
+		var err error
+		if v, err = lookup(cfg, key); err != nil {
+			return nil, err
+		}
+	}
+	return encodeYAML(plain(v, isSecretKey(lastSegment(key))))
+}
+
+// encodeYAML encodes a value with the two-space indent of the config file
+func encodeYAML(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// lookup finds the value of a dotted key in the configuration
+func lookup(cfg *Config, key string) (reflect.Value, error) {
+	if _, err := keyType(key); err != nil {
+		return reflect.Value{}, err
+	}
+	v := reflect.ValueOf(cfg).Elem()
+	for _, segment := range strings.Split(key, ".") {
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := fieldByKey(v.Type(), segment)
+			if !ok {
+				// A _cmd or _keychain key, replaced by the secret it fetches
+				return reflect.Value{}, fmt.Errorf("%s is only kept in the config file", key)
+			}
+			v = v.FieldByIndex(field.Index)
+		case reflect.Map:
+			// Viper lowercases the names of map entries
+			entry := v.MapIndex(reflect.ValueOf(strings.ToLower(segment)))
+			if !entry.IsValid() {
+				return reflect.Value{}, fmt.Errorf("%s isn't set", key)
+			}
+			v = entry
+		case reflect.Slice:
+			i, _ := strconv.Atoi(segment)
+			if i < 0 || i >= v.Len() {
+				return reflect.Value{}, fmt.Errorf("%s isn't set", key)
+			}
+			v = v.Index(i)
+		default:
+			return reflect.Value{}, fmt.Errorf("%s isn't set", key)
+		}
+	}
+	return v, nil
+}
+
+// plain converts a configuration value into maps, lists and scalars keyed like the config
+// file, in field order, redacting secrets when redact is set or a key names one
+func plain(v reflect.Value, redact bool) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		var node yaml.Node
+		node.Kind = yaml.MappingNode
+		for i := 0; i < v.NumField(); i++ {
+			key := fieldKey(v.Type().Field(i))
+			var value yaml.Node
+			value.Encode(plain(v.Field(i), redact || isSecretKey(key)))
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &value)
+		}
+		return &node
+	case reflect.Map:
+		values := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			// Environment variables and headers are where MCP servers take their credentials
+			secret := redact || v.Type().Elem().Kind() == reflect.String
+			values[iter.Key().String()] = plain(iter.Value(), secret)
+		}
+		return values
+	case reflect.Slice:
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = plain(v.Index(i), redact)
+		}
+		return values
+	case reflect.String:
+		if redact && v.String() != "" {
+			return redacted
+		}
+	}
+	return v.Interface()
+}
+
+// isSecretKey reports whether a key holds a credential, such as api_key, bot_token,
+// app_secret, smtp_password or a database DSN
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, suffix := range []string{"token", "_key", "secret", "password"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return key == "dsn"
+}
+
+func lastSegment(key string) string {
+	return key[strings.LastIndex(key, ".")+1:]
+}
+
+// SetValue sets a dotted key in the config file at path to value, keeping the file's other
+// settings and comments. The file is created if it doesn't exist.
+func SetValue(path, key string, value interface{}) error {
+	if _, err := keyType(key); err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	node := doc.Content[0]
+	segments := strings.Split(key, ".")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		child, err := childNode(node, segment, strings.Join(segments[:i+1], "."), !last)
+		if err != nil {
+			return err
+		}
+		if last {
+			var replacement yaml.Node
+			if err := replacement.Encode(value); err != nil {
+				return err
+			}
+			replacement.HeadComment, replacement.LineComment, replacement.FootComment = child.HeadComment, child.LineComment, child.FootComment
+			*child = replacement
+		}
+		node = child
+	}
+
+	data, err = encodeYAML(&doc)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// childNode returns the child of a mapping or list node named segment, adding it to a
+// mapping when it's missing. Sections are created empty, leaves as null for the caller to set.
+func childNode(node *yaml.Node, segment, key string, section bool) (*yaml.Node, error) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		*node = yaml.Node{Kind: yaml.MappingNode, HeadComment: node.HeadComment, LineComment: node.LineComment}
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if strings.EqualFold(node.Content[i].Value, segment) {
+				return node.Content[i+1], nil
+			}
+		}
+		child := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+		if section {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: segment}, child)
+		return child, nil
+	case yaml.SequenceNode:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i >= len(node.Content) {
+			return nil, fmt.Errorf("%s: the list has no item %s", key, segment)
+		}
+		return node.Content[i], nil
+	}
+	return nil, fmt.Errorf("%s: the config file has a value where a section is expected", key)
+}
+
+// writeFileAtomic replaces a file through a temporary one, keeping its permissions, so a
+// gateway watching it never reads half of it
+func writeFileAtomic(path string, data []byte) error {
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// ConfigEnv names the environment variable that points at the config file
+	ConfigEnv = "NANOTALON_CONFIG"
+	// ProfileEnv names the environment variable that selects a profile
+	ProfileEnv = "NANOTALON_PROFILE"
+	// WorkspaceEnv names the environment variable that selects a workspace
+	WorkspaceEnv = "NANOTALON_WORKSPACE"
+
+	dirName       = ".nanotalon" // Under the home directory: the config, workspace and data
+	legacyDirName = ".nanobot"   // Where earlier versions looked for the config and workspace
+)
+
+var (
+	configFile   string    // Set with SetConfigFile, from --config
+	profile      string    // Set with SetProfile, from --profile
+	workspace    string    // Set with SetWorkspace, from --workspace
+	legacyNotice sync.Once // The migration notice is shown once per run
+)
+
+// SetConfigFile makes LoadConfig read path instead of looking in the default locations
+func SetConfigFile(path string) {
+	configFile = path
+}
+
+// SetProfile selects the profile merged over the config file, overriding $NANOTALON_PROFILE
+func SetProfile(name string) {
+	profile = name
+}
+
+// Profile returns the selected profile, from SetProfile or $NANOTALON_PROFILE, or "" for none
+func Profile() string {
+	if profile != "" {
+		return profile
+	}
+	return os.Getenv(ProfileEnv)
+}
+
+// SetWorkspace selects the workspace, by name from agents.workspaces or by path, overriding
+// $NANOTALON_WORKSPACE and agents.defaults.workspace
+func SetWorkspace(nameOrPath string) {
+	workspace = nameOrPath
+}
+
+// Workspace returns the workspace selected with SetWorkspace or $NANOTALON_WORKSPACE, or ""
+// for the configured one
+func Workspace() string {
+	if workspace != "" {
+		return workspace
+	}
+	return os.Getenv(WorkspaceEnv)
+}
+
+// ConfigPath returns the config file LoadConfig reads: the one set with SetConfigFile, then
+// $NANOTALON_CONFIG, then ~/.nanotalon/config.yaml. A config left in ~/.nanobot by earlier
+// versions is read, with a notice, while there's none in ~/.nanotalon. When no file exists,
+// this is where onboard creates one.
+func ConfigPath() (string, error) {
+	if configFile != "" {
+		return configFile, nil
+	}
+	if path := os.Getenv(ConfigEnv); path != "" {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return legacyFallback(homeDir, "config.yaml"), nil
+}
+
+// ProfilePath returns the file of a profile: profiles/<name>.yaml next to the config file
+func ProfilePath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid profile name %q", name)
+	}
+	path, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "profiles", name+".yaml"), nil
+}
+
+// OverlayPaths returns the files merged over the config file, in order: the .yaml and .yml
+// files in config.d next to it, by name, then the selected profile's. A selected profile
+// without a file is an error.
+func OverlayPaths() ([]string, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), "config.d", pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	if name := Profile(); name != "" {
+		profilePath, err := ProfilePath(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(profilePath); err != nil {
+			return nil, fmt.Errorf("no profile %q: create %s", name, profilePath)
+		}
+		paths = append(paths, profilePath)
+	}
+	return paths, nil
+}
+
+// DefaultWorkspace returns the workspace used while agents.defaults.workspace isn't set:
+// ~/.nanotalon/workspace, or the one in ~/.nanobot while only that exists. Each profile
+// gets its own, ~/.nanotalon/workspace-<profile>.
+func DefaultWorkspace() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if name := Profile(); name != "" {
+		return filepath.Join(homeDir, dirName, "workspace-"+name), nil
+	}
+	return legacyFallback(homeDir, "workspace"), nil
+}
+
+// legacyFallback returns name in ~/.nanotalon, unless it's missing there and present in
+// ~/.nanobot, in which case it tells the user to move the directory over
+func legacyFallback(homeDir, name string) string {
+	path := filepath.Join(homeDir, dirName, name)
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		return path
+	}
+	legacy := filepath.Join(homeDir, legacyDirName, name)
+	if _, err := os.Stat(legacy); err != nil {
+		return path
+	}
+	legacyNotice.Do(func() {
+		fmt.Fprintf(os.Stderr, "Notice: reading %s, left by an earlier version; move %s to %s\n",
+			legacy, filepath.Join(homeDir, legacyDirName), filepath.Join(homeDir, dirName))
+	})
+	return legacy
+}
+
+// resolveWorkspace returns the absolute path of the workspace cfg uses: the one selected with
+// SetWorkspace, else agents.defaults.workspace, else DefaultWorkspace. A name from
+// agents.workspaces stands for its path. ~ and $VARS are expanded, and a relative path is
+// taken from the config file's directory, or from the current one when selected.
+func resolveWorkspace(cfg *Config) (string, error) {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+	path, base := cfg.Agents.Defaults.Workspace, filepath.Dir(configPath)
+	selected := Workspace()
+	if selected != "" {
+		path, base = selected, "."
+	}
+	// Viper lowercases the names of map entries
+	if named, ok := cfg.Agents.Workspaces[strings.ToLower(path)]; ok {
+		path, base = named, filepath.Dir(configPath)
+	} else if selected != "" && !strings.ContainsAny(selected, `/\~$`) {
+		// A bare word is a name unless a directory of that name exists, so a misspelled one
+		// doesn't start an empty workspace
+		if info, err := os.Stat(selected); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("no workspace named %q in agents.workspaces", selected)
+		}
+	}
+	if path == "" {
+		return DefaultWorkspace()
+	}
+	return filepath.Abs(expandPath(path, base))
+}
+
+// expandPath expands ~ and $VARS in path and joins a relative result to base, unless base
+// is empty
+func expandPath(path, base string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(homeDir, path[1:])
+		}
+	}
+	if base != "" && path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	return path
+}
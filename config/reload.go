@@ -0,0 +1,109 @@
+package config
+
+import (
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Reloader applies changes to the configuration to the running services that can take
+// them, and logs the changes that need a restart
+type Reloader struct {
+	mu       sync.Mutex
+	current  *Config
+	appliers []applier
+}
+
+// applier applies the changes to some keys and those under them
+type applier struct {
+	keys  []string
+	apply func(*Config) error
+}
+
+// NewReloader creates a reloader for services started with cfg
+func NewReloader(cfg *Config) *Reloader {
+	return &Reloader{current: cfg}
+}
+
+// Handle makes changes to the keys, or to any key under them, such as "channels.telegram"
+// or "agents.defaults.temperature", call apply with the new configuration
+func (r *Reloader) Handle(apply func(*Config) error, keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appliers = append(r.appliers, applier{keys: keys, apply: apply})
+}
+
+// Apply applies a new configuration: each applier whose keys changed runs once, and the
+// changed keys no applier handles are logged as needing a restart. It can be passed to
+// WatchConfig.
+func (r *Reloader) Apply(cfg *Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := Changes(r.current, cfg)
+	r.current = cfg
+	if len(changed) == 0 {
+		return
+	}
+
+	var applied, restart []string
+	ran := make(map[int]bool)
+	for _, key := range changed {
+		handled := false
+		for i, a := range r.appliers {
+			if !a.handles(key) {
+				continue
+			}
+			handled = true
+			if ran[i] {
+				continue
+			}
+			ran[i] = true
+			if err := a.apply(cfg); err != nil {
+				slog.Error("Error applying config change", "key", key, "error", err)
+			}
+		}
+		if handled {
+			applied = append(applied, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+	if len(applied) > 0 {
+		slog.Info("Config reloaded", "applied", strings.Join(applied, ", "))
+	}
+	if len(restart) > 0 {
+		slog.Warn("Config changed: restart the gateway to apply it", "keys", strings.Join(restart, ", "))
+	}
+}
+
+// handles reports whether key is one of the applier's keys or under one of them
+func (a applier) handles(key string) bool {
+	for _, prefix := range a.keys {
+		if key == prefix || strings.HasPrefix(key, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Changes lists the keys whose values differ between two configurations. Lists and maps
+// are compared whole, so a change to channels.telegram.allow_from is listed once.
+func Changes(old, new *Config) []string {
+	var changed []string
+	diffValues(reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), "", &changed)
+	return changed
+}
+
+func diffValues(old, new reflect.Value, key string, changed *[]string) {
+	if old.Kind() == reflect.Struct {
+		for i := 0; i < old.NumField(); i++ {
+			diffValues(old.Field(i), new.Field(i), joinKey(key, fieldKey(old.Type().Field(i))), changed)
+		}
+		return
+	}
+	if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+		*changed = append(*changed, key)
+	}
+}
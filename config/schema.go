@@ -0,0 +1,389 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ValidationError is a problem found in the config file, at a line of it
+type ValidationError struct {
+	Line    int
+	Key     string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Key, e.Message)
+}
+
+// configType is the schema every key is checked against
+var configType = reflect.TypeOf(Config{})
+
+// keyType returns the type of the value a dotted key, such as agents.defaults.model or
+// tools.mcp_servers.github.args, holds
+func keyType(key string) (reflect.Type, error) {
+	t := configType
+	for i, segment := range strings.Split(key, ".") {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		field, ok := childType(t, segment)
+		if !ok {
+			if i == 0 {
+				return nil, fmt.Errorf("unknown key %q", key)
+			}
+			return nil, fmt.Errorf("unknown key %q: %s has no %q", key, strings.Join(strings.Split(key, ".")[:i], "."), segment)
+		}
+		t = field
+	}
+	return t, nil
+}
+
+// childType returns the type of the child named segment of a value of type t: a struct
+// field by its mapstructure tag or a secret's _cmd or _keychain key, a map entry, or a list
+// item by its index
+func childType(t reflect.Type, segment string) (reflect.Type, bool) {
+	switch t.Kind() {
+	case reflect.Struct:
+		if field, ok := fieldByKey(t, segment); ok {
+			return field.Type, true
+		}
+		if _, ok := secretSource(t, segment); ok {
+			return reflect.TypeOf(""), true
+		}
+	case reflect.Map:
+		return t.Elem(), true
+	case reflect.Slice:
+		if _, err := strconv.Atoi(segment); err == nil {
+			return t.Elem(), true
+		}
+	}
+	return nil, false
+}
+
+// fieldByKey finds the struct field a config key names
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if strings.EqualFold(fieldKey(field), key) { // Viper matches keys in any case
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// fieldKey returns the config key of a struct field
+func fieldKey(field reflect.StructField) string {
+	if tag := field.Tag.Get("mapstructure"); tag != "" {
+		return tag
+	}
+	return strings.ToLower(field.Name)
+}
+
+// ParseValue converts the command-line text of a value for key to the key's type. Lists
+// are comma-separated or written as YAML ([a, b]); maps as YAML ({name: value}).
+func ParseValue(key, text string) (interface{}, error) {
+	t, err := keyType(key)
+	if err != nil {
+		return nil, err
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return text, nil
+	case reflect.Bool:
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s takes true or false, not %q", key, text)
+		}
+		return value, nil
+	case reflect.Int, reflect.Int64:
+		value, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s takes a whole number, not %q", key, text)
+		}
+		return value, nil
+	case reflect.Float64:
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s takes a number, not %q", key, text)
+		}
+		return value, nil
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.String {
+			return nil, fmt.Errorf("%s is a list of settings; edit it in the config file", key)
+		}
+		if strings.HasPrefix(strings.TrimSpace(text), "[") {
+			var list []string
+			if err := yaml.Unmarshal([]byte(text), &list); err != nil {
+				return nil, fmt.Errorf("%s takes a list, such as [a, b]: %v", key, err)
+			}
+			return list, nil
+		}
+		list := []string{}
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	case reflect.Map:
+		if t.Elem().Kind() != reflect.String {
+			return nil, fmt.Errorf("%s holds settings per name; set %s.<name>.<key> instead", key, key)
+		}
+		var values map[string]string
+		if err := yaml.Unmarshal([]byte(text), &values); err != nil {
+			return nil, fmt.Errorf("%s takes a map, such as {name: value}: %v", key, err)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%s is a section; set one of its keys instead", key)
+}
+
+// Validate checks a config file's YAML against the schema: every key must be known and
+// every value of the right type
+func Validate(data []byte) []ValidationError {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []ValidationError{yamlError(err)}
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	var errs []ValidationError
+	validateNode(doc.Content[0], configType, "", &errs)
+	return errs
+}
+
+// yamlError turns a YAML syntax error into a ValidationError; yaml.v3 puts the line in the text
+func yamlError(err error) ValidationError {
+	message := strings.TrimPrefix(err.Error(), "yaml: ")
+	var line int
+	if rest, ok := strings.CutPrefix(message, "line "); ok {
+		if n, after, ok := strings.Cut(rest, ": "); ok {
+			if parsed, err := strconv.Atoi(n); err == nil {
+				line, message = parsed, after
+			}
+		}
+	}
+	return ValidationError{Line: line, Message: message}
+}
+
+// validateNode checks that node holds a value of type t
+func validateNode(node *yaml.Node, t reflect.Type, key string, errs *[]ValidationError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, ValidationError{Line: node.Line, Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return // An empty value leaves the default
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			fail("expected a section of keys, got %s", describeNode(node))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i], node.Content[i+1]
+			childKey := joinKey(key, name.Value)
+			if name.Value == "<<" {
+				continue // Merge keys bring in another section, checked where it's defined
+			}
+			if ignoredKey(name.Value) {
+				continue
+			}
+			child, ok := childType(t, name.Value)
+			if !ok {
+				*errs = append(*errs, ValidationError{Line: name.Line, Key: childKey, Message: unknownKeyMessage(childKey)})
+				continue
+			}
+			validateNode(value, child, childKey, errs)
+		}
+	case reflect.Slice:
+		if node.Kind == yaml.ScalarNode && t.Elem().Kind() == reflect.String {
+			return // A single value is read as a list of one
+		}
+		if node.Kind != yaml.SequenceNode {
+			fail("expected a list, got %s", describeNode(node))
+			return
+		}
+		for i, item := range node.Content {
+			validateNode(item, t.Elem(), joinKey(key, strconv.Itoa(i)), errs)
+		}
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			fail("expected a text value, got %s", describeNode(node))
+		}
+	case reflect.Bool:
+		if _, err := strconv.ParseBool(node.Value); node.Kind != yaml.ScalarNode || err != nil {
+			fail("expected true or false, got %s", describeNode(node))
+		}
+	case reflect.Int, reflect.Int64:
+		if _, err := strconv.ParseInt(node.Value, 0, 64); node.Kind != yaml.ScalarNode || err != nil {
+			fail("expected a whole number, got %s", describeNode(node))
+		}
+	case reflect.Float64:
+		if _, err := strconv.ParseFloat(node.Value, 64); node.Kind != yaml.ScalarNode || err != nil {
+			fail("expected a number, got %s", describeNode(node))
+		}
+	}
+}
+
+// describeNode names what a YAML node holds, for error messages
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a section"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	return strconv.Quote(node.Value)
+}
+
+func joinKey(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "." + child
+}
+
+// ignoredKey reports whether a key is left for other tools and never reported as unknown:
+// $schema, for editors, and x- sections, which hold YAML anchors as in Compose files
+func ignoredKey(name string) bool {
+	return name == "$schema" || strings.HasPrefix(strings.ToLower(name), "x-")
+}
+
+// unknownKeys turns the keys mapstructure left unused while decoding, such as
+// channels.telegramm or tools.mcp_servers[github].comand, into dotted config keys
+func unknownKeys(unused []string) []string {
+	replacer := strings.NewReplacer("[", ".", "]", "")
+	var keys []string
+	for _, key := range unused {
+		key = replacer.Replace(key)
+		if !ignoredKey(lastSegment(key)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// unknownKeyMessage says a key is unknown, suggesting the key that was likely meant
+func unknownKeyMessage(key string) string {
+	if suggestion := suggestKey(key); suggestion != "" {
+		return fmt.Sprintf("unknown key; did you mean %s?", suggestion)
+	}
+	return "unknown key"
+}
+
+// suggestKey returns the key an unknown one was likely meant to be: a misspelled sibling,
+// such as channels.telegram for channels.telegramm, or the one place a key of that name is,
+// such as channels.telegram for a top-level telegram, or "" if there's no likely one
+func suggestKey(key string) string {
+	parent, name := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		parent, name = key[:i], key[i+1:]
+	}
+	name = strings.ToLower(name)
+
+	t := configType
+	if parent != "" {
+		var err error
+		if t, err = keyType(parent); err != nil {
+			return ""
+		}
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		best, bestDistance := "", typoDistance(name)+1
+		for i := 0; i < t.NumField(); i++ {
+			field := fieldKey(t.Field(i))
+			if d := editDistance(name, field); d < bestDistance {
+				best, bestDistance = field, d
+			}
+		}
+		if best != "" {
+			return joinKey(parent, best)
+		}
+	}
+
+	// A key put in the wrong section: prefer the places under the section it's in
+	var matches []string
+	findKeys(configType, "", name, &matches)
+	var nearby []string
+	for _, match := range matches {
+		if parent != "" && strings.HasPrefix(match, parent+".") {
+			nearby = append(nearby, match)
+		}
+	}
+	if len(nearby) > 0 {
+		matches = nearby
+	}
+	if len(matches) == 1 {
+		return matches[0]
+	}
+	return ""
+}
+
+// findKeys adds the keys of the fields named name in sections of type t to matches.
+// Sections under maps and lists, such as an MCP server's, aren't searched.
+func findKeys(t reflect.Type, key, name string, matches *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		childKey := joinKey(key, fieldKey(field))
+		if fieldKey(field) == name {
+			*matches = append(*matches, childKey)
+		}
+		if field.Type.Kind() == reflect.Struct {
+			findKeys(field.Type, childKey, name, matches)
+		}
+	}
+}
+
+// typoDistance is how many edits a misspelling of name may be from it
+func typoDistance(name string) int {
+	if len(name) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// A secret, such as providers.anthropic.api_key or channels.telegram.token, can be kept out
+// of the config file by setting one of these in its place:
+//
+//	api_key_cmd: pass show nanotalon/anthropic   # a command that prints the secret
+//	api_key_keychain: nanotalon/anthropic        # an OS keychain item, service[/account]
+const (
+	secretCmdSuffix      = "_cmd"
+	secretKeychainSuffix = "_keychain"
+)
+
+// secretTimeout bounds a secret command, which may wait for a password manager to unlock
+const secretTimeout = 30 * time.Second
+
+// secretSource returns the secret key that a key such as api_key_cmd or token_keychain
+// fetches, and whether it is one, given the struct it's in
+func secretSource(t reflect.Type, key string) (string, bool) {
+	for _, suffix := range []string{secretCmdSuffix, secretKeychainSuffix} {
+		base, ok := strings.CutSuffix(strings.ToLower(key), suffix)
+		if !ok || !isSecretKey(base) {
+			continue
+		}
+		if field, ok := fieldByKey(t, base); ok && field.Type.Kind() == reflect.String {
+			return base, true
+		}
+	}
+	return "", false
+}
+
+// resolveSecrets replaces the _cmd and _keychain keys in settings, the config as decoded
+// from YAML, with the secrets they fetch. t is the type settings decode to and key its
+// dotted key, for errors.
+func resolveSecrets(settings interface{}, t reflect.Type, key string) error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch values := settings.(type) {
+	case map[string]interface{}:
+		if t.Kind() != reflect.Struct && t.Kind() != reflect.Map {
+			return nil
+		}
+		for name, value := range values {
+			childKey := joinKey(key, name)
+			if t.Kind() == reflect.Struct {
+				if base, ok := secretSource(t, name); ok {
+					secret, err := fetchSecret(childKey, value)
+					if err != nil {
+						return err
+					}
+					values[base] = secret
+					delete(values, name)
+					continue
+				}
+			}
+			child, ok := childType(t, name)
+			if !ok {
+				continue
+			}
+			if err := resolveSecrets(value, child, childKey); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice {
+			return nil
+		}
+		for i, value := range values {
+			if err := resolveSecrets(value, t.Elem(), joinKey(key, fmt.Sprint(i))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fetchSecret runs the command or reads the keychain item a _cmd or _keychain key names
+func fetchSecret(key string, value interface{}) (string, error) {
+	source, ok := value.(string)
+	if !ok || strings.TrimSpace(source) == "" {
+		return "", fmt.Errorf("%s: expected a text value", key)
+	}
+	var secret string
+	var err error
+	if strings.HasSuffix(strings.ToLower(key), secretKeychainSuffix) {
+		secret, err = keychainSecret(source)
+	} else {
+		secret, err = runSecretCommand("sh", "-c", source)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	if secret == "" {
+		return "", fmt.Errorf("%s: got an empty secret", key)
+	}
+	return secret, nil
+}
+
+// keychainSecret reads a password from the OS keychain: the login keychain on macOS, the
+// Secret Service (GNOME Keyring, KWallet) on Linux. item is service or service/account.
+func keychainSecret(item string) (string, error) {
+	service, account, _ := strings.Cut(item, "/")
+	switch runtime.GOOS {
+	case "darwin":
+		args := []string{"find-generic-password", "-w", "-s", service}
+		if account != "" {
+			args = append(args, "-a", account)
+		}
+		return runSecretCommand("security", args...)
+	case "linux", "freebsd", "openbsd", "netbsd":
+		args := []string{"lookup", "service", service}
+		if account != "" {
+			args = append(args, "account", account)
+		}
+		return runSecretCommand("secret-tool", args...)
+	}
+	return "", fmt.Errorf("no keychain support on %s; use a _cmd key instead", runtime.GOOS)
+}
+
+// runSecretCommand runs a command and returns what it prints, without the trailing newline
+func runSecretCommand(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s timed out after %s", name, secretTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s failed: %v: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("%s failed: %v", name, err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
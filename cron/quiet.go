@@ -0,0 +1,78 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuietHours is a daily window, such as 23:00 to 07:00, during which deliveries wait.
+// The zero value is no window.
+type QuietHours struct {
+	Start    time.Duration // Since midnight
+	End      time.Duration // Since midnight; before Start for windows that cross midnight
+	Location *time.Location
+}
+
+// ParseQuietHours parses a window given as "HH:MM" times in an IANA timezone, or the
+// local one if tz is empty. Empty start and end mean no window.
+func ParseQuietHours(start, end, tz string) (QuietHours, error) {
+	if start == "" && end == "" {
+		return QuietHours{}, nil
+	}
+
+	loc := time.Local
+	if tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return QuietHours{}, fmt.Errorf("invalid quiet hours timezone %q: %w", tz, err)
+		}
+	}
+
+	startOffset, err := parseClock(start)
+	if err != nil {
+		return QuietHours{}, fmt.Errorf("invalid quiet hours start: %w", err)
+	}
+	endOffset, err := parseClock(end)
+	if err != nil {
+		return QuietHours{}, fmt.Errorf("invalid quiet hours end: %w", err)
+	}
+	if startOffset == endOffset {
+		return QuietHours{}, fmt.Errorf("quiet hours start and end are both %s", start)
+	}
+
+	return QuietHours{Start: startOffset, End: endOffset, Location: loc}, nil
+}
+
+// parseClock parses an "HH:MM" time of day as the time since midnight
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an HH:MM time", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Remaining returns how long the window lasts after t, or 0 if t is outside it
+func (q QuietHours) Remaining(t time.Time) time.Duration {
+	if q.Location == nil {
+		return 0
+	}
+
+	t = t.In(q.Location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, q.Location)
+	sinceMidnight := t.Sub(midnight)
+
+	var end time.Time
+	switch {
+	case q.Start < q.End && sinceMidnight >= q.Start && sinceMidnight < q.End:
+		end = midnight.Add(q.End)
+	case q.Start > q.End && sinceMidnight >= q.Start:
+		// The window ends tomorrow
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, q.Location).Add(q.End)
+	case q.Start > q.End && sinceMidnight < q.End:
+		end = midnight.Add(q.End)
+	default:
+		return 0
+	}
+	return end.Sub(t)
+}
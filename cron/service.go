@@ -3,11 +3,17 @@ package cron
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"nanotalon/clock"
+
 	"github.com/robfig/cron/v3"
 )
 
@@ -17,31 +23,103 @@ type CronPayload struct {
 	Channel string `json:"channel,omitempty"`
 	To      string `json:"to,omitempty"`
 	Deliver bool   `json:"deliver"`
+	Origin  string `json:"origin,omitempty"` // "<channel>:<chat ID>" the job was first set to deliver to
+
+	// Template names a subagent template the job spawns instead of messaging the agent;
+	// Args fill in its parameters
+	Template string            `json:"template,omitempty"`
+	Args     map[string]string `json:"args,omitempty"`
 }
 
 // CronSchedule represents the schedule for a job
 type CronSchedule struct {
-	Kind    string `json:"kind"`      // "every", "cron", "at"
-	EveryMS *int64 `json:"every_ms,omitempty"`
-	Expr    string `json:"expr,omitempty"`
-	AtMS    int64  `json:"at_ms,omitempty"`
-	Tz      string `json:"tz,omitempty"`
+	Kind     string `json:"kind"` // "every", "cron", "at"
+	EveryMS  *int64 `json:"every_ms,omitempty"`
+	Expr     string `json:"expr,omitempty"`
+	AtMS     int64  `json:"at_ms,omitempty"`
+	Tz       string `json:"tz,omitempty"`
+	AnchorMS int64  `json:"anchor_ms,omitempty"` // Interval jobs run at AnchorMS plus whole intervals
+	JitterMS int64  `json:"jitter_ms,omitempty"` // Scheduled runs start up to this much later, at random
+	CatchUp  string `json:"catch_up,omitempty"`  // "skip", "run_once", "run_all"; see CatchUpPolicy
+	Overlap  string `json:"overlap,omitempty"`   // "skip", "delay", "allow"; see OverlapPolicy
+}
+
+// Overlap policies for a job triggered while its previous run is still going
+const (
+	OverlapSkip  = "skip"  // Drop the trigger
+	OverlapDelay = "delay" // Run once the previous run finishes
+	OverlapAllow = "allow" // Run alongside the previous run
+)
+
+// OverlapPolicy returns the schedule's overlap policy, skipping by default
+func (s CronSchedule) OverlapPolicy() string {
+	if s.Overlap != "" {
+		return s.Overlap
+	}
+	return OverlapSkip
+}
+
+// Catch-up policies for runs missed while the service wasn't running
+const (
+	CatchUpSkip    = "skip"     // Forget missed runs
+	CatchUpRunOnce = "run_once" // Run once on start, however many runs were missed
+	CatchUpRunAll  = "run_all"  // Run every missed run on start, up to maxCatchUpRuns
+)
+
+// maxCatchUpRuns bounds how many missed runs a job makes up on start
+const maxCatchUpRuns = 24
+
+// CatchUpPolicy returns the schedule's catch-up policy. One-shot jobs run once
+// by default so a missed reminder still arrives; recurring jobs skip.
+func (s CronSchedule) CatchUpPolicy() string {
+	if s.CatchUp != "" {
+		return s.CatchUp
+	}
+	if s.Kind == "at" {
+		return CatchUpRunOnce
+	}
+	return CatchUpSkip
 }
 
 // CronState represents the state of a job
 type CronState struct {
-	NextRunAtMS *int64 `json:"next_run_at_ms,omitempty"`
+	NextRunAtMS *int64    `json:"next_run_at_ms,omitempty"`
+	Runs        []CronRun `json:"runs,omitempty"`        // Most recent last, at most maxRunHistory
+	MissedRuns  int       `json:"missed_runs,omitempty"` // Runs owed by the catch-up policy, made up on Start
+	Held        []string  `json:"held,omitempty"`        // Responses waiting for quiet hours to end
+}
+
+// LastRun returns the job's most recent run, or nil if it hasn't run yet
+func (s CronState) LastRun() *CronRun {
+	if len(s.Runs) == 0 {
+		return nil
+	}
+	return &s.Runs[len(s.Runs)-1]
 }
 
+// CronRun records one execution of a job
+type CronRun struct {
+	StartedAtMS int64  `json:"started_at_ms"`
+	DurationMS  int64  `json:"duration_ms"`
+	Status      string `json:"status"` // "ok", "error"
+	Error       string `json:"error,omitempty"`
+	Response    string `json:"response,omitempty"` // Truncated to maxRunResponse characters
+}
+
+const (
+	maxRunHistory  = 20  // Runs kept per job
+	maxRunResponse = 500 // Characters of the agent response kept per run
+)
+
 // CronJob represents a scheduled job
 type CronJob struct {
-	ID       string        `json:"id"`
-	Name     string        `json:"name"`
-	Schedule CronSchedule  `json:"schedule"`
-	Payload  CronPayload   `json:"payload"`
-	State    CronState     `json:"state"`
-	Enabled  bool          `json:"enabled"`
-	DeleteAfterRun bool   `json:"delete_after_run,omitempty"`
+	ID             string       `json:"id"`
+	Name           string       `json:"name"`
+	Schedule       CronSchedule `json:"schedule"`
+	Payload        CronPayload  `json:"payload"`
+	State          CronState    `json:"state"`
+	Enabled        bool         `json:"enabled"`
+	DeleteAfterRun bool         `json:"delete_after_run,omitempty"`
 }
 
 // CronService manages scheduled jobs
@@ -51,10 +129,27 @@ type CronService struct {
 	cron      *cron.Cron
 	mutex     sync.RWMutex
 	onJob     func(job *CronJob) (string, error)
+	clock     clock.Clock
+
+	entries map[string]cron.EntryID // Scheduler entries of cron expression jobs, by job ID
+	timers  map[string]func()       // Stop the timers of interval and one-shot jobs, by job ID
+	running map[string]*sync.Mutex  // Held while a job runs, by job ID
+	slots   chan struct{}           // Limits concurrent runs across jobs; nil for no limit
+
+	onDeliver  func(job *CronJob, response string) error
+	quietHours QuietHours
+	flushTimer clock.Timer // Set while deliveries are held for quiet hours
+	started    bool        // Between Start and Stop
 }
 
 // NewCronService creates a new cron service
 func NewCronService(storePath string) (*CronService, error) {
+	return NewCronServiceWithClock(storePath, clock.New())
+}
+
+// NewCronServiceWithClock creates a new cron service driven by the given clock.
+// Interval and one-shot jobs follow the clock; cron expressions use the scheduler's own time source.
+func NewCronServiceWithClock(storePath string, clk clock.Clock) (*CronService, error) {
 	dir := filepath.Dir(storePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create store directory: %w", err)
@@ -64,6 +159,10 @@ func NewCronService(storePath string) (*CronService, error) {
 		storePath: storePath,
 		jobs:      make(map[string]*CronJob),
 		cron:      cron.New(),
+		clock:     clk,
+		entries:   make(map[string]cron.EntryID),
+		timers:    make(map[string]func()),
+		running:   make(map[string]*sync.Mutex),
 	}
 
 	// Load existing jobs
@@ -79,34 +178,46 @@ func (cs *CronService) loadJobs() error {
 	cs.mutex.Lock()
 	defer cs.mutex.Unlock()
 
-	data, err := os.ReadFile(cs.storePath)
-	if os.IsNotExist(err) {
-		return nil
-	}
+	jobs, err := LoadJobs(cs.storePath)
 	if err != nil {
-		return fmt.Errorf("failed to read store file: %w", err)
-	}
-
-	var jobs []*CronJob
-	if err := json.Unmarshal(data, &jobs); err != nil {
-		return fmt.Errorf("failed to unmarshal jobs: %w", err)
+		return err
 	}
 
+	now := cs.clock.Now()
 	for _, job := range jobs {
 		cs.jobs[job.ID] = job
 		if job.Enabled {
-			cs.scheduleJob(job)
+			job.State.MissedRuns = owedRuns(job, now)
+		}
+		if err := cs.scheduleJob(job); err != nil {
+			slog.Error("Failed to schedule job", "job", job.ID, "error", err)
 		}
 	}
 
 	return nil
 }
 
-// saveJobs saves jobs to the store file
-func (cs *CronService) saveJobs() error {
-	cs.mutex.RLock()
-	defer cs.mutex.RUnlock()
+// LoadJobs reads the jobs in a store file, sorted by ID, without scheduling them. A missing
+// store has no jobs.
+func LoadJobs(storePath string) ([]*CronJob, error) {
+	data, err := os.ReadFile(storePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store file: %w", err)
+	}
+
+	var jobs []*CronJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal jobs: %w", err)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs, nil
+}
 
+// saveJobs saves jobs to the store file. The caller holds the mutex.
+func (cs *CronService) saveJobs() error {
 	var jobs []*CronJob
 	for _, job := range cs.jobs {
 		jobs = append(jobs, job)
@@ -124,30 +235,168 @@ func (cs *CronService) saveJobs() error {
 	return nil
 }
 
-// AddJob adds a new scheduled job
+// AddJob adds a new scheduled job. It fails if the job's schedule is invalid.
 func (cs *CronService) AddJob(name string, schedule CronSchedule, message string, deliver bool, to string, channel string, deleteAfterRun bool) (*CronJob, error) {
-	job := &CronJob{
-		ID:               fmt.Sprintf("job_%d", time.Now().Unix()),
-		Name:             name,
-		Schedule:         schedule,
-		Payload:          CronPayload{Message: message, Deliver: deliver, To: to, Channel: channel},
-		State:            CronState{},
-		Enabled:          true,
-		DeleteAfterRun:   deleteAfterRun,
+	if err := validateSchedule(schedule); err != nil {
+		return nil, err
 	}
 
 	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	job := &CronJob{
+		ID:             cs.newJobID(),
+		Name:           name,
+		Schedule:       schedule,
+		Payload:        CronPayload{Message: message, Deliver: deliver, To: to, Channel: channel},
+		State:          CronState{},
+		Enabled:        true,
+		DeleteAfterRun: deleteAfterRun,
+	}
+
+	if channel != "" && to != "" {
+		job.Payload.Origin = channel + ":" + to
+	}
+
+	if err := cs.scheduleJob(job); err != nil {
+		return nil, err
+	}
 	cs.jobs[job.ID] = job
-	cs.scheduleJob(job)
-	cs.mutex.Unlock()
 
 	if err := cs.saveJobs(); err != nil {
+		cs.unscheduleJob(job.ID)
+		delete(cs.jobs, job.ID)
 		return nil, err
 	}
 
 	return job, nil
 }
 
+// JobUpdate holds changes to a job; nil fields are left as they are
+type JobUpdate struct {
+	Name     *string
+	Schedule *CronSchedule
+	Message  *string
+	Deliver  *bool
+	To       *string
+	Channel  *string
+	Template *string
+	Args     *map[string]string
+
+	DeleteAfterRun *bool
+}
+
+// UpdateJob applies changes to a job, rescheduling it if its schedule changed.
+// The job is left as it was if the changes are invalid.
+func (cs *CronService) UpdateJob(jobID string, update JobUpdate) (*CronJob, error) {
+	if update.Schedule != nil {
+		if err := validateSchedule(*update.Schedule); err != nil {
+			return nil, err
+		}
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	job, exists := cs.jobs[jobID]
+	if !exists {
+		return nil, fmt.Errorf("job %s not found", jobID)
+	}
+	previous := *job
+
+	if update.Name != nil {
+		job.Name = *update.Name
+	}
+	if update.Message != nil {
+		job.Payload.Message = *update.Message
+	}
+	if update.Deliver != nil {
+		job.Payload.Deliver = *update.Deliver
+	}
+	if update.To != nil {
+		job.Payload.To = *update.To
+	}
+	if update.Channel != nil {
+		job.Payload.Channel = *update.Channel
+	}
+	if update.Template != nil {
+		job.Payload.Template = *update.Template
+	}
+	if update.Args != nil {
+		job.Payload.Args = *update.Args
+	}
+	if update.DeleteAfterRun != nil {
+		job.DeleteAfterRun = *update.DeleteAfterRun
+	}
+
+	if update.Schedule != nil {
+		cs.unscheduleJob(jobID)
+		job.Schedule = *update.Schedule
+		job.State.MissedRuns = 0
+		job.State.NextRunAtMS = nil // Belongs to the old schedule, so a new interval counts from now
+		if err := cs.scheduleJob(job); err != nil {
+			*job = previous
+			if err := cs.scheduleJob(job); err != nil {
+				slog.Error("Failed to reschedule job", "job", jobID, "error", err)
+			}
+			return nil, err
+		}
+	}
+
+	if err := cs.saveJobs(); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// validateSchedule checks a schedule before it is stored, including for jobs that start disabled
+func validateSchedule(schedule CronSchedule) error {
+	switch schedule.Kind {
+	case "every":
+		if schedule.EveryMS == nil || *schedule.EveryMS <= 0 {
+			return fmt.Errorf("interval job needs a positive every_ms")
+		}
+	case "cron":
+		spec, err := cronSpec(schedule)
+		if err != nil {
+			return err
+		}
+		if _, err := cron.ParseStandard(spec); err != nil {
+			return fmt.Errorf("invalid cron expression %q: %w", schedule.Expr, err)
+		}
+	case "at":
+	default:
+		return fmt.Errorf("unsupported schedule kind %q", schedule.Kind)
+	}
+
+	if schedule.JitterMS < 0 {
+		return fmt.Errorf("jitter can't be negative")
+	}
+
+	switch schedule.CatchUp {
+	case "", CatchUpSkip, CatchUpRunOnce, CatchUpRunAll:
+	default:
+		return fmt.Errorf("unknown catch-up policy %q, expected skip, run_once or run_all", schedule.CatchUp)
+	}
+	switch schedule.Overlap {
+	case "", OverlapSkip, OverlapDelay, OverlapAllow:
+	default:
+		return fmt.Errorf("unknown overlap policy %q, expected skip, delay or allow", schedule.Overlap)
+	}
+	return nil
+}
+
+// newJobID returns an unused job ID based on the current time. The caller holds the mutex.
+func (cs *CronService) newJobID() string {
+	base := fmt.Sprintf("job_%d", cs.clock.Now().Unix())
+	id := base
+	for n := 2; cs.jobs[id] != nil; n++ {
+		id = fmt.Sprintf("%s_%d", base, n)
+	}
+	return id
+}
+
 // RemoveJob removes a job by ID
 func (cs *CronService) RemoveJob(jobID string) bool {
 	cs.mutex.Lock()
@@ -158,22 +407,17 @@ func (cs *CronService) RemoveJob(jobID string) bool {
 		return false
 	}
 
+	cs.unscheduleJob(jobID)
 	delete(cs.jobs, jobID)
-	if job.Enabled {
-		// Note: We can't easily unschedule jobs in the cron lib without storing entry IDs
-		// This is a limitation of the library; for now we'll restart the cron scheduler
-		newCron := cron.New()
-		for _, existingJob := range cs.jobs {
-			if existingJob.Enabled {
-				cs.scheduleJob(existingJob)
-			}
-		}
-		cs.cron.Stop()
-		cs.cron = newCron
-	}
+	delete(cs.running, jobID)
 
 	if err := cs.saveJobs(); err != nil {
-		return false // revert deletion?
+		slog.Error("Failed to save jobs after removing one", "job", jobID, "error", err)
+		cs.jobs[jobID] = job
+		if err := cs.scheduleJob(job); err != nil {
+			slog.Error("Failed to reschedule job", "job", jobID, "error", err)
+		}
+		return false
 	}
 
 	return true
@@ -194,6 +438,19 @@ func (cs *CronService) ListJobs(includeDisabled bool) []*CronJob {
 	return jobs
 }
 
+// GetJob returns a copy of a job by ID, or nil if there is none
+func (cs *CronService) GetJob(jobID string) *CronJob {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	job, exists := cs.jobs[jobID]
+	if !exists {
+		return nil
+	}
+	snapshot := *job
+	return &snapshot
+}
+
 // EnableJob enables or disables a job
 func (cs *CronService) EnableJob(jobID string, enabled bool) *CronJob {
 	cs.mutex.Lock()
@@ -205,18 +462,9 @@ func (cs *CronService) EnableJob(jobID string, enabled bool) *CronJob {
 	}
 
 	job.Enabled = enabled
-	if enabled {
-		cs.scheduleJob(job)
-	} else {
-		// For now, we restart the scheduler to remove the job
-		newCron := cron.New()
-		for _, existingJob := range cs.jobs {
-			if existingJob.Enabled && existingJob.ID != jobID {
-				cs.scheduleJob(existingJob)
-			}
-		}
-		cs.cron.Stop()
-		cs.cron = newCron
+	cs.unscheduleJob(jobID)
+	if err := cs.scheduleJob(job); err != nil {
+		slog.Error("Failed to schedule job", "job", jobID, "error", err)
 	}
 
 	if err := cs.saveJobs(); err != nil {
@@ -236,20 +484,7 @@ func (cs *CronService) RunJob(jobID string, force bool) bool {
 		return false
 	}
 
-	go func() {
-		if cs.onJob != nil {
-			_, err := cs.onJob(job)
-			if err != nil {
-				// Log error
-				fmt.Printf("Error running job %s: %v\n", jobID, err)
-			}
-
-			// Delete job if it's one-time and marked for deletion
-			if job.DeleteAfterRun {
-				cs.RemoveJob(jobID)
-			}
-		}
-	}()
+	go cs.runJob(job)
 
 	return true
 }
@@ -259,9 +494,54 @@ func (cs *CronService) Status() map[string]interface{} {
 	cs.mutex.RLock()
 	defer cs.mutex.RUnlock()
 
-	return map[string]interface{}{
-		"jobs": len(cs.jobs),
+	status := map[string]interface{}{
+		"jobs":    len(cs.jobs),
+		"running": cs.started,
 	}
+
+	// Earliest upcoming run across enabled jobs
+	var next *int64
+	for _, job := range cs.jobs {
+		if run := job.State.NextRunAtMS; job.Enabled && run != nil && (next == nil || *run < *next) {
+			next = run
+		}
+	}
+	if next != nil {
+		status["next_run_at_ms"] = *next
+	}
+
+	// Jobs whose last run failed
+	var failed []string
+	for id, job := range cs.jobs {
+		if run := job.State.LastRun(); run != nil && run.Status == "error" {
+			failed = append(failed, id)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		status["failed_jobs"] = failed
+	}
+
+	return status
+}
+
+// SetMaxConcurrent limits how many jobs run at once; 0 means no limit. Call it before Start.
+func (cs *CronService) SetMaxConcurrent(n int) {
+	cs.slots = nil
+	if n > 0 {
+		cs.slots = make(chan struct{}, n)
+	}
+}
+
+// SetOnDeliverCallback sets the callback that delivers the response of a job with Payload.Deliver set
+func (cs *CronService) SetOnDeliverCallback(callback func(job *CronJob, response string) error) {
+	cs.onDeliver = callback
+}
+
+// SetQuietHours sets a daily window during which deliveries are held, to be sent when it ends.
+// Call it before Start.
+func (cs *CronService) SetQuietHours(quietHours QuietHours) {
+	cs.quietHours = quietHours
 }
 
 // SetOnJobCallback sets the callback function to execute jobs
@@ -269,130 +549,442 @@ func (cs *CronService) SetOnJobCallback(callback func(job *CronJob) (string, err
 	cs.onJob = callback
 }
 
-// scheduleJob schedules a job based on its schedule type
-func (cs *CronService) scheduleJob(job *CronJob) {
-	if !job.Enabled {
+// runJob executes a job through the callback, removing it afterwards if it only runs once
+func (cs *CronService) runJob(job *CronJob) {
+	if cs.onJob == nil {
+		return
+	}
+
+	release, ok := cs.acquireRun(job)
+	if !ok {
+		slog.Warn("Skipping run of job, its previous run is still going", "job", job.ID)
+		return
+	}
+	defer release()
+
+	start := cs.clock.Now()
+	response, err := cs.onJob(job)
+	if err == nil {
+		err = cs.deliver(job, response)
+	}
+	run := CronRun{
+		StartedAtMS: start.UnixMilli(),
+		DurationMS:  cs.clock.Now().Sub(start).Milliseconds(),
+		Status:      "ok",
+		Response:    truncateResponse(response),
+	}
+	if err != nil {
+		slog.Error("Error running job", "job", job.ID, "error", err)
+		run.Status = "error"
+		run.Error = err.Error()
+	}
+	cs.recordRun(job, run)
+
+	// Delete job if it's one-time and marked for deletion
+	if job.DeleteAfterRun {
+		cs.RemoveJob(job.ID)
+	}
+}
+
+// deliver sends a job's response if the job delivers it, holding it until quiet hours end
+func (cs *CronService) deliver(job *CronJob, response string) error {
+	if !job.Payload.Deliver || response == "" || cs.onDeliver == nil {
+		return nil
+	}
+
+	if wait := cs.quietHours.Remaining(cs.clock.Now()); wait > 0 {
+		cs.mutex.Lock()
+		defer cs.mutex.Unlock()
+
+		// Held responses are stored so they survive a restart
+		job.State.Held = append(job.State.Held, response)
+		if err := cs.saveJobs(); err != nil {
+			slog.Error("Failed to save jobs after holding a result", "job", job.ID, "error", err)
+		}
+		cs.flushAfter(wait)
+		slog.Info("Holding the result of job until quiet hours end", "job", job.ID)
+		return nil
+	}
+
+	if err := cs.onDeliver(job, response); err != nil {
+		return fmt.Errorf("delivering result: %w", err)
+	}
+	return nil
+}
+
+// flushAfter sends the held deliveries once the wait is over, unless a flush is already set.
+// The caller holds the mutex.
+func (cs *CronService) flushAfter(wait time.Duration) {
+	if cs.flushTimer == nil {
+		cs.flushTimer = cs.clock.AfterFunc(wait, func() { go cs.flushHeld() })
+	}
+}
+
+// flushHeld sends the deliveries held during quiet hours, each job's in the order they were held
+func (cs *CronService) flushHeld() {
+	cs.mutex.Lock()
+	held := make(map[*CronJob][]string)
+	for _, job := range cs.jobs {
+		if len(job.State.Held) > 0 {
+			held[job] = job.State.Held
+			job.State.Held = nil
+		}
+	}
+	if len(held) > 0 {
+		if err := cs.saveJobs(); err != nil {
+			slog.Error("Failed to save jobs after sending held results", "error", err)
+		}
+	}
+	cs.flushTimer = nil
+	cs.mutex.Unlock()
+
+	for job, responses := range held {
+		for _, response := range responses {
+			if err := cs.onDeliver(job, response); err != nil {
+				slog.Error("Failed to deliver a held result", "job", job.ID, "error", err)
+			}
+		}
+	}
+}
+
+// acquireRun waits for a job's turn under its overlap policy and then for a free slot under the
+// concurrency limit. It reports false if the run should be skipped.
+func (cs *CronService) acquireRun(job *CronJob) (release func(), ok bool) {
+	var lock *sync.Mutex
+	switch job.Schedule.OverlapPolicy() {
+	case OverlapSkip, OverlapDelay:
+		cs.mutex.Lock()
+		lock = cs.running[job.ID]
+		if lock == nil {
+			lock = &sync.Mutex{}
+			cs.running[job.ID] = lock
+		}
+		cs.mutex.Unlock()
+
+		if job.Schedule.OverlapPolicy() == OverlapDelay {
+			lock.Lock()
+		} else if !lock.TryLock() {
+			return nil, false
+		}
+	}
+
+	slots := cs.slots
+	if slots != nil {
+		slots <- struct{}{}
+	}
+
+	return func() {
+		if slots != nil {
+			<-slots
+		}
+		if lock != nil {
+			lock.Unlock()
+		}
+	}, true
+}
+
+// recordRun adds a run to the job's history, dropping the oldest beyond maxRunHistory
+func (cs *CronService) recordRun(job *CronJob, run CronRun) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if cs.jobs[job.ID] != job {
 		return
 	}
+	job.State.Runs = append(job.State.Runs, run)
+	if len(job.State.Runs) > maxRunHistory {
+		job.State.Runs = append([]CronRun(nil), job.State.Runs[len(job.State.Runs)-maxRunHistory:]...)
+	}
+	if err := cs.saveJobs(); err != nil {
+		slog.Error("Failed to save jobs after running one", "job", job.ID, "error", err)
+	}
+}
+
+// truncateResponse shortens an agent response to maxRunResponse characters
+func truncateResponse(response string) string {
+	runes := []rune(response)
+	if len(runes) <= maxRunResponse {
+		return response
+	}
+	return string(runes[:maxRunResponse]) + "..."
+}
+
+// runScheduledJob runs a job the scheduler fired, first moving its next run to the following occurrence
+func (cs *CronService) runScheduledJob(job *CronJob) {
+	if job.Schedule.JitterMS > 0 {
+		cs.clock.Sleep(rand.N(time.Duration(job.Schedule.JitterMS) * time.Millisecond))
+	}
+
+	cs.mutex.Lock()
+	if cs.jobs[job.ID] == job {
+		job.State.NextRunAtMS = nextRunAt(job, cs.clock.Now())
+		if err := cs.saveJobs(); err != nil {
+			slog.Error("Failed to save jobs after scheduling one", "job", job.ID, "error", err)
+		}
+	}
+	cs.mutex.Unlock()
+
+	cs.runJob(job)
+}
+
+// scheduleJob schedules a job based on its schedule type, remembering how to unschedule it.
+// Disabled jobs aren't scheduled. The caller holds the mutex.
+func (cs *CronService) scheduleJob(job *CronJob) error {
+	if job.Schedule.Kind == "every" && job.Schedule.AnchorMS == 0 {
+		job.Schedule.AnchorMS = intervalAnchor(job, cs.clock.Now())
+	}
+	job.State.NextRunAtMS = nil
+	if !job.Enabled {
+		return nil
+	}
 
 	switch job.Schedule.Kind {
 	case "every":
-		if job.Schedule.EveryMS != nil {
-			duration := time.Duration(*job.Schedule.EveryMS) * time.Millisecond
-			go func() {
-				ticker := time.NewTicker(duration)
-				defer ticker.Stop()
-
-				for range ticker.C {
-					if !job.Enabled {
-						break
-					}
-
-					if cs.onJob != nil {
-						_, err := cs.onJob(job)
-						if err != nil {
-							fmt.Printf("Error running job %s: %v\n", job.ID, err)
-						}
-
-						// Delete job if it's one-time and marked for deletion
-						if job.DeleteAfterRun {
-							cs.RemoveJob(job.ID)
-							break
-						}
-					}
-				}
-			}()
+		if job.Schedule.EveryMS == nil || *job.Schedule.EveryMS <= 0 {
+			return fmt.Errorf("interval job needs a positive every_ms")
+		}
+		if cs.started {
+			cs.armTimer(job)
 		}
 	case "cron":
-		if job.Schedule.Expr != "" {
-			var err error
-
-			if job.Schedule.Tz != "" {
-				// Parse with timezone
-				_, locErr := time.LoadLocation(job.Schedule.Tz)
-				if locErr != nil {
-					fmt.Printf("Invalid timezone '%s' for job %s: %v\n", job.Schedule.Tz, job.ID, locErr)
-					return
-				}
-
-				// Use the standard cron parser with timezone
-				parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
-				_, err := parser.Parse(job.Schedule.Expr)
-				if err != nil {
-					fmt.Printf("Invalid cron expression '%s' for job %s: %v\n", job.Schedule.Expr, job.ID, err)
-					return
-				}
-
-				// For timezone support, we'll run the cron with UTC and handle the timezone ourselves
-				// This is a simplified implementation - in a real application you'd need proper timezone handling
-				_, err = cs.cron.AddFunc(job.Schedule.Expr, func() {
-					if cs.onJob != nil {
-						_, runErr := cs.onJob(job)
-						if runErr != nil {
-							fmt.Printf("Error running job %s: %v\n", job.ID, runErr)
-						}
-
-						// Delete job if it's one-time and marked for deletion
-						if job.DeleteAfterRun {
-							cs.RemoveJob(job.ID)
-						}
-					}
-				})
-			} else {
-				_, err = cs.cron.AddFunc(job.Schedule.Expr, func() {
-					if cs.onJob != nil {
-						_, runErr := cs.onJob(job)
-						if runErr != nil {
-							fmt.Printf("Error running job %s: %v\n", job.ID, runErr)
-						}
-
-						// Delete job if it's one-time and marked for deletion
-						if job.DeleteAfterRun {
-							cs.RemoveJob(job.ID)
-						}
-					}
-				})
+		spec, err := cronSpec(job.Schedule)
+		if err != nil {
+			return err
+		}
+		entryID, err := cs.cron.AddJob(spec, &jobFunc{job: job, service: cs})
+		if err != nil {
+			return fmt.Errorf("invalid cron expression %q: %w", job.Schedule.Expr, err)
+		}
+		cs.entries[job.ID] = entryID
+	case "at":
+		// One-time execution at specific time
+		if !time.UnixMilli(job.Schedule.AtMS).After(cs.clock.Now()) {
+			// Before Start, catchUp makes up past-due one-shots; once running, they run right away
+			if cs.started && owedRuns(job, cs.clock.Now()) > 0 {
+				go cs.runJob(job)
 			}
+			return nil
+		}
+		if cs.started {
+			cs.armTimer(job)
+		}
+	default:
+		return fmt.Errorf("unsupported schedule kind %q", job.Schedule.Kind)
+	}
 
-			if err != nil {
-				fmt.Printf("Failed to schedule job %s: %v\n", job.ID, err)
+	job.State.NextRunAtMS = nextRunAt(job, cs.clock.Now())
+	return nil
+}
+
+// armTimer sets the clock timer of an interval or upcoming one-shot job. Timers are only
+// armed between Start and Stop. The caller holds the mutex.
+func (cs *CronService) armTimer(job *CronJob) {
+	switch job.Schedule.Kind {
+	case "every":
+		cs.scheduleInterval(job)
+	case "at":
+		delay := time.UnixMilli(job.Schedule.AtMS).Sub(cs.clock.Now())
+		if delay <= 0 {
+			return
+		}
+		timer := cs.clock.AfterFunc(delay, func() { go cs.runScheduledJob(job) })
+		cs.timers[job.ID] = func() { timer.Stop() }
+	}
+}
+
+// scheduleInterval runs an interval job at its anchor plus each whole interval, so the times
+// don't shift when the service restarts. The caller holds the mutex.
+func (cs *CronService) scheduleInterval(job *CronJob) {
+	var timer clock.Timer
+	stopped := false
+
+	// arm sets the timer for the first run after the later of now and the run that just fired
+	var arm func(after time.Time)
+	arm = func(after time.Time) {
+		now := cs.clock.Now()
+		if now.After(after) {
+			after = now
+		}
+		due := nextInterval(job.Schedule, after)
+		timer = cs.clock.AfterFunc(due.Sub(now), func() {
+			cs.mutex.Lock()
+			if stopped {
+				cs.mutex.Unlock()
 				return
 			}
+			arm(due)
+			cs.mutex.Unlock()
+
+			go cs.runScheduledJob(job)
+		})
+	}
+	arm(time.Time{})
+
+	cs.timers[job.ID] = func() {
+		stopped = true
+		timer.Stop()
+	}
+}
+
+// nextInterval returns the first run of an interval schedule after the given time
+func nextInterval(schedule CronSchedule, after time.Time) time.Time {
+	anchor := time.UnixMilli(schedule.AnchorMS)
+	every := time.Duration(*schedule.EveryMS) * time.Millisecond
+	if after.Before(anchor) {
+		return anchor.Add(every)
+	}
+	return anchor.Add((after.Sub(anchor)/every + 1) * every)
+}
+
+// intervalAnchor returns the anchor of an interval job that doesn't have one yet. Jobs stored
+// before anchors keep the phase of their stored next run; new ones count from now.
+func intervalAnchor(job *CronJob, now time.Time) int64 {
+	if next := job.State.NextRunAtMS; next != nil && job.Schedule.EveryMS != nil {
+		return *next - *job.Schedule.EveryMS
+	}
+	return now.UnixMilli()
+}
+
+// nextRunAt returns when a job will next run after now, or nil if it won't run again
+func nextRunAt(job *CronJob, now time.Time) *int64 {
+	var next time.Time
+	switch job.Schedule.Kind {
+	case "every":
+		if job.Schedule.EveryMS != nil && *job.Schedule.EveryMS > 0 {
+			next = nextInterval(job.Schedule, now)
 		}
+	case "cron":
+		spec, err := cronSpec(job.Schedule)
+		if err != nil {
+			return nil
+		}
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			return nil
+		}
+		next = schedule.Next(now)
 	case "at":
-		// One-time execution at specific time
-		go func() {
-			atTime := time.UnixMilli(job.Schedule.AtMS)
-			now := time.Now()
-
-			if now.After(atTime) {
-				// Time has passed, run immediately if DeleteAfterRun is true
-				if cs.onJob != nil && job.DeleteAfterRun {
-					_, err := cs.onJob(job)
-					if err != nil {
-						fmt.Printf("Error running job %s: %v\n", job.ID, err)
-					}
-					cs.RemoveJob(job.ID)
-				}
-				return
-			}
+		if at := time.UnixMilli(job.Schedule.AtMS); at.After(now) {
+			next = at
+		}
+	}
+
+	if next.IsZero() {
+		return nil
+	}
+	ms := next.UnixMilli()
+	return &ms
+}
 
-			time.Sleep(atTime.Sub(now))
+// cronSpec returns the scheduler spec of a cron expression job, evaluated in the job's timezone
+// rather than the server's when one is set
+func cronSpec(schedule CronSchedule) (string, error) {
+	if schedule.Tz == "" {
+		return schedule.Expr, nil
+	}
+	if strings.HasPrefix(schedule.Expr, "TZ=") || strings.HasPrefix(schedule.Expr, "CRON_TZ=") {
+		return "", fmt.Errorf("cron expression %q already names a timezone, leave tz empty", schedule.Expr)
+	}
+	if _, err := time.LoadLocation(schedule.Tz); err != nil {
+		return "", fmt.Errorf("invalid timezone %q: %w", schedule.Tz, err)
+	}
+	return "CRON_TZ=" + schedule.Tz + " " + schedule.Expr, nil
+}
 
-			if cs.onJob != nil {
-				_, err := cs.onJob(job)
-				if err != nil {
-					fmt.Printf("Error running job %s: %v\n", job.ID, err)
-				}
+// owedRuns returns how many runs a job owes under its catch-up policy: those it already owed plus
+// those that fell due while the service wasn't running. The job's persisted next run marks where
+// the last service left off.
+func owedRuns(job *CronJob, now time.Time) int {
+	policy := job.Schedule.CatchUpPolicy()
+	if policy == CatchUpSkip {
+		return 0
+	}
+	limit := maxCatchUpRuns
+	if policy == CatchUpRunOnce || job.Schedule.Kind == "at" {
+		limit = 1
+	}
+	return min(job.State.MissedRuns+missedRuns(job, now), limit)
+}
 
-				if job.DeleteAfterRun {
-					cs.RemoveJob(job.ID)
-				}
+// missedRuns returns how many runs of a job fell due since its persisted next run
+func missedRuns(job *CronJob, now time.Time) int {
+	var due time.Time
+	if job.State.NextRunAtMS != nil {
+		due = time.UnixMilli(*job.State.NextRunAtMS)
+	} else if job.Schedule.Kind == "at" {
+		// One-shot jobs added after their time was already past were never given a next run
+		if last := job.State.LastRun(); last == nil || last.StartedAtMS < job.Schedule.AtMS {
+			due = time.UnixMilli(job.Schedule.AtMS)
+		}
+	}
+	if due.IsZero() || due.After(now) {
+		return 0
+	}
+
+	missed := 1
+	switch job.Schedule.Kind {
+	case "every":
+		if job.Schedule.EveryMS != nil && *job.Schedule.EveryMS > 0 {
+			missed += int(now.Sub(due) / (time.Duration(*job.Schedule.EveryMS) * time.Millisecond))
+		}
+	case "cron":
+		spec, err := cronSpec(job.Schedule)
+		if err != nil {
+			return missed
+		}
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			return missed
+		}
+		for next := schedule.Next(due); !next.After(now) && missed < maxCatchUpRuns; next = schedule.Next(next) {
+			missed++
+		}
+	}
+	return missed
+}
+
+// catchUp makes up the runs jobs missed while the service wasn't running
+func (cs *CronService) catchUp() {
+	cs.mutex.Lock()
+	owed := make(map[*CronJob]int)
+	for _, job := range cs.jobs {
+		if job.State.MissedRuns == 0 {
+			continue
+		}
+		if job.Enabled {
+			owed[job] = job.State.MissedRuns
+		}
+		job.State.MissedRuns = 0
+	}
+	if len(owed) > 0 {
+		if err := cs.saveJobs(); err != nil {
+			slog.Error("Failed to save jobs after catching up", "error", err)
+		}
+	}
+	cs.mutex.Unlock()
+
+	for job, runs := range owed {
+		slog.Info("Catching up on missed runs of job", "job", job.ID, "runs", runs)
+		go func() {
+			for i := 0; i < runs; i++ {
+				cs.runJob(job)
 			}
 		}()
 	}
 }
 
+// unscheduleJob takes a job off the scheduler or stops its timer. The caller holds the mutex.
+func (cs *CronService) unscheduleJob(jobID string) {
+	if entryID, ok := cs.entries[jobID]; ok {
+		cs.cron.Remove(entryID)
+		delete(cs.entries, jobID)
+	}
+	if stop, ok := cs.timers[jobID]; ok {
+		stop()
+		delete(cs.timers, jobID)
+	}
+}
+
 // jobFunc implements cron.Job interface
 type jobFunc struct {
 	job     *CronJob
@@ -400,25 +992,46 @@ type jobFunc struct {
 }
 
 func (jf *jobFunc) Run() {
-	if jf.service.onJob != nil {
-		_, err := jf.service.onJob(jf.job)
-		if err != nil {
-			fmt.Printf("Error running job %s: %v\n", jf.job.ID, err)
-		}
-
-		// Delete job if it's one-time and marked for deletion
-		if jf.job.DeleteAfterRun {
-			jf.service.RemoveJob(jf.job.ID)
-		}
-	}
+	jf.service.runScheduledJob(jf.job)
 }
 
 // Start starts the cron service
 func (cs *CronService) Start() {
 	cs.cron.Start()
+	cs.catchUp()
+
+	cs.mutex.Lock()
+	cs.started = true
+	for _, job := range cs.jobs {
+		if _, armed := cs.timers[job.ID]; job.Enabled && !armed {
+			cs.armTimer(job)
+		}
+	}
+
+	// Send results held before a restart once quiet hours are over
+	for _, job := range cs.jobs {
+		if len(job.State.Held) > 0 && cs.onDeliver != nil {
+			cs.flushAfter(cs.quietHours.Remaining(cs.clock.Now()))
+			break
+		}
+	}
+	cs.mutex.Unlock()
 }
 
-// Stop stops the cron service
+// Stop stops the cron service and the timers of its jobs. Deliveries held for quiet hours
+// stay stored for the next start.
 func (cs *CronService) Stop() {
 	cs.cron.Stop()
-}
\ No newline at end of file
+
+	cs.mutex.Lock()
+	cs.started = false
+	for jobID, stop := range cs.timers {
+		stop()
+		delete(cs.timers, jobID)
+	}
+	if cs.flushTimer != nil {
+		cs.flushTimer.Stop()
+		cs.flushTimer = nil
+	}
+	cs.mutex.Unlock()
+}
@@ -3,29 +3,34 @@ package heartbeat
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
+	"nanotalon/clock"
 	"nanotalon/providers"
 )
 
 // Service represents the heartbeat service
 type Service struct {
-	intervalS int
-	enabled   bool
-	workspace string
-	provider  providers.LLMProvider
-	model     string
-	onExecute func(tasks string) (string, error)
-	onNotify  func(response string) error
-	ctx       context.Context
-	cancel    context.CancelFunc
-	wg        sync.WaitGroup
-	mu        sync.Mutex
-	running   bool
+	intervalS  int
+	enabled    bool
+	scheduleMu sync.Mutex    // Guards intervalS and enabled, which a config reload may change
+	reschedule chan struct{} // Wakes the loop to pick up a new interval
+	workspace  string
+	provider   providers.LLMProvider
+	model      string
+	onExecute  func(tasks string) (string, error)
+	onNotify   func(response string) error
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	running    bool
+	clock      clock.Clock
 }
 
 // NewService creates a new heartbeat service
@@ -41,19 +46,52 @@ func NewService(
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Service{
-		workspace: workspace,
-		provider:  provider,
-		model:     model,
-		onExecute: onExecute,
-		onNotify:  onNotify,
-		intervalS: intervalS,
-		enabled:   enabled,
-		ctx:       ctx,
-		cancel:    cancel,
+		workspace:  workspace,
+		provider:   provider,
+		model:      model,
+		onExecute:  onExecute,
+		onNotify:   onNotify,
+		intervalS:  intervalS,
+		enabled:    enabled,
+		reschedule: make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+		clock:      clock.New(),
 	}
 }
 
-// Start starts the heartbeat service
+// SetClock replaces the clock driving the heartbeat interval; call before Start
+func (s *Service) SetClock(clk clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clk
+}
+
+// SetSchedule changes the interval and whether heartbeats run, taking effect right away
+// on a started service
+func (s *Service) SetSchedule(intervalS int, enabled bool) error {
+	if intervalS <= 0 {
+		return fmt.Errorf("the heartbeat interval must be positive, got %ds", intervalS)
+	}
+	s.scheduleMu.Lock()
+	s.intervalS, s.enabled = intervalS, enabled
+	s.scheduleMu.Unlock()
+
+	select {
+	case s.reschedule <- struct{}{}:
+	default: // The loop hasn't picked up the last change yet; it will read this one too
+	}
+	return nil
+}
+
+// schedule returns the interval and whether heartbeats run
+func (s *Service) schedule() (time.Duration, bool) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+	return time.Duration(s.intervalS) * time.Second, s.enabled
+}
+
+// Start starts the heartbeat service. A disabled service idles until SetSchedule enables it.
 func (s *Service) Start() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -62,26 +100,27 @@ func (s *Service) Start() error {
 		return fmt.Errorf("heartbeat service is already running")
 	}
 
-	if !s.enabled {
-		return fmt.Errorf("heartbeat service is disabled")
-	}
-
 	s.running = true
 
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
 
-		ticker := time.NewTicker(time.Duration(s.intervalS) * time.Second)
-		defer ticker.Stop()
+		interval, _ := s.schedule()
+		ticker := s.clock.NewTicker(interval)
+		defer func() { ticker.Stop() }()
 
 		// Execute immediately on startup
 		s.executeHeartbeat()
 
 		for {
 			select {
-			case <-ticker.C:
+			case <-ticker.C():
 				s.executeHeartbeat()
+			case <-s.reschedule:
+				ticker.Stop()
+				interval, _ := s.schedule()
+				ticker = s.clock.NewTicker(interval)
 			case <-s.ctx.Done():
 				return
 			}
@@ -107,13 +146,13 @@ func (s *Service) Stop() {
 
 // executeHeartbeat performs the heartbeat logic
 func (s *Service) executeHeartbeat() {
-	if !s.enabled {
+	if _, enabled := s.schedule(); !enabled {
 		return
 	}
 
 	tasks, err := s.getHeartbeatTasks()
 	if err != nil {
-		fmt.Printf("Error getting heartbeat tasks: %v\n", err)
+		slog.Error("Error getting heartbeat tasks", "error", err)
 		return
 	}
 
@@ -125,13 +164,13 @@ func (s *Service) executeHeartbeat() {
 	if s.onExecute != nil {
 		response, err := s.onExecute(tasks)
 		if err != nil {
-			fmt.Printf("Error executing heartbeat tasks: %v\n", err)
+			slog.Error("Error executing heartbeat tasks", "error", err)
 			return
 		}
 
 		if response != "" && s.onNotify != nil {
 			if notifyErr := s.onNotify(response); notifyErr != nil {
-				fmt.Printf("Error notifying heartbeat response: %v\n", notifyErr)
+				slog.Error("Error notifying heartbeat response", "error", notifyErr)
 			}
 		}
 	}
@@ -0,0 +1,146 @@
+// Package logging sets up the structured logger, log/slog, that the rest of nanotalon logs
+// through, and tags entries with the session, channel and request they belong to.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"nanotalon/config"
+)
+
+// Keys of the attributes that tie entries to what they're about, so the logs can be
+// searched for one session, channel or API request
+const (
+	SessionKey = "session"
+	ChannelKey = "channel"
+	RequestKey = "request_id"
+)
+
+var (
+	level  slog.LevelVar // Shared by every logger Setup makes, so SetLevel takes effect at once
+	mu     sync.Mutex
+	output io.Closer // The log file Setup opened, closed when it's replaced
+)
+
+// Setup makes slog's default logger, which the log package also writes through, log at
+// cfg's level and in its format, to its file or else to stderr
+func Setup(cfg config.LoggingConfig) error {
+	if err := SetLevel(cfg.Level); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stderr
+	var file io.Closer
+	if cfg.File != "" {
+		rf, err := openRotatingFile(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		w, file = rf, rf
+	}
+
+	options := &slog.HandlerOptions{Level: &level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		if file != nil {
+			file.Close()
+		}
+		return fmt.Errorf("unknown log format %q: use text or json", cfg.Format)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if output != nil {
+		output.Close()
+	}
+	output = file
+	return nil
+}
+
+// SetLevel changes the level of the loggers Setup made: debug, info, warn or error, info
+// if empty
+func SetLevel(name string) error {
+	if name == "" {
+		name = "info"
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("unknown log level %q: use debug, info, warn or error", name)
+	}
+	level.Set(l)
+	return nil
+}
+
+// Close closes the log file, if Setup opened one
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if output == nil {
+		return nil
+	}
+	err := output.Close()
+	output = nil
+	return err
+}
+
+type contextKey struct{}
+
+// With returns a context whose entries, logged with slog's Context functions, carry the
+// attributes args gives as key-value pairs or slog.Attrs, such as the session
+func With(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	attrs = append(attrs[:len(attrs):len(attrs)], argsToAttrs(args)...)
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// argsToAttrs converts key-value pairs, as slog's functions take them, to attributes
+func argsToAttrs(args []any) []slog.Attr {
+	var attrs []slog.Attr
+	for len(args) > 0 {
+		switch key := args[0].(type) {
+		case slog.Attr:
+			attrs, args = append(attrs, key), args[1:]
+		case string:
+			if len(args) == 1 {
+				attrs, args = append(attrs, slog.String("!BADKEY", key)), nil
+				continue
+			}
+			attrs, args = append(attrs, slog.Any(key, args[1])), args[2:]
+		default:
+			attrs, args = append(attrs, slog.Any("!BADKEY", key)), args[1:]
+		}
+	}
+	return attrs
+}
+
+// contextHandler adds the attributes With put in a context to the entries logged with it
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,176 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits for text pulled out of attachments into the prompt
+const (
+	maxTextChars   = 2000
+	extractTimeout = 60 * time.Second
+)
+
+// Attachment is a saved attachment as described to the model
+type Attachment struct {
+	Path     string // Relative to the workspace when the file is inside it
+	Name     string
+	MimeType string
+	Size     int64
+	Text     string // Extracted text, if any
+	TextKind string // What Text is: "contents", "OCR text" or "transcript"
+}
+
+// Describer extracts what it can from saved attachments: the contents of text files, OCR
+// text of images and transcripts of audio, when commands for those are available.
+// Commands run with sh -c and get the file path in place of {file}.
+type Describer struct {
+	workspace         string
+	ocrCommand        string
+	transcribeCommand string
+}
+
+// NewDescriber creates a describer. Without an OCR command, tesseract is used if installed;
+// audio is only transcribed when a transcribe command is configured.
+func NewDescriber(workspace, ocrCommand, transcribeCommand string) *Describer {
+	if ocrCommand == "" {
+		if _, err := exec.LookPath("tesseract"); err == nil {
+			ocrCommand = "tesseract {file} stdout 2>/dev/null"
+		}
+	}
+	return &Describer{
+		workspace:         workspace,
+		ocrCommand:        ocrCommand,
+		transcribeCommand: transcribeCommand,
+	}
+}
+
+// Describe inspects a saved attachment
+func (d *Describer) Describe(path string) Attachment {
+	attachment := Attachment{Path: path, Name: filepath.Base(path), MimeType: DetectType(path)}
+	if rel, err := filepath.Rel(d.workspace, path); err == nil && !strings.HasPrefix(rel, "..") {
+		attachment.Path = rel
+	}
+	if info, err := os.Stat(path); err == nil {
+		attachment.Size = info.Size()
+	}
+
+	switch {
+	case isText(attachment.MimeType):
+		if data, err := os.ReadFile(path); err == nil && utf8.Valid(data) {
+			attachment.Text, attachment.TextKind = string(data), "contents"
+		}
+	case strings.HasPrefix(attachment.MimeType, "image/") && d.ocrCommand != "":
+		attachment.Text, attachment.TextKind = d.extract(d.ocrCommand, path), "OCR text"
+	case strings.HasPrefix(attachment.MimeType, "audio/") && d.transcribeCommand != "":
+		attachment.Text, attachment.TextKind = d.extract(d.transcribeCommand, path), "transcript"
+	}
+	attachment.Text = strings.TrimSpace(attachment.Text)
+	return attachment
+}
+
+// Prompt describes attachments for the model, noting where the file tools can find them
+func (d *Describer) Prompt(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[Attachments, saved in the workspace where the file tools can read them]")
+	for _, path := range paths {
+		attachment := d.Describe(path)
+		fmt.Fprintf(&sb, "\n- %s (%s, %s)", attachment.Path, attachment.MimeType, formatSize(attachment.Size))
+		if attachment.Text == "" {
+			continue
+		}
+		text := attachment.Text
+		if runes := []rune(text); len(runes) > maxTextChars {
+			text = string(runes[:maxTextChars]) + "…"
+		}
+		fmt.Fprintf(&sb, "\n  %s:\n  %s", attachment.TextKind, strings.ReplaceAll(text, "\n", "\n  "))
+	}
+	return sb.String()
+}
+
+// extract runs an OCR or transcription command and returns its output; failures are logged
+func (d *Describer) extract(command, path string) string {
+	text, err := ExtractText(command, path)
+	if err != nil {
+		slog.Warn("Could not extract text", "path", path, "error", err)
+		return ""
+	}
+	return text
+}
+
+// ExtractText runs a text extraction command with sh -c, with the quoted path in place
+// of {file}, and returns what it prints
+func ExtractText(command, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), extractTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", strings.ReplaceAll(command, "{file}", shellQuote(path)))
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// DetectType guesses a file's MIME type from its extension, then its contents
+func DetectType(path string) string {
+	if mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path))); mimeType != "" {
+		mediaType, _, _ := mime.ParseMediaType(mimeType)
+		return mediaType
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := file.Read(head)
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	return mediaType
+}
+
+// isText reports whether a MIME type holds readable text
+func isText(mimeType string) bool {
+	if strings.HasPrefix(mimeType, "text/") {
+		return true
+	}
+	switch mimeType {
+	case "application/json", "application/xml", "application/yaml", "application/x-yaml", "application/toml":
+		return true
+	}
+	return false
+}
+
+// formatSize renders a byte count for people
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%d KB", size>>10)
+	default:
+		return fmt.Sprintf("%d bytes", size)
+	}
+}
+
+// shellQuote quotes a path for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,162 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultMaxBytes caps a single attachment when no limit is configured
+const defaultMaxBytes = 20 << 20
+
+// Dir returns the directory inside a workspace where attachments are saved
+func Dir(workspace string) string {
+	return filepath.Join(workspace, "media")
+}
+
+// Store saves attachments received by channels under <workspace>/media/<channel>/,
+// where the file tools can read them
+type Store struct {
+	workspace string
+	maxBytes  int64
+	client    *http.Client
+}
+
+// NewStore creates a store for a workspace; maxBytes of zero or less uses the default limit
+func NewStore(workspace string, maxBytes int64) *Store {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+	return &Store{
+		workspace: workspace,
+		maxBytes:  maxBytes,
+		client:    &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// Workspace returns the workspace the store saves into
+func (s *Store) Workspace() string {
+	return s.workspace
+}
+
+// Download describes an attachment to fetch
+type Download struct {
+	Channel  string      // Channel the attachment arrived on; files are grouped by it
+	URL      string      // Where to fetch it from
+	Filename string      // Original file name, if the platform provides one
+	MimeType string      // Declared content type, if any
+	Header   http.Header // Extra request headers, e.g. authorization for private files
+}
+
+// Download fetches an attachment and saves it, returning its path. Files larger than the
+// store's limit are rejected rather than truncated.
+func (s *Store) Download(ctx context.Context, d Download) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid attachment URL: %w", err)
+	}
+	for key, values := range d.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download attachment: status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > s.maxBytes {
+		return "", fmt.Errorf("attachment is %d bytes, over the %d byte limit", resp.ContentLength, s.maxBytes)
+	}
+
+	mimeType := d.MimeType
+	if mimeType == "" {
+		mimeType = resp.Header.Get("Content-Type")
+	}
+	return s.Save(d.Channel, d.Filename, mimeType, resp.Body)
+}
+
+// Save writes an attachment read from r and returns its path
+func (s *Store) Save(channel, filename, mimeType string, r io.Reader) (string, error) {
+	dir := filepath.Join(Dir(s.workspace), safeName(channel, "unknown"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create media directory: %w", err)
+	}
+
+	name := safeName(filename, "attachment")
+	if filepath.Ext(name) == "" {
+		name += extensionFor(mimeType)
+	}
+	path := filepath.Join(dir, time.Now().Format("20060102-150405")+"-"+name)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create attachment file: %w", err)
+	}
+
+	// Read one byte past the limit to tell a file at the limit from one over it
+	written, err := io.Copy(file, io.LimitReader(r, s.maxBytes+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > s.maxBytes {
+		err = fmt.Errorf("attachment is over the %d byte limit", s.maxBytes)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// commonExtensions are preferred over the alphabetically first extension mime knows
+var commonExtensions = map[string]string{
+	"text/plain": ".txt",
+	"image/jpeg": ".jpg",
+	"audio/mpeg": ".mp3",
+	"audio/ogg":  ".ogg",
+	"video/mp4":  ".mp4",
+}
+
+// extensionFor returns a file extension for a MIME type, or "" if none is known
+func extensionFor(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+	if ext, ok := commonExtensions[mediaType]; ok {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// unsafeChars matches characters replaced in saved file names
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// safeName reduces a name to a single safe path component
+func safeName(name, fallback string) string {
+	name = unsafeChars.ReplaceAllString(filepath.Base(strings.TrimSpace(name)), "_")
+	name = strings.Trim(name, "._")
+	if name == "" {
+		return fallback
+	}
+	if len(name) > 100 {
+		name = name[len(name)-100:]
+	}
+	return name
+}
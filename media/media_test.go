@@ -0,0 +1,80 @@
+package media_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nanotalon/media"
+)
+
+func TestStoreDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("x", 64)))
+	}))
+	defer server.Close()
+
+	workspace := t.TempDir()
+	store := media.NewStore(workspace, 100)
+	header := http.Header{"Authorization": {"Bearer secret"}}
+
+	path, err := store.Download(context.Background(), media.Download{Channel: "slack", URL: server.URL, Filename: "../notes", Header: header})
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if filepath.Dir(path) != filepath.Join(media.Dir(workspace), "slack") || !strings.HasSuffix(path, "-notes.txt") {
+		t.Errorf("Unexpected attachment path %s", path)
+	}
+
+	if _, err := store.Download(context.Background(), media.Download{Channel: "slack", URL: server.URL}); err == nil {
+		t.Error("Expected a download without authorization to fail")
+	}
+
+	small := media.NewStore(workspace, 10)
+	if _, err := small.Download(context.Background(), media.Download{Channel: "slack", URL: server.URL, Header: header}); err == nil {
+		t.Error("Expected an attachment over the size limit to be rejected")
+	}
+	entries, _ := os.ReadDir(filepath.Join(media.Dir(workspace), "slack"))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the first download to be kept, found %d files", len(entries))
+	}
+}
+
+func TestDescriberPrompt(t *testing.T) {
+	workspace := t.TempDir()
+	store := media.NewStore(workspace, 0)
+	notes, err := store.Save("telegram", "notes.md", "", strings.NewReader("# Groceries\nmilk"))
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	photo, err := store.Save("telegram", "photo.png", "", strings.NewReader("\x89PNG\r\n\x1a\n"))
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	describer := media.NewDescriber(workspace, "", "")
+	prompt := describer.Prompt([]string{notes, photo})
+
+	rel, _ := filepath.Rel(workspace, notes)
+	if !strings.Contains(prompt, "- "+rel+" (text/markdown, 16 bytes)") || !strings.Contains(prompt, "contents:\n  # Groceries\n  milk") {
+		t.Errorf("Expected the text file's path and contents, got:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "photo.png (image/png, 8 bytes)") {
+		t.Errorf("Expected the image to be listed, got:\n%s", prompt)
+	}
+
+	transcribing := media.NewDescriber(workspace, "", "echo transcript of {file}")
+	voice, _ := store.Save("telegram", "voice.ogg", "audio/ogg", strings.NewReader("OggS"))
+	if attachment := transcribing.Describe(voice); attachment.TextKind != "transcript" || !strings.Contains(attachment.Text, "voice.ogg") {
+		t.Errorf("Expected a transcript from the configured command, got %+v", attachment)
+	}
+}
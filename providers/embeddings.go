@@ -0,0 +1,139 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"nanotalon/config"
+)
+
+// EmbeddingsProvider turns text into vectors for semantic search
+type EmbeddingsProvider interface {
+	// Embed returns one vector per input text, in the same order
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+	GetModel() string
+}
+
+// OpenAIEmbeddings implements EmbeddingsProvider for OpenAI-compatible /embeddings APIs
+type OpenAIEmbeddings struct {
+	apiKey  string
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+// NewOpenAIEmbeddings creates a new OpenAI-compatible embeddings provider
+func NewOpenAIEmbeddings(apiKey, baseURL, model string) *OpenAIEmbeddings {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1" // Default OpenAI endpoint
+	}
+
+	return &OpenAIEmbeddings{
+		apiKey:  apiKey,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		client:  &http.Client{},
+	}
+}
+
+// EmbeddingsFactory creates the embeddings provider for memory.embeddings.model
+func EmbeddingsFactory(cfg *config.Config) (EmbeddingsProvider, error) {
+	model := cfg.Memory.Embeddings.Model
+	if model == "" {
+		return nil, fmt.Errorf("no embedding model configured (memory.embeddings.model)")
+	}
+
+	apiKey := cfg.Providers.GetAPIKey(model)
+	if apiKey == "" {
+		return nil, fmt.Errorf("no API key configured for embedding model: %s", model)
+	}
+	baseURL := cfg.Providers.GetAPIBase(model)
+
+	// OpenAI and custom endpoints expect the bare model name; gateways such as
+	// OpenRouter route on the full "provider/model" name
+	apiModel := model
+	if provider, name, ok := strings.Cut(model, "/"); ok {
+		switch strings.ToLower(provider) {
+		case "openai", "custom":
+			apiModel = name
+		}
+	}
+
+	return NewOpenAIEmbeddings(apiKey, baseURL, apiModel), nil
+}
+
+// Embed implements the EmbeddingsProvider interface
+func (p *OpenAIEmbeddings) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	url := fmt.Sprintf("%s/embeddings", p.baseURL)
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"model": p.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.apiKey))
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var apiResp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(apiResp.Data) != len(texts) {
+		return nil, fmt.Errorf("API returned %d embeddings for %d inputs", len(apiResp.Data), len(texts))
+	}
+
+	// The API may return items out of order; place each by its index
+	vectors := make([][]float64, len(texts))
+	for _, item := range apiResp.Data {
+		if item.Index < 0 || item.Index >= len(texts) || vectors[item.Index] != nil {
+			return nil, fmt.Errorf("API returned an embedding with invalid index %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+
+	return vectors, nil
+}
+
+// GetModel returns the embedding model this provider requests
+func (p *OpenAIEmbeddings) GetModel() string {
+	return p.model
+}
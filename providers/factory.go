@@ -7,8 +7,18 @@ import (
 	"nanotalon/config"
 )
 
-// ProviderFactory creates the appropriate LLM provider based on the config
+// ProviderFactory creates the appropriate LLM provider based on the config, applying the
+// models section's parameter overrides to its requests
 func ProviderFactory(cfg *config.Config) (LLMProvider, error) {
+	provider, err := newProvider(cfg)
+	if err != nil || len(cfg.Models) == 0 {
+		return provider, err
+	}
+	return NewModelParamsProvider(provider, cfg.Models), nil
+}
+
+// newProvider creates the provider for the configured model
+func newProvider(cfg *config.Config) (LLMProvider, error) {
 	model := cfg.Agents.Defaults.Model
 
 	// Determine the provider based on model prefix
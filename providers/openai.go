@@ -40,13 +40,7 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (*ChatRespon
 
 	url := fmt.Sprintf("%s/chat/completions", p.baseURL)
 
-	payload, err := json.Marshal(map[string]interface{}{
-		"model":       req.Model,
-		"messages":    req.Messages,
-		"temperature": req.Temperature,
-		"max_tokens":  req.MaxTokens,
-		"tools":       req.Tools,
-	})
+	payload, err := json.Marshal(requestBody(req))
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
@@ -88,6 +82,7 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (*ChatRespon
 				} `json:"tool_calls"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage Usage `json:"usage"`
 	}
 
 	if err := json.Unmarshal(body, &apiResp); err != nil {
@@ -102,24 +97,28 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (*ChatRespon
 
 	response := &ChatResponse{
 		Content: choice.Content,
+		Usage:   apiResp.Usage,
 	}
 
 	if len(choice.ToolCalls) > 0 {
 		response.HasToolCalls = true
 		for _, tc := range choice.ToolCalls {
-			args := make(map[string]interface{})
+			call := ToolCall{
+				ID:   tc.ID,
+				Name: tc.Function.Name,
+				Args: make(map[string]interface{}),
+				Type: tc.Type,
+			}
+			// Malformed arguments are reported back to the model rather than failing the request
 			if tc.Function.Arguments != "" {
-				if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
-					return nil, fmt.Errorf("failed to unmarshal tool arguments: %w", err)
+				if err := json.Unmarshal([]byte(tc.Function.Arguments), &call.Args); err != nil {
+					call.Args = make(map[string]interface{})
+					call.ArgsError = err.Error()
+					call.RawArgs = tc.Function.Arguments
 				}
 			}
 
-			response.ToolCalls = append(response.ToolCalls, ToolCall{
-				ID:   tc.ID,
-				Name: tc.Function.Name,
-				Args: args,
-				Type: tc.Type,
-			})
+			response.ToolCalls = append(response.ToolCalls, call)
 		}
 	}
 
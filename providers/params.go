@@ -0,0 +1,90 @@
+package providers
+
+import (
+	"context"
+
+	"nanotalon/config"
+)
+
+// requestBody builds the body of an OpenAI-compatible chat completions request, with the
+// optional parameters only when they're set
+func requestBody(req ChatRequest) map[string]interface{} {
+	body := map[string]interface{}{
+		"model":       req.Model,
+		"messages":    req.Messages,
+		"temperature": req.Temperature,
+		"max_tokens":  req.MaxTokens,
+		"tools":       req.Tools,
+	}
+	if req.TopP > 0 {
+		body["top_p"] = req.TopP
+	}
+	if len(req.Stop) > 0 {
+		body["stop"] = req.Stop
+	}
+	if req.ReasoningEffort != "" {
+		body["reasoning_effort"] = req.ReasoningEffort
+	}
+	return body
+}
+
+// ModelParamsProvider applies the generation parameters configured in the models section
+// to each request, by the model it's for
+type ModelParamsProvider struct {
+	provider LLMProvider
+	models   []config.ModelConfig
+}
+
+// NewModelParamsProvider wraps provider to apply the models' parameter overrides
+func NewModelParamsProvider(provider LLMProvider, models []config.ModelConfig) *ModelParamsProvider {
+	return &ModelParamsProvider{provider: provider, models: models}
+}
+
+// Chat implements the LLMProvider interface
+func (p *ModelParamsProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = p.provider.GetDefaultModel()
+	}
+	return p.provider.Chat(ctx, ApplyModelParams(req, model, p.models))
+}
+
+// GetDefaultModel implements the LLMProvider interface
+func (p *ModelParamsProvider) GetDefaultModel() string {
+	return p.provider.GetDefaultModel()
+}
+
+// Ping implements the Pinger interface when the wrapped provider does
+func (p *ModelParamsProvider) Ping(ctx context.Context) error {
+	if pinger, ok := p.provider.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// ApplyModelParams returns req with the parameters of every entry matching model applied in
+// order. They override what the agent asked for, since a model may accept only some values,
+// such as a temperature of 1 for reasoning models.
+func ApplyModelParams(req ChatRequest, model string, models []config.ModelConfig) ChatRequest {
+	for _, m := range models {
+		if !m.Matches(model) {
+			continue
+		}
+		if m.Temperature != nil {
+			req.Temperature = *m.Temperature
+		}
+		if m.MaxTokens > 0 {
+			req.MaxTokens = m.MaxTokens
+		}
+		if m.TopP != nil {
+			req.TopP = *m.TopP
+		}
+		if len(m.Stop) > 0 {
+			req.Stop = m.Stop
+		}
+		if m.ReasoningEffort != "" {
+			req.ReasoningEffort = m.ReasoningEffort
+		}
+	}
+	return req
+}
@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// pingEndpoint checks an OpenAI-compatible API answers at baseURL by listing its models,
+// which costs no tokens. Any answer short of a server error or a rejected key will do,
+// since not every compatible API serves /models.
+func pingEndpoint(ctx context.Context, client *http.Client, baseURL, apiKey string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%s rejected the API key (status %d)", baseURL, resp.StatusCode)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%s failed with status %d", baseURL, resp.StatusCode)
+	}
+	return nil
+}
+
+// Ping implements the Pinger interface
+func (p *OpenAIProvider) Ping(ctx context.Context) error {
+	return pingEndpoint(ctx, p.client, p.baseURL, p.apiKey)
+}
+
+// Ping implements the Pinger interface
+func (p *CustomProvider) Ping(ctx context.Context) error {
+	return pingEndpoint(ctx, p.client, p.baseURL, p.apiKey)
+}
+
+// Ping implements the Pinger interface
+func (p *LiteLLMProvider) Ping(ctx context.Context) error {
+	return pingEndpoint(ctx, p.client, p.baseURL, p.apiKey)
+}
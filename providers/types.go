@@ -2,6 +2,7 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
 )
 
 // LLMProvider defines the interface for LLM providers
@@ -10,6 +11,12 @@ type LLMProvider interface {
 	GetDefaultModel() string
 }
 
+// Pinger is implemented by providers that can check their API is reachable without
+// running a completion
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
 // ChatRequest represents a request to the LLM
 type ChatRequest struct {
 	Messages  []Message      `json:"messages"`
@@ -17,6 +24,9 @@ type ChatRequest struct {
 	Model     string         `json:"model,omitempty"`
 	Temperature float64      `json:"temperature,omitempty"`
 	MaxTokens int           `json:"max_tokens,omitempty"`
+	TopP            float64  `json:"top_p,omitempty"`            // 0 leaves the API's default
+	Stop            []string `json:"stop,omitempty"`
+	ReasoningEffort string   `json:"reasoning_effort,omitempty"` // For reasoning models: minimal, low, medium or high
 }
 
 // Message represents a message in the conversation
@@ -24,6 +34,40 @@ type Message struct {
 	Role    string      `json:"role"`  // "system", "user", "assistant", "tool"
 	Content interface{} `json:"content"` // String or array of content parts for multimodal
 	Name    string      `json:"name,omitempty"` // For tool calls
+	ToolCalls  []MessageToolCall `json:"tool_calls,omitempty"`   // Tool calls made by an assistant message
+	ToolCallID string            `json:"tool_call_id,omitempty"` // The call a tool message responds to
+}
+
+// MessageToolCall is a tool call as it appears in an assistant message sent back to the API
+type MessageToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall holds the function name and its JSON-encoded arguments
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// NewMessageToolCall converts a parsed tool call back into its wire format
+func NewMessageToolCall(id, name string, args map[string]interface{}) MessageToolCall {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		encoded = []byte("{}")
+	}
+	return MessageToolCall{
+		ID:   id,
+		Type: "function",
+		Function: FunctionCall{
+			Name:      name,
+			Arguments: string(encoded),
+		},
+	}
 }
 
 // ToolDef defines a function/tool that can be called
@@ -45,6 +89,10 @@ type ToolCall struct {
 	Name     string                 `json:"name"`
 	Args     map[string]interface{} `json:"arguments"`
 	Type     string                 `json:"type"`
+	// Set when the model's arguments weren't valid JSON; Args is then empty and
+	// RawArgs holds what the model sent so the agent can ask it to try again
+	ArgsError string `json:"-"`
+	RawArgs   string `json:"-"`
 }
 
 // ChatResponse is the response from the LLM
@@ -52,4 +100,12 @@ type ChatResponse struct {
 	Content      string     `json:"content"`
 	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
 	HasToolCalls bool       `json:"has_tool_calls"`
+	Usage        Usage      `json:"usage"` // Zero when the API doesn't report usage
+}
+
+// Usage is the token count the API reports for a request
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
\ No newline at end of file
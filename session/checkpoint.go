@@ -0,0 +1,227 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DataKeyCheckpoints is the session data key holding the session's checkpoints
+const DataKeyCheckpoints = "checkpoints"
+
+// Checkpoint marks a point in a session's history that it can be rolled back or branched to.
+// Messages are append-only, so a checkpoint only records how many there were; the last
+// message ID detects histories that were cleared or rewritten since.
+type Checkpoint struct {
+	Name          string                 `json:"name"`
+	MessageCount  int                    `json:"message_count"`
+	LastMessageID string                 `json:"last_message_id,omitempty"`
+	Data          map[string]interface{} `json:"data,omitempty"` // Session data (summary, settings) at the time
+	CreatedAt     time.Time              `json:"created_at"`
+}
+
+// CreateCheckpoint records the current state of a session under name.
+// An empty name picks the next free "cp-N"; reusing a name replaces that checkpoint.
+func (sm *SessionManager) CreateCheckpoint(sessionKey, name string) (Checkpoint, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if session == nil {
+		return Checkpoint{}, fmt.Errorf("session %s not found", sessionKey)
+	}
+
+	checkpoints := checkpointsOf(session)
+	for n := len(checkpoints) + 1; name == ""; n++ {
+		if candidate := fmt.Sprintf("cp-%d", n); findCheckpoint(checkpoints, candidate) < 0 {
+			name = candidate
+		}
+	}
+
+	checkpoint := Checkpoint{
+		Name:         name,
+		MessageCount: len(session.Messages),
+		Data:         snapshotData(session.Data),
+		CreatedAt:    time.Now(),
+	}
+	if n := len(session.Messages); n > 0 {
+		checkpoint.LastMessageID = session.Messages[n-1].ID
+	}
+
+	if i := findCheckpoint(checkpoints, name); i >= 0 {
+		checkpoints = append(checkpoints[:i], checkpoints[i+1:]...)
+	}
+	checkpoints = append(checkpoints, checkpoint)
+	session.Data[DataKeyCheckpoints] = checkpoints
+	session.UpdatedAt = time.Now()
+
+	return checkpoint, sm.store.Save(session)
+}
+
+// ListCheckpoints returns a session's checkpoints, oldest first
+func (sm *SessionManager) ListCheckpoints(sessionKey string) ([]Checkpoint, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, fmt.Errorf("session %s not found", sessionKey)
+	}
+	return checkpointsOf(session), nil
+}
+
+// RollbackToCheckpoint discards every message after the checkpoint and restores the session
+// data saved with it. Checkpoints taken after it are dropped, since their messages are gone.
+func (sm *SessionManager) RollbackToCheckpoint(sessionKey, name string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	session, checkpoints, i, err := sm.checkpointLocked(sessionKey, name)
+	if err != nil {
+		return err
+	}
+	checkpoint := checkpoints[i]
+
+	session.Messages = session.Messages[:checkpoint.MessageCount:checkpoint.MessageCount]
+	session.Data = snapshotData(checkpoint.Data)
+	session.Data[DataKeyCheckpoints] = checkpoints[:i+1]
+	session.UpdatedAt = time.Now()
+
+	return sm.store.Save(session)
+}
+
+// BranchSession creates newKey as a copy of a session as it was at the named checkpoint,
+// or at its current state when name is empty. The original session is left untouched.
+func (sm *SessionManager) BranchSession(sessionKey, name, newKey string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if existing, err := sm.loadLocked(newKey); err != nil {
+		return err
+	} else if existing != nil {
+		return fmt.Errorf("session %s already exists", newKey)
+	}
+
+	var messages []Message
+	var data map[string]interface{}
+	var checkpoints []Checkpoint
+	if name == "" {
+		session, err := sm.loadLocked(sessionKey)
+		if err != nil {
+			return err
+		}
+		if session == nil {
+			return fmt.Errorf("session %s not found", sessionKey)
+		}
+		messages = session.Messages
+		data = snapshotData(session.Data)
+		checkpoints = checkpointsOf(session)
+	} else {
+		session, all, i, err := sm.checkpointLocked(sessionKey, name)
+		if err != nil {
+			return err
+		}
+		messages = session.Messages[:all[i].MessageCount]
+		data = snapshotData(all[i].Data)
+		checkpoints = all[:i+1]
+	}
+	if len(checkpoints) > 0 {
+		data[DataKeyCheckpoints] = checkpoints
+	}
+
+	now := time.Now()
+	branch := &Session{
+		Key:       newKey,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Data:      data,
+		Messages:  append(make([]Message, 0, len(messages)), messages...),
+	}
+	if err := sm.store.Save(branch); err != nil {
+		return err
+	}
+	sm.sessions[newKey] = branch
+	return nil
+}
+
+// checkpointLocked loads a session and finds a checkpoint that still matches its history;
+// the caller must hold the write lock
+func (sm *SessionManager) checkpointLocked(sessionKey, name string) (*Session, []Checkpoint, int, error) {
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if session == nil {
+		return nil, nil, 0, fmt.Errorf("session %s not found", sessionKey)
+	}
+
+	checkpoints := checkpointsOf(session)
+	i := findCheckpoint(checkpoints, name)
+	if i < 0 {
+		return nil, nil, 0, fmt.Errorf("checkpoint %s not found in session %s", name, sessionKey)
+	}
+
+	checkpoint := checkpoints[i]
+	if checkpoint.MessageCount > len(session.Messages) ||
+		(checkpoint.MessageCount > 0 && session.Messages[checkpoint.MessageCount-1].ID != checkpoint.LastMessageID) {
+		return nil, nil, 0, fmt.Errorf("checkpoint %s no longer matches the history of session %s", name, sessionKey)
+	}
+	return session, checkpoints, i, nil
+}
+
+// checkpointsOf reads the checkpoints from session data. Data loaded from disk holds
+// generic JSON values, so it is re-encoded into Checkpoint structs.
+func checkpointsOf(session *Session) []Checkpoint {
+	switch v := session.Data[DataKeyCheckpoints].(type) {
+	case nil:
+		return nil
+	case []Checkpoint:
+		return append([]Checkpoint(nil), v...)
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		var checkpoints []Checkpoint
+		if err := json.Unmarshal(raw, &checkpoints); err != nil {
+			return nil
+		}
+		return checkpoints
+	}
+}
+
+// findCheckpoint returns the index of the named checkpoint, or -1
+func findCheckpoint(checkpoints []Checkpoint, name string) int {
+	for i, checkpoint := range checkpoints {
+		if checkpoint.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// snapshotData deep-copies session data without its checkpoints
+func snapshotData(data map[string]interface{}) map[string]interface{} {
+	snapshot := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if k == DataKeyCheckpoints {
+			continue
+		}
+		snapshot[k] = v
+	}
+
+	// Values are JSON-compatible, so a round trip gives a deep copy
+	if raw, err := json.Marshal(snapshot); err == nil {
+		copied := make(map[string]interface{}, len(snapshot))
+		if json.Unmarshal(raw, &copied) == nil {
+			return copied
+		}
+	}
+	return snapshot
+}
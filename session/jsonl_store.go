@@ -0,0 +1,231 @@
+package session
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// unsafeKeyChars matches characters that can't be used in session file names (':' on Windows, '/' everywhere)
+var unsafeKeyChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// sessionHeader is the first line of a session file and holds everything except messages
+type sessionHeader struct {
+	Type      string                 `json:"_type"`
+	Key       string                 `json:"key"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// JSONLStore persists each session as dir/<key>.jsonl: a metadata header line followed
+// by one line per message, so saving a message is a single append
+type JSONLStore struct {
+	dir string
+}
+
+// NewJSONLStore creates a store writing session files under dir
+func NewJSONLStore(dir string) *JSONLStore {
+	return &JSONLStore{dir: dir}
+}
+
+// path returns the file path for a session key. Keys that need sanitizing get a short
+// hash suffix so "cli:direct" and "cli_direct" don't share a file.
+func (s *JSONLStore) path(key string) string {
+	name := unsafeKeyChars.ReplaceAllString(key, "_")
+	if name != key {
+		sum := sha1.Sum([]byte(key))
+		name = fmt.Sprintf("%s_%x", name, sum[:4])
+	}
+	return filepath.Join(s.dir, name+".jsonl")
+}
+
+// Load reads a session from disk, returning nil if it has never been saved
+func (s *JSONLStore) Load(key string) (*Session, error) {
+	session, err := readSessionFile(s.path(key))
+	if err != nil || session == nil {
+		return session, err
+	}
+	// The header holds the real key; never hand back another session's history
+	if session.Key != key {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// AppendMessage appends one message to a session file, writing the header first for new files
+func (s *JSONLStore) AppendMessage(session *Session, message Message) error {
+	path := s.path(session.Key)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return s.Save(session)
+	}
+
+	line, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("error encoding message: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening session file: %w", err)
+	}
+	defer f.Close()
+
+	// Start on a fresh line if a previous append was cut short
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing session file: %w", err)
+	}
+	return nil
+}
+
+// Save rewrites a whole session file atomically
+func (s *JSONLStore) Save(session *Session) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("error creating sessions directory: %w", err)
+	}
+
+	path := s.path(session.Key)
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating session file: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(sessionHeader{
+		Type:      "metadata",
+		Key:       session.Key,
+		CreatedAt: session.CreatedAt,
+		UpdatedAt: session.UpdatedAt,
+		Data:      session.Data,
+	})
+	for _, message := range session.Messages {
+		if err != nil {
+			break
+		}
+		err = encoder.Encode(message)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing session file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error replacing session file: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a session file
+func (s *JSONLStore) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting session file: %w", err)
+	}
+	return nil
+}
+
+// List summarizes every persisted session
+func (s *JSONLStore) List() ([]SessionInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading sessions directory: %w", err)
+	}
+
+	var infos []SessionInfo
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
+			continue
+		}
+		session, err := readSessionFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil || session == nil {
+			continue
+		}
+		infos = append(infos, session.Info())
+	}
+	return infos, nil
+}
+
+// Close is a no-op; files are not held open between operations
+func (s *JSONLStore) Close() error {
+	return nil
+}
+
+// readSessionFile parses a session file; a missing file returns nil without error
+func readSessionFile(path string) (*Session, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error opening session file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading session file: %w", err)
+		}
+		return nil, fmt.Errorf("session file %s is empty", path)
+	}
+
+	var header sessionHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Type != "metadata" {
+		return nil, fmt.Errorf("session file %s has no metadata header", path)
+	}
+
+	session := &Session{
+		Key:       header.Key,
+		CreatedAt: header.CreatedAt,
+		UpdatedAt: header.UpdatedAt,
+		Data:      header.Data,
+		Messages:  make([]Message, 0),
+	}
+	if session.Data == nil {
+		session.Data = make(map[string]interface{})
+	}
+
+	for scanner.Scan() {
+		var message Message
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			// A crash mid-append can leave a partial last line; skip it
+			continue
+		}
+		session.Messages = append(session.Messages, message)
+		// Appends don't rewrite the header, so the last message is the real activity time
+		if message.Timestamp.After(session.UpdatedAt) {
+			session.UpdatedAt = message.Timestamp
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading session file: %w", err)
+	}
+
+	return session, nil
+}
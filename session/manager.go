@@ -2,8 +2,13 @@ package session
 
 import (
 	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
+
+	"nanotalon/logging"
 )
 
 // Session represents a conversation session
@@ -17,34 +22,75 @@ type Session struct {
 
 // Message represents a message in a session
 type Message struct {
-	ID        string    `json:"id"`
-	Role      string    `json:"role"`      // "user", "assistant", "system"
-	Content   string    `json:"content"`
-	Timestamp time.Time `json:"timestamp"`
+	ID         string                 `json:"id"`
+	Role       string                 `json:"role"`      // "user", "assistant", "system", "tool"
+	Content    string                 `json:"content"`
+	ToolCalls  []ToolCall             `json:"tool_calls,omitempty"`   // Tools requested by an assistant message
+	ToolCallID string                 `json:"tool_call_id,omitempty"` // The call a tool message answers
+	Name       string                 `json:"name,omitempty"`         // Tool name for tool messages
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+}
+
+// ToolCall records a tool invocation requested by the assistant
+type ToolCall struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
 }
 
-// SessionManager manages conversation sessions
+// SessionManager manages conversation sessions. Sessions are persisted under
+// baseDir/sessions and loaded lazily the first time they are accessed.
 type SessionManager struct {
 	sessions map[string]*Session
 	mutex    sync.RWMutex
 	baseDir  string
+	store    Store
 }
 
-// NewSessionManager creates a new session manager
+// NewSessionManager creates a new session manager persisting JSONL files under baseDir/sessions
 func NewSessionManager(baseDir string) *SessionManager {
+	return NewSessionManagerWithStore(baseDir, NewJSONLStore(filepath.Join(baseDir, "sessions")))
+}
+
+// NewSessionManagerWithStore creates a new session manager backed by the given store
+func NewSessionManagerWithStore(baseDir string, store Store) *SessionManager {
 	return &SessionManager{
 		sessions: make(map[string]*Session),
 		baseDir:  baseDir,
+		store:    store,
 	}
 }
 
-// GetOrCreateSession gets an existing session or creates a new one
-func (sm *SessionManager) GetOrCreateSession(sessionKey string) *Session {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
+// Close releases the underlying store
+func (sm *SessionManager) Close() error {
+	return sm.store.Close()
+}
+
+// loadLocked returns a cached session or loads it from disk; the caller must hold the write lock
+func (sm *SessionManager) loadLocked(sessionKey string) (*Session, error) {
+	if session, exists := sm.sessions[sessionKey]; exists {
+		return session, nil
+	}
+
+	session, err := sm.store.Load(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if session != nil {
+		sm.sessions[sessionKey] = session
+	}
+	return session, nil
+}
 
-	session, exists := sm.sessions[sessionKey]
-	if !exists {
+// getOrCreateLocked returns an existing session or creates a new one; the caller must hold the write lock
+func (sm *SessionManager) getOrCreateLocked(sessionKey string) *Session {
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		// A corrupt file shouldn't take the conversation down; start fresh and overwrite it on save
+		slog.Warn("Could not load session", logging.SessionKey, sessionKey, "error", err)
+	}
+	if session == nil {
 		session = &Session{
 			Key:       sessionKey,
 			CreatedAt: time.Now(),
@@ -54,49 +100,63 @@ func (sm *SessionManager) GetOrCreateSession(sessionKey string) *Session {
 		}
 		sm.sessions[sessionKey] = session
 	}
-
 	return session
 }
 
+// GetOrCreateSession gets an existing session or creates a new one
+func (sm *SessionManager) GetOrCreateSession(sessionKey string) *Session {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	return sm.getOrCreateLocked(sessionKey)
+}
+
 // GetSession gets a session by key
 func (sm *SessionManager) GetSession(sessionKey string) (*Session, bool) {
-	sm.mutex.RLock()
-	defer sm.mutex.RUnlock()
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
 
-	session, exists := sm.sessions[sessionKey]
-	return session, exists
+	session, err := sm.loadLocked(sessionKey)
+	return session, err == nil && session != nil
 }
 
-// SaveMessage saves a message to a session
+// SaveMessage saves a message to a session, creating the session if needed,
+// and appends it to the session file
 func (sm *SessionManager) SaveMessage(sessionKey, role, content string) error {
+	return sm.AppendMessage(sessionKey, Message{Role: role, Content: content})
+}
+
+// AppendMessage saves a full message, including any tool calls or tool result fields,
+// creating the session if needed. ID and Timestamp are filled in when empty.
+func (sm *SessionManager) AppendMessage(sessionKey string, message Message) error {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
-	session, exists := sm.sessions[sessionKey]
-	if !exists {
-		return fmt.Errorf("session %s not found", sessionKey)
-	}
+	session := sm.getOrCreateLocked(sessionKey)
 
-	message := Message{
-		ID:        fmt.Sprintf("msg_%d", time.Now().UnixNano()),
-		Role:      role,
-		Content:   content,
-		Timestamp: time.Now(),
+	if message.ID == "" {
+		message.ID = fmt.Sprintf("msg_%d", time.Now().UnixNano())
+	}
+	if message.Timestamp.IsZero() {
+		message.Timestamp = time.Now()
 	}
 
 	session.Messages = append(session.Messages, message)
 	session.UpdatedAt = time.Now()
 
-	return nil
+	return sm.store.AppendMessage(session, message)
 }
 
 // GetMessageHistory gets message history for a session
 func (sm *SessionManager) GetMessageHistory(sessionKey string, limit int) ([]Message, error) {
-	sm.mutex.RLock()
-	defer sm.mutex.RUnlock()
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
 
-	session, exists := sm.sessions[sessionKey]
-	if !exists {
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
 		return nil, fmt.Errorf("session %s not found", sessionKey)
 	}
 
@@ -108,18 +168,44 @@ func (sm *SessionManager) GetMessageHistory(sessionKey string, limit int) ([]Mes
 	return session.Messages[startIdx:], nil
 }
 
-// ListSessions lists all active sessions
-func (sm *SessionManager) ListSessions() []map[string]interface{} {
+// ListSessionInfo summarizes all sessions, including persisted ones not yet loaded,
+// most recently active first
+func (sm *SessionManager) ListSessionInfo() []SessionInfo {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
 
+	all := make(map[string]SessionInfo)
+	persisted, err := sm.store.List()
+	if err != nil {
+		slog.Warn("Could not list persisted sessions", "error", err)
+	}
+	for _, info := range persisted {
+		all[info.Key] = info
+	}
+	// Loaded sessions may be newer than what was last written
+	for key, session := range sm.sessions {
+		all[key] = session.Info()
+	}
+
+	infos := make([]SessionInfo, 0, len(all))
+	for _, info := range all {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].UpdatedAt.After(infos[j].UpdatedAt)
+	})
+	return infos
+}
+
+// ListSessions lists all sessions, including persisted ones not yet loaded
+func (sm *SessionManager) ListSessions() []map[string]interface{} {
 	var sessions []map[string]interface{}
-	for _, session := range sm.sessions {
+	for _, info := range sm.ListSessionInfo() {
 		sessions = append(sessions, map[string]interface{}{
-			"key":        session.Key,
-			"created_at": session.CreatedAt,
-			"updated_at": session.UpdatedAt,
-			"message_count": len(session.Messages),
+			"key":        info.Key,
+			"created_at": info.CreatedAt,
+			"updated_at": info.UpdatedAt,
+			"message_count": info.MessageCount,
 		})
 	}
 
@@ -131,42 +217,58 @@ func (sm *SessionManager) ClearSession(sessionKey string) error {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
-	session, exists := sm.sessions[sessionKey]
-	if !exists {
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		return err
+	}
+	if session == nil {
 		return fmt.Errorf("session %s not found", sessionKey)
 	}
 
 	session.Messages = make([]Message, 0)
+	delete(session.Data, DataKeySummary)
+	delete(session.Data, DataKeySummarizedCount)
+	delete(session.Data, DataKeyCheckpoints)
 	session.UpdatedAt = time.Now()
 
-	return nil
+	return sm.store.Save(session)
 }
 
-// UpdateSessionData updates session data
+// UpdateSessionData updates session data; a nil value removes the key
 func (sm *SessionManager) UpdateSessionData(sessionKey string, data map[string]interface{}) error {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
-	session, exists := sm.sessions[sessionKey]
-	if !exists {
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		return err
+	}
+	if session == nil {
 		return fmt.Errorf("session %s not found", sessionKey)
 	}
 
 	for k, v := range data {
+		if v == nil {
+			delete(session.Data, k)
+			continue
+		}
 		session.Data[k] = v
 	}
 	session.UpdatedAt = time.Now()
 
-	return nil
+	return sm.store.Save(session)
 }
 
 // GetData retrieves session data
 func (sm *SessionManager) GetData(sessionKey string) (map[string]interface{}, error) {
-	sm.mutex.RLock()
-	defer sm.mutex.RUnlock()
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
 
-	session, exists := sm.sessions[sessionKey]
-	if !exists {
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
 		return nil, fmt.Errorf("session %s not found", sessionKey)
 	}
 
@@ -179,16 +281,19 @@ func (sm *SessionManager) GetData(sessionKey string) (map[string]interface{}, er
 	return dataCopy, nil
 }
 
-// DeleteSession deletes a session
+// DeleteSession deletes a session and its file
 func (sm *SessionManager) DeleteSession(sessionKey string) error {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
-	_, exists := sm.sessions[sessionKey]
-	if !exists {
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		return err
+	}
+	if session == nil {
 		return fmt.Errorf("session %s not found", sessionKey)
 	}
 
 	delete(sm.sessions, sessionKey)
-	return nil
-}
\ No newline at end of file
+	return sm.store.Delete(sessionKey)
+}
@@ -0,0 +1,147 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RedactedText replaces forgotten text in session transcripts
+const RedactedText = "[forgotten]"
+
+// Redaction is a message, or the summary, of a session that contained forgotten text
+type Redaction struct {
+	Session   string `json:"session"`
+	MessageID string `json:"message_id,omitempty"` // Empty for the summary and checkpoints
+	Role      string `json:"role"`                 // The message's role, or "summary"
+	Excerpt   string `json:"excerpt"`              // The redacted content around the match
+}
+
+// Redact replaces text, ignoring case, with RedactedText in every session's messages, tool
+// calls, summary and checkpoints, and returns where it was found. With dryRun nothing is
+// changed. Messages keep their place so tool calls and their results still pair up.
+func (sm *SessionManager) Redact(text string, dryRun bool) ([]Redaction, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("nothing to redact: the text is empty")
+	}
+	pattern := regexp.MustCompile("(?i)" + regexp.QuoteMeta(text))
+
+	infos := sm.ListSessionInfo()
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	var redactions []Redaction
+	for _, info := range infos {
+		session, err := sm.loadLocked(info.Key)
+		if err != nil {
+			return redactions, fmt.Errorf("failed to load session %s: %w", info.Key, err)
+		}
+		if session == nil {
+			continue
+		}
+
+		changed := false
+		for i := range session.Messages {
+			message := &session.Messages[i]
+			found := pattern.MatchString(message.Content)
+			for _, tc := range message.ToolCalls {
+				if args, _ := json.Marshal(tc.Arguments); pattern.Match(args) {
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+
+			content := pattern.ReplaceAllString(message.Content, RedactedText)
+			redactions = append(redactions, Redaction{
+				Session:   session.Key,
+				MessageID: message.ID,
+				Role:      message.Role,
+				Excerpt:   redactedExcerpt(content),
+			})
+			if dryRun {
+				continue
+			}
+			message.Content = content
+			for j := range message.ToolCalls {
+				message.ToolCalls[j].Arguments, _ = redactValue(message.ToolCalls[j].Arguments, pattern).(map[string]interface{})
+			}
+			changed = true
+		}
+
+		// The summary and checkpoints hold copies of earlier messages
+		if raw, _ := json.Marshal(session.Data); pattern.Match(raw) {
+			var data map[string]interface{}
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return redactions, fmt.Errorf("failed to decode data of session %s: %w", session.Key, err)
+			}
+			data, _ = redactValue(data, pattern).(map[string]interface{})
+			summary, _ := data[DataKeySummary].(string)
+			redactions = append(redactions, Redaction{Session: session.Key, Role: "summary", Excerpt: redactedExcerpt(summary)})
+			if !dryRun {
+				session.Data = data
+				changed = true
+			}
+		}
+
+		if changed {
+			session.UpdatedAt = time.Now()
+			if err := sm.store.Save(session); err != nil {
+				return redactions, fmt.Errorf("failed to save session %s: %w", session.Key, err)
+			}
+		}
+	}
+
+	return redactions, nil
+}
+
+// redactValue replaces the pattern in every string of a decoded JSON value
+func redactValue(value interface{}, pattern *regexp.Regexp) interface{} {
+	switch v := value.(type) {
+	case string:
+		return pattern.ReplaceAllString(v, RedactedText)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = redactValue(item, pattern)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item, pattern)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// redactedExcerpt shows the redacted content around the first redaction on one line
+func redactedExcerpt(content string) string {
+	const context = 60
+	runes := []rune(strings.Join(strings.Fields(content), " "))
+	i := strings.Index(string(runes), RedactedText)
+	if i < 0 {
+		if len(runes) > 2*context {
+			return string(runes[:2*context]) + "…"
+		}
+		return string(runes)
+	}
+
+	i = len([]rune(string(runes)[:i]))
+	start, end := max(i-context, 0), min(i+len(RedactedText)+context, len(runes))
+	excerpt := string(runes[start:end])
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+	if end < len(runes) {
+		excerpt += "…"
+	}
+	return excerpt
+}
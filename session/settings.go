@@ -0,0 +1,101 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Session data keys for per-session overrides of the agent defaults
+const (
+	DataKeyModel             = "model"
+	DataKeyTemperature       = "temperature"
+	DataKeySystemPromptExtra = "system_prompt_extra"
+)
+
+// SettingKeys lists the session data keys the agent loop recognizes as settings
+var SettingKeys = []string{DataKeyModel, DataKeyTemperature, DataKeySystemPromptExtra}
+
+// Settings are per-session overrides; zero values mean "use the agent default"
+type Settings struct {
+	Model             string
+	Temperature       *float64
+	SystemPromptExtra string
+}
+
+// GetSettings returns the recognized settings stored in a session's data.
+// Sessions that don't exist yet have no overrides.
+func (sm *SessionManager) GetSettings(sessionKey string) (Settings, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil || session == nil {
+		return Settings{}, err
+	}
+	return settingsFromData(session.Data), nil
+}
+
+// SettingKey normalizes a setting name to its data key, accepting "persona" as an
+// alias for system_prompt_extra. It reports false for unrecognized names.
+func SettingKey(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "persona" {
+		return DataKeySystemPromptExtra, true
+	}
+	for _, key := range SettingKeys {
+		if name == key {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// ParseSetting validates a setting value given as text and returns its data key
+// along with the value converted to the type stored in session data
+func ParseSetting(name, value string) (string, interface{}, error) {
+	key, ok := SettingKey(name)
+	if !ok {
+		return "", nil, fmt.Errorf("unknown setting %q (use %s)", name, strings.Join(SettingKeys, ", "))
+	}
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case DataKeyModel:
+		if value == "" || strings.ContainsAny(value, " \t\n") {
+			return "", nil, fmt.Errorf("invalid model name %q", value)
+		}
+		return key, value, nil
+	case DataKeyTemperature:
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil || temperature < 0 || temperature > 2 {
+			return "", nil, fmt.Errorf("temperature must be a number between 0 and 2")
+		}
+		return key, temperature, nil
+	default:
+		if value == "" {
+			return "", nil, fmt.Errorf("system_prompt_extra must not be empty")
+		}
+		return key, value, nil
+	}
+}
+
+// settingsFromData reads settings from session data; numbers decoded from JSON are float64
+func settingsFromData(data map[string]interface{}) Settings {
+	var settings Settings
+	settings.Model, _ = data[DataKeyModel].(string)
+	settings.SystemPromptExtra, _ = data[DataKeySystemPromptExtra].(string)
+
+	switch v := data[DataKeyTemperature].(type) {
+	case float64:
+		settings.Temperature = &v
+	case int:
+		temperature := float64(v)
+		settings.Temperature = &temperature
+	case string:
+		if temperature, err := strconv.ParseFloat(v, 64); err == nil {
+			settings.Temperature = &temperature
+		}
+	}
+	return settings
+}
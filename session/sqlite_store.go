@@ -0,0 +1,232 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the session tables. Messages keep their full JSON in body so new
+// message fields don't need migrations; key and timestamp are columns for indexed queries.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	key        TEXT PRIMARY KEY,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	data       TEXT NOT NULL DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_updated_at ON sessions (updated_at);
+
+CREATE TABLE IF NOT EXISTS messages (
+	seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_key TEXT NOT NULL,
+	timestamp   INTEGER NOT NULL,
+	body        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_messages_session_key ON messages (session_key, seq);
+CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages (session_key, timestamp);
+`
+
+// SQLiteStore persists sessions in a SQLite database (pure Go driver, no cgo)
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens or creates a SQLite session database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating sessions directory: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening session database: %w", err)
+	}
+	// SQLite allows one writer at a time; serializing here avoids SQLITE_BUSY under load
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating session schema: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Load returns the stored session, or nil if it has never been saved
+func (s *SQLiteStore) Load(key string) (*Session, error) {
+	var createdAt, updatedAt int64
+	var data string
+	err := s.db.QueryRow(`SELECT created_at, updated_at, data FROM sessions WHERE key = ?`, key).
+		Scan(&createdAt, &updatedAt, &data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading session: %w", err)
+	}
+
+	session := &Session{
+		Key:       key,
+		CreatedAt: time.Unix(0, createdAt),
+		UpdatedAt: time.Unix(0, updatedAt),
+		Data:      make(map[string]interface{}),
+		Messages:  make([]Message, 0),
+	}
+	if err := json.Unmarshal([]byte(data), &session.Data); err != nil {
+		return nil, fmt.Errorf("error decoding session data: %w", err)
+	}
+
+	rows, err := s.db.Query(`SELECT body FROM messages WHERE session_key = ? ORDER BY seq`, key)
+	if err != nil {
+		return nil, fmt.Errorf("error loading messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return nil, fmt.Errorf("error loading messages: %w", err)
+		}
+		var message Message
+		if err := json.Unmarshal([]byte(body), &message); err != nil {
+			return nil, fmt.Errorf("error decoding message: %w", err)
+		}
+		session.Messages = append(session.Messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error loading messages: %w", err)
+	}
+
+	return session, nil
+}
+
+// AppendMessage inserts one message and bumps the session's update time
+func (s *SQLiteStore) AppendMessage(session *Session, message Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("error encoding message: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := upsertSession(tx, session); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO messages (session_key, timestamp, body) VALUES (?, ?, ?)`,
+		session.Key, message.Timestamp.UnixNano(), string(body)); err != nil {
+		return fmt.Errorf("error inserting message: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Save replaces the stored session and all of its messages
+func (s *SQLiteStore) Save(session *Session) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := upsertSession(tx, session); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM messages WHERE session_key = ?`, session.Key); err != nil {
+		return fmt.Errorf("error clearing messages: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO messages (session_key, timestamp, body) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("error preparing insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, message := range session.Messages {
+		body, err := json.Marshal(message)
+		if err != nil {
+			return fmt.Errorf("error encoding message: %w", err)
+		}
+		if _, err := stmt.Exec(session.Key, message.Timestamp.UnixNano(), string(body)); err != nil {
+			return fmt.Errorf("error inserting message: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a session and its messages
+func (s *SQLiteStore) Delete(key string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM messages WHERE session_key = ?`, key); err != nil {
+		return fmt.Errorf("error deleting messages: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE key = ?`, key); err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// List summarizes all stored sessions, most recently active first
+func (s *SQLiteStore) List() ([]SessionInfo, error) {
+	rows, err := s.db.Query(`
+		SELECT s.key, s.created_at, s.updated_at, COUNT(m.seq)
+		FROM sessions s LEFT JOIN messages m ON m.session_key = s.key
+		GROUP BY s.key
+		ORDER BY s.updated_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var infos []SessionInfo
+	for rows.Next() {
+		var info SessionInfo
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&info.Key, &createdAt, &updatedAt, &info.MessageCount); err != nil {
+			return nil, fmt.Errorf("error listing sessions: %w", err)
+		}
+		info.CreatedAt = time.Unix(0, createdAt)
+		info.UpdatedAt = time.Unix(0, updatedAt)
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// upsertSession writes the session row inside a transaction
+func upsertSession(tx *sql.Tx, session *Session) error {
+	data, err := json.Marshal(session.Data)
+	if err != nil {
+		return fmt.Errorf("error encoding session data: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO sessions (key, created_at, updated_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		session.Key, session.CreatedAt.UnixNano(), session.UpdatedAt.UnixNano(), string(data))
+	if err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nanotalon/config"
+)
+
+// Store persists sessions for a SessionManager
+type Store interface {
+	// Load returns the stored session, or nil if it has never been saved
+	Load(key string) (*Session, error)
+	// AppendMessage persists one new message already added to session
+	AppendMessage(session *Session, message Message) error
+	// Save replaces the stored session with its current state
+	Save(session *Session) error
+	// Delete removes a session
+	Delete(key string) error
+	// List summarizes all stored sessions
+	List() ([]SessionInfo, error)
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// SessionInfo summarizes a session without its messages
+type SessionInfo struct {
+	Key          string    `json:"key"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	MessageCount int       `json:"message_count"`
+}
+
+// Channel returns the channel the session belongs to
+func (i SessionInfo) Channel() string {
+	return ChannelFromKey(i.Key)
+}
+
+// ChannelFromKey extracts the channel name from a "channel:chat" session key
+func ChannelFromKey(key string) string {
+	channel, _, _ := strings.Cut(key, ":")
+	return channel
+}
+
+// Info returns a summary of the session
+func (s *Session) Info() SessionInfo {
+	return SessionInfo{
+		Key:          s.Key,
+		CreatedAt:    s.CreatedAt,
+		UpdatedAt:    s.UpdatedAt,
+		MessageCount: len(s.Messages),
+	}
+}
+
+// NewStore creates the session store selected by config
+func NewStore(cfg config.SessionConfig, workspace string) (Store, error) {
+	switch strings.ToLower(cfg.Store) {
+	case "", "jsonl":
+		dir := cfg.Path
+		if dir == "" {
+			dir = filepath.Join(workspace, "sessions")
+		}
+		return NewJSONLStore(dir), nil
+	case "sqlite":
+		path := cfg.Path
+		if path == "" {
+			path = filepath.Join(workspace, "sessions", "sessions.db")
+		}
+		return NewSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("unknown session store: %s", cfg.Store)
+	}
+}
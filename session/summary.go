@@ -0,0 +1,88 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// Session data keys used for the rolling conversation summary
+const (
+	DataKeySummary         = "summary"
+	DataKeySummarizedCount = "summarized_count"
+)
+
+// GetSummary returns the rolling summary of a session and how many of its leading
+// messages it covers. Sessions without a summary return an empty string and zero.
+func (sm *SessionManager) GetSummary(sessionKey string) (string, int, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil || session == nil {
+		return "", 0, err
+	}
+	summary, count := summaryState(session)
+	return summary, count, nil
+}
+
+// SetSummary stores a new rolling summary covering the first count messages
+func (sm *SessionManager) SetSummary(sessionKey string, summary string, count int) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return fmt.Errorf("session %s not found", sessionKey)
+	}
+	if count < 0 || count > len(session.Messages) {
+		return fmt.Errorf("summary covers %d messages but session %s has %d", count, sessionKey, len(session.Messages))
+	}
+
+	session.Data[DataKeySummary] = summary
+	session.Data[DataKeySummarizedCount] = count
+	session.UpdatedAt = time.Now()
+
+	return sm.store.Save(session)
+}
+
+// GetUnsummarizedHistory returns up to limit recent messages not yet covered by the summary
+func (sm *SessionManager) GetUnsummarizedHistory(sessionKey string, limit int) ([]Message, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	session, err := sm.loadLocked(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, fmt.Errorf("session %s not found", sessionKey)
+	}
+
+	_, count := summaryState(session)
+	startIdx := count
+	if len(session.Messages)-startIdx > limit {
+		startIdx = len(session.Messages) - limit
+	}
+
+	return session.Messages[startIdx:], nil
+}
+
+// summaryState reads the summary fields from session data; numbers decoded from JSON are float64
+func summaryState(session *Session) (string, int) {
+	summary, _ := session.Data[DataKeySummary].(string)
+
+	var count int
+	switch v := session.Data[DataKeySummarizedCount].(type) {
+	case int:
+		count = v
+	case float64:
+		count = int(v)
+	}
+	if count > len(session.Messages) {
+		count = len(session.Messages)
+	}
+	return summary, count
+}
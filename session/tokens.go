@@ -0,0 +1,82 @@
+package session
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// messageOverheadTokens approximates the per-message framing tokens (role, separators)
+const messageOverheadTokens = 4
+
+// EstimateTokens gives a rough token count for text without a model-specific tokenizer.
+// ASCII text averages about four characters per token; other scripts (CJK in particular)
+// are closer to one token per character, so they are counted per rune.
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// EstimatedTokens returns the approximate number of tokens the message uses in a prompt
+func (m Message) EstimatedTokens() int {
+	tokens := EstimateTokens(m.Content) + messageOverheadTokens
+	for _, tc := range m.ToolCalls {
+		args, _ := json.Marshal(tc.Arguments)
+		tokens += EstimateTokens(tc.Name) + EstimateTokens(string(args)) + messageOverheadTokens
+	}
+	return tokens
+}
+
+// TrimToTokenBudget drops the oldest messages until the total estimate fits maxTokens.
+// System messages and the last user message are always kept, even if they alone exceed
+// the budget. A maxTokens of zero or less disables trimming.
+func TrimToTokenBudget(messages []Message, maxTokens int) []Message {
+	if maxTokens <= 0 || len(messages) == 0 {
+		return messages
+	}
+
+	lastUser := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			lastUser = i
+			break
+		}
+	}
+
+	total := 0
+	for _, m := range messages {
+		total += m.EstimatedTokens()
+	}
+	if total <= maxTokens {
+		return messages
+	}
+
+	keep := make([]bool, len(messages))
+	for i := range keep {
+		keep[i] = true
+	}
+	for i, m := range messages {
+		if total <= maxTokens {
+			break
+		}
+		if m.Role == "system" || i == lastUser {
+			continue
+		}
+		keep[i] = false
+		total -= m.EstimatedTokens()
+	}
+
+	trimmed := make([]Message, 0, len(messages))
+	for i, m := range messages {
+		if keep[i] {
+			trimmed = append(trimmed, m)
+		}
+	}
+	return trimmed
+}
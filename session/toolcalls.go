@@ -0,0 +1,47 @@
+package session
+
+// RepairToolCalls makes a message window valid to replay to a provider. Trimming or
+// windowing can cut a tool exchange in half, and APIs reject tool results without the
+// assistant call that requested them, or calls left without results. Assistant
+// messages lose their tool calls unless every result is present (and are dropped if
+// nothing else remains), and tool results without a preceding call are dropped.
+func RepairToolCalls(messages []Message) []Message {
+	answered := make(map[string]bool)
+	for _, m := range messages {
+		if m.Role == "tool" && m.ToolCallID != "" {
+			answered[m.ToolCallID] = true
+		}
+	}
+
+	pending := make(map[string]bool)
+	repaired := make([]Message, 0, len(messages))
+	for _, m := range messages {
+		switch {
+		case len(m.ToolCalls) > 0:
+			complete := true
+			for _, tc := range m.ToolCalls {
+				if !answered[tc.ID] {
+					complete = false
+					break
+				}
+			}
+			if complete {
+				for _, tc := range m.ToolCalls {
+					pending[tc.ID] = true
+				}
+				repaired = append(repaired, m)
+			} else if m.Content != "" {
+				m.ToolCalls = nil
+				repaired = append(repaired, m)
+			}
+		case m.Role == "tool":
+			if pending[m.ToolCallID] {
+				delete(pending, m.ToolCallID)
+				repaired = append(repaired, m)
+			}
+		default:
+			repaired = append(repaired, m)
+		}
+	}
+	return repaired
+}
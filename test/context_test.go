@@ -0,0 +1,43 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	agentcontext "nanotalon/agent/context"
+	"nanotalon/agent/memory"
+)
+
+// TestSystemPromptSources checks bootstrap files and memory reach the prompt and edits invalidate the cache
+func TestSystemPromptSources(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "SOUL.md"), []byte("Always answer in haiku."), 0644); err != nil {
+		t.Fatalf("Failed to write SOUL.md: %v", err)
+	}
+
+	builder := agentcontext.NewContextBuilder(workspace)
+	prompt, err := builder.SystemPrompt()
+	if err != nil {
+		t.Fatalf("Failed to build system prompt: %v", err)
+	}
+	if !strings.Contains(prompt, "Always answer in haiku.") {
+		t.Errorf("Expected SOUL.md in the system prompt")
+	}
+
+	if err := memory.NewMemoryStore(workspace).WriteLongTerm("User's cat is called Miso."); err != nil {
+		t.Fatalf("Failed to write memory: %v", err)
+	}
+	prompt, _ = builder.SystemPrompt()
+	if !strings.Contains(prompt, "Miso") {
+		t.Errorf("Expected new long-term memory to invalidate the cached prompt")
+	} else {
+		t.Logf("✓ Memory update picked up by the cached prompt")
+	}
+
+	channel, chatID := "telegram", "42"
+	injected := builder.InjectRuntimeContext("hello", &channel, &chatID)
+	if !strings.HasPrefix(injected, "hello") || !strings.Contains(injected, "Chat ID: 42") {
+		t.Errorf("Unexpected runtime context: %q", injected)
+	}
+}
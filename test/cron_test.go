@@ -1,8 +1,13 @@
 package test
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+	"nanotalon/clock"
 	"nanotalon/cron"
 )
 
@@ -93,6 +98,7 @@ func TestCronFunctionality(t *testing.T) {
 		t.Errorf("Failed to manually run job: %s", job2.ID)
 	} else {
 		t.Logf("✓ Manually ran job with ID: %s", job2.ID)
+		waitForRun(t, service, job2.ID, time.Time{})
 	}
 
 	// Test service status
@@ -154,4 +160,749 @@ func TestCronInvalidSchedule(t *testing.T) {
 	}
 
 	t.Logf("✓ Cron invalid schedule test completed")
-}
\ No newline at end of file
+}
+
+// firedJobs returns a job callback that reports the names of the jobs it runs
+func firedJobs() (func(job *cron.CronJob) (string, error), chan string) {
+	fired := make(chan string, 16)
+	return func(job *cron.CronJob) (string, error) {
+		fired <- job.Name
+		return "Executed", nil
+	}, fired
+}
+
+// expectFired waits for the named job to run, failing if another job runs first
+func expectFired(t *testing.T, fired chan string, name string, within time.Duration) {
+	t.Helper()
+	select {
+	case got := <-fired:
+		if got != name {
+			t.Fatalf("Expected %s to run, got %s", name, got)
+		}
+	case <-time.After(within):
+		t.Fatalf("Expected %s to run within %s", name, within)
+	}
+}
+
+// expectQuiet fails if any job runs within the given duration
+func expectQuiet(t *testing.T, fired chan string, within time.Duration) {
+	t.Helper()
+	select {
+	case got := <-fired:
+		t.Fatalf("Expected no job to run, got %s", got)
+	case <-time.After(within):
+	}
+}
+
+// waitForRun waits until a job's history records a run started at or after the given time
+func waitForRun(t *testing.T, service *cron.CronService, jobID string, startedAt time.Time) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if run := service.GetJob(jobID).State.LastRun(); run != nil && run.StartedAtMS >= startedAt.UnixMilli() {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected job %s to have run", jobID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestCronRemoveThenFire tests that a removed job never fires while the others keep running
+func TestCronRemoveThenFire(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	service, err := cron.NewCronServiceWithClock(filepath.Join(t.TempDir(), "cron_store.json"), fake)
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	callback, fired := firedJobs()
+	service.SetOnJobCallback(callback)
+	service.Start()
+	defer service.Stop()
+
+	every := int64(time.Minute / time.Millisecond)
+	schedule := cron.CronSchedule{Kind: "every", EveryMS: &every}
+	removed, err := service.AddJob("removed", schedule, "Removed job", false, "", "", false)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	if _, err := service.AddJob("kept", schedule, "Kept job", false, "", "", false); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	later, err := service.AddJob("one-shot", cron.CronSchedule{Kind: "at", AtMS: fake.Now().Add(30 * time.Second).UnixMilli()}, "One-shot job", false, "", "", true)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	fake.BlockUntil(3)
+
+	if !service.RemoveJob(removed.ID) || !service.RemoveJob(later.ID) {
+		t.Fatal("Failed to remove jobs")
+	}
+	fake.Advance(time.Minute)
+	expectFired(t, fired, "kept", 5*time.Second)
+	expectQuiet(t, fired, 100*time.Millisecond)
+
+	if jobs := service.ListJobs(true); len(jobs) != 1 || jobs[0].Name != "kept" {
+		t.Errorf("Expected only the kept job to remain, got %d jobs", len(jobs))
+	}
+}
+
+// TestCronDisableKeepsOthersRunning tests that disabling a cron expression job leaves the scheduler running
+func TestCronDisableKeepsOthersRunning(t *testing.T) {
+	service, err := cron.NewCronService(filepath.Join(t.TempDir(), "cron_store.json"))
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	callback, fired := firedJobs()
+	service.SetOnJobCallback(callback)
+
+	disabled, err := service.AddJob("disabled", cron.CronSchedule{Kind: "cron", Expr: "@every 1s"}, "Disabled job", false, "", "", false)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	service.Start()
+	defer service.Stop()
+
+	if service.EnableJob(disabled.ID, false) == nil {
+		t.Fatal("Failed to disable job")
+	}
+	if _, err := service.AddJob("enabled", cron.CronSchedule{Kind: "cron", Expr: "@every 1s"}, "Enabled job", false, "", "", false); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	expectFired(t, fired, "enabled", 3*time.Second)
+
+	if !service.RemoveJob(disabled.ID) {
+		t.Fatal("Failed to remove job")
+	}
+	expectFired(t, fired, "enabled", 3*time.Second)
+}
+
+// TestCronTimezone tests that cron expression jobs accept IANA timezones and reject unknown ones
+func TestCronTimezone(t *testing.T) {
+	service, err := cron.NewCronService(filepath.Join(t.TempDir(), "cron_store.json"))
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+
+	if _, err := service.AddJob("vancouver", cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *", Tz: "America/Vancouver"}, "Morning", false, "", "", false); err != nil {
+		t.Errorf("Expected a valid timezone to be accepted: %v", err)
+	}
+	if _, err := service.AddJob("nowhere", cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *", Tz: "Mars/Olympus"}, "Morning", false, "", "", false); err == nil {
+		t.Error("Expected an unknown timezone to be rejected")
+	}
+	if _, err := service.AddJob("twice", cron.CronSchedule{Kind: "cron", Expr: "CRON_TZ=UTC 0 9 * * *", Tz: "America/Vancouver"}, "Morning", false, "", "", false); err == nil {
+		t.Error("Expected a timezone in both the expression and tz to be rejected")
+	}
+}
+
+// TestCronNextRun tests that jobs report when they will next run
+func TestCronNextRun(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	service, err := cron.NewCronServiceWithClock(filepath.Join(t.TempDir(), "cron_store.json"), fake)
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	callback, fired := firedJobs()
+	service.SetOnJobCallback(callback)
+	service.Start()
+	defer service.Stop()
+
+	morning, err := service.AddJob("morning", cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *", Tz: "America/Vancouver"}, "Morning", false, "", "", false)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	// 9am in Vancouver is 5pm UTC in winter
+	if next := morning.State.NextRunAtMS; next == nil || !time.UnixMilli(*next).Equal(start.Add(17*time.Hour)) {
+		t.Errorf("Expected the next run at 9am Vancouver time, got %v", next)
+	}
+
+	every := int64(time.Minute / time.Millisecond)
+	ticking, err := service.AddJob("ticking", cron.CronSchedule{Kind: "every", EveryMS: &every}, "Tick", false, "", "", false)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	if next := ticking.State.NextRunAtMS; next == nil || *next != start.Add(time.Minute).UnixMilli() {
+		t.Errorf("Expected the next run a minute from now, got %v", next)
+	}
+	if next, ok := service.Status()["next_run_at_ms"].(int64); !ok || next != start.Add(time.Minute).UnixMilli() {
+		t.Errorf("Expected the status to report the earliest next run, got %v", service.Status()["next_run_at_ms"])
+	}
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	expectFired(t, fired, "ticking", 5*time.Second)
+	for _, job := range service.ListJobs(false) {
+		if job.Name == "ticking" && (job.State.NextRunAtMS == nil || *job.State.NextRunAtMS != start.Add(2*time.Minute).UnixMilli()) {
+			t.Errorf("Expected the next run to move on after firing, got %v", job.State.NextRunAtMS)
+		}
+	}
+
+	if disabled := service.EnableJob(morning.ID, false); disabled == nil || disabled.State.NextRunAtMS != nil {
+		t.Error("Expected a disabled job to have no next run")
+	}
+}
+
+// TestCronRunHistory tests that runs are recorded, trimmed and surfaced as failures
+func TestCronRunHistory(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "cron_store.json")
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	service, err := cron.NewCronServiceWithClock(storePath, fake)
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	service.SetOnJobCallback(func(job *cron.CronJob) (string, error) {
+		if job.Name == "broken" {
+			return "", fmt.Errorf("provider unavailable")
+		}
+		return strings.Repeat("a", 1000), nil
+	})
+
+	schedule := cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *"}
+	working, err := service.AddJob("working", schedule, "Work", false, "", "", false)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	broken, err := service.AddJob("broken", schedule, "Break", false, "", "", false)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+
+	for i := 0; i < 25; i++ {
+		// Give each run its own start time and let it be recorded before the next one starts
+		fake.Advance(time.Second)
+		service.RunJob(working.ID, false)
+		waitForRun(t, service, working.ID, fake.Now())
+	}
+	service.RunJob(broken.ID, false)
+	waitForRun(t, service, broken.ID, fake.Now())
+
+	// Reload from the store to check the history is persisted
+	reloaded, err := cron.NewCronService(storePath)
+	if err != nil {
+		t.Fatalf("Failed to reload cron service: %v", err)
+	}
+	runs := reloaded.GetJob(working.ID).State.Runs
+	if len(runs) != 20 {
+		t.Errorf("Expected the history to keep 20 runs, got %d", len(runs))
+	}
+	if last := runs[len(runs)-1]; last.Status != "ok" || len([]rune(last.Response)) > 510 {
+		t.Errorf("Expected a successful run with a truncated response, got %s with %d characters", last.Status, len(last.Response))
+	}
+	if last := reloaded.GetJob(broken.ID).State.LastRun(); last.Status != "error" || last.Error != "provider unavailable" {
+		t.Errorf("Expected the failure to be recorded, got %+v", last)
+	}
+	if failed, _ := reloaded.Status()["failed_jobs"].([]string); len(failed) != 1 || failed[0] != broken.ID {
+		t.Errorf("Expected the status to list the failing job, got %v", failed)
+	}
+
+	// The status command reads the store without a live service
+	jobs, err := cron.LoadJobs(storePath)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("Expected LoadJobs to read both jobs, got %d: %v", len(jobs), err)
+	}
+	for _, job := range jobs {
+		if failing := job.State.LastRun().Status == "error"; failing != (job.ID == broken.ID) {
+			t.Errorf("Unexpected last run of %s: %+v", job.Name, job.State.LastRun())
+		}
+	}
+	if jobs, err := cron.LoadJobs(filepath.Join(t.TempDir(), "missing.json")); err != nil || len(jobs) != 0 {
+		t.Errorf("Expected a missing store to have no jobs, got %d: %v", len(jobs), err)
+	}
+}
+
+// TestCronCatchUp tests that runs missed while the service was down are made up according to each job's policy
+func TestCronCatchUp(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "cron_store.json")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	service, err := cron.NewCronServiceWithClock(storePath, fake)
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+
+	every := int64(time.Minute / time.Millisecond)
+	schedules := map[string]cron.CronSchedule{
+		"hourly-all":  {Kind: "cron", Expr: "0 * * * *", CatchUp: cron.CatchUpRunAll},
+		"hourly-once": {Kind: "cron", Expr: "0 * * * *", CatchUp: cron.CatchUpRunOnce},
+		"hourly-skip": {Kind: "cron", Expr: "0 * * * *"},
+		"minutely":    {Kind: "every", EveryMS: &every, CatchUp: cron.CatchUpSkip},
+		"reminder":    {Kind: "at", AtMS: start.Add(time.Hour).UnixMilli()},
+	}
+	for name, schedule := range schedules {
+		if _, err := service.AddJob(name, schedule, name, false, "", "", false); err != nil {
+			t.Fatalf("Failed to add job %s: %v", name, err)
+		}
+	}
+	if _, err := service.AddJob("bad", cron.CronSchedule{Kind: "cron", Expr: "0 * * * *", CatchUp: "sometimes"}, "bad", false, "", "", false); err == nil {
+		t.Error("Expected an unknown catch-up policy to be rejected")
+	}
+
+	// The service is down for a little over three hours. Loading and saving the store in
+	// between, as the cron commands do, must not lose or double the missed runs.
+	later := clock.NewFake(start.Add(3*time.Hour + 5*time.Minute))
+	between, err := cron.NewCronServiceWithClock(storePath, later)
+	if err != nil {
+		t.Fatalf("Failed to reload cron service: %v", err)
+	}
+	if _, err := between.AddJob("later", cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *"}, "later", false, "", "", false); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+
+	restarted, err := cron.NewCronServiceWithClock(storePath, later)
+	if err != nil {
+		t.Fatalf("Failed to reload cron service: %v", err)
+	}
+	callback, fired := firedJobs()
+	restarted.SetOnJobCallback(callback)
+	restarted.Start()
+	defer restarted.Stop()
+
+	counts := make(map[string]int)
+	for i := 0; i < 5; i++ {
+		select {
+		case name := <-fired:
+			counts[name]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected 5 catch-up runs, got %v", counts)
+		}
+	}
+	expectQuiet(t, fired, 100*time.Millisecond)
+	if counts["hourly-all"] != 3 || counts["hourly-once"] != 1 || counts["reminder"] != 1 {
+		t.Errorf("Unexpected catch-up runs %v", counts)
+	}
+
+	for _, job := range restarted.ListJobs(true) {
+		if missed := restarted.GetJob(job.ID).State.MissedRuns; missed != 0 {
+			t.Errorf("Expected the missed runs of %s to be cleared, got %d", job.Name, missed)
+		}
+	}
+}
+
+// TestCronCatchUpOneShot tests that a one-shot job that fell due while the service was down runs once on start
+func TestCronCatchUpOneShot(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "cron_store.json")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := fmt.Sprintf(`[{"id":"job_1","name":"reminder","schedule":{"kind":"at","at_ms":%d},"payload":{"message":"Reminder","deliver":false},"state":{},"enabled":true,"delete_after_run":true}]`, start.Add(-time.Hour).UnixMilli())
+	if err := os.WriteFile(storePath, []byte(stored), 0644); err != nil {
+		t.Fatalf("Failed to write store: %v", err)
+	}
+
+	service, err := cron.NewCronServiceWithClock(storePath, clock.NewFake(start))
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	callback, fired := firedJobs()
+	service.SetOnJobCallback(callback)
+	service.Start()
+	defer service.Stop()
+
+	expectFired(t, fired, "reminder", 5*time.Second)
+	expectQuiet(t, fired, 200*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for service.GetJob("job_1") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the one-shot job to be removed after its run")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// blockingJobs returns a job callback that reports each run as it starts and then waits to be released
+func blockingJobs() (func(job *cron.CronJob) (string, error), chan string, chan struct{}) {
+	started := make(chan string, 16)
+	release := make(chan struct{})
+	return func(job *cron.CronJob) (string, error) {
+		started <- job.Name
+		<-release
+		return "Executed", nil
+	}, started, release
+}
+
+// TestCronOverlap tests each overlap policy for a job triggered while its previous run is still going
+func TestCronOverlap(t *testing.T) {
+	for _, policy := range []string{cron.OverlapSkip, cron.OverlapDelay, cron.OverlapAllow} {
+		t.Run(policy, func(t *testing.T) {
+			service, err := cron.NewCronService(filepath.Join(t.TempDir(), "cron_store.json"))
+			if err != nil {
+				t.Fatalf("Failed to create cron service: %v", err)
+			}
+			callback, started, release := blockingJobs()
+			service.SetOnJobCallback(callback)
+
+			job, err := service.AddJob("slow", cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *", Overlap: policy}, "Slow", false, "", "", false)
+			if err != nil {
+				t.Fatalf("Failed to add job: %v", err)
+			}
+			service.RunJob(job.ID, false)
+			expectFired(t, started, "slow", 5*time.Second)
+			service.RunJob(job.ID, false)
+
+			runs := 2
+			switch policy {
+			case cron.OverlapAllow:
+				expectFired(t, started, "slow", 5*time.Second)
+				close(release)
+			case cron.OverlapDelay:
+				expectQuiet(t, started, 100*time.Millisecond)
+				release <- struct{}{}
+				expectFired(t, started, "slow", 5*time.Second)
+				close(release)
+			case cron.OverlapSkip:
+				expectQuiet(t, started, 100*time.Millisecond)
+				close(release)
+				expectQuiet(t, started, 100*time.Millisecond)
+				runs = 1
+			}
+			// Wait for every run to be recorded before the store is cleaned up
+			deadline := time.Now().Add(5 * time.Second)
+			for len(service.GetJob(job.ID).State.Runs) < runs {
+				if time.Now().After(deadline) {
+					t.Fatalf("Expected %d runs to be recorded", runs)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+
+	service, err := cron.NewCronService(filepath.Join(t.TempDir(), "cron_store.json"))
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	if _, err := service.AddJob("bad", cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *", Overlap: "queue"}, "bad", false, "", "", false); err == nil {
+		t.Error("Expected an unknown overlap policy to be rejected")
+	}
+}
+
+// TestCronMaxConcurrent tests that the concurrency limit holds runs of different jobs back
+func TestCronMaxConcurrent(t *testing.T) {
+	service, err := cron.NewCronService(filepath.Join(t.TempDir(), "cron_store.json"))
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	service.SetMaxConcurrent(1)
+	callback, started, release := blockingJobs()
+	service.SetOnJobCallback(callback)
+
+	var ids []string
+	for _, name := range []string{"first", "second"} {
+		job, err := service.AddJob(name, cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *"}, name, false, "", "", false)
+		if err != nil {
+			t.Fatalf("Failed to add job: %v", err)
+		}
+		ids = append(ids, job.ID)
+		service.RunJob(job.ID, false)
+	}
+
+	var first string
+	select {
+	case first = <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a job to start")
+	}
+	expectQuiet(t, started, 100*time.Millisecond)
+
+	release <- struct{}{}
+	second := "second"
+	if first == "second" {
+		second = "first"
+	}
+	expectFired(t, started, second, 5*time.Second)
+	close(release)
+	for _, id := range ids {
+		waitForRun(t, service, id, time.Time{})
+	}
+}
+
+// TestCronUpdateJob tests that updates reschedule a job and leave it alone when invalid
+func TestCronUpdateJob(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	service, err := cron.NewCronServiceWithClock(filepath.Join(t.TempDir(), "cron_store.json"), fake)
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	callback, fired := firedJobs()
+	service.SetOnJobCallback(callback)
+	service.Start()
+	defer service.Stop()
+
+	hourly := int64(time.Hour / time.Millisecond)
+	job, err := service.AddJob("report", cron.CronSchedule{Kind: "every", EveryMS: &hourly, Overlap: cron.OverlapDelay}, "Report", false, "", "", false)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	fake.BlockUntil(1)
+
+	minutely := int64(time.Minute / time.Millisecond)
+	name, message, deliver := "summary", "Summarize", true
+	updated, err := service.UpdateJob(job.ID, cron.JobUpdate{
+		Name:     &name,
+		Message:  &message,
+		Deliver:  &deliver,
+		Schedule: &cron.CronSchedule{Kind: "every", EveryMS: &minutely, Overlap: cron.OverlapDelay},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+	if updated.Name != "summary" || updated.Payload.Message != "Summarize" || !updated.Payload.Deliver {
+		t.Errorf("Unexpected updated job %+v", updated)
+	}
+
+	// Only the new interval is left on the clock, so the hour passes without an extra run
+	fake.BlockUntil(1)
+	for i := 0; i < 60; i++ {
+		fake.Advance(time.Minute)
+		expectFired(t, fired, "summary", 5*time.Second)
+	}
+	expectQuiet(t, fired, 100*time.Millisecond)
+
+	if _, err := service.UpdateJob(job.ID, cron.JobUpdate{Schedule: &cron.CronSchedule{Kind: "cron", Expr: "not a schedule"}}); err == nil {
+		t.Error("Expected an invalid schedule to be rejected")
+	}
+	if current := service.GetJob(job.ID); current.Schedule.Kind != "every" || *current.Schedule.EveryMS != minutely {
+		t.Errorf("Expected a rejected update to leave the schedule alone, got %+v", current.Schedule)
+	}
+	if _, err := service.UpdateJob("job_missing", cron.JobUpdate{Name: &name}); err == nil {
+		t.Error("Expected updating a missing job to fail")
+	}
+}
+
+// TestCronIntervalAnchor tests that interval jobs keep their times across restarts
+func TestCronIntervalAnchor(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "cron_store.json")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	service, err := cron.NewCronServiceWithClock(storePath, fake)
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	callback, fired := firedJobs()
+	service.SetOnJobCallback(callback)
+	service.Start()
+	defer service.Stop()
+
+	hourly := int64(time.Hour / time.Millisecond)
+	job, err := service.AddJob("hourly", cron.CronSchedule{Kind: "every", EveryMS: &hourly}, "Hourly", false, "", "", false)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	fake.BlockUntil(1)
+	fake.Advance(90 * time.Minute)
+	expectFired(t, fired, "hourly", 5*time.Second)
+	waitForRun(t, service, job.ID, start.Add(time.Hour))
+
+	// Restarting half way through an interval keeps the job on the hour
+	later := clock.NewFake(start.Add(90 * time.Minute))
+	restarted, err := cron.NewCronServiceWithClock(storePath, later)
+	if err != nil {
+		t.Fatalf("Failed to reload cron service: %v", err)
+	}
+	restarted.SetOnJobCallback(callback)
+	restarted.Start()
+	defer restarted.Stop()
+	if next := restarted.GetJob(job.ID).State.NextRunAtMS; next == nil || *next != start.Add(2*time.Hour).UnixMilli() {
+		t.Errorf("Expected the next run on the hour, got %v", next)
+	}
+	later.BlockUntil(1)
+	later.Advance(29 * time.Minute)
+	expectQuiet(t, fired, 100*time.Millisecond)
+	later.Advance(time.Minute)
+	expectFired(t, fired, "hourly", 5*time.Second)
+	waitForRun(t, restarted, job.ID, start.Add(2*time.Hour))
+}
+
+// TestCronStartStopTimers tests that interval and one-shot jobs only fire between Start and Stop
+func TestCronStartStopTimers(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	service, err := cron.NewCronServiceWithClock(filepath.Join(t.TempDir(), "cron_store.json"), fake)
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	callback, fired := firedJobs()
+	service.SetOnJobCallback(callback)
+
+	every := int64(time.Minute / time.Millisecond)
+	if _, err := service.AddJob("ticking", cron.CronSchedule{Kind: "every", EveryMS: &every}, "Tick", false, "", "", false); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	if _, err := service.AddJob("reminder", cron.CronSchedule{Kind: "at", AtMS: start.Add(90 * time.Second).UnixMilli()}, "Remind", false, "", "", false); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	fake.Advance(30 * time.Second)
+	expectQuiet(t, fired, 100*time.Millisecond)
+
+	service.Start()
+	fake.BlockUntil(2)
+	service.Stop()
+	fake.Advance(5 * time.Minute)
+	expectQuiet(t, fired, 100*time.Millisecond)
+
+	// Starting again arms the interval; the one-shot's time passed while stopped
+	service.Start()
+	defer service.Stop()
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	expectFired(t, fired, "ticking", 5*time.Second)
+}
+
+// TestCronIntervalAnchorMigration tests that interval jobs stored before anchors keep their phase
+func TestCronIntervalAnchorMigration(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "cron_store.json")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := fmt.Sprintf(`[{"id":"job_1","name":"legacy","schedule":{"kind":"every","every_ms":3600000},"payload":{"message":"Legacy","deliver":false},"state":{"next_run_at_ms":%d},"enabled":true}]`, start.Add(45*time.Minute).UnixMilli())
+	if err := os.WriteFile(storePath, []byte(stored), 0644); err != nil {
+		t.Fatalf("Failed to write store: %v", err)
+	}
+
+	service, err := cron.NewCronServiceWithClock(storePath, clock.NewFake(start))
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	job := service.GetJob("job_1")
+	if job.Schedule.AnchorMS != start.Add(-15*time.Minute).UnixMilli() {
+		t.Errorf("Expected the anchor an interval before the stored next run, got %d", job.Schedule.AnchorMS)
+	}
+	if next := job.State.NextRunAtMS; next == nil || *next != start.Add(45*time.Minute).UnixMilli() {
+		t.Errorf("Expected the stored next run to be kept, got %v", next)
+	}
+}
+
+// TestQuietHours tests quiet hours windows within a day and across midnight
+func TestQuietHours(t *testing.T) {
+	night, err := cron.ParseQuietHours("23:00", "07:00", "UTC")
+	if err != nil {
+		t.Fatalf("Failed to parse quiet hours: %v", err)
+	}
+	lunch, err := cron.ParseQuietHours("12:00", "13:30", "UTC")
+	if err != nil {
+		t.Fatalf("Failed to parse quiet hours: %v", err)
+	}
+
+	at := func(hour, minute int) time.Time { return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		window cron.QuietHours
+		at     time.Time
+		want   time.Duration
+	}{
+		{night, at(23, 30), 7*time.Hour + 30*time.Minute},
+		{night, at(6, 0), time.Hour},
+		{night, at(7, 0), 0},
+		{night, at(12, 0), 0},
+		{lunch, at(12, 45), 45 * time.Minute},
+		{lunch, at(14, 0), 0},
+		{cron.QuietHours{}, at(3, 0), 0},
+	}
+	for _, test := range tests {
+		if got := test.window.Remaining(test.at); got != test.want {
+			t.Errorf("Remaining(%s) = %s, want %s", test.at.Format("15:04"), got, test.want)
+		}
+	}
+
+	if _, err := cron.ParseQuietHours("23:00", "7am", ""); err == nil {
+		t.Error("Expected an invalid end to be rejected")
+	}
+	if _, err := cron.ParseQuietHours("23:00", "23:00", ""); err == nil {
+		t.Error("Expected an empty window to be rejected")
+	}
+	if window, err := cron.ParseQuietHours("", "", ""); err != nil || window.Remaining(at(3, 0)) != 0 {
+		t.Errorf("Expected no window without times, got %v", err)
+	}
+}
+
+// TestCronQuietHoursHoldDeliveries tests that results wait for quiet hours to end, across a restart
+func TestCronQuietHoursHoldDeliveries(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "cron_store.json")
+	night, _ := cron.ParseQuietHours("23:00", "07:00", "UTC")
+	delivered := make(chan string, 4)
+	deliver := func(job *cron.CronJob, response string) error {
+		delivered <- response
+		return nil
+	}
+
+	start := time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC)
+	service, err := cron.NewCronServiceWithClock(storePath, clock.NewFake(start))
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	service.SetQuietHours(night)
+	service.SetOnJobCallback(func(job *cron.CronJob) (string, error) { return "Time to sleep", nil })
+	service.SetOnDeliverCallback(deliver)
+
+	job, err := service.AddJob("late", cron.CronSchedule{Kind: "cron", Expr: "30 23 * * *"}, "Late", true, "42", "telegram", false)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	service.RunJob(job.ID, false)
+	waitForRun(t, service, job.ID, start)
+	expectQuiet(t, delivered, 100*time.Millisecond)
+	service.Stop()
+
+	// The gateway restarts before the morning; the held result goes out when quiet hours end
+	morning := clock.NewFake(start.Add(7 * time.Hour))
+	restarted, err := cron.NewCronServiceWithClock(storePath, morning)
+	if err != nil {
+		t.Fatalf("Failed to reload cron service: %v", err)
+	}
+	if held := restarted.GetJob(job.ID).State.Held; len(held) != 1 {
+		t.Fatalf("Expected the held result to be stored, got %q", held)
+	}
+	restarted.SetQuietHours(night)
+	restarted.SetOnDeliverCallback(deliver)
+	restarted.Start()
+	defer restarted.Stop()
+
+	morning.BlockUntil(1)
+	morning.Advance(29 * time.Minute)
+	expectQuiet(t, delivered, 100*time.Millisecond)
+	morning.Advance(time.Minute)
+	select {
+	case response := <-delivered:
+		if response != "Time to sleep" {
+			t.Errorf("Unexpected delivery %q", response)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the held result to be delivered when quiet hours end")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(restarted.GetJob(job.ID).State.Held) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the delivered result to be cleared")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestCronJitter tests that jitter delays scheduled runs by at most its length
+func TestCronJitter(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	service, err := cron.NewCronServiceWithClock(filepath.Join(t.TempDir(), "cron_store.json"), fake)
+	if err != nil {
+		t.Fatalf("Failed to create cron service: %v", err)
+	}
+	callback, fired := firedJobs()
+	service.SetOnJobCallback(callback)
+	service.Start()
+	defer service.Stop()
+
+	every := int64(time.Minute / time.Millisecond)
+	jitter := int64(30 * time.Second / time.Millisecond)
+	job, err := service.AddJob("jittery", cron.CronSchedule{Kind: "every", EveryMS: &every, JitterMS: jitter}, "Jitter", false, "", "", false)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	if _, err := service.AddJob("bad", cron.CronSchedule{Kind: "every", EveryMS: &every, JitterMS: -1}, "Bad", false, "", "", false); err == nil {
+		t.Error("Expected a negative jitter to be rejected")
+	}
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	// The next interval's timer and the jitter's sleep
+	fake.BlockUntil(2)
+	fake.Advance(30 * time.Second)
+	expectFired(t, fired, "jittery", 5*time.Second)
+	waitForRun(t, service, job.ID, time.Time{})
+}
@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"nanotalon/clock"
 	"nanotalon/heartbeat"
 	"nanotalon/providers"
 )
@@ -110,4 +113,59 @@ func TestHeartbeatFunctionality(t *testing.T) {
 	}
 
 	t.Logf("✓ Heartbeat functionality test completed")
-}
\ No newline at end of file
+}
+// TestHeartbeatWithFakeClock verifies the heartbeat interval is driven by the injected clock
+func TestHeartbeatWithFakeClock(t *testing.T) {
+	tempDir := t.TempDir()
+	memoryDir := filepath.Join(tempDir, "memory")
+	if err := os.MkdirAll(memoryDir, 0755); err != nil {
+		t.Fatalf("Failed to create memory directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(memoryDir, "MEMORY.md"), []byte("# Heartbeat\n- Check backups\n"), 0644); err != nil {
+		t.Fatalf("Failed to write MEMORY.md: %v", err)
+	}
+
+	executed := make(chan string, 10)
+	service := heartbeat.NewService(
+		tempDir,
+		nil,
+		"test-model",
+		func(tasks string) (string, error) {
+			executed <- tasks
+			return "", nil
+		},
+		nil,
+		60,
+		true,
+	)
+
+	fake := clock.NewFake(time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC))
+	service.SetClock(fake)
+
+	if err := service.Start(); err != nil {
+		t.Fatalf("Failed to start heartbeat service: %v", err)
+	}
+	defer service.Stop()
+
+	// The heartbeat runs once immediately on startup
+	if tasks := <-executed; tasks != "- Check backups" {
+		t.Errorf("Unexpected heartbeat tasks: %q", tasks)
+	}
+
+	// Nothing else fires until the clock moves past the interval
+	fake.BlockUntil(1)
+	fake.Advance(59 * time.Second)
+	select {
+	case <-executed:
+		t.Fatal("Heartbeat fired before the interval elapsed")
+	default:
+	}
+
+	fake.Advance(1 * time.Second)
+	select {
+	case <-executed:
+		t.Logf("✓ Heartbeat fired after advancing the fake clock")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Heartbeat did not fire after the interval elapsed")
+	}
+}
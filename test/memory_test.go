@@ -1,9 +1,23 @@
 package test
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 	"nanotalon/agent/memory"
+	"nanotalon/config"
+	"nanotalon/providers"
+	"nanotalon/session"
 )
 
 // TestMemoryFunctionality performs functional tests for the memory functionality
@@ -147,10 +161,853 @@ Features: Chat channels, scheduling, memory, tools
 	t.Logf("✓ Memory context functionality test completed")
 }
 
+// keywordEmbeddings is a deterministic embeddings provider with one dimension per keyword
+type keywordEmbeddings struct {
+	keywords []string
+	model    string
+	calls    int
+	embedded []string
+}
+
+func (k *keywordEmbeddings) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	k.calls++
+	k.embedded = append(k.embedded, texts...)
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float64, len(k.keywords))
+		for j, keyword := range k.keywords {
+			vectors[i][j] = float64(strings.Count(strings.ToLower(text), keyword))
+		}
+	}
+	return vectors, nil
+}
+
+func (k *keywordEmbeddings) GetModel() string {
+	if k.model == "" {
+		return "keywords"
+	}
+	return k.model
+}
+
+// TestSemanticMemorySearch checks that long-term memory and history are chunked, embedded
+// and ranked by similarity to the query
+func TestSemanticMemorySearch(t *testing.T) {
+	embeddings := &keywordEmbeddings{keywords: []string{"birthday", "coffee", "golang"}}
+	store, err := memory.NewSemanticMemoryStore(t.TempDir(), embeddings)
+	if err != nil {
+		t.Fatalf("Failed to create semantic memory store: %v", err)
+	}
+	defer store.Close()
+
+	longTerm := "# Preferences\n\nAlice's birthday is on March 3rd; she likes a birthday cake.\n\n" +
+		"Alice drinks her coffee black.\n\nThe weather was nice."
+	if err := store.WriteLongTerm(longTerm); err != nil {
+		t.Fatalf("Failed to write long-term memory: %v", err)
+	}
+
+	results, err := store.SearchMemory(context.Background(), "When is the birthday?", 5)
+	if err != nil {
+		t.Fatalf("SearchMemory failed: %v", err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Segment, "March 3rd") {
+		t.Fatalf("Expected only the birthday paragraph, got %+v", results)
+	}
+	if embeddings.calls != 1 {
+		t.Errorf("Expected the query and segments to be embedded in one request, got %d", embeddings.calls)
+	}
+
+	// History entries are searched too, not just long-term memory
+	for _, entry := range []string{"User asked about golang generics", "User ordered coffee beans", "User asked for coffee and golang tips"} {
+		if err := store.AppendHistory(entry); err != nil {
+			t.Fatalf("Failed to append history: %v", err)
+		}
+	}
+
+	results, err = store.SearchHistory(context.Background(), "coffee", 0)
+	if err != nil {
+		t.Fatalf("SearchHistory failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected two coffee entries, got %+v", results)
+	}
+	if !strings.Contains(results[0].Segment, "coffee beans") {
+		t.Errorf("Expected the entry only about coffee to rank first, got %q", results[0].Segment)
+	}
+
+	results, err = store.SearchHistory(context.Background(), "coffee", 1)
+	if err != nil || len(results) != 1 {
+		t.Errorf("Expected the limit to apply, got %+v (err %v)", results, err)
+	}
+}
+
+// TestSemanticMemoryIndex checks that the index only embeds new chunks, filters by source
+// and date, and is rebuilt when the embedding model changes
+func TestSemanticMemoryIndex(t *testing.T) {
+	workspace := t.TempDir()
+	embeddings := &keywordEmbeddings{keywords: []string{"birthday", "coffee"}}
+	store, err := memory.NewSemanticMemoryStore(workspace, embeddings)
+	if err != nil {
+		t.Fatalf("Failed to create semantic memory store: %v", err)
+	}
+
+	if err := store.WriteLongTerm("Bob's birthday is in May.\n\nBob likes coffee."); err != nil {
+		t.Fatalf("Failed to write long-term memory: %v", err)
+	}
+	history := "[2025-01-10 09:00:00] Talked about coffee grinders\n\n[2025-03-02 18:30:00] Planned the birthday dinner\n\n"
+	if err := os.WriteFile(filepath.Join(workspace, "memory", "HISTORY.md"), []byte(history), 0644); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+
+	// The first search embeds every chunk of both sources plus the query
+	results, err := store.Search(context.Background(), "birthday", memory.SearchFilter{}, 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 || len(embeddings.embedded) != 5 {
+		t.Fatalf("Expected 2 results after embedding 5 texts, got %+v after %d", results, len(embeddings.embedded))
+	}
+
+	// Later searches only embed the query
+	embeddings.embedded = nil
+	if _, err := store.Search(context.Background(), "coffee", memory.SearchFilter{}, 0); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(embeddings.embedded) != 1 {
+		t.Errorf("Expected only the query to be embedded, got %q", embeddings.embedded)
+	}
+
+	// An appended entry is indexed on its own
+	embeddings.embedded = nil
+	if err := store.AppendHistory("Ordered a birthday present"); err != nil {
+		t.Fatalf("Failed to append history: %v", err)
+	}
+	if len(embeddings.embedded) != 1 || !strings.Contains(embeddings.embedded[0], "birthday present") {
+		t.Errorf("Expected only the new entry to be embedded, got %q", embeddings.embedded)
+	}
+
+	// Date filters leave out undated long-term memory and older history
+	results, err = store.Search(context.Background(), "birthday", memory.SearchFilter{
+		Since: time.Date(2025, 2, 1, 0, 0, 0, 0, time.Local),
+		Until: time.Date(2025, 4, 1, 0, 0, 0, 0, time.Local),
+	}, 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Source != memory.SourceHistory || !strings.Contains(results[0].Segment, "dinner") {
+		t.Fatalf("Expected only the March history entry, got %+v", results)
+	}
+	if want := time.Date(2025, 3, 2, 18, 30, 0, 0, time.Local); !results[0].Date.Equal(want) {
+		t.Errorf("Expected the entry's date %v, got %v", want, results[0].Date)
+	}
+
+	// Edited memory drops the old chunk from the index
+	if err := store.WriteLongTerm("Bob likes coffee."); err != nil {
+		t.Fatalf("Failed to write long-term memory: %v", err)
+	}
+	results, err = store.SearchMemory(context.Background(), "birthday", 0)
+	if err != nil || len(results) != 0 {
+		t.Errorf("Expected the removed paragraph to be gone, got %+v (err %v)", results, err)
+	}
+	store.Close()
+
+	// Reopening with the same model keeps the index
+	embeddings.embedded = nil
+	store, err = memory.NewSemanticMemoryStore(workspace, embeddings)
+	if err != nil {
+		t.Fatalf("Failed to reopen semantic memory store: %v", err)
+	}
+	if _, err := store.Search(context.Background(), "coffee", memory.SearchFilter{}, 0); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(embeddings.embedded) != 1 {
+		t.Errorf("Expected the index to survive a restart, embedded %q", embeddings.embedded)
+	}
+	store.Close()
+
+	// A new model makes the old vectors useless, so everything is embedded again
+	embeddings.model = "keywords-v2"
+	embeddings.embedded = nil
+	store, err = memory.NewSemanticMemoryStore(workspace, embeddings)
+	if err != nil {
+		t.Fatalf("Failed to reopen semantic memory store: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.Search(context.Background(), "coffee", memory.SearchFilter{}, 0); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(embeddings.embedded) != 5 {
+		t.Errorf("Expected a rebuild to embed 4 chunks and the query, embedded %q", embeddings.embedded)
+	}
+}
+
+// TestKnowledgeBase checks that documents in the knowledge directory are ingested,
+// re-ingested when they change and forgotten when deleted
+func TestKnowledgeBase(t *testing.T) {
+	workspace := t.TempDir()
+	embeddings := &keywordEmbeddings{keywords: []string{"warranty", "recipe"}}
+	// Stand in for pdftotext so the test doesn't depend on it
+	kb, err := memory.NewKnowledgeBase(workspace, embeddings, "cat {file}")
+	if err != nil {
+		t.Fatalf("Failed to create knowledge base: %v", err)
+	}
+	defer kb.Close()
+
+	// An empty knowledge base doesn't embed the query
+	results, err := kb.Search(context.Background(), "warranty", 5)
+	if err != nil || len(results) != 0 || embeddings.calls != 0 {
+		t.Fatalf("Expected no results and no embedding calls, got %+v (%d calls, err %v)", results, embeddings.calls, err)
+	}
+
+	write := func(name, content string) {
+		path := filepath.Join(workspace, "knowledge", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	write("manuals/dishwasher.pdf", "The warranty lasts two years.\n\nClean the filter monthly.")
+	write("cooking.md", "# Pancakes\n\nA recipe for pancakes.")
+	write("notes.txt", "Nothing relevant here.")
+	write("photo.jpg", "warranty warranty")
+	write(".drafts/secret.md", "warranty draft")
+
+	results, err = kb.Search(context.Background(), "warranty", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Source != "manuals/dishwasher.pdf" || !strings.Contains(results[0].Segment, "two years") {
+		t.Fatalf("Expected the warranty paragraph of the PDF, got %+v", results)
+	}
+
+	// Unchanged documents aren't embedded again
+	embeddings.embedded = nil
+	if _, err := kb.Search(context.Background(), "recipe", 5); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(embeddings.embedded) != 1 {
+		t.Errorf("Expected only the query to be embedded, got %q", embeddings.embedded)
+	}
+
+	// A changed document is re-ingested and a deleted one forgotten
+	write("cooking.md", "A recipe for waffles, with a warranty of deliciousness.")
+	if err := os.Remove(filepath.Join(workspace, "knowledge", "manuals", "dishwasher.pdf")); err != nil {
+		t.Fatalf("Failed to remove document: %v", err)
+	}
+	results, err = kb.Search(context.Background(), "warranty", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Source != "cooking.md" || !strings.Contains(results[0].Segment, "waffles") {
+		t.Fatalf("Expected only the updated recipe, got %+v", results)
+	}
+}
+
+// TestOpenAIEmbeddings checks the request sent to an OpenAI-compatible /embeddings endpoint
+// and that vectors come back in input order
+func TestOpenAIEmbeddings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Unexpected Authorization header %q", got)
+		}
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.Model != "text-embedding-3-small" {
+			t.Errorf("Expected the provider prefix to be stripped, got model %q", req.Model)
+		}
+
+		// Reply out of order; the index says where each vector belongs
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.Memory.Embeddings.Model = "openai/text-embedding-3-small"
+	cfg.Providers.OpenAI = config.ProviderConfig{APIKey: "sk-test", APIBase: server.URL}
+
+	embeddings, err := providers.EmbeddingsFactory(cfg)
+	if err != nil {
+		t.Fatalf("EmbeddingsFactory failed: %v", err)
+	}
+
+	vectors, err := embeddings.Embed(context.Background(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("Expected vectors in input order, got %v", vectors)
+	}
+
+	cfg.Memory.Embeddings.Model = ""
+	if _, err := providers.EmbeddingsFactory(cfg); err == nil {
+		t.Error("Expected an error without an embedding model")
+	}
+}
+
 // Helper function to truncate string
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
 	}
 	return s[:maxLen] + "..."
-}
\ No newline at end of file
+}
+// TestMemoryScopes checks that chats only see the memory scopes they are allowed to read
+func TestMemoryScopes(t *testing.T) {
+	workspace := t.TempDir()
+	scopes := memory.NewScopes(workspace)
+
+	work := scopes.View("slack", "C01", memory.TierChannel, []string{memory.TierGlobal})
+	family := scopes.View("telegram", "42", memory.TierChat, []string{memory.TierGlobal})
+	if work.Write.Name != "channel:slack" || family.Write.Name != "chat:telegram:42" {
+		t.Fatalf("Unexpected write scopes %q and %q", work.Write.Name, family.Write.Name)
+	}
+	if len(work.Read) != 2 || work.Read[0].Name != memory.TierGlobal || work.Read[1].Name != "channel:slack" {
+		t.Errorf("Expected global then channel memory to be read, got %+v", work.Read)
+	}
+	if work.Key() == family.Key() {
+		t.Errorf("Expected different views to have different keys, both are %q", work.Key())
+	}
+	if work.Read[0].Dir != filepath.Join(workspace, "memory") {
+		t.Errorf("Expected global memory in workspace/memory, got %s", work.Read[0].Dir)
+	}
+
+	// Chat IDs that aren't safe file names still get their own directory
+	odd := scopes.Scope(memory.TierChat, "matrix", "!room:example.org")
+	other := scopes.Scope(memory.TierChat, "matrix", "_room_example.org")
+	if odd.Dir == other.Dir || filepath.Dir(odd.Dir) != filepath.Join(workspace, "memory", "scopes", "matrix", "chats") {
+		t.Errorf("Unexpected chat scope directories %s and %s", odd.Dir, other.Dir)
+	}
+
+	workFacts, err := scopes.Facts(work.Write)
+	if err != nil {
+		t.Fatalf("Failed to load facts: %v", err)
+	}
+	if _, _, err := workFacts.Assert(memory.Fact{Subject: "Alice", Predicate: "role", Value: "manager", Confidence: 1}, true); err != nil {
+		t.Fatalf("Failed to assert fact: %v", err)
+	}
+	familyFacts, err := scopes.Facts(family.Write)
+	if err != nil {
+		t.Fatalf("Failed to load facts: %v", err)
+	}
+	if facts := familyFacts.Query(memory.FactQuery{Subject: "Alice"}); len(facts) != 0 {
+		t.Errorf("Expected no work facts in the family chat, got %+v", facts)
+	}
+
+	// Stores are shared between views of the same scope and persisted in its directory
+	again, _ := scopes.Facts(scopes.Scope(memory.TierChannel, "slack", "C02"))
+	if again != workFacts {
+		t.Errorf("Expected chats of one channel to share its fact store")
+	}
+	if _, err := os.Stat(filepath.Join(work.Write.Dir, "facts.json")); err != nil {
+		t.Errorf("Expected facts in the scope directory: %v", err)
+	}
+}
+
+// TestHistoryRotation checks that a large HISTORY.md is rotated into monthly archives
+// and that semantic search still finds archived entries without embedding them again
+func TestHistoryRotation(t *testing.T) {
+	workspace := t.TempDir()
+	embeddings := &keywordEmbeddings{keywords: []string{"birthday", "coffee", "garden"}}
+	store, err := memory.NewSemanticMemoryStore(workspace, embeddings)
+	if err != nil {
+		t.Fatalf("Failed to create semantic memory store: %v", err)
+	}
+	defer store.Close()
+
+	history := "# History\n\n" +
+		"[2025-01-10 09:00:00] Talked about coffee grinders\n\n" +
+		"[2025-01-20 10:00:00] Bought coffee beans\n\n" +
+		"[2025-02-03 18:30:00] Planned the birthday dinner\n\n"
+	historyPath := filepath.Join(workspace, "memory", "HISTORY.md")
+	if err := os.WriteFile(historyPath, []byte(history), 0644); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+	if _, err := store.SearchHistory(context.Background(), "coffee", 0); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	// Appending past the limit keeps the newest entries hot and archives the rest by month
+	embeddings.embedded = nil
+	store.SetHistoryLimits(int64(len(history)), 60)
+	if err := store.AppendHistory("Weeded the garden"); err != nil {
+		t.Fatalf("Failed to append history: %v", err)
+	}
+
+	months, err := store.HistoryArchives()
+	if err != nil || len(months) != 2 || months[0] != "2025-01" || months[1] != "2025-02" {
+		t.Fatalf("Expected archives for 2025-01 and 2025-02, got %v (err %v)", months, err)
+	}
+	hot, _ := store.ReadHistory()
+	if !strings.HasPrefix(hot, "# History\n\n") || !strings.Contains(hot, "garden") || strings.Contains(hot, "coffee") || strings.Contains(hot, "birthday") {
+		t.Errorf("Expected only the heading and newest entry in HISTORY.md, got %q", hot)
+	}
+	january, _ := store.ReadHistoryArchive("2025-01")
+	if !strings.Contains(january, "coffee grinders") || !strings.Contains(january, "coffee beans") {
+		t.Errorf("Expected both January entries in the January archive, got %q", january)
+	}
+
+	// Archived entries keep their vectors; only the new entry is embedded
+	if len(embeddings.embedded) != 1 || !strings.Contains(embeddings.embedded[0], "garden") {
+		t.Errorf("Expected only the new entry to be embedded, got %q", embeddings.embedded)
+	}
+
+	results, err := store.SearchHistory(context.Background(), "birthday", 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Source != memory.HistoryArchiveSource("2025-02") || !strings.Contains(results[0].Segment, "dinner") {
+		t.Errorf("Expected the archived February entry, got %+v", results)
+	}
+
+	// A deleted archive drops out of search
+	if err := os.Remove(filepath.Join(workspace, "memory", "HISTORY-2025-02.md")); err != nil {
+		t.Fatalf("Failed to delete archive: %v", err)
+	}
+	results, err = store.SearchHistory(context.Background(), "birthday", 0)
+	if err != nil || len(results) != 0 {
+		t.Errorf("Expected no results from a deleted archive, got %+v (err %v)", results, err)
+	}
+}
+
+// TestMemoryForget checks that forgetting removes matching memory lines and history
+// entries, archived ones included, and that Find only previews them
+func TestMemoryForget(t *testing.T) {
+	workspace := t.TempDir()
+	store := memory.NewMemoryStore(workspace)
+	memoryDir := filepath.Join(workspace, "memory")
+
+	if err := store.WriteLongTerm("# Memory\n- Lives at 12 Elm St\n- Likes tea\n"); err != nil {
+		t.Fatalf("Failed to write long-term memory: %v", err)
+	}
+	archive := "[2025-01-10 09:00:00] Moved to 12 elm st\n\n"
+	if err := os.WriteFile(filepath.Join(memoryDir, "HISTORY-2025-01.md"), []byte(archive), 0644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	history := "# History\n\n[2025-02-10 09:00:00] Tea tasting\n\n[2025-02-11 09:00:00] Mail for Elm St\n\n"
+	if err := os.WriteFile(filepath.Join(memoryDir, "HISTORY.md"), []byte(history), 0644); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+
+	matches, err := store.Find("ELM ST")
+	if err != nil || len(matches) != 3 {
+		t.Fatalf("Expected 3 matches, got %+v (err %v)", matches, err)
+	}
+	if longTerm, _ := store.ReadLongTerm(); !strings.Contains(longTerm, "Elm St") {
+		t.Errorf("Expected Find to leave memory untouched, got %q", longTerm)
+	}
+
+	matches, err = store.Forget("elm st")
+	if err != nil || len(matches) != 3 {
+		t.Fatalf("Expected 3 entries forgotten, got %+v (err %v)", matches, err)
+	}
+	if matches[0].File != "MEMORY.md" || matches[1].File != "HISTORY-2025-01.md" || matches[2].File != "HISTORY.md" {
+		t.Errorf("Unexpected files of forgotten entries: %+v", matches)
+	}
+	if longTerm, _ := store.ReadLongTerm(); longTerm != "# Memory\n- Likes tea\n" {
+		t.Errorf("Expected only the matching line removed, got %q", longTerm)
+	}
+	if hot, _ := store.ReadHistory(); hot != "# History\n\n[2025-02-10 09:00:00] Tea tasting\n\n" {
+		t.Errorf("Expected only the matching entry removed, got %q", hot)
+	}
+	if months, _ := store.HistoryArchives(); len(months) != 0 {
+		t.Errorf("Expected the emptied archive to be removed, got %v", months)
+	}
+}
+
+// TestForgetEverywhere checks that forgetting reaches memory and facts of every scope, the
+// search index and session transcripts, and that a dry run changes nothing
+func TestForgetEverywhere(t *testing.T) {
+	workspace := t.TempDir()
+	scopes := memory.NewScopes(workspace)
+	sessions := session.NewSessionManager(workspace)
+	defer sessions.Close()
+
+	embeddings := &keywordEmbeddings{keywords: []string{"elm", "tea"}}
+	store, err := memory.NewSemanticMemoryStore(workspace, embeddings)
+	if err != nil {
+		t.Fatalf("Failed to create semantic memory store: %v", err)
+	}
+	if err := store.WriteLongTerm("- Lives at 12 Elm St\n\n- Likes tea\n"); err != nil {
+		t.Fatalf("Failed to write long-term memory: %v", err)
+	}
+	if _, err := store.SearchMemory(context.Background(), "elm", 0); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	store.Close()
+
+	chat := memory.NewMemoryStoreAt(scopes.Scope(memory.TierChat, "telegram", "42").Dir)
+	if err := chat.AppendHistory("Sent a parcel to 12 Elm St"); err != nil {
+		t.Fatalf("Failed to append history: %v", err)
+	}
+	facts, err := scopes.Facts(scopes.Scope(memory.TierChannel, "telegram", "42"))
+	if err != nil {
+		t.Fatalf("Failed to load facts: %v", err)
+	}
+	if _, _, err := facts.Assert(memory.Fact{Subject: "user", Predicate: "address", Value: "12 Elm St", Confidence: 1}, true); err != nil {
+		t.Fatalf("Failed to assert fact: %v", err)
+	}
+	if err := sessions.SaveMessage("telegram:42", "user", "My address is 12 elm st, remember it"); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+	if err := sessions.SaveMessage("telegram:42", "assistant", "Noted"); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+
+	preview, err := scopes.Forget(sessions, "12 Elm St", true)
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if len(preview.Memory) != 2 || len(preview.Facts) != 1 || preview.Chunks != 1 || len(preview.Sessions) != 1 {
+		t.Fatalf("Unexpected dry run report: %+v", preview)
+	}
+	if history, _ := chat.ReadHistory(); !strings.Contains(history, "Elm St") {
+		t.Errorf("Expected the dry run to leave history untouched, got %q", history)
+	}
+	if len(facts.Query(memory.FactQuery{})) != 1 {
+		t.Errorf("Expected the dry run to leave facts untouched")
+	}
+
+	report, err := scopes.Forget(sessions, "12 Elm St", false)
+	if err != nil {
+		t.Fatalf("Forget failed: %v", err)
+	}
+	if len(report.Memory) != 2 || len(report.Facts) != 1 || report.Chunks != 1 || len(report.Sessions) != 1 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if report.Memory[0].File != filepath.Join("memory", "MEMORY.md") {
+		t.Errorf("Expected files relative to the workspace, got %+v", report.Memory)
+	}
+	if again, _ := scopes.Forget(sessions, "12 Elm St", true); !again.Empty() {
+		t.Errorf("Expected nothing left to forget, got %+v", again)
+	}
+
+	// The transcript keeps its messages, with the text replaced
+	reopened := session.NewSessionManager(workspace)
+	defer reopened.Close()
+	messages, err := reopened.GetMessageHistory("telegram:42", 10)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %+v (err %v)", messages, err)
+	}
+	if messages[0].Content != "My address is "+session.RedactedText+", remember it" {
+		t.Errorf("Unexpected redacted message %q", messages[0].Content)
+	}
+}
+
+// fakeVectorStore is an in-memory VectorStore that filters like the real backends
+type fakeVectorStore struct {
+	docs       map[string]memory.VectorDocument
+	upserts    int
+	queries    int
+	cleared    []string
+	failUpsert bool
+	closed     bool
+}
+
+func newFakeVectorStore() *fakeVectorStore {
+	return &fakeVectorStore{docs: make(map[string]memory.VectorDocument)}
+}
+
+func (f *fakeVectorStore) Name() string { return "fake" }
+
+func (f *fakeVectorStore) Upsert(ctx context.Context, docs []memory.VectorDocument) error {
+	if f.failUpsert {
+		return fmt.Errorf("store unavailable")
+	}
+	f.upserts += len(docs)
+	for _, doc := range docs {
+		f.docs[doc.ID] = doc
+	}
+	return nil
+}
+
+func (f *fakeVectorStore) Query(ctx context.Context, vector []float64, filter memory.VectorFilter, limit int) ([]memory.VectorMatch, error) {
+	f.queries++
+	var matches []memory.VectorMatch
+	for _, doc := range f.docs {
+		if doc.Namespace != filter.Namespace {
+			continue
+		}
+		if len(filter.Sources) > 0 && !slices.Contains(filter.Sources, doc.Source) {
+			continue
+		}
+		if !filter.Since.IsZero() && doc.Date < filter.Since.UnixMilli() {
+			continue
+		}
+		if !filter.Until.IsZero() && (doc.Date == 0 || doc.Date >= filter.Until.UnixMilli()) {
+			continue
+		}
+		var dot, a, b float64
+		for i := range vector {
+			dot += vector[i] * doc.Vector[i]
+			a += vector[i] * vector[i]
+			b += doc.Vector[i] * doc.Vector[i]
+		}
+		if a > 0 && b > 0 {
+			matches = append(matches, memory.VectorMatch{ID: doc.ID, Score: dot / math.Sqrt(a*b)})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func (f *fakeVectorStore) Delete(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		delete(f.docs, id)
+	}
+	return nil
+}
+
+func (f *fakeVectorStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	f.cleared = append(f.cleared, namespace)
+	for id, doc := range f.docs {
+		if doc.Namespace == namespace {
+			delete(f.docs, id)
+		}
+	}
+	return nil
+}
+
+func (f *fakeVectorStore) Close() error {
+	f.closed = true
+	return nil
+}
+
+// TestMemoryIndexVectorStore checks that an attached vector store is filled from the index,
+// kept in step with it, searched in its place, and refilled after changes it missed
+func TestMemoryIndexVectorStore(t *testing.T) {
+	workspace := t.TempDir()
+	embeddings := &keywordEmbeddings{keywords: []string{"birthday", "coffee"}}
+	store, err := memory.NewSemanticMemoryStore(workspace, embeddings)
+	if err != nil {
+		t.Fatalf("Failed to create semantic memory store: %v", err)
+	}
+
+	if err := store.WriteLongTerm("Bob's birthday is in May.\n\nBob likes coffee."); err != nil {
+		t.Fatalf("Failed to write long-term memory: %v", err)
+	}
+	history := "[2025-01-10 09:00:00] Talked about coffee grinders\n\n[2025-03-02 18:30:00] Planned the birthday dinner\n\n"
+	if err := os.WriteFile(filepath.Join(workspace, "memory", "HISTORY.md"), []byte(history), 0644); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+	if _, err := store.Search(context.Background(), "birthday", memory.SearchFilter{}, 0); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	// Attaching sends the chunks already indexed, in the index's own namespace
+	vectors := newFakeVectorStore()
+	if err := store.UseVectorStore(vectors); err != nil {
+		t.Fatalf("Failed to attach vector store: %v", err)
+	}
+	if len(vectors.docs) != 4 || len(vectors.cleared) != 1 {
+		t.Fatalf("Expected the 4 indexed chunks after clearing the namespace, got %d docs, cleared %v", len(vectors.docs), vectors.cleared)
+	}
+	namespace := vectors.cleared[0]
+	for _, doc := range vectors.docs {
+		if doc.Namespace != namespace || !strings.HasPrefix(doc.ID, namespace+"|") {
+			t.Errorf("Expected every document in namespace %q, got %+v", namespace, doc)
+		}
+	}
+
+	// Searches go to the store, with the filter, and come back with the chunks' text
+	results, err := store.Search(context.Background(), "birthday", memory.SearchFilter{
+		Since: time.Date(2025, 2, 1, 0, 0, 0, 0, time.Local),
+	}, 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if vectors.queries != 1 {
+		t.Errorf("Expected the search to query the store once, got %d", vectors.queries)
+	}
+	if len(results) != 1 || results[0].Source != memory.SourceHistory || !strings.Contains(results[0].Segment, "dinner") {
+		t.Fatalf("Expected only the March history entry, got %+v", results)
+	}
+	if want := time.Date(2025, 3, 2, 18, 30, 0, 0, time.Local); !results[0].Date.Equal(want) {
+		t.Errorf("Expected the entry's date %v, got %v", want, results[0].Date)
+	}
+
+	// New and removed chunks reach the store
+	if err := store.AppendHistory("Ordered a birthday present"); err != nil {
+		t.Fatalf("Failed to append history: %v", err)
+	}
+	if err := store.WriteLongTerm("Bob likes coffee."); err != nil {
+		t.Fatalf("Failed to write long-term memory: %v", err)
+	}
+	results, err = store.SearchMemory(context.Background(), "birthday", 0)
+	if err != nil || len(results) != 0 {
+		t.Errorf("Expected the removed paragraph to be gone, got %+v (err %v)", results, err)
+	}
+	if len(vectors.docs) != 4 {
+		t.Errorf("Expected 4 documents after adding one chunk and removing one, got %d", len(vectors.docs))
+	}
+	store.Close()
+	if !vectors.closed {
+		t.Error("Expected closing the store to close the vector store")
+	}
+
+	// A store that is already up to date isn't filled again
+	store, err = memory.NewSemanticMemoryStore(workspace, embeddings)
+	if err != nil {
+		t.Fatalf("Failed to reopen semantic memory store: %v", err)
+	}
+	upserts := vectors.upserts
+	if err := store.UseVectorStore(vectors); err != nil {
+		t.Fatalf("Failed to attach vector store: %v", err)
+	}
+	if vectors.upserts != upserts || len(vectors.cleared) != 1 {
+		t.Errorf("Expected no refill, got %d more upserts and cleared %v", vectors.upserts-upserts, vectors.cleared)
+	}
+	store.Close()
+
+	// Forgetting without the store leaves it stale, so the next attach refills it
+	index, err := memory.OpenMemoryIndex(filepath.Join(workspace, "memory", "index", "memory.db"), "")
+	if err != nil {
+		t.Fatalf("Failed to open memory index: %v", err)
+	}
+	if n, err := index.Forget("grinders", false); err != nil || n != 1 {
+		t.Fatalf("Expected one chunk forgotten, got %d (err %v)", n, err)
+	}
+	index.Close()
+
+	store, err = memory.NewSemanticMemoryStore(workspace, embeddings)
+	if err != nil {
+		t.Fatalf("Failed to reopen semantic memory store: %v", err)
+	}
+	defer store.Close()
+	if err := store.UseVectorStore(vectors); err != nil {
+		t.Fatalf("Failed to attach vector store: %v", err)
+	}
+	if len(vectors.cleared) != 2 || len(vectors.docs) != 3 {
+		t.Errorf("Expected a refill with 3 documents, got %d, cleared %v", len(vectors.docs), vectors.cleared)
+	}
+
+	// A failed update drops the store and searches go back to the index
+	vectors.failUpsert = true
+	vectors.queries = 0
+	if err := store.AppendHistory("Bought coffee for the birthday"); err != nil {
+		t.Fatalf("Failed to append history: %v", err)
+	}
+	results, err = store.SearchHistory(context.Background(), "coffee", 0)
+	if err != nil || !slices.ContainsFunc(results, func(r memory.MemorySearchResult) bool {
+		return strings.Contains(r.Segment, "Bought coffee")
+	}) {
+		t.Errorf("Expected the new entry from the index, got %+v (err %v)", results, err)
+	}
+	if vectors.queries != 0 {
+		t.Errorf("Expected the stale store not to be queried, got %d queries", vectors.queries)
+	}
+}
+
+// TestQdrantVectorStore checks the Qdrant requests for creating the collection, upserting,
+// filtered search and deletes, and that a missing collection reads as empty
+func TestQdrantVectorStore(t *testing.T) {
+	var requests []string
+	var bodies []map[string]interface{}
+	created := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("api-key") != "secret" {
+			t.Errorf("Expected the API key header, got %q", r.Header.Get("api-key"))
+		}
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/collections/mem":
+			created = true
+		case !created:
+			http.Error(w, `{"status":{"error":"Not found"}}`, http.StatusNotFound)
+			return
+		case r.URL.Path == "/collections/mem/points/search":
+			w.Write([]byte(`{"result":[{"id":"x","score":0.9,"payload":{"doc_id":"ns|history|abc"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"result":{}}`))
+	}))
+	defer server.Close()
+
+	vectors, err := memory.NewVectorStore(config.VectorStoreConfig{Backend: "qdrant", URL: server.URL + "/", APIKey: "secret", Collection: "mem"})
+	if err != nil {
+		t.Fatalf("Failed to create vector store: %v", err)
+	}
+	defer vectors.Close()
+	ctx := context.Background()
+
+	// Before anything is stored, queries and deletes find nothing
+	if matches, err := vectors.Query(ctx, []float64{1, 0}, memory.VectorFilter{Namespace: "ns"}, 5); err != nil || len(matches) != 0 {
+		t.Fatalf("Expected no matches without a collection, got %+v (err %v)", matches, err)
+	}
+	if err := vectors.DeleteNamespace(ctx, "ns"); err != nil {
+		t.Fatalf("Expected deleting from a missing collection to succeed, got %v", err)
+	}
+
+	requests, bodies = nil, nil
+	if err := vectors.Upsert(ctx, []memory.VectorDocument{{ID: "ns|history|abc", Namespace: "ns", Source: "history", Date: 1000, Vector: []float64{1, 0}}}); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	if len(requests) != 3 || requests[0] != "GET /collections/mem" || requests[1] != "PUT /collections/mem" || requests[2] != "PUT /collections/mem/points" {
+		t.Fatalf("Expected the collection to be created before the upsert, got %v", requests)
+	}
+	if size := bodies[1]["vectors"].(map[string]interface{})["size"]; size != float64(2) {
+		t.Errorf("Expected the collection size from the vector, got %v", size)
+	}
+	point := bodies[2]["points"].([]interface{})[0].(map[string]interface{})
+	payload := point["payload"].(map[string]interface{})
+	if payload["namespace"] != "ns" || payload["source"] != "history" || payload["date"] != float64(1000) || payload["doc_id"] != "ns|history|abc" {
+		t.Errorf("Unexpected point payload: %v", payload)
+	}
+	if _, hasText := payload["text"]; hasText {
+		t.Error("Expected chunk text to stay out of the store")
+	}
+
+	requests, bodies = nil, nil
+	matches, err := vectors.Query(ctx, []float64{1, 0}, memory.VectorFilter{
+		Namespace:    "ns",
+		SearchFilter: memory.SearchFilter{Sources: []string{"history"}, Since: time.UnixMilli(500), Until: time.UnixMilli(2000)},
+	}, 5)
+	if err != nil || len(matches) != 1 || matches[0].ID != "ns|history|abc" || matches[0].Score != 0.9 {
+		t.Fatalf("Expected the stored document, got %+v (err %v)", matches, err)
+	}
+	filter, _ := json.Marshal(bodies[0]["filter"])
+	want := `{"must":[{"key":"namespace","match":{"value":"ns"}},{"key":"source","match":{"any":["history"]}},` +
+		`{"key":"date","range":{"gte":500}},{"key":"date","range":{"gt":0,"lt":2000}}]}`
+	if string(filter) != want {
+		t.Errorf("Unexpected search filter:\n got %s\nwant %s", filter, want)
+	}
+
+	requests, bodies = nil, nil
+	if err := vectors.Delete(ctx, "ns|history|abc"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := vectors.DeleteNamespace(ctx, "ns"); err != nil {
+		t.Fatalf("DeleteNamespace failed: %v", err)
+	}
+	if len(requests) != 2 || requests[0] != "POST /collections/mem/points/delete" || requests[1] != "POST /collections/mem/points/delete" {
+		t.Fatalf("Expected two deletes, got %v", requests)
+	}
+	if ids := bodies[0]["points"].([]interface{}); len(ids) != 1 || ids[0] == "ns|history|abc" {
+		t.Errorf("Expected the document ID mapped to a UUID, got %v", ids)
+	}
+	if _, ok := bodies[1]["filter"]; !ok {
+		t.Errorf("Expected the namespace delete to use a filter, got %v", bodies[1])
+	}
+
+	if _, err := memory.NewVectorStore(config.VectorStoreConfig{Backend: "embedded"}); err != nil {
+		t.Errorf("Expected the embedded backend to need no store, got %v", err)
+	}
+	if _, err := memory.NewVectorStore(config.VectorStoreConfig{Backend: "faiss"}); err == nil {
+		t.Error("Expected an unknown backend to be rejected")
+	}
+}
@@ -0,0 +1,373 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"nanotalon/config"
+	"nanotalon/session"
+)
+
+// TestSessionPersistence checks that sessions survive a restart of the session manager
+func TestSessionPersistence(t *testing.T) {
+	workspace := t.TempDir()
+
+	manager := session.NewSessionManager(workspace)
+	if err := manager.SaveMessage("telegram:42", "user", "hello"); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+	if err := manager.SaveMessage("telegram:42", "assistant", "hi there"); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+	if err := manager.UpdateSessionData("telegram:42", map[string]interface{}{"model": "gpt-4o-mini"}); err != nil {
+		t.Fatalf("Failed to update session data: %v", err)
+	}
+	if err := manager.SaveMessage("telegram:42", "user", "after data update"); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+	if err := manager.SaveMessage("cli_direct", "user", "separate session"); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+	t.Logf("✓ Saved messages to two sessions")
+
+	files, _ := filepath.Glob(filepath.Join(workspace, "sessions", "*.jsonl"))
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 session files, got %v", files)
+	}
+
+	// A fresh manager loads sessions lazily from disk
+	restarted := session.NewSessionManager(workspace)
+	history, err := restarted.GetMessageHistory("telegram:42", 10)
+	if err != nil {
+		t.Fatalf("Failed to load persisted history: %v", err)
+	}
+	if len(history) != 3 || history[0].Content != "hello" || history[2].Content != "after data update" {
+		t.Errorf("Unexpected persisted history: %+v", history)
+	} else {
+		t.Logf("✓ Loaded %d persisted messages after restart", len(history))
+	}
+
+	data, err := restarted.GetData("telegram:42")
+	if err != nil || data["model"] != "gpt-4o-mini" {
+		t.Errorf("Session data was not persisted: %v (err %v)", data, err)
+	}
+
+	if sessions := restarted.ListSessions(); len(sessions) != 2 {
+		t.Errorf("Expected ListSessions to include 2 persisted sessions, got %d", len(sessions))
+	}
+
+	// A partial trailing line from a crash is ignored
+	for _, file := range files {
+		f, _ := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0600)
+		f.WriteString(`{"id":"msg_partial","role":"us`)
+		f.Close()
+	}
+	recovered := session.NewSessionManager(workspace)
+	if err := recovered.SaveMessage("cli_direct", "user", "after crash"); err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+	history, err = session.NewSessionManager(workspace).GetMessageHistory("cli_direct", 10)
+	if err != nil || len(history) != 2 || history[1].Content != "after crash" {
+		t.Errorf("Expected 2 messages around a truncated line, got %+v (err %v)", history, err)
+	} else {
+		t.Logf("✓ Skipped truncated trailing line")
+	}
+
+	if err := restarted.DeleteSession("telegram:42"); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+	if _, exists := session.NewSessionManager(workspace).GetSession("telegram:42"); exists {
+		t.Errorf("Deleted session should not be loaded again")
+	} else {
+		t.Logf("✓ Deleted session removed from disk")
+	}
+}
+
+// TestSQLiteSessionStore checks the SQLite backend round-trips sessions across restarts
+func TestSQLiteSessionStore(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := config.SessionConfig{Store: "sqlite"}
+
+	store, err := session.NewStore(cfg, workspace)
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	manager := session.NewSessionManagerWithStore(workspace, store)
+	for i, content := range []string{"one", "two", "three"} {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		if err := manager.SaveMessage("slack:C123", role, content); err != nil {
+			t.Fatalf("Failed to save message: %v", err)
+		}
+	}
+	if err := manager.UpdateSessionData("slack:C123", map[string]interface{}{"persona": "terse"}); err != nil {
+		t.Fatalf("Failed to update session data: %v", err)
+	}
+	manager.SaveMessage("discord:9", "user", "other")
+	manager.Close()
+	t.Logf("✓ Wrote sessions to SQLite")
+
+	if _, err := os.Stat(filepath.Join(workspace, "sessions", "sessions.db")); err != nil {
+		t.Fatalf("Expected database file: %v", err)
+	}
+
+	store, err = session.NewStore(cfg, workspace)
+	if err != nil {
+		t.Fatalf("Failed to reopen SQLite store: %v", err)
+	}
+	restarted := session.NewSessionManagerWithStore(workspace, store)
+	defer restarted.Close()
+
+	history, err := restarted.GetMessageHistory("slack:C123", 2)
+	if err != nil || len(history) != 2 || history[0].Content != "two" || history[1].Content != "three" {
+		t.Errorf("Unexpected history from SQLite: %+v (err %v)", history, err)
+	} else {
+		t.Logf("✓ Loaded recent history from SQLite")
+	}
+
+	data, _ := restarted.GetData("slack:C123")
+	if data["persona"] != "terse" {
+		t.Errorf("Session data was not persisted: %v", data)
+	}
+
+	sessions := restarted.ListSessions()
+	if len(sessions) != 2 {
+		t.Errorf("Expected 2 sessions, got %d", len(sessions))
+	}
+
+	if err := restarted.ClearSession("slack:C123"); err != nil {
+		t.Fatalf("Failed to clear session: %v", err)
+	}
+	if err := restarted.DeleteSession("discord:9"); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+	for _, info := range restarted.ListSessions() {
+		if info["key"] == "discord:9" {
+			t.Errorf("Deleted session still listed")
+		}
+		if info["key"] == "slack:C123" && info["message_count"] != 0 {
+			t.Errorf("Cleared session still has %v messages", info["message_count"])
+		}
+	}
+	t.Logf("✓ Clear and delete applied to SQLite")
+}
+
+// TestTokenBudgetTrimming checks history is trimmed oldest-first while keeping system and last user messages
+func TestTokenBudgetTrimming(t *testing.T) {
+	long := strings.Repeat("word ", 200) // ~250 tokens
+	history := []session.Message{
+		{Role: "system", Content: "summary of earlier conversation"},
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: long},
+		{Role: "user", Content: "short question"},
+		{Role: "assistant", Content: "short answer"},
+		{Role: "user", Content: long},
+	}
+
+	if got := session.TrimToTokenBudget(history, 0); len(got) != len(history) {
+		t.Errorf("A zero budget should disable trimming")
+	}
+
+	trimmed := session.TrimToTokenBudget(history, 300)
+	var roles []string
+	for _, m := range trimmed {
+		roles = append(roles, m.Role+":"+m.Content[:5])
+	}
+	want := []string{"system:summa", "user:short", "assistant:short", "user:word "}
+	if strings.Join(roles, ",") != strings.Join(want, ",") {
+		t.Errorf("Unexpected trimmed history: got %v, want %v", roles, want)
+	} else {
+		t.Logf("✓ Trimmed history to %d messages", len(trimmed))
+	}
+
+	// The last user turn survives even when it alone exceeds the budget
+	trimmed = session.TrimToTokenBudget(history, 10)
+	if len(trimmed) != 2 || trimmed[0].Role != "system" || trimmed[1].Content != long {
+		t.Errorf("Expected only system prompt and last user turn, got %d messages", len(trimmed))
+	}
+
+	if session.EstimateTokens("你好世界") != 4 || session.EstimateTokens("abcdefgh") != 2 {
+		t.Errorf("Unexpected token estimates: %d, %d", session.EstimateTokens("你好世界"), session.EstimateTokens("abcdefgh"))
+	}
+}
+
+// TestSessionSummaryState checks the rolling summary survives restarts and hides summarized turns
+func TestSessionSummaryState(t *testing.T) {
+	workspace := t.TempDir()
+	manager := session.NewSessionManager(workspace)
+	for i := 1; i <= 6; i++ {
+		manager.SaveMessage("cli:direct", "user", fmt.Sprintf("message %d", i))
+	}
+
+	if err := manager.SetSummary("cli:direct", "user counted to four", 4); err != nil {
+		t.Fatalf("Failed to set summary: %v", err)
+	}
+	if err := manager.SetSummary("cli:direct", "too far", 7); err == nil {
+		t.Errorf("Expected an error for a summary covering more messages than exist")
+	}
+
+	restarted := session.NewSessionManager(workspace)
+	summary, count, err := restarted.GetSummary("cli:direct")
+	if err != nil || summary != "user counted to four" || count != 4 {
+		t.Errorf("Unexpected summary after restart: %q, %d (err %v)", summary, count, err)
+	}
+
+	history, _ := restarted.GetUnsummarizedHistory("cli:direct", 10)
+	if len(history) != 2 || history[0].Content != "message 5" {
+		t.Errorf("Expected only the 2 unsummarized messages, got %+v", history)
+	} else {
+		t.Logf("✓ Summarized turns excluded from history")
+	}
+
+	restarted.ClearSession("cli:direct")
+	if summary, count, _ := restarted.GetSummary("cli:direct"); summary != "" || count != 0 {
+		t.Errorf("Clearing a session should drop its summary")
+	}
+}
+
+// TestListSessionInfo checks session summaries are ordered by last activity and expose their channel
+func TestListSessionInfo(t *testing.T) {
+	workspace := t.TempDir()
+	manager := session.NewSessionManager(workspace)
+	manager.SaveMessage("telegram:42", "user", "first")
+	time.Sleep(10 * time.Millisecond)
+	manager.SaveMessage("slack:C1", "user", "second")
+	manager.SaveMessage("slack:C1", "assistant", "reply")
+
+	infos := session.NewSessionManager(workspace).ListSessionInfo()
+	if len(infos) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(infos))
+	}
+	if infos[0].Key != "slack:C1" || infos[0].Channel() != "slack" || infos[0].MessageCount != 2 {
+		t.Errorf("Expected most recent session first, got %+v", infos[0])
+	}
+	if infos[1].Channel() != "telegram" {
+		t.Errorf("Unexpected channel for %s: %s", infos[1].Key, infos[1].Channel())
+	}
+}
+
+// TestToolMessagesPersisted checks tool calls and results round-trip and orphaned halves are repaired
+func TestToolMessagesPersisted(t *testing.T) {
+	workspace := t.TempDir()
+	manager := session.NewSessionManager(workspace)
+	manager.SaveMessage("cli:direct", "user", "what's in the workspace?")
+	manager.AppendMessage("cli:direct", session.Message{
+		Role:      "assistant",
+		ToolCalls: []session.ToolCall{{ID: "call_1", Name: "list_dir", Arguments: map[string]interface{}{"path": "."}}},
+	})
+	manager.AppendMessage("cli:direct", session.Message{Role: "tool", ToolCallID: "call_1", Name: "list_dir", Content: "notes.md"})
+	manager.SaveMessage("cli:direct", "assistant", "Just notes.md")
+
+	history, err := session.NewSessionManager(workspace).GetMessageHistory("cli:direct", 10)
+	if err != nil || len(history) != 4 {
+		t.Fatalf("Expected 4 persisted messages, got %d (err %v)", len(history), err)
+	}
+	if len(history[1].ToolCalls) != 1 || history[1].ToolCalls[0].Arguments["path"] != "." {
+		t.Errorf("Tool call was not persisted: %+v", history[1])
+	}
+	if history[2].ToolCallID != "call_1" || history[2].Name != "list_dir" {
+		t.Errorf("Tool result was not persisted: %+v", history[2])
+	}
+
+	if repaired := session.RepairToolCalls(history); len(repaired) != 4 {
+		t.Errorf("A complete exchange should be kept, got %d messages", len(repaired))
+	}
+	// A window starting at the tool result has lost its call
+	if repaired := session.RepairToolCalls(history[2:]); len(repaired) != 1 || repaired[0].Role != "assistant" {
+		t.Errorf("Expected the orphaned tool result to be dropped, got %+v", repaired)
+	}
+	// A window ending at the call has lost its result
+	if repaired := session.RepairToolCalls(history[:2]); len(repaired) != 1 {
+		t.Errorf("Expected the unanswered tool call to be dropped, got %+v", repaired)
+	}
+}
+
+// TestSessionSettings checks recognized settings are parsed, stored and cleared
+func TestSessionSettings(t *testing.T) {
+	manager := session.NewSessionManager(t.TempDir())
+	manager.GetOrCreateSession("telegram:1")
+
+	if _, _, err := session.ParseSetting("temperature", "3"); err == nil {
+		t.Errorf("Expected an error for an out-of-range temperature")
+	}
+	if _, _, err := session.ParseSetting("colour", "blue"); err == nil {
+		t.Errorf("Expected an error for an unknown setting")
+	}
+
+	key, value, err := session.ParseSetting("persona", "Be brief.")
+	if err != nil || key != session.DataKeySystemPromptExtra {
+		t.Fatalf("Expected persona to map to %s, got %q (err %v)", session.DataKeySystemPromptExtra, key, err)
+	}
+	_, temperature, _ := session.ParseSetting("temperature", "0.3")
+	manager.UpdateSessionData("telegram:1", map[string]interface{}{
+		key:                        value,
+		session.DataKeyModel:       "openai/gpt-4o-mini",
+		session.DataKeyTemperature: temperature,
+	})
+
+	settings, err := manager.GetSettings("telegram:1")
+	if err != nil || settings.Model != "openai/gpt-4o-mini" || settings.SystemPromptExtra != "Be brief." ||
+		settings.Temperature == nil || *settings.Temperature != 0.3 {
+		t.Errorf("Unexpected settings: %+v (err %v)", settings, err)
+	}
+
+	manager.UpdateSessionData("telegram:1", map[string]interface{}{session.DataKeyModel: nil})
+	if settings, _ := manager.GetSettings("telegram:1"); settings.Model != "" {
+		t.Errorf("Expected a nil value to clear the model, got %q", settings.Model)
+	}
+	if settings, _ := manager.GetSettings("slack:unknown"); settings.Model != "" || settings.Temperature != nil {
+		t.Errorf("Expected no overrides for a missing session, got %+v", settings)
+	}
+}
+
+// TestSessionCheckpoints checks rollback and branching restore history and data from a checkpoint
+func TestSessionCheckpoints(t *testing.T) {
+	workspace := t.TempDir()
+	manager := session.NewSessionManager(workspace)
+	manager.SaveMessage("telegram:7", "user", "keep me")
+	manager.UpdateSessionData("telegram:7", map[string]interface{}{session.DataKeyModel: "openai/gpt-4o-mini"})
+
+	checkpoint, err := manager.CreateCheckpoint("telegram:7", "")
+	if err != nil || checkpoint.Name != "cp-1" || checkpoint.MessageCount != 1 {
+		t.Fatalf("Unexpected checkpoint %+v (err %v)", checkpoint, err)
+	}
+
+	manager.SaveMessage("telegram:7", "user", "off the rails")
+	manager.UpdateSessionData("telegram:7", map[string]interface{}{session.DataKeyModel: "bad/model"})
+	manager.CreateCheckpoint("telegram:7", "later")
+
+	// Branch before rolling back; the checkpoint survives a restart
+	restarted := session.NewSessionManager(workspace)
+	if err := restarted.BranchSession("telegram:7", "cp-1", "telegram:7-branch"); err != nil {
+		t.Fatalf("Failed to branch: %v", err)
+	}
+	if err := restarted.RollbackToCheckpoint("telegram:7", "cp-1"); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+
+	for _, key := range []string{"telegram:7", "telegram:7-branch"} {
+		history, _ := restarted.GetMessageHistory(key, 10)
+		settings, _ := restarted.GetSettings(key)
+		if len(history) != 1 || history[0].Content != "keep me" || settings.Model != "openai/gpt-4o-mini" {
+			t.Errorf("%s: expected state at cp-1, got %d messages and model %q", key, len(history), settings.Model)
+		}
+	}
+
+	if checkpoints, _ := restarted.ListCheckpoints("telegram:7"); len(checkpoints) != 1 {
+		t.Errorf("Expected checkpoints after cp-1 to be dropped, got %+v", checkpoints)
+	}
+	if err := restarted.BranchSession("telegram:7", "", "telegram:7-branch"); err == nil {
+		t.Errorf("Expected an error when branching onto an existing session")
+	}
+
+	restarted.ClearSession("telegram:7-branch")
+	restarted.SaveMessage("telegram:7-branch", "user", "new start")
+	if err := restarted.RollbackToCheckpoint("telegram:7-branch", "cp-1"); err == nil {
+		t.Errorf("Expected clearing a session to drop its checkpoints")
+	}
+}